@@ -14,12 +14,18 @@ import (
 	"bufio"         // bufio 用于缓冲读取
 	"context"       // context 用于控制并发和取消操作
 	"encoding/json" // json 用于解析消息 JSON
+	"errors"        // errors 用于判断错误类型
 	"flag"          // flag 用于解析命令行参数
 	"fmt"           // fmt 用于格式化输出
+	"io"            // io 用于读取标准输入
 	"log"           // log 用于日志记录
+	"net/http"      // http 用于 Gateway HTTP 端点
+	"net/url"       // url 用于转义管理接口路径
 	"os"            // os 用于操作系统功能
 	"os/signal"     // os/signal 用于捕获系统信号
 	"path/filepath" // filepath 用于处理文件路径
+	"sort"          // sort 用于排序任务列表
+	"strconv"       // strconv 用于解析数字参数
 	"strings"       // strings 用于字符串操作
 	"sync"          // sync 用于同步和 WaitGroup
 	"syscall"       // syscall 用于系统调用
@@ -27,16 +33,37 @@ import (
 
 	// 内部包导入
 	"github.com/Ailoc/nanogrip/internal/agent"     // Agent 核心逻辑
+	"github.com/Ailoc/nanogrip/internal/audit"     // 工具调用审计日志
+	"github.com/Ailoc/nanogrip/internal/backup"    // 工作区备份
+	"github.com/Ailoc/nanogrip/internal/budget"    // 每日花费上限
 	"github.com/Ailoc/nanogrip/internal/bus"       // 消息总线
 	"github.com/Ailoc/nanogrip/internal/channels"  // 通信通道
 	"github.com/Ailoc/nanogrip/internal/config"    // 配置管理
 	"github.com/Ailoc/nanogrip/internal/cron"      // 定时任务服务
+	"github.com/Ailoc/nanogrip/internal/doctor"    // 运行环境检查
+	"github.com/Ailoc/nanogrip/internal/email"     // 邮件收发
+	"github.com/Ailoc/nanogrip/internal/gateway"   // Gateway HTTP 服务
+	"github.com/Ailoc/nanogrip/internal/i18n"      // 系统文本本地化
+	"github.com/Ailoc/nanogrip/internal/lifecycle" // 启动/退出记录与主人通知
 	"github.com/Ailoc/nanogrip/internal/mcp"       // MCP 客户端
+	"github.com/Ailoc/nanogrip/internal/outbox"    // 出站消息归档
+	"github.com/Ailoc/nanogrip/internal/paths"     // 跨平台路径处理
+	"github.com/Ailoc/nanogrip/internal/presets"   // 工作区初始化预设
 	"github.com/Ailoc/nanogrip/internal/providers" // LLM 提供商
+	"github.com/Ailoc/nanogrip/internal/ratelimit" // 限流和每日额度
+	"github.com/Ailoc/nanogrip/internal/redact"    // 密钥脱敏
+	"github.com/Ailoc/nanogrip/internal/secrets"   // 静态数据加密
 	"github.com/Ailoc/nanogrip/internal/session"   // 会话管理
+	"github.com/Ailoc/nanogrip/internal/skills"    // 技能管理
+	"github.com/Ailoc/nanogrip/internal/templates" // 消息模板
 	"github.com/Ailoc/nanogrip/internal/tools"     // 工具集
+	"github.com/Ailoc/nanogrip/internal/trace"     // 请求追踪
+	"github.com/Ailoc/nanogrip/internal/watch"     // 工作区文件监视
 )
 
+// version 当前版本，发布构建时通过 -ldflags "-X main.version=v1.2.3" 注入
+var version = "dev"
+
 // CLIFlags 命令行参数结构体
 type CLIFlags struct {
 	config  string // 配置文件路径
@@ -80,7 +107,7 @@ func (w *terminalLogWriter) Write(p []byte) (int, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	message := strings.TrimRight(string(p), "\r\n")
+	message := strings.TrimRight(redact.String(string(p)), "\r\n")
 	message = strings.TrimLeft(message, "\r\n")
 	if message == "" {
 		return len(p), nil
@@ -142,9 +169,19 @@ func showHelp() {
 	fmt.Println("命令:")
 	fmt.Println("  agent [消息]  与 Agent 对话 (支持交互模式和单条消息模式)")
 	fmt.Println("  gateway       启动 Web Gateway (默认)")
+	fmt.Println("  daemon        在后台运行 Gateway (start|stop|status)")
 	fmt.Println("  status        查看服务状态")
 	fmt.Println("  init          初始化工作区")
 	fmt.Println("  cron          管理定时任务")
+	fmt.Println("  outbox        查询出站消息归档")
+	fmt.Println("  audit         查询工具调用审计日志")
+	fmt.Println("  sessions      列出保存的会话 (标题、频道、消息数、最后活动时间)")
+	fmt.Println("  backup        备份和恢复工作区 (create|list|restore)")
+	fmt.Println("  secrets       管理静态数据加密 (init|encrypt|encrypt-config|encrypt-sessions)")
+	fmt.Println("  mcp-serve     作为 MCP 服务器提供工作区工具 (stdio，或 --sse <地址>)")
+	fmt.Println("  skills        管理技能 (list|enable|disable|install)")
+	fmt.Println("  replay        用当前提示词回放记录的会话并对比回复 (工具调用不会真正执行)")
+	fmt.Println("  doctor        检查工作区、模型提供商、频道凭据、网络搜索和 MCP 服务器")
 	fmt.Println("")
 	fmt.Println("选项:")
 	fmt.Println("  --config <路径>  指定配置文件路径")
@@ -155,6 +192,20 @@ func showHelp() {
 	fmt.Println("  nanogrip agent -m \"你好\"          # 单条消息模式")
 	fmt.Println("  nanogrip gateway                  # 启动 Gateway")
 	fmt.Println("  nanogrip status                   # 查看状态")
+	fmt.Println("  nanogrip daemon start             # 在后台启动 Gateway (日志写入工作区 nanogrip.log)")
+	fmt.Println("  nanogrip init --preset personal   # 使用预设初始化工作区 (personal|devops|research)")
+	fmt.Println("  nanogrip init --prompt-template   # 导出系统提示词模板到工作区 prompts/system.md 以便自定义")
+	fmt.Println("  nanogrip secrets init             # 生成加密密钥 (--keychain 保存到系统钥匙串)")
+	fmt.Println("  nanogrip cron list                # 查看运行中 gateway 的定时任务 (cron add|remove 管理任务，cron history 查看执行记录)")
+	fmt.Println("  nanogrip outbox --since 2026-01-01 --channel telegram --status failed")
+	fmt.Println("  nanogrip audit --session telegram:123 --tool shell --since 2026-01-01")
+	fmt.Println("  nanogrip sessions list --channel telegram --limit 10")
+	fmt.Println("  nanogrip backup create --encrypt   # 备份工作区 (backup list 查看，backup restore <文件> 恢复)")
+	fmt.Println("  nanogrip outbox failed            # 查看投递失败的消息 (outbox resend <序号...>|--all 重新发送)")
+	fmt.Println("  nanogrip skills install https://github.com/user/repo#skills/weather  # 从 git 仓库安装技能")
+	fmt.Println("  nanogrip replay workspace/sessions/telegram_123.jsonl  # 回放会话 (--model 指定模型)")
+	fmt.Println("  nanogrip doctor                   # 检查配置能否正常工作 (--skip-provider 跳过模型调用)")
+	fmt.Println("  nanogrip mcp-serve --sse 127.0.0.1:8765 --token secret --tools filesystem,todo")
 	fmt.Println("  nanogrip --config /path/to/config.yaml agent -m \"你好\"")
 }
 
@@ -167,9 +218,29 @@ func handleCommand(command, configPath string) {
 	case "status":
 		handleStatus(configPath)
 	case "init":
-		handleInit(configPath)
+		handleInit(configPath, flag.Args()[1:])
 	case "cron":
-		handleCron(configPath)
+		handleCron(configPath, flag.Args()[1:])
+	case "outbox":
+		handleOutbox(configPath, flag.Args()[1:])
+	case "secrets":
+		handleSecrets(configPath, flag.Args()[1:])
+	case "mcp-serve":
+		handleMCPServe(configPath, flag.Args()[1:])
+	case "skills":
+		handleSkills(configPath, flag.Args()[1:])
+	case "daemon":
+		handleDaemon(configPath, flag.Args()[1:])
+	case "replay":
+		handleReplay(configPath, flag.Args()[1:])
+	case "audit":
+		handleAudit(configPath, flag.Args()[1:])
+	case "doctor":
+		handleDoctor(configPath, flag.Args()[1:])
+	case "sessions":
+		handleSessions(configPath, flag.Args()[1:])
+	case "backup":
+		handleBackup(configPath, flag.Args()[1:])
 	case "gateway":
 		runGateway(configPath)
 	case "agent":
@@ -182,6 +253,7 @@ func handleCommand(command, configPath string) {
 }
 
 // handleStatus 查看服务状态
+// gateway 正在运行时通过管理接口查询实际的运行状态，否则显示配置
 func handleStatus(configPath string) {
 	// 加载配置
 	cfg, err := loadConfig(configPath)
@@ -193,6 +265,31 @@ func handleStatus(configPath string) {
 	workspace := cfg.GetWorkspacePath()
 	fmt.Println("=== nanogrip 状态 ===")
 	fmt.Printf("工作区: %s\n", workspace)
+
+	var status gatewayStatus
+	client := gateway.NewAdminClient(gateway.AdminSocketPath(workspace))
+	if err := client.Do(http.MethodGet, "/status", nil, &status); err == nil {
+		fmt.Printf("运行中: pid %d，版本 %s，已运行 %s（%s 启动）\n",
+			status.PID, status.Version, time.Since(status.StartedAt).Round(time.Second), status.StartedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("模型: %s\n", status.Model)
+		if len(status.Channels) > 0 {
+			fmt.Printf("通道: %s\n", strings.Join(status.Channels, ", "))
+		} else {
+			fmt.Println("通道: 无")
+		}
+		if len(status.Agents) > 0 {
+			fmt.Printf("Agent: %s\n", strings.Join(status.Agents, ", "))
+		}
+		fmt.Printf("定时任务: %d 个\n", status.CronJobs)
+		fmt.Printf("消息队列: 入站 %d（其中后台消息 %d），出站 %d\n", status.Inbound, status.InboundLow, status.Outbound)
+		return
+	}
+
+	if pid, err := lifecycle.RunningPid(lifecycle.PidFilePath(workspace)); err == nil {
+		fmt.Printf("运行中: pid %d（管理接口不可用，无法获取详细状态）\n", pid)
+	} else {
+		fmt.Println("未运行（使用 nanogrip gateway 或 nanogrip daemon start 启动）")
+	}
 	fmt.Printf("模型: %s\n", cfg.Agents.Defaults.Model)
 	fmt.Printf("最大令牌数: %d\n", cfg.Agents.Defaults.MaxTokens)
 	fmt.Printf("温度: %.1f\n", cfg.Agents.Defaults.Temperature)
@@ -202,18 +299,199 @@ func handleStatus(configPath string) {
 	if cfg.Channels.Telegram.Enabled {
 		fmt.Println("  ✓ Telegram 已启用")
 	}
+	if cfg.Channels.Discord.Enabled {
+		fmt.Println("  ✓ Discord 已启用")
+	}
+	if cfg.Channels.Feishu.Enabled {
+		fmt.Println("  ✓ 飞书已启用")
+	}
+	if cfg.Channels.Webhook.Enabled {
+		fmt.Printf("  ✓ Webhook 已启用（%d 个）\n", len(cfg.Channels.Webhook.Hooks))
+	}
 }
 
-// handleInit 初始化工作区
-func handleInit(configPath string) {
-	// 确定配置路径
-	if configPath == "" {
-		home, err := os.UserHomeDir()
+// handleDoctor 检查运行环境：工作区、模型提供商（含文本向量）、频道凭据、网络搜索和 MCP 服务器
+// 有检查失败时以状态码 1 退出
+func handleDoctor(configPath string, args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	skipProvider := fs.Bool("skip-provider", false, "不调用模型（避免产生费用）")
+	timeout := fs.Duration("timeout", doctor.DefaultTimeout, "每项检查的超时时间")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("✗ config: %v\n", err)
+		fmt.Println("  → 运行 nanogrip init 生成配置文件，或用 --config 指定配置文件路径（也可以用 NANOGRIP_* 环境变量提供配置）")
+		os.Exit(1)
+	}
+
+	checks := doctorChecks(cfg, cfg.GetWorkspacePath(), !*skipProvider)
+	for name, mcpCfg := range mcpConfigs(cfg) {
+		checks = append(checks, doctor.MCPServer(name, mcpCfg))
+	}
+
+	fmt.Println("=== nanogrip doctor ===")
+	results := doctor.Run(context.Background(), checks, *timeout)
+	fmt.Print(doctor.Format(results))
+	if failed := doctor.Failed(results); failed > 0 {
+		fmt.Printf("\n%d 项检查失败\n", failed)
+		os.Exit(1)
+	}
+	fmt.Println("\n全部检查通过")
+}
+
+// doctorChecks 返回 doctor 和 gateway 启动检查共用的检查项（不含 MCP 服务器）
+// 参数:
+//
+//	withProvider: 是否向模型发送一次测试对话
+func doctorChecks(cfg *config.Config, workspace string, withProvider bool) []doctor.Check {
+	checks := []doctor.Check{doctor.Workspace(workspace)}
+
+	if withProvider {
+		model := cfg.Agents.Defaults.Model
+		provider, err := newModelProvider(cfg, model)
+		checks = append(checks, doctor.Provider(provider, model, err))
+
+		if cfg.Providers.Embeddings.Provider != "" {
+			embeddings, err := newEmbeddingsProvider(cfg)
+			checks = append(checks, doctor.Embeddings(embeddings, cfg.Providers.Embeddings.Provider, err))
+		}
+	}
+
+	if cfg.Channels.Telegram.Enabled {
+		checks = append(checks, doctor.Channel("telegram", channels.NewTelegramChannel(&cfg.Channels.Telegram, nil),
+			"检查 channels.telegram.token（在 Telegram 中向 @BotFather 发送 /token 获取），以及本机能否访问 api.telegram.org（需要代理时设置 HTTPS_PROXY）"))
+	}
+	if cfg.Channels.Discord.Enabled {
+		checks = append(checks, doctor.Channel("discord", channels.NewDiscordChannel(&cfg.Channels.Discord, nil),
+			"检查 channels.discord.token（开发者后台 Bot 页面点击 Reset Token 获取），以及本机能否访问 discord.com"))
+	}
+	if cfg.Channels.Feishu.Enabled {
+		checks = append(checks, doctor.Channel("feishu", channels.NewFeishuChannel(&cfg.Channels.Feishu, nil),
+			"检查 channels.feishu.appId 和 appSecret（开发者后台的凭证与基础信息页面），国际版需要设置 domain: lark"))
+	}
+
+	search := cfg.Tools.Web.Search
+	if search.Provider != "" && search.Provider != "duckduckgo" {
+		searchTool := tools.NewWebSearchTool(search.APIKey, search.Provider, search.MaxResults)
+		searchTool.SetBaseURL(search.BaseURL)
+		searchTool.SetEngineID(search.CX)
+		checks = append(checks, doctor.WebSearch(searchTool, search.Provider))
+	}
+	return checks
+}
+
+// runStartupCheck 在 gateway 启动时检查模型提供商、频道凭据和网络搜索
+// 检查在后台进行，失败时只记录日志和修复建议，不影响启动
+func runStartupCheck(ctx context.Context, cfg *config.Config, workspace string) {
+	results := doctor.Run(ctx, doctorChecks(cfg, workspace, true), doctor.DefaultTimeout)
+	if ctx.Err() != nil {
+		return
+	}
+	failed := doctor.Failed(results)
+	if failed == 0 {
+		log.Printf("✓ 启动检查通过（%d 项）", len(results))
+		return
+	}
+	for _, r := range results {
+		if !r.OK() {
+			log.Printf("⚠ 启动检查失败 %s: %v → %s", r.Name, r.Err, r.Hint)
+		}
+	}
+	log.Printf("⚠ 启动检查: %d/%d 项失败，运行 nanogrip doctor 查看详情", failed, len(results))
+}
+
+// handleDaemon 在后台运行 gateway：daemon start|stop|status
+func handleDaemon(configPath string, args []string) {
+	if len(args) == 0 {
+		printDaemonUsage()
+		return
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("无法加载配置: %v\n", err)
+		return
+	}
+	workspace := cfg.GetWorkspacePath()
+	pidPath := lifecycle.PidFilePath(workspace)
+
+	switch args[0] {
+	case "start":
+		if pid, err := lifecycle.RunningPid(pidPath); err == nil {
+			fmt.Printf("nanogrip 已在运行 (pid %d)\n", pid)
+			return
+		}
+		if err := os.MkdirAll(workspace, 0755); err != nil {
+			fmt.Printf("创建工作区失败: %v\n", err)
+			return
+		}
+		var gatewayArgs []string
+		if configPath != "" {
+			gatewayArgs = append(gatewayArgs, "--config", configPath)
+		}
+		gatewayArgs = append(gatewayArgs, "gateway")
+		logPath := filepath.Join(workspace, lifecycle.LogFileName)
+		pid, err := lifecycle.Daemonize(gatewayArgs, logPath)
+		if err != nil {
+			fmt.Printf("启动失败: %v\n", err)
+			return
+		}
+
+		// 等待 gateway 写入进程 ID 文件，确认启动成功
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			if running, err := lifecycle.RunningPid(pidPath); err == nil && running == pid {
+				fmt.Printf("nanogrip 已在后台启动 (pid %d)，日志: %s\n", pid, logPath)
+				return
+			}
+			time.Sleep(200 * time.Millisecond)
+		}
+		fmt.Printf("nanogrip 未能启动，请查看日志: %s\n", logPath)
+	case "stop":
+		pid, err := lifecycle.RunningPid(pidPath)
 		if err != nil {
-			fmt.Printf("获取主目录失败: %v\n", err)
+			fmt.Println("nanogrip 未运行")
+			return
+		}
+		fmt.Printf("正在停止 nanogrip (pid %d)...\n", pid)
+		if err := lifecycle.StopProcess(pid, 30*time.Second); err != nil {
+			fmt.Printf("停止失败: %v\n", err)
 			return
 		}
-		configPath = filepath.Join(home, ".nanogrip", "config.yaml")
+		fmt.Println("nanogrip 已停止")
+	case "status":
+		handleStatus(configPath)
+	default:
+		fmt.Printf("未知的 daemon 子命令: %s\n\n", args[0])
+		printDaemonUsage()
+	}
+}
+
+// printDaemonUsage 打印 daemon 子命令的用法
+func printDaemonUsage() {
+	fmt.Println("后台运行:")
+	fmt.Println("  nanogrip daemon start    # 在后台启动 gateway，日志追加到工作区的 nanogrip.log")
+	fmt.Println("  nanogrip daemon stop     # 停止运行中的 gateway（包括前台和 systemd 启动的实例）")
+	fmt.Println("  nanogrip daemon status   # 查看运行状态（同 nanogrip status）")
+	fmt.Println("")
+	fmt.Println("使用 systemd 管理时，在 [Service] 中设置 Type=notify 和 ExecStart=nanogrip gateway，")
+	fmt.Println("gateway 启动完成后会通知 systemd")
+}
+
+// handleInit 初始化工作区
+// 可以通过 --preset 选择初始化预设；未指定且在终端中运行时交互式选择
+func handleInit(configPath string, args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	presetName := fs.String("preset", "", "初始化预设 (personal|devops|research|none)")
+	promptTemplate := fs.Bool("prompt-template", false, "把内置系统提示词模板写入工作区的 "+agent.SystemTemplatePath+" 以便自定义")
+	fs.Parse(args)
+
+	// 确定配置路径
+	configPath, err := resolveConfigPath(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
 
 	// 确保配置目录存在
@@ -234,111 +512,2966 @@ func handleInit(configPath string) {
 		fmt.Println("请编辑配置文件，添加您的 API 密钥")
 	}
 
-	// 加载配置
+	// 加载配置
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("无法加载配置: %v\n", err)
+		return
+	}
+
+	workspace := cfg.GetWorkspacePath()
+	if err := os.MkdirAll(workspace, 0755); err != nil {
+		fmt.Printf("创建工作区失败: %v\n", err)
+		return
+	}
+	fmt.Printf("工作区已创建: %s\n", workspace)
+
+	if *promptTemplate {
+		writePromptTemplate(workspace)
+	}
+
+	// 选择并安装预设
+	name := *presetName
+	if name == "" && isTerminal(os.Stdin) {
+		name = choosePreset()
+	}
+	if name == "" || name == "none" {
+		return
+	}
+	if _, ok := presets.Get(name); !ok {
+		fmt.Printf("未知的预设: %s（可选: personal, devops, research）\n", name)
+		return
+	}
+	installPreset(name, workspace, configPath)
+}
+
+// writePromptTemplate 把内置系统提示词模板写入工作区（已存在时不覆盖）
+// 修改后的模板在下一条消息时生效，删除文件即恢复内置模板
+func writePromptTemplate(workspace string) {
+	path := filepath.Join(workspace, agent.SystemTemplatePath)
+	if _, err := os.Stat(path); err == nil {
+		fmt.Printf("系统提示词模板已存在，未覆盖: %s\n", path)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Printf("创建模板目录失败: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(path, []byte(agent.DefaultSystemTemplate()), 0644); err != nil {
+		fmt.Printf("写入系统提示词模板失败: %v\n", err)
+		return
+	}
+	fmt.Printf("系统提示词模板已写入: %s\n", path)
+	fmt.Println("可用变量: {{.Time}} {{.Timezone}} {{.Workspace}} {{.MemoryDir}} {{.Runtime}} {{.Skills}}")
+}
+
+// choosePreset 交互式选择初始化预设，返回空字符串表示不使用预设
+func choosePreset() string {
+	available := presets.List()
+	fmt.Println("\n选择工作区预设:")
+	fmt.Println("  0) none      空白工作区")
+	for i, p := range available {
+		fmt.Printf("  %d) %-9s %s\n", i+1, p.Name, p.Description)
+	}
+	fmt.Print("请输入编号或名称 [0]: ")
+
+	input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	input = strings.TrimSpace(input)
+	if input == "" || input == "0" {
+		return ""
+	}
+	for i, p := range available {
+		if input == fmt.Sprint(i+1) || input == p.Name {
+			return p.Name
+		}
+	}
+	return input
+}
+
+// installPreset 安装预设文件，并把建议的定时任务写入配置
+// 只有配置中的 cron.jobs 仍为空列表时才自动写入，否则打印片段由用户自行添加
+func installPreset(name, workspace, configPath string) {
+	written, skipped, err := presets.Install(name, workspace)
+	if err != nil {
+		fmt.Printf("安装预设失败: %v\n", err)
+		return
+	}
+	fmt.Printf("已安装预设 %s:\n", name)
+	for _, f := range written {
+		fmt.Printf("  + %s\n", f)
+	}
+	for _, f := range skipped {
+		fmt.Printf("  = %s（已存在，未覆盖）\n", f)
+	}
+
+	jobs, err := presets.CronJobs(name)
+	if err != nil || jobs == "" {
+		return
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err == nil && strings.Contains(string(data), "\n  jobs: []\n") {
+		updated := strings.Replace(string(data), "\n  jobs: []\n", "\n  jobs:\n"+jobs, 1)
+		if err := os.WriteFile(configPath, []byte(updated), 0644); err == nil {
+			fmt.Printf("已在 %s 中添加预设的定时任务（发送给 notify.chatId，可在 cron.jobs 中修改）\n", configPath)
+			return
+		}
+	}
+	fmt.Println("\n建议的定时任务（请添加到配置文件的 cron.jobs 中）:")
+	fmt.Print(jobs)
+}
+
+// isTerminal 判断文件是否为交互式终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// getDefaultConfig 返回默认配置内容
+func getDefaultConfig() string {
+	return `# nanogrip 配置文件
+# 由 "nanogrip init" 生成；请填入至少一个模型提供商的 API Key。
+#
+# 任何字符串值都可以引用环境变量，避免明文保存密钥：
+#   apiKey: "${OPENAI_API_KEY}"        # 可与其他文本混用，${VAR:-默认值} 提供默认值
+#   token: !env TELEGRAM_BOT_TOKEN     # 整个值取自环境变量
+# 与本文件同目录的 .env 文件（KEY=VALUE 格式）会被自动加载，但不会覆盖已有的环境变量。
+# 也可以加密保存：先运行 "nanogrip secrets init" 生成密钥，再运行 "nanogrip secrets encrypt-config"，
+# 或用 "nanogrip secrets encrypt <值>" 生成 "enc:v1:..." 后手动填入。
+
+# Agent 配置
+agents:
+  defaults:
+    workspace: "~/.nanogrip/workspace"
+    # 支持格式:
+    #   - "anthropic/claude-opus-4-5"
+    #   - "openai/gpt-4.1"
+    #   - "openai/<OpenAI-compatible-model-or-endpoint-id>"
+    model: "anthropic/claude-opus-4-5"
+    fallbacks: []               # 备用模型（按顺序尝试），主模型报错、超时或被限流时改用，例如 ["openai/gpt-4o-mini"]
+    fallbackTimeout: 0          # 配置了备用模型时，单次请求最多等待的秒数，超时改用下一个，0 表示不限制
+    maxTokens: 8192
+    temperature: 0.7
+    maxToolIterations: 20
+    memoryWindow: 50
+    memoryScope: global      # 记忆范围：global 所有聊天共用一份记忆；chat 每个聊天独立（workspace/memory/<会话>/）
+    sharedMemory: false      # memoryScope 为 chat 时，是否同时加载全局的 memory/MEMORY.md（只读共享）
+    language: auto           # 系统消息（/help、错误回复、通知）的语言：auto 根据用户消息检测；en 或 zh 固定语言（模型也用该语言回复）
+    timezone: ""             # 默认时区（IANA 名称，如 Asia/Shanghai），为空使用服务器时区；用户可以用 /timezone 设置自己的时区
+    sessionIdleMinutes: 30   # 空闲会话卸载时间（分钟），负数表示禁用
+    maxConcurrentSubagents: 4   # 同时运行的后台子代理上限，负数表示不限制
+    subagentTimeout: 1800       # 单个子代理的运行时间上限（秒），超时后停止并通知来源聊天，负数表示不限制
+    maxConcurrentSessions: 4    # 同时处理消息的会话上限（同一会话内依次处理），1 表示全部依次处理，负数表示不限制
+    # 推理模型：effort 发送给 o 系列等 OpenAI 兼容模型，budgetTokens 开启 Claude 扩展思考
+    reasoning:
+      effort: ""               # low / medium / high，为空表示不发送
+      budgetTokens: 0          # Claude 扩展思考的 token 预算（至少 1024），0 表示不开启
+      log: false               # 把模型的思考过程写入日志
+      showInCli: false         # 在 CLI 回复前显示折叠的思考过程
+    # 记忆整理：把旧消息提炼到 MEMORY.md 和 HISTORY.md
+    consolidation:
+      model: ""                # 整理使用的模型（例如更便宜的 "openai/gpt-4o-mini"），为空表示使用主模型
+      timeout: 120             # 单次整理的超时时间（秒）
+      threshold: 0             # 未整理的消息达到多少条时整理，0 表示 memoryWindow/2
+      batchSize: 0             # 每次整理的消息条数，0 表示与 threshold 相同
+      keepRecent: 0            # 最近的多少条消息不参与整理
+      idleSeconds: 0           # 会话空闲多少秒后再整理（积压的消息一次整理完），0 表示达到阈值后立即整理
+      userProfile: "off"       # 同时学习用户档案 USER.md：off 关闭；confirm 发送提议，管理员用 /profile accept 接受；auto 直接写入
+  # 多 Agent（仅 gateway 模式，修改后需重启）：每个 Agent 有自己的工作区、模型、工具和会话
+  # 路由顺序：聊天中 /agent <名称> 的选择 > chatIds > channels > 上面的默认 Agent
+  instances: []
+  # - name: "coder"
+  #   model: "openai/gpt-4.1"              # 默认与 defaults.model 相同
+  #   workspace: "~/.nanogrip/workspace-coder"   # 默认为 defaults.workspace 加上 "-<名称>"
+  #   systemPrompt: "You are a senior Go engineer. Keep answers short and show code."
+  #   tools: ["filesystem", "shell", "web_*"] # 允许的工具（支持 * 通配符），为空表示全部
+  #   channels: []                          # 该频道的所有消息交给此 Agent
+  #   chatIds: ["telegram:123456789"]       # 这些聊天交给此 Agent
+  # 按复杂度选择模型：简单的请求（问候、简短问答）交给便宜快速的模型，复杂任务仍使用主模型
+  # 附件、超过 maxChars 或多行的消息、代码块、链接和包含 keywords 的消息视为复杂；会话用 /model 切换过模型时不路由
+  routing:
+    model: ""                  # 简单请求使用的模型，例如 "openai/gpt-4o-mini"，为空表示不路由
+    maxChars: 200              # 超过多少个字符视为复杂，负数表示不按长度判断
+    # keywords: ["plan", "research", "计划"]   # 视为复杂的关键词，不设置时使用内置列表
+    classifier: false          # 规则判断为简单时，再让简单请求的模型做一次分类调用确认
+
+# 通信通道配置
+channels:
+  telegram:
+    enabled: false
+    token: ""
+    allowFrom: []
+    replyToMessage: false
+    # 回复模式：reply（回复所有消息）| observe（旁听：群聊消息只记入历史，只回复私聊、@机器人、回复机器人的消息和命令；
+    # 需要在 BotFather 中关闭 Privacy Mode）。feishu 也支持 mode
+    mode: "reply"
+    # 两段式响应：需要调用工具的较慢回合先发一条简短确认，完整回复稍后送达
+    ack:
+      enabled: false
+      delaySeconds: 0        # 超过多少秒仍未完成才发送确认，0 表示开始调用工具时立即发送
+      message: "⏳ On it — working on {tools}…"
+      useModelText: true     # 优先使用模型在调用工具前输出的文字（无额外开销）
+    typing: true             # 处理期间显示"正在输入…"
+    progressUpdates: false   # 开始执行待办中的某一步时发送进度提示，例如 "Step 3/5: 生成图片"；
+                             # 运行较久的 shell 命令和 web_fetch 下载也会定期报告最新的输出行或下载进度
+    # 确认、进度提示和最终回复合并为一条消息：之后的内容通过编辑这条消息显示（需要启用 ack 或 progressUpdates；
+    # 编辑不产生新通知，最终回复送达时不会提醒）
+    editReplies: false
+    # 用表情回应用户的消息：开始处理时 working，完成后换成 done（Telegram 只支持固定的一组表情）
+    reactions:
+      enabled: false
+      working: "👀"
+      done: "👌"
+    # 免打扰时段：定时任务、子代理结果等后台消息暂存，结束时合并为一条发送（直接回复不受影响）
+    # discord 和 feishu 也支持同样的 quietHours 配置
+    quietHours:
+      enabled: false
+      start: "23:00"
+      end: "07:00"
+  # Discord：通过斜杠命令 /ask、/new、/task 交互（需要 gateway.port，并在开发者后台
+  # 把 Interactions Endpoint URL 设置为 https://<你的域名>/discord/interactions）
+  discord:
+    enabled: false
+    token: ""
+    applicationId: ""
+    publicKey: ""
+    guildId: ""              # 只在指定服务器注册命令（立即生效），为空表示全局命令
+    allowFrom: []
+  # 飞书（Lark）：事件订阅请求地址设置为 https://<你的域名>/feishu/events（需要 gateway.port），
+  # 订阅 im.message.receive_v1 事件，并开通 im:message、im:resource 权限
+  feishu:
+    enabled: false
+    appId: ""
+    appSecret: ""
+    encryptKey: ""           # 事件加密密钥，为空表示不加密
+    verificationToken: ""
+    domain: "feishu"         # feishu 或 lark（国际版）
+    mode: "reply"            # observe：群聊消息只记入历史，只回复私聊和 @机器人（需要"获取群组中所有消息"权限）
+    allowFrom: []            # 用户 open_id
+  # Webhook：外部系统（GitHub、Grafana 告警、家庭自动化等）向 POST /hooks/<名称> 推送事件（需要 gateway.port），
+  # 事件交给 Agent 处理，回复转发到 channel/chatId（默认与 notify 相同）
+  # 事件内容来自外部，处理时默认文件系统只读且不能执行命令；确实需要时在 hook 上设置 fullTools: true
+  webhook:
+    enabled: false
+    hooks: []
+    # - name: "github"
+    #   secret: ""                              # HMAC-SHA256 签名密钥（GitHub Webhook 的 Secret）
+    #   signatureHeader: "X-Hub-Signature-256"  # 签名所在的请求头
+    #   prompt: "Summarize this GitHub event in one or two sentences."
+    #   fullTools: false                        # true 表示可以使用全部工具（包括 shell）
+    # - name: "home"
+    #   token: ""                               # 不支持签名的来源：X-Webhook-Token 头或 ?token= 参数
+  # 出站投递：每个频道独立排队，一个频道变慢不影响其他频道
+  # 最终发送失败的消息写入工作区的 outbox-failed.jsonl，可用 nanogrip outbox failed / resend 查看和补发
+  outbound:
+    queueSize: 1000    # 每个频道的队列长度
+    maxAttempts: 3     # 每条消息最多发送次数（含第一次）
+    retryDelay: 2      # 第一次重试前等待的秒数，之后每次翻倍
+  # 用户发送的图片和文件下载到工作区的 media/ 目录，Agent 收到的是文件路径
+  media:
+    maxSizeMB: 20      # 单个文件的大小上限
+    allowedTypes: []   # 允许的 MIME 类型（如 "image/"、"application/pdf"），为空表示不限制
+    retentionDays: 7   # 文件保留天数，负数表示永久保留
+
+# LLM 提供商配置
+# 当前只支持 OpenAI SDK 路径和 Anthropic SDK 路径。
+providers:
+  openai:
+    apiKey: ""   # 或设置环境变量 OPENAI_API_KEY
+    apiBase: ""  # 可选；OpenAI-compatible 服务填写基础地址，不要包含 /chat/completions
+                 # 例如 Doubao Ark: "https://ark.cn-beijing.volces.com/api/v3"
+
+  anthropic:
+    apiKey: ""   # 或设置环境变量 ANTHROPIC_API_KEY
+    apiBase: ""  # 可选；通常留空
+  # 语音转写（可选）：把语音消息转成文字后再交给 Agent
+  transcription:
+    provider: ""        # "openai"（Whisper API，复用 providers.openai）、"command"（本地命令），留空禁用
+    model: "whisper-1"
+    language: ""        # 可选，如 "zh"
+    command: ""         # provider=command 时使用，{file} 会被替换为音频文件路径，例如 whisper.cpp:
+                        # "ffmpeg -loglevel error -y -i {file} -ar 16000 -ac 1 {file}.wav && whisper-cli -m ~/models/ggml-base.bin -nt -np -f {file}.wav"
+  # 文本向量（可选）：用于向量记忆和语义检索，与对话模型分开配置
+  embeddings:
+    provider: ""        # "openai"（OpenAI 兼容接口）、"ollama"，留空禁用
+    model: ""           # 默认 openai: text-embedding-3-small，ollama: nomic-embed-text
+    apiKey: ""          # openai 留空时复用 providers.openai
+    apiBase: ""         # OpenAI 兼容服务的 /v1 地址；ollama 默认 http://localhost:11434
+    dimensions: 0       # 可选，仅 text-embedding-3 系列支持
+
+# 工具配置
+tools:
+  web:
+    search:
+      provider: "tavily"    # tavily / brave / searxng / google / duckduckgo
+      apiKey: ""            # Tavily、Brave 或 Google API Key（searxng 和 duckduckgo 不需要）
+      maxResults: 5
+      baseUrl: ""           # SearXNG 实例地址，例如 http://localhost:8888（需在实例中启用 json 格式）
+      cx: ""                # Google Custom Search 搜索引擎 ID
+      fallback: "duckduckgo" # 主提供商未配置或失败时退回到 DuckDuckGo，设为 "none" 关闭
+    # 网页抓取（web_fetch）：下载网页并转换为 Markdown
+    fetch:
+      timeout: 30
+      maxBytes: 2097152   # 最多下载 2MB
+      maxChars: 20000     # 默认返回给模型的最大字符数
+    # 通用 HTTP 请求（http_request）：调用 API（智能家居、GitHub、天气等），不需要通过 shell 执行 curl
+    # allowDomains 为空时不启用；域名同时匹配子域名，"*" 表示所有域名；denyDomains 优先
+    http:
+      allowDomains: []    # 例如 ["api.github.com", "homeassistant.local:8123"]
+      denyDomains: []
+      headers: {}         # 按域名自动添加的请求头，例如 {"api.github.com": {"Authorization": "Bearer ${GITHUB_TOKEN}"}}
+      timeout: 30
+      maxChars: 20000     # 返回给模型的响应正文的最大字符数
+
+  exec:
+    timeout: 60
+    # 执行命令的 shell：留空自动选择（Windows 上为 pwsh 或 powershell，其他系统为 sh）| sh | bash | powershell | pwsh | cmd
+    shell: ""
+    # 命令执行沙箱：none（直接在主机执行）| bwrap（需安装 bubblewrap）| docker
+    # 沙箱中系统目录只读，只有工作空间可写，主目录和配置文件（含密钥）不可见，远程聊天用户无法破坏主机或读取密钥
+    sandbox: "none"
+    sandboxImage: "debian:stable-slim"   # docker 沙箱使用的镜像
+    cpus: 1          # CPU 上限（docker）
+    memoryMB: 512    # 内存上限（MB），0 表示不限制
+    network: false   # 沙箱中是否允许联网
+    # 命令策略：内置黑名单（rm -rf /、mkfs、dd 写磁盘、curl | sh、关机等）始终生效
+    denyCommands: []     # 额外禁止的命令（正则表达式），例如 ["\\bgit\\s+push\\b"]
+    allowCommands: []    # 严格模式：只允许这些程序（支持 *），例如 ["ls", "cat", "git", "python3"]；为空表示不限制
+    # 执行命令前从环境变量中去除密钥（默认已去除 *API_KEY*、*_TOKEN、*SECRET*、*PASSWORD* 等，以及值等于本配置中密钥的变量）
+    scrubEnv: []         # 额外去除的环境变量名（glob），例如 ["MY_SERVICE_*"]
+    # interactive 模式（shell 工具的 interactive 参数）：命令等待输入时把提示发到聊天，用户的下一条消息作为输入，回复 /abort 终止命令
+    inputTimeout: 300    # 等待用户答复的超时时间（秒），超时后关闭命令的标准输入
+    # code_exec 工具在 workspace/.venv 中执行 Python 脚本并自动安装依赖（启用沙箱或 allowCommands 时不可用）
+    python: ""           # 创建虚拟环境使用的解释器，留空使用 python3（Windows 上为 python）
+
+  # 邮件工具：配置 smtp.host 后启用 send_email，配置 imap.host 后启用 search_email（只读）
+  email:
+    smtp:
+      host: ""         # 例如 smtp.gmail.com
+      port: 587        # 465 使用隐式 TLS，其他端口使用 STARTTLS
+      username: ""
+      password: ""     # 建议使用应用专用密码
+      from: ""         # 发件人地址，为空时使用 username
+    imap:
+      host: ""         # 例如 imap.gmail.com
+      port: 993
+      username: ""     # 为空时使用 smtp 的用户名和密码
+      password: ""
+      mailbox: "INBOX"
+    allowRecipients: []  # 允许的收件人地址或域名，为空时只能发给自己，"*" 表示不限制
+
+  restrictToWorkspace: false
+  # restrictToWorkspace 为 true 时，额外允许文件工具访问的目录（默认只读，write: true 允许写入和删除）
+  # 路径检查使用解析符号链接后的真实路径，工作区内指向外部的符号链接无法绕过限制
+  allowedPaths: []
+  #   - path: "~/Documents"
+  #   - path: "~/projects/notes"
+  #     write: true
+
+  # 工具描述覆盖（可选）：某些模型对内置工具描述理解不佳时使用，键为工具名称
+  overrides: {}
+  # overrides:
+  #   shell:
+  #     description: "Run a non-interactive shell command on the host."
+  #     parameterHints:
+  #       command: "Never use interactive commands such as vim or top."
+  #     examples:
+  #       - '{"command": "ls -la ~/projects"}'
+
+  # 工具权限策略（可选）：按顺序匹配，第一条命中的规则生效；action: auto | confirm | deny
+  # confirm 会在聊天中发送审批提示，等待用户回复 yes/no 后再执行
+  policies: []
+  # policies:
+  #   - tool: shell
+  #     action: confirm
+  #     params:
+  #       command: '\brm\b'
+  #   - tool: filesystem
+  #     action: confirm
+  #     params:
+  #       operation: '^delete$'
+  #   - tool: shell
+  #     action: deny
+  #     channels: [telegram]
+  #     users: ["123456789"]
+  # 按频道和聊天限制工具（可选）：所有命中的规则同时生效，受限的工具不会出现在发给模型的工具列表中
+  # chats 支持 * 通配符；allow/deny 是工具名称（支持 *），readOnly 禁止修改文件和执行命令，noShell 不提供 shell、code_exec 和技能命令
+  scopes: []
+  # scopes:
+  #   - channels: [email]
+  #     deny: [shell, http_request]
+  #   - channels: [telegram]
+  #     chats: ["-*"]          # Telegram 群组的聊天 ID 以 - 开头
+  #     readOnly: true
+  approvalTimeout: 300   # 等待确认的超时时间（秒）
+  # 审计日志：记录每次工具调用（会话、工具、参数、结果摘要、耗时）到 workspace/audit/audit-YYYY-MM-DD.jsonl
+  # 聊天中用 /audit 查看本会话最近的调用，命令行用 nanogrip audit 查询
+  audit:
+    enabled: true
+    retentionDays: 90    # 保留天数，负数表示永久保留
+  # 单次工具结果放入上下文的最大字符数，超出时完整结果保存到 workspace/artifacts/tool-results，
+  # 上下文中只保留开头和结尾的片段和文件路径，模型可以用 filesystem 按行读取；负数表示不限制
+  maxResultChars: 20000
+
+# MCP 服务器配置
+mcpServers: {}
+# 定期刷新 MCP 工具列表的间隔（秒）：重试启动失败的服务器，同步运行中新增或删除的工具
+# 0 表示只在启动时获取；也可以随时在聊天或 CLI 中发送 /mcp reload 手动刷新
+mcpRefreshInterval: 0
+
+# Gateway HTTP 服务（可选）
+gateway:
+  host: "127.0.0.1"
+  port: 0          # 0 表示不启动 HTTP 服务
+  token: ""        # 访问令牌，通过 ?token=... 或 Authorization: Bearer 传递
+  # 持久化入站队列：待处理的消息追加到 workspace/queue.jsonl，处理完成后标记，
+  # 崩溃或重启前未处理的消息会在下次启动时重新处理（启用 secrets.encryptSessions 时加密保存）
+  persistentQueue: false
+  # 日历订阅：在日历应用中订阅 http://host:port/calendar.ics?token=... 查看计划中的定时任务
+  # 单个任务可通过 cron 工具的 calendar=false 隐藏
+  calendar:
+    enabled: false
+    days: 14       # 导出未来多少天
+    maxPerJob: 50  # 每个任务最多导出的执行次数
+
+# 出站消息归档：记录每条实际投递到外部通道的消息（workspace/outbox/YYYY-MM-DD.jsonl）
+# 使用 "nanogrip outbox" 查询
+outbox:
+  enabled: true
+  storeContent: false   # 是否保存消息原文（默认只保存 SHA-256 哈希；启用 secrets.encryptSessions 时原文加密保存）
+
+# 请求追踪：每条消息的处理日志都带有 [trace=<ID>]，配置 endpoint 后还会导出 OpenTelemetry span
+tracing:
+  endpoint: ""          # OTLP/HTTP 收集器地址，例如 http://localhost:4318/v1/traces，为空表示不导出
+  serviceName: nanogrip
+  headers: {}           # 附加的请求头，例如 Authorization
+
+# 主人通知（仅 gateway 模式）：启动、正常退出和崩溃循环告警
+# 崩溃循环：一小时内启动次数超过 crashLoopThreshold（例如被 systemd/docker 反复拉起）时告警
+notify:
+  channel: "telegram"
+  chatId: ""              # 主人的聊天 ID，留空则不发送通知
+  startup: true           # 启动时发送版本、已连接频道、定时任务和待办摘要
+  shutdown: true          # 正常退出时发送告别消息
+  crashLoopThreshold: 3   # 0 表示不告警
+
+# 配置热重载：修改本文件后自动生效（也可以发送 SIGHUP 触发）
+# 可以热更新：频道启用/禁用和 allowFrom、模型默认参数、下面的定时任务、mcpServers
+# 其他设置需要重启后生效
+reloadInterval: 2   # 检查间隔（秒），-1 关闭自动检查
+
+# 配置文件中定义的定时任务（cron 和 every 二选一，command 和 message 二选一，to 留空时发送给 notify.chatId）
+cron:
+  jobs: []
+  # - name: "morning-briefing"
+  #   cron: "0 9 * * *"
+  #   command: "Summarize today's calendar and weather"
+  #   channel: "telegram"
+  #   to: "123456789"
+  #   misfire: "run_once_late"   # 错过执行时间后：skip 跳过、run_once_late 补执行一次、run_all_missed 全部补执行
+  #   skipIfRunning: true   # 上一次执行尚未结束时跳过这一次（默认）
+  #   maxRuntime: 600       # 每次执行最多 600 秒，超时取消（0 不限制）
+  #   jitter: 60            # 执行前随机延迟最多 60 秒（0 不延迟）
+  #   permissions:          # 覆盖下面的默认权限
+  #     tools: ["web_search", "web_fetch", "message"]
+  # - name: "weekly-report"   # 用 workspace/templates/weekly.yaml 发送固定格式的消息，不经过模型
+  #   cron: "0 9 * * 1"
+  #   template: "weekly"
+  #   variables:
+  #     team: "ops"
+  #   channel: "telegram"
+  #   to: "123456789"
+  history: 20          # 每个任务保留的执行记录数（cron 工具的 history 操作、nanogrip cron history），负数表示不记录
+  alertAfter: 0        # 周期性任务连续失败多少次后通知主人（notify），恢复后再通知一次，0 表示不通知
+  # Agent 模式任务无人值守执行时的默认工具权限（不设置表示不限制）
+  # 聊天中创建的任务只能在此基础上进一步收紧
+  permissions:
+    tools: []          # 允许的工具（支持 * 通配符），为空表示不限制
+    readOnly: false    # 禁止写入、删除和修改文件（也不能执行命令）
+    noShell: false     # 禁止执行 shell 命令
+  # 摘要：定时把这段时间的对话、完成的待办和执行过的定时任务总结后发送，并追加到 memory/HISTORY.md
+  digest:
+    enabled: false
+    period: "daily"        # daily 过去 24 小时；weekly 过去 7 天
+    cron: ""               # 生成时间，默认 daily 为 "0 21 * * *"，weekly 为 "0 18 * * 0"
+    channel: ""            # 默认与 notify.channel 相同
+    to: ""                 # 默认与 notify.chatId 相同
+
+# 静态数据加密（密钥由 "nanogrip secrets init" 生成）
+secrets:
+  encryptSessions: false   # 加密会话文件（workspace/sessions/*.jsonl）、持久化入站队列和出站归档中的原文；已有会话可用 "nanogrip secrets encrypt-sessions" 加密
+
+# 密钥脱敏：工具结果、日志和保存的会话中的密钥会被替换为 [REDACTED]
+# 包括本配置中的 apiKey、token、password 等字段的值，以及常见的密钥格式（sk-...、ghp_...、PASSWORD=... 等）
+redaction:
+  disabled: false
+  patterns: []             # 额外的密钥格式（正则表达式），例如 ["acct-[0-9]{8}"]
+
+# 会话保留策略，0 表示永久保留
+# 启动时和之后每天检查一次；过期会话删除前会先整理到 memory/HISTORY.md
+sessions:
+  maxAge: 0     # 超过这么多天未更新的会话会被归档
+  maxCount: 0   # 最多保留的会话数量，超出时归档最旧的会话
+  disableTitles: false  # 不自动生成会话标题（默认在第一轮对话后生成，nanogrip sessions list 中显示）
+
+# 可以使用管理员命令（/status、/tools、/model、/memory）的发送者 ID，例如 ["123456789"] 或 ["telegram:123456789"]
+# 为空时只有本地 CLI 可以使用这些命令
+admins: []
+
+# 限流和每日额度（allowFrom 包含群聊时建议开启），0 表示不限制
+# 超出限制时回复一条提示而不调用模型；每日用量保存在 workspace/usage.json
+rateLimit:
+  perSender:
+    messagesPerMinute: 0
+    llmCallsPerDay: 0
+    tokensPerDay: 0
+  perChannel:
+    messagesPerMinute: 0
+    llmCallsPerDay: 0
+    tokensPerDay: 0
+  exempt: []               # 不受限制的发送者 ID，例如 ["123456789"]
+
+# 每日花费上限（所有 Agent、子代理、记忆整理和定时任务合计），0 表示不限制
+# 超出后拒绝新的 LLM 调用并回复说明，配置了 fallbackModel 时改用更便宜的模型；用量保存在 workspace/budget.json
+budget:
+  providers: {}            # 例如 anthropic: {maxTokensPerDay: 2000000, maxCostPerDay: 5}
+  prices: {}               # 每百万 token 的单价（美元），例如 claude-sonnet-4: {input: 3, output: 15}
+  fallbackModel: ""        # 例如 claude-haiku-4-5
+  resetTime: "00:00"       # 每天清零的时间（本地时间）
+
+# 工作区备份（会话、记忆、待办事项等），也可以用 nanogrip backup create|list|restore 手动操作
+backup:
+  dir: ""                  # 备份目录，默认为 ~/.nanogrip/backups；建议放在另一块磁盘或同步目录
+  schedule: ""             # 定时备份的 cron 表达式，例如 "0 3 * * *"；留空不定时备份
+  keep: 7                  # 保留最近的几份备份，-1 表示不删除
+  encrypt: false           # 使用 secrets 的密钥加密备份（先运行 nanogrip secrets init）
+`
+}
+
+// handleCron 管理运行中 gateway 的定时任务
+// 通过工作区中的管理接口 socket（见 gateway.AdminServer）与 gateway 通信，
+// 因此 gateway 必须正在运行
+func handleCron(configPath string, args []string) {
+	if len(args) == 0 {
+		printCronUsage()
+		return
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("无法加载配置: %v\n", err)
+		return
+	}
+	client := gateway.NewAdminClient(gateway.AdminSocketPath(cfg.GetWorkspacePath()))
+
+	switch args[0] {
+	case "list", "ls":
+		handleCronList(client)
+	case "add":
+		handleCronAdd(client, args[1:])
+	case "remove", "rm":
+		handleCronRemove(client, args[1:])
+	case "history":
+		handleCronHistory(client, args[1:])
+	default:
+		fmt.Printf("未知的 cron 子命令: %s\n\n", args[0])
+		printCronUsage()
+	}
+}
+
+// printCronUsage 打印 cron 子命令的用法
+func printCronUsage() {
+	fmt.Println("定时任务管理（需要 gateway 正在运行）:")
+	fmt.Println("  nanogrip cron list                              # 查看任务列表和下次执行时间")
+	fmt.Println("  nanogrip cron add --every 3600 --channel telegram --to 123 \"喝水\"")
+	fmt.Println("  nanogrip cron add --cron \"0 9 * * *\" --mode agent --channel telegram --to 123 \"总结今天的新闻\"")
+	fmt.Println("  nanogrip cron add --at 2026-01-01T09:00 --channel telegram --to 123 \"新年快乐\"")
+	fmt.Println("  nanogrip cron remove <任务ID...>")
+	fmt.Println("  nanogrip cron history [任务ID] [--limit 20]     # 查看最近的执行记录（成功/失败、耗时、回复开头）")
+}
+
+// handleCronList 以表格形式列出任务，按下次执行时间排序
+func handleCronList(client *gateway.AdminClient) {
+	var jobs []*cron.Job
+	if err := client.Do(http.MethodGet, "/cron", nil, &jobs); err != nil {
+		fmt.Printf("获取任务列表失败: %v\n", err)
+		return
+	}
+	if len(jobs) == 0 {
+		fmt.Println("没有定时任务")
+		return
+	}
+
+	rows := [][]string{{"ID", "NAME", "SCHEDULE", "MODE", "NEXT RUN", "TARGET"}}
+	for _, job := range jobs {
+		mode := "message"
+		if job.TriggerAgent {
+			mode = "agent"
+		}
+		if job.Builtin != "" {
+			mode = job.Builtin
+		}
+		name := strings.ReplaceAll(job.Name, "\n", " ")
+		if len([]rune(name)) > 30 {
+			name = string([]rune(name)[:30]) + "…"
+		}
+		next := job.NextRun.Local().Format("2006-01-02 15:04:05")
+		if until := time.Until(job.NextRun); until > 0 {
+			next += " (" + until.Round(time.Second).String() + ")"
+		}
+		rows = append(rows, []string{job.ID, name, describeCronSchedule(job.Schedule), mode, next, job.Channel + ":" + job.To})
+	}
+	printTable(rows)
+}
+
+// printTable 按列对齐输出表格（第一行为表头）
+func printTable(rows [][]string) {
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			line.WriteString(cell)
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-len([]rune(cell))+2))
+			}
+		}
+		fmt.Println(line.String())
+	}
+}
+
+// describeCronSchedule 返回调度配置的简短描述
+func describeCronSchedule(schedule cron.Schedule) string {
+	switch schedule.Kind {
+	case "every":
+		return "every " + (time.Duration(schedule.EveryMs) * time.Millisecond).String()
+	case "cron":
+		if schedule.TZ != "" {
+			return "cron " + schedule.CronExpr + " " + schedule.TZ
+		}
+		return "cron " + schedule.CronExpr
+	case "at":
+		return "at " + time.UnixMilli(schedule.AtMs).Format("2006-01-02 15:04")
+	default:
+		return schedule.Kind
+	}
+}
+
+// handleCronAdd 向运行中的 gateway 添加任务
+// 任务内容可以通过 --message 或位置参数给出
+func handleCronAdd(client *gateway.AdminClient, args []string) {
+	fs := flag.NewFlagSet("cron add", flag.ExitOnError)
+	every := fs.Int("every", 0, "每隔多少秒执行一次")
+	cronExpr := fs.String("cron", "", "cron 表达式，例如 \"0 9 * * *\"")
+	tz := fs.String("tz", "", "cron 表达式的时区，例如 Asia/Shanghai")
+	at := fs.String("at", "", "在指定时间执行一次 (2006-01-02T15:04)")
+	mode := fs.String("mode", "message", "执行模式 (message|agent)")
+	message := fs.String("message", "", "消息内容（message 模式）或要 Agent 执行的命令（agent 模式）")
+	channel := fs.String("channel", "", "目标通道，例如 telegram")
+	to := fs.String("to", "", "目标聊天 ID")
+	name := fs.String("name", "", "任务名称（默认使用任务内容）")
+	misfire := fs.String("misfire", "", "错过执行时间后的处理 (skip|run_once_late|run_all_missed)")
+	skipIfRunning := fs.Bool("skip-if-running", true, "上一次执行尚未结束时跳过这一次")
+	maxRuntime := fs.Int("max-runtime", 0, "agent 模式每次执行的最长时间（秒），0 表示不限制")
+	jitter := fs.Int("jitter", 0, "执行前的最大随机延迟（秒）")
+	fs.Parse(args)
+
+	content := *message
+	if content == "" {
+		content = strings.Join(fs.Args(), " ")
+	}
+	if content == "" {
+		fmt.Println("缺少任务内容：使用 --message 或在参数末尾给出")
+		return
+	}
+	if *channel == "" || *to == "" {
+		fmt.Println("必须指定 --channel 和 --to")
+		return
+	}
+
+	job := &cron.Job{Name: *name, Channel: *channel, To: *to}
+	if job.Name == "" {
+		job.Name = content
+	}
+	switch *mode {
+	case "message":
+		job.Message = content
+	case "agent":
+		job.TriggerAgent = true
+		job.AgentCommand = content
+	default:
+		fmt.Printf("无效的 --mode: %s（应为 message 或 agent）\n", *mode)
+		return
+	}
+
+	schedules := 0
+	if *every > 0 {
+		job.Schedule = cron.Schedule{Kind: "every", EveryMs: int64(*every) * 1000}
+		schedules++
+	}
+	if *cronExpr != "" {
+		job.Schedule = cron.Schedule{Kind: "cron", CronExpr: *cronExpr, TZ: *tz}
+		schedules++
+	}
+	if *at != "" {
+		t, err := parseCLITime(*at)
+		if err != nil {
+			fmt.Printf("无效的 --at: %v\n", err)
+			return
+		}
+		job.Schedule = cron.Schedule{Kind: "at", AtMs: t.UnixMilli()}
+		schedules++
+	}
+	if schedules != 1 {
+		fmt.Println("必须且只能指定 --every、--cron、--at 其中之一")
+		return
+	}
+
+	policy, err := cron.ParseMisfirePolicy(*misfire)
+	if err != nil {
+		fmt.Printf("无效的 --misfire: %v\n", err)
+		return
+	}
+	job.Misfire = policy
+	job.AllowOverlap = !*skipIfRunning
+	job.MaxRuntime = time.Duration(*maxRuntime) * time.Second
+	job.Jitter = time.Duration(*jitter) * time.Second
+
+	var created cron.Job
+	if err := client.Do(http.MethodPost, "/cron", job, &created); err != nil {
+		fmt.Printf("添加任务失败: %v\n", err)
+		return
+	}
+	fmt.Printf("已添加任务 %s，下次执行: %s\n", created.ID, created.NextRun.Local().Format("2006-01-02 15:04:05"))
+}
+
+// handleCronHistory 显示运行中的 gateway 记录的任务执行历史（新的在前）
+func handleCronHistory(client *gateway.AdminClient, args []string) {
+	fs := flag.NewFlagSet("cron history", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "最多显示的记录数，0 表示不限")
+	fs.Parse(args)
+
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(*limit))
+	if fs.NArg() > 0 {
+		query.Set("job", fs.Arg(0))
+	}
+	var runs []cron.Run
+	if err := client.Do(http.MethodGet, "/cron/history?"+query.Encode(), nil, &runs); err != nil {
+		fmt.Printf("获取执行记录失败: %v\n", err)
+		return
+	}
+	if len(runs) == 0 {
+		fmt.Println("没有执行记录")
+		return
+	}
+	fmt.Print(cron.FormatRuns(runs, time.Local))
+}
+
+// handleCronRemove 从运行中的 gateway 删除任务
+func handleCronRemove(client *gateway.AdminClient, ids []string) {
+	if len(ids) == 0 {
+		fmt.Println("用法: nanogrip cron remove <任务ID...>")
+		return
+	}
+	for _, id := range ids {
+		if err := client.Do(http.MethodDelete, "/cron/"+url.PathEscape(id), nil, nil); err != nil {
+			fmt.Printf("删除 %s 失败: %v\n", id, err)
+			continue
+		}
+		fmt.Printf("已删除任务 %s\n", id)
+	}
+}
+
+// handleOutbox 查询出站消息归档
+// 支持按时间、通道、聊天、投递状态和内容哈希过滤
+func handleOutbox(configPath string, args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "failed":
+			handleOutboxFailed(configPath)
+			return
+		case "resend":
+			handleOutboxResend(configPath, args[1:])
+			return
+		}
+	}
+
+	fs := flag.NewFlagSet("outbox", flag.ExitOnError)
+	since := fs.String("since", "", "开始日期或时间 (2006-01-02 或 2006-01-02T15:04)")
+	until := fs.String("until", "", "结束日期或时间（不含）")
+	channel := fs.String("channel", "", "按通道过滤")
+	chatID := fs.String("chat", "", "按聊天 ID 过滤")
+	status := fs.String("status", "", "按投递状态过滤 (delivered|failed)")
+	hash := fs.String("hash", "", "按内容 SHA-256 哈希（前缀）过滤")
+	text := fs.String("text", "", "计算这段文本的哈希并查找（用于核对某条消息是否发出过）")
+	limit := fs.Int("limit", 50, "最多显示的记录数（最新的），0 表示不限")
+	asJSON := fs.Bool("json", false, "以 JSONL 格式输出")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("无法加载配置: %v\n", err)
+		return
+	}
+
+	q := outbox.Query{
+		Channel: *channel,
+		ChatID:  *chatID,
+		Status:  *status,
+		Hash:    *hash,
+		Limit:   *limit,
+	}
+	if *text != "" {
+		q.Hash = outbox.HashContent(*text)
+	}
+	if q.Since, err = parseCLITime(*since); err != nil {
+		fmt.Printf("无效的 --since: %v\n", err)
+		return
+	}
+	if q.Until, err = parseCLITime(*until); err != nil {
+		fmt.Printf("无效的 --until: %v\n", err)
+		return
+	}
+
+	dir := filepath.Join(cfg.GetWorkspacePath(), "outbox")
+	records, err := outbox.Search(dir, q)
+	if err != nil {
+		fmt.Printf("查询归档失败: %v\n", err)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Printf("没有匹配的记录（归档目录: %s）\n", dir)
+		return
+	}
+
+	cipher := sessionCipher(cfg, configPath)
+	for _, r := range records {
+		if *asJSON {
+			if content, err := r.DecryptContent(cipher); err == nil {
+				r.Content = content
+			}
+			data, _ := json.Marshal(r)
+			fmt.Println(string(data))
+			continue
+		}
+		line := fmt.Sprintf("%s  %-9s  %s:%s  %s  %dB", r.Time.Format("2006-01-02 15:04:05"), r.Status, r.Channel, r.ChatID, r.ContentHash[:12], r.Length)
+		if r.Media > 0 {
+			line += fmt.Sprintf("  +%d media", r.Media)
+		}
+		if r.Error != "" {
+			line += "  error: " + r.Error
+		}
+		fmt.Println(line)
+	}
+}
+
+// handleAudit 查询工具调用审计日志（workspace/audit）
+func handleAudit(configPath string, args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	since := fs.String("since", "", "开始日期或时间 (2006-01-02 或 2006-01-02T15:04)")
+	session := fs.String("session", "", "按会话过滤 (channel:chat_id)")
+	tool := fs.String("tool", "", "按工具名称过滤")
+	failed := fs.Bool("failed", false, "只显示失败的调用")
+	limit := fs.Int("limit", 50, "最多显示的记录数（最新的），0 表示不限")
+	asJSON := fs.Bool("json", false, "以 JSONL 格式输出")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("无法加载配置: %v\n", err)
+		return
+	}
+
+	q := audit.Query{
+		Session: *session,
+		Tool:    *tool,
+		Failed:  *failed,
+		Limit:   *limit,
+	}
+	if q.Since, err = parseCLITime(*since); err != nil {
+		fmt.Printf("无效的 --since: %v\n", err)
+		return
+	}
+
+	dir := filepath.Join(cfg.GetWorkspacePath(), "audit")
+	records, err := audit.Search(dir, q)
+	if err != nil {
+		fmt.Printf("查询审计日志失败: %v\n", err)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Printf("没有匹配的记录（日志目录: %s）\n", dir)
+		if !cfg.Tools.Audit.Enabled {
+			fmt.Println("审计日志未启用，请在配置中设置 tools.audit.enabled: true")
+		}
+		return
+	}
+
+	for _, r := range records {
+		if *asJSON {
+			data, _ := json.Marshal(r)
+			fmt.Println(string(data))
+			continue
+		}
+		fmt.Println(r.Format())
+	}
+}
+
+// handleBackup 创建、列出和恢复工作区备份
+func handleBackup(configPath string, args []string) {
+	if len(args) == 0 {
+		printBackupUsage()
+		return
+	}
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("无法加载配置: %v\n", err)
+		return
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("backup create", flag.ExitOnError)
+		dir := fs.String("dir", cfg.GetBackupPath(), "备份目录")
+		encrypt := fs.Bool("encrypt", cfg.Backup.Encrypt, "使用 secrets 的密钥加密备份")
+		keep := fs.Int("keep", cfg.Backup.Keep, "保留最近的几份备份，-1 表示不删除")
+		fs.Parse(args[1:])
+
+		opts, err := backupOptions(configPath, *dir, *keep, *encrypt)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		path, err := backup.Create(cfg.GetWorkspacePath(), opts)
+		if err != nil && path == "" {
+			fmt.Printf("备份失败: %v\n", err)
+			return
+		}
+		fmt.Printf("✓ 已备份到 %s\n", path)
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+
+	case "list", "ls":
+		fs := flag.NewFlagSet("backup list", flag.ExitOnError)
+		dir := fs.String("dir", cfg.GetBackupPath(), "备份目录")
+		fs.Parse(args[1:])
+
+		backups, err := backup.List(*dir)
+		if err != nil {
+			fmt.Printf("读取备份目录失败: %v\n", err)
+			return
+		}
+		if len(backups) == 0 {
+			fmt.Printf("没有备份（备份目录: %s）\n", *dir)
+			return
+		}
+		rows := [][]string{{"CREATED", "SIZE", "ENCRYPTED", "NAME"}}
+		for _, b := range backups {
+			encrypted := "no"
+			if b.Encrypted {
+				encrypted = "yes"
+			}
+			rows = append(rows, []string{b.Created.Format("2006-01-02 15:04:05"), fmt.Sprintf("%.1f MB", float64(b.Size)/(1<<20)), encrypted, b.Name})
+		}
+		printTable(rows)
+
+	case "restore":
+		fs := flag.NewFlagSet("backup restore", flag.ExitOnError)
+		dir := fs.String("dir", cfg.GetBackupPath(), "备份目录（按文件名查找备份）")
+		force := fs.Bool("force", false, "工作区不为空时也恢复（会先备份当前工作区）")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			fmt.Println("用法: nanogrip backup restore [--force] <备份文件或文件名>")
+			return
+		}
+		handleBackupRestore(cfg, configPath, backup.Resolve(*dir, fs.Arg(0)), *force)
+
+	default:
+		fmt.Printf("未知的 backup 子命令: %s\n\n", args[0])
+		printBackupUsage()
+	}
+}
+
+// printBackupUsage 打印 backup 子命令的用法
+func printBackupUsage() {
+	fmt.Println("工作区备份:")
+	fmt.Println("  nanogrip backup create [--encrypt] [--dir <目录>] [--keep 7]  # 备份会话、记忆、待办事项等工作区数据")
+	fmt.Println("  nanogrip backup list                                         # 列出备份目录中的备份")
+	fmt.Println("  nanogrip backup restore [--force] <备份文件或文件名>           # 恢复到工作区")
+	fmt.Println("定时备份: 在 config.yaml 中设置 backup.schedule，例如 \"0 3 * * *\"")
+}
+
+// handleBackupRestore 把备份恢复到工作区
+// gateway 运行时拒绝恢复（它会继续写入并覆盖恢复的文件）；工作区不为空时需要 --force，并先备份当前工作区
+func handleBackupRestore(cfg *config.Config, configPath, path string, force bool) {
+	workspace := cfg.GetWorkspacePath()
+	if pid, err := lifecycle.RunningPid(lifecycle.PidFilePath(workspace)); err == nil {
+		fmt.Printf("gateway 正在运行 (PID %d)，请先停止: nanogrip daemon stop\n", pid)
+		return
+	}
+
+	if entries, err := os.ReadDir(workspace); err == nil && len(entries) > 0 {
+		if !force {
+			fmt.Printf("工作区 %s 不为空，恢复会覆盖其中的同名文件；确认恢复请加 --force（会先备份当前工作区）\n", workspace)
+			return
+		}
+		opts, err := backupOptions(configPath, cfg.GetBackupPath(), -1, cfg.Backup.Encrypt)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		saved, err := backup.Create(workspace, opts)
+		if err != nil {
+			fmt.Printf("备份当前工作区失败，已取消恢复: %v\n", err)
+			return
+		}
+		fmt.Printf("当前工作区已备份到 %s\n", saved)
+	}
+
+	// 加密的备份需要密钥，找不到密钥时由 Restore 报错
+	c, _ := backupCipher(configPath)
+	count, err := backup.Restore(path, workspace, c)
+	if err != nil {
+		fmt.Printf("恢复失败（已恢复 %d 个文件）: %v\n", count, err)
+		return
+	}
+	fmt.Printf("✓ 已从 %s 恢复 %d 个文件到 %s\n", path, count, workspace)
+}
+
+// backupOptions 返回创建备份的配置，需要加密时查找 secrets 的密钥
+func backupOptions(configPath, dir string, keep int, encrypt bool) (backup.Options, error) {
+	opts := backup.Options{Dir: dir, Keep: keep}
+	if !encrypt {
+		return opts, nil
+	}
+	c, err := backupCipher(configPath)
+	if err != nil {
+		return opts, fmt.Errorf("无法加密备份: %w", err)
+	}
+	opts.Cipher = c
+	return opts, nil
+}
+
+// backupCipher 打开配置目录中的加密密钥
+func backupCipher(configPath string) (*secrets.Cipher, error) {
+	path, err := resolveConfigPath(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return secrets.Open(filepath.Dir(path))
+}
+
+// handleSessions 列出保存的会话（最近更新的在前），显示标题、频道、消息数和最后活动时间
+func handleSessions(configPath string, args []string) {
+	if len(args) > 0 && (args[0] == "list" || args[0] == "ls") {
+		args = args[1:]
+	}
+	fs := flag.NewFlagSet("sessions", flag.ExitOnError)
+	channel := fs.String("channel", "", "按频道过滤")
+	limit := fs.Int("limit", 20, "最多显示的会话数（最近的），0 表示不限")
+	asJSON := fs.Bool("json", false, "以 JSONL 格式输出")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("无法加载配置: %v\n", err)
+		return
+	}
+	workspace := cfg.GetWorkspacePath()
+	sessions := newSessionManager(cfg, configPath, workspace).ListSessions()
+
+	rows := [][]string{{"LAST ACTIVE", "CHANNEL", "MESSAGES", "TITLE", "KEY"}}
+	shown := 0
+	for _, info := range sessions {
+		if *channel != "" && info["channel"] != *channel {
+			continue
+		}
+		if *limit > 0 && shown == *limit {
+			break
+		}
+		shown++
+		if *asJSON {
+			data, _ := json.Marshal(info)
+			fmt.Println(string(data))
+			continue
+		}
+
+		updated, _ := info["updated_at"].(string)
+		if t, err := time.Parse(time.RFC3339, updated); err == nil {
+			updated = t.Local().Format("2006-01-02 15:04")
+		}
+		title, _ := info["title"].(string)
+		if title == "" {
+			title = "-"
+		}
+		rows = append(rows, []string{
+			updated,
+			fmt.Sprint(info["channel"]),
+			fmt.Sprint(info["message_count"]),
+			title,
+			fmt.Sprint(info["key"]),
+		})
+	}
+	if *asJSON {
+		return
+	}
+	if shown == 0 {
+		fmt.Printf("没有保存的会话（会话目录: %s）\n", filepath.Join(workspace, "sessions"))
+		return
+	}
+	printTable(rows)
+	if *limit > 0 && shown == *limit && len(sessions) > shown {
+		fmt.Printf("\n只显示最近的 %d 个会话（--limit 0 显示全部）\n", shown)
+	}
+}
+
+// registerAuditCommand 在 Agent 上注册 /audit 命令，查看当前会话最近的工具调用
+// 只显示当前会话的记录，避免在聊天中泄露其他会话的内容
+func registerAuditCommand(cfg *config.Config, workspace string, loops ...*agent.AgentLoop) {
+	if !cfg.Tools.Audit.Enabled {
+		return
+	}
+	dir := filepath.Join(workspace, "audit")
+	handler := func(ctx context.Context, msg bus.InboundMessage, args []string) string {
+		q := audit.Query{Session: msg.Channel + ":" + msg.ChatID, Limit: 10}
+		for _, arg := range args {
+			if arg == "failed" {
+				q.Failed = true
+			} else if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+				q.Limit = n
+			}
+		}
+		records, err := audit.Search(dir, q)
+		if err != nil {
+			return fmt.Sprintf("Failed to read the audit log: %v", err)
+		}
+		if len(records) == 0 {
+			return "No tool calls recorded in this chat."
+		}
+		lines := make([]string, 0, len(records))
+		for _, r := range records {
+			lines = append(lines, r.Format())
+		}
+		return fmt.Sprintf("Last %d tool calls in this chat:\n%s", len(records), strings.Join(lines, "\n"))
+	}
+	for _, loop := range loops {
+		loop.RegisterCommand("audit", "Show recent tool calls in this chat (/audit [count] [failed])", handler)
+	}
+}
+
+// handleOutboxFailed 列出无法投递的消息（workspace/outbox-failed.jsonl）
+func handleOutboxFailed(configPath string) {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("无法加载配置: %v\n", err)
+		return
+	}
+
+	failed := outbox.NewFailedLog(filepath.Join(cfg.GetWorkspacePath(), outbox.FailedFileName))
+	records, err := failed.List()
+	if err != nil {
+		fmt.Printf("读取 %s 失败: %v\n", failed.Path(), err)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Println("没有投递失败的消息")
+		return
+	}
+
+	for i, r := range records {
+		content := strings.ReplaceAll(r.Content, "\n", " ")
+		if len([]rune(content)) > 60 {
+			content = string([]rune(content)[:60]) + "…"
+		}
+		fmt.Printf("%3d  %s  %s:%s  attempts=%d  error: %s\n     %s\n", i+1, r.Time.Format("2006-01-02 15:04:05"), r.Channel, r.ChatID, r.Attempts, r.Error, content)
+	}
+	fmt.Printf("\n共 %d 条。使用 nanogrip outbox resend <序号...> 或 --all 重新发送\n", len(records))
+}
+
+// handleOutboxResend 重新发送无法投递的消息
+// 发送成功的消息从死信文件中移除，仍然失败的保留并更新失败原因
+func handleOutboxResend(configPath string, args []string) {
+	fs := flag.NewFlagSet("outbox resend", flag.ExitOnError)
+	all := fs.Bool("all", false, "重新发送所有失败的消息")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("无法加载配置: %v\n", err)
+		return
+	}
+	workspace := cfg.GetWorkspacePath()
+
+	failed := outbox.NewFailedLog(filepath.Join(workspace, outbox.FailedFileName))
+	records, err := failed.List()
+	if err != nil {
+		fmt.Printf("读取 %s 失败: %v\n", failed.Path(), err)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Println("没有投递失败的消息")
+		return
+	}
+
+	selected := make(map[int]bool)
+	if *all {
+		for i := range records {
+			selected[i] = true
+		}
+	} else {
+		if fs.NArg() == 0 {
+			fmt.Println("用法: nanogrip outbox resend [--all] [序号...]（序号见 nanogrip outbox failed）")
+			return
+		}
+		for _, arg := range fs.Args() {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 || n > len(records) {
+				fmt.Printf("无效的序号: %s（共 %d 条）\n", arg, len(records))
+				return
+			}
+			selected[n-1] = true
+		}
+	}
+
+	var archive *outbox.Archive
+	if cfg.Outbox.Enabled {
+		archive = outbox.NewArchive(filepath.Join(workspace, "outbox"), cfg.Outbox.StoreContent)
+		archive.SetCipher(sessionCipher(cfg, configPath))
+	}
+
+	senders := make(map[string]channels.Channel)
+	var remaining []outbox.Failed
+	sent := 0
+	for i, r := range records {
+		if !selected[i] {
+			remaining = append(remaining, r)
+			continue
+		}
+
+		sender, ok := senders[r.Channel]
+		if !ok {
+			if sender, err = channels.NewSender(cfg, r.Channel); err != nil {
+				fmt.Printf("✗ %d  %s:%s  %v\n", i+1, r.Channel, r.ChatID, err)
+				r.Error = err.Error()
+				remaining = append(remaining, r)
+				continue
+			}
+			senders[r.Channel] = sender
+		}
+
+		var sendErr error
+		for _, part := range channels.Adapt(r.Message(), channels.CapabilitiesOf(sender)) {
+			sendErr = sender.Send(part)
+			if err := archive.Record(part, sendErr); err != nil {
+				fmt.Printf("⚠ 写入出站归档失败: %v\n", err)
+			}
+			if sendErr != nil {
+				break
+			}
+		}
+
+		r.Attempts++
+		if sendErr != nil {
+			fmt.Printf("✗ %d  %s:%s  %v\n", i+1, r.Channel, r.ChatID, sendErr)
+			r.Time = time.Now()
+			r.Error = sendErr.Error()
+			remaining = append(remaining, r)
+			continue
+		}
+		fmt.Printf("✓ %d  %s:%s\n", i+1, r.Channel, r.ChatID)
+		sent++
+	}
+
+	if err := failed.Replace(remaining); err != nil {
+		fmt.Printf("更新 %s 失败: %v\n", failed.Path(), err)
+		return
+	}
+	fmt.Printf("已重新发送 %d 条，剩余 %d 条失败\n", sent, len(remaining))
+}
+
+// handleSecrets 管理静态数据加密
+// 子命令:
+//
+//	init [--keychain]   生成密钥，默认保存在配置目录的 secret.key
+//	encrypt [值]        加密一个值（未提供时从标准输入读取），输出可直接写入 config.yaml
+//	encrypt-config      加密配置文件中明文保存的 apiKey、token、secret、password 等字段
+//	encrypt-sessions    加密工作区中已有的会话文件
+func handleSecrets(configPath string, args []string) {
+	path, err := resolveConfigPath(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	configDir := filepath.Dir(path)
+
+	if len(args) == 0 {
+		fmt.Println("用法: nanogrip secrets <init|encrypt|encrypt-config|encrypt-sessions>")
+		return
+	}
+
+	switch args[0] {
+	case "init":
+		fs := flag.NewFlagSet("secrets init", flag.ExitOnError)
+		useKeychain := fs.Bool("keychain", false, "保存到系统钥匙串而不是 secret.key 文件")
+		fs.Parse(args[1:])
+
+		location, err := secrets.Init(configDir, *useKeychain)
+		if err != nil {
+			fmt.Printf("生成密钥失败: %v\n", err)
+			return
+		}
+		fmt.Printf("✓ 密钥已保存到 %s\n", location)
+		fmt.Println("  请妥善备份密钥，丢失后已加密的数据将无法恢复")
+		fmt.Println("  下一步: nanogrip secrets encrypt-config 加密配置中的 API Key")
+		fmt.Println("          在 config.yaml 中设置 secrets.encryptSessions: true 加密会话文件")
+
+	case "encrypt":
+		c, err := secrets.Open(configDir)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		value := strings.Join(args[1:], " ")
+		if value == "" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Printf("读取标准输入失败: %v\n", err)
+				return
+			}
+			value = strings.TrimRight(string(data), "\r\n")
+		}
+		encrypted, err := c.Encrypt([]byte(value))
+		if err != nil {
+			fmt.Printf("加密失败: %v\n", err)
+			return
+		}
+		fmt.Println(encrypted)
+
+	case "encrypt-config":
+		c, err := secrets.Open(configDir)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		count, err := config.EncryptFile(path, c)
+		if err != nil {
+			fmt.Printf("加密配置失败: %v\n", err)
+			return
+		}
+		if count == 0 {
+			fmt.Println("没有需要加密的明文字段")
+			return
+		}
+		fmt.Printf("✓ 已加密 %d 个字段（原文件备份为 %s.bak，确认无误后请删除）\n", count, path)
+
+	case "encrypt-sessions":
+		cfg, err := config.Load(path)
+		if err != nil {
+			fmt.Printf("无法加载配置: %v\n", err)
+			return
+		}
+		c, err := secrets.Open(configDir)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		sm := session.NewSessionManager(cfg.GetWorkspacePath())
+		sm.SetCipher(c)
+		count := 0
+		for _, info := range sm.ListSessions() {
+			key, _ := info["key"].(string)
+			if err := sm.Save(sm.GetOrCreate(key)); err != nil {
+				fmt.Printf("加密会话 %s 失败: %v\n", key, err)
+				continue
+			}
+			count++
+		}
+		fmt.Printf("✓ 已加密 %d 个会话\n", count)
+		if !cfg.Secrets.EncryptSessions {
+			fmt.Println("  请在 config.yaml 中设置 secrets.encryptSessions: true，否则新会话仍以明文保存")
+		}
+
+	default:
+		fmt.Printf("未知的 secrets 子命令: %s\n", args[0])
+	}
+}
+
+// parseCLITime 解析命令行中的日期或时间（本地时区），空字符串返回零值
+func parseCLITime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("expected 2006-01-02 or 2006-01-02T15:04, got %q", value)
+}
+
+// loadConfig 加载配置文件
+func loadConfig(configPath string) (*config.Config, error) {
+	configPath, err := resolveConfigPath(configPath)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	applyRedaction(cfg)
+	i18n.SetDefault(cfg.Agents.Defaults.Language)
+	return cfg, nil
+}
+
+// applyRedaction 根据配置设置全局的密钥脱敏规则（配置中的密钥和 redaction.patterns）
+func applyRedaction(cfg *config.Config) {
+	if cfg.Redaction.Disabled {
+		redact.Set(nil)
+		return
+	}
+	redactor, err := redact.New(cfg.SecretValues(), cfg.Redaction.Patterns)
+	if err != nil {
+		log.Printf("[Config] redaction.patterns 中有无效的正则表达式，已忽略: %v", err)
+	}
+	redact.Set(redactor)
+}
+
+// resolveConfigPath 返回配置文件路径，未指定时使用 ~/.nanogrip/config.yaml
+func resolveConfigPath(configPath string) (string, error) {
+	if configPath != "" {
+		return configPath, nil
+	}
+	path, err := paths.HomeDir(".nanogrip", "config.yaml")
+	if err != nil {
+		return "", fmt.Errorf("获取主目录失败: %v", err)
+	}
+	return path, nil
+}
+
+// mcpConfigs 将配置中的 mcpServers 转换为 MCP 管理器使用的配置格式
+func mcpConfigs(cfg *config.Config) map[string]mcp.MCPConfig {
+	configs := make(map[string]mcp.MCPConfig, len(cfg.MCPServers))
+	for name, serverConfig := range cfg.MCPServers {
+		configs[name] = mcp.MCPConfig{
+			Command: serverConfig.Command,
+			Args:    serverConfig.Args,
+			Env:     serverConfig.Env,
+			URL:     serverConfig.URL,
+			Headers: serverConfig.Headers,
+		}
+	}
+	return configs
+}
+
+// configCronJobs 将配置中的 cron.jobs 转换为定时任务
+// 定义不完整的任务会被跳过并记录警告；设置了 permissions 的任务使用自己的工具权限，否则使用 cron.permissions
+// timezoneFor 返回聊天的时区（见 AgentLoop.TimezoneFor），摘要任务按接收者的时区生成
+func configCronJobs(cfg *config.Config, timezoneFor func(channel, chatID string) string) []*cron.Job {
+	jobs := make([]*cron.Job, 0, len(cfg.Cron.Jobs))
+	seen := make(map[string]bool)
+	for _, jc := range cfg.Cron.Jobs {
+		if jc.Name == "" || seen[jc.Name] {
+			log.Printf("Warning: 跳过配置中的定时任务：名称为空或重复 (%q)", jc.Name)
+			continue
+		}
+		seen[jc.Name] = true
+
+		// 未指定接收者时发送给主人
+		if jc.To == "" && jc.Channel == cfg.Notify.Channel {
+			jc.To = cfg.Notify.ChatID
+		}
+
+		job := &cron.Job{
+			ID:           cron.ConfigJobPrefix + jc.Name,
+			Name:         jc.Name,
+			Message:      jc.Message,
+			Channel:      jc.Channel,
+			To:           jc.To,
+			Deliver:      true,
+			TriggerAgent: jc.Command != "",
+			AgentCommand: jc.Command,
+		}
+		if jc.Template != "" && jc.Command == "" {
+			job.Builtin = "template"
+			job.Message = jc.Template
+			job.Variables = jc.Variables
+		}
+		if jc.Permissions != nil {
+			job.Permissions = &cron.Permissions{Tools: jc.Permissions.Tools, ReadOnly: jc.Permissions.ReadOnly, NoShell: jc.Permissions.NoShell}
+		}
+		misfire, err := cron.ParseMisfirePolicy(jc.Misfire)
+		if err != nil {
+			log.Printf("Warning: 跳过配置中的定时任务 %s：%v", jc.Name, err)
+			continue
+		}
+		job.Misfire = misfire
+		if jc.MaxRuntime < 0 || jc.Jitter < 0 {
+			log.Printf("Warning: 跳过配置中的定时任务 %s：maxRuntime 和 jitter 不能为负数", jc.Name)
+			continue
+		}
+		job.AllowOverlap = jc.SkipIfRunning != nil && !*jc.SkipIfRunning
+		job.MaxRuntime = time.Duration(jc.MaxRuntime) * time.Second
+		job.Jitter = time.Duration(jc.Jitter) * time.Second
+		switch {
+		case jc.Cron != "":
+			job.Schedule = cron.Schedule{Kind: "cron", CronExpr: jc.Cron}
+		case jc.Every > 0:
+			job.Schedule = cron.Schedule{Kind: "every", EveryMs: int64(jc.Every) * 1000}
+		default:
+			log.Printf("Warning: 跳过配置中的定时任务 %s：需要 cron 或 every", jc.Name)
+			continue
+		}
+		if jc.Command == "" && jc.Message == "" && jc.Template == "" {
+			log.Printf("Warning: 跳过配置中的定时任务 %s：需要 command、message 或 template", jc.Name)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	if job := digestCronJob(cfg, timezoneFor); job != nil {
+		jobs = append(jobs, job)
+	}
+	if job := backupCronJob(cfg); job != nil {
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// digestCronJob 将配置中的 cron.digest 转换为内置的摘要任务，未启用或缺少接收者时返回 nil
+// cron 表达式按接收者会话的时区计算（用户用 /timezone 修改后，在配置重载或重启时生效）
+func digestCronJob(cfg *config.Config, timezoneFor func(channel, chatID string) string) *cron.Job {
+	d := cfg.Cron.Digest
+	if !d.Enabled {
+		return nil
+	}
+	if d.To == "" {
+		log.Printf("Warning: 摘要任务未启用：需要 cron.digest.to 或 notify.chatId")
+		return nil
+	}
+	if d.Period != "daily" && d.Period != "weekly" {
+		log.Printf("Warning: 摘要任务未启用：未知的 period %q（daily 或 weekly）", d.Period)
+		return nil
+	}
+	schedule := cron.Schedule{Kind: "cron", CronExpr: d.Cron, TZ: timezoneFor(d.Channel, d.To)}
+	if err := cron.ValidateSchedule(schedule); err != nil {
+		log.Printf("Warning: 摘要任务未启用：%v", err)
+		return nil
+	}
+	return &cron.Job{
+		ID:       cron.ConfigJobPrefix + "builtin:digest",
+		Name:     d.Period + " digest",
+		Message:  d.Period,
+		Schedule: schedule,
+		Channel:  d.Channel,
+		To:       d.To,
+		Deliver:  true,
+		Builtin:  "digest",
+	}
+}
+
+// backupCronJob 将配置中的 backup.schedule 转换为内置的备份任务，未设置或无效时返回 nil
+// 备份成功时不发送消息，失败时通知主人
+func backupCronJob(cfg *config.Config) *cron.Job {
+	if cfg.Backup.Schedule == "" {
+		return nil
+	}
+	schedule := cron.Schedule{Kind: "cron", CronExpr: cfg.Backup.Schedule}
+	if err := cron.ValidateSchedule(schedule); err != nil {
+		log.Printf("Warning: 定时备份未启用：%v", err)
+		return nil
+	}
+	return &cron.Job{
+		ID:               cron.ConfigJobPrefix + "builtin:backup",
+		Name:             "workspace backup",
+		Schedule:         schedule,
+		Channel:          cfg.Notify.Channel,
+		To:               cfg.Notify.ChatID,
+		Deliver:          true,
+		Builtin:          "backup",
+		HideFromCalendar: true,
+	}
+}
+
+// registerBackupJob 注册内置的备份任务
+// 每次执行时重新读取配置，修改备份目录、保留份数或加密设置后不需要重启
+func registerBackupJob(cronService *cron.CronService, configPath string) {
+	cronService.RegisterBuiltin("backup", func(job *cron.Job) (string, error) {
+		cfg, err := loadConfig(configPath)
+		if err != nil {
+			return "", err
+		}
+		opts, err := backupOptions(configPath, cfg.GetBackupPath(), cfg.Backup.Keep, cfg.Backup.Encrypt)
+		if err != nil {
+			return "", err
+		}
+		path, err := backup.Create(cfg.GetWorkspacePath(), opts)
+		if err != nil {
+			return "", err
+		}
+		log.Printf("[Backup] 工作区已备份到 %s", path)
+		return "", nil
+	})
+}
+
+// registerDigestJob 注册内置的摘要任务：总结一个周期（任务参数 daily 或 weekly）内的活动
+func registerDigestJob(cronService *cron.CronService, loop *agent.AgentLoop) {
+	cronService.RegisterBuiltin("digest", func(job *cron.Job) (string, error) {
+		title, period := "Daily digest", 24*time.Hour
+		if job.Message == "weekly" {
+			title, period = "Weekly digest", 7*24*time.Hour
+		}
+		// 摘要中的时间按任务的时区（接收者的时区）显示
+		loc := time.Local
+		if job.Schedule.TZ != "" {
+			if l, err := time.LoadLocation(job.Schedule.TZ); err == nil {
+				loc = l
+			}
+		}
+		return loop.GenerateDigest(context.Background(), title, time.Now().Add(-period), cronService.ListJobs(), loc)
+	})
+}
+
+// registerTemplateJob 注册内置的模板任务：用配置中的变量渲染模板，结果发送到任务频道
+// 定时任务只发送正文，模板中的媒体需要通过 send_template 工具发送
+func registerTemplateJob(cronService *cron.CronService, workspace string) {
+	store := templates.NewStore(workspace)
+	cronService.RegisterBuiltin("template", func(job *cron.Job) (string, error) {
+		tmpl, err := store.Get(job.Message)
+		if err != nil {
+			return "", err
+		}
+		vars := make(map[string]interface{}, len(job.Variables))
+		for name, value := range job.Variables {
+			vars[name] = value
+		}
+		rendered, err := tmpl.Render(vars)
+		if err != nil {
+			return "", err
+		}
+		return rendered.Content, nil
+	})
+}
+
+// applyCronHistory 设置定时任务的执行记录（workspace/cron/history.json）和连续失败告警
+func applyCronHistory(cronService *cron.CronService, cfg *config.Config) {
+	cronService.SetHistory(filepath.Join(cfg.GetWorkspacePath(), "cron", "history.json"), cfg.Cron.History)
+	cronService.SetFailureAlert(cfg.Cron.AlertAfter, cfg.Notify.Channel, cfg.Notify.ChatID)
+}
+
+// defaultCronPermissions 返回 cron.permissions 对应的默认权限，没有任何限制时返回 nil
+func defaultCronPermissions(cfg *config.Config) *cron.Permissions {
+	p := cfg.Cron.Permissions
+	if len(p.Tools) == 0 && !p.ReadOnly && !p.NoShell {
+		return nil
+	}
+	return &cron.Permissions{Tools: p.Tools, ReadOnly: p.ReadOnly, NoShell: p.NoShell}
+}
+
+// configReloader 把配置文件的变化应用到运行中的 gateway
+// 可以热更新的设置：频道启用/禁用、白名单和免打扰时段、模型默认参数（含子代理限制）、配置中的定时任务、MCP 服务器；
+// 其他设置（提供商密钥、工具、agents.instances、Gateway HTTP 等）仍需重启后生效
+type configReloader struct {
+	path           string
+	channels       *channels.Manager
+	agentLoop      *agent.AgentLoop
+	instances      []*agent.AgentLoop // agents.instances 中的 Agent（只更新频道能力说明）
+	subagents      *agent.SubagentManager
+	cronService    *cron.CronService
+	mcpManager     *mcp.MCPManager
+	mcpRefresher   *mcpRefresher
+	dispatcher     *channels.Dispatcher
+	msgBus         *bus.MessageBus
+	reloadInterval time.Duration
+	mu             sync.Mutex // 保证同一时间只有一次重载
+}
+
+// run 监听配置文件变化和 SIGHUP 信号，直到 ctx 被取消
+func (r *configReloader) run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	if r.reloadInterval > 0 {
+		go config.Watch(ctx, r.path, r.reloadInterval, func() { r.reload(ctx) })
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Println("[Config] 收到 SIGHUP，重新加载配置")
+			r.reload(ctx)
+		}
+	}
+}
+
+// reload 重新加载配置文件并应用可以热更新的设置
+// 配置文件有误时保留当前配置
+func (r *configReloader) reload(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := config.Load(r.path)
+	if err != nil {
+		log.Printf("[Config] 重新加载失败，继续使用当前配置: %v", err)
+		return
+	}
+	applyRedaction(cfg)
+	i18n.SetDefault(cfg.Agents.Defaults.Language)
+
+	// 1. 频道启用/禁用和白名单
+	if r.channels.Apply(ctx, cfg) {
+		for name, caps := range r.channels.Capabilities() {
+			r.agentLoop.SetChannelCapabilities(name, caps.Describe())
+			for _, loop := range r.instances {
+				loop.SetChannelCapabilities(name, caps.Describe())
+			}
+		}
+	}
+	r.dispatcher.Subscribe(r.msgBus) // 新启用的频道
+	r.dispatcher.SetQuietHours(quietHours(cfg))
+
+	// 2. 模型默认参数
+	defaults := cfg.Agents.Defaults
+	r.agentLoop.SetModelDefaults(defaults.Model, defaults.MaxTokens, defaults.Temperature)
+	r.subagents.SetModelDefaults(defaults.Model, defaults.MaxTokens, defaults.Temperature)
+	applySubagentLimits(r.subagents, defaults)
+	applyReasoning(r.agentLoop, defaults)
+	applyRouting(r.agentLoop, cfg)
+	r.agentLoop.SetLanguage(defaults.Language)
+	r.agentLoop.SetTimezone(defaults.Timezone)
+	r.agentLoop.SetMaxConcurrentSessions(defaults.MaxConcurrentSessions)
+	for _, loop := range r.instances {
+		applyReasoning(loop, defaults)
+		applyRouting(loop, cfg)
+		loop.SetLanguage(defaults.Language)
+		loop.SetTimezone(defaults.Timezone)
+		loop.SetMaxConcurrentSessions(defaults.MaxConcurrentSessions)
+	}
+	// 管理员命令白名单和按聊天限制的工具
+	r.agentLoop.SetAdmins(cfg.Admins)
+	r.agentLoop.SetToolScopes(toolScopes(cfg))
+	for _, loop := range r.instances {
+		loop.SetAdmins(cfg.Admins)
+		loop.SetToolScopes(toolScopes(cfg))
+	}
+
+	// 3. 配置中的定时任务
+	r.cronService.SetDefaultPermissions(defaultCronPermissions(cfg))
+	applyCronHistory(r.cronService, cfg)
+	added, removed := r.cronService.SyncConfigJobs(configCronJobs(cfg, r.agentLoop.TimezoneFor))
+
+	// 4. MCP 服务器
+	newTools, removedTools := r.mcpManager.Sync(mcpConfigs(cfg))
+	r.mcpRefresher.apply(newTools, removedTools)
+
+	log.Printf("[Config] 配置已重新加载: 频道 %v, 模型 %s, 定时任务 +%d/-%d, MCP 工具 +%d/-%d",
+		r.channels.ListChannels(), defaults.Model, added, removed, len(newTools), len(removedTools))
+}
+
+// mcpRefresher 刷新 MCP 工具列表，并把变化同步到所有使用 MCP 工具的工具注册表
+// 由 /mcp reload 命令、mcpRefreshInterval 定时刷新和配置热重载共用
+type mcpRefresher struct {
+	manager    *mcp.MCPManager
+	registries []*tools.ToolRegistry
+	mu         sync.Mutex // 保证同一时间只有一次刷新
+}
+
+// refresh 重新获取 MCP 工具列表并同步到工具注册表，返回结果摘要
+func (r *mcpRefresher) refresh() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, added, removed := r.manager.RefreshTools()
+	r.apply(current, removed)
+	if len(added) > 0 || len(removed) > 0 {
+		log.Printf("[MCP] 工具列表已刷新: +%v -%v", added, removed)
+	}
+
+	summary := fmt.Sprintf("MCP tools reloaded: %d tools, %d added, %d removed", len(current), len(added), len(removed))
+	if len(added) > 0 {
+		summary += "\nAdded: " + strings.Join(added, ", ")
+	}
+	if len(removed) > 0 {
+		summary += "\nRemoved: " + strings.Join(removed, ", ")
+	}
+	if status := r.manager.Status(); len(status) > 0 {
+		summary += "\n\nServers:\n" + strings.Join(status, "\n")
+	}
+	return summary
+}
+
+// apply 把工具变化同步到所有工具注册表
+func (r *mcpRefresher) apply(registered []tools.Tool, removed []string) {
+	for _, registry := range r.registries {
+		for _, name := range removed {
+			registry.Unregister(name)
+		}
+		for _, tool := range registered {
+			registry.Register(tool)
+		}
+	}
+}
+
+// run 按间隔定时刷新，直到 ctx 被取消
+func (r *mcpRefresher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.refresh()
+		}
+	}
+}
+
+// command 处理 /mcp 命令：/mcp reload 刷新工具列表，/mcp 显示服务器状态
+func (r *mcpRefresher) command(ctx context.Context, msg bus.InboundMessage, args []string) string {
+	if len(args) > 0 && args[0] == "reload" {
+		return r.refresh()
+	}
+	status := r.manager.Status()
+	if len(status) == 0 {
+		return "No MCP servers configured."
+	}
+	return "MCP servers:\n" + strings.Join(status, "\n") + "\n\nUse /mcp reload to refresh the tool lists."
+}
+
+// register 在 Agent 上注册 /mcp 命令
+func (r *mcpRefresher) register(loops ...*agent.AgentLoop) {
+	for _, loop := range loops {
+		loop.RegisterCommand("mcp", "Show MCP servers (/mcp reload to refresh their tools)", r.command)
+	}
+}
+
+// toolOverrides 将配置中的 tools.overrides 转换为工具注册表使用的覆盖配置
+func toolOverrides(cfg *config.Config) map[string]tools.ToolOverride {
+	overrides := make(map[string]tools.ToolOverride, len(cfg.Tools.Overrides))
+	for name, override := range cfg.Tools.Overrides {
+		overrides[name] = tools.ToolOverride{
+			Description:    override.Description,
+			ParameterHints: override.ParameterHints,
+			Examples:       override.Examples,
+		}
+	}
+	return overrides
+}
+
+// toolPolicy 根据配置中的 tools.policies 创建工具权限策略
+// 配置有误时记录错误并返回 nil（所有工具自动执行）
+func toolPolicy(cfg *config.Config) *tools.ToolPolicy {
+	rules := make([]tools.PolicyRule, 0, len(cfg.Tools.Policies))
+	for _, rule := range cfg.Tools.Policies {
+		rules = append(rules, tools.PolicyRule{
+			Tool:     rule.Tool,
+			Action:   tools.PolicyAction(rule.Action),
+			Channels: rule.Channels,
+			Users:    rule.Users,
+			Params:   rule.Params,
+		})
+	}
+
+	policy, err := tools.NewToolPolicy(rules)
+	if err != nil {
+		log.Printf("工具权限策略配置错误，已忽略: %v", err)
+		return nil
+	}
+	return policy
+}
+
+// toolScopes 根据配置中的 tools.scopes 创建按频道和聊天限制工具的规则
+// 没有设置 fullTools 的 Webhook 额外加一条规则：文件系统只读，不能执行命令
+func toolScopes(cfg *config.Config) []tools.ScopeRule {
+	rules := make([]tools.ScopeRule, 0, len(cfg.Tools.Scopes)+1)
+	var restricted []string
+	for _, hook := range cfg.Channels.Webhook.Hooks {
+		if !hook.FullTools {
+			restricted = append(restricted, hook.Name)
+		}
+	}
+	if len(restricted) > 0 {
+		rules = append(rules, tools.ScopeRule{
+			Channels: []string{"webhook"},
+			Chats:    restricted,
+			Scope:    tools.Scope{ReadOnly: true, NoShell: true},
+		})
+	}
+	for _, scope := range cfg.Tools.Scopes {
+		rules = append(rules, tools.ScopeRule{
+			Channels: scope.Channels,
+			Chats:    scope.Chats,
+			Scope: tools.Scope{
+				Allow:    scope.Allow,
+				Deny:     scope.Deny,
+				ReadOnly: scope.ReadOnly,
+				NoShell:  scope.NoShell,
+			},
+		})
+	}
+	return rules
+}
+
+// registerChannelsCommand 在 Agent 上注册 /channels 管理员命令，在运行时停用和重新启用单个频道
+// 停用期间发往频道的消息由出站分发器暂存，重新启用后按顺序发送
+func registerChannelsCommand(channelManager *channels.Manager, dispatcher *channels.Dispatcher, loops ...*agent.AgentLoop) {
+	handler := func(ctx context.Context, msg bus.InboundMessage, args []string) string {
+		if len(args) == 0 || args[0] == "list" {
+			pending := dispatcher.Pending()
+			lines := make([]string, 0, len(channels.Names))
+			for _, s := range channelManager.Status() {
+				state := "not configured"
+				switch {
+				case s.Disabled:
+					state = "disabled"
+				case s.Running:
+					state = "running"
+				case s.Configured:
+					state = "not running"
+				}
+				line := fmt.Sprintf("- %s: %s", s.Name, state)
+				if n := pending[s.Name]; n > 0 {
+					line += fmt.Sprintf(" (%d messages waiting)", n)
+				}
+				lines = append(lines, line)
+			}
+			return "Channels:\n" + strings.Join(lines, "\n") + "\n\nUse /channels disable <name> or /channels enable <name>."
+		}
+		if len(args) < 2 || (args[0] != "enable" && args[0] != "disable") {
+			return "Usage: /channels [list | enable <name> | disable <name>]"
+		}
+
+		name := strings.ToLower(args[1])
+		if args[0] == "disable" {
+			// 停用当前频道后就无法再用命令重新启用它
+			if name == msg.Channel {
+				return fmt.Sprintf("Cannot disable %s from a chat on %s; send the command from another channel.", name, name)
+			}
+			if err := channelManager.Disable(name); err != nil {
+				return fmt.Sprintf("Failed to disable %s: %v", name, err)
+			}
+			return fmt.Sprintf("Channel %s disabled. Outgoing messages will wait until /channels enable %s.", name, name)
+		}
+
+		if !channelManager.Disabled(name) {
+			return fmt.Sprintf("Channel %s is not disabled.", name)
+		}
+		waiting := dispatcher.Pending()[name]
+		err := channelManager.Enable(name)
+		for ch, caps := range channelManager.Capabilities() {
+			for _, loop := range loops {
+				loop.SetChannelCapabilities(ch, caps.Describe())
+			}
+		}
+		if err != nil {
+			return fmt.Sprintf("Channel %s re-enabled, but it failed to start: %v", name, err)
+		}
+		if waiting > 0 {
+			return fmt.Sprintf("Channel %s enabled. Sending %d waiting messages.", name, waiting)
+		}
+		return fmt.Sprintf("Channel %s enabled.", name)
+	}
+	for _, loop := range loops {
+		loop.RegisterAdminCommand("channels", "Show channels, or enable/disable one at runtime (/channels enable|disable <name>, admins only)", handler)
+	}
+}
+
+// startHTTPServer 根据 gateway 配置启动 HTTP 服务
+// 未配置端口时返回 nil
+func startHTTPServer(cfg *config.Config, cronService *cron.CronService, channelManager *channels.Manager) *gateway.Server {
+	if cfg.Gateway.Port <= 0 {
+		if cfg.Channels.Discord.Enabled {
+			log.Printf("Warning: Discord 斜杠命令需要 gateway HTTP 服务，请配置 gateway.port")
+		}
+		if cfg.Channels.Feishu.Enabled {
+			log.Printf("Warning: 飞书事件订阅需要 gateway HTTP 服务，请配置 gateway.port")
+		}
+		if cfg.Channels.Webhook.Enabled {
+			log.Printf("Warning: Webhook 频道需要 gateway HTTP 服务，请配置 gateway.port")
+		}
+		return nil
+	}
+
+	server := gateway.NewServer(cfg.Gateway.Host, cfg.Gateway.Port, cfg.Gateway.Token)
+
+	if cfg.Gateway.Calendar.Enabled {
+		horizon := time.Duration(cfg.Gateway.Calendar.Days) * 24 * time.Hour
+		maxPerJob := cfg.Gateway.Calendar.MaxPerJob
+		server.Handle("/calendar.ics", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+			w.Header().Set("Content-Disposition", `inline; filename="nanogrip.ics"`)
+			fmt.Fprint(w, cronService.CalendarFeed(time.Now(), horizon, maxPerJob))
+		})
+		log.Printf("日历订阅已启用: /calendar.ics（未来 %d 天）", cfg.Gateway.Calendar.Days)
+	}
+
+	// Discord 斜杠命令回调（Discord 自行签名，不使用访问令牌；热重载启用 Discord 后同样生效）
+	server.HandlePublic("POST /discord/interactions", channelManager.HandleDiscordInteraction)
+	// 飞书事件回调（使用 verificationToken / encryptKey 校验）
+	server.HandlePublic("POST /feishu/events", channelManager.HandleFeishuEvent)
+	// 外部事件推送（每个 Webhook 使用自己的 HMAC 签名或令牌校验）
+	server.HandlePublic("POST /hooks/{name}", channelManager.HandleWebhook)
+
+	if err := server.Start(); err != nil {
+		log.Printf("Warning: 启动 HTTP 服务失败: %v", err)
+		return nil
+	}
+	return server
+}
+
+// gatewayStatus 是运行中的 gateway 的状态（管理接口 GET /status，nanogrip status 使用）
+type gatewayStatus struct {
+	PID       int       `json:"pid"`
+	Version   string    `json:"version"`
+	StartedAt time.Time `json:"started_at"`
+	Workspace string    `json:"workspace"`
+	Model     string    `json:"model"`
+	Channels  []string  `json:"channels"`
+	Agents    []string  `json:"agents,omitempty"`
+	CronJobs  int       `json:"cron_jobs"`
+	Inbound   int       `json:"inbound_queue"`
+	Outbound  int       `json:"outbound_queue"`
+
+	InboundLow int `json:"inbound_low_queue"` // 其中低优先级（后台）消息的数量
+}
+
+// startAdminServer 启动本机管理接口（workspace/admin.sock），供 "nanogrip cron" 等 CLI 子命令使用
+// 启动失败时记录警告并返回 nil
+func startAdminServer(workspace string, cronService *cron.CronService, status func() gatewayStatus) *gateway.AdminServer {
+	admin := gateway.NewAdminServer(gateway.AdminSocketPath(workspace))
+
+	admin.Handle("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		gateway.WriteJSON(w, http.StatusOK, status())
+	})
+
+	admin.Handle("GET /cron", func(w http.ResponseWriter, r *http.Request) {
+		jobs := cronService.ListJobs()
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].NextRun.Before(jobs[j].NextRun) })
+		gateway.WriteJSON(w, http.StatusOK, jobs)
+	})
+
+	admin.Handle("GET /cron/history", func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		gateway.WriteJSON(w, http.StatusOK, cronService.History(r.URL.Query().Get("job"), limit))
+	})
+
+	admin.Handle("POST /cron", func(w http.ResponseWriter, r *http.Request) {
+		var job cron.Job
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			gateway.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid job: %v", err))
+			return
+		}
+		if err := validateAdminCronJob(&job); err != nil {
+			gateway.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		gateway.WriteJSON(w, http.StatusCreated, cronService.AddJob(&job))
+	})
+
+	admin.Handle("DELETE /cron/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if strings.HasPrefix(id, cron.ConfigJobPrefix) {
+			gateway.WriteError(w, http.StatusBadRequest, fmt.Errorf("job %s is defined in the config file; remove it there", id))
+			return
+		}
+		if !cronService.RemoveJob(id) {
+			gateway.WriteError(w, http.StatusNotFound, fmt.Errorf("job %s not found", id))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	if err := admin.Start(); err != nil {
+		log.Printf("Warning: 启动管理接口失败: %v", err)
+		return nil
+	}
+	return admin
+}
+
+// validateAdminCronJob 检查通过管理接口添加的任务，并补全服务端决定的字段
+func validateAdminCronJob(job *cron.Job) error {
+	job.ID = ""
+	job.LastRun = time.Time{}
+	if job.Channel == "" || job.To == "" {
+		return fmt.Errorf("channel and to are required")
+	}
+	if job.Builtin != "" {
+		return fmt.Errorf("built-in jobs can only be defined in the config file")
+	}
+	if job.TriggerAgent && job.AgentCommand == "" {
+		return fmt.Errorf("agent jobs require a command")
+	}
+	if !job.TriggerAgent && job.Message == "" {
+		return fmt.Errorf("message jobs require a message")
+	}
+	if err := cron.ValidateSchedule(job.Schedule); err != nil {
+		return err
+	}
+	if _, err := cron.ParseMisfirePolicy(string(job.Misfire)); err != nil {
+		return err
+	}
+	if job.MaxRuntime < 0 || job.Jitter < 0 {
+		return fmt.Errorf("max runtime and jitter must not be negative")
+	}
+	if job.Schedule.Kind == "at" && time.UnixMilli(job.Schedule.AtMs).Before(time.Now()) {
+		return fmt.Errorf("at time %s is in the past", time.UnixMilli(job.Schedule.AtMs).Format("2006-01-02 15:04"))
+	}
+	if job.Name == "" {
+		job.Name = job.Message + job.AgentCommand
+	}
+	job.Deliver = true
+	job.DeleteAfterRun = job.Schedule.Kind == "at"
+	return nil
+}
+
+// newWebSearchTool 根据配置创建网络搜索工具
+// 主提供商和备用提供商都不可用时返回 nil
+func newWebSearchTool(cfg *config.Config) *tools.WebSearchTool {
+	search := cfg.Tools.Web.Search
+	searchTool := tools.NewWebSearchTool(search.APIKey, search.Provider, search.MaxResults)
+	searchTool.SetBaseURL(search.BaseURL)
+	searchTool.SetEngineID(search.CX)
+	searchTool.SetFallback(search.Fallback)
+
+	if err := searchTool.Ready(); err != nil {
+		log.Printf("警告: 网络搜索不可用（%v），请检查配置文件中的 tools.web.search", err)
+		return nil
+	}
+	log.Printf("注册网络搜索工具: %s (maxResults: %d, fallback: %s)", search.Provider, search.MaxResults, search.Fallback)
+	return searchTool
+}
+
+// newShellTool 根据 tools.exec 配置创建 shell 工具
+// 沙箱不可用时记录警告并拒绝执行命令，而不是悄悄退回到主机执行
+func newShellTool(cfg *config.Config, workspace string) *tools.ShellTool {
+	shellTool := tools.NewShellTool(cfg.Tools.Exec.Timeout)
+	if err := shellTool.SetShell(cfg.Tools.Exec.Shell); err != nil {
+		log.Printf("Warning: tools.exec.shell 配置有误，shell 工具已禁用: %v", err)
+		shellTool.Disable(err.Error())
+		return shellTool
+	}
+
+	policy, err := tools.NewCommandPolicy(cfg.Tools.Exec.DenyCommands, cfg.Tools.Exec.AllowCommands, cfg.Tools.Exec.ScrubEnv, cfg.SecretValues())
+	if err != nil {
+		log.Printf("Warning: 命令策略配置有误，shell 工具已禁用: %v", err)
+		shellTool.Disable(fmt.Sprintf("invalid command policy: %v", err))
+		return shellTool
+	}
+	shellTool.SetPolicy(policy)
+
+	sandbox, err := tools.NewSandbox(tools.SandboxOptions{
+		Mode:      cfg.Tools.Exec.Sandbox,
+		Workspace: workspace,
+		Image:     cfg.Tools.Exec.SandboxImage,
+		CPUs:      cfg.Tools.Exec.CPUs,
+		MemoryMB:  cfg.Tools.Exec.MemoryMB,
+		Network:   cfg.Tools.Exec.Network,
+	})
+	if err != nil {
+		log.Printf("Warning: 命令执行沙箱不可用，shell 工具已禁用: %v", err)
+		shellTool.Disable(fmt.Sprintf("sandbox unavailable: %v", err))
+		return shellTool
+	}
+	if sandbox != nil {
+		shellTool.SetSandbox(sandbox)
+		log.Printf("Shell 命令将在 %s 沙箱中执行", sandbox.Mode())
+	}
+	return shellTool
+}
+
+// newSessionManager 创建会话管理器，配置了 secrets.encryptSessions 时启用会话文件加密
+// 找不到密钥时直接退出，避免在用户以为已加密的情况下写入明文；未启用加密时仍用找到的密钥读取之前加密的会话
+func newSessionManager(cfg *config.Config, configPath, workspace string) *session.SessionManager {
+	sm := session.NewSessionManager(workspace)
+	c := sessionCipher(cfg, configPath)
+	sm.SetCipher(c)
+	if c == nil {
+		// 关闭加密后之前加密保存的会话仍然需要读取，有密钥时用它解密
+		if path, err := resolveConfigPath(configPath); err == nil {
+			if rc, err := secrets.Open(filepath.Dir(path)); err == nil {
+				sm.SetReadCipher(rc)
+			} else if !errors.Is(err, secrets.ErrNoKey) {
+				log.Printf("警告: 无法读取会话密钥，已加密的会话将无法读取: %v", err)
+			}
+		}
+	}
+	return sm
+}
+
+// sessionCipher 返回加密会话文件和其他保存聊天内容的文件（持久化入站队列等）使用的加密器
+// 未配置 secrets.encryptSessions 时返回 nil；找不到密钥时直接退出
+func sessionCipher(cfg *config.Config, configPath string) *secrets.Cipher {
+	if !cfg.Secrets.EncryptSessions {
+		return nil
+	}
+	path, err := resolveConfigPath(configPath)
+	if err != nil {
+		log.Fatalf("启用会话加密失败: %v", err)
+	}
+	c, err := secrets.Open(filepath.Dir(path))
+	if err != nil {
+		log.Fatalf("启用会话加密失败: %v", err)
+	}
+	return c
+}
+
+// newTmuxTool 创建 tmux 工具，以下情况不启用（返回 nil）：
+// Windows 或没有安装 tmux；启用了命令沙箱或严格模式（tools.exec.allowCommands），tmux 会话中的命令不受它们限制
+func newTmuxTool(cfg *config.Config, workspace string) *tools.TmuxTool {
+	if !tools.TmuxAvailable() {
+		return nil
+	}
+	if cfg.Tools.Exec.Sandbox != "none" || len(cfg.Tools.Exec.AllowCommands) > 0 {
+		log.Printf("命令沙箱或 tools.exec.allowCommands 已启用，不注册 tmux 工具")
+		return nil
+	}
+	policy, err := tools.NewCommandPolicy(cfg.Tools.Exec.DenyCommands, nil, cfg.Tools.Exec.ScrubEnv, cfg.SecretValues())
+	if err != nil {
+		return nil
+	}
+
+	tmuxTool := tools.NewTmuxTool(workspace, os.Getenv("NANOGRIP_TMUX_SOCKET_DIR"))
+	tmuxTool.SetPolicy(policy)
+	return tmuxTool
+}
+
+// newCodeExecTool 创建 code_exec 工具，找不到 Python 解释器，或启用了命令沙箱或严格模式时不启用（返回 nil）
+// 脚本直接在主机上执行，不受沙箱和 allowCommands 限制
+func newCodeExecTool(cfg *config.Config, workspace string) *tools.CodeExecTool {
+	if cfg.Tools.Exec.Sandbox != "none" || len(cfg.Tools.Exec.AllowCommands) > 0 {
+		return nil
+	}
+	codeTool := tools.NewCodeExecTool(workspace, cfg.Tools.Exec.Python, cfg.Tools.Exec.Timeout)
+	if !codeTool.Available() {
+		return nil
+	}
+	policy, err := tools.NewCommandPolicy(nil, nil, cfg.Tools.Exec.ScrubEnv, cfg.SecretValues())
+	if err != nil {
+		return nil
+	}
+	codeTool.SetPolicy(policy)
+	return codeTool
+}
+
+// newToolRegistry 创建工具注册表并注册与工作区相关的基础工具（搜索、抓取、Shell、文件系统）
+// 参数:
+//
+//	allowed: 允许使用的工具，为空表示全部
+func newToolRegistry(cfg *config.Config, workspace string, allowed []string) *tools.ToolRegistry {
+	registry := tools.NewToolRegistry()
+	registry.SetAllowed(allowed)
+	registry.SetOverrides(toolOverrides(cfg))
+	registry.SetPolicy(toolPolicy(cfg))
+	// 先脱敏再写审计日志，密钥既不进入模型上下文也不进入审计日志
+	registry.AddPostHook(func(ctx context.Context, name string, params map[string]interface{}, result string, err error, elapsed time.Duration) string {
+		return redact.String(result)
+	})
+	if cfg.Tools.Audit.Enabled {
+		registry.AddPostHook(audit.New(filepath.Join(workspace, "audit"), cfg.Tools.Audit.RetentionDays).Hook)
+	}
+	// 审计日志记录完整结果的摘要之后，再把过长的结果换成文件路径
+	registry.AddPostHook(tools.ArtifactHook(filepath.Join(workspace, "artifacts", "tool-results"), cfg.Tools.MaxResultChars))
+	if searchTool := newWebSearchTool(cfg); searchTool != nil {
+		registry.Register(searchTool)
+	}
+	registry.Register(tools.NewWebFetchTool(
+		cfg.Tools.Web.Fetch.Timeout,
+		cfg.Tools.Web.Fetch.MaxBytes,
+		cfg.Tools.Web.Fetch.MaxChars,
+	))
+	registry.Register(newShellTool(cfg, workspace))
+	if tmuxTool := newTmuxTool(cfg, workspace); tmuxTool != nil {
+		registry.Register(tmuxTool)
+	}
+	if codeTool := newCodeExecTool(cfg, workspace); codeTool != nil {
+		registry.Register(codeTool)
+	}
+	filesystemTool := tools.NewFilesystemTool(workspace, cfg.Tools.RestrictToWorkspace)
+	filesystemTool.SetAllowedRoots(allowedRoots(cfg))
+	registry.Register(filesystemTool)
+	documentTool := tools.NewDocumentTool(workspace, cfg.Tools.RestrictToWorkspace)
+	documentTool.SetAllowedRoots(allowedRoots(cfg))
+	registry.Register(documentTool)
+	registry.Register(tools.NewFeedsTool(workspace, cfg.Tools.Web.Fetch.Timeout))
+	if httpCfg := cfg.Tools.Web.HTTP; len(httpCfg.AllowDomains) > 0 {
+		httpTool := tools.NewHTTPRequestTool(httpCfg.Timeout, httpCfg.MaxChars)
+		httpTool.SetDomains(httpCfg.AllowDomains, httpCfg.DenyDomains)
+		httpTool.SetHeaders(httpCfg.Headers)
+		registry.Register(httpTool)
+	}
+	registerEmailTools(registry, cfg, workspace)
+	registerSkillTools(registry, workspace)
+	return registry
+}
+
+// registerMessageTools 注册 message 工具和基于它的 send_template 工具
+func registerMessageTools(registry *tools.ToolRegistry, workspace string, messageChan chan string) {
+	messageTool := tools.NewMessageTool(messageChan)
+	registry.Register(messageTool)
+	registry.Register(tools.NewSendTemplateTool(workspace, messageTool))
+}
+
+// allowedRoots 将配置中的 tools.allowedPaths 转换为文件工具额外允许访问的目录
+func allowedRoots(cfg *config.Config) []tools.AllowedRoot {
+	roots := make([]tools.AllowedRoot, 0, len(cfg.Tools.AllowedPaths))
+	for _, p := range cfg.Tools.AllowedPaths {
+		if p.Path != "" {
+			roots = append(roots, tools.AllowedRoot{Path: p.Path, Write: p.Write})
+		}
+	}
+	return roots
+}
+
+// registerSkillTools 把技能在 tools.json 中声明的命令注册为 skill_<技能>_<命令> 工具
+// 技能命令通过 shell 工具执行，注册表中没有 shell 工具时（例如被 tools 白名单排除）不注册
+func registerSkillTools(registry *tools.ToolRegistry, workspace string) {
+	shellTool, ok := registry.Get("shell").(*tools.ShellTool)
+	if !ok {
+		return
+	}
+	loader := skills.NewSkillsLoader(workspace, builtinSkillsPath(workspace))
+	count, errs := tools.RegisterSkillTools(registry, loader, shellTool)
+	for _, err := range errs {
+		log.Printf("Warning: 技能命令加载失败: %v", err)
+	}
+	if count > 0 {
+		log.Printf("注册 %d 个技能命令工具", count)
+	}
+}
+
+// registerEmailTools 按配置注册邮件工具：配置了 SMTP 时注册 send_email，配置了 IMAP 时注册 search_email
+func registerEmailTools(registry *tools.ToolRegistry, cfg *config.Config, workspace string) {
+	emailCfg := cfg.Tools.Email
+	if emailCfg.SMTP.Host != "" {
+		sendTool := tools.NewSendEmailTool(email.SMTPOptions{
+			Host:     emailCfg.SMTP.Host,
+			Port:     emailCfg.SMTP.Port,
+			Username: emailCfg.SMTP.Username,
+			Password: emailCfg.SMTP.Password,
+			From:     emailCfg.SMTP.From,
+		}, emailCfg.AllowRecipients, workspace, cfg.Tools.RestrictToWorkspace)
+		sendTool.SetAllowedRoots(allowedRoots(cfg))
+		registry.Register(sendTool)
+	}
+	if emailCfg.IMAP.Host != "" {
+		registry.Register(tools.NewSearchEmailTool(email.IMAPOptions{
+			Host:     emailCfg.IMAP.Host,
+			Port:     emailCfg.IMAP.Port,
+			Username: emailCfg.IMAP.Username,
+			Password: emailCfg.IMAP.Password,
+		}, emailCfg.IMAP.Mailbox))
+	}
+}
+
+// watchWorkspace 监视 Agent 工作区中的技能、Bootstrap 文件（AGENTS.md 等）、系统提示词模板和 MEMORY.md
+// 技能被修改时清空技能缓存并重新注册技能命令工具；其他文件每条消息都会重新读取，这里只记录日志
+// 修改在下一条消息时生效，无需重启
+func watchWorkspace(ctx context.Context, loop *agent.AgentLoop) {
+	workspace := loop.Workspace()
+	skillDirs := []string{filepath.Join(workspace, "skills"), builtinSkillsPath(workspace)}
+
+	paths := append([]string{}, skillDirs...)
+	for _, name := range []string{"AGENTS.md", "SOUL.md", "USER.md", "TOOLS.md", "IDENTITY.md", agent.SystemTemplatePath, "memory/MEMORY.md"} {
+		paths = append(paths, filepath.Join(workspace, filepath.FromSlash(name)))
+	}
+
+	watcher := watch.New(paths, watch.DefaultInterval, func(changed []string) {
+		skillsChanged := false
+		names := make([]string, 0, len(changed))
+		for _, path := range changed {
+			for _, dir := range skillDirs {
+				if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+					skillsChanged = true
+				}
+			}
+			if rel, err := filepath.Rel(workspace, path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+			names = append(names, path)
+		}
+
+		if skillsChanged {
+			loop.InvalidateSkills()
+			registerSkillTools(loop.Tools(), workspace)
+		}
+		log.Printf("[Watch] 工作区文件已修改，下一条消息生效: %s", strings.Join(names, ", "))
+	})
+	go watcher.Run(ctx)
+}
+
+// builtinSkillsPath 返回内置技能目录（与 AgentLoop 相同的查找顺序）
+func builtinSkillsPath(workspace string) string {
+	builtinSkills := filepath.Join(workspace, "..", "skills")
+	if _, err := os.Stat(builtinSkills); os.IsNotExist(err) {
+		builtinSkills = "/workspace/nanogrip/skills"
+		if _, err := os.Stat(builtinSkills); os.IsNotExist(err) {
+			builtinSkills = "skills"
+		}
+	}
+	return builtinSkills
+}
+
+// agentDeps 是创建命名 Agent 时共享的组件
+type agentDeps struct {
+	configPath  string
+	msgBus      *bus.MessageBus
+	cronService *cron.CronService
+	mcpManager  *mcp.MCPManager
+	approvals   *tools.ApprovalManager
+	inputs      *tools.InteractionManager
+	messageChan chan string
+}
+
+// newAgentInstance 创建 agents.instances 中定义的一个 Agent
+// 每个 Agent 有自己的工作区、提供商、工具注册表、会话和子代理；定时任务服务和 MCP 服务器是共享的
+func newAgentInstance(cfg *config.Config, inst config.AgentInstanceConfig, deps agentDeps) (*agent.AgentLoop, error) {
+	workspace := cfg.InstanceWorkspacePath(inst)
+	if err := os.MkdirAll(workspace, 0755); err != nil {
+		return nil, err
+	}
+
+	provider, err := createProvider(cfg, inst.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := cfg.Agents.Defaults
+	registry := newToolRegistry(cfg, workspace, inst.Tools)
+	registerMessageTools(registry, workspace, deps.messageChan)
+
+	subagents := agent.NewSubagentManager(
+		provider,
+		workspace,
+		deps.msgBus,
+		inst.Model,
+		defaults.Temperature,
+		defaults.MaxTokens,
+		defaults.MaxToolIterations,
+		registry,
+		builtinSkillsPath(workspace),
+	)
+	subagents.SetAgentName(inst.Name)
+	applySubagentLimits(subagents, defaults)
+	registry.Register(tools.NewSpawnTool(func(task string, opts tools.SpawnOptions, originChannel string, originChatID string) string {
+		return subagents.Spawn(task, opts, originChannel, originChatID)
+	}))
+	registry.Register(tools.NewSubagentsTool(subagents))
+	registry.Register(tools.NewTaskResultTool(subagents))
+	registry.Register(tools.NewCronTool(deps.cronService))
+	for _, tool := range deps.mcpManager.GetTools() {
+		registry.Register(tool)
+	}
+	registry.SetApprover(deps.approvals)
+	registry.SetInteractor(deps.inputs)
+
+	loop := agent.NewAgentLoop(
+		provider,
+		registry,
+		deps.msgBus,
+		newSessionManager(cfg, deps.configPath, workspace),
+		workspace,
+		inst.Model,
+		defaults.MaxTokens,
+		defaults.Temperature,
+		defaults.MaxToolIterations,
+		defaults.MemoryWindow,
+	)
+	loop.SetMessageChan(deps.messageChan)
+	loop.SetSubagentManager(subagents)
+	loop.SetSessionIdleTimeout(time.Duration(defaults.SessionIdleMinutes) * time.Minute)
+	loop.SetMemoryIsolation(defaults.MemoryScope == "chat", defaults.SharedMemory)
+	applyReasoning(loop, defaults)
+	loop.SetLanguage(defaults.Language)
+	loop.SetTimezone(defaults.Timezone)
+	applyConsolidation(loop, cfg)
+	applyRouting(loop, cfg)
+	loop.SetMaxConcurrentSessions(defaults.MaxConcurrentSessions)
+	loop.SetSessionRetention(time.Duration(cfg.Sessions.MaxAge)*24*time.Hour, cfg.Sessions.MaxCount)
+	loop.SetSessionTitles(!cfg.Sessions.DisableTitles)
+	loop.SetToolScopes(toolScopes(cfg))
+	enableTodoReminders(loop, deps.cronService)
+	applyChannelFeedback(loop, cfg)
+	loop.SetRolePrompt(inst.SystemPrompt)
+	return loop, nil
+}
+
+// newRateLimiter 根据 rateLimit 配置创建限流器，每日用量保存在 workspace/usage.json
+func newRateLimiter(cfg *config.Config, workspace string) *ratelimit.Limiter {
+	limits := func(l config.RateLimits) ratelimit.Limits {
+		return ratelimit.Limits{
+			MessagesPerMinute: l.MessagesPerMinute,
+			LLMCallsPerDay:    l.LLMCallsPerDay,
+			TokensPerDay:      l.TokensPerDay,
+		}
+	}
+	limiter := ratelimit.New(ratelimit.Options{
+		PerSender:  limits(cfg.RateLimit.PerSender),
+		PerChannel: limits(cfg.RateLimit.PerChannel),
+		Exempt:     cfg.RateLimit.Exempt,
+		StatePath:  filepath.Join(workspace, "usage.json"),
+	})
+	if limiter.Enabled() {
+		log.Println("限流已启用（rateLimit）")
+	}
+	return limiter
+}
+
+// applySubagentLimits 把 agents.defaults 中的子代理并发数和超时时间应用到子代理管理器
+func applySubagentLimits(subagents *agent.SubagentManager, defaults config.AgentDefaults) {
+	subagents.SetLimits(defaults.MaxConcurrentSubagents, time.Duration(defaults.SubagentTimeout)*time.Second)
+}
+
+// applyReasoning 把 agents.defaults.reasoning 中的推理参数应用到 Agent
+func applyReasoning(loop *agent.AgentLoop, defaults config.AgentDefaults) {
+	loop.SetReasoning(providers.ReasoningOptions{
+		Effort:       defaults.Reasoning.Effort,
+		BudgetTokens: defaults.Reasoning.BudgetTokens,
+	}, defaults.Reasoning.Log)
+}
+
+// applyConsolidation 设置记忆整理的模型、阈值、调度方式和用户档案学习
+// 整理模型无法创建时记录日志并改用主模型
+func applyConsolidation(loop *agent.AgentLoop, cfg *config.Config) {
+	c := cfg.Agents.Defaults.Consolidation
+	opts := agent.ConsolidationOptions{
+		Timeout:    time.Duration(c.Timeout) * time.Second,
+		Threshold:  c.Threshold,
+		BatchSize:  c.BatchSize,
+		KeepRecent: c.KeepRecent,
+		IdleDelay:  time.Duration(c.IdleSeconds) * time.Second,
+	}
+	if c.Model != "" {
+		provider, err := createProvider(cfg, c.Model)
+		if err != nil {
+			log.Printf("记忆整理模型 %s 无法使用，改用主模型: %v", c.Model, err)
+		} else {
+			opts.Provider = provider
+			opts.Model = c.Model
+		}
+	}
+	loop.SetConsolidation(opts)
+
+	switch c.UserProfile {
+	case "confirm":
+		loop.SetUserProfileLearning(false)
+	case "auto":
+		loop.SetUserProfileLearning(true)
+	}
+}
+
+// applyRouting 按配置设置按复杂度选择模型，简单请求的模型无法使用时不路由
+func applyRouting(loop *agent.AgentLoop, cfg *config.Config) {
+	r := cfg.Agents.Routing
+	opts := agent.RoutingOptions{
+		MaxChars:   r.MaxChars,
+		Keywords:   r.Keywords,
+		Classifier: r.Classifier,
+	}
+	if r.Model != "" {
+		provider, err := createProvider(cfg, r.Model)
+		if err != nil {
+			log.Printf("模型路由的模型 %s 无法使用，所有请求使用主模型: %v", r.Model, err)
+		} else {
+			opts.Provider = provider
+			opts.Model = r.Model
+		}
+	}
+	loop.SetRouting(opts)
+}
+
+// enableTodoReminders 让 Agent 的待办工具通过定时任务服务发送到期提醒
+func enableTodoReminders(loop *agent.AgentLoop, cronService *cron.CronService) {
+	if todo, ok := loop.Tools().Get("todo").(*tools.TodoTool); ok {
+		todo.SetCronService(cronService)
+	}
+}
+
+// applyChannelFeedback 设置 Agent 在各通道处理消息期间的反馈方式
+// 包括快速确认、"正在输入"状态、表情回应和待办进度提示（输入状态和表情回应由通道管理器发送，见 SetTypingFunc、SetReactFunc）
+func applyChannelFeedback(loop *agent.AgentLoop, cfg *config.Config) {
+	telegram := cfg.Channels.Telegram
+	loop.SetAckOptions("telegram", ackOptions(telegram.Ack))
+	activity := agent.ActivityOptions{
+		Typing:   telegram.Typing,
+		Progress: telegram.ProgressUpdates,
+	}
+	if telegram.Reactions.Enabled {
+		activity.WorkingReaction = telegram.Reactions.Working
+		activity.DoneReaction = telegram.Reactions.Done
+	}
+	loop.SetActivityOptions("telegram", activity)
+}
+
+// ackOptions 将通道的 ack 配置转换为 Agent 的快速确认选项
+func ackOptions(ack config.AckConfig) agent.AckOptions {
+	return agent.AckOptions{
+		Enabled:      ack.Enabled,
+		Delay:        time.Duration(ack.DelaySeconds) * time.Second,
+		Message:      ack.Message,
+		UseModelText: ack.UseModelText,
+	}
+}
+
+// createProvider 根据模型名称创建对应的 LLM 提供商
+// 配置了 agents.defaults.fallbacks 时，返回的提供商在请求失败后依次改用备用模型
+func createProvider(cfg *config.Config, model string) (providers.LLMProvider, error) {
+	primary, err := newModelProvider(cfg, model)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := cfg.Agents.Defaults
+	var fallbacks []providers.Fallback
+	for _, name := range defaults.Fallbacks {
+		if name == model {
+			continue
+		}
+		provider, err := newModelProvider(cfg, name)
+		if err != nil {
+			return nil, fmt.Errorf("fallback model %s: %w", name, err)
+		}
+		fallbacks = append(fallbacks, providers.Fallback{Provider: provider, Model: name})
+	}
+	if len(fallbacks) == 0 {
+		return withBudget(cfg, primary)
+	}
+
+	log.Printf("备用模型: %s", strings.Join(defaults.Fallbacks, " → "))
+	return withBudget(cfg, providers.NewFallbackProvider(primary, fallbacks, time.Duration(defaults.FallbackTimeout)*time.Second))
+}
+
+// budgets 按用量文件路径缓存的每日花费记录，同一进程中创建的所有提供商共享同一个
+var (
+	budgetsMu sync.Mutex
+	budgets   = make(map[string]*budget.Tracker)
+)
+
+// budgetTracker 返回 budget 配置对应的每日花费记录，用量保存在 workspace/budget.json
+func budgetTracker(cfg *config.Config) *budget.Tracker {
+	statePath := filepath.Join(cfg.GetWorkspacePath(), "budget.json")
+
+	budgetsMu.Lock()
+	defer budgetsMu.Unlock()
+	if tracker, ok := budgets[statePath]; ok {
+		return tracker
+	}
+
+	resetAt, err := budget.ParseResetTime(cfg.Budget.ResetTime)
+	if err != nil {
+		log.Printf("budget.resetTime 无效，改用午夜: %v", err)
+	}
+	limits := make(map[string]budget.Limit, len(cfg.Budget.Providers))
+	for name, l := range cfg.Budget.Providers {
+		limits[name] = budget.Limit{MaxTokensPerDay: l.MaxTokensPerDay, MaxCostPerDay: l.MaxCostPerDay}
+	}
+	prices := make(map[string]budget.Price, len(cfg.Budget.Prices))
+	for model, p := range cfg.Budget.Prices {
+		prices[model] = budget.Price{Input: p.Input, Output: p.Output}
+	}
+	tracker := budget.New(budget.Options{
+		Limits:    limits,
+		Prices:    prices,
+		ResetAt:   resetAt,
+		StatePath: statePath,
+	})
+	if tracker.Enabled() {
+		log.Printf("每日花费上限已启用（budget），每天 %s 清零", cfg.Budget.ResetTime)
+	}
+	budgets[statePath] = tracker
+	return tracker
+}
+
+// withBudget 配置了 budget 时为提供商加上每日花费检查
+// 配置了 budget.fallbackModel 时，预算用完后改用该模型
+func withBudget(cfg *config.Config, provider providers.LLMProvider) (providers.LLMProvider, error) {
+	tracker := budgetTracker(cfg)
+	if !tracker.Enabled() {
+		return provider, nil
+	}
+	var fallback *providers.Fallback
+	if model := cfg.Budget.FallbackModel; model != "" {
+		fallbackProvider, err := newModelProvider(cfg, model)
+		if err != nil {
+			return nil, fmt.Errorf("budget fallback model %s: %w", model, err)
+		}
+		fallback = &providers.Fallback{Provider: fallbackProvider, Model: model}
+	}
+	return budget.NewProvider(provider, tracker, fallback), nil
+}
+
+// newModelProvider 创建单个模型的 LLM 提供商
+func newModelProvider(cfg *config.Config, model string) (providers.LLMProvider, error) {
+	return providers.NewProvider(providers.ProviderOptions{
+		DefaultModel: model,
+		OpenAI: providers.APIConfig{
+			APIKey:  cfg.Providers.OpenAI.APIKey,
+			APIBase: cfg.Providers.OpenAI.APIBase,
+		},
+		Anthropic: providers.APIConfig{
+			APIKey:  cfg.Providers.Anthropic.APIKey,
+			APIBase: cfg.Providers.Anthropic.APIBase,
+		},
+	})
+}
+
+// newEmbeddingsProvider 创建文本向量提供商（providers.embeddings），未配置时返回 nil
+func newEmbeddingsProvider(cfg *config.Config) (providers.EmbeddingsProvider, error) {
+	embeddings := cfg.Providers.Embeddings
+	return providers.NewEmbeddingsProvider(providers.EmbeddingsOptions{
+		Provider:   embeddings.Provider,
+		Model:      embeddings.Model,
+		Dimensions: embeddings.Dimensions,
+		BatchSize:  embeddings.BatchSize,
+		Timeout:    time.Duration(embeddings.Timeout) * time.Second,
+		API: providers.APIConfig{
+			APIKey:  embeddings.APIKey,
+			APIBase: embeddings.APIBase,
+		},
+		OpenAI: providers.APIConfig{
+			APIKey:  cfg.Providers.OpenAI.APIKey,
+			APIBase: cfg.Providers.OpenAI.APIBase,
+		},
+	})
+}
+
+// handleSkills 管理工作区技能
+// list 列出所有技能及其状态；enable/disable 启用或禁用技能；
+// install 从 git 仓库或本地目录安装技能并校验 SKILL.md
+func handleSkills(configPath string, args []string) {
+	if len(args) == 0 {
+		fmt.Println("用法: nanogrip skills <list|enable <名称>|disable <名称>|install [--force] <git 地址|路径>>")
+		return
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("无法加载配置: %v\n", err)
+		return
+	}
+	workspace := cfg.GetWorkspacePath()
+	loader := skills.NewSkillsLoader(workspace, builtinSkillsPath(workspace))
+
+	switch args[0] {
+	case "list", "ls":
+		all := loader.AllSkills()
+		if len(all) == 0 {
+			fmt.Println("没有安装技能")
+			return
+		}
+		disabled := loader.Disabled()
+		for _, skill := range all {
+			status := "✓"
+			note := ""
+			if disabled[skill.Name] {
+				status = "-"
+				note = "（已禁用）"
+			} else if missing := loader.MissingRequirements(skill); missing != "" {
+				status = "✗"
+				note = "（缺少 " + missing + "）"
+			}
+			fmt.Printf("%s %-20s [%s] %s%s\n", status, skill.Name, skill.Source, skill.Description, note)
+			if _, problems, err := skills.ValidateSkill(filepath.Dir(skill.Path)); err == nil {
+				for _, problem := range problems {
+					fmt.Printf("    ⚠ %s\n", problem)
+				}
+			}
+		}
+
+	case "enable", "disable":
+		if len(args) < 2 {
+			fmt.Printf("用法: nanogrip skills %s <名称>\n", args[0])
+			return
+		}
+		enabled := args[0] == "enable"
+		if err := loader.SetEnabled(args[1], enabled); err != nil {
+			fmt.Printf("操作失败: %v\n", err)
+			return
+		}
+		if enabled {
+			fmt.Printf("✓ 已启用技能 %s\n", args[1])
+		} else {
+			fmt.Printf("✓ 已禁用技能 %s\n", args[1])
+		}
+
+	case "install":
+		fs := flag.NewFlagSet("skills install", flag.ExitOnError)
+		force := fs.Bool("force", false, "覆盖同名的工作区技能")
+		fs.Parse(args[1:])
+		if fs.NArg() == 0 {
+			fmt.Println("用法: nanogrip skills install [--force] <git 地址|路径>")
+			return
+		}
+
+		skill, err := loader.Install(fs.Arg(0), *force)
+		if err != nil {
+			fmt.Printf("安装失败: %v\n", err)
+			return
+		}
+		fmt.Printf("✓ 技能 %s 已安装到 %s\n", skill.Name, filepath.Dir(skill.Path))
+		if missing := loader.MissingRequirements(skill); missing != "" {
+			fmt.Printf("  ⚠ 缺少依赖: %s（安装依赖后技能才可用）\n", missing)
+		}
+
+	default:
+		fmt.Printf("未知的 skills 子命令: %s\n", args[0])
+	}
+}
+
+// handleMCPServe 把 nanogrip 的工具作为 MCP 服务器提供给其他客户端（Claude Desktop、编辑器等）
+// 默认通过 stdio 通信（由客户端启动进程）；--sse 时监听 HTTP SSE
+// 暴露的工具：文件系统、文档、Shell、网页、待办、定时任务和记忆，与 Agent 共用工作区和 tools 配置
+func handleMCPServe(configPath string, args []string) {
+	fs := flag.NewFlagSet("mcp-serve", flag.ExitOnError)
+	sseAddr := fs.String("sse", "", "通过 HTTP SSE 监听此地址（例如 127.0.0.1:8765），为空时使用 stdio")
+	token := fs.String("token", "", "SSE 访问令牌（必填，客户端通过 Authorization: Bearer <token> 头传递）")
+	toolNames := fs.String("tools", "", "只暴露这些工具，逗号分隔，支持 * 通配符（默认全部）")
+	fs.Parse(args)
+	if *sseAddr != "" && *token == "" {
+		log.Printf("--sse 需要同时设置 --token：SSE 服务暴露 shell 和文件写入等工具，不允许无认证访问")
+		os.Exit(1)
+	}
+
+	// stdio 模式下标准输出用于协议消息，错误只能写到标准错误
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		log.Printf("无法加载配置: %v", err)
+		os.Exit(1)
+	}
+	workspace := cfg.GetWorkspacePath()
+	if err := os.MkdirAll(workspace, 0755); err != nil {
+		log.Printf("创建工作区失败: %v", err)
+		os.Exit(1)
+	}
+
+	var allowed []string
+	if *toolNames != "" {
+		allowed = strings.Split(*toolNames, ",")
+		for i := range allowed {
+			allowed[i] = strings.TrimSpace(allowed[i])
+		}
+	}
+	toolRegistry := newToolRegistry(cfg, workspace, allowed)
+	toolRegistry.Register(tools.NewTodoTool(workspace))
+	toolRegistry.Register(tools.NewSaveMemoryTool(agent.NewMemoryStore(workspace)))
+	toolRegistry.Register(tools.NewMemorySearchTool(workspace))
+
+	// 定时任务只在 mcp-serve 进程运行期间有效，触发时写入日志
+	cronService := cron.NewCronService(func(job *cron.Job) {
+		log.Printf("[Cron] %s -> %s", job.Name, job.Message)
+	})
+	toolRegistry.Register(tools.NewCronTool(cronService))
+	cronService.Start()
+	defer cronService.Stop()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	server := mcp.NewServer("nanogrip", version, toolRegistry)
+	log.Printf("[MCP] 提供 %d 个工具: %s", toolRegistry.Len(), strings.Join(toolRegistry.ToolNames(), ", "))
+	if *sseAddr != "" {
+		log.Printf("[MCP] SSE 服务已启动: http://%s/sse", *sseAddr)
+		err = mcp.ServeSSE(ctx, server, *sseAddr, *token)
+	} else {
+		err = mcp.ServeStdio(ctx, server)
+	}
+	if err != nil {
+		log.Printf("[MCP] 服务异常退出: %v", err)
+		os.Exit(1)
+	}
+}
+
+// handleReplay 用当前的提示词和工具回放记录的会话，逐回合对比新旧回复
+// 工具不会真正执行：有相同调用的记录时返回记录的结果，否则返回占位结果
+func handleReplay(configPath string, args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	model := fs.String("model", "", "回放使用的模型（默认使用配置中的模型）")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("用法: nanogrip replay [--model <模型>] <会话文件.jsonl>")
+		return
+	}
+
 	cfg, err := loadConfig(configPath)
 	if err != nil {
 		fmt.Printf("无法加载配置: %v\n", err)
 		return
 	}
-
 	workspace := cfg.GetWorkspacePath()
-	if err := os.MkdirAll(workspace, 0755); err != nil {
-		fmt.Printf("创建工作区失败: %v\n", err)
-		return
+	if *model == "" {
+		*model = cfg.Agents.Defaults.Model
 	}
-	fmt.Printf("工作区已创建: %s\n", workspace)
-}
-
-// getDefaultConfig 返回默认配置内容
-func getDefaultConfig() string {
-	return `# nanogrip 配置文件
-# 由 "nanogrip init" 生成；请填入至少一个模型提供商的 API Key。
-
-# Agent 配置
-agents:
-  defaults:
-    workspace: "~/.nanogrip/workspace"
-    # 支持格式:
-    #   - "anthropic/claude-opus-4-5"
-    #   - "openai/gpt-4.1"
-    #   - "openai/<OpenAI-compatible-model-or-endpoint-id>"
-    model: "anthropic/claude-opus-4-5"
-    maxTokens: 8192
-    temperature: 0.7
-    maxToolIterations: 20
-    memoryWindow: 50
-
-# 通信通道配置
-channels:
-  telegram:
-    enabled: false
-    token: ""
-    allowFrom: []
-    replyToMessage: false
-
-# LLM 提供商配置
-# 当前只支持 OpenAI SDK 路径和 Anthropic SDK 路径。
-providers:
-  openai:
-    apiKey: ""   # 或设置环境变量 OPENAI_API_KEY
-    apiBase: ""  # 可选；OpenAI-compatible 服务填写基础地址，不要包含 /chat/completions
-                 # 例如 Doubao Ark: "https://ark.cn-beijing.volces.com/api/v3"
-
-  anthropic:
-    apiKey: ""   # 或设置环境变量 ANTHROPIC_API_KEY
-    apiBase: ""  # 可选；通常留空
-
-# 工具配置
-tools:
-  web:
-    search:
-      apiKey: ""       # Tavily 或 Brave Search API Key
-      provider: "tavily"
-      maxResults: 5
-
-  exec:
-    timeout: 60
-
-  restrictToWorkspace: false
-
-# MCP 服务器配置
-mcpServers: {}
-`
-}
 
-// handleCron 管理定时任务
-func handleCron(configPath string) {
-	fmt.Println("定时任务管理:")
-	fmt.Println("  使用 nanogrip cron list 查看任务列表")
-	fmt.Println("  使用 nanogrip cron add <任务> 添加任务")
-	fmt.Println("  使用 nanogrip cron remove <任务ID> 删除任务")
-}
+	sessionManager := newSessionManager(cfg, configPath, workspace)
+	sess, err := sessionManager.LoadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("读取会话失败: %v\n", err)
+		return
+	}
 
-// loadConfig 加载配置文件
-func loadConfig(configPath string) (*config.Config, error) {
-	if configPath == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("获取主目录失败: %v", err)
-		}
-		configPath = filepath.Join(home, ".nanogrip", "config.yaml")
+	provider, err := createProvider(cfg, *model)
+	if err != nil {
+		fmt.Printf("配置 LLM 提供商失败: %v\n", err)
+		return
 	}
 
-	return config.Load(configPath)
-}
+	// 注册与 agent 模式相同的工具，让模型看到相同的工具定义（回放时不会真正执行）
+	toolRegistry := newToolRegistry(cfg, workspace, nil)
+	registerMessageTools(toolRegistry, workspace, make(chan string, 1))
+	toolRegistry.Register(tools.NewSpawnTool(func(task string, opts tools.SpawnOptions, originChannel, originChatID string) string { return "" }))
+	toolRegistry.Register(tools.NewCronTool(cron.NewCronService(func(job *cron.Job) {})))
 
-func createProvider(cfg *config.Config) (providers.LLMProvider, error) {
-	return providers.NewProvider(providers.ProviderOptions{
-		DefaultModel: cfg.Agents.Defaults.Model,
-		OpenAI: providers.APIConfig{
-			APIKey:  cfg.Providers.OpenAI.APIKey,
-			APIBase: cfg.Providers.OpenAI.APIBase,
-		},
-		Anthropic: providers.APIConfig{
-			APIKey:  cfg.Providers.Anthropic.APIKey,
-			APIBase: cfg.Providers.Anthropic.APIBase,
-		},
+	agentLoop := agent.NewAgentLoop(
+		provider,
+		toolRegistry,
+		bus.New(10),
+		sessionManager,
+		workspace,
+		*model,
+		cfg.Agents.Defaults.MaxTokens,
+		cfg.Agents.Defaults.Temperature,
+		cfg.Agents.Defaults.MaxToolIterations,
+		cfg.Agents.Defaults.MemoryWindow,
+	)
+	agentLoop.SetMemoryIsolation(cfg.Agents.Defaults.MemoryScope == "chat", cfg.Agents.Defaults.SharedMemory)
+	applyReasoning(agentLoop, cfg.Agents.Defaults)
+	agentLoop.SetLanguage(cfg.Agents.Defaults.Language)
+	agentLoop.SetTimezone(cfg.Agents.Defaults.Timezone)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("回放会话 %s（%d 条消息，模型 %s）\n", sess.Key, len(sess.Messages), *model)
+	changed := 0
+	turns := agentLoop.Replay(ctx, sess, func(turn agent.ReplayTurn) {
+		fmt.Printf("\n=== 回合 %d ===\n", turn.Index)
+		fmt.Printf("用户: %s\n", turn.User)
+		if len(turn.Tools) > 0 {
+			fmt.Printf("工具调用: %s\n", strings.Join(turn.Tools, ", "))
+		}
+		if turn.Err != nil {
+			fmt.Printf("回放失败: %v\n", turn.Err)
+			return
+		}
+		if !turn.Changed() {
+			fmt.Println("回复相同")
+			return
+		}
+		changed++
+		for _, line := range agent.LineDiff(turn.Recorded, turn.Replayed) {
+			fmt.Println(line)
+		}
 	})
+	fmt.Printf("\n共 %d 个回合，%d 个回合的回复有变化\n", len(turns), changed)
 }
 
 // runAgent 运行 Agent 模式
@@ -362,31 +3495,21 @@ func runAgent(configPath, message string) {
 	}
 
 	// 配置 LLM 提供商
-	provider, err := createProvider(cfg)
+	provider, err := createProvider(cfg, cfg.Agents.Defaults.Model)
 	if err != nil {
 		fmt.Printf("配置 LLM 提供商失败: %v\n", err)
 		return
 	}
 
 	// 创建工具注册表
-	toolRegistry := tools.NewToolRegistry()
-	if cfg.Tools.Web.Search.APIKey != "" {
-		toolRegistry.Register(tools.NewWebSearchTool(
-			cfg.Tools.Web.Search.APIKey,
-			cfg.Tools.Web.Search.Provider,
-			cfg.Tools.Web.Search.MaxResults,
-		))
-		log.Printf("注册网络搜索工具: %s (maxResults: %d)", cfg.Tools.Web.Search.Provider, cfg.Tools.Web.Search.MaxResults)
-	}
-	toolRegistry.Register(tools.NewShellTool(cfg.Tools.Exec.Timeout))
-	toolRegistry.Register(tools.NewFilesystemTool(workspace, cfg.Tools.RestrictToWorkspace))
+	toolRegistry := newToolRegistry(cfg, workspace, nil)
 
 	// 创建会话管理器
-	sessionManager := session.NewSessionManager(workspace)
+	sessionManager := newSessionManager(cfg, configPath, workspace)
 
 	// 创建消息通道
 	messageChan := make(chan string, 100)
-	toolRegistry.Register(tools.NewMessageTool(messageChan))
+	registerMessageTools(toolRegistry, workspace, messageChan)
 
 	// 【关键修复】创建共享的消息总线，用于 AgentLoop 和子代理通信
 	msgBus := bus.New(10)
@@ -413,11 +3536,15 @@ func runAgent(configPath, message string) {
 		builtinSkills,
 	)
 
+	applySubagentLimits(subagentManager, cfg.Agents.Defaults)
+
 	// 注册子代理生成工具
-	spawnTool := tools.NewSpawnTool(func(task string, label string, originChannel string, originChatID string) string {
-		return subagentManager.Spawn(task, label, originChannel, originChatID)
+	spawnTool := tools.NewSpawnTool(func(task string, opts tools.SpawnOptions, originChannel string, originChatID string) string {
+		return subagentManager.Spawn(task, opts, originChannel, originChatID)
 	})
 	toolRegistry.Register(spawnTool)
+	toolRegistry.Register(tools.NewSubagentsTool(subagentManager))
+	toolRegistry.Register(tools.NewTaskResultTool(subagentManager))
 
 	// 注册定时任务工具（Cron）
 	cronService := cron.NewCronService(func(job *cron.Job) {
@@ -438,18 +3565,7 @@ func runAgent(configPath, message string) {
 	mcpManager := mcp.NewMCPManager()
 	if len(cfg.MCPServers) > 0 {
 		log.Printf("启动 %d 个 MCP 服务器...", len(cfg.MCPServers))
-		// 转换配置格式
-		mcpConfigs := make(map[string]mcp.MCPConfig)
-		for name, serverConfig := range cfg.MCPServers {
-			mcpConfigs[name] = mcp.MCPConfig{
-				Command: serverConfig.Command,
-				Args:    serverConfig.Args,
-				Env:     serverConfig.Env,
-				URL:     serverConfig.URL,
-				Headers: serverConfig.Headers,
-			}
-		}
-		if err := mcpManager.StartAll(mcpConfigs); err != nil {
+		if err := mcpManager.StartAll(mcpConfigs(cfg)); err != nil {
 			log.Printf("MCP 启动部分失败: %v", err)
 		}
 		// 注册 MCP 工具
@@ -474,6 +3590,18 @@ func runAgent(configPath, message string) {
 	)
 
 	agentLoop.SetMessageChan(messageChan)
+	agentLoop.SetSubagentManager(subagentManager)
+	agentLoop.SetSessionIdleTimeout(time.Duration(cfg.Agents.Defaults.SessionIdleMinutes) * time.Minute)
+	agentLoop.SetMemoryIsolation(cfg.Agents.Defaults.MemoryScope == "chat", cfg.Agents.Defaults.SharedMemory)
+	applyReasoning(agentLoop, cfg.Agents.Defaults)
+	agentLoop.SetLanguage(cfg.Agents.Defaults.Language)
+	agentLoop.SetTimezone(cfg.Agents.Defaults.Timezone)
+	applyConsolidation(agentLoop, cfg)
+	applyRouting(agentLoop, cfg)
+	agentLoop.SetMaxConcurrentSessions(cfg.Agents.Defaults.MaxConcurrentSessions)
+	enableTodoReminders(agentLoop, cronService)
+	agentLoop.SetBudget(budgetTracker(cfg))
+	agentLoop.SetToolScopes(toolScopes(cfg))
 
 	// 【关键修复】启动 AgentLoop 后台 goroutine 来处理子代理结果
 	ctx, cancel := context.WithCancel(context.Background())
@@ -487,25 +3615,50 @@ func runAgent(configPath, message string) {
 		return
 	}
 	defer agentLoop.Stop()
+	watchWorkspace(ctx, agentLoop)
+
+	// 子代理结果等后台消息发往 "cli" 频道，直接打印到终端
+	go printCLIOutbound(ctx, msgBus.SubscribeOutbound("cli", 0))
+
+	// /mcp reload 命令：重新获取 MCP 工具列表
+	refresher := &mcpRefresher{manager: mcpManager, registries: []*tools.ToolRegistry{toolRegistry}}
+	refresher.register(agentLoop)
+	registerAuditCommand(cfg, workspace, agentLoop)
 
 	// 根据是否有消息决定运行模式
 	if message != "" {
 		// 单消息模式
-		runSingleMessageMode(agentLoop, message)
+		runSingleMessageMode(agentLoop, message, cfg.Agents.Defaults.Reasoning.ShowInCLI)
 	} else {
 		// 交互式模式
-		runInteractiveMode(agentLoop)
+		runInteractiveMode(agentLoop, cfg.Agents.Defaults.Reasoning.ShowInCLI)
+	}
+}
+
+// printCLIOutbound 打印发往 "cli" 频道的出站消息，直到 ctx 被取消
+func printCLIOutbound(ctx context.Context, queue <-chan bus.OutboundMessage) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-queue:
+			fmt.Printf("\n📨 %s\n", msg.Content)
+		}
 	}
 }
 
 // runSingleMessageMode 运行单消息模式
 // 直接处理一条消息并输出结果，然后退出
-func runSingleMessageMode(agentLoop *agent.AgentLoop, message string) {
+// showThinking 为 true 时以折叠形式显示模型的思考过程
+func runSingleMessageMode(agentLoop *agent.AgentLoop, message string, showThinking bool) {
 	ctx := context.Background()
 
 	fmt.Printf(">>> %s\n", message)
 
 	printer := newCLIStreamPrinter()
+	if showThinking {
+		ctx = agent.WithReasoningHandler(ctx, printer.Thinking)
+	}
 	response, err := agentLoop.ProcessDirectStream(ctx, message, printer.Print)
 	if err != nil {
 		printer.Finish("")
@@ -518,7 +3671,8 @@ func runSingleMessageMode(agentLoop *agent.AgentLoop, message string) {
 
 // runInteractiveMode 运行交互式命令行界面
 // 提供一个循环读取用户输入并处理的多行对话界面
-func runInteractiveMode(agentLoop *agent.AgentLoop) {
+// showThinking 为 true 时以折叠形式显示模型的思考过程
+func runInteractiveMode(agentLoop *agent.AgentLoop, showThinking bool) {
 	ctx := context.Background()
 
 	fmt.Println("🐈 nanogrip 交互式对话模式")
@@ -589,7 +3743,11 @@ func runInteractiveMode(agentLoop *agent.AgentLoop) {
 
 			// 处理消息
 			printer := newCLIStreamPrinter()
-			response, err := agentLoop.ProcessDirectStream(ctx, input, printer.Print)
+			turnCtx := ctx
+			if showThinking {
+				turnCtx = agent.WithReasoningHandler(ctx, printer.Thinking)
+			}
+			response, err := agentLoop.ProcessDirectStream(turnCtx, input, printer.Print)
 			if err != nil {
 				printer.Finish("")
 				fmt.Printf("错误: %v\n", err)
@@ -635,6 +3793,25 @@ func (p *cliStreamPrinter) Finish(fallback string) {
 	}
 }
 
+// cliThinkingPreview 折叠显示思考过程时保留的字符数
+const cliThinkingPreview = 120
+
+// Thinking 以折叠形式（一行灰色摘要）显示模型的思考过程
+func (p *cliStreamPrinter) Thinking(reasoning string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	runes := []rune(strings.Join(strings.Fields(reasoning), " "))
+	preview := string(runes)
+	if len(runes) > cliThinkingPreview {
+		preview = string(runes[:cliThinkingPreview]) + "…"
+	}
+	if p.wrote {
+		fmt.Println()
+	}
+	fmt.Printf("\n\033[2m💭 思考 (%d 字): %s\033[0m\n", len(runes), preview)
+}
+
 func (p *cliStreamPrinter) ensureStarted() {
 	if p.wrote {
 		return
@@ -655,6 +3832,7 @@ func printInteractiveHelp() {
 	fmt.Println("可用命令:")
 	fmt.Println("  /help    - 显示此帮助信息")
 	fmt.Println("  /new     - 开始新会话")
+	fmt.Println("  /status  - 查看运行状态和内存占用")
 	fmt.Println("  /exit    - 退出程序")
 	fmt.Println("  Ctrl+C   - 强制退出程序")
 	fmt.Println("")
@@ -678,10 +3856,28 @@ func runGateway(configPath string) {
 		log.Fatalf("创建工作区失败: %v", err)
 	}
 
+	// 记录进程 ID（nanogrip daemon stop/status 使用），同一工作区只能运行一个实例
+	pidPath := lifecycle.PidFilePath(workspace)
+	if err := lifecycle.WritePidFile(pidPath); err != nil {
+		log.Fatalf("写入进程 ID 文件失败: %v", err)
+	}
+	defer lifecycle.RemovePidFile(pidPath)
+	startedAt := time.Now()
+
 	// ============================================
 	// 第3步：创建消息总线
 	// ============================================
 	msgBus := bus.New(100)
+	if cfg.Gateway.PersistentQueue {
+		// 恢复上次崩溃或重启前尚未处理的消息（在智能体启动后按原顺序处理）
+		restored, err := msgBus.EnablePersistence(filepath.Join(workspace, "queue.jsonl"), sessionCipher(cfg, configPath))
+		if err != nil {
+			log.Fatalf("启用持久化入站队列失败: %v", err)
+		}
+		if restored > 0 {
+			log.Printf("持久化入站队列: 恢复了 %d 条未处理的消息", restored)
+		}
+	}
 
 	// 用于跟踪所有后台 goroutine
 	var wg sync.WaitGroup
@@ -689,7 +3885,7 @@ func runGateway(configPath string) {
 	// ============================================
 	// 第4步：配置 LLM 提供商
 	// ============================================
-	provider, err := createProvider(cfg)
+	provider, err := createProvider(cfg, cfg.Agents.Defaults.Model)
 	if err != nil {
 		log.Fatalf("配置 LLM 提供商失败: %v", err)
 	}
@@ -697,42 +3893,21 @@ func runGateway(configPath string) {
 	// ============================================
 	// 第5步：创建工具注册表
 	// ============================================
-	toolRegistry := tools.NewToolRegistry()
-
-	if cfg.Tools.Web.Search.APIKey != "" {
-		toolRegistry.Register(tools.NewWebSearchTool(
-			cfg.Tools.Web.Search.APIKey,
-			cfg.Tools.Web.Search.Provider,
-			cfg.Tools.Web.Search.MaxResults,
-		))
-		log.Printf("注册网络搜索工具: %s (maxResults: %d)", cfg.Tools.Web.Search.Provider, cfg.Tools.Web.Search.MaxResults)
-	} else {
-		log.Println("警告: 未配置网络搜索 API Key，请在配置文件中设置 tools.web.search.apiKey 以启用搜索功能")
-	}
-
-	toolRegistry.Register(tools.NewShellTool(cfg.Tools.Exec.Timeout))
-	toolRegistry.Register(tools.NewFilesystemTool(workspace, cfg.Tools.RestrictToWorkspace))
+	toolRegistry := newToolRegistry(cfg, workspace, nil)
 
 	// ============================================
 	// 第6步：创建会话管理器
 	// ============================================
-	sessionManager := session.NewSessionManager(workspace)
+	sessionManager := newSessionManager(cfg, configPath, workspace)
 
 	// ============================================
 	// 第7步：创建消息工具
 	// ============================================
 	messageChan := make(chan string, 100)
-	toolRegistry.Register(tools.NewMessageTool(messageChan))
+	registerMessageTools(toolRegistry, workspace, messageChan)
 
 	// 获取内置技能路径（与 AgentLoop 相同的逻辑）
-	var builtinSkills string
-	builtinSkills = filepath.Join(workspace, "..", "skills")
-	if _, err := os.Stat(builtinSkills); os.IsNotExist(err) {
-		builtinSkills = "/workspace/nanogrip/skills"
-		if _, err := os.Stat(builtinSkills); os.IsNotExist(err) {
-			builtinSkills = "skills"
-		}
-	}
+	builtinSkills := builtinSkillsPath(workspace)
 	log.Printf("[Gateway] Loading built-in skills from: %s", builtinSkills)
 
 	// 创建子代理管理器
@@ -748,11 +3923,15 @@ func runGateway(configPath string) {
 		builtinSkills,
 	)
 
+	applySubagentLimits(subagentManager, cfg.Agents.Defaults)
+
 	// 注册子代理生成工具
-	spawnTool := tools.NewSpawnTool(func(task string, label string, originChannel string, originChatID string) string {
-		return subagentManager.Spawn(task, label, originChannel, originChatID)
+	spawnTool := tools.NewSpawnTool(func(task string, opts tools.SpawnOptions, originChannel string, originChatID string) string {
+		return subagentManager.Spawn(task, opts, originChannel, originChatID)
 	})
 	toolRegistry.Register(spawnTool)
+	toolRegistry.Register(tools.NewSubagentsTool(subagentManager))
+	toolRegistry.Register(tools.NewTaskResultTool(subagentManager))
 
 	// 注册定时任务工具（Cron）
 	// 【方案4实现】支持 Agent 模式：可以触发 AI 执行复杂任务
@@ -782,18 +3961,7 @@ func runGateway(configPath string) {
 	mcpManager := mcp.NewMCPManager()
 	if len(cfg.MCPServers) > 0 {
 		log.Printf("启动 %d 个 MCP 服务器...", len(cfg.MCPServers))
-		// 转换配置格式
-		mcpConfigs := make(map[string]mcp.MCPConfig)
-		for name, serverConfig := range cfg.MCPServers {
-			mcpConfigs[name] = mcp.MCPConfig{
-				Command: serverConfig.Command,
-				Args:    serverConfig.Args,
-				Env:     serverConfig.Env,
-				URL:     serverConfig.URL,
-				Headers: serverConfig.Headers,
-			}
-		}
-		if err := mcpManager.StartAll(mcpConfigs); err != nil {
+		if err := mcpManager.StartAll(mcpConfigs(cfg)); err != nil {
 			log.Printf("MCP 启动部分失败: %v", err)
 		}
 		// 注册 MCP 工具
@@ -820,40 +3988,242 @@ func runGateway(configPath string) {
 	)
 
 	agentLoop.SetMessageChan(messageChan)
+	agentLoop.SetSubagentManager(subagentManager)
+	agentLoop.SetSessionIdleTimeout(time.Duration(cfg.Agents.Defaults.SessionIdleMinutes) * time.Minute)
+	agentLoop.SetMemoryIsolation(cfg.Agents.Defaults.MemoryScope == "chat", cfg.Agents.Defaults.SharedMemory)
+	applyReasoning(agentLoop, cfg.Agents.Defaults)
+	agentLoop.SetLanguage(cfg.Agents.Defaults.Language)
+	agentLoop.SetTimezone(cfg.Agents.Defaults.Timezone)
+	applyConsolidation(agentLoop, cfg)
+	applyRouting(agentLoop, cfg)
+	agentLoop.SetMaxConcurrentSessions(cfg.Agents.Defaults.MaxConcurrentSessions)
+	agentLoop.SetSessionRetention(time.Duration(cfg.Sessions.MaxAge)*24*time.Hour, cfg.Sessions.MaxCount)
+	agentLoop.SetSessionTitles(!cfg.Sessions.DisableTitles)
+	agentLoop.SetToolScopes(toolScopes(cfg))
+	enableTodoReminders(agentLoop, cronService)
+	applyChannelFeedback(agentLoop, cfg)
+
+	approvals := tools.NewApprovalManager(msgBus, time.Duration(cfg.Tools.ApprovalTimeout)*time.Second)
+	inputs := tools.NewInteractionManager(msgBus, time.Duration(cfg.Tools.Exec.InputTimeout)*time.Second)
+
+	// 多 Agent：agents.instances 中的每个 Agent 有自己的工作区、模型和工具
+	// 入站消息由 Router 按频道、聊天 ID 或 /agent 命令分发
+	var router *agent.Router
+	var instances []*agent.AgentLoop
+	if len(cfg.Agents.Instances) > 0 {
+		router = agent.NewRouter(msgBus, agentLoop, filepath.Join(workspace, "agents.json"))
+		deps := agentDeps{
+			configPath:  configPath,
+			msgBus:      msgBus,
+			cronService: cronService,
+			mcpManager:  mcpManager,
+			approvals:   approvals,
+			inputs:      inputs,
+			messageChan: messageChan,
+		}
+		for _, inst := range cfg.Agents.Instances {
+			loop, err := newAgentInstance(cfg, inst, deps)
+			if err != nil {
+				log.Fatalf("创建 Agent %s 失败: %v", inst.Name, err)
+			}
+			if err := router.Add(inst.Name, loop, agent.Route{Channels: inst.Channels, ChatIDs: inst.ChatIDs}); err != nil {
+				log.Fatalf("创建 Agent %s 失败: %v", inst.Name, err)
+			}
+			instances = append(instances, loop)
+			log.Printf("已创建 Agent %s (模型 %s, 工作区 %s)", inst.Name, inst.Model, cfg.InstanceWorkspacePath(inst))
+		}
+	}
 
 	// 【方案4】设置 Cron 服务的 Agent 执行器
-	// 这样定时任务就可以触发 AI 执行复杂操作
-	cronService.SetAgentExecutor(agentLoop)
+	// 这样定时任务就可以触发 AI 执行复杂操作（多 Agent 时由负责该聊天的 Agent 执行）
+	if router != nil {
+		cronService.SetAgentExecutor(router)
+	} else {
+		cronService.SetAgentExecutor(agentLoop)
+	}
 	cronService.SetMessageBus(msgBus)
+	cronService.SetDefaultPermissions(defaultCronPermissions(cfg))
+	applyCronHistory(cronService, cfg)
+	registerDigestJob(cronService, agentLoop)
+	registerTemplateJob(cronService, workspace)
+	registerBackupJob(cronService, configPath)
 	log.Println("Cron 服务已配置 Agent 执行器")
 
 	// 【关键修复】启动定时任务服务
 	cronService.Start()
 	log.Println("定时任务服务已启动")
+	if added, _ := cronService.SyncConfigJobs(configCronJobs(cfg, agentLoop.TimezoneFor)); added > 0 {
+		log.Printf("已加载配置中的 %d 个定时任务", added)
+	}
 
 	// ============================================
 	// 第9步：创建通道管理器
 	// ============================================
 	channelManager := channels.NewManager(msgBus, cfg)
 
+	// 处理消息期间通过支持的通道显示"正在输入…"和表情回应
+	agentLoop.SetTypingFunc(channelManager.SendTyping)
+	agentLoop.SetReactFunc(channelManager.React)
+	for _, loop := range instances {
+		loop.SetTypingFunc(channelManager.SendTyping)
+		loop.SetReactFunc(channelManager.React)
+	}
+
+	// 限流和每日额度（所有 Agent 共享，同一发送者的用量合并计算）
+	limiter := newRateLimiter(cfg, workspace)
+	agentLoop.SetRateLimiter(limiter)
+	agentLoop.SetBudget(budgetTracker(cfg))
+	agentLoop.SetAdmins(cfg.Admins)
+	for _, loop := range instances {
+		loop.SetRateLimiter(limiter)
+		loop.SetBudget(budgetTracker(cfg))
+		loop.SetAdmins(cfg.Admins)
+	}
+
+	// 需要确认的工具调用通过聊天向用户发送审批提示，等待输入的命令通过聊天询问用户
+	// 用户的答复在频道层被拦截（AgentLoop 此时正阻塞在工具调用上）
+	toolRegistry.SetApprover(approvals)
+	toolRegistry.SetInteractor(inputs)
+	channelManager.SetInputHandler(tools.InputHandlers(approvals.HandleInput, inputs.HandleInput))
+
 	// ============================================
 	// 第10步：启动所有组件
 	// ============================================
 	ctx, cancel := context.WithCancel(context.Background())
 
+	// 导出请求追踪（OpenTelemetry span）
+	if cfg.Tracing.Endpoint != "" {
+		exporter := trace.NewExporter(cfg.Tracing.Endpoint, cfg.Tracing.ServiceName, cfg.Tracing.Headers)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			exporter.Run(ctx)
+		}()
+		log.Printf("请求追踪导出已启用: %s", cfg.Tracing.Endpoint)
+	}
+
+	// 出站消息归档（记录每条实际投递的消息）
+	var archive *outbox.Archive
+	if cfg.Outbox.Enabled {
+		archive = outbox.NewArchive(filepath.Join(workspace, "outbox"), cfg.Outbox.StoreContent)
+		archive.SetCipher(sessionCipher(cfg, configPath))
+	}
+
+	// 创建出站分发器（启动见下文），免打扰时段随配置热更新
+	// 在 Agent 开始处理消息之前为启用的频道订阅出站消息，之前发布的回复在队列中等待发送
+	dispatcher := newDispatcher(cfg, channelManager, archive, workspace)
+	dispatcher.SetQuietHours(quietHours(cfg))
+	dispatcher.Subscribe(msgBus)
+
 	if err := agentLoop.Start(ctx); err != nil {
 		log.Fatalf("启动 Agent 失败: %v", err)
 	}
+	watchWorkspace(ctx, agentLoop)
+	for _, loop := range instances {
+		if err := loop.Start(ctx); err != nil {
+			log.Fatalf("启动 Agent 失败: %v", err)
+		}
+		watchWorkspace(ctx, loop)
+	}
+	if router != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			router.Run(ctx)
+		}()
+	}
 
 	if err := channelManager.StartAll(ctx); err != nil {
 		log.Printf("Warning: 部分通道启动失败: %v", err)
 	}
 
-	// 启动 processOutbound goroutine 并注册到 WaitGroup
+	// 让 Agent 了解各频道的能力（消息长度、媒体类型、格式）
+	for name, caps := range channelManager.Capabilities() {
+		agentLoop.SetChannelCapabilities(name, caps.Describe())
+		for _, loop := range instances {
+			loop.SetChannelCapabilities(name, caps.Describe())
+		}
+	}
+
+	// 启动 Gateway HTTP 服务（日历订阅、Discord 斜杠命令、飞书事件等）
+	httpServer := startHTTPServer(cfg, cronService, channelManager)
+
+	// 启动本机管理接口（nanogrip cron list/add/remove/history 通过它管理任务）
+	adminServer := startAdminServer(workspace, cronService, func() gatewayStatus {
+		model, _, _ := agentLoop.ModelSettings()
+		status := gatewayStatus{
+			PID:       os.Getpid(),
+			Version:   version,
+			StartedAt: startedAt,
+			Workspace: workspace,
+			Model:     model,
+			Channels:  channelManager.ListChannels(),
+			CronJobs:  len(cronService.ListJobs()),
+			Inbound:   msgBus.InboundSize(),
+			Outbound:  msgBus.OutboundSize(),
+
+			InboundLow: msgBus.InboundSizeOf(bus.PriorityLow),
+		}
+		if router != nil {
+			status.Agents = router.Names()
+		}
+		return status
+	})
+
+	// MCP 工具刷新：/mcp reload 命令和 mcpRefreshInterval 定时刷新，变化同步到所有 Agent 的工具注册表
+	refresher := &mcpRefresher{manager: mcpManager, registries: []*tools.ToolRegistry{toolRegistry}}
+	for _, loop := range instances {
+		refresher.registries = append(refresher.registries, loop.Tools())
+	}
+	refresher.register(append([]*agent.AgentLoop{agentLoop}, instances...)...)
+	registerAuditCommand(cfg, workspace, append([]*agent.AgentLoop{agentLoop}, instances...)...)
+	registerChannelsCommand(channelManager, dispatcher, append([]*agent.AgentLoop{agentLoop}, instances...)...)
+	if cfg.MCPRefreshInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			refresher.run(ctx, time.Duration(cfg.MCPRefreshInterval)*time.Second)
+		}()
+	}
+
+	// 配置热重载：配置文件变化或收到 SIGHUP 时应用可以热更新的设置
+	if resolvedPath, err := resolveConfigPath(configPath); err == nil {
+		reloader := &configReloader{
+			path:           resolvedPath,
+			channels:       channelManager,
+			agentLoop:      agentLoop,
+			instances:      instances,
+			subagents:      subagentManager,
+			cronService:    cronService,
+			mcpManager:     mcpManager,
+			mcpRefresher:   refresher,
+			dispatcher:     dispatcher,
+			msgBus:         msgBus,
+			reloadInterval: time.Duration(cfg.ReloadInterval) * time.Second,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reloader.run(ctx)
+		}()
+	}
+
+	// 记录本次启动，并按配置通知主人（启动摘要、崩溃循环告警）
+	tracker := lifecycle.NewTracker(workspace)
+	notifyStartup(cfg, tracker, channelManager, cronService, archive, workspace)
+
+	// 启动检查：在后台校验模型提供商、频道凭据和网络搜索，失败时记录修复建议
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runStartupCheck(ctx, cfg, workspace)
+	}()
+
+	// 启动出站分发器：每个频道独立的订阅队列和发送 goroutine，失败重试，最终失败写入死信
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		processOutbound(ctx, msgBus, channelManager)
+		dispatcher.Run(ctx, msgBus)
 	}()
 
 	// 启动消息工具输出桥接器
@@ -861,61 +4231,29 @@ func runGateway(configPath string) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case msgJSON := <-messageChan:
-				// 解析 JSON 消息
-				var msgData map[string]interface{}
-				if err := json.Unmarshal([]byte(msgJSON), &msgData); err != nil {
-					log.Printf("Failed to parse message JSON: %v", err)
-					continue
-				}
-
-				// 提取字段
-				content, _ := msgData["content"].(string)
-				channel, _ := msgData["channel"].(string)
-				chatID, _ := msgData["chat_id"].(string)
-				media, _ := msgData["media"].(string)
-				mediaType, _ := msgData["media_type"].(string)
-
-				// 如果没有指定 channel，使用当前上下文
-				if channel == "" {
-					channel = "telegram"
-				}
-
-				// 构建媒体列表
-				mediaList := []string{}
-				if media != "" {
-					mediaList = strings.Split(media, ",")
-				}
-
-				// 发布到消息总线
-				outboundMsg := bus.OutboundMessage{
-					Channel: channel,
-					ChatID:  chatID,
-					Content: content,
-					Media:   mediaList,
-					Metadata: map[string]interface{}{
-						"media_type": mediaType,
-					},
-				}
-				msgBus.PublishOutbound(outboundMsg)
-			}
-		}
+		runMessageBridge(ctx, messageChan, msgBus)
 	}()
 
 	// ============================================
 	// 第11步：运行 CLI
 	// ============================================
 	fmt.Println("🐈 nanogrip is running. Type /help for commands, /exit to quit.")
+	// 由 systemd 以 Type=notify 启动时通知启动完成
+	if _, err := lifecycle.NotifySystemd("READY=1"); err != nil {
+		log.Printf("发送 systemd 就绪通知失败: %v", err)
+	}
 	runCLI(ctx, agentLoop, msgBus)
 
 	// ============================================
 	// 第12步：清理和关闭
 	// ============================================
 	log.Println("正在关闭...")
+	lifecycle.NotifySystemd("STOPPING=1")
+
+	// 告别消息需要在关闭通道之前直接发送
+	if cfg.Notify.Shutdown {
+		notifyOwner(cfg.Notify, channelManager, archive, lifecycle.ShutdownMessage(version, tracker.Uptime()))
+	}
 
 	// 1. 停止所有子代理
 	subagentManager.StopAll()
@@ -923,13 +4261,30 @@ func runGateway(configPath string) {
 	// 2. 取消上下文，通知所有 goroutine 退出
 	cancel()
 
-	// 3. 停止所有通信通道
+	// 3. 停止所有通信通道和 HTTP 服务
 	channelManager.StopAll()
+	if httpServer != nil {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := httpServer.Stop(shutdownCtx); err != nil {
+			log.Printf("关闭 HTTP 服务失败: %v", err)
+		}
+		shutdownCancel()
+	}
+	if adminServer != nil {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := adminServer.Stop(shutdownCtx); err != nil {
+			log.Printf("关闭管理接口失败: %v", err)
+		}
+		shutdownCancel()
+	}
 
 	// 4. 停止 Agent 循环
 	agentLoop.Stop()
+	for _, loop := range instances {
+		loop.Stop()
+	}
 
-	// 5. 等待所有 goroutine 完成（processOutbound, messageToolBridge）
+	// 5. 等待所有 goroutine 完成（出站分发器, messageToolBridge）
 	log.Println("等待所有 goroutine 完成...")
 	done := make(chan struct{})
 	go func() {
@@ -953,40 +4308,150 @@ func runGateway(configPath string) {
 	// 8. 最后关闭消息总线
 	msgBus.Close()
 
+	if err := tracker.Stop(); err != nil {
+		log.Printf("写入运行记录失败: %v", err)
+	}
+
 	log.Println("nanogrip 已安全关闭")
 }
 
-// processOutbound 处理出站消息
-func processOutbound(ctx context.Context, msgBus *bus.MessageBus, channelManager *channels.Manager) {
+// notifyStartup 记录启动并发送启动通知
+// 上一次运行异常退出的提示包含在启动通知中；崩溃循环告警独立于 startup 开关发送
+func notifyStartup(cfg *config.Config, tracker *lifecycle.Tracker, channelManager *channels.Manager, cronService *cron.CronService, archive *outbox.Archive, workspace string) {
+	report, err := tracker.Start(version)
+	if err != nil {
+		log.Printf("写入运行记录失败: %v", err)
+	}
+	if report.UncleanExit {
+		log.Printf("⚠ 上一次运行（%s 启动）没有正常退出", report.PreviousStart.Format("2006-01-02 15:04:05"))
+	}
+
+	threshold := cfg.Notify.CrashLoopThreshold
+	if threshold > 0 && report.RestartsLastHour > threshold {
+		log.Printf("⚠ 最近一小时内已启动 %d 次，可能处于崩溃循环", report.RestartsLastHour)
+		notifyOwner(cfg.Notify, channelManager, archive, lifecycle.CrashLoopMessage(report))
+	}
+
+	if !cfg.Notify.Startup {
+		return
+	}
+
+	summary := lifecycle.Summary{
+		Version:  version,
+		Channels: channelManager.ListChannels(),
+	}
+	for _, job := range cronService.ListJobs() {
+		summary.CronJobs++
+		if summary.NextJob == "" || job.NextRun.Before(summary.NextRun) {
+			summary.NextJob = job.Name
+			summary.NextRun = job.NextRun
+		}
+	}
+	projects, open, err := tools.NewTodoTool(workspace).Backlog()
+	if err != nil {
+		log.Printf("读取待办摘要失败: %v", err)
+	}
+	summary.TodoProjects = projects
+	summary.OpenTodos = open
+
+	notifyOwner(cfg.Notify, channelManager, archive, lifecycle.StartupMessage(report, summary))
+}
+
+// notifyOwner 直接通过频道给主人发送通知（不经过消息总线，保证退出时也能送达）
+func notifyOwner(notify config.NotifyConfig, channelManager *channels.Manager, archive *outbox.Archive, content string) {
+	if notify.ChatID == "" {
+		return
+	}
+	channel := channelManager.GetChannel(notify.Channel)
+	if channel == nil {
+		log.Printf("⚠ 主人通知发送失败：找不到通道 '%s'", notify.Channel)
+		return
+	}
+
+	msg := bus.OutboundMessage{
+		Channel: notify.Channel,
+		ChatID:  notify.ChatID,
+		Content: content,
+	}
+	for _, adapted := range channels.Adapt(msg, channels.CapabilitiesOf(channel)) {
+		sendErr := channel.Send(adapted)
+		if sendErr != nil {
+			log.Printf("⚠ 主人通知发送失败: %v", sendErr)
+		}
+		if err := archive.Record(adapted, sendErr); err != nil {
+			log.Printf("⚠ 写入出站归档失败: %v", err)
+		}
+		if sendErr != nil {
+			return
+		}
+	}
+}
+
+// runMessageBridge 把消息工具发出的消息发布到消息总线，直到 ctx 取消
+// 发送目标由消息工具根据当前会话确定；格式转换和按长度拆分由出站分发器按目标频道的能力完成
+func runMessageBridge(ctx context.Context, messageChan <-chan string, msgBus *bus.MessageBus) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		default:
-			msg, err := msgBus.ConsumeOutbound(ctx)
-			if err != nil {
-				if ctx.Err() != nil {
-					return
-				}
+		case msgJSON := <-messageChan:
+			var msg tools.OutgoingMessage
+			if err := json.Unmarshal([]byte(msgJSON), &msg); err != nil {
+				log.Printf("Failed to parse message JSON: %v", err)
 				continue
 			}
-
-			log.Printf("[processOutbound] 收到消息: Channel=%s, ChatID=%s, Content=%.50s",
-				msg.Channel, msg.ChatID, msg.Content)
-
-			channel := channelManager.GetChannel(msg.Channel)
-			if channel == nil {
-				log.Printf("[processOutbound] ⚠ 警告：找不到通道 '%s'，消息丢弃", msg.Channel)
+			if msg.Channel == "" || msg.ChatID == "" {
+				log.Printf("[Message] 丢弃没有发送目标的消息: channel=%q chat_id=%q", msg.Channel, msg.ChatID)
 				continue
 			}
+			msgBus.PublishOutbound(msg.Outbound())
+		}
+	}
+}
 
-			if err := channel.Send(msg); err != nil {
-				log.Printf("[processOutbound] ❌ 发送消息失败: %v", err)
-			} else {
-				log.Printf("[processOutbound] ✓ 消息已发送到 %s (%s)", msg.Channel, msg.ChatID)
+// newDispatcher 创建出站分发器
+// 每条投递结果（含发送次数）都会写入出站消息归档（archive 为 nil 时不归档），
+// 最终无法投递的消息写入 workspace/outbox-failed.jsonl，可用 "nanogrip outbox resend" 补发
+func newDispatcher(cfg *config.Config, channelManager *channels.Manager, archive *outbox.Archive, workspace string) *channels.Dispatcher {
+	outbound := cfg.Channels.Outbound
+	failed := outbox.NewFailedLog(filepath.Join(workspace, outbox.FailedFileName))
+	return channels.NewDispatcher(channelManager, channels.DispatcherOptions{
+		QueueSize:   outbound.QueueSize,
+		MaxAttempts: outbound.MaxAttempts,
+		RetryDelay:  time.Duration(outbound.RetryDelay) * time.Second,
+		OnResult: func(msg bus.OutboundMessage, attempts int, err error) {
+			if recordErr := archive.RecordDelivery(msg, attempts, err); recordErr != nil {
+				log.Printf("[Outbound] ⚠ 写入出站归档失败: %v", recordErr)
+			}
+		},
+		OnDeadLetter: func(msg bus.OutboundMessage, attempts int, err error) {
+			if appendErr := failed.Append(msg, attempts, err); appendErr != nil {
+				log.Printf("[Outbound] ⚠ 写入 %s 失败: %v", failed.Path(), appendErr)
 			}
+		},
+	})
+}
+
+// quietHours 返回各频道的免打扰时段（未启用或时间格式有误的频道不包括在内）
+func quietHours(cfg *config.Config) map[string]channels.QuietHours {
+	configs := map[string]config.QuietHoursConfig{
+		"telegram": cfg.Channels.Telegram.QuietHours,
+		"discord":  cfg.Channels.Discord.QuietHours,
+		"feishu":   cfg.Channels.Feishu.QuietHours,
+	}
+	result := make(map[string]channels.QuietHours)
+	for name, quiet := range configs {
+		if !quiet.Enabled {
+			continue
+		}
+		hours, err := channels.ParseQuietHours(quiet.Start, quiet.End)
+		if err != nil {
+			log.Printf("⚠ %s 的免打扰时段配置有误，已忽略: %v", name, err)
+			continue
 		}
+		result[name] = hours
 	}
+	return result
 }
 
 // runCLI 运行命令行界面
@@ -0,0 +1,164 @@
+package agent
+
+// ack.go - 两段式响应（快速确认 + 完整回复）
+//
+// 需要调用多个工具的回合往往要几十秒才能给出最终回复，
+// 这期间用户不知道机器人是否收到了消息。启用快速确认后：
+// 1. 模型第一次请求调用工具时，准备一条简短的确认消息
+// 2. 确认消息立即（或在 Delay 之后仍未完成时）发送给用户
+// 3. 最终回复照常发送；如果回合在 Delay 内结束，则不会发送确认
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/providers"
+)
+
+// AckOptions 描述某个通道的快速确认行为
+type AckOptions struct {
+	Enabled      bool          // 是否启用
+	Delay        time.Duration // 收到消息后超过该时间仍未完成才发送确认（0 表示立即）
+	Message      string        // 确认消息模板，{tools} 会被替换为工具名称
+	UseModelText bool          // 优先使用模型在调用工具前输出的文字
+}
+
+// turnAck 跟踪单个回合的快速确认状态
+// 每个回合最多发送一次确认
+type turnAck struct {
+	opts      AckOptions
+	bus       *bus.MessageBus
+	msg       bus.InboundMessage
+	startedAt time.Time
+
+	mu    sync.Mutex
+	armed bool        // 是否已准备发送确认
+	done  bool        // 回合是否已结束（结束后不再发送）
+	timer *time.Timer // 延迟发送的定时器
+}
+
+type turnAckKey struct{}
+
+// SetAckOptions 设置某个通道的快速确认行为
+// 参数:
+//
+//	channel: 通道名称（如 "telegram"）
+//	opts: 快速确认选项
+func (a *AgentLoop) SetAckOptions(channel string, opts AckOptions) {
+	a.ackMu.Lock()
+	defer a.ackMu.Unlock()
+	if a.ackOptions == nil {
+		a.ackOptions = make(map[string]AckOptions)
+	}
+	a.ackOptions[channel] = opts
+}
+
+// beginAck 为一条入站消息开始跟踪快速确认
+// 如果该通道未启用快速确认，返回原 ctx 和 nil
+func (a *AgentLoop) beginAck(ctx context.Context, msg bus.InboundMessage) (context.Context, *turnAck) {
+	a.ackMu.RLock()
+	opts, ok := a.ackOptions[msg.Channel]
+	a.ackMu.RUnlock()
+	if !ok || !opts.Enabled || msg.Channel == "system" || strings.HasPrefix(msg.Content, "/") {
+		return ctx, nil
+	}
+
+	ack := &turnAck{
+		opts:      opts,
+		bus:       a.bus,
+		msg:       msg,
+		startedAt: time.Now(),
+	}
+	return context.WithValue(ctx, turnAckKey{}, ack), ack
+}
+
+// ackFrom 返回 ctx 中的快速确认跟踪器（可能为 nil）
+func ackFrom(ctx context.Context) *turnAck {
+	ack, _ := ctx.Value(turnAckKey{}).(*turnAck)
+	return ack
+}
+
+// onToolCalls 在模型请求调用工具时调用
+// 只有第一次调用会生效：立即发送确认，或者在剩余的延迟时间之后发送
+func (t *turnAck) onToolCalls(resp *providers.LLMResponse) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.armed || t.done {
+		return
+	}
+	t.armed = true
+
+	content := t.render(resp)
+	remaining := t.opts.Delay - time.Since(t.startedAt)
+	if remaining <= 0 {
+		t.publish(content)
+		return
+	}
+	t.timer = time.AfterFunc(remaining, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if !t.done {
+			t.publish(content)
+		}
+	})
+}
+
+// finish 标记回合结束，取消尚未发送的确认
+func (t *turnAck) finish() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done = true
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// render 生成确认消息内容
+func (t *turnAck) render(resp *providers.LLMResponse) string {
+	if t.opts.UseModelText {
+		if text := strings.TrimSpace(resp.Content); text != "" {
+			return text
+		}
+	}
+
+	names := make([]string, 0, len(resp.ToolCalls))
+	seen := make(map[string]bool)
+	for _, tc := range resp.ToolCalls {
+		if !seen[tc.Name] {
+			seen[tc.Name] = true
+			names = append(names, tc.Name)
+		}
+	}
+	return strings.ReplaceAll(t.opts.Message, "{tools}", strings.Join(names, ", "))
+}
+
+// publish 发送确认消息（调用方需持有 t.mu）
+func (t *turnAck) publish(content string) {
+	if content == "" {
+		return
+	}
+
+	metadata := make(map[string]interface{}, len(t.msg.Metadata)+1)
+	for k, v := range t.msg.Metadata {
+		metadata[k] = v
+	}
+	metadata["ack"] = true
+
+	t.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:  t.msg.Channel,
+		ChatID:   t.msg.ChatID,
+		Content:  content,
+		Metadata: metadata,
+	})
+}
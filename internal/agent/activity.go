@@ -0,0 +1,202 @@
+package agent
+
+// activity.go - 处理期间的"正在输入"状态、表情回应和进度提示
+//
+// Agent 运行较长的回合时，用户只能等待最终回复。启用后：
+//   - 支持的通道（例如 Telegram 的 sendChatAction）会持续显示"正在输入…"，直到回合结束
+//   - 支持的通道（例如 Telegram 的 setMessageReaction）开始处理时用 👀 回应用户的消息，完成后换成 done 表情
+//   - 模型把待办标记为 in_progress 时，发送一条简短的进度提示（例如 "Step 3/5: 生成图片"）；
+//     运行较久的工具报告的进度也通过同一回调发送（见 toolcall.go）
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/tools"
+)
+
+// typingInterval 是刷新"正在输入"状态的间隔
+// Telegram 的输入状态持续约 5 秒，需要在过期前重新发送
+const typingInterval = 4 * time.Second
+
+// ActivityOptions 描述某个通道在处理期间的反馈方式
+type ActivityOptions struct {
+	Typing   bool // 处理期间显示"正在输入…"
+	Progress bool // 待办开始执行时发送进度提示
+
+	WorkingReaction string // 开始处理时用于回应用户消息的表情（为空表示不回应）
+	DoneReaction    string // 处理完成后替换成的表情
+}
+
+// TypingFunc 在指定聊天中显示"正在输入"状态
+type TypingFunc func(channel, chatID string) error
+
+// ReactFunc 用表情回应指定消息，emoji 为空表示移除回应
+type ReactFunc func(channel, chatID, messageID, emoji string) error
+
+// turnActivity 跟踪单个回合的输入状态和表情回应
+type turnActivity struct {
+	stop chan struct{}
+	once sync.Once
+
+	react   func(emoji string) // 回应本回合的用户消息（nil 表示不回应）
+	reacted chan struct{}      // 开始处理的回应发送完成后关闭，保证完成回应在它之后发送
+	done    string             // 处理完成后的表情
+}
+
+// SetActivityOptions 设置某个通道在处理期间的反馈方式
+// 参数:
+//
+//	channel: 通道名称（如 "telegram"）
+//	opts: 反馈选项
+func (a *AgentLoop) SetActivityOptions(channel string, opts ActivityOptions) {
+	a.ackMu.Lock()
+	defer a.ackMu.Unlock()
+	if a.activityOptions == nil {
+		a.activityOptions = make(map[string]ActivityOptions)
+	}
+	a.activityOptions[channel] = opts
+}
+
+// SetTypingFunc 设置显示"正在输入"状态的函数（通常由频道管理器提供）
+func (a *AgentLoop) SetTypingFunc(fn TypingFunc) {
+	a.ackMu.Lock()
+	defer a.ackMu.Unlock()
+	a.typing = fn
+}
+
+// SetReactFunc 设置用表情回应消息的函数（通常由频道管理器提供）
+func (a *AgentLoop) SetReactFunc(fn ReactFunc) {
+	a.ackMu.Lock()
+	defer a.ackMu.Unlock()
+	a.react = fn
+}
+
+// beginActivity 为一条入站消息开始显示输入状态、表情回应和进度提示
+// 返回的 ctx 携带进度回调；调用方在回合结束后必须调用 finish
+func (a *AgentLoop) beginActivity(ctx context.Context, msg bus.InboundMessage) (context.Context, *turnActivity) {
+	channel, chatID := msg.Channel, msg.ChatID
+	if channel == "system" {
+		// 子代理公告的回复发往原始聊天，chat_id 是 "channel:chat_id"
+		if idx := strings.Index(chatID, ":"); idx != -1 {
+			channel, chatID = chatID[:idx], chatID[idx+1:]
+		}
+	}
+
+	a.ackMu.RLock()
+	opts := a.activityOptions[channel]
+	typing := a.typing
+	react := a.react
+	a.ackMu.RUnlock()
+
+	if opts.Progress {
+		// source_message_id 是本回合的用户消息，频道据此把进度提示与同一回合的确认和回复关联起来
+		sourceID := metadataID(msg.Metadata["message_id"])
+		ctx = tools.WithProgress(ctx, func(note string) {
+			metadata := map[string]interface{}{"progress": true}
+			if sourceID != "" {
+				metadata["source_message_id"] = sourceID
+			}
+			a.bus.PublishOutbound(bus.OutboundMessage{
+				Channel:  channel,
+				ChatID:   chatID,
+				Content:  note,
+				Metadata: metadata,
+			})
+		})
+	}
+
+	if strings.HasPrefix(msg.Content, "/") {
+		return ctx, nil
+	}
+
+	activity := &turnActivity{stop: make(chan struct{})}
+	messageID := metadataID(msg.Metadata["message_id"])
+	if opts.WorkingReaction != "" && react != nil && msg.Channel != "system" && messageID != "" {
+		activity.react = func(emoji string) {
+			if err := react(channel, chatID, messageID, emoji); err != nil {
+				log.Printf("[Agent] 发送表情回应失败: %v", err)
+			}
+		}
+		activity.reacted = make(chan struct{})
+		activity.done = opts.DoneReaction
+		go func() {
+			defer close(activity.reacted)
+			activity.react(opts.WorkingReaction)
+		}()
+	}
+
+	if !opts.Typing || typing == nil {
+		if activity.react == nil {
+			return ctx, nil
+		}
+		close(activity.stop)
+		return ctx, activity
+	}
+
+	go func() {
+		ticker := time.NewTicker(typingInterval)
+		defer ticker.Stop()
+		for {
+			if err := typing(channel, chatID); err != nil {
+				log.Printf("[Agent] 发送输入状态失败: %v", err)
+				return
+			}
+			select {
+			case <-activity.stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return ctx, activity
+}
+
+// finish 停止显示输入状态，并把表情回应换成完成状态
+// 回合失败时移除回应（错误信息会作为回复发送）
+func (t *turnActivity) finish(err error) {
+	if t == nil {
+		return
+	}
+	t.once.Do(func() {
+		select {
+		case <-t.stop:
+		default:
+			close(t.stop)
+		}
+		if t.react == nil {
+			return
+		}
+		emoji := t.done
+		if err != nil {
+			emoji = ""
+		}
+		go func() {
+			<-t.reacted
+			t.react(emoji)
+		}()
+	})
+}
+
+// metadataID 把消息元数据中的 ID（频道可能存为数字或字符串）转换为字符串
+func metadataID(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatInt(int64(v), 10)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,172 @@
+package agent
+
+// admin.go - 管理员聊天命令
+// /status、/tools、/model、/memory 会暴露运行状态或改变模型，/profile 会修改共用的 USER.md，只允许配置的管理员使用
+// 本地 CLI（"cli" 频道）始终视为管理员
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/i18n"
+	"github.com/Ailoc/nanogrip/internal/session"
+	"github.com/Ailoc/nanogrip/internal/tools"
+)
+
+// sessionModelKey 是会话元数据中保存 /model 切换的模型的键
+const sessionModelKey = "model"
+
+// memoryReplyLimit /memory 最多显示的字符数
+const memoryReplyLimit = 3500
+
+type modelOverrideKey struct{}
+
+// SetAdmins 设置可以使用管理员命令的用户
+// 参数:
+//
+//	ids: 发送者 ID，可以写 "123" 或 "telegram:123"；为空表示只有本地 CLI 可以使用
+func (a *AgentLoop) SetAdmins(ids []string) {
+	admins := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		admins[id] = true
+	}
+	a.settingsMu.Lock()
+	a.admins = admins
+	a.settingsMu.Unlock()
+}
+
+// isAdmin 判断消息发送者是否是管理员
+func (a *AgentLoop) isAdmin(msg bus.InboundMessage) bool {
+	if msg.Channel == "cli" {
+		return true
+	}
+	if msg.SenderID == "" {
+		return false
+	}
+	a.settingsMu.RLock()
+	defer a.settingsMu.RUnlock()
+	return a.admins[msg.SenderID] || a.admins[msg.Channel+":"+msg.SenderID]
+}
+
+// adminCommand 处理管理员命令，消息不是管理员命令时返回 false
+func (a *AgentLoop) adminCommand(ctx context.Context, msg bus.InboundMessage, sess *session.Session) (string, bool) {
+	fields := strings.Fields(msg.Content)
+	if len(fields) == 0 {
+		return "", false
+	}
+	switch fields[0] {
+	case "/status", "/tools", "/model", "/memory", "/profile":
+	default:
+		return "", false
+	}
+	if !a.isAdmin(msg) {
+		return i18n.T(languageFrom(ctx), "admin_only", fields[0]), true
+	}
+
+	switch fields[0] {
+	case "/status":
+		return a.statusReport() + a.usageReport(msg) + a.budgetReport(), true
+	case "/tools":
+		return a.toolsReport(ctx), true
+	case "/model":
+		return a.modelCommand(sess, fields[1:]), true
+	case "/profile":
+		return a.profileCommand(fields[1:]), true
+	default:
+		return a.memoryReport(msg.Channel, msg.ChatID), true
+	}
+}
+
+// toolsReport 列出当前可用的工具，外部工具（例如 MCP）按来源分组
+func (a *AgentLoop) toolsReport(ctx context.Context) string {
+	registry := a.toolsFor(ctx)
+	var builtin []string
+	external := make(map[string][]string)
+	for _, name := range registry.ToolNames() {
+		if sourced, ok := registry.Get(name).(tools.SourcedTool); ok {
+			external[sourced.Source()] = append(external[sourced.Source()], name)
+			continue
+		}
+		builtin = append(builtin, name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🧰 Tools (%d)\n", registry.Len()))
+	sb.WriteString(fmt.Sprintf("Built-in: %s", strings.Join(builtin, ", ")))
+
+	sources := make([]string, 0, len(external))
+	for source := range external {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		sb.WriteString(fmt.Sprintf("\n%s: %s", source, strings.Join(external[source], ", ")))
+	}
+	return sb.String()
+}
+
+// modelCommand 处理 /model 命令
+//
+//	/model          查看本会话使用的模型
+//	/model <name>   本会话改用指定模型
+//	/model reset    恢复默认模型
+func (a *AgentLoop) modelCommand(sess *session.Session, args []string) string {
+	defaultModel, _, _ := a.ModelSettings()
+	current, _ := sess.Metadata[sessionModelKey].(string)
+
+	if len(args) == 0 {
+		if current == "" {
+			return fmt.Sprintf("Model: %s (default)", defaultModel)
+		}
+		return fmt.Sprintf("Model: %s (default: %s)\nUse /model reset to switch back.", current, defaultModel)
+	}
+
+	if args[0] == "reset" || args[0] == "default" {
+		delete(sess.Metadata, sessionModelKey)
+		a.sessions.Save(sess)
+		return fmt.Sprintf("Model reset to %s.", defaultModel)
+	}
+
+	if sess.Metadata == nil {
+		sess.Metadata = make(map[string]interface{})
+	}
+	sess.Metadata[sessionModelKey] = args[0]
+	a.sessions.Save(sess)
+	return fmt.Sprintf("Model for this conversation switched to %s.", args[0])
+}
+
+// memoryReport 返回当前聊天的长期记忆内容
+func (a *AgentLoop) memoryReport(channel, chatID string) string {
+	memory := a.memoryFor(channel, chatID)
+	if memory == nil {
+		return "Long-term memory is not available."
+	}
+	content := strings.TrimSpace(memory.ReadLongTerm())
+	if content == "" {
+		return "🧠 Long-term memory is empty."
+	}
+	if runes := []rune(content); len(runes) > memoryReplyLimit {
+		content = string(runes[:memoryReplyLimit]) + "\n…(truncated)"
+	}
+	return "🧠 Long-term memory:\n" + content
+}
+
+// withSessionModel 如果会话通过 /model 切换了模型，让本回合的 LLM 调用使用该模型
+func withSessionModel(ctx context.Context, sess *session.Session) context.Context {
+	if model, ok := sess.Metadata[sessionModelKey].(string); ok && model != "" {
+		return context.WithValue(ctx, modelOverrideKey{}, model)
+	}
+	return ctx
+}
+
+// modelFor 返回本回合使用的模型（会话切换的模型优先于默认模型）
+func (a *AgentLoop) modelFor(ctx context.Context) (string, int, float64) {
+	model, maxTokens, temperature := a.ModelSettings()
+	if override, ok := ctx.Value(modelOverrideKey{}).(string); ok {
+		model = override
+	}
+	return model, maxTokens, temperature
+}
@@ -0,0 +1,111 @@
+package agent
+
+// branch.go - 撤销和会话分支
+// /undo 删除最后一轮对话（用户消息、助手回复以及之后的系统通知），
+// /fork <名称> 把当前会话复制为一个分支（会话键为 "<会话键>#<名称>"），
+// 之后可以用 /fork restore <名称> 回到分支保存时的状态，而不必用 /new 丢掉整个会话。
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/i18n"
+	"github.com/Ailoc/nanogrip/internal/session"
+)
+
+// forkSeparator 分支会话键中原会话键和分支名称之间的分隔符
+const forkSeparator = "#"
+
+// forkNamePattern 合法的分支名称
+var forkNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// undoCommand 处理 /undo 命令：删除最后一条用户消息及其之后的所有消息
+func (a *AgentLoop) undoCommand(sess *session.Session, lang string) string {
+	last := -1
+	for i := len(sess.Messages) - 1; i >= 0; i-- {
+		msg := sess.Messages[i]
+		// 子代理报告等系统通知也以 user 角色保存，跳过它们，连同之后的内容一起删除
+		if msg.Role == "user" && !strings.HasPrefix(msg.Content, "[System: ") {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		return i18n.T(lang, "undo_nothing")
+	}
+
+	removed := sess.Messages[last].Content
+	consolidated := sess.LastConsolidated > last
+	sess.Truncate(last)
+	a.sessions.Save(sess)
+
+	reply := i18n.T(lang, "undo_done", truncateRunes(removed, 80))
+	if consolidated {
+		reply += "\n" + i18n.T(lang, "undo_consolidated")
+	}
+	return reply
+}
+
+// forkCommand 处理 /fork 命令
+// 参数:
+//
+//	args: 空表示列出分支；<名称> 保存分支；restore <名称> 用分支替换当前会话
+func (a *AgentLoop) forkCommand(key string, sess *session.Session, args []string, lang string) string {
+	if len(args) == 0 {
+		forks := a.listForks(key)
+		if len(forks) == 0 {
+			return i18n.T(lang, "fork_none")
+		}
+		return i18n.T(lang, "fork_list", strings.Join(forks, ", "))
+	}
+
+	if args[0] == "restore" {
+		if len(args) < 2 {
+			return i18n.T(lang, "fork_usage")
+		}
+		name := args[1]
+		if !forkNamePattern.MatchString(name) || !a.hasFork(key, name) {
+			return i18n.T(lang, "fork_unknown", name)
+		}
+		branch := a.sessions.GetOrCreate(key + forkSeparator + name)
+		restored := branch.Clone(key)
+		restored.CreatedAt = sess.CreatedAt
+		a.sessions.Save(restored)
+		a.sessions.Invalidate(key)
+		return i18n.T(lang, "fork_restored", name, len(restored.Messages))
+	}
+
+	name := args[0]
+	if len(args) > 1 || !forkNamePattern.MatchString(name) {
+		return i18n.T(lang, "fork_usage")
+	}
+	branch := sess.Clone(key + forkSeparator + name)
+	if err := a.sessions.Save(branch); err != nil {
+		return "❌ " + err.Error()
+	}
+	return i18n.T(lang, "fork_saved", name, len(branch.Messages))
+}
+
+// listForks 返回会话的所有分支名称（按名称排序）
+func (a *AgentLoop) listForks(key string) []string {
+	prefix := key + forkSeparator
+	var forks []string
+	for _, info := range a.sessions.ListSessions() {
+		if k, _ := info["key"].(string); strings.HasPrefix(k, prefix) {
+			forks = append(forks, strings.TrimPrefix(k, prefix))
+		}
+	}
+	sort.Strings(forks)
+	return forks
+}
+
+// hasFork 判断会话是否有指定名称的分支
+func (a *AgentLoop) hasFork(key, name string) bool {
+	for _, fork := range a.listForks(key) {
+		if fork == name {
+			return true
+		}
+	}
+	return false
+}
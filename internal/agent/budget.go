@@ -0,0 +1,31 @@
+package agent
+
+// budget.go - 每日花费上限
+// 预算的检查和记录在提供商外层完成（见 budget.Provider），这里负责把预算用完的错误
+// 转换为给用户看的说明，并在 /status 中显示各提供商当天的用量
+
+import (
+	"errors"
+
+	"github.com/Ailoc/nanogrip/internal/budget"
+	"github.com/Ailoc/nanogrip/internal/i18n"
+)
+
+// SetBudget 设置每日花费上限的用量记录（多个 Agent 共享同一个）
+func (a *AgentLoop) SetBudget(tracker *budget.Tracker) {
+	a.budgetTracker = tracker
+}
+
+// budgetReply 预算用完导致处理失败时返回给用户的说明，其他错误返回 false
+func budgetReply(err error, lang string) (string, bool) {
+	var exceeded *budget.ExceededError
+	if !errors.As(err, &exceeded) {
+		return "", false
+	}
+	return i18n.T(lang, "budget_exceeded", exceeded.Provider, exceeded.ResetAt.Format("15:04")), true
+}
+
+// budgetReport 返回各提供商当天的用量（用于 /status），未启用预算时返回空字符串
+func (a *AgentLoop) budgetReport() string {
+	return a.budgetTracker.Report()
+}
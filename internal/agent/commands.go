@@ -0,0 +1,87 @@
+package agent
+
+// commands.go - 由外部注册的聊天命令
+// 内置命令（/new、/status 等）直接在 processMessage 中处理；
+// 需要 AgentLoop 之外的组件的命令（例如 /mcp reload 需要 MCP 管理器）由 gateway 或 CLI 注册
+// 用 RegisterAdminCommand 注册的命令只有管理员可以使用（见 admin.go）
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/i18n"
+)
+
+// CommandFunc 处理一条聊天命令，返回回复内容
+// args 是命令名之后的参数（按空白分割）
+type CommandFunc func(ctx context.Context, msg bus.InboundMessage, args []string) string
+
+// command 是一条注册的聊天命令
+type command struct {
+	help    string
+	handler CommandFunc
+	admin   bool // 只有管理员可以使用
+}
+
+// RegisterCommand 注册一条聊天命令
+// 参数：
+//   - name: 命令名（不含 "/"，例如 "mcp"）
+//   - help: /help 中显示的说明
+//   - handler: 命令处理函数
+func (a *AgentLoop) RegisterCommand(name, help string, handler CommandFunc) {
+	a.commandsMu.Lock()
+	defer a.commandsMu.Unlock()
+	if a.commands == nil {
+		a.commands = make(map[string]command)
+	}
+	a.commands[strings.TrimPrefix(name, "/")] = command{help: help, handler: handler}
+}
+
+// RegisterAdminCommand 注册一条只有管理员可以使用的聊天命令，参数同 RegisterCommand
+func (a *AgentLoop) RegisterAdminCommand(name, help string, handler CommandFunc) {
+	a.commandsMu.Lock()
+	defer a.commandsMu.Unlock()
+	if a.commands == nil {
+		a.commands = make(map[string]command)
+	}
+	a.commands[strings.TrimPrefix(name, "/")] = command{help: help, handler: handler, admin: true}
+}
+
+// runCommand 执行注册的命令，消息不是注册的命令时返回 false
+func (a *AgentLoop) runCommand(ctx context.Context, msg bus.InboundMessage) (string, bool) {
+	fields := strings.Fields(msg.Content)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", false
+	}
+
+	a.commandsMu.RLock()
+	cmd, ok := a.commands[strings.TrimPrefix(fields[0], "/")]
+	a.commandsMu.RUnlock()
+	if !ok {
+		return "", false
+	}
+	if cmd.admin && !a.isAdmin(msg) {
+		return i18n.T(languageFrom(ctx), "admin_only", fields[0]), true
+	}
+	return cmd.handler(ctx, msg, fields[1:]), true
+}
+
+// commandsHelp 返回注册命令的帮助文本（每行一条，按名称排序）
+func (a *AgentLoop) commandsHelp() string {
+	a.commandsMu.RLock()
+	defer a.commandsMu.RUnlock()
+
+	names := make([]string, 0, len(a.commands))
+	for name := range a.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString("\n/" + name + " — " + a.commands[name].help)
+	}
+	return sb.String()
+}
@@ -0,0 +1,120 @@
+package agent
+
+// consolidation.go - 记忆整理的配置和调度
+//
+// 会话中未整理的消息达到阈值时，把最早的一批消息通过 LLM 提炼到 MEMORY.md 和 HISTORY.md。
+// 默认使用主模型并立即在后台整理；可以改用单独的（更便宜的）模型，
+// 或者等会话空闲一段时间后再整理，避免与正在进行的对话争用模型和限流额度。
+
+import (
+	"log"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/providers"
+)
+
+// defaultConsolidationTimeout 是单次整理的默认超时时间
+const defaultConsolidationTimeout = 120 * time.Second
+
+// ConsolidationOptions 记忆整理的配置
+type ConsolidationOptions struct {
+	Provider   providers.LLMProvider // 整理使用的提供商（nil 表示使用主提供商）
+	Model      string                // 整理使用的模型（为空表示使用主模型）
+	Timeout    time.Duration         // 单次整理的超时时间（<= 0 表示 120 秒）
+	Threshold  int                   // 未整理的消息达到多少条时整理（<= 0 表示 memoryWindow/2）
+	BatchSize  int                   // 每次整理的消息条数（<= 0 表示与 Threshold 相同）
+	KeepRecent int                   // 最近的多少条消息不参与整理
+	IdleDelay  time.Duration         // 会话空闲多久后再整理（<= 0 表示达到阈值后立即整理）
+}
+
+// SetConsolidation 设置记忆整理的模型、阈值和调度方式
+// 必须在 Start 之前调用
+func (a *AgentLoop) SetConsolidation(opts ConsolidationOptions) {
+	a.consolidation = opts
+}
+
+// consolidationThreshold 返回触发整理的未整理消息数
+func (a *AgentLoop) consolidationThreshold() int {
+	if a.consolidation.Threshold > 0 {
+		return a.consolidation.Threshold
+	}
+	if a.memoryWindow/2 > 0 {
+		return a.memoryWindow / 2
+	}
+	return 10 // 默认每10条消息整理一次
+}
+
+// consolidationBatch 返回每次整理的消息条数
+func (a *AgentLoop) consolidationBatch() int {
+	if a.consolidation.BatchSize > 0 {
+		return a.consolidation.BatchSize
+	}
+	return a.consolidationThreshold()
+}
+
+// pendingConsolidation 返回会话中可以整理的消息区间 [start, end)
+// 最近的 KeepRecent 条消息不参与整理
+func (a *AgentLoop) pendingConsolidation(sessLen, lastConsolidated int) (start, end int) {
+	end = sessLen - a.consolidation.KeepRecent
+	if end < lastConsolidated {
+		end = lastConsolidated
+	}
+	return lastConsolidated, end
+}
+
+// consolidationModel 返回整理使用的提供商、模型和超时时间
+func (a *AgentLoop) consolidationModel() (providers.LLMProvider, string, time.Duration) {
+	provider, model := a.provider, a.consolidation.Model
+	if a.consolidation.Provider != nil {
+		provider = a.consolidation.Provider
+	}
+	if model == "" {
+		model, _, _ = a.ModelSettings()
+	}
+	timeout := a.consolidation.Timeout
+	if timeout <= 0 {
+		timeout = defaultConsolidationTimeout
+	}
+	return provider, model, timeout
+}
+
+// scheduleConsolidation 在会话空闲 IdleDelay 后整理记忆
+// 会话每收到一条消息都会重新计时
+func (a *AgentLoop) scheduleConsolidation(sessionKey string) {
+	a.consolidatingMu.Lock()
+	defer a.consolidatingMu.Unlock()
+
+	if timer, ok := a.consolidationTimers[sessionKey]; ok {
+		timer.Reset(a.consolidation.IdleDelay)
+		return
+	}
+	a.consolidationTimers[sessionKey] = time.AfterFunc(a.consolidation.IdleDelay, func() {
+		a.consolidatingMu.Lock()
+		delete(a.consolidationTimers, sessionKey)
+		if a.consolidating[sessionKey] || (a.ctx != nil && a.ctx.Err() != nil) {
+			a.consolidatingMu.Unlock()
+			return
+		}
+		a.consolidating[sessionKey] = true
+		a.consolidatingMu.Unlock()
+
+		defer func() {
+			a.consolidatingMu.Lock()
+			delete(a.consolidating, sessionKey)
+			a.consolidatingMu.Unlock()
+		}()
+
+		log.Printf("[Memory] 会话 %s 已空闲 %v，开始整理积压的消息", sessionKey, a.consolidation.IdleDelay)
+		a.consolidateMemory(sessionKey, a.sessions.GetOrCreate(sessionKey))
+	})
+}
+
+// stopConsolidationTimers 取消所有等待中的空闲整理
+func (a *AgentLoop) stopConsolidationTimers() {
+	a.consolidatingMu.Lock()
+	defer a.consolidatingMu.Unlock()
+	for key, timer := range a.consolidationTimers {
+		timer.Stop()
+		delete(a.consolidationTimers, key)
+	}
+}
@@ -14,13 +14,16 @@ package agent
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Ailoc/nanogrip/internal/media"
 	"github.com/Ailoc/nanogrip/internal/skills"
+	"github.com/Ailoc/nanogrip/internal/tools"
 )
 
 // ContextBuilder 构建发送给 LLM 的消息
@@ -29,6 +32,11 @@ type ContextBuilder struct {
 	workspace   string               // 工作空间路径
 	skills      *skills.SkillsLoader // 技能加载器
 	memoryStore *MemoryStore         // 记忆存储
+	memoryScope MemoryScopeFunc      // 按聊天选择记忆存储（nil 表示始终使用 memoryStore）
+	rolePrompt  string               // 额外的角色说明（多 Agent 时由 agents.instances 的 systemPrompt 设置）
+
+	channelCaps   map[string]string // 各频道的能力说明（消息长度、媒体类型、格式等）
+	channelCapsMu sync.RWMutex      // 保护 channelCaps
 }
 
 // NewContextBuilder 创建一个新的上下文构建器
@@ -48,6 +56,28 @@ func (cb *ContextBuilder) SetMemoryStore(memoryStore *MemoryStore) {
 	cb.memoryStore = memoryStore
 }
 
+// SetMemoryScope 设置按聊天选择记忆存储的函数（按聊天隔离记忆时使用）
+func (cb *ContextBuilder) SetMemoryScope(scope MemoryScopeFunc) {
+	cb.memoryScope = scope
+}
+
+// SetRolePrompt 设置额外的角色说明
+// 说明会放在核心身份之后、Bootstrap 文件之前
+func (cb *ContextBuilder) SetRolePrompt(prompt string) {
+	cb.rolePrompt = strings.TrimSpace(prompt)
+}
+
+// SetChannelCapabilities 设置频道的能力说明
+// 说明会附加在系统提示词的当前频道信息之后
+func (cb *ContextBuilder) SetChannelCapabilities(channel string, description string) {
+	cb.channelCapsMu.Lock()
+	defer cb.channelCapsMu.Unlock()
+	if cb.channelCaps == nil {
+		cb.channelCaps = make(map[string]string)
+	}
+	cb.channelCaps[channel] = description
+}
+
 // BuildMessages 构建完整的消息数组
 // 这个方法组装所有必要的上下文，包括：
 // 1. 系统消息（包含身份、技能、工作空间信息）
@@ -59,31 +89,42 @@ func (cb *ContextBuilder) SetMemoryStore(memoryStore *MemoryStore) {
 //   - currentMessage: 当前用户消息
 //   - channel: 消息来源频道（如 "whatsapp"、"cli"）
 //   - chatID: 聊天 ID
-//   - media: 媒体文件列表（如图片、文件）
+//   - mediaFiles: 媒体文件列表（如图片、文件）
+//   - pinned: 会话的固定内容（不受 memoryWindow 影响，始终放在上下文靠前的位置）
+//   - loc: 会话的时区（用于当前时间，nil 表示服务器的本地时区）
 func (cb *ContextBuilder) BuildMessages(
 	history []map[string]interface{},
 	currentMessage string,
 	channel string,
 	chatID string,
-	media []string,
+	mediaFiles []string,
+	pinned []string,
+	loc *time.Location,
 ) []map[string]interface{} {
 	messages := make([]map[string]interface{}, 0)
 
 	// 系统消息 - 包含 Agent 身份、技能、工作空间等核心信息
-	systemContent := cb.buildSystemPrompt()
-	if channel != "" {
-		systemContent += fmt.Sprintf("\n\nCurrent channel: %s", channel)
-	}
-	if chatID != "" {
-		systemContent += fmt.Sprintf("\nChat ID: %s", chatID)
+	memory := cb.memoryStore
+	if cb.memoryScope != nil {
+		memory = cb.memoryScope(channel, chatID)
 	}
+	// 身份、技能等稳定部分在各次请求之间保持不变，标记为缓存断点（"cache"）以便提供商缓存这段前缀；
+	// 时间、记忆和通道信息放在后面单独的系统消息中
 	messages = append(messages, map[string]interface{}{
 		"role":    "system",
-		"content": systemContent,
+		"content": cb.buildSystemPrompt(memory),
+		"cache":   true,
 	})
+	messages = append(messages, map[string]interface{}{
+		"role":    "system",
+		"content": cb.buildRuntimeContext(memory, channel, chatID, pinned, loc),
+	})
+
+	// 历史消息中的图片只重新附带最近的几张，避免每轮都发送全部图片
+	imageBudget := historyImageBudget(history)
 
 	// 历史消息 - 保留对话上下文
-	for _, msg := range history {
+	for i, msg := range history {
 		role, _ := msg["role"].(string)
 		content, _ := msg["content"].(string)
 
@@ -96,6 +137,15 @@ func (cb *ContextBuilder) BuildMessages(
 			"content": content,
 		}
 
+		// 附带媒体的用户消息：重新加入文件引用和图片，"先看图再处理"的多轮对话仍然能看到图片
+		if files, ok := msg["media"].([]string); ok && len(files) > 0 {
+			text, images := describeMedia(content, files, imageBudget[i])
+			entry["content"] = text
+			if len(images) > 0 {
+				entry["images"] = images
+			}
+		}
+
 		// 添加工具调用信息（如果存在）
 		if tc, ok := msg["tool_calls"].([]interface{}); ok && len(tc) > 0 {
 			entry["tool_calls"] = tc
@@ -108,29 +158,7 @@ func (cb *ContextBuilder) BuildMessages(
 	}
 
 	// 当前用户消息 - 添加媒体附件信息
-	currentContent := currentMessage
-	var imageList []string // 收集图片用于发送给视觉模型
-
-	if len(media) > 0 {
-		for _, m := range media {
-			// 检测媒体类型：URL、base64 data URL 或本地文件
-			if strings.HasPrefix(m, "http://") || strings.HasPrefix(m, "https://") {
-				// URL - 添加到内容中，同时作为图片引用
-				currentContent += "\n[Media URL: " + m + "]"
-				// 如果是图片 URL，添加到图片列表
-				if strings.HasSuffix(m, ".jpg") || strings.HasSuffix(m, ".jpeg") ||
-					strings.HasSuffix(m, ".png") || strings.HasSuffix(m, ".gif") ||
-					strings.HasSuffix(m, ".webp") {
-					imageList = append(imageList, m)
-				}
-			} else if strings.HasPrefix(m, "data:image/") {
-				// base64 图片 - 不添加到文本内容，添加到图片列表供视觉模型使用
-				imageList = append(imageList, m)
-			} else {
-				currentContent += "\n[File: " + m + "]"
-			}
-		}
-	}
+	currentContent, imageList := describeMedia(currentMessage, mediaFiles, -1)
 
 	msg := map[string]interface{}{
 		"role":    "user",
@@ -147,20 +175,123 @@ func (cb *ContextBuilder) BuildMessages(
 	return messages
 }
 
+// historyImageLimit 历史消息中最多重新附带的图片数量（从最近的消息开始计算）
+const historyImageLimit = 4
+
+// describeMedia 把媒体附件转换为消息文本中的引用，并收集发送给视觉模型的图片
+// 参数:
+//   - content: 消息文本
+//   - files: 媒体文件（URL、base64 data URL 或本地文件路径）
+//   - maxImages: 最多收集的图片数量，负数表示不限制
+//
+// 返回: 添加了附件引用的文本，图片列表（URL 或 data URL）
+func describeMedia(content string, files []string, maxImages int) (string, []string) {
+	var images []string
+	canAttach := func() bool {
+		return maxImages < 0 || len(images) < maxImages
+	}
+
+	for _, m := range files {
+		// 检测媒体类型：URL、base64 data URL 或本地文件
+		if strings.HasPrefix(m, "http://") || strings.HasPrefix(m, "https://") {
+			// URL - 添加到内容中，如果是图片 URL 同时添加到图片列表
+			content += "\n[Media URL: " + m + "]"
+			if isImageURL(m) && canAttach() {
+				images = append(images, m)
+			}
+		} else if strings.HasPrefix(m, "data:image/") {
+			// base64 图片 - 不添加到文本内容，添加到图片列表供视觉模型使用
+			if canAttach() {
+				images = append(images, m)
+			}
+		} else if media.IsImage(m) {
+			// 本地图片（频道下载到媒体目录的文件）- 只在调用时读取为 base64，
+			// 同时告诉模型文件路径，便于用工具进一步处理
+			content += "\n[Image: " + m + "]"
+			if !canAttach() {
+				continue
+			}
+			if dataURL, err := media.DataURL(m); err == nil {
+				images = append(images, dataURL)
+			} else {
+				log.Printf("Failed to load image %s: %v", m, err)
+			}
+		} else {
+			content += "\n[File: " + m + "]"
+		}
+	}
+	return content, images
+}
+
+// historyImageBudget 计算每条历史消息可以重新附带的图片数量
+// 从最近的消息往前分配，总数不超过 historyImageLimit
+// 返回: 历史消息下标 -> 图片数量
+func historyImageBudget(history []map[string]interface{}) map[int]int {
+	budget := make(map[int]int)
+	remaining := historyImageLimit
+	for i := len(history) - 1; i >= 0 && remaining > 0; i-- {
+		files, _ := history[i]["media"].([]string)
+		count := 0
+		for _, m := range files {
+			if isImageURL(m) || strings.HasPrefix(m, "data:image/") || media.IsImage(m) {
+				count++
+			}
+		}
+		if count > remaining {
+			count = remaining
+		}
+		budget[i] = count
+		remaining -= count
+	}
+	return budget
+}
+
+// isImageURL 判断 URL 是否指向图片（按扩展名）
+func isImageURL(m string) bool {
+	if !strings.HasPrefix(m, "http://") && !strings.HasPrefix(m, "https://") {
+		return false
+	}
+	return strings.HasSuffix(m, ".jpg") || strings.HasSuffix(m, ".jpeg") ||
+		strings.HasSuffix(m, ".png") || strings.HasSuffix(m, ".gif") ||
+		strings.HasSuffix(m, ".webp")
+}
+
+// sessionMedia 返回需要保存到会话历史的媒体文件
+// base64 data URL 体积太大，不保存到会话中
+func sessionMedia(files []string) []string {
+	var kept []string
+	for _, m := range files {
+		if !strings.HasPrefix(m, "data:") {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
 // buildSystemPrompt 构建完整的系统提示词
 // 系统提示词是 Agent 的核心"大脑"，包含：
 // 1. 核心身份（Agent 名称、能力、运行环境）
 // 2. Bootstrap 文件（AGENTS.md、SOUL.md 等自定义配置）
 // 3. 技能系统（always-loaded 技能的完整内容 + 可用技能摘要）
+// 这些内容在各次请求之间保持不变，可以被提供商缓存；时间、记忆等变化的部分见 buildRuntimeContext
 //
 // 技能加载策略（渐进式加载）：
 // - Always-loaded skills: 完整内容直接注入（如核心技能）
 // - Available skills: 只显示摘要，需要时 Agent 通过 read_file 工具读取
-func (cb *ContextBuilder) buildSystemPrompt() string {
+func (cb *ContextBuilder) buildSystemPrompt(memory *MemoryStore) string {
 	parts := make([]string, 0)
 
 	// 核心身份 - Agent 的基本信息和能力
-	parts = append(parts, cb.getIdentity())
+	memoryDir := filepath.Join(cb.workspace, "memory")
+	if memory != nil {
+		memoryDir = memory.Dir()
+	}
+	parts = append(parts, cb.getIdentity(memoryDir))
+
+	// 角色说明 - 多 Agent 时每个 Agent 的专属提示词
+	if cb.rolePrompt != "" {
+		parts = append(parts, "# Role\n\n"+cb.rolePrompt)
+	}
 
 	// 加载 Bootstrap 文件 - 自定义配置（AGENTS.md、SOUL.md、USER.md 等）
 	bootstrap := cb.loadBootstrapFiles()
@@ -193,258 +324,63 @@ Skills with available="false" need dependencies installed first - you can try in
 		parts = append(parts, skillsSection)
 	}
 
+	// 用分隔符连接所有部分
+	return strings.Join(parts, "\n\n---\n\n")
+}
+
+// buildRuntimeContext 构建每次请求都可能变化的系统提示词部分
+// 包括当前时间、会话的固定内容、长期记忆（MEMORY.md）和当前通道信息；
+// 这部分放在 buildSystemPrompt 之后，不影响前面稳定部分的提示词缓存
+func (cb *ContextBuilder) buildRuntimeContext(memory *MemoryStore, channel string, chatID string, pinned []string, loc *time.Location) string {
+	parts := make([]string, 0)
+
+	if loc == nil {
+		loc = time.Local
+	}
+	now := time.Now().In(loc)
+	current := "## Current Time\n" + now.Format("2006-01-02 15:04 (Monday)") + " (" + now.Format("MST")
+	if loc != time.Local {
+		current += ", " + loc.String()
+	}
+	parts = append(parts, current+")")
+
+	// 固定内容 - 用户要求在整个会话中始终遵守的指示
+	if len(pinned) > 0 {
+		parts = append(parts, "## Pinned\nThe user pinned these for this conversation. Always follow them:\n"+tools.FormatPins(pinned))
+	}
+
 	// 长期记忆 - 从 MEMORY.md 加载
-	if cb.memoryStore != nil {
-		memoryContext := cb.memoryStore.GetMemoryContext()
+	if memory != nil {
+		memoryContext := memory.GetMemoryContext()
 		if memoryContext != "" {
 			parts = append(parts, memoryContext)
 		}
 	}
 
-	// 用分隔符连接所有部分
+	if channel != "" {
+		session := fmt.Sprintf("Current channel: %s", channel)
+		cb.channelCapsMu.RLock()
+		caps := cb.channelCaps[channel]
+		cb.channelCapsMu.RUnlock()
+		if caps != "" {
+			session += fmt.Sprintf("\nChannel capabilities: %s", caps)
+		}
+		if chatID != "" {
+			session += fmt.Sprintf("\nChat ID: %s", chatID)
+		}
+		parts = append(parts, session)
+	} else if chatID != "" {
+		parts = append(parts, fmt.Sprintf("Chat ID: %s", chatID))
+	}
+
 	return strings.Join(parts, "\n\n---\n\n")
 }
 
 // getIdentity 返回核心身份部分
-// 这包括 Agent 的名称、能力、当前时间、运行环境和工作空间信息
-func (cb *ContextBuilder) getIdentity() string {
-	now := time.Now().Format("2006-01-02 15:04 (Monday)")
-	tz := time.Now().Format("MST")
-	workspacePath := cb.workspace
-
-	sys := runtime.GOOS
-	arch := runtime.GOARCH
-
-	return `# nanogrip 🐈
-
-You are nanogrip, a helpful AI assistant. You have access to tools that allow you to:
-- Read, write, and edit files
-- Execute shell commands
-- Search the web and fetch web pages
-- Send messages to users on chat channels
-- Spawn subagents for background tasks
-
-## Available Tools
-
-You have access to the following tools:
-- **web_search**: Search the web for current information. Use this when you need up-to-date facts, news, weather, or information beyond your training data.
-- **filesystem**: Read, write, list, and delete files (operation: read/write/list/delete/exists)
-- **shell**: Execute non-interactive shell commands
-- **tmux skill**: For interactive commands requiring passwords, confirmations, or TTY (see below)
-- **spawn**: Create subagents for parallel background tasks
-- **todo**: Manage task lists for multi-step projects
-- **save_memory**: Save long-term memory and history
-
-## Shell Tool vs tmux Skill
-
-**CRITICAL:** The shell tool does NOT support interactive input (passwords, confirmations, etc.).
-
-### Decision Flow:
-1. Does the command need interaction? → Use tmux skill
-2. Command is non-interactive? → Use shell tool
-3. Not sure? → Use tmux (safer)
-
-### Use tmux skill for:
-- SSH/SCP: ssh user@host, scp file host:/path
-- Password prompts: sudo command, sudo -i
-- Installers: apt install, yum install, pip install
-- Interactive programs: vim, nano, top, htop
-- REPL environments: python, node, ipython
-- Anything needing TTY or user input
-
-### Use shell tool for:
-- File operations: ls, cp, mv, rm, mkdir, chmod
-- Text processing: cat, head, tail, grep, awk, sed
-- Pipes and redirects: cmd1 | cmd2, cmd > file
-- Background services: systemctl start, service start
-- Non-interactive scripts: python script.py, bash script.sh
-
-### Quick Reference:
-
-- SSH connection (use tmux): ssh user@192.168.1.1
-- Sudo command (use tmux): sudo apt install nginx
-- List files (use shell): ls -la /home/user
-- Read file (use shell): cat /etc/hosts
-- Python script (use shell): python3 script.py
-- Python REPL (use tmux): python3 interactive
-
-For tmux usage details, refer to: workspace/skills/tmux/SKILL.md
-
-## When to Use Subagents
-Use the 'spawn' tool to run tasks in the background when:
-- The task takes a long time to complete
-- The task can run independently without immediate user feedback
-- You want to run multiple tasks in parallel
-- The task is computationally expensive or memory-intensive
-- You need to monitor something continuously
-
-When you spawn a subagent:
-- It runs in the background and notifies you when complete
-- You can continue handling other requests while it runs
-- Multiple subagents can run simultaneously
-
-## Task Classification & Plan-Execute Workflow
-
-You MUST classify EVERY user request:
-
-### Type A: Simple Direct Response
-- Questions answerable from knowledge, or single-step actions
-- Reply directly with text, NO todo tool needed
-- Examples: "What is 1+1?", "List files", "Hello"
-
-### Type B: Execution Task (Plan-Execute Required)
-- Tasks requiring 2+ steps, tool usage, or multi-stage execution
-- **MUST use todo tool FIRST** to create a plan, then execute
-- Examples: "Search and save", "Generate image and send", "Read files and report"
-
-## Plan-Execute Pattern (Mandatory for Type B)
-
-**Complete Workflow for "Generate Image and Send":**
-
-1. Create project and todos in one call:
-   todo(operation="add_todos", project_name="Generate Heart Image", todos=[
-     {"content":"Write Python script", "priority":"high"},
-     {"content":"Run script to generate image", "priority":"high"},
-     {"content":"Send image to user", "priority":"high"}
-   ])
-   The result contains project_id and todo_ids. Use them in later update_todo calls.
-
-2. **Execute each step in order:**
-   - Update to in_progress: todo(operation="update_todo", project_id="[ID]", todo_id="[todo_id]", status="in_progress")
-   - Execute: filesystem(operation="write", path="script.py", content="...")
-   - Update to completed: todo(operation="update_todo", project_id="[ID]", todo_id="[todo_id]", status="completed")
-
-   - Update to in_progress: todo(operation="update_todo", project_id="[ID]", todo_id="[todo_id]", status="in_progress")
-   - Execute: shell(command="python3 script.py")
-   - Verify: shell(command="ls -la image.png")
-   - Update to completed: todo(operation="update_todo", project_id="[ID]", todo_id="[todo_id]", status="completed")
-
-   - Update to in_progress: todo(operation="update_todo", project_id="[ID]", todo_id="[todo_id]", status="in_progress")
-   - Execute: message(content="Here is your image", media="image.png", media_type="photo")
-   - Update to completed: todo(operation="update_todo", project_id="[ID]", todo_id="[todo_id]", status="completed")
-
-3. **Archive Project (Important!):**
-   After all todos are completed, ALWAYS archive the project:
-   - todo(operation="archive_project", project_id="[ID]")
-
-**CRITICAL: After each todo step, you MUST update its status to "completed" before moving to next step!**
-**IMPORTANT: ALWAYS archive the project after all tasks are completed to keep the todo list clean!**
-
-## When to Use Todo
-
-**Todo System - Multi-Project Support:**
-This tool supports multiple projects/tasks. Each project can contain multiple todo items. Use projects to organize different work contexts.
-
-**Automatically create a project with todos when the task has:**
-- Multiple steps (2 or more distinct actions)
-- Conditional logic (if X then do Y)
-- Dependencies (step B depends on step A)
-- Research + action combination
-- Complex file operations (read multiple files, then process, then write)
-- Multiple files or directories to manage
-
-**How to use todo:**
-
-1. **Create Project and Add Todos:**
-   - todo(operation="add_todos", project_name="项目名称", description="可选描述", todos=[{"content":"待办内容", "priority":"high/medium/low"}])
-   - add_todos automatically finds or creates an active project and returns project_id plus todo_ids.
-
-2. **Update Todo Status:**
-   - todo(operation="update_todo", project_id="项目ID", todo_id="待办ID", status="pending/in_progress/completed/failed")
-
-3. **List Projects:**
-   - todo(operation="list_projects", include_archived=true/false)
-
-4. **List Todos in a Project:**
-   - todo(operation="list_todos", project_id="项目ID")
-
-5. **Archive/Delete Project:**
-   - todo(operation="archive_project", project_id="项目ID")
-   - todo(operation="delete_project", project_id="项目ID")
-
-**Example - Automatic Planning:**
-User: "Search for Python tutorials, save top 5 to a file, then read and summarize"
-→ You should AUTOMATICALLY:
-  1. Add todos: todo(operation="add_todos", project_name="Python Tutorials Research", todos=[
-       {"content":"Search for Python tutorials"},
-       {"content":"Save top 5 to file"},
-       {"content":"Read and summarize"}
-     ])
-→ Then execute each step and update status
-
-**Task Classification Examples:**
-- Type A: "What is 1+1?" → Direct: "2"
-- Type A: "List files" → Direct shell execution
-- Type B: "Search X, save to file" → MUST use todo first
-- Type B: "Generate image and send to Telegram" → MUST use todo first
-
-## Current Time
-` + now + ` (` + tz + `)
-
-## Workflow Summary
-
-| Task Type | First Action | Final Action |
-|-----------|--------------|--------------|
-| Type A (Simple) | Direct response | None needed |
-| Type B (Execution) | todo: add_todos | message: send to channel |
-
-**CRITICAL RULE**: For Type B tasks, NEVER execute steps before creating the todo plan!
-
-## Workspace
-Your workspace is at: ` + workspacePath + `
-- Long-term memory: ` + workspacePath + `/memory/MEMORY.md
-- History log: ` + workspacePath + `/memory/HISTORY.md (grep-searchable)
-
-NOTE: Built-in skills are listed in the Skills section above with their full paths. Use those paths when reading skill files.
-
-## Runtime
-` + sys + ` ` + arch + `
-
-## Channel Response Rules
-
-When a task is COMPLETED (Type B), you MUST respond via message tool to the channel:
-- message tool: content="Task completed! Results: ...", channel="[channel]", chat_id="[chat_id]"
-
-For Type A (simple questions), just reply with text directly - no message tool needed.
-
-## Sending Images
-When you need to send images to the user, use the message tool with the following parameters:
-- content: Text caption for the image
-- media: Local file path or URL of the image (MUST use ABSOLUTE path like $HOME/.nanogrip/workspace/filename.png)
-- media_type: "photo" (for images)
-
-IMPORTANT - Taking screenshots:
-1. First, check if screenshot is available: shell tool: command="xrandr 2>/dev/null || echo 'NO_DISPLAY'"
-2. If NO_DISPLAY or error, inform the user that screenshots are not available in this environment
-3. If display is available, use scrot with ABSOLUTE path: scrot $HOME/.nanogrip/workspace/screenshot.png
-4. Verify file exists and has content (>1KB): ls -la $HOME/.nanogrip/workspace/screenshot.png
-5. If screenshot is too small (<1KB), it's a black image - inform the user
-6. Use the message tool with the ABSOLUTE file path
-
-Example - Taking and sending a screenshot:
-Step 1: shell tool: command="xrandr 2>/dev/null || echo 'NO_DISPLAY'"
-Step 2: shell tool: command="scrot $HOME/.nanogrip/workspace/screenshot.png"
-Step 3: Verify file exists: shell tool: command="ls -la $HOME/.nanogrip/workspace/screenshot.png"
-Step 4: message tool: content="Here's your screenshot:", media="$HOME/.nanogrip/workspace/screenshot.png", media_type="photo"
-
-## Generating Images with Python
-If you need to generate images using Python, follow these rules:
-1. Use a Python script file instead of inline code with -c
-2. Write the script to a file first, then run it
-3. After generating, ALWAYS send the image using message tool
-
-Example - Generate and send an image:
-Step 1: Write Python script: shell tool: command="cat > $HOME/.nanogrip/workspace/generate_image.py << 'EOF'\nfrom PIL import Image, ImageDraw, ImageFont\nimg = Image.new('RGB', (400, 200), color=(255, 200, 200))\nd = ImageDraw.Draw(img)\ntry:\n    fnt = ImageFont.truetype('/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf', 40)\nexcept:\n    fnt = ImageFont.load_default()\nd.text((50, 50), 'Hello!', font=fnt, fill=(0, 0, 0))\nimg.save('/home/minimax/.nanogrip/workspace/random_image.png')\nEOF"
-Step 2: Run the script: shell tool: command="python3 $HOME/.nanogrip/workspace/generate_image.py"
-Step 3: Verify file exists: shell tool: command="ls -la $HOME/.nanogrip/workspace/random_image.png"
-Step 4: Send the image: message tool: content="Here's a random image I generated:", media="$HOME/.nanogrip/workspace/random_image.png", media_type="photo"
-
-NEVER use "python3 -c" with multiple statements - it will fail! Always use a script file.
-
-Always be helpful, accurate, and concise. Before calling tools, briefly tell the user what you're about to do (one short sentence in the user's language).
-If you need to use tools, call them directly — never send a preliminary message like "Let me check" without actually calling a tool.
-When remembering something important, write to ` + workspacePath + `/memory/MEMORY.md
-To recall past events, grep ` + workspacePath + `/memory/HISTORY.md`
+// 这包括 Agent 的名称、能力、运行环境和工作空间信息（当前时间见 buildRuntimeContext）
+// 内容由系统提示词模板生成，见 prompt.go
+func (cb *ContextBuilder) getIdentity(memoryDir string) string {
+	return cb.renderSystemTemplate(memoryDir)
 }
 
 // loadBootstrapFiles 从工作空间加载 Bootstrap 文件
@@ -489,7 +425,8 @@ func (cb *ContextBuilder) AddAssistantMessage(
 	}
 
 	if reasoningContent != "" {
-		// 推理模型可能在内容中包含推理过程
+		// 推理模型的推理内容需要随工具调用一起回传（见 runAgentLoop）
+		msg["reasoning"] = reasoningContent
 	}
 
 	messages = append(messages, msg)
@@ -0,0 +1,173 @@
+package agent
+
+// digest.go - 每日/每周摘要
+// 收集一段时间内的对话、完成的待办和执行过的定时任务，由模型总结成一条摘要消息，
+// 同时追加到 HISTORY.md。由内置的 "digest" 定时任务触发（见 cron.digest 配置）。
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/cron"
+	"github.com/Ailoc/nanogrip/internal/providers"
+	"github.com/Ailoc/nanogrip/internal/tools"
+)
+
+const (
+	// digestMessageLimit 摘要素材中单条消息最多保留的字符数
+	digestMessageLimit = 300
+	// digestInputLimit 摘要素材最多包含的字符数（超出的早期对话被省略）
+	digestInputLimit = 30000
+)
+
+// GenerateDigest 生成 since 之后的活动摘要，并追加到 HISTORY.md
+// 使用记忆整理的模型（见 SetConsolidation）
+// 参数:
+//
+//	ctx: 上下文
+//	title: 摘要标题（例如 "Daily digest"）
+//	since: 摘要的开始时间
+//	jobs: 定时任务列表，上次执行时间在 since 之后的任务会列入摘要
+//	loc: 摘要接收者的时区（摘要中的时间按此时区显示，nil 表示服务器的本地时区）
+//
+// 返回:
+//
+//	摘要内容，这段时间没有任何活动时返回空字符串
+func (a *AgentLoop) GenerateDigest(ctx context.Context, title string, since time.Time, jobs []*cron.Job, loc *time.Location) (string, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	conversations := a.digestConversations(since, loc)
+
+	var completed []string
+	if todo, ok := a.tools.Get("todo").(*tools.TodoTool); ok {
+		items, err := todo.CompletedSince(since)
+		if err != nil {
+			log.Printf("[Digest] 读取待办失败: %v", err)
+		}
+		completed = items
+	}
+
+	var ran []string
+	for _, job := range jobs {
+		if job.Builtin == "" && job.LastRun.After(since) {
+			ran = append(ran, fmt.Sprintf("%s (last run %s)", job.Name, job.LastRun.In(loc).Format("2006-01-02 15:04")))
+		}
+	}
+
+	if conversations == "" && len(completed) == 0 && len(ran) == 0 {
+		log.Printf("[Digest] %s 之后没有活动，跳过摘要", since.Format("2006-01-02 15:04"))
+		return "", nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Write a %s for the period %s to %s.\n\n", strings.ToLower(title), since.In(loc).Format("2006-01-02 15:04"), time.Now().In(loc).Format("2006-01-02 15:04 MST"))
+	sb.WriteString("## Conversations\n")
+	sb.WriteString(orNone(conversations))
+	sb.WriteString("\n\n## Completed todos\n")
+	sb.WriteString(orNone(bulletList(completed)))
+	sb.WriteString("\n\n## Scheduled jobs that ran\n")
+	sb.WriteString(orNone(bulletList(ran)))
+	sb.WriteString("\n\nSummarize what happened, decisions made, what got done and anything still open or needing attention. Use short markdown sections and bullet points, be concise, and do not invent anything that is not in the material above.")
+
+	provider, model, timeout := a.consolidationModel()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := provider.Chat(ctx, []providers.Message{
+		{Role: "system", Content: "You write brief activity digests for the owner of a personal assistant."},
+		{Role: "user", Content: sb.String()},
+	}, nil, model, 2048, 0.3)
+	if err != nil {
+		return "", err
+	}
+	digest := strings.TrimSpace(resp.Content)
+	if digest == "" {
+		return "", fmt.Errorf("model returned an empty digest")
+	}
+
+	entry := fmt.Sprintf("[%s] %s\n%s", time.Now().Format("2006-01-02 15:04"), title, digest)
+	if err := a.memoryStore.AppendHistory(entry); err != nil {
+		log.Printf("[Digest] 写入 HISTORY.md 失败: %v", err)
+	}
+	return "📰 " + title + "\n\n" + digest, nil
+}
+
+// digestConversations 返回 since 之后各会话中的用户和助手消息（消息时间按 loc 显示）
+func (a *AgentLoop) digestConversations(since time.Time, loc *time.Location) string {
+	type sessionText struct {
+		key     string
+		updated time.Time
+		text    string
+	}
+	var sessions []sessionText
+	for _, info := range a.sessions.ListSessions() {
+		if updated, ok := info["updated_at"].(string); ok {
+			if t, err := time.Parse(time.RFC3339, updated); err == nil && t.Before(since) {
+				continue
+			}
+		}
+		path, _ := info["path"].(string)
+		sess, err := a.sessions.LoadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var lines []string
+		var last time.Time
+		for _, msg := range sess.Messages {
+			if (msg.Role != "user" && msg.Role != "assistant") || strings.TrimSpace(msg.Content) == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, msg.Timestamp)
+			if err != nil || t.Before(since) {
+				continue
+			}
+			last = t
+			content := strings.Join(strings.Fields(msg.Content), " ")
+			if runes := []rune(content); len(runes) > digestMessageLimit {
+				content = string(runes[:digestMessageLimit]) + "…"
+			}
+			lines = append(lines, fmt.Sprintf("[%s] %s: %s", t.In(loc).Format("01-02 15:04"), msg.Role, content))
+		}
+		if len(lines) > 0 {
+			key, _ := info["key"].(string)
+			sessions = append(sessions, sessionText{key: key, updated: last, text: strings.Join(lines, "\n")})
+		}
+	}
+
+	// 最近活跃的会话在前，超出长度上限时省略较早的会话
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].updated.After(sessions[j].updated) })
+	var parts []string
+	total := 0
+	for _, s := range sessions {
+		part := "### " + s.key + "\n" + s.text
+		if total+len(part) > digestInputLimit && len(parts) > 0 {
+			parts = append(parts, fmt.Sprintf("(%d older conversations omitted)", len(sessions)-len(parts)))
+			break
+		}
+		parts = append(parts, part)
+		total += len(part)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// bulletList 把列表格式化为 markdown 列表
+func bulletList(items []string) string {
+	if len(items) == 0 {
+		return ""
+	}
+	return "- " + strings.Join(items, "\n- ")
+}
+
+// orNone 为空时返回 "(none)"
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,145 @@
+package agent
+
+// language.go - 会话语言
+// 系统生成的文本（/help、错误回复、子代理完成提示等）按会话的语言输出：
+//   - 用户用 /language 设置的语言优先
+//   - 其次是配置的 agents.defaults.language（"auto" 表示不固定）
+//   - 最后是根据用户消息检测到的语言，检测不出时使用 i18n 的默认语言
+//
+// 语言保存在会话元数据中，随会话持久化。设置了固定语言时还会要求模型用该语言回复。
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/i18n"
+	"github.com/Ailoc/nanogrip/internal/session"
+)
+
+const (
+	// sessionLanguageKey 会话元数据中保存语言的键
+	sessionLanguageKey = "language"
+	// sessionLanguageSourceKey 会话元数据中保存语言来源的键（"user" 或 "detected"）
+	sessionLanguageSourceKey = "language_source"
+)
+
+type languageKey struct{}
+
+// SetLanguage 设置默认语言
+// 可以在运行时调用（配置热重载）
+// 参数:
+//
+//	lang: 语言代码（例如 "en"、"zh"），"auto" 或空字符串表示根据用户的消息检测
+func (a *AgentLoop) SetLanguage(lang string) {
+	normalized, _ := i18n.Normalize(lang)
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+	a.language = normalized
+}
+
+// sessionLanguage 返回会话的语言和来源（"user"、"config"、"detected" 或 "default"）
+func (a *AgentLoop) sessionLanguage(sess *session.Session) (string, string) {
+	lang, _ := sess.Metadata[sessionLanguageKey].(string)
+	source, _ := sess.Metadata[sessionLanguageSourceKey].(string)
+	if lang != "" && source == "user" {
+		return lang, source
+	}
+
+	a.settingsMu.RLock()
+	configured := a.language
+	a.settingsMu.RUnlock()
+	if configured != "" {
+		return configured, "config"
+	}
+	if lang != "" {
+		return lang, "detected"
+	}
+	return i18n.Default(), "default"
+}
+
+// detectLanguage 根据用户消息更新会话检测到的语言（用户设置的语言不会被覆盖）
+func (a *AgentLoop) detectLanguage(sess *session.Session, content string) {
+	if source, _ := sess.Metadata[sessionLanguageSourceKey].(string); source == "user" {
+		return
+	}
+	detected := i18n.Detect(content)
+	if detected == "" {
+		return
+	}
+	if current, _ := sess.Metadata[sessionLanguageKey].(string); current != detected {
+		sess.Metadata[sessionLanguageKey] = detected
+		sess.Metadata[sessionLanguageSourceKey] = "detected"
+	}
+}
+
+// withLanguage 把本回合的语言放入上下文
+func withLanguage(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, languageKey{}, lang)
+}
+
+// languageFrom 返回上下文中的语言（没有时使用默认语言）
+func languageFrom(ctx context.Context) string {
+	if lang, ok := ctx.Value(languageKey{}).(string); ok {
+		return lang
+	}
+	return i18n.Default()
+}
+
+// languageForSession 返回会话键对应会话的语言（用于不在消息处理流程中的回复和通知）
+func (a *AgentLoop) languageForSession(key string) string {
+	lang, _ := a.sessionLanguage(a.sessions.GetOrCreate(key))
+	return lang
+}
+
+// withLanguageInstruction 会话设置了固定语言（用户设置或配置）时，在系统提示词末尾要求模型使用该语言回复
+func withLanguageInstruction(messages []map[string]interface{}, lang, source string) []map[string]interface{} {
+	if (source != "user" && source != "config") || len(messages) == 0 {
+		return messages
+	}
+	if role, _ := messages[0]["role"].(string); role != "system" {
+		return messages
+	}
+	if content, ok := messages[0]["content"].(string); ok {
+		messages[0]["content"] = content + "\n\n## Language\nAlways reply in " + i18n.Name(lang) + ", regardless of the language of tool results or earlier messages."
+	}
+	return messages
+}
+
+// helpText 返回内置命令的帮助文本（不含外部注册的命令和 /help 本身）
+func helpText(lang string) string {
+	keys := []string{"help_header", "help_new", "help_undo", "help_fork", "help_pin", "help_status", "help_tools", "help_model", "help_memory", "help_profile", "help_tasks", "help_language", "help_timezone"}
+	lines := make([]string, len(keys))
+	for i, key := range keys {
+		lines[i] = i18n.T(lang, key)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// languageCommand 处理 /language 命令
+// 参数:
+//
+//	args: 空表示显示当前语言；"auto" 表示跟随消息自动检测；其余为要设置的语言
+func (a *AgentLoop) languageCommand(sess *session.Session, args []string) string {
+	if len(args) == 0 {
+		lang, source := a.sessionLanguage(sess)
+		return i18n.T(lang, "language_current", i18n.Name(lang), i18n.T(lang, "language_source_"+source))
+	}
+
+	if args[0] == i18n.Auto {
+		delete(sess.Metadata, sessionLanguageSourceKey)
+		delete(sess.Metadata, sessionLanguageKey)
+		a.sessions.Save(sess)
+		lang, _ := a.sessionLanguage(sess)
+		return i18n.T(lang, "language_auto")
+	}
+
+	lang, ok := i18n.Normalize(args[0])
+	if !ok {
+		current, _ := a.sessionLanguage(sess)
+		return i18n.T(current, "language_unknown", args[0])
+	}
+	sess.Metadata[sessionLanguageKey] = lang
+	sess.Metadata[sessionLanguageSourceKey] = "user"
+	a.sessions.Save(sess)
+	return i18n.T(lang, "language_set", i18n.Name(lang))
+}
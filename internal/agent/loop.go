@@ -18,43 +18,86 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Ailoc/nanogrip/internal/budget"
 	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/cron"
+	"github.com/Ailoc/nanogrip/internal/i18n"
 	"github.com/Ailoc/nanogrip/internal/providers"
+	"github.com/Ailoc/nanogrip/internal/ratelimit"
 	"github.com/Ailoc/nanogrip/internal/session"
 	"github.com/Ailoc/nanogrip/internal/tools"
+	"github.com/Ailoc/nanogrip/internal/trace"
 )
 
 // AgentLoop 是主要的 Agent 循环处理器
 // 它协调所有核心组件来处理用户消息并生成响应
 type AgentLoop struct {
-	provider        providers.LLMProvider   // LLM 提供商（OpenAI、Anthropic 等）
-	tools           *tools.ToolRegistry     // 工具注册表，包含所有可用的工具
-	bus             *bus.MessageBus         // 消息总线，用于接收和发送消息
-	sessions        *session.SessionManager // 会话管理器，管理用户会话历史
-	contextBuilder  *ContextBuilder         // 上下文构建器，用于构建系统提示词
-	memoryStore     *MemoryStore            // 记忆存储，用于长期记忆和历史
-	workspace       string                  // 工作空间路径
-	model           string                  // LLM 模型名称（如 gpt-4、claude-3-5-sonnet）
-	maxTokens       int                     // 最大令牌数
-	temperature     float64                 // 温度参数（控制随机性）
-	maxIterations   int                     // 最大迭代次数（防止无限循环）
-	memoryWindow    int                     // 记忆窗口大小（保留多少条历史消息）
-	running         bool                    // 循环是否正在运行
-	runningMu       sync.RWMutex            // running 字段的读写锁
-	consolidating   map[string]bool         // 正在整理记忆的会话
-	consolidatingMu sync.Mutex              // 整理记忆的互斥锁
-	messageChan     chan string             // 消息通道（用于工具发送消息）
-	toolContextMu   sync.RWMutex            // 保护当前工具上下文
-	currentChannel  string                  // 当前处理的通道
-	currentChatID   string                  // 当前处理的聊天 ID
-	wg              sync.WaitGroup          // 等待所有goroutine结束
-	cancelFunc      context.CancelFunc      // 用于取消所有子goroutine
-	ctx             context.Context         // 上下文，用于取消操作
-	subagents       *SubagentManager        // 子代理管理器
+	provider        providers.LLMProvider      // LLM 提供商（OpenAI、Anthropic 等）
+	tools           *tools.ToolRegistry        // 工具注册表，包含所有可用的工具
+	bus             *bus.MessageBus            // 消息总线，用于接收和发送消息
+	sessions        *session.SessionManager    // 会话管理器，管理用户会话历史
+	contextBuilder  *ContextBuilder            // 上下文构建器，用于构建系统提示词
+	memoryStore     *MemoryStore               // 记忆存储，用于长期记忆和历史
+	workspace       string                     // 工作空间路径
+	model           string                     // LLM 模型名称（如 gpt-4、claude-3-5-sonnet）
+	maxTokens       int                        // 最大令牌数
+	temperature     float64                    // 温度参数（控制随机性）
+	maxIterations   int                        // 最大迭代次数（防止无限循环）
+	memoryWindow    int                        // 记忆窗口大小（保留多少条历史消息）
+	running         bool                       // 循环是否正在运行
+	runningMu       sync.RWMutex               // running 字段的读写锁
+	consolidating   map[string]bool            // 正在整理记忆的会话
+	consolidatingMu sync.Mutex                 // 整理记忆的互斥锁
+	messageChan     chan string                // 消息通道（用于工具发送消息）
+	toolContextMu   sync.RWMutex               // 保护当前工具上下文
+	currentChannel  string                     // 当前处理的通道
+	currentChatID   string                     // 当前处理的聊天 ID
+	wg              sync.WaitGroup             // 等待所有goroutine结束
+	cancelFunc      context.CancelFunc         // 用于取消所有子goroutine
+	ctx             context.Context            // 上下文，用于取消操作
+	subagents       *SubagentManager           // 子代理管理器
+	idleTimeout     time.Duration              // 会话空闲卸载时间（<= 0 表示禁用）
+	startedAt       time.Time                  // 启动时间（用于 /status）
+	ackOptions      map[string]AckOptions      // 各通道的快速确认配置
+	ackMu           sync.RWMutex               // 保护 ackOptions、activityOptions、typing 和 react
+	activityOptions map[string]ActivityOptions // 各通道处理期间的反馈方式（输入状态、进度提示）
+	typing          TypingFunc                 // 显示"正在输入"状态
+	react           ReactFunc                  // 用表情回应消息
+	limiter         *ratelimit.Limiter         // 限流和每日额度（nil 表示不限制）
+	settingsMu      sync.RWMutex               // 保护 model、maxTokens 和 temperature（配置热重载时会修改）
+	inbox           chan bus.InboundMessage    // 由 Router 分发的入站消息（nil 表示直接从消息总线消费）
+	commands        map[string]command         // 外部注册的聊天命令
+	commandsMu      sync.RWMutex               // 保护 commands
+	retainAge       time.Duration              // 会话最长保留时间（<= 0 表示不按时间过期）
+	retainCount     int                        // 最多保留的会话数量（<= 0 表示不限制）
+	memoryScope     MemoryScopeFunc            // 按聊天隔离记忆（nil 表示所有聊天共用 memoryStore）
+	admins          map[string]bool            // 可以使用管理员命令的发送者（由 settingsMu 保护）
+
+	maxSessions int            // 同时处理消息的会话上限（<= 0 表示不限制，由 settingsMu 保护）
+	workers     sessionWorkers // 按会话分配的消息处理 worker
+
+	reasoning    providers.ReasoningOptions // 推理模型参数（reasoning_effort / thinking 预算，由 settingsMu 保护）
+	logReasoning bool                       // 是否把模型返回的推理内容写入日志（由 settingsMu 保护）
+	language     string                     // 固定的默认语言（为空表示根据用户消息检测，由 settingsMu 保护）
+
+	consolidation       ConsolidationOptions   // 记忆整理的模型、阈值和调度方式
+	consolidationTimers map[string]*time.Timer // 等待会话空闲后整理的计时器（由 consolidatingMu 保护）
+
+	budgetTracker  *budget.Tracker // 每日花费上限的用量（用于 /status，nil 表示未启用）
+	titlesDisabled bool            // 不自动生成会话标题（由 settingsMu 保护）
+
+	toolStats  toolStats         // 工具调用的成功、失败和重试次数（用于 /status）
+	toolScopes []tools.ScopeRule // 按频道和聊天限制工具的规则（由 settingsMu 保护）
+
+	routing      RoutingOptions // 按复杂度选择模型（由 settingsMu 保护）
+	routingStats routingStats   // 路由到快速模型和主模型的次数（用于 /status）
+
+	timezone *time.Location // 默认时区（nil 表示服务器的本地时区，由 settingsMu 保护）
 }
 
 // NewAgentLoop 创建一个新的 Agent 循环处理器
@@ -103,6 +146,9 @@ func NewAgentLoop(
 	saveMemoryTool := tools.NewSaveMemoryTool(memoryStore)
 	toolRegistry.Register(saveMemoryTool)
 
+	// 注册记忆检索工具（检索 HISTORY.md 和每日笔记）
+	toolRegistry.Register(tools.NewMemorySearchTool(workspace))
+
 	// 注册待办事项工具（支持多项目/多任务）
 	todoTool := tools.NewTodoTool(workspace)
 	toolRegistry.Register(todoTool)
@@ -122,11 +168,17 @@ func NewAgentLoop(
 		memoryWindow:   memoryWindow,
 		consolidating:  make(map[string]bool),
 		messageChan:    make(chan string, 100),
+		maxSessions:    1, // 默认依次处理，通过 SetMaxConcurrentSessions 开启并行
+
+		consolidationTimers: make(map[string]*time.Timer),
 	}
 
 	// 设置上下文构建器的记忆上下文
 	loop.contextBuilder.SetMemoryStore(memoryStore)
 
+	// 注册固定内容工具（固定内容保存在会话元数据中）
+	toolRegistry.Register(tools.NewPinTool(loop))
+
 	return loop
 }
 
@@ -146,6 +198,8 @@ func (a *AgentLoop) Start(ctx context.Context) error {
 	a.cancelFunc = cancel
 	a.ctx = agentCtx
 
+	a.startedAt = time.Now()
+
 	// 启动消息处理器goroutine并注册到WaitGroup
 	a.wg.Add(1)
 	go func() {
@@ -153,6 +207,24 @@ func (a *AgentLoop) Start(ctx context.Context) error {
 		a.processMessages(agentCtx)
 	}()
 
+	// 启动空闲资源回收goroutine
+	if a.idleTimeout > 0 {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.evictIdleLoop(agentCtx)
+		}()
+	}
+
+	// 启动会话过期归档goroutine
+	if a.retainAge > 0 || a.retainCount > 0 {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.retentionLoop(agentCtx)
+		}()
+	}
+
 	log.Println("Agent loop started")
 	return nil
 }
@@ -172,6 +244,7 @@ func (a *AgentLoop) Stop() {
 	if a.cancelFunc != nil {
 		a.cancelFunc()
 	}
+	a.stopConsolidationTimers()
 
 	log.Println("Agent loop stopping, waiting for goroutines...")
 
@@ -190,6 +263,34 @@ func (a *AgentLoop) Stop() {
 	}
 }
 
+// evictIdleLoop 定期回收空闲资源
+// 卸载超过 idleTimeout 未访问的会话，并清空技能正文缓存（只保留元数据）
+func (a *AgentLoop) evictIdleLoop(ctx context.Context) {
+	interval := a.idleTimeout / 2
+	if interval > 5*time.Minute {
+		interval = 5 * time.Minute
+	}
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			evicted := a.sessions.EvictIdle(a.idleTimeout)
+			freed := a.contextBuilder.skills.ClearContentCache()
+			if evicted > 0 || freed > 0 {
+				log.Printf("[Agent] 空闲回收: 卸载 %d 个会话, 释放技能正文 %d 字节", evicted, freed)
+			}
+		}
+	}
+}
+
 // processMessages 处理传入的消息
 // 这是一个持续运行的循环，不断从消息总线消费消息并处理
 func (a *AgentLoop) processMessages(ctx context.Context) {
@@ -210,7 +311,7 @@ func (a *AgentLoop) processMessages(ctx context.Context) {
 			// 从消息总线消费入站消息
 			// 【调试日志】显示正在等待消息
 			// log.Printf("[Agent] 等待消息...")
-			msg, err := a.bus.ConsumeInbound(ctx)
+			msg, err := a.nextMessage(ctx)
 			if err != nil {
 				if ctx.Err() != nil {
 					return
@@ -218,26 +319,98 @@ func (a *AgentLoop) processMessages(ctx context.Context) {
 				continue
 			}
 
-			// 【调试日志】显示收到消息
-			log.Printf("[Agent] 收到消息: Channel=%s, ChatID=%s, Content=%s", msg.Channel, msg.ChatID, msg.Content)
+			// 交给所属会话的 worker：同一会话依次处理，不同会话并行处理
+			a.dispatch(ctx, msg)
+		}
+	}
+}
 
-			// 处理单个消息
-			response, err := a.processMessage(ctx, msg)
-			if err != nil {
-				log.Printf("Error processing message: %v", err)
-				response = &bus.OutboundMessage{
-					Channel:  msg.Channel,
-					ChatID:   msg.ChatID,
-					Content:  fmt.Sprintf("Error: %v", err),
-					Metadata: msg.Metadata,
-				}
-			}
+// handleMessage 处理一条入站消息并发布回复
+func (a *AgentLoop) handleMessage(ctx context.Context, msg bus.InboundMessage) {
+	// 整个处理过程使用消息的追踪 ID
+	ctx = trace.WithID(ctx, trace.FromMetadata(msg.Metadata))
+	ctx, span := trace.Start(ctx, "agent.message", "channel", msg.Channel, "chat_id", msg.ChatID)
 
-			// 发布出站响应
-			if response != nil && response.Content != "" {
-				a.bus.PublishOutbound(*response)
+	// 【调试日志】显示收到消息
+	trace.Logf(ctx, "[Agent] 收到消息: Channel=%s, ChatID=%s, Content=%s", msg.Channel, msg.ChatID, msg.Content)
+
+	// 旁听模式下的群聊消息只记入历史，不回复（见 observe.go）
+	if msg.Observed() {
+		a.observeMessage(msg)
+		span.End(nil)
+		a.bus.MarkProcessed(msg)
+		return
+	}
+
+	// 超出限流或每日额度时只回复提示，不调用模型
+	if !a.checkRateLimit(msg) {
+		span.SetAttr("rate_limited", true)
+		span.End(nil)
+		a.bus.MarkProcessed(msg)
+		return
+	}
+
+	// 处理单个消息（较慢的工具回合会先发送快速确认，处理期间显示输入状态）
+	msgCtx, ack := a.beginAck(withUsageSubject(ctx, msg), msg)
+	msgCtx, activity := a.beginActivity(msgCtx, msg)
+	response, err := a.processMessage(msgCtx, msg)
+	activity.finish(err)
+	ack.finish()
+	span.End(err)
+	if err != nil {
+		trace.Logf(ctx, "Error processing message: %v", err)
+		key := msg.SessionKey
+		if key == "" {
+			key = msg.Channel + ":" + msg.ChatID
+		}
+		lang := a.languageForSession(key)
+		content, ok := budgetReply(err, lang)
+		if !ok {
+			content = i18n.T(lang, "error_reply", err)
+		}
+		response = &bus.OutboundMessage{
+			Channel:  msg.Channel,
+			ChatID:   msg.ChatID,
+			Content:  content,
+			Metadata: msg.Metadata,
+		}
+	}
+
+	// 发布出站响应（带上追踪 ID，出站发送的日志据此关联）
+	if response != nil && response.Content != "" {
+		if id := trace.IDFrom(ctx); id != "" && trace.FromMetadata(response.Metadata) != id {
+			metadata := make(map[string]interface{}, len(response.Metadata)+1)
+			for k, v := range response.Metadata {
+				metadata[k] = v
 			}
+			metadata[trace.MetadataKey] = id
+			response.Metadata = metadata
 		}
+		a.bus.PublishOutbound(*response)
+	}
+
+	// 持久化队列中的消息到这里才算处理完成（因关闭而中断的消息保留在队列中，重启后重新处理）
+	if ctx.Err() == nil {
+		a.bus.MarkProcessed(msg)
+	}
+
+	// 第一轮对话完成后生成会话标题
+	if err == nil && ctx.Err() == nil && msg.Channel != "system" {
+		a.ensureTitle(ctx, sessionKeyFor(msg))
+	}
+}
+
+// nextMessage 获取下一条入站消息
+// 设置了 inbox 时从 inbox 读取（多 Agent 路由），否则从消息总线消费
+func (a *AgentLoop) nextMessage(ctx context.Context) (bus.InboundMessage, error) {
+	if a.inbox == nil {
+		return a.bus.ConsumeInbound(ctx)
+	}
+	select {
+	case <-ctx.Done():
+		return bus.InboundMessage{}, ctx.Err()
+	case msg := <-a.inbox:
+		return msg, nil
 	}
 }
 
@@ -245,7 +418,7 @@ func (a *AgentLoop) processMessages(ctx context.Context) {
 // 这是核心的消息处理逻辑，包括：
 // 1. 获取或创建会话
 // 2. 更新工具上下文（message、spawn 工具需要知道当前 channel 和 chat_id）
-// 3. 处理命令（/new, /help）
+// 3. 处理命令（/new, /help 和管理员命令 /status、/tools、/model、/memory）
 // 4. 构建消息上下文
 // 5. 运行 Agent 循环进行推理
 // 6. 保存会话历史
@@ -269,9 +442,23 @@ func (a *AgentLoop) processMessageWithStream(ctx context.Context, msg bus.Inboun
 	// 获取或创建会话
 	sess := a.sessions.GetOrCreate(key)
 
+	// 根据用户消息检测语言，系统生成的回复使用会话的语言
+	a.detectLanguage(sess, msg.Content)
+	lang, langSource := a.sessionLanguage(sess)
+	ctx = withLanguage(ctx, lang)
+
+	// 频道提供了用户的时区时更新会话的时区，当前时间和定时任务按会话的时区计算
+	a.detectTimezone(sess, msg.Metadata)
+	loc, locSource := a.sessionTimezone(sess)
+
 	// 设置工具上下文（通道、聊天 ID 和交互处理器）
 	a.SetToolContext(msg.Channel, msg.ChatID)
 	ctx = tools.WithToolContext(ctx, msg.Channel, msg.ChatID)
+	// 直接调用（CLI、定时任务）和 Webhook 的发送者不是真实用户，不记录发送者，审批和命令输入允许聊天中的任何人答复
+	if msg.SenderID != directSenderID && msg.Channel != "webhook" {
+		ctx = tools.WithToolSender(ctx, msg.SenderID)
+	}
+	ctx = tools.WithToolTimezone(ctx, loc)
 
 	// 处理 /new 命令 - 开始新会话
 	if msg.Content == "/new" {
@@ -280,12 +467,51 @@ func (a *AgentLoop) processMessageWithStream(ctx context.Context, msg bus.Inboun
 		newSession := session.NewSession(key)
 		newSession.CreatedAt = time.Now()
 		newSession.UpdatedAt = time.Now()
+		// 保留用户设置的语言
+		if langSource == "user" {
+			newSession.Metadata[sessionLanguageKey] = lang
+			newSession.Metadata[sessionLanguageSourceKey] = langSource
+		}
+		// 保留用户设置的和频道提供的时区
+		if locSource == "user" || locSource == "detected" {
+			newSession.Metadata[sessionTimezoneKey] = loc.String()
+			newSession.Metadata[sessionTimezoneSourceKey] = locSource
+		}
+		// 固定内容是长期有效的指示，新会话中继续生效
+		setSessionPins(newSession, sessionPins(sess))
 		a.sessions.Save(newSession)
 		a.sessions.Invalidate(key)
 		return &bus.OutboundMessage{
 			Channel: msg.Channel,
 			ChatID:  msg.ChatID,
-			Content: "新会话已创建",
+			Content: i18n.T(lang, "new_session"),
+		}, nil
+	}
+
+	// 处理 /undo 命令 - 撤销最后一轮对话
+	if msg.Content == "/undo" {
+		return &bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: a.undoCommand(sess, lang),
+		}, nil
+	}
+
+	// 处理 /fork 命令 - 保存、列出或恢复会话分支
+	if msg.Content == "/fork" || strings.HasPrefix(msg.Content, "/fork ") {
+		return &bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: a.forkCommand(key, sess, strings.Fields(msg.Content)[1:], lang),
+		}, nil
+	}
+
+	// 处理 /pin 命令 - 固定始终保留在上下文中的内容
+	if msg.Content == "/pin" || strings.HasPrefix(msg.Content, "/pin ") {
+		return &bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: a.pinCommand(sess, strings.TrimPrefix(msg.Content, "/pin"), lang),
 		}, nil
 	}
 
@@ -294,10 +520,59 @@ func (a *AgentLoop) processMessageWithStream(ctx context.Context, msg bus.Inboun
 		return &bus.OutboundMessage{
 			Channel: msg.Channel,
 			ChatID:  msg.ChatID,
-			Content: "🐈 nanobot commands:\n/new — Start a new conversation\n/help — Show available commands",
+			Content: helpText(lang) + a.commandsHelp() + "\n" + i18n.T(lang, "help_help"),
+		}, nil
+	}
+
+	// 处理管理员命令 - /status、/tools、/model、/memory
+	if reply, ok := a.adminCommand(ctx, msg, sess); ok {
+		return &bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: reply,
 		}, nil
 	}
 
+	// 处理 /tasks 命令 - 查看或取消后台子代理
+	if msg.Content == "/tasks" || strings.HasPrefix(msg.Content, "/tasks ") {
+		return &bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: a.tasksCommand(strings.Fields(msg.Content)[1:], msg),
+		}, nil
+	}
+
+	// 处理 /language 命令 - 查看或设置本会话的语言
+	if msg.Content == "/language" || strings.HasPrefix(msg.Content, "/language ") {
+		return &bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: a.languageCommand(sess, strings.Fields(msg.Content)[1:]),
+		}, nil
+	}
+
+	// 处理 /timezone 命令 - 查看或设置本会话的时区
+	if msg.Content == "/timezone" || strings.HasPrefix(msg.Content, "/timezone ") {
+		return &bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: a.timezoneCommand(sess, lang, strings.Fields(msg.Content)[1:]),
+		}, nil
+	}
+
+	// 处理外部注册的命令（例如 /mcp）
+	if reply, ok := a.runCommand(ctx, msg); ok {
+		return &bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: reply,
+		}, nil
+	}
+
+	// 会话通过 /model 切换过模型时使用该模型，否则按请求的复杂度选择模型
+	ctx = withSessionModel(ctx, sess)
+	ctx = a.routeModel(ctx, msg, sess)
+
 	// 构建消息数组（包括系统提示词、历史消息、当前消息）
 	messages := a.contextBuilder.BuildMessages(
 		sess.GetHistory(a.memoryWindow),
@@ -305,7 +580,10 @@ func (a *AgentLoop) processMessageWithStream(ctx context.Context, msg bus.Inboun
 		msg.Channel,
 		msg.ChatID,
 		msg.Media,
+		sessionPins(sess),
+		loc,
 	)
+	messages = withLanguageInstruction(messages, lang, langSource)
 
 	// 运行 Agent 循环进行推理和工具调用
 	finalContent, err := a.runAgentLoopWithStream(ctx, messages, onDelta)
@@ -314,11 +592,11 @@ func (a *AgentLoop) processMessageWithStream(ctx context.Context, msg bus.Inboun
 	}
 
 	if finalContent == "" {
-		finalContent = "I've completed processing but have no response to give."
+		finalContent = i18n.T(lang, "empty_reply")
 	}
 
 	// 保存用户消息和助手响应到会话历史
-	sess.AddMessage("user", msg.Content, nil)
+	sess.AddMessageWithMedia("user", msg.Content, sessionMedia(msg.Media))
 	sess.AddMessage("assistant", finalContent, nil)
 	a.sessions.Save(sess)
 
@@ -354,6 +632,7 @@ func (a *AgentLoop) runAgentLoopWithStream(ctx context.Context, messages []map[s
 
 	for iteration < a.maxIterations {
 		iteration++
+		trace.Logf(ctx, "[Agent] 第 %d 轮推理", iteration)
 
 		// 将消息转换为提供商格式
 		providerMessages := make([]providers.Message, len(messages))
@@ -370,6 +649,19 @@ func (a *AgentLoop) runAgentLoopWithStream(ctx context.Context, messages []map[s
 				providerMessages[i].Images = imgs
 			}
 
+			// 提示词缓存断点（见 ContextBuilder.BuildMessages）
+			if cache, ok := m["cache"].(bool); ok {
+				providerMessages[i].Cache = cache
+			}
+
+			// 推理模型的推理内容需要随工具调用一起回传
+			if reasoning, ok := m["reasoning"].(string); ok {
+				providerMessages[i].Reasoning = reasoning
+			}
+			if signature, ok := m["reasoning_signature"].(string); ok {
+				providerMessages[i].ReasoningSignature = signature
+			}
+
 			// 处理工具响应消息 - 必须包含 tool_call_id
 			if role == "tool" {
 				if toolCallID, ok := m["tool_call_id"].(string); ok && toolCallID != "" {
@@ -409,7 +701,7 @@ func (a *AgentLoop) runAgentLoopWithStream(ctx context.Context, messages []map[s
 
 		// 获取工具定义
 		toolDefs := make([]providers.ToolDef, 0)
-		for _, t := range a.tools.GetDefinitions() {
+		for _, t := range a.toolsFor(ctx).GetDefinitions() {
 			if fn, ok := t["function"].(map[string]interface{}); ok {
 				toolDefs = append(toolDefs, providers.ToolDef{
 					Type: "function",
@@ -429,6 +721,9 @@ func (a *AgentLoop) runAgentLoopWithStream(ctx context.Context, messages []map[s
 
 		// 检查是否有工具调用
 		if resp.HasToolCalls() {
+			// 需要调用工具说明这一轮会比较慢，先让用户知道消息已收到
+			ackFrom(ctx).onToolCalls(resp)
+
 			// 构建工具调用字典 - 与 nanobot 一致
 			toolCallDicts := make([]map[string]interface{}, len(resp.ToolCalls))
 			for i, tc := range resp.ToolCalls {
@@ -446,14 +741,16 @@ func (a *AgentLoop) runAgentLoopWithStream(ctx context.Context, messages []map[s
 			// 【关键修复】与 nanobot 一致：先添加工具调用的助手消息，再执行工具
 			// 这确保 LLM 知道它自己调用了哪些工具
 			messages = append(messages, map[string]interface{}{
-				"role":       "assistant",
-				"content":    resp.Content,
-				"tool_calls": toolCallDicts,
+				"role":                "assistant",
+				"content":             resp.Content,
+				"tool_calls":          toolCallDicts,
+				"reasoning":           resp.ReasoningContent,
+				"reasoning_signature": resp.ReasoningSignature,
 			})
 
 			// 执行工具调用
 			for _, tc := range resp.ToolCalls {
-				result := a.tools.Execute(ctx, tc.Name, tc.Arguments)
+				result := a.executeTool(ctx, tc.Name, tc.Arguments)
 
 				// 添加完整的工具结果消息给 LLM
 				messages = append(messages, map[string]interface{}{
@@ -479,9 +776,20 @@ func (a *AgentLoop) runAgentLoopWithStream(ctx context.Context, messages []map[s
 	return finalContent, nil
 }
 
-func (a *AgentLoop) chat(ctx context.Context, messages []providers.Message, toolDefs []providers.ToolDef, onDelta providers.StreamCallback) (*providers.LLMResponse, error) {
+func (a *AgentLoop) chat(ctx context.Context, messages []providers.Message, toolDefs []providers.ToolDef, onDelta providers.StreamCallback) (resp *providers.LLMResponse, err error) {
+	ctx = a.withReasoning(ctx)
+
+	model, _, _ := a.modelFor(ctx)
+	ctx, span := trace.Start(ctx, "llm.chat", "model", model, "messages", len(messages), "tools", len(toolDefs))
+	defer func() {
+		if resp != nil {
+			span.SetAttr("tool_calls", len(resp.ToolCalls))
+		}
+		span.End(err)
+		trace.Logf(ctx, "[LLM] %s 调用完成 (%s)", model, span.Duration().Round(time.Millisecond))
+	}()
 	if onDelta != nil {
-		if streamingProvider, ok := a.provider.(providers.StreamingLLMProvider); ok {
+		if streamingProvider, ok := a.providerFor(ctx).(providers.StreamingLLMProvider); ok {
 			emitted := false
 			wrappedDelta := func(delta string) {
 				if delta == "" {
@@ -491,8 +799,11 @@ func (a *AgentLoop) chat(ctx context.Context, messages []providers.Message, tool
 				onDelta(delta)
 			}
 
-			resp, err := streamingProvider.ChatStream(ctx, messages, toolDefs, a.model, a.maxTokens, a.temperature, wrappedDelta)
+			model, maxTokens, temperature := a.modelFor(ctx)
+			resp, err := streamingProvider.ChatStream(ctx, messages, toolDefs, model, maxTokens, temperature, wrappedDelta)
 			if err == nil {
+				a.recordUsage(ctx, resp.Usage)
+				a.handleReasoning(ctx, resp)
 				return resp, nil
 			}
 			if emitted {
@@ -503,9 +814,18 @@ func (a *AgentLoop) chat(ctx context.Context, messages []providers.Message, tool
 		}
 	}
 
-	return a.provider.Chat(ctx, messages, toolDefs, a.model, a.maxTokens, a.temperature)
+	model, maxTokens, temperature := a.modelFor(ctx)
+	resp, err = a.providerFor(ctx).Chat(ctx, messages, toolDefs, model, maxTokens, temperature)
+	if err == nil {
+		a.recordUsage(ctx, resp.Usage)
+		a.handleReasoning(ctx, resp)
+	}
+	return resp, err
 }
 
+// directSenderID 是直接调用（ProcessDirect 系列）的消息使用的发送者 ID
+const directSenderID = "user"
+
 // ProcessDirect 直接处理消息（用于 CLI 或 Cron）
 // 这个方法用于命令行界面或 cron 任务，不通过消息总线
 // 使用当前设置的 currentChannel 和 currentChatID 作为目标
@@ -551,7 +871,7 @@ func (a *AgentLoop) ProcessDirectWithContextStream(ctx context.Context, channel,
 	msg := bus.InboundMessage{
 		Message: bus.Message{
 			Channel:  channel,
-			SenderID: "user",
+			SenderID: directSenderID,
 			ChatID:   chatID,
 			Content:  content,
 		},
@@ -571,6 +891,257 @@ func (a *AgentLoop) ProcessDirectWithContextStream(ctx context.Context, channel,
 	return response.Content, nil
 }
 
+// Tools 返回 Agent 的工具注册表
+func (a *AgentLoop) Tools() *tools.ToolRegistry {
+	return a.tools
+}
+
+// Workspace 返回 Agent 的工作区路径
+func (a *AgentLoop) Workspace() string {
+	return a.workspace
+}
+
+// InvalidateSkills 清空技能缓存（包括子代理的），技能文件被修改后调用
+// 下一条消息会重新扫描技能目录
+func (a *AgentLoop) InvalidateSkills() {
+	a.contextBuilder.skills.Invalidate()
+	if a.subagents != nil {
+		a.subagents.InvalidateSkills()
+	}
+}
+
+// scopedToolsKey 是受限工具注册表视图在 context 中的键
+type scopedToolsKey struct{}
+
+// ProcessDirectWithPermissions 以受限的工具权限直接处理消息（实现 cron.AgentExecutor）
+// 用于无人值守的执行（例如 Agent 模式的定时任务）：模型只能看到并调用权限允许的工具
+func (a *AgentLoop) ProcessDirectWithPermissions(ctx context.Context, channel, chatID, content string, perms cron.Permissions) (string, error) {
+	scoped := a.tools.Scoped(tools.Scope{Allow: perms.Tools, ReadOnly: perms.ReadOnly, NoShell: perms.NoShell})
+	ctx = context.WithValue(ctx, scopedToolsKey{}, scoped)
+	return a.ProcessDirectWithContext(ctx, channel, chatID, content)
+}
+
+// SetToolScopes 设置按频道和聊天限制工具的规则（可以在运行中调用，下一次工具调用生效）
+func (a *AgentLoop) SetToolScopes(rules []tools.ScopeRule) {
+	a.settingsMu.Lock()
+	a.toolScopes = rules
+	a.settingsMu.Unlock()
+}
+
+// toolsFor 返回本次处理使用的工具注册表
+// 受限执行时为受限视图，再按当前聊天应用 SetToolScopes 设置的规则
+func (a *AgentLoop) toolsFor(ctx context.Context) *tools.ToolRegistry {
+	registry := a.tools
+	if scoped, ok := ctx.Value(scopedToolsKey{}).(*tools.ToolRegistry); ok {
+		registry = scoped
+	}
+
+	a.settingsMu.RLock()
+	rules := a.toolScopes
+	a.settingsMu.RUnlock()
+	if toolCtx, ok := tools.ToolContextFrom(ctx); ok && len(rules) > 0 {
+		registry = registry.ScopedFor(rules, toolCtx.Channel, toolCtx.ChatID)
+	}
+	return registry
+}
+
+// SetSubagentManager 设置子代理管理器（用于 /status 等状态查询，SetRouting 设置的快速模型也会传给它）
+func (a *AgentLoop) SetSubagentManager(manager *SubagentManager) {
+	a.subagents = manager
+}
+
+// SetChannelCapabilities 设置频道的能力说明，Agent 会在系统提示词中看到
+func (a *AgentLoop) SetChannelCapabilities(channel string, description string) {
+	a.contextBuilder.SetChannelCapabilities(channel, description)
+}
+
+// SetRolePrompt 设置 Agent 的角色说明（agents.instances 中的 systemPrompt）
+func (a *AgentLoop) SetRolePrompt(prompt string) {
+	a.contextBuilder.SetRolePrompt(prompt)
+}
+
+// SetMemoryIsolation 设置是否按聊天隔离记忆
+// 必须在 Start 之前调用
+// 参数:
+//
+//	perChat: 为 true 时每个会话使用自己的记忆目录（memory/<会话>/）
+//	shared: 按聊天隔离时，是否同时加载全局的 memory/MEMORY.md（只读）并允许检索全局历史
+func (a *AgentLoop) SetMemoryIsolation(perChat, shared bool) {
+	var scope MemoryScopeFunc
+	if perChat {
+		scope = func(channel, chatID string) *MemoryStore {
+			return a.memoryStore.Scoped(channel+":"+chatID, shared)
+		}
+	}
+	a.memoryScope = scope
+	a.contextBuilder.SetMemoryScope(scope)
+
+	// 记忆工具根据工具上下文中的聊天选择记忆存储
+	if saveTool, ok := a.tools.Get("save_memory").(*tools.SaveMemoryTool); ok {
+		if scope == nil {
+			saveTool.SetScope(nil)
+		} else {
+			saveTool.SetScope(func(ctx context.Context) tools.MemoryStoreInterface {
+				toolCtx, _ := tools.ToolContextFrom(ctx)
+				return scope(toolCtx.Channel, toolCtx.ChatID)
+			})
+		}
+	}
+	if searchTool, ok := a.tools.Get("memory_search").(*tools.MemorySearchTool); ok {
+		if scope == nil {
+			searchTool.SetScope(nil)
+		} else {
+			searchTool.SetScope(func(ctx context.Context) []string {
+				toolCtx, _ := tools.ToolContextFrom(ctx)
+				memory := scope(toolCtx.Channel, toolCtx.ChatID)
+				dirs := []string{memory.Dir()}
+				if sharedDir := memory.SharedDir(); sharedDir != "" {
+					dirs = append(dirs, sharedDir)
+				}
+				return dirs
+			})
+		}
+	}
+}
+
+// memoryFor 返回某个聊天使用的记忆存储
+func (a *AgentLoop) memoryFor(channel, chatID string) *MemoryStore {
+	if a.memoryScope == nil {
+		return a.memoryStore
+	}
+	return a.memoryScope(channel, chatID)
+}
+
+// SetSessionIdleTimeout 设置会话空闲卸载时间
+// 必须在 Start 之前调用；<= 0 表示禁用空闲回收
+func (a *AgentLoop) SetSessionIdleTimeout(timeout time.Duration) {
+	a.idleTimeout = timeout
+}
+
+// SetModelDefaults 更新模型、最大令牌数和温度参数
+// 可以在运行时调用（配置热重载），从下一次 LLM 调用开始生效
+func (a *AgentLoop) SetModelDefaults(model string, maxTokens int, temperature float64) {
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+	a.model = model
+	a.maxTokens = maxTokens
+	a.temperature = temperature
+}
+
+// SetReasoning 设置推理模型参数，以及是否把推理内容写入日志
+// 可以在运行时调用（配置热重载），从下一次 LLM 调用开始生效
+func (a *AgentLoop) SetReasoning(opts providers.ReasoningOptions, logReasoning bool) {
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+	a.reasoning = opts
+	a.logReasoning = logReasoning
+}
+
+// ModelSettings 返回当前的模型、最大令牌数和温度参数
+func (a *AgentLoop) ModelSettings() (string, int, float64) {
+	a.settingsMu.RLock()
+	defer a.settingsMu.RUnlock()
+	return a.model, a.maxTokens, a.temperature
+}
+
+// statusReport 生成 /status 命令的状态报告
+// 包括运行时长、进程内存占用、消息队列长度、缓存的会话和技能、运行中的子代理
+func (a *AgentLoop) statusReport() string {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	skillCount, skillBytes := a.contextBuilder.skills.CacheStats()
+
+	var sb strings.Builder
+	sb.WriteString("🐈 nanogrip status\n")
+	if !a.startedAt.IsZero() {
+		sb.WriteString(fmt.Sprintf("Uptime: %s\n", time.Since(a.startedAt).Round(time.Second)))
+	}
+	model, _, _ := a.ModelSettings()
+	sb.WriteString(fmt.Sprintf("Model: %s\n", model))
+	a.settingsMu.RLock()
+	fastModel := a.routing.Model
+	a.settingsMu.RUnlock()
+	if fastModel != "" {
+		sb.WriteString(fmt.Sprintf("Routing: %d simple (%s) / %d complex\n",
+			a.routingStats.simple.Load(), fastModel, a.routingStats.complex.Load()))
+	}
+	sb.WriteString(fmt.Sprintf("Memory: heap %s, sys %s, GC %d\n", formatBytes(mem.HeapAlloc), formatBytes(mem.Sys), mem.NumGC))
+	sb.WriteString(fmt.Sprintf("Goroutines: %d\n", runtime.NumGoroutine()))
+	if a.bus != nil {
+		sb.WriteString(fmt.Sprintf("Queues: inbound %d high / %d low, outbound %d\n",
+			a.bus.InboundSizeOf(bus.PriorityHigh), a.bus.InboundSizeOf(bus.PriorityLow), a.bus.OutboundSize()))
+	}
+	sb.WriteString(fmt.Sprintf("Tool calls: %d (failed %d, denied %d, retries %d)\n",
+		a.toolStats.calls.Load(), a.toolStats.failed.Load(), a.toolStats.denied.Load(), a.toolStats.retries.Load()))
+	sb.WriteString(fmt.Sprintf("Cached sessions: %d\n", a.sessions.CacheSize()))
+	sb.WriteString(fmt.Sprintf("Skills: %d (content cache %s)\n", skillCount, formatBytes(uint64(skillBytes))))
+	if a.subagents != nil {
+		sb.WriteString(fmt.Sprintf("Running subagents: %d\n", a.subagents.GetRunningCount()))
+	}
+	if a.idleTimeout > 0 {
+		sb.WriteString(fmt.Sprintf("Idle eviction: %s", a.idleTimeout))
+	} else {
+		sb.WriteString("Idle eviction: disabled")
+	}
+	return sb.String()
+}
+
+// tasksCommand 处理 /tasks 命令
+//
+//	/tasks              列出当前聊天的后台子代理
+//	/tasks <id>         查看子代理的详细状态和结果
+//	/tasks cancel <id>  取消运行中的子代理
+//
+// 只能查看和取消来自当前聊天的子代理，管理员可以按 ID 查看和取消任何聊天的子代理
+func (a *AgentLoop) tasksCommand(args []string, msg bus.InboundMessage) string {
+	if a.subagents == nil {
+		return "Background subagents are not available."
+	}
+	visible := func(id string) (tools.SubagentInfo, bool) {
+		info, ok := a.subagents.TaskInfo(id)
+		if !ok || (!a.isAdmin(msg) && !tools.SubagentVisible(info, msg.Channel, msg.ChatID)) {
+			return tools.SubagentInfo{}, false
+		}
+		return info, true
+	}
+	switch {
+	case len(args) == 0:
+		return tools.FormatSubagentList(a.subagents.ListTasks(), msg.Channel, msg.ChatID)
+	case args[0] == "cancel":
+		if len(args) < 2 {
+			return "Usage: /tasks cancel <id>"
+		}
+		if _, ok := visible(args[1]); !ok {
+			return fmt.Sprintf("No subagent with id %s.", args[1])
+		}
+		if !a.subagents.CancelTask(args[1]) {
+			return fmt.Sprintf("Subagent %s is not running.", args[1])
+		}
+		return fmt.Sprintf("Subagent %s cancelled.", args[1])
+	default:
+		info, ok := visible(args[0])
+		if !ok {
+			return fmt.Sprintf("No subagent with id %s.", args[0])
+		}
+		return tools.FormatSubagentStatus(info)
+	}
+}
+
+// formatBytes 将字节数格式化为人类可读的字符串
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 // SetMessageChan 设置消息通道（用于消息工具）
 // 这允许工具通过通道发送消息给用户
 func (a *AgentLoop) SetMessageChan(ch chan string) {
@@ -608,32 +1179,24 @@ func (a *AgentLoop) SetToolContext(channel, chatID string) {
 }
 
 // ConsolidateIfNeeded 检查并执行记忆整理（如果需要）
-// 当会话消息数量超过记忆窗口时，触发记忆整理
+// 当会话中未整理的消息达到阈值时，在后台（或等会话空闲后）触发记忆整理
 func (a *AgentLoop) ConsolidateIfNeeded(sessionKey string, sess *session.Session) {
 	// 检查是否需要整理
-	keepCount := a.memoryWindow / 2
-	if keepCount <= 0 {
-		keepCount = 10 // 默认保留10条消息
-	}
-
-	// 获取当前总消息数
-	msgCount := len(sess.Messages)
-	if msgCount <= keepCount {
+	threshold := a.consolidationThreshold()
+	start, end := a.pendingConsolidation(len(sess.Messages), sess.LastConsolidated)
+	if end-start < threshold {
+		log.Printf("[Memory] 未整理消息数 %d < %d，暂不整理", end-start, threshold)
 		return
 	}
 
-	// 【修复】计算从 LastConsolidated 到当前最新消息的新增数量
-	newMessagesSinceLastConsolidate := msgCount - sess.LastConsolidated
-
-	// 如果新增消息数达到 keepCount，触发整理
-	if newMessagesSinceLastConsolidate < keepCount {
-		log.Printf("[Memory] 新消息数 %d < %d，暂不整理",
-			newMessagesSinceLastConsolidate, keepCount)
+	// 等会话空闲后再整理
+	if a.consolidation.IdleDelay > 0 {
+		a.scheduleConsolidation(sessionKey)
 		return
 	}
 
-	log.Printf("[Memory] 新消息数 %d >= %d，触发整理 (LastConsolidated=%d, 总消息=%d)",
-		newMessagesSinceLastConsolidate, keepCount, sess.LastConsolidated, msgCount)
+	log.Printf("[Memory] 未整理消息数 %d >= %d，触发整理 (LastConsolidated=%d, 总消息=%d)",
+		end-start, threshold, sess.LastConsolidated, len(sess.Messages))
 
 	// 检查是否已经在整理
 	a.consolidatingMu.Lock()
@@ -652,44 +1215,51 @@ func (a *AgentLoop) ConsolidateIfNeeded(sessionKey string, sess *session.Session
 			a.consolidatingMu.Unlock()
 		}()
 
-		a.consolidateMemory(sessionKey, sess, keepCount)
+		a.consolidateMemory(sessionKey, sess)
 	}()
 }
 
 // consolidateMemory 执行记忆整理
-// 将旧消息通过 LLM 提炼并保存到 MEMORY.md 和 HISTORY.md
-func (a *AgentLoop) consolidateMemory(sessionKey string, sess *session.Session, keepCount int) {
+// 将旧消息按批通过 LLM 提炼并保存到 MEMORY.md 和 HISTORY.md，直到未整理的消息少于阈值
+func (a *AgentLoop) consolidateMemory(sessionKey string, sess *session.Session) {
 	log.Printf("[Memory] 开始记忆整理: %s", sessionKey)
 
-	// 创建带有更长超时的上下文（记忆整理可能需要更长时间）
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-	defer cancel()
+	threshold, batch := a.consolidationThreshold(), a.consolidationBatch()
+	for {
+		// 整理区间：从 LastConsolidated 开始的一批消息（最近的 KeepRecent 条除外）
+		startConsolidate, endConsolidate := a.pendingConsolidation(len(sess.Messages), sess.LastConsolidated)
+		if endConsolidate-startConsolidate < threshold {
+			return
+		}
+		if endConsolidate > startConsolidate+batch {
+			endConsolidate = startConsolidate + batch
+		}
+		oldMessages := sess.Messages[startConsolidate:endConsolidate]
 
-	// 【修复】整理区间：从 LastConsolidated 到 LastConsolidated + keepCount
-	startConsolidate := sess.LastConsolidated
-	endConsolidate := startConsolidate + keepCount
+		log.Printf("[Memory] 整理消息区间 [%d:%d] (%d 条消息) → MEMORY.md",
+			startConsolidate, endConsolidate, len(oldMessages))
 
-	// 确保不超过消息总数
-	totalMessages := len(sess.Messages)
-	if endConsolidate > totalMessages {
-		endConsolidate = totalMessages
-	}
+		if err := a.summarizeToMemory(sessionKey, oldMessages); err != nil {
+			log.Printf("Memory consolidation failed: %v", err)
+			return
+		}
 
-	// 没有需要整理的消息
-	if startConsolidate >= endConsolidate {
-		log.Printf("[Memory] 没有需要整理的消息 (start=%d, end=%d)",
-			startConsolidate, endConsolidate)
-		return
+		// 更新 LastConsolidated 到本次整理的结束位置
+		sess.LastConsolidated = endConsolidate
+		a.sessions.Save(sess)
+		log.Printf("[Memory] 整理完成: LastConsolidated=%d -> %d",
+			startConsolidate, sess.LastConsolidated)
 	}
+}
 
-	// 只整理 [LastConsolidated, LastConsolidated + keepCount) 区间的消息
-	oldMessages := sess.Messages[startConsolidate:endConsolidate]
-	if len(oldMessages) == 0 {
-		return
+// summarizeToMemory 通过 LLM 把一段对话提炼到 MEMORY.md 和 HISTORY.md
+// 用于记忆整理和会话过期归档；按聊天隔离记忆时写入该会话自己的记忆目录
+func (a *AgentLoop) summarizeToMemory(sessionKey string, oldMessages []session.Message) error {
+	channel, chatID := sessionKey, ""
+	if idx := strings.Index(sessionKey, ":"); idx != -1 {
+		channel, chatID = sessionKey[:idx], sessionKey[idx+1:]
 	}
-
-	log.Printf("[Memory] 整理消息区间 [%d:%d] (%d 条消息) → MEMORY.md",
-		startConsolidate, endConsolidate, len(oldMessages))
+	memory := a.memoryFor(channel, chatID)
 
 	// 构建对话文本
 	var lines []string
@@ -705,7 +1275,7 @@ func (a *AgentLoop) consolidateMemory(sessionKey string, sess *session.Session,
 	}
 
 	// 读取当前长期记忆
-	currentMemory := a.memoryStore.ReadLongTerm()
+	currentMemory := memory.ReadLongTerm()
 	if currentMemory == "" {
 		currentMemory = "(empty)"
 	}
@@ -724,9 +1294,18 @@ Respond by calling the save_memory tool with:
 1. history_entry: A paragraph summarizing key events/decisions (start with [YYYY-MM-DD HH:MM])
 2. memory_update: Updated long-term memory (include existing facts plus new ones, or unchanged if nothing new)`, currentMemory, conversationText)
 
-	// 调用 LLM 进行整理（使用较长超时）
-	ctx, cancel = context.WithTimeout(context.Background(), 120*time.Second)
+	// 开启用户档案学习时，同时允许模型提出 USER.md 的更新
+	profileTool := a.userProfileTool()
+	if profileTool != nil {
+		prompt += a.userProfilePrompt()
+	}
+
+	// 调用 LLM 进行整理（可以使用单独的模型和超时时间）
+	// save_memory 根据工具上下文中的聊天选择记忆存储
+	provider, model, timeout := a.consolidationModel()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+	ctx = tools.WithToolContext(ctx, channel, chatID)
 
 	// 构建消息
 	messages := []providers.Message{
@@ -758,32 +1337,37 @@ Respond by calling the save_memory tool with:
 			},
 		},
 	}
+	if profileTool != nil {
+		toolDefs = append(toolDefs, userProfileToolDef(profileTool))
+	}
 
 	// 调用 LLM
-	resp, err := a.provider.Chat(ctx, messages, toolDefs, a.model, 4096, 0.7)
+	resp, err := provider.Chat(ctx, messages, toolDefs, model, 4096, 0.7)
 	if err != nil {
-		log.Printf("Memory consolidation failed: %v", err)
-		return
+		return err
 	}
 
 	// 检查是否有工具调用
 	if resp.HasToolCalls() {
 		// 执行 save_memory 工具
 		for _, tc := range resp.ToolCalls {
-			if tc.Name == "save_memory" {
+			switch {
+			case tc.Name == "save_memory":
 				result := a.tools.Execute(ctx, tc.Name, tc.Arguments)
-				log.Printf("Memory consolidation result: %s", result)
+				log.Printf("Memory consolidation result: %s", result.Content)
+			case profileTool != nil && tc.Name == profileTool.Name():
+				result := a.tools.Execute(ctx, tc.Name, tc.Arguments)
+				log.Printf("User profile result: %s", result.Content)
+				if !profileTool.AutoAccept() && result.OK() && strings.HasPrefix(result.Content, "User profile update proposed") {
+					changes, _ := tc.Arguments["changes"].(string)
+					a.proposeUserProfile(channel, chatID, changes)
+				}
 			}
 		}
 	} else {
 		log.Printf("Memory consolidation: LLM did not call save_memory, skipping")
 	}
-
-	// 【修复】更新 LastConsolidated 到本次整理的结束位置
-	sess.LastConsolidated = endConsolidate
-	a.sessions.Save(sess)
-	log.Printf("[Memory] 整理完成: LastConsolidated=%d -> %d",
-		startConsolidate, sess.LastConsolidated)
+	return nil
 }
 
 // processSystemMessage 处理系统消息（例如子代理公告）
@@ -792,6 +1376,10 @@ Respond by calling the save_memory tool with:
 // 路由到正确的目的地
 func (a *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMessage) (*bus.OutboundMessage, error) {
 	log.Printf("Processing system message from %s", msg.SenderID)
+	subagentResult, fromSubagent := tools.SubagentResultFrom(msg.Metadata)
+	if fromSubagent {
+		log.Printf("Subagent [%s] result: %s, %d artifact(s)", subagentResult.TaskID, subagentResult.Status, len(subagentResult.Artifacts))
+	}
 
 	// 从 chat_id 解析来源（格式："channel:chat_id"）
 	originChannel := "cli"
@@ -805,6 +1393,9 @@ func (a *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMes
 	sessionKey := fmt.Sprintf("%s:%s", originChannel, originChatID)
 	sess := a.sessions.GetOrCreate(sessionKey)
 	ctx = tools.WithToolContext(ctx, originChannel, originChatID)
+	lang, langSource := a.sessionLanguage(sess)
+	loc, _ := a.sessionTimezone(sess)
+	ctx = tools.WithToolTimezone(ctx, loc)
 
 	// 更新工具上下文
 	if msgTool := a.tools.Get("message"); msgTool != nil {
@@ -825,7 +1416,10 @@ func (a *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMes
 		originChannel,
 		originChatID,
 		nil,
+		sessionPins(sess),
+		loc,
 	)
+	messages = withLanguageInstruction(messages, lang, langSource)
 
 	// Agent 循环（限制迭代次数用于公告处理）
 	iteration := 0
@@ -849,6 +1443,19 @@ func (a *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMes
 				providerMessages[i].Images = imgs
 			}
 
+			// 提示词缓存断点（见 ContextBuilder.BuildMessages）
+			if cache, ok := m["cache"].(bool); ok {
+				providerMessages[i].Cache = cache
+			}
+
+			// 推理模型的推理内容需要随工具调用一起回传
+			if reasoning, ok := m["reasoning"].(string); ok {
+				providerMessages[i].Reasoning = reasoning
+			}
+			if signature, ok := m["reasoning_signature"].(string); ok {
+				providerMessages[i].ReasoningSignature = signature
+			}
+
 			// 处理工具响应消息 - 必须包含 tool_call_id
 			if role == "tool" {
 				if toolCallID, ok := m["tool_call_id"].(string); ok && toolCallID != "" {
@@ -862,7 +1469,7 @@ func (a *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMes
 
 		// 获取工具定义
 		toolDefs := make([]providers.ToolDef, 0)
-		for _, t := range a.tools.GetDefinitions() {
+		for _, t := range a.toolsFor(ctx).GetDefinitions() {
 			if fn, ok := t["function"].(map[string]interface{}); ok {
 				toolDefs = append(toolDefs, providers.ToolDef{
 					Type: "function",
@@ -875,7 +1482,8 @@ func (a *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMes
 			}
 		}
 		// 调用 LLM
-		resp, err := a.provider.Chat(ctx, providerMessages, toolDefs, a.model, a.maxTokens, a.temperature)
+		model, maxTokens, temperature := a.ModelSettings()
+		resp, err := a.provider.Chat(a.withReasoning(ctx), providerMessages, toolDefs, model, maxTokens, temperature)
 		if err != nil {
 			return nil, err
 		}
@@ -897,19 +1505,21 @@ func (a *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMes
 
 			// 先添加工具调用的助手消息
 			messages = append(messages, map[string]interface{}{
-				"role":       "assistant",
-				"content":    resp.Content,
-				"tool_calls": toolCallDicts,
+				"role":                "assistant",
+				"content":             resp.Content,
+				"tool_calls":          toolCallDicts,
+				"reasoning":           resp.ReasoningContent,
+				"reasoning_signature": resp.ReasoningSignature,
 			})
 
 			// 执行工具
 			for _, tc := range resp.ToolCalls {
-				result := a.tools.Execute(ctx, tc.Name, tc.Arguments)
+				result := executeTool(ctx, a.toolsFor(ctx), tc.Name, tc.Arguments, &a.toolStats)
 				messages = append(messages, map[string]interface{}{
 					"role":         "tool",
 					"tool_call_id": tc.ID,
 					"name":         tc.Name,
-					"content":      result,
+					"content":      result.Content,
 				})
 			}
 		} else {
@@ -919,7 +1529,7 @@ func (a *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMes
 	}
 
 	if finalContent == "" {
-		finalContent = "Background task completed."
+		finalContent = i18n.T(lang, "background_done")
 	}
 
 	// 保存到会话（在历史中标记为系统消息）
@@ -927,10 +1537,16 @@ func (a *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMes
 	sess.AddMessage("assistant", finalContent, nil)
 	a.sessions.Save(sess)
 
+	// 子代理结果是后台消息，免打扰时段内会被暂存
+	metadata := map[string]interface{}{"from_subagent": true}
+	if fromSubagent {
+		metadata["subagent_task_id"] = subagentResult.TaskID
+	}
 	return &bus.OutboundMessage{
-		Channel: originChannel,
-		ChatID:  originChatID,
-		Content: finalContent,
+		Channel:  originChannel,
+		ChatID:   originChatID,
+		Content:  finalContent,
+		Metadata: metadata,
 	}, nil
 }
 
@@ -13,6 +13,10 @@
 // - 按日期组织，便于回顾
 // - 可通过工具按需访问
 //
+// 按聊天隔离（agents.defaults.memoryScope: chat）：
+// - 每个会话使用自己的目录 memory/<会话>/，包含独立的 MEMORY.md、HISTORY.md 和每日笔记
+// - 启用 sharedMemory 时，全局的 memory/MEMORY.md 也会（只读）加载到每个聊天的上下文中
+//
 // 记忆整理机制：
 // - 当会话历史超过窗口大小时，旧消息可以被整理到 MEMORY.md
 // - 使用 LLM 提炼重要信息，避免丢失关键上下文
@@ -31,9 +35,10 @@ import (
 // MemoryStore 提供两层记忆：MEMORY.md（长期）+ 每日笔记
 // 这是 Agent 的"记忆系统"，允许它记住重要信息并回顾历史
 type MemoryStore struct {
-	memoryDir   string // 记忆目录路径
-	memoryFile  string // MEMORY.md 文件路径（长期记忆）
-	historyFile string // HISTORY.md 文件路径（历史日志）
+	memoryDir   string       // 记忆目录路径
+	memoryFile  string       // MEMORY.md 文件路径（长期记忆）
+	historyFile string       // HISTORY.md 文件路径（历史日志）
+	shared      *MemoryStore // 共享的全局记忆（只读加载到上下文，nil 表示没有）
 }
 
 // NewMemoryStore 创建一个新的记忆存储
@@ -53,6 +58,63 @@ func NewMemoryStore(workspace string) *MemoryStore {
 	}
 }
 
+// MemoryScopeFunc 根据聊天返回应使用的记忆存储
+type MemoryScopeFunc func(channel, chatID string) *MemoryStore
+
+// Scoped 返回某个会话专属的记忆存储（memory/<会话>/）
+// 参数：
+//   - sessionKey: 会话 key（例如 "telegram:123456"）
+//   - shared: 是否在上下文中同时加载全局的 MEMORY.md
+//
+// 返回：
+//   - 会话的记忆存储
+func (m *MemoryStore) Scoped(sessionKey string, shared bool) *MemoryStore {
+	memoryDir := filepath.Join(m.memoryDir, memoryNamespace(sessionKey))
+	os.MkdirAll(memoryDir, 0755)
+
+	scoped := &MemoryStore{
+		memoryDir:   memoryDir,
+		memoryFile:  filepath.Join(memoryDir, "MEMORY.md"),
+		historyFile: filepath.Join(memoryDir, "HISTORY.md"),
+	}
+	if shared {
+		scoped.shared = m
+	}
+	return scoped
+}
+
+// Dir 返回记忆目录路径
+func (m *MemoryStore) Dir() string {
+	return m.memoryDir
+}
+
+// SharedDir 返回共享的全局记忆目录，没有共享记忆时返回空字符串
+func (m *MemoryStore) SharedDir() string {
+	if m.shared == nil {
+		return ""
+	}
+	return m.shared.memoryDir
+}
+
+// memoryNamespace 把会话 key 转换为安全的目录名
+// 只保留字母、数字、连字符、下划线和点号，其他字符替换为下划线
+func memoryNamespace(key string) string {
+	var sb strings.Builder
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	name := strings.Trim(sb.String(), ".")
+	if name == "" {
+		name = "_"
+	}
+	return name
+}
+
 // GetTodayFile 获取今天的笔记文件路径
 // 格式：memory/YYYY-MM-DD.md
 func (m *MemoryStore) GetTodayFile() string {
@@ -179,6 +241,13 @@ func (m *MemoryStore) ListMemoryFiles() []string {
 func (m *MemoryStore) GetMemoryContext() string {
 	var parts []string
 
+	// 共享的全局记忆（按聊天隔离时）
+	if m.shared != nil {
+		if shared := m.shared.ReadLongTerm(); shared != "" {
+			parts = append(parts, "## Shared Memory\n"+shared)
+		}
+	}
+
 	// 长期记忆
 	longTerm := m.ReadLongTerm()
 	if longTerm != "" {
@@ -0,0 +1,36 @@
+package agent
+
+// observe.go - 旁听模式
+// 频道配置为 mode: observe 时，群聊中没有 @机器人 的消息带有 bus.ObserveKey 标记。
+// 这些消息只按发送者和时间记入会话历史（随后和普通对话一样参与记忆整理），不调用模型、不回复；
+// 之后有人 @机器人 提问（例如"昨天 Alice 说了什么？"）时，模型可以从历史和记忆中找到它们。
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+)
+
+// observeMessage 把旁听到的消息记入会话历史
+func (a *AgentLoop) observeMessage(msg bus.InboundMessage) {
+	key := sessionKeyFor(msg)
+	sess := a.sessions.GetOrCreate(key)
+	sess.AddMessage("user", observedContent(msg), nil)
+	a.sessions.Save(sess)
+	a.ConsolidateIfNeeded(key, sess)
+}
+
+// observedContent 为旁听到的消息加上时间和发送者，例如
+// "[Observed group message | 2026-01-02 15:04 | Alice] 明天的会改到下午"
+func observedContent(msg bus.InboundMessage) string {
+	at := msg.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+	sender, _ := msg.Metadata[bus.SenderNameKey].(string)
+	if sender == "" {
+		sender = msg.SenderID
+	}
+	return fmt.Sprintf("[Observed group message | %s | %s] %s", at.Format("2006-01-02 15:04"), sender, msg.Content)
+}
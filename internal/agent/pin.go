@@ -0,0 +1,105 @@
+package agent
+
+// pin.go - 固定内容
+// /pin 和 pin 工具把长期有效的指示保存在会话元数据中，ContextBuilder 每次都把它们放在上下文靠前的位置，
+// 不会随着历史消息超出 memoryWindow 而丢失。/new 开始新会话时保留固定内容。
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/i18n"
+	"github.com/Ailoc/nanogrip/internal/session"
+	"github.com/Ailoc/nanogrip/internal/tools"
+)
+
+// sessionPinsKey 会话元数据中保存固定内容的键
+const sessionPinsKey = "pinned"
+
+// sessionPins 返回会话的固定内容
+// 从磁盘重新加载的会话中，列表被 JSON 解码为 []interface{}
+func sessionPins(sess *session.Session) []string {
+	if sess == nil {
+		return nil
+	}
+	switch pins := sess.Metadata[sessionPinsKey].(type) {
+	case []string:
+		return pins
+	case []interface{}:
+		result := make([]string, 0, len(pins))
+		for _, pin := range pins {
+			if text, ok := pin.(string); ok && text != "" {
+				result = append(result, text)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// setSessionPins 替换会话的固定内容（列表为空时删除元数据）
+func setSessionPins(sess *session.Session, pins []string) {
+	if len(pins) == 0 {
+		delete(sess.Metadata, sessionPinsKey)
+		return
+	}
+	sess.Metadata[sessionPinsKey] = pins
+}
+
+// Pins 返回聊天的固定内容（实现 tools.PinStore）
+func (a *AgentLoop) Pins(channel, chatID string) []string {
+	return sessionPins(a.sessions.GetOrCreate(channel + ":" + chatID))
+}
+
+// SetPins 替换聊天的固定内容并保存会话（实现 tools.PinStore）
+func (a *AgentLoop) SetPins(channel, chatID string, pins []string) error {
+	sess := a.sessions.GetOrCreate(channel + ":" + chatID)
+	setSessionPins(sess, pins)
+	return a.sessions.Save(sess)
+}
+
+// pinCommand 处理 /pin 命令
+// 参数:
+//
+//	args: 空表示列出固定内容；remove <序号> 删除一条；clear 全部清除；其他内容作为新的固定内容
+func (a *AgentLoop) pinCommand(sess *session.Session, args string, lang string) string {
+	pins := sessionPins(sess)
+	fields := strings.Fields(args)
+
+	switch {
+	case len(fields) == 0:
+		if len(pins) == 0 {
+			return i18n.T(lang, "pin_none")
+		}
+		return i18n.T(lang, "pin_list", tools.FormatPins(pins))
+
+	case fields[0] == "clear" && len(fields) == 1:
+		setSessionPins(sess, nil)
+		a.sessions.Save(sess)
+		return i18n.T(lang, "pin_cleared")
+
+	case fields[0] == "remove":
+		if len(fields) != 2 {
+			return i18n.T(lang, "pin_usage")
+		}
+		index, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return i18n.T(lang, "pin_usage")
+		}
+		updated, err := tools.RemovePin(pins, index)
+		if err != nil {
+			return "❌ " + err.Error()
+		}
+		setSessionPins(sess, updated)
+		a.sessions.Save(sess)
+		return i18n.T(lang, "pin_removed", truncateRunes(pins[index-1], 80))
+	}
+
+	updated, err := tools.AddPin(pins, args)
+	if err != nil {
+		return "❌ " + err.Error()
+	}
+	setSessionPins(sess, updated)
+	a.sessions.Save(sess)
+	return i18n.T(lang, "pin_added", tools.FormatPins(updated))
+}
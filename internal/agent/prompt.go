@@ -0,0 +1,90 @@
+package agent
+
+// prompt.go - 系统提示词模板
+// 核心身份部分（getIdentity）由 Go 模板（text/template）生成。
+// 内置模板 prompts/system.md 打包进二进制文件；工作区中存在 prompts/system.md 时优先使用它，
+// 每个 Agent 有自己的工作区，因此可以为不同的 Agent 定制不同的模板，修改后下一条消息即生效，无需重新编译。
+//
+// 模板可以使用的变量：
+//   - {{.Time}}: 当前时间（如 "2026-01-02 15:04 (Friday)"），{{.Timezone}}: 时区缩写
+//   - {{.Workspace}}: 工作区路径，{{.MemoryDir}}: 记忆目录
+//   - {{.Runtime}}: 运行环境（如 "linux amd64"）
+//   - {{.Skills}}: 可用技能摘要（与 Skills 部分相同）
+//
+// 注意：使用 {{.Time}} 会让系统提示词每分钟都变化，无法利用提示词缓存（内置模板不使用它，当前时间由 buildRuntimeContext 提供）。
+
+import (
+	_ "embed"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SystemTemplatePath 是工作区中自定义系统提示词模板的相对路径
+const SystemTemplatePath = "prompts/system.md"
+
+//go:embed prompts/system.md
+var defaultSystemTemplate string
+
+// promptData 是渲染系统提示词模板时可以使用的变量
+type promptData struct {
+	Time      string
+	Timezone  string
+	Workspace string
+	MemoryDir string
+	Runtime   string
+	Skills    string
+}
+
+// DefaultSystemTemplate 返回内置的系统提示词模板（可以作为自定义模板的起点）
+func DefaultSystemTemplate() string {
+	return defaultSystemTemplate
+}
+
+// renderSystemTemplate 渲染系统提示词模板
+// 工作区中的模板无法解析或渲染时记录日志并使用内置模板
+func (cb *ContextBuilder) renderSystemTemplate(memoryDir string) string {
+	now := time.Now()
+	data := promptData{
+		Time:      now.Format("2006-01-02 15:04 (Monday)"),
+		Timezone:  now.Format("MST"),
+		Workspace: cb.workspace,
+		MemoryDir: memoryDir,
+		Runtime:   runtime.GOOS + " " + runtime.GOARCH,
+		Skills:    cb.skills.BuildSkillsSummary(),
+	}
+
+	path := filepath.Join(cb.workspace, SystemTemplatePath)
+	if content, err := os.ReadFile(path); err == nil {
+		rendered, err := renderTemplate(path, string(content), data)
+		if err == nil {
+			return rendered
+		}
+		log.Printf("[Prompt] 自定义系统提示词模板 %s 无效，使用内置模板: %v", path, err)
+	}
+
+	rendered, err := renderTemplate("system.md", defaultSystemTemplate, data)
+	if err != nil {
+		// 内置模板在编译时就已确定，出错说明模板本身有问题
+		log.Printf("[Prompt] 内置系统提示词模板无效: %v", err)
+		return defaultSystemTemplate
+	}
+	return rendered
+}
+
+// renderTemplate 解析并渲染一个模板
+func renderTemplate(name string, text string, data promptData) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
@@ -0,0 +1,84 @@
+package agent
+
+// ratelimit.go - 在 AgentLoop 之前检查限流和每日额度
+// 超出限制的消息不会调用模型，而是回复一条礼貌的提示（同一原因每分钟只提示一次）
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/ratelimit"
+)
+
+// usageSubject 是本回合 LLM 用量计入的发送者
+type usageSubject struct {
+	channel  string
+	senderID string
+}
+
+type usageSubjectKey struct{}
+
+// SetRateLimiter 设置限流器（多个 Agent 共享同一个限流器时额度合并计算）
+func (a *AgentLoop) SetRateLimiter(limiter *ratelimit.Limiter) {
+	a.limiter = limiter
+}
+
+// checkRateLimit 检查是否允许处理一条入站消息
+// 不允许时按需发送提示，返回 false；系统消息和命令不受限制
+func (a *AgentLoop) checkRateLimit(msg bus.InboundMessage) bool {
+	if !a.limiter.Enabled() || msg.Channel == "system" || strings.HasPrefix(msg.Content, "/") {
+		return true
+	}
+
+	decision := a.limiter.Allow(msg.Channel, msg.SenderID)
+	if decision.Allowed {
+		return true
+	}
+
+	log.Printf("[RateLimit] 拒绝 %s:%s (sender %s): %s", msg.Channel, msg.ChatID, msg.SenderID, decision.Reason)
+	if decision.Notify {
+		a.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:  msg.Channel,
+			ChatID:   msg.ChatID,
+			Content:  decision.Reason,
+			Metadata: msg.Metadata,
+		})
+	}
+	return false
+}
+
+// withUsageSubject 让本回合的 LLM 调用计入指定发送者的额度
+func withUsageSubject(ctx context.Context, msg bus.InboundMessage) context.Context {
+	if msg.Channel == "system" || msg.SenderID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, usageSubjectKey{}, usageSubject{channel: msg.Channel, senderID: msg.SenderID})
+}
+
+// recordUsage 记录一次 LLM 调用的用量
+func (a *AgentLoop) recordUsage(ctx context.Context, usage map[string]int) {
+	if !a.limiter.Enabled() {
+		return
+	}
+	subject, ok := ctx.Value(usageSubjectKey{}).(usageSubject)
+	if !ok {
+		return
+	}
+	tokens := usage["total_tokens"]
+	if tokens == 0 {
+		tokens = usage["prompt_tokens"] + usage["completion_tokens"]
+	}
+	a.limiter.RecordLLM(subject.channel, subject.senderID, tokens)
+}
+
+// usageReport 返回发送者当天的用量（用于 /status），未启用限流时返回空字符串
+func (a *AgentLoop) usageReport(msg bus.InboundMessage) string {
+	if !a.limiter.Enabled() || msg.SenderID == "" {
+		return ""
+	}
+	calls, tokens := a.limiter.Usage(msg.Channel, msg.SenderID)
+	return fmt.Sprintf("\nYour usage today: %d LLM calls, %d tokens", calls, tokens)
+}
@@ -0,0 +1,59 @@
+package agent
+
+// reasoning.go - 推理模型支持
+// 把配置中的 reasoning_effort / thinking 预算随请求上下文传给提供商，
+// 并把模型返回的推理内容写入日志或交给调用方（如 CLI 的折叠"思考"显示）
+
+import (
+	"context"
+	"log"
+
+	"github.com/Ailoc/nanogrip/internal/providers"
+)
+
+// reasoningLogLimit 日志中推理内容的最大长度（字符）
+const reasoningLogLimit = 2000
+
+// ReasoningHandler 接收一次 LLM 调用返回的推理内容
+type ReasoningHandler func(reasoning string)
+
+type reasoningHandlerKey struct{}
+
+// WithReasoningHandler 返回一个上下文，本回合每次 LLM 调用返回推理内容时都会调用 handler
+// 用于 CLI 显示模型的"思考"过程
+func WithReasoningHandler(ctx context.Context, handler ReasoningHandler) context.Context {
+	return context.WithValue(ctx, reasoningHandlerKey{}, handler)
+}
+
+// withReasoning 把当前的推理参数附加到上下文（未配置时原样返回）
+func (a *AgentLoop) withReasoning(ctx context.Context) context.Context {
+	a.settingsMu.RLock()
+	opts := a.reasoning
+	a.settingsMu.RUnlock()
+	if opts == (providers.ReasoningOptions{}) {
+		return ctx
+	}
+	return providers.WithReasoning(ctx, opts)
+}
+
+// handleReasoning 按配置记录推理内容，并交给上下文中的 ReasoningHandler
+func (a *AgentLoop) handleReasoning(ctx context.Context, resp *providers.LLMResponse) {
+	if resp == nil || resp.ReasoningContent == "" {
+		return
+	}
+
+	a.settingsMu.RLock()
+	logReasoning := a.logReasoning
+	a.settingsMu.RUnlock()
+	if logReasoning {
+		text := resp.ReasoningContent
+		if runes := []rune(text); len(runes) > reasoningLogLimit {
+			text = string(runes[:reasoningLogLimit]) + "..."
+		}
+		log.Printf("[Reasoning] %s", text)
+	}
+
+	if handler, ok := ctx.Value(reasoningHandlerKey{}).(ReasoningHandler); ok && handler != nil {
+		handler(resp.ReasoningContent)
+	}
+}
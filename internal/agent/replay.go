@@ -0,0 +1,189 @@
+package agent
+
+// replay.go - 回放记录的会话（nanogrip replay）
+// 用当前的系统提示词、工具定义和模型重新运行会话中的每个用户回合，对比新旧回复，
+// 用于调整提示词或升级模型时检查行为变化。
+//
+// 回放时工具不会真正执行：会话中记录了相同调用（工具名称和参数都相同）的结果时返回记录的结果，
+// 否则返回一条说明"回放中未执行"的占位结果。每个回合使用记录中的历史作为上下文，
+// 因此前面回合的回复变化不会影响后面的回合；回放不会修改会话和记忆。
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/session"
+)
+
+// ToolMock 在回放时代替真实的工具执行
+type ToolMock func(name string, args map[string]interface{}) string
+
+// toolMockKey 是 context 中保存 ToolMock 的键
+type toolMockKey struct{}
+
+// ReplayTurn 是回放中一个用户回合的结果
+type ReplayTurn struct {
+	Index    int      // 回合序号（从 1 开始）
+	User     string   // 用户消息
+	Recorded string   // 会话中记录的回复
+	Replayed string   // 当前提示词和模型生成的回复
+	Tools    []string // 回放时模型调用的工具
+	Err      error    // 回放失败的原因
+}
+
+// Changed 判断回放的回复是否与记录不同（忽略首尾空白）
+func (t ReplayTurn) Changed() bool {
+	return strings.TrimSpace(t.Recorded) != strings.TrimSpace(t.Replayed)
+}
+
+// Replay 回放会话中的所有用户回合
+// 参数:
+//
+//	ctx: 上下文
+//	sess: 要回放的会话
+//	onTurn: 每个回合完成时调用（可以为 nil），用于边回放边输出
+//
+// 返回:
+//
+//	每个回合的结果
+func (a *AgentLoop) Replay(ctx context.Context, sess *session.Session, onTurn func(ReplayTurn)) []ReplayTurn {
+	channel, chatID := "cli", sess.Key
+	if idx := strings.Index(sess.Key, ":"); idx != -1 {
+		channel, chatID = sess.Key[:idx], sess.Key[idx+1:]
+	}
+
+	messages := sess.Messages
+	recorded := recordedToolResults(messages)
+	loc, _ := a.sessionTimezone(sess)
+
+	var turns []ReplayTurn
+	for i, m := range messages {
+		if m.Role != "user" {
+			continue
+		}
+
+		turn := ReplayTurn{Index: len(turns) + 1, User: m.Content}
+		// 记录的回复：下一条没有工具调用的助手消息
+		for _, next := range messages[i+1:] {
+			if next.Role == "user" {
+				break
+			}
+			if next.Role == "assistant" && len(next.ToolCalls) == 0 {
+				turn.Recorded = next.Content
+				break
+			}
+		}
+
+		// 使用记录中的历史（而不是回放生成的回复）作为上下文
+		history := session.NewSession(sess.Key)
+		history.Messages = messages[:i]
+
+		mock := func(name string, args map[string]interface{}) string {
+			turn.Tools = append(turn.Tools, name)
+			if result, ok := recorded[toolCallKey(name, args)]; ok {
+				return result
+			}
+			return fmt.Sprintf("[replay] Tool '%s' was not executed during replay and no recorded result is available.", name)
+		}
+		turnCtx := context.WithValue(ctx, toolMockKey{}, ToolMock(mock))
+
+		built := a.contextBuilder.BuildMessages(history.GetHistory(a.memoryWindow), m.Content, channel, chatID, m.Media, sessionPins(sess), loc)
+		turn.Replayed, turn.Err = a.runAgentLoop(turnCtx, built)
+
+		turns = append(turns, turn)
+		if onTurn != nil {
+			onTurn(turn)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return turns
+}
+
+// executeTool 执行一次工具调用（回放时由 context 中的 ToolMock 代替）
+func (a *AgentLoop) executeTool(ctx context.Context, name string, args map[string]interface{}) string {
+	if mock, ok := ctx.Value(toolMockKey{}).(ToolMock); ok {
+		return mock(name, args)
+	}
+	return executeTool(ctx, a.toolsFor(ctx), name, args, &a.toolStats).Content
+}
+
+// recordedToolResults 从会话中收集工具调用的结果，键为工具名称和参数
+func recordedToolResults(messages []session.Message) map[string]string {
+	calls := make(map[string]string) // 调用 ID -> 键
+	results := make(map[string]string)
+	for _, m := range messages {
+		for _, tc := range m.ToolCalls {
+			var args map[string]interface{}
+			json.Unmarshal([]byte(tc.Function.Arguments), &args)
+			calls[tc.ID] = toolCallKey(tc.Function.Name, args)
+		}
+		if m.Role == "tool" {
+			if key, ok := calls[m.ToolCallID]; ok {
+				results[key] = m.Content
+			}
+		}
+	}
+	return results
+}
+
+// toolCallKey 返回工具调用的匹配键（参数按 JSON 序列化，键已排序）
+func toolCallKey(name string, args map[string]interface{}) string {
+	clean := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		if k != "_raw" {
+			clean[k] = v
+		}
+	}
+	data, _ := json.Marshal(clean)
+	return name + "\x00" + string(data)
+}
+
+// LineDiff 逐行比较两段文本
+// 返回: 差异行，相同的行以 "  " 开头，删除的行以 "- " 开头，新增的行以 "+ " 开头
+func LineDiff(before, after string) []string {
+	a := strings.Split(strings.TrimSpace(before), "\n")
+	b := strings.Split(strings.TrimSpace(after), "\n")
+
+	// 最长公共子序列
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, "+ "+b[j])
+	}
+	return lines
+}
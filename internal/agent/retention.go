@@ -0,0 +1,94 @@
+package agent
+
+// retention.go - 会话过期归档
+//
+// 会话文件（workspace/sessions/*.jsonl）默认永久保留。设置保留策略后：
+//   - 启动时以及之后每天检查一次，找出超过 maxAge 未更新或超出 maxCount 的最旧会话
+//   - 删除前先把尚未整理的消息通过记忆整理流程提炼到 MEMORY.md 和 HISTORY.md
+//   - 提炼失败的会话保留到下一次检查，不会丢失内容
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// retentionInterval 是检查会话保留策略的间隔
+const retentionInterval = 24 * time.Hour
+
+// SetSessionRetention 设置会话保留策略
+// 必须在 Start 之前调用；两个参数都 <= 0 表示永久保留
+// 参数:
+//
+//	maxAge: 会话最长保留时间（按最后更新时间计算）
+//	maxCount: 最多保留的会话数量
+func (a *AgentLoop) SetSessionRetention(maxAge time.Duration, maxCount int) {
+	a.retainAge = maxAge
+	a.retainCount = maxCount
+}
+
+// retentionLoop 启动时和之后每天归档过期会话，直到 ctx 被取消
+func (a *AgentLoop) retentionLoop(ctx context.Context) {
+	a.ArchiveExpiredSessions(ctx)
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.ArchiveExpiredSessions(ctx)
+		}
+	}
+}
+
+// ArchiveExpiredSessions 归档并删除超出保留策略的会话
+// 返回:
+//
+//	被删除的会话数量
+func (a *AgentLoop) ArchiveExpiredSessions(ctx context.Context) int {
+	expired := a.sessions.Expired(a.retainAge, a.retainCount)
+	archived := 0
+	for _, key := range expired {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := a.archiveSession(key); err != nil {
+			log.Printf("[Sessions] 归档会话 %s 失败，下次重试: %v", key, err)
+			continue
+		}
+		archived++
+	}
+	if archived > 0 {
+		log.Printf("[Sessions] 已归档并删除 %d 个过期会话", archived)
+	}
+	return archived
+}
+
+// archiveSession 把会话中尚未整理的消息提炼到记忆文件，然后删除会话
+func (a *AgentLoop) archiveSession(key string) error {
+	// 正在整理记忆的会话留到下一次
+	a.consolidatingMu.Lock()
+	busy := a.consolidating[key]
+	if !busy {
+		a.consolidating[key] = true
+	}
+	a.consolidatingMu.Unlock()
+	if busy {
+		return nil
+	}
+	defer func() {
+		a.consolidatingMu.Lock()
+		delete(a.consolidating, key)
+		a.consolidatingMu.Unlock()
+	}()
+
+	sess := a.sessions.GetOrCreate(key)
+	if sess.LastConsolidated < len(sess.Messages) {
+		if err := a.summarizeToMemory(key, sess.Messages[sess.LastConsolidated:]); err != nil {
+			return err
+		}
+	}
+	return a.sessions.Delete(key)
+}
@@ -0,0 +1,279 @@
+// router.go - 多 Agent 路由
+//
+// 配置了 agents.instances 时，gateway 会运行多个 AgentLoop，每个都有自己的
+// 工作区、模型、工具和会话。Router 从消息总线消费入站消息，按以下顺序决定交给哪个 Agent：
+//  1. 子代理公告交给创建它的 Agent（元数据中的 "agent"）
+//  2. 用户通过 /agent <名称> 为该聊天选择的 Agent（持久化保存，重启后仍然有效）
+//  3. chatIds 匹配的 Agent
+//  4. channels 匹配的 Agent
+//  5. 默认 Agent（agents.defaults）
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/cron"
+)
+
+// DefaultAgentName 是默认 Agent（agents.defaults）的名称
+const DefaultAgentName = "default"
+
+// Route 描述一个 Agent 负责的频道和聊天
+type Route struct {
+	Channels []string // 该 Agent 负责的频道（例如 "telegram"）
+	ChatIDs  []string // 该 Agent 负责的聊天，可以写 "123" 或 "telegram:123"
+}
+
+// routedAgent 是 Router 中的一个 Agent
+type routedAgent struct {
+	name  string
+	loop  *AgentLoop
+	route Route
+}
+
+// Router 把入站消息分发给多个 AgentLoop
+type Router struct {
+	bus        *bus.MessageBus
+	agents     map[string]*routedAgent
+	order      []string          // Agent 名称（按添加顺序，默认 Agent 在最前）
+	selections map[string]string // "channel:chatID" -> 用户通过 /agent 选择的 Agent
+	path       string            // selections 的保存位置
+	mu         sync.RWMutex
+}
+
+// NewRouter 创建 Router
+// 参数:
+//
+//	msgBus: 消息总线
+//	defaultLoop: 默认 Agent，没有其他规则命中时使用
+//	statePath: 保存 /agent 选择的文件路径
+func NewRouter(msgBus *bus.MessageBus, defaultLoop *AgentLoop, statePath string) *Router {
+	r := &Router{
+		bus:        msgBus,
+		agents:     make(map[string]*routedAgent),
+		selections: make(map[string]string),
+		path:       statePath,
+	}
+	r.add(DefaultAgentName, defaultLoop, Route{})
+	r.load()
+	return r
+}
+
+// Add 添加一个命名 Agent
+// 必须在 Agent 的 Start 之前调用，Agent 之后只从 Router 接收消息
+func (r *Router) Add(name string, loop *AgentLoop, route Route) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.agents[name]; exists {
+		return fmt.Errorf("duplicate agent name %q", name)
+	}
+	r.add(name, loop, route)
+	return nil
+}
+
+func (r *Router) add(name string, loop *AgentLoop, route Route) {
+	loop.inbox = make(chan bus.InboundMessage, 100)
+	r.agents[name] = &routedAgent{name: name, loop: loop, route: route}
+	r.order = append(r.order, name)
+}
+
+// Names 返回所有 Agent 的名称
+func (r *Router) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.order...)
+}
+
+// Run 从消息总线消费入站消息并分发，直到 ctx 被取消
+func (r *Router) Run(ctx context.Context) {
+	for {
+		msg, err := r.bus.ConsumeInbound(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		if strings.HasPrefix(msg.Content, "/agent") && (len(msg.Content) == len("/agent") || msg.Content[len("/agent")] == ' ') {
+			r.handleCommand(msg)
+			r.bus.MarkProcessed(msg)
+			continue
+		}
+
+		target := r.agentFor(msg)
+		select {
+		case target.loop.inbox <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// agentFor 选择处理消息的 Agent
+func (r *Router) agentFor(msg bus.InboundMessage) *routedAgent {
+	if name, ok := msg.Metadata["agent"].(string); ok {
+		r.mu.RLock()
+		target := r.agents[name]
+		r.mu.RUnlock()
+		if target != nil {
+			return target
+		}
+	}
+
+	channel, chatID := msg.Channel, msg.ChatID
+	if channel == "system" {
+		// 系统消息的 chat_id 是 "channel:chat_id"
+		if idx := strings.Index(chatID, ":"); idx != -1 {
+			channel, chatID = chatID[:idx], chatID[idx+1:]
+		}
+	}
+	return r.resolve(channel, chatID)
+}
+
+// Resolve 返回负责指定聊天的 Agent 名称
+func (r *Router) Resolve(channel, chatID string) string {
+	return r.resolve(channel, chatID).name
+}
+
+func (r *Router) resolve(channel, chatID string) *routedAgent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if name, ok := r.selections[channel+":"+chatID]; ok {
+		if target := r.agents[name]; target != nil {
+			return target
+		}
+	}
+	for _, name := range r.order {
+		for _, id := range r.agents[name].route.ChatIDs {
+			if id == chatID || id == channel+":"+chatID {
+				return r.agents[name]
+			}
+		}
+	}
+	for _, name := range r.order {
+		for _, ch := range r.agents[name].route.Channels {
+			if ch == channel {
+				return r.agents[name]
+			}
+		}
+	}
+	return r.agents[DefaultAgentName]
+}
+
+// handleCommand 处理 /agent 命令
+//
+//	/agent           查看当前 Agent 和所有可用的 Agent
+//	/agent <名称>    切换当前聊天使用的 Agent
+//	/agent reset     取消选择，恢复按配置路由
+func (r *Router) handleCommand(msg bus.InboundMessage) {
+	arg := strings.TrimSpace(strings.TrimPrefix(msg.Content, "/agent"))
+	key := msg.Channel + ":" + msg.ChatID
+
+	var reply string
+	switch {
+	case arg == "":
+		current := r.Resolve(msg.Channel, msg.ChatID)
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("Current agent: %s\nAvailable agents:\n", current))
+		for _, name := range r.Names() {
+			model, _, _ := r.agents[name].loop.ModelSettings()
+			marker := "  "
+			if name == current {
+				marker = "▶ "
+			}
+			sb.WriteString(fmt.Sprintf("%s%s (%s)\n", marker, name, model))
+		}
+		sb.WriteString("Switch with /agent <name>, or /agent reset to use the configured routing.")
+		reply = sb.String()
+
+	case arg == "reset":
+		r.mu.Lock()
+		delete(r.selections, key)
+		r.mu.Unlock()
+		r.save()
+		reply = fmt.Sprintf("Agent selection cleared. This chat now uses: %s", r.Resolve(msg.Channel, msg.ChatID))
+
+	default:
+		r.mu.Lock()
+		_, exists := r.agents[arg]
+		if exists {
+			r.selections[key] = arg
+		}
+		r.mu.Unlock()
+		if !exists {
+			reply = fmt.Sprintf("Unknown agent %q. Available: %s", arg, strings.Join(r.Names(), ", "))
+			break
+		}
+		r.save()
+		log.Printf("[Router] %s 切换到 Agent %s", key, arg)
+		reply = fmt.Sprintf("Switched to agent: %s", arg)
+	}
+
+	r.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:  msg.Channel,
+		ChatID:   msg.ChatID,
+		Content:  reply,
+		Metadata: msg.Metadata,
+	})
+}
+
+// ProcessDirect 使用默认 Agent 直接处理消息（实现 cron.AgentExecutor）
+func (r *Router) ProcessDirect(ctx context.Context, message string) (string, error) {
+	return r.agents[DefaultAgentName].loop.ProcessDirect(ctx, message)
+}
+
+// ProcessDirectWithContext 使用负责该聊天的 Agent 直接处理消息（实现 cron.AgentExecutor）
+// 这样在某个 Agent 中创建的定时任务到期时仍由该 Agent 执行
+func (r *Router) ProcessDirectWithContext(ctx context.Context, channel, chatID, message string) (string, error) {
+	return r.resolve(channel, chatID).loop.ProcessDirectWithContext(ctx, channel, chatID, message)
+}
+
+// ProcessDirectWithPermissions 使用负责该聊天的 Agent 以受限的工具权限处理消息（实现 cron.AgentExecutor）
+func (r *Router) ProcessDirectWithPermissions(ctx context.Context, channel, chatID, message string, perms cron.Permissions) (string, error) {
+	return r.resolve(channel, chatID).loop.ProcessDirectWithPermissions(ctx, channel, chatID, message, perms)
+}
+
+// SetToolContext 设置负责该聊天的 Agent 的工具上下文（实现 cron.AgentExecutor）
+func (r *Router) SetToolContext(channel, chatID string) {
+	r.resolve(channel, chatID).loop.SetToolContext(channel, chatID)
+}
+
+// load 读取保存的 /agent 选择
+func (r *Router) load() {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &r.selections); err != nil {
+		log.Printf("[Router] 读取 %s 失败: %v", r.path, err)
+		r.selections = make(map[string]string)
+	}
+}
+
+// save 保存 /agent 选择
+func (r *Router) save() {
+	r.mu.RLock()
+	data, err := json.MarshalIndent(r.selections, "", "  ")
+	r.mu.RUnlock()
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		log.Printf("[Router] 保存 Agent 选择失败: %v", err)
+		return
+	}
+	if err := os.WriteFile(r.path, data, 0644); err != nil {
+		log.Printf("[Router] 保存 Agent 选择失败: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package agent
+
+// routing.go - 按请求的复杂度选择模型（agents.routing）
+// 简单的请求（问候、简短的问答）交给便宜、快速的模型，需要多步操作的复杂任务仍使用主模型。
+// 先用启发式规则判断：附件、长消息、多行内容、代码块、链接和任务类关键词都视为复杂；
+// 启用 Classifier 后，启发式判断为简单的消息再让快速模型做一次很短的分类调用确认。
+// 会话通过 /model 切换了模型时不做路由；无法判断时一律使用主模型。
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/providers"
+	"github.com/Ailoc/nanogrip/internal/session"
+	"github.com/Ailoc/nanogrip/internal/trace"
+)
+
+const (
+	// classifyTimeout 分类调用的超时时间，超时视为复杂
+	classifyTimeout = 10 * time.Second
+	// classifyContextChars 分类时附带的上一条助手回复的最多字符数
+	classifyContextChars = 500
+	// maxRequestLines 超过该行数的消息视为复杂（通常是任务清单或粘贴的内容）
+	maxRequestLines = 3
+)
+
+// RoutingOptions 描述按复杂度选择模型的方式
+type RoutingOptions struct {
+	Provider   providers.LLMProvider // 简单请求使用的提供商（nil 表示使用主提供商）
+	Model      string                // 简单请求使用的模型（为空表示不路由）
+	MaxChars   int                   // 超过该字符数的消息视为复杂（<= 0 表示不按长度判断）
+	Keywords   []string              // 包含任一关键词（不区分大小写）的消息视为复杂
+	Classifier bool                  // 启发式判断为简单时，再用快速模型分类确认
+}
+
+// routingStats 统计路由的结果（用于 /status）
+type routingStats struct {
+	simple  atomic.Int64
+	complex atomic.Int64
+}
+
+// providerOverrideKey 是本回合使用的提供商在 context 中的键
+type providerOverrideKey struct{}
+
+// SetRouting 设置按复杂度选择模型的方式（可以在运行中调用，下一条消息生效）
+// 快速模型同时用于 spawn 指定 model 为 "fast" 的子代理
+func (a *AgentLoop) SetRouting(opts RoutingOptions) {
+	a.settingsMu.Lock()
+	a.routing = opts
+	a.settingsMu.Unlock()
+	if a.subagents != nil {
+		a.subagents.SetFastModel(opts.Provider, opts.Model)
+	}
+}
+
+// routeModel 为一条用户消息选择模型：简单的请求改用快速模型
+// 返回的 ctx 携带选择的模型和提供商（使用主模型时原样返回）
+func (a *AgentLoop) routeModel(ctx context.Context, msg bus.InboundMessage, sess *session.Session) context.Context {
+	a.settingsMu.RLock()
+	opts := a.routing
+	a.settingsMu.RUnlock()
+	if opts.Model == "" {
+		return ctx
+	}
+	if _, ok := ctx.Value(modelOverrideKey{}).(string); ok {
+		return ctx
+	}
+
+	if !simpleRequest(opts, msg) || (opts.Classifier && !a.classifySimple(ctx, opts, msg.Content, sess)) {
+		a.routingStats.complex.Add(1)
+		return ctx
+	}
+	a.routingStats.simple.Add(1)
+	trace.Logf(ctx, "[Router] 简单请求，使用 %s", opts.Model)
+
+	ctx = context.WithValue(ctx, modelOverrideKey{}, opts.Model)
+	if opts.Provider != nil {
+		ctx = context.WithValue(ctx, providerOverrideKey{}, opts.Provider)
+	}
+	return ctx
+}
+
+// providerFor 返回本回合使用的提供商（路由到快速模型时可能不是主提供商）
+func (a *AgentLoop) providerFor(ctx context.Context) providers.LLMProvider {
+	if provider, ok := ctx.Value(providerOverrideKey{}).(providers.LLMProvider); ok {
+		return provider
+	}
+	return a.provider
+}
+
+// simpleRequest 用启发式规则判断消息是否是简单请求
+func simpleRequest(opts RoutingOptions, msg bus.InboundMessage) bool {
+	content := strings.TrimSpace(msg.Content)
+	if content == "" || len(msg.Media) > 0 {
+		return false
+	}
+	if opts.MaxChars > 0 && utf8.RuneCountInString(content) > opts.MaxChars {
+		return false
+	}
+	if strings.Count(content, "\n") >= maxRequestLines {
+		return false
+	}
+	if strings.Contains(content, "```") || strings.Contains(content, "http://") || strings.Contains(content, "https://") {
+		return false
+	}
+
+	lower := strings.ToLower(content)
+	for _, keyword := range opts.Keywords {
+		if keyword != "" && strings.Contains(lower, strings.ToLower(keyword)) {
+			return false
+		}
+	}
+	return true
+}
+
+// classifySimple 让快速模型判断消息是否可以直接回答
+// 附带上一条助手回复，避免把"好的，开始吧"之类对复杂任务的确认当作简单请求
+func (a *AgentLoop) classifySimple(ctx context.Context, opts RoutingOptions, content string, sess *session.Session) bool {
+	provider := opts.Provider
+	if provider == nil {
+		provider = a.provider
+	}
+
+	var prompt strings.Builder
+	if previous := lastAssistantMessage(sess); previous != "" {
+		if runes := []rune(previous); len(runes) > classifyContextChars {
+			previous = string(runes[:classifyContextChars]) + "…"
+		}
+		fmt.Fprintf(&prompt, "Previous assistant message:\n%s\n\n", previous)
+	}
+	fmt.Fprintf(&prompt, "User message:\n%s", content)
+
+	ctx, cancel := context.WithTimeout(ctx, classifyTimeout)
+	defer cancel()
+	resp, err := provider.Chat(ctx, []providers.Message{
+		{Role: "system", Content: "Classify the user's request. Reply SIMPLE if it can be answered directly in one short reply without tools (greetings, quick facts, short questions). Reply COMPLEX if it needs tools, several steps, research, code, files, scheduling or careful reasoning. Reply with one word."},
+		{Role: "user", Content: prompt.String()},
+	}, nil, opts.Model, 5, 0)
+	if err != nil {
+		log.Printf("[Router] 分类失败，使用主模型: %v", err)
+		return false
+	}
+	a.recordUsage(ctx, resp.Usage)
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(resp.Content)), "SIMPLE")
+}
+
+// lastAssistantMessage 返回会话中最后一条助手回复
+func lastAssistantMessage(sess *session.Session) string {
+	if sess == nil {
+		return ""
+	}
+	for i := len(sess.Messages) - 1; i >= 0; i-- {
+		if sess.Messages[i].Role == "assistant" && sess.Messages[i].Content != "" {
+			return sess.Messages[i].Content
+		}
+	}
+	return ""
+}
@@ -7,12 +7,16 @@
 // 2. 专注单一任务 - 每个子代理只负责完成被分配的特定任务
 // 3. 简化上下文 - 子代理有自己的系统提示词，不访问主会话历史
 // 4. 结果通知 - 完成后通过消息总线发送结果给主 Agent
+// 5. 结构化结果 - 状态、摘要、生成的文件和统计保存在子工作区的 result.json 中，也放在结果公告的消息元数据中
 //
 // 使用场景：
 // - 长时间运行的任务（如大型文件处理、网页爬取）
 // - 并行任务（同时进行多个独立的子任务）
 // - 后台监控（持续监控某些条件）
 //
+// 创建时可以指定模型（"fast" 表示 agents.routing 的快速模型）、可用工具的子集和更短的运行时间上限，
+// 例如并行启动多个使用快速模型、只能搜索网页的调研子代理。
+//
 // 限制：
 // - 子代理不能发送消息给用户（没有 message 工具）
 // - 子代理不能再创建其他子代理
@@ -22,9 +26,13 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -32,6 +40,7 @@ import (
 	"github.com/Ailoc/nanogrip/internal/providers"
 	"github.com/Ailoc/nanogrip/internal/skills"
 	"github.com/Ailoc/nanogrip/internal/tools"
+	"github.com/google/uuid"
 )
 
 // SubagentManager 管理后台子代理的执行
@@ -47,7 +56,16 @@ type SubagentManager struct {
 	toolRegistry      *tools.ToolRegistry      // 工具注册表
 	skillsLoader      *skills.SkillsLoader     // 技能加载器
 	runningTasks      map[string]*subagentTask // 正在运行的任务映射
-	runningTasksMutex sync.Mutex               // 任务映射的互斥锁
+	finishedTasks     []tools.SubagentInfo     // 最近结束的任务（最多 maxFinishedTasks 个，最新的在最后）
+	runningTasksMutex sync.Mutex               // 任务映射的互斥锁（同时保护 finishedTasks 和任务进度）
+	settingsMu        sync.RWMutex             // 保护 model、maxTokens 和 temperature
+	agentName         string                   // 所属 Agent 的名称（多 Agent 时用于把结果路由回该 Agent）
+	maxConcurrent     int                      // 同时运行的子代理上限（<= 0 表示不限制）
+	timeout           time.Duration            // 单个子代理的运行时间上限（<= 0 表示不限制）
+
+	// 快速模型（agents.routing.model），spawn 的 model 参数为 "fast" 时使用（由 settingsMu 保护）
+	fastProvider providers.LLMProvider
+	fastModel    string
 }
 
 // subagentTask 表示一个子代理任务
@@ -58,8 +76,28 @@ type subagentTask struct {
 	Origin  originInfo         // 来源信息（用于发送结果）
 	Context context.Context    // 上下文（用于取消）
 	Cancel  context.CancelFunc // 取消函数
+
+	Started    time.Time     // 开始时间
+	Timeout    time.Duration // 运行时间上限（0 表示不限制）
+	Model      string        // 创建时指定的模型（为空表示默认模型）
+	Tools      []string      // 创建时指定的工具（为空表示全部）
+	Iterations int           // 已完成的 LLM 迭代次数
+	LastTool   string        // 最近一次调用的工具
+
+	ToolCalls        int // 已执行的工具调用次数
+	PromptTokens     int // 累计的输入令牌数
+	CompletionTokens int // 累计的输出令牌数
 }
 
+const (
+	// maxFinishedTasks 保留的已结束任务数量（供 subagents 工具和 /tasks 查询结果）
+	maxFinishedTasks = 20
+	// maxArtifacts 结构化结果中最多列出的生成文件数
+	maxArtifacts = 50
+	// resultFileName 子工作区中保存结构化结果的文件
+	resultFileName = "result.json"
+)
+
 // originInfo 记录任务的来源
 type originInfo struct {
 	Channel string // 来源频道
@@ -93,6 +131,72 @@ func NewSubagentManager(
 	}
 }
 
+// SetModelDefaults 更新子代理使用的模型、最大令牌数和温度参数
+// 运行中的子代理从下一次 LLM 调用开始使用新设置
+func (s *SubagentManager) SetModelDefaults(model string, maxTokens int, temperature float64) {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	s.model = model
+	s.maxTokens = maxTokens
+	s.temperature = temperature
+}
+
+// SetLimits 设置并发数和运行时间上限
+// 可以在运行时调用（配置热重载），对之后创建的子代理生效
+// 参数：
+//   - maxConcurrent: 同时运行的子代理上限，<= 0 表示不限制
+//   - timeout: 单个子代理的运行时间上限，<= 0 表示不限制
+func (s *SubagentManager) SetLimits(maxConcurrent int, timeout time.Duration) {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	s.maxConcurrent = maxConcurrent
+	s.timeout = timeout
+}
+
+// SetFastModel 设置 spawn 的 model 参数为 "fast" 时使用的提供商和模型
+// 可以在运行时调用（配置热重载），对之后创建的子代理生效
+// 参数：
+//   - provider: 快速模型的提供商，为 nil 时使用主提供商
+//   - model: 快速模型，为空表示没有配置快速模型
+func (s *SubagentManager) SetFastModel(provider providers.LLMProvider, model string) {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	s.fastProvider = provider
+	s.fastModel = model
+}
+
+// resolveModel 把创建时指定的模型转换为提供商和模型名称
+// 返回的模型为空表示使用默认模型（每次调用 LLM 时读取，随配置热重载更新）
+func (s *SubagentManager) resolveModel(name string) (providers.LLMProvider, string, error) {
+	if name == "" || strings.EqualFold(name, "default") {
+		return s.provider, "", nil
+	}
+	if !strings.EqualFold(name, tools.FastModel) && !strings.EqualFold(name, "cheap") {
+		return s.provider, name, nil
+	}
+
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	if s.fastModel == "" {
+		return nil, "", fmt.Errorf("no fast model is configured (agents.routing.model); omit model to use the default model")
+	}
+	if s.fastProvider != nil {
+		return s.fastProvider, s.fastModel, nil
+	}
+	return s.provider, s.fastModel, nil
+}
+
+// InvalidateSkills 清空子代理的技能缓存（技能文件被修改后调用）
+func (s *SubagentManager) InvalidateSkills() {
+	s.skillsLoader.Invalidate()
+}
+
+// SetAgentName 设置所属 Agent 的名称
+// 子代理的结果公告会带上该名称，Router 据此交给创建它的 Agent 处理
+func (s *SubagentManager) SetAgentName(name string) {
+	s.agentName = name
+}
+
 // Spawn 创建一个子代理在后台执行任务
 // 这个方法会：
 // 1. 生成唯一的任务 ID
@@ -102,15 +206,15 @@ func NewSubagentManager(
 //
 // 参数：
 //   - task: 任务描述（告诉子代理要做什么）
-//   - label: 任务标签（可选，用于显示）
+//   - opts: 任务标签、模型、可用工具和运行时间上限（均可选）
 //   - originChannel: 来源频道
 //   - originChatID: 来源聊天 ID
 //
 // 返回：
-//   - 确认消息，包含任务 ID
+//   - 确认消息，包含任务 ID；无法创建时说明原因
 func (s *SubagentManager) Spawn(
 	task string,
-	label string,
+	opts tools.SpawnOptions,
 	originChannel string,
 	originChatID string,
 ) string {
@@ -119,11 +223,42 @@ func (s *SubagentManager) Spawn(
 	if len(displayLabel) > 30 {
 		displayLabel = displayLabel[:30] + "..."
 	}
-	if label != "" {
-		displayLabel = label
+	if opts.Label != "" {
+		displayLabel = opts.Label
+	}
+
+	provider, model, err := s.resolveModel(opts.Model)
+	if err != nil {
+		return fmt.Sprintf("Cannot start subagent [%s]: %v", displayLabel, err)
+	}
+	// 子代理只能使用调用者的注册表视图中的工具（按聊天的 tools.scopes 或定时任务的权限受限时）
+	available := s.toolRegistry
+	if opts.Registry != nil {
+		available = opts.Registry
+	}
+	registry := available
+	var toolNames []string
+	if len(opts.Tools) > 0 {
+		registry = available.Scoped(tools.Scope{Allow: opts.Tools})
+		if registry.Len() == 0 {
+			return fmt.Sprintf("Cannot start subagent [%s]: none of the tools %s are available. Available tools: %s",
+				displayLabel, strings.Join(opts.Tools, ", "), strings.Join(available.ToolNames(), ", "))
+		}
+		toolNames = registry.ToolNames()
+	}
+
+	// 指定的运行时间上限只能比配置的更短
+	s.settingsMu.RLock()
+	maxConcurrent, timeout := s.maxConcurrent, s.timeout
+	s.settingsMu.RUnlock()
+	if opts.Timeout > 0 && (timeout <= 0 || opts.Timeout < timeout) {
+		timeout = opts.Timeout
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
 
 	subtask := &subagentTask{
 		ID:      taskID,
@@ -132,17 +267,37 @@ func (s *SubagentManager) Spawn(
 		Origin:  originInfo{Channel: originChannel, ChatID: originChatID},
 		Context: ctx,
 		Cancel:  cancel,
+		Started: time.Now(),
+		Timeout: timeout,
+		Model:   model,
+		Tools:   toolNames,
 	}
 
 	s.runningTasksMutex.Lock()
+	if running := len(s.runningTasks); maxConcurrent > 0 && running >= maxConcurrent {
+		s.runningTasksMutex.Unlock()
+		cancel()
+		log.Printf("Subagent limit reached (%d), refusing to spawn: %s", maxConcurrent, displayLabel)
+		return fmt.Sprintf("Cannot start subagent [%s]: %d subagents are already running (limit %d). Wait for one to finish, or cancel one with the subagents tool, then try again.", displayLabel, running, maxConcurrent)
+	}
 	s.runningTasks[taskID] = subtask
 	s.runningTasksMutex.Unlock()
 
 	// 在后台运行子代理
-	go s.runSubagent(ctx, taskID, displayLabel, task, originChannel, originChatID)
+	go s.runSubagent(ctx, taskID, displayLabel, task, originChannel, originChatID, provider, model, registry)
 
 	log.Printf("Spawned subagent [%s]: %s", taskID, displayLabel)
-	return fmt.Sprintf("Subagent [%s] started (id: %s). I'll notify you when it completes.", displayLabel, taskID)
+	reply := fmt.Sprintf("Subagent [%s] started (id: %s", displayLabel, taskID)
+	if model != "" {
+		reply += ", model: " + model
+	}
+	if toolNames != nil {
+		reply += ", tools: " + strings.Join(toolNames, ", ")
+	}
+	if timeout > 0 {
+		reply += ", time limit: " + timeout.String()
+	}
+	return reply + "). I'll notify you when it completes."
 }
 
 // runSubagent 执行子代理任务
@@ -152,6 +307,8 @@ func (s *SubagentManager) Spawn(
 // 3. 处理错误或成功完成
 // 4. 通过消息总线发送结果
 // 5. 清理任务记录
+//
+// provider、model 和 registry 是创建时选择的提供商、模型（为空表示默认模型）和工具注册表
 func (s *SubagentManager) runSubagent(
 	ctx context.Context,
 	taskID string,
@@ -159,11 +316,23 @@ func (s *SubagentManager) runSubagent(
 	task string,
 	originChannel string,
 	originChatID string,
+	provider providers.LLMProvider,
+	model string,
+	registry *tools.ToolRegistry,
 ) {
 	log.Printf("Subagent [%s] starting task: %s", taskID, label)
 
+	// 无论成功还是失败，结束时都清理任务记录，避免注册表无限增长
+	// （正常结束时 finish 已经移除了任务，这里只处理 panic 等意外退出）
+	defer s.finish(taskID, "error", "Subagent exited unexpectedly")
+
 	// 构建子代理的消息（使用专用的系统提示词）
 	systemPrompt := s.buildSubagentPrompt(task, taskID)
+	if registry != s.toolRegistry {
+		// 只给了部分工具时，提示词中说明（上面的 What You Can Do 按全部工具描述）
+		systemPrompt += "\n\n## Available Tools\nYou were given only these tools: " + strings.Join(registry.ToolNames(), ", ") +
+			". Ignore any capability above that needs other tools."
+	}
 	messages := []map[string]interface{}{
 		{"role": "system", "content": systemPrompt},
 		{"role": "user", "content": task},
@@ -234,7 +403,7 @@ func (s *SubagentManager) runSubagent(
 
 		// 获取工具定义
 		toolDefs := make([]providers.ToolDef, 0)
-		for _, t := range s.toolRegistry.GetDefinitions() {
+		for _, t := range registry.GetDefinitions() {
 			if fn, ok := t["function"].(map[string]interface{}); ok {
 				toolDefs = append(toolDefs, providers.ToolDef{
 					Type: "function",
@@ -248,13 +417,28 @@ func (s *SubagentManager) runSubagent(
 		}
 
 		// 调用 LLM
-		resp, err := s.provider.Chat(ctx, providerMessages, toolDefs, s.model, s.maxTokens, s.temperature)
+		s.settingsMu.RLock()
+		callModel, maxTokens, temperature := s.model, s.maxTokens, s.temperature
+		s.settingsMu.RUnlock()
+		if model != "" {
+			callModel = model
+		}
+		resp, err := provider.Chat(ctx, providerMessages, toolDefs, callModel, maxTokens, temperature)
 		if err != nil {
+			if ctx.Err() != nil {
+				s.interrupted(ctx, taskID, originChannel, originChatID)
+				return
+			}
 			log.Printf("Subagent [%s] error: %v", taskID, err)
-			s.announceResult(taskID, label, task, fmt.Sprintf("Error: %v", err), originChannel, originChatID, "error")
+			if result, ok := s.finish(taskID, "error", err.Error()); ok {
+				s.announceResult(result, originChannel, originChatID)
+			}
 			return
 		}
 
+		s.recordProgress(taskID, "")
+		s.recordUsage(taskID, resp.Usage)
+
 		// 处理工具调用
 		if resp.HasToolCalls() {
 			// 添加包含工具调用的助手消息
@@ -279,14 +463,19 @@ func (s *SubagentManager) runSubagent(
 
 			// 执行工具
 			for _, tc := range resp.ToolCalls {
-				result := s.toolRegistry.Execute(ctx, tc.Name, tc.Arguments)
+				s.recordProgress(taskID, tc.Name)
+				result := executeTool(ctx, registry, tc.Name, tc.Arguments, nil)
 				log.Printf("Subagent [%s] executed %s", taskID, tc.Name)
+				if ctx.Err() != nil {
+					s.interrupted(ctx, taskID, originChannel, originChatID)
+					return
+				}
 
 				messages = append(messages, map[string]interface{}{
 					"role":         "tool",
 					"tool_call_id": tc.ID,
 					"name":         tc.Name,
-					"content":      result,
+					"content":      result.Content,
 				})
 			}
 		} else {
@@ -301,41 +490,72 @@ func (s *SubagentManager) runSubagent(
 	}
 
 	log.Printf("Subagent [%s] completed successfully", taskID)
-	s.announceResult(taskID, label, task, finalResult, originChannel, originChatID, "ok")
+	if result, ok := s.finish(taskID, "ok", finalResult); ok {
+		s.announceResult(result, originChannel, originChatID)
+	}
+}
+
+// interrupted 处理被取消或超时的子代理
+// 超时时记录状态并把进度报告回来源聊天；被 CancelTask 取消时状态已经记录，不再通知主 Agent
+func (s *SubagentManager) interrupted(ctx context.Context, taskID, originChannel, originChatID string) {
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Printf("Subagent [%s] cancelled", taskID)
+		return
+	}
 
-	// 清理任务记录
 	s.runningTasksMutex.Lock()
-	delete(s.runningTasks, taskID)
+	running, ok := s.runningTasks[taskID]
+	var timeout time.Duration
+	var info tools.SubagentInfo
+	if ok {
+		timeout = running.Timeout
+		info = running.info("running")
+	}
 	s.runningTasksMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	result := fmt.Sprintf("The subagent was stopped after reaching its time limit of %s. It had completed %d LLM iteration(s)", timeout, info.Iterations)
+	if info.LastTool != "" {
+		result += fmt.Sprintf("; the last tool it called was %s", info.LastTool)
+	}
+	result += ". Any files it wrote are still in its subworkspace. Tell the user the task timed out and offer to retry it, split it up, or continue it directly."
+
+	log.Printf("Subagent [%s] timed out after %s", taskID, timeout)
+	if res, ok := s.finish(taskID, "timeout", result); ok {
+		s.announceResult(res, originChannel, originChatID)
+	}
 }
 
 // announceResult 宣布子代理的结果
 // 这个方法通过消息总线发送子代理的结果给主 Agent
-// 消息会自动路由回原始的频道和聊天
-func (s *SubagentManager) announceResult(
-	taskID string,
-	label string,
-	task string,
-	result string,
-	originChannel string,
-	originChatID string,
-	status string,
-) {
+// 消息会自动路由回原始的频道和聊天，结构化结果放在消息元数据中
+func (s *SubagentManager) announceResult(result tools.SubagentResult, originChannel string, originChatID string) {
 	statusText := "completed successfully"
-	if status == "error" {
+	switch result.Status {
+	case "error":
 		statusText = "failed"
+	case "timeout":
+		statusText = "timed out"
 	}
 
 	// 构建结果通知消息
 	// 子代理只向主 agent 报告任务执行结果，由主 agent 决定如何响应用户
-	announceContent := fmt.Sprintf(`[Subagent Task Report]
-Label: %s
-Status: %s
-
-Task: %s
-
-Result:
-%s`, label, statusText, task, result)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[Subagent Task Report]\nTask ID: %s\nLabel: %s\nStatus: %s\n\nTask: %s\n", result.TaskID, result.Label, statusText, result.Task)
+	if len(result.Artifacts) > 0 {
+		sb.WriteString("\nArtifacts:\n")
+		for _, artifact := range result.Artifacts {
+			fmt.Fprintf(&sb, "- %s (%d bytes)\n", artifact.Path, artifact.Size)
+		}
+	}
+	m := result.Metrics
+	fmt.Fprintf(&sb, "\nMetrics: %s, %d iteration(s), %d tool call(s)", (time.Duration(m.DurationMs) * time.Millisecond).Round(time.Second), m.Iterations, m.ToolCalls)
+	if m.Model != "" {
+		sb.WriteString(", model " + m.Model)
+	}
+	fmt.Fprintf(&sb, "\n\nResult:\n%s\n\nThe structured result is available with get_task_result (task_id %q).", result.Summary, result.TaskID)
 
 	// 通过消息总线发送结果
 	msg := bus.InboundMessage{
@@ -343,10 +563,14 @@ Result:
 			Channel:   "system",
 			SenderID:  "subagent",
 			ChatID:    originChannel + ":" + originChatID,
-			Content:   announceContent,
+			Content:   sb.String(),
 			Timestamp: time.Now(),
+			Metadata:  map[string]interface{}{tools.SubagentResultKey: result},
 		},
 	}
+	if s.agentName != "" {
+		msg.Metadata["agent"] = s.agentName
+	}
 
 	s.bus.PublishInbound(msg)
 }
@@ -360,7 +584,7 @@ Result:
 func (s *SubagentManager) buildSubagentPrompt(task string, taskID string) string {
 	now := time.Now().Format("2006-01-02 15:04 (Monday)")
 	tz := time.Now().Format("MST")
-	subworkspace := filepath.Join(s.workspace, "subworkspace", taskID)
+	subworkspace := s.subworkspace(taskID)
 
 	// 构建基础提示词
 	prompt := fmt.Sprintf(`# Subagent
@@ -444,15 +668,225 @@ func (s *SubagentManager) GetRunningCount() int {
 // CancelTask 取消正在运行的子代理
 // 返回 true 表示成功取消，false 表示任务不存在
 func (s *SubagentManager) CancelTask(taskID string) bool {
+	s.runningTasksMutex.Lock()
+	task, ok := s.runningTasks[taskID]
+	s.runningTasksMutex.Unlock()
+	if !ok {
+		return false
+	}
+	task.Cancel()
+	s.finish(taskID, "cancelled", "")
+	log.Printf("Subagent [%s] cancelled by request", taskID)
+	return true
+}
+
+// recordProgress 记录任务进度
+// 参数:
+//
+//	toolName: 即将执行的工具名称，为空表示完成了一次 LLM 迭代
+func (s *SubagentManager) recordProgress(taskID string, toolName string) {
 	s.runningTasksMutex.Lock()
 	defer s.runningTasksMutex.Unlock()
+	task, ok := s.runningTasks[taskID]
+	if !ok {
+		return
+	}
+	if toolName == "" {
+		task.Iterations++
+	} else {
+		task.LastTool = toolName
+		task.ToolCalls++
+	}
+}
 
+// recordUsage 累计任务的令牌用量
+func (s *SubagentManager) recordUsage(taskID string, usage map[string]int) {
+	s.runningTasksMutex.Lock()
+	defer s.runningTasksMutex.Unlock()
 	if task, ok := s.runningTasks[taskID]; ok {
-		task.Cancel()
-		delete(s.runningTasks, taskID)
-		return true
+		task.PromptTokens += usage["prompt_tokens"]
+		task.CompletionTokens += usage["completion_tokens"]
 	}
-	return false
+}
+
+// finish 把任务从运行列表移到最近结束列表，并把结构化结果保存到子工作区
+// 任务已经结束时不做任何事（例如取消后子代理才退出）
+// 返回:
+//
+//	任务的结构化结果；任务已经结束时第二个返回值为 false
+func (s *SubagentManager) finish(taskID string, status string, result string) (tools.SubagentResult, bool) {
+	s.runningTasksMutex.Lock()
+	task, ok := s.runningTasks[taskID]
+	if !ok {
+		s.runningTasksMutex.Unlock()
+		return tools.SubagentResult{}, false
+	}
+	delete(s.runningTasks, taskID)
+
+	info := task.info("")
+	info.Status = status
+	info.Result = result
+	info.Finished = time.Now()
+	s.finishedTasks = append(s.finishedTasks, info)
+	if len(s.finishedTasks) > maxFinishedTasks {
+		s.finishedTasks = s.finishedTasks[len(s.finishedTasks)-maxFinishedTasks:]
+	}
+	res := task.result(status, result, info.Finished)
+	s.runningTasksMutex.Unlock()
+
+	res.Artifacts = s.artifacts(taskID)
+	if err := s.saveResult(res); err != nil {
+		log.Printf("Subagent [%s] failed to save result: %v", taskID, err)
+	}
+	return res, true
+}
+
+// result 返回任务的结构化结果（不含生成的文件，调用者需持有 runningTasksMutex）
+// finished 为零值表示任务仍在运行，耗时计算到现在
+func (t *subagentTask) result(status, summary string, finished time.Time) tools.SubagentResult {
+	end := finished
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return tools.SubagentResult{
+		TaskID:   t.ID,
+		Label:    t.Label,
+		Task:     t.Task,
+		Status:   status,
+		Channel:  t.Origin.Channel,
+		ChatID:   t.Origin.ChatID,
+		Summary:  summary,
+		Started:  t.Started,
+		Finished: finished,
+		Metrics: tools.SubagentMetrics{
+			DurationMs:       end.Sub(t.Started).Milliseconds(),
+			Iterations:       t.Iterations,
+			ToolCalls:        t.ToolCalls,
+			PromptTokens:     t.PromptTokens,
+			CompletionTokens: t.CompletionTokens,
+			Model:            t.Model,
+		},
+	}
+}
+
+// subworkspace 返回任务的子工作区目录
+func (s *SubagentManager) subworkspace(taskID string) string {
+	return filepath.Join(s.workspace, "subworkspace", taskID)
+}
+
+// artifacts 列出任务在子工作区中生成的文件（不含 result.json，最多 maxArtifacts 个）
+func (s *SubagentManager) artifacts(taskID string) []tools.SubagentArtifact {
+	dir := s.subworkspace(taskID)
+	var artifacts []tools.SubagentArtifact
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if len(artifacts) >= maxArtifacts {
+			return filepath.SkipAll
+		}
+		if path == filepath.Join(dir, resultFileName) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			artifacts = append(artifacts, tools.SubagentArtifact{Path: path, Size: info.Size()})
+		}
+		return nil
+	})
+	return artifacts
+}
+
+// saveResult 把结构化结果写入子工作区的 result.json
+func (s *SubagentManager) saveResult(result tools.SubagentResult) error {
+	dir := s.subworkspace(result.TaskID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, resultFileName), data, 0644)
+}
+
+// TaskResult 返回指定任务的结构化结果（实现 tools.SubagentController）
+// 运行中的任务返回目前的统计和已生成的文件；已结束的任务从子工作区的 result.json 读取，重启后仍然可以查询
+// 结果带有任务的来源聊天（Channel、ChatID），调用者负责只把结果交给来源聊天
+func (s *SubagentManager) TaskResult(taskID string) (tools.SubagentResult, bool) {
+	if !generatedTaskID(taskID) {
+		return tools.SubagentResult{}, false
+	}
+
+	s.runningTasksMutex.Lock()
+	task, running := s.runningTasks[taskID]
+	var result tools.SubagentResult
+	if running {
+		result = task.result("running", "", time.Time{})
+	}
+	s.runningTasksMutex.Unlock()
+	if running {
+		result.Artifacts = s.artifacts(taskID)
+		return result, true
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.subworkspace(taskID), resultFileName))
+	if err != nil {
+		return tools.SubagentResult{}, false
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return tools.SubagentResult{}, false
+	}
+	return result, true
+}
+
+// info 返回任务的状态快照（调用者需持有 runningTasksMutex）
+func (t *subagentTask) info(status string) tools.SubagentInfo {
+	return tools.SubagentInfo{
+		ID:         t.ID,
+		Label:      t.Label,
+		Task:       t.Task,
+		Status:     status,
+		Channel:    t.Origin.Channel,
+		ChatID:     t.Origin.ChatID,
+		Started:    t.Started,
+		Iterations: t.Iterations,
+		LastTool:   t.LastTool,
+		Model:      t.Model,
+		Tools:      t.Tools,
+	}
+}
+
+// ListTasks 返回运行中和最近结束的任务（实现 tools.SubagentController）
+// 运行中的任务按开始时间排在前面，之后是最近结束的任务（最新的在前）
+func (s *SubagentManager) ListTasks() []tools.SubagentInfo {
+	s.runningTasksMutex.Lock()
+	defer s.runningTasksMutex.Unlock()
+
+	tasks := make([]tools.SubagentInfo, 0, len(s.runningTasks)+len(s.finishedTasks))
+	for _, task := range s.runningTasks {
+		tasks = append(tasks, task.info("running"))
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Started.Before(tasks[j].Started) })
+	for i := len(s.finishedTasks) - 1; i >= 0; i-- {
+		tasks = append(tasks, s.finishedTasks[i])
+	}
+	return tasks
+}
+
+// TaskInfo 返回指定任务的状态（实现 tools.SubagentController）
+func (s *SubagentManager) TaskInfo(taskID string) (tools.SubagentInfo, bool) {
+	s.runningTasksMutex.Lock()
+	defer s.runningTasksMutex.Unlock()
+
+	if task, ok := s.runningTasks[taskID]; ok {
+		return task.info("running"), true
+	}
+	for i := len(s.finishedTasks) - 1; i >= 0; i-- {
+		if s.finishedTasks[i].ID == taskID {
+			return s.finishedTasks[i], true
+		}
+	}
+	return tools.SubagentInfo{}, false
 }
 
 // StopAll 停止所有正在运行的子代理
@@ -484,8 +918,20 @@ func (s *SubagentManager) GetRunningTaskIDs() []string {
 }
 
 // generateTaskID 生成一个短的任务 ID
-// 使用当前时间戳的十六进制表示（取前8位）
+// 取随机 UUID 的前 8 位（时间戳的高位在短时间内会重复，无法区分同时创建的任务）
 func generateTaskID() string {
-	// 简单的 ID 生成
-	return fmt.Sprintf("%x", time.Now().UnixNano())[:8]
+	return uuid.NewString()[:8]
+}
+
+// generatedTaskID 判断 ID 是否是 generateTaskID 生成的格式（8 位十六进制），防止用 ID 拼出工作区之外的路径
+func generatedTaskID(id string) bool {
+	if len(id) != 8 {
+		return false
+	}
+	for _, r := range id {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
 }
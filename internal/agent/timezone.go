@@ -0,0 +1,143 @@
+package agent
+
+// timezone.go - 会话时区
+// 系统提示词中的当前时间、cron 工具的 "at" 时间和 cron 表达式、摘要任务的生成时间都按会话的时区计算：
+//   - 用户用 /timezone 设置的时区优先
+//   - 其次是频道在消息元数据中提供的时区（"timezone" 键，IANA 名称）
+//   - 再次是配置的 agents.defaults.timezone
+//   - 最后是服务器的本地时区
+//
+// Telegram 等频道的 Bot API 不提供用户的时区，这些频道的用户需要用 /timezone 设置。
+// 时区保存在会话元数据中，随会话持久化。
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/i18n"
+	"github.com/Ailoc/nanogrip/internal/session"
+)
+
+const (
+	// sessionTimezoneKey 会话元数据中保存时区的键（IANA 名称）
+	sessionTimezoneKey = "timezone"
+	// sessionTimezoneSourceKey 会话元数据中保存时区来源的键（"user" 或 "detected"）
+	sessionTimezoneSourceKey = "timezone_source"
+	// timezoneMetadataKey 入站消息元数据中由频道提供的时区（IANA 名称）
+	timezoneMetadataKey = "timezone"
+)
+
+// LoadTimezone 解析 IANA 时区名称（例如 "Asia/Shanghai"、"UTC"）
+// 不接受 "Local"，它在不同的机器上含义不同
+func LoadTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.EqualFold(name, "local") {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return time.LoadLocation(name)
+}
+
+// SetTimezone 设置默认时区
+// 可以在运行时调用（配置热重载）
+// 参数:
+//
+//	name: IANA 时区名称，空字符串表示使用服务器的本地时区；无效的名称同样使用本地时区
+func (a *AgentLoop) SetTimezone(name string) {
+	var loc *time.Location
+	if name != "" {
+		loc, _ = LoadTimezone(name)
+	}
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+	a.timezone = loc
+}
+
+// sessionTimezone 返回会话的时区和来源（"user"、"detected"、"config" 或 "server"）
+func (a *AgentLoop) sessionTimezone(sess *session.Session) (*time.Location, string) {
+	name, _ := sess.Metadata[sessionTimezoneKey].(string)
+	source, _ := sess.Metadata[sessionTimezoneSourceKey].(string)
+	if name != "" {
+		if loc, err := LoadTimezone(name); err == nil {
+			return loc, source
+		}
+	}
+
+	a.settingsMu.RLock()
+	configured := a.timezone
+	a.settingsMu.RUnlock()
+	if configured != nil {
+		return configured, "config"
+	}
+	return time.Local, "server"
+}
+
+// detectTimezone 根据频道在消息元数据中提供的时区更新会话的时区（用户设置的时区不会被覆盖）
+func (a *AgentLoop) detectTimezone(sess *session.Session, metadata map[string]interface{}) {
+	name, _ := metadata[timezoneMetadataKey].(string)
+	if name == "" {
+		return
+	}
+	if source, _ := sess.Metadata[sessionTimezoneSourceKey].(string); source == "user" {
+		return
+	}
+	loc, err := LoadTimezone(name)
+	if err != nil {
+		return
+	}
+	if current, _ := sess.Metadata[sessionTimezoneKey].(string); current != loc.String() {
+		sess.Metadata[sessionTimezoneKey] = loc.String()
+		sess.Metadata[sessionTimezoneSourceKey] = "detected"
+	}
+}
+
+// TimezoneFor 返回发送到某个聊天的内容应使用的时区名称（例如摘要任务的生成时间）
+// 返回:
+//
+//	IANA 时区名称，会话和配置都没有时区时返回空字符串（使用服务器的本地时区）
+func (a *AgentLoop) TimezoneFor(channel, chatID string) string {
+	loc, source := a.sessionTimezone(a.sessions.GetOrCreate(channel + ":" + chatID))
+	if source == "server" {
+		return ""
+	}
+	return loc.String()
+}
+
+// timezoneLabel 返回时区的名称和当前的 UTC 偏移，例如 "Asia/Shanghai (UTC+08:00)"
+// 服务器的本地时区没有 IANA 名称，使用时区缩写
+func timezoneLabel(loc *time.Location) string {
+	now := time.Now().In(loc)
+	name := loc.String()
+	if loc == time.Local {
+		name = now.Format("MST")
+	}
+	return name + " (UTC" + now.Format("-07:00") + ")"
+}
+
+// timezoneCommand 处理 /timezone 命令
+// 参数:
+//
+//	args: 空表示显示当前时区；"auto" 表示清除设置（使用频道提供的、配置的或服务器的时区）；其余为 IANA 时区名称
+func (a *AgentLoop) timezoneCommand(sess *session.Session, lang string, args []string) string {
+	if len(args) == 0 {
+		loc, source := a.sessionTimezone(sess)
+		return i18n.T(lang, "timezone_current", timezoneLabel(loc), i18n.T(lang, "timezone_source_"+source))
+	}
+
+	if strings.EqualFold(args[0], i18n.Auto) {
+		delete(sess.Metadata, sessionTimezoneKey)
+		delete(sess.Metadata, sessionTimezoneSourceKey)
+		a.sessions.Save(sess)
+		loc, _ := a.sessionTimezone(sess)
+		return i18n.T(lang, "timezone_auto", timezoneLabel(loc))
+	}
+
+	loc, err := LoadTimezone(args[0])
+	if err != nil {
+		return i18n.T(lang, "timezone_unknown", args[0])
+	}
+	sess.Metadata[sessionTimezoneKey] = loc.String()
+	sess.Metadata[sessionTimezoneSourceKey] = "user"
+	a.sessions.Save(sess)
+	return i18n.T(lang, "timezone_set", timezoneLabel(loc))
+}
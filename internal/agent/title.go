@@ -0,0 +1,115 @@
+package agent
+
+// title.go - 会话标题
+// 会话的第一轮对话完成后，用记忆整理的模型（通常更便宜）生成一个简短的标题并保存在会话元数据中，
+// nanogrip sessions list 用它显示会话列表。生成失败时下一轮对话后再试。
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/providers"
+	"github.com/Ailoc/nanogrip/internal/session"
+)
+
+const (
+	// titleTimeout 生成标题的超时时间
+	titleTimeout = 30 * time.Second
+	// maxTitleLength 标题最多保留的字符数
+	maxTitleLength = 60
+	// titleSourceMessages 生成标题时参考的最多消息数（从会话开头算起）
+	titleSourceMessages = 4
+)
+
+// SetSessionTitles 设置是否自动生成会话标题（默认生成）
+func (a *AgentLoop) SetSessionTitles(enabled bool) {
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+	a.titlesDisabled = !enabled
+}
+
+// ensureTitle 会话还没有标题时生成一个
+// 在会话的 worker 中回复发出之后调用，不会与同一会话的消息处理同时修改会话
+func (a *AgentLoop) ensureTitle(ctx context.Context, key string) {
+	a.settingsMu.RLock()
+	disabled := a.titlesDisabled
+	a.settingsMu.RUnlock()
+	if disabled {
+		return
+	}
+
+	sess := a.sessions.GetOrCreate(key)
+	if title, _ := sess.Metadata[session.TitleKey].(string); title != "" {
+		return
+	}
+	excerpt := titleExcerpt(sess.Messages)
+	if excerpt == "" {
+		return
+	}
+
+	provider, model, _ := a.consolidationModel()
+	ctx, cancel := context.WithTimeout(ctx, titleTimeout)
+	defer cancel()
+	resp, err := provider.Chat(ctx, []providers.Message{
+		{Role: "system", Content: "You write short titles for conversations."},
+		{Role: "user", Content: "Write a title of at most six words for this conversation, in the language the user writes in. Reply with the title only, without quotes or punctuation at the end.\n\n" + excerpt},
+	}, nil, model, 32, 0.3)
+	if err != nil {
+		log.Printf("[Session] 生成 %s 的标题失败: %v", key, err)
+		return
+	}
+	title := cleanTitle(resp.Content)
+	if title == "" {
+		return
+	}
+	sess.Metadata[session.TitleKey] = title
+	a.sessions.Save(sess)
+}
+
+// titleExcerpt 返回会话开头的几条对话，还没有完整的一问一答时返回空字符串
+func titleExcerpt(messages []session.Message) string {
+	var lines []string
+	hasReply := false
+	for _, msg := range messages {
+		content := strings.TrimSpace(msg.Content)
+		if content == "" {
+			continue
+		}
+		switch msg.Role {
+		case "user":
+			lines = append(lines, "User: "+truncateRunes(content, 300))
+		case "assistant":
+			lines = append(lines, "Assistant: "+truncateRunes(content, 300))
+			hasReply = true
+		default:
+			continue
+		}
+		if len(lines) == titleSourceMessages {
+			break
+		}
+	}
+	if !hasReply {
+		return ""
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cleanTitle 取模型回复的第一行，去掉引号、Markdown 标记和结尾的句号
+func cleanTitle(reply string) string {
+	title := ""
+	for _, line := range strings.Split(reply, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			title = line
+			break
+		}
+	}
+	title = strings.TrimLeft(title, "#*- ")
+	title = strings.Trim(title, "\"'“”‘’「」《》*` ")
+	title = strings.TrimRight(title, ".。")
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength]) + "…"
+	}
+	return strings.TrimSpace(title)
+}
@@ -0,0 +1,100 @@
+package agent
+
+// toolcall.go - 工具调用的统计和进度
+// 工具以 tools.ToolResult 报告结果，临时故障（网络错误、限流、服务端错误）由工具注册表自动重试几次
+// （权限检查和用户确认只进行一次），模型只看到最后一次的结果；成功、失败和重试的次数显示在 /status 中。
+// 运行较久的工具（shell、web_fetch）报告的中间进度经过节流后作为进度提示发给用户。
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Ailoc/nanogrip/internal/tools"
+)
+
+const (
+	// toolProgressDelay 工具运行超过这个时间后才转发进度，很快完成的调用不打扰用户
+	toolProgressDelay = 5 * time.Second
+	// toolProgressInterval 两次进度提示之间的最短间隔
+	toolProgressInterval = 15 * time.Second
+	// maxProgressChars 进度提示中输出行的最大字符数
+	maxProgressChars = 200
+)
+
+// toolStats 统计工具调用的结果
+type toolStats struct {
+	calls   atomic.Int64 // 调用次数（重试不重复计数）
+	failed  atomic.Int64 // 最终失败的次数（不包括被拒绝的调用）
+	denied  atomic.Int64 // 被拦截或被拒绝的次数
+	retries atomic.Int64 // 重试次数
+}
+
+// executeTool 执行一次工具调用并统计结果（临时失败的重试由 registry.Execute 完成）
+// 参数:
+//
+//	ctx: 上下文对象，取消时停止重试
+//	registry: 工具注册表
+//	name: 工具名称
+//	args: 工具参数
+//	stats: 统计结果，为 nil 时不统计
+//
+// 返回:
+//
+//	最后一次调用的结果
+func executeTool(ctx context.Context, registry *tools.ToolRegistry, name string, args map[string]interface{}, stats *toolStats) tools.ToolResult {
+	ctx = tools.WithProgressReporter(ctx, &toolProgress{ctx: ctx, name: name, start: time.Now()})
+	result := registry.Execute(ctx, name, args)
+
+	if stats != nil {
+		stats.retries.Add(int64(result.Retries))
+		stats.calls.Add(1)
+		switch result.Status {
+		case tools.StatusError:
+			stats.failed.Add(1)
+		case tools.StatusDenied:
+			stats.denied.Add(1)
+		}
+	}
+	return result
+}
+
+// toolProgress 把一次工具调用的进度节流后转发为进度提示（tools.ReportProgress）
+// 通道未启用进度提示时 ctx 中没有回调，进度会被忽略
+type toolProgress struct {
+	ctx   context.Context
+	name  string
+	start time.Time
+
+	mu   sync.Mutex
+	last time.Time // 上一次转发的时间
+}
+
+// Report 实现 tools.ProgressReporter
+func (p *toolProgress) Report(progress tools.Progress) {
+	now := time.Now()
+	p.mu.Lock()
+	if now.Sub(p.start) < toolProgressDelay || now.Sub(p.last) < toolProgressInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.last = now
+	p.mu.Unlock()
+
+	message := strings.TrimSpace(progress.Message)
+	if utf8.RuneCountInString(message) > maxProgressChars {
+		message = string([]rune(message)[:maxProgressChars]) + "…"
+	}
+	note := p.name
+	if progress.Percent >= 0 {
+		note += fmt.Sprintf(" (%.0f%%)", progress.Percent)
+	}
+	if message != "" {
+		note += ": " + message
+	}
+	tools.ReportProgress(p.ctx, note)
+}
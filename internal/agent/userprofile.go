@@ -0,0 +1,120 @@
+package agent
+
+// userprofile.go - 用户档案学习
+// 开启后记忆整理时模型还可以通过 save_user_profile 提出 USER.md 的更新。
+// 需要确认时把提议的变化发送到来源聊天，管理员用 /profile accept 或 /profile reject 处理；
+// USER.md 是整个工作区共用的 Bootstrap 文件，所以 /profile 是管理员命令。
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/i18n"
+	"github.com/Ailoc/nanogrip/internal/providers"
+	"github.com/Ailoc/nanogrip/internal/tools"
+)
+
+// SetUserProfileLearning 开启用户档案学习，注册 save_user_profile 工具
+// 必须在 Start 之前调用
+// 参数:
+//
+//	autoAccept: 为 true 时直接更新 USER.md，否则发送确认消息等待 /profile accept
+func (a *AgentLoop) SetUserProfileLearning(autoAccept bool) {
+	a.tools.Register(tools.NewSaveUserProfileTool(a.workspace, autoAccept))
+}
+
+// userProfileTool 返回用户档案工具（未开启用户档案学习时返回 nil）
+func (a *AgentLoop) userProfileTool() *tools.SaveUserProfileTool {
+	tool, _ := a.tools.Get("save_user_profile").(*tools.SaveUserProfileTool)
+	return tool
+}
+
+// userProfilePrompt 返回记忆整理提示词中关于用户档案的部分
+func (a *AgentLoop) userProfilePrompt() string {
+	current, _ := os.ReadFile(filepath.Join(a.workspace, tools.UserProfileFile))
+	profile := strings.TrimSpace(string(current))
+	if profile == "" {
+		profile = "(empty)"
+	}
+	return fmt.Sprintf(`
+
+## Current User Profile (USER.md)
+%s
+
+If the conversation revealed new lasting facts about the user (preferences, timezone, language, recurring contacts, ongoing projects), also call the save_user_profile tool with the full updated profile and a short description of the changes. Do not call it otherwise.`, profile)
+}
+
+// userProfileToolDef 返回记忆整理时提供给模型的 save_user_profile 定义
+func userProfileToolDef(tool *tools.SaveUserProfileTool) providers.ToolDef {
+	return providers.ToolDef{
+		Type: "function",
+		Function: providers.FunctionDef{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			Parameters:  tool.Parameters(),
+		},
+	}
+}
+
+// proposeUserProfile 把待确认的用户档案更新发送到来源聊天
+func (a *AgentLoop) proposeUserProfile(channel, chatID, changes string) {
+	if channel == "" || chatID == "" {
+		return
+	}
+	log.Printf("[Memory] 已保存用户档案更新提议，等待确认: %s", changes)
+	a.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Content: i18n.T(a.languageForSession(channel+":"+chatID), "profile_proposal", changes),
+	})
+}
+
+// profileCommand 处理 /profile 命令
+// 参数:
+//
+//	args: 空表示显示当前档案和待确认的提议；accept 接受提议；reject 丢弃提议
+func (a *AgentLoop) profileCommand(args []string) string {
+	tool := a.userProfileTool()
+	if tool == nil {
+		return "User profile learning is not enabled (agents.defaults.consolidation.userProfile)."
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "accept":
+			if err := tool.Accept(); err != nil {
+				return "❌ " + err.Error()
+			}
+			return "✅ USER.md updated."
+		case "reject":
+			if err := tool.Reject(); err != nil {
+				return "❌ " + err.Error()
+			}
+			return "🗑 Proposed profile update discarded."
+		default:
+			return "Usage: /profile [accept|reject]"
+		}
+	}
+
+	current, _ := os.ReadFile(filepath.Join(a.workspace, tools.UserProfileFile))
+	reply := "👤 USER.md:\n" + truncateRunes(strings.TrimSpace(string(current)), memoryReplyLimit/2)
+	if proposed, ok := tool.Pending(); ok {
+		reply += "\n\n📝 Proposed update (/profile accept or /profile reject):\n" + truncateRunes(strings.TrimSpace(proposed), memoryReplyLimit/2)
+	}
+	return reply
+}
+
+// truncateRunes 把文本截断到最多 limit 个字符
+func truncateRunes(s string, limit int) string {
+	if s == "" {
+		return "(empty)"
+	}
+	if runes := []rune(s); len(runes) > limit {
+		return string(runes[:limit]) + "\n…(truncated)"
+	}
+	return s
+}
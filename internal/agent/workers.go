@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/i18n"
+)
+
+// workers.go - 按会话并行处理消息
+// 同一会话（会话键相同）的消息按到达顺序依次处理（用户在上一条消息处理完之前发来的消息
+// 排队等待，并收到一条排队提示，不会有两个 Agent 循环同时修改同一份会话历史），不同会话的消息并行处理，
+// 同时处理的会话数量受 maxSessions 限制。名额用完时新会话排队等待；
+// 正在处理的会话还有后续消息、且有其他会话在等待时，处理完当前消息后让出名额，
+// 避免一个消息很多的会话长期占用名额。
+
+// sessionWorkers 记录每个会话的待处理消息和等待名额的会话
+type sessionWorkers struct {
+	mu      sync.Mutex
+	queues  map[string][]bus.InboundMessage // 已分配给 worker（运行中或等待名额）的会话及其排队的消息
+	waiting []string                        // 等待名额的会话（按到达顺序，取出时优先用户消息）
+	running int                             // 正在运行的 worker 数量
+}
+
+// SetMaxConcurrentSessions 设置同时处理消息的会话上限
+// 可以在运行时调用（配置热重载），对之后分配名额时生效
+// 参数：
+//   - n: 会话上限，1 表示所有消息依次处理，<= 0 表示不限制
+func (a *AgentLoop) SetMaxConcurrentSessions(n int) {
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+	a.maxSessions = n
+}
+
+// sessionKeyFor 返回消息所属的会话键
+// 系统消息（子代理公告）的 chat_id 是 "channel:chat_id"，与来源会话使用同一个键
+func sessionKeyFor(msg bus.InboundMessage) string {
+	if msg.Channel == "system" {
+		if strings.Contains(msg.ChatID, ":") {
+			return msg.ChatID
+		}
+		return "cli:" + msg.ChatID
+	}
+	if msg.SessionKey != "" {
+		return msg.SessionKey
+	}
+	return fmt.Sprintf("%s:%s", msg.Channel, msg.ChatID)
+}
+
+// dispatch 把消息交给所属会话的 worker，会话没有 worker 时创建一个（名额用完时排队）
+func (a *AgentLoop) dispatch(ctx context.Context, msg bus.InboundMessage) {
+	key := sessionKeyFor(msg)
+
+	w := &a.workers
+	w.mu.Lock()
+	if w.queues == nil {
+		w.queues = make(map[string][]bus.InboundMessage)
+	}
+	if queue, ok := w.queues[key]; ok {
+		// 同一会话的上一条消息还没处理完：排队，并告诉用户消息没有丢
+		w.queues[key] = append(queue, msg)
+		queued := len(w.queues[key])
+		w.mu.Unlock()
+		a.notifyQueued(msg, queued)
+		return
+	}
+	w.queues[key] = []bus.InboundMessage{msg}
+	if !a.hasFreeSlot() {
+		w.waiting = append(w.waiting, key)
+		w.mu.Unlock()
+		return
+	}
+	w.running++
+	w.mu.Unlock()
+
+	a.startWorker(ctx, key)
+}
+
+// hasFreeSlot 判断是否还有空闲名额（调用者需持有 workers.mu）
+func (a *AgentLoop) hasFreeSlot() bool {
+	a.settingsMu.RLock()
+	limit := a.maxSessions
+	a.settingsMu.RUnlock()
+	return limit <= 0 || a.workers.running < limit
+}
+
+// startWorker 启动一个 worker 依次处理会话中的消息
+func (a *AgentLoop) startWorker(ctx context.Context, key string) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.runWorker(ctx, key)
+	}()
+}
+
+// runWorker 依次处理会话中排队的消息，直到队列为空或需要让出名额
+func (a *AgentLoop) runWorker(ctx context.Context, key string) {
+	w := &a.workers
+	for {
+		w.mu.Lock()
+		queue := w.queues[key]
+		if len(queue) == 0 || ctx.Err() != nil {
+			// 会话处理完毕（或正在关闭），把名额交给下一个等待的会话
+			delete(w.queues, key)
+			next := a.nextWaiting()
+			w.mu.Unlock()
+			if next != "" {
+				a.startWorker(ctx, next)
+			}
+			return
+		}
+		msg := queue[0]
+		w.queues[key] = queue[1:]
+		w.mu.Unlock()
+
+		a.handleMessage(ctx, msg)
+
+		// 还有后续消息但其他会话在等待时，让出名额排到队尾
+		w.mu.Lock()
+		if len(w.queues[key]) > 0 && len(w.waiting) > 0 {
+			w.waiting = append(w.waiting, key)
+			next := a.nextWaiting()
+			w.mu.Unlock()
+			if next != "" {
+				a.startWorker(ctx, next)
+			}
+			return
+		}
+		w.mu.Unlock()
+	}
+}
+
+// nextWaiting 释放当前 worker 的名额，如果有空闲名额则取出下一个等待的会话并占用名额
+// 下一条消息是用户消息（高优先级）的会话先启动，子代理公告等后台消息只在没有用户消息等待时处理
+// 调用者需持有 workers.mu；返回空字符串表示没有可以启动的会话
+func (a *AgentLoop) nextWaiting() string {
+	w := &a.workers
+	w.running--
+	if len(w.waiting) == 0 || !a.hasFreeSlot() {
+		return ""
+	}
+	i := 0
+	for j, key := range w.waiting {
+		if queue := w.queues[key]; len(queue) > 0 && bus.PriorityOf(queue[0]) == bus.PriorityHigh {
+			i = j
+			break
+		}
+	}
+	next := w.waiting[i]
+	w.waiting = append(w.waiting[:i], w.waiting[i+1:]...)
+	w.running++
+	return next
+}
+
+// notifyQueued 告诉用户消息已排队，会在之前的请求完成后处理
+// 参数：
+//   - msg: 排队的消息
+//   - queued: 该会话中排队的消息数量（包括这一条）
+func (a *AgentLoop) notifyQueued(msg bus.InboundMessage, queued int) {
+	// 系统消息和旁听的消息不需要提示
+	if msg.Channel == "system" || msg.Observed() {
+		return
+	}
+	a.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:  msg.Channel,
+		ChatID:   msg.ChatID,
+		Content:  i18n.T(a.languageForSession(sessionKeyFor(msg)), "message_queued", queued),
+		Metadata: msg.Metadata,
+	})
+}
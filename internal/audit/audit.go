@@ -0,0 +1,291 @@
+// Package audit 记录每一次工具调用
+//
+// Agent 可以根据聊天消息执行 shell 命令和读写文件，审计日志记录每一次工具调用
+// （时间、会话、工具、参数、结果摘要、耗时、是否成功），按天写入
+// workspace/audit/audit-YYYY-MM-DD.jsonl，超过保留天数的文件自动删除。
+//
+// 参数中疑似密钥的字段（password、token 等）会被替换为 "[redacted]"，
+// 过长的参数和结果会被截断，审计日志不是工具输出的完整备份。
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/redact"
+	"github.com/Ailoc/nanogrip/internal/tools"
+	"github.com/Ailoc/nanogrip/internal/trace"
+)
+
+const (
+	// maxArgLength 单个参数值最多记录的字符数
+	maxArgLength = 500
+	// maxResultLength 结果最多记录的字符数
+	maxResultLength = 1000
+	// filePrefix 审计日志文件名前缀
+	filePrefix = "audit-"
+)
+
+// secretKeys 参数名包含这些词时不记录参数值
+var secretKeys = []string{"password", "passwd", "secret", "token", "api_key", "apikey", "authorization", "credential", "private_key"}
+
+// Record 是审计日志中的一条记录
+type Record struct {
+	Time       time.Time              `json:"time"`               // 调用结束的时间
+	Session    string                 `json:"session,omitempty"`  // 会话（channel:chat_id）
+	Sender     string                 `json:"sender,omitempty"`   // 发送者 ID
+	Tool       string                 `json:"tool"`               // 工具名称
+	Args       map[string]interface{} `json:"args,omitempty"`     // 参数（已去除密钥并截断）
+	Result     string                 `json:"result"`             // 结果（已截断）
+	DurationMs int64                  `json:"duration_ms"`        // 耗时（毫秒）
+	Success    bool                   `json:"success"`            // 是否成功
+	TraceID    string                 `json:"trace_id,omitempty"` // 追踪 ID
+}
+
+// Log 负责写入审计日志
+type Log struct {
+	dir           string     // 日志目录
+	retentionDays int        // 保留天数（<= 0 表示永久保留）
+	mu            sync.Mutex // 保护文件写入
+	day           string     // 最近一次写入的日期，日期变化时清理过期文件
+}
+
+// New 创建审计日志
+// 参数:
+//
+//	dir: 日志目录（通常为 workspace/audit）
+//	retentionDays: 保留天数，<= 0 表示永久保留
+func New(dir string, retentionDays int) *Log {
+	return &Log{dir: dir, retentionDays: retentionDays}
+}
+
+// Dir 返回日志目录
+func (l *Log) Dir() string {
+	return l.dir
+}
+
+// Hook 是记录工具调用的 tools.PostHook，不修改结果
+func (l *Log) Hook(ctx context.Context, name string, params map[string]interface{}, result string, err error, elapsed time.Duration) string {
+	record := Record{
+		Time:       time.Now(),
+		Tool:       name,
+		Args:       sanitizeArgs(params),
+		Result:     truncate(result, maxResultLength),
+		DurationMs: elapsed.Milliseconds(),
+		Success:    err == nil,
+		TraceID:    trace.IDFrom(ctx),
+	}
+	if toolCtx, ok := tools.ToolContextFrom(ctx); ok {
+		record.Session = toolCtx.Channel + ":" + toolCtx.ChatID
+		record.Sender = toolCtx.SenderID
+	}
+	if writeErr := l.Append(record); writeErr != nil {
+		log.Printf("[Audit] 写入审计日志失败: %v", writeErr)
+	}
+	return result
+}
+
+// Append 写入一条记录
+func (l *Log) Append(record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(l.dir, 0700); err != nil {
+		return err
+	}
+	day := record.Time.Format("2006-01-02")
+	if day != l.day {
+		l.day = day
+		l.prune(record.Time)
+	}
+
+	f, err := os.OpenFile(filepath.Join(l.dir, filePrefix+day+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// prune 删除超过保留天数的日志文件（调用者需持有锁）
+func (l *Log) prune(now time.Time) {
+	if l.retentionDays <= 0 {
+		return
+	}
+	cutoff := now.AddDate(0, 0, -l.retentionDays).Format("2006-01-02")
+	files, _ := filepath.Glob(filepath.Join(l.dir, filePrefix+"*.jsonl"))
+	for _, file := range files {
+		if fileDay(file) < cutoff {
+			if err := os.Remove(file); err == nil {
+				log.Printf("[Audit] 已删除过期的审计日志: %s", filepath.Base(file))
+			}
+		}
+	}
+}
+
+// fileDay 返回日志文件对应的日期（YYYY-MM-DD）
+func fileDay(path string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), filePrefix), ".jsonl")
+}
+
+// sanitizeArgs 复制参数，去除疑似密钥的值并截断过长的字符串
+func sanitizeArgs(params map[string]interface{}) map[string]interface{} {
+	if len(params) == 0 {
+		return nil
+	}
+	args := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		if key == "_raw" {
+			continue
+		}
+		if isSecretKey(key) {
+			args[key] = "[redacted]"
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			args[key] = truncate(redact.String(v), maxArgLength)
+		case map[string]interface{}:
+			args[key] = sanitizeArgs(v)
+		default:
+			args[key] = value
+		}
+	}
+	return args
+}
+
+// isSecretKey 判断参数名是否疑似密钥
+func isSecretKey(key string) bool {
+	lower := strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if strings.Contains(lower, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate 把字符串截断到最多 max 个字符
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + fmt.Sprintf("... (%d more chars)", len(runes)-max)
+}
+
+// Query 审计日志查询条件
+type Query struct {
+	Since   time.Time // 开始时间（含），零值表示不限
+	Session string    // 按会话过滤
+	Tool    string    // 按工具名称过滤
+	Failed  bool      // 只返回失败的调用
+	Limit   int       // 最多返回的记录数（取最新的），0 表示不限
+}
+
+// Search 在日志目录中查询记录
+// 参数:
+//
+//	dir: 日志目录
+//	q: 查询条件
+//
+// 返回:
+//
+//	按时间排序的记录列表
+func Search(dir string, q Query) ([]Record, error) {
+	files, err := filepath.Glob(filepath.Join(dir, filePrefix+"*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var records []Record
+	for _, file := range files {
+		if !q.Since.IsZero() && fileDay(file) < q.Since.Format("2006-01-02") {
+			continue
+		}
+		fileRecords, err := readFile(file, q)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		records = append(records, fileRecords...)
+	}
+
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[len(records)-q.Limit:]
+	}
+	return records, nil
+}
+
+// readFile 读取单个日志文件中满足条件的记录
+func readFile(path string, q Query) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue // 跳过损坏的行
+		}
+		if q.matches(r) {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// matches 判断记录是否满足查询条件
+func (q Query) matches(r Record) bool {
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	if q.Session != "" && r.Session != q.Session {
+		return false
+	}
+	if q.Tool != "" && r.Tool != q.Tool {
+		return false
+	}
+	if q.Failed && r.Success {
+		return false
+	}
+	return true
+}
+
+// Format 把记录格式化为一行摘要（用于 /audit 命令和 nanogrip audit）
+func (r Record) Format() string {
+	status := "ok"
+	if !r.Success {
+		status = "FAILED"
+	}
+	args := []byte("{}")
+	if len(r.Args) > 0 {
+		args, _ = json.Marshal(r.Args)
+	}
+	line := fmt.Sprintf("%s  %-6s  %s  %dms  %s", r.Time.Format("2006-01-02 15:04:05"), status, r.Tool, r.DurationMs, truncate(string(args), 120))
+	if r.Session != "" {
+		line += "  [" + r.Session + "]"
+	}
+	return line
+}
@@ -0,0 +1,373 @@
+// Package backup 备份和恢复工作区
+//
+// 会话历史、记忆、待办事项、用户资料和技能都保存在工作区中，丢失 ~/.nanogrip 就会全部丢失。
+// 备份把整个工作区打包为 nanogrip-YYYYMMDD-HHMMSS.tar.gz，保存在备份目录中（建议放在另一块磁盘或同步目录），
+// 可以用 secrets 包的密钥分块加密（文件名以 .tar.gz.enc 结尾），并只保留最近的若干份。
+// 打包、加密和恢复都是流式的，内存占用与工作区大小无关。
+// 过期的工具结果文件（artifacts）、进程 ID 文件、管理接口 socket 和 code_exec 的虚拟环境（.venv）不会被备份。
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/secrets"
+)
+
+const (
+	// Ext 未加密备份的扩展名
+	Ext = ".tar.gz"
+	// EncryptedExt 加密备份的扩展名
+	EncryptedExt = ".tar.gz.enc"
+
+	// namePrefix 备份文件名的前缀，List 和 Prune 只处理以它开头的文件
+	namePrefix = "nanogrip-"
+	// timeLayout 备份文件名中的时间格式
+	timeLayout = "20060102-150405"
+)
+
+// skipped 不备份的工作区文件和目录（相对于工作区的路径）
+var skipped = map[string]bool{
+	"artifacts":    true, // 过长的工具结果，会定期删除
+	"nanogrip.pid": true, // 进程 ID 文件（见 lifecycle.PidFileName），恢复后会误判进程状态
+	".venv":        true, // code_exec 的 Python 虚拟环境，可以随时重建
+}
+
+// Options 是创建备份的配置
+type Options struct {
+	Dir    string          // 备份目录
+	Keep   int             // 保留最近的几份备份，<= 0 表示不删除旧备份
+	Cipher *secrets.Cipher // 不为 nil 时加密备份
+}
+
+// Info 描述一份备份
+type Info struct {
+	Name      string    // 文件名
+	Path      string    // 完整路径
+	Size      int64     // 文件大小（字节）
+	Created   time.Time // 创建时间（来自文件名）
+	Encrypted bool      // 是否加密
+}
+
+// Create 把工作区打包为一份备份，然后按 opts.Keep 删除旧备份
+// 参数:
+//
+//	workspace: 工作区目录
+//	opts: 备份目录、保留份数和加密
+//
+// 返回:
+//
+//	备份文件的路径
+func Create(workspace string, opts Options) (string, error) {
+	if opts.Dir == "" {
+		return "", fmt.Errorf("backup directory is not set")
+	}
+	if err := os.MkdirAll(opts.Dir, 0700); err != nil {
+		return "", err
+	}
+
+	stamp := time.Now().Format(timeLayout)
+	name := namePrefix + stamp + Ext
+	if opts.Cipher != nil {
+		name = namePrefix + stamp + EncryptedExt
+	}
+
+	// 同一秒内创建的备份不覆盖已有的备份
+	path := filepath.Join(opts.Dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("backup %s already exists", path)
+	}
+
+	// 边打包边写入临时文件（工作区可能很大，不在内存中组装），完成后再重命名，中途失败时不会留下不完整的备份
+	tmp := path + ".tmp"
+	if err := writeArchive(tmp, workspace, opts); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	if _, err := Prune(opts.Dir, opts.Keep); err != nil {
+		return path, fmt.Errorf("backup created, but failed to remove old backups: %w", err)
+	}
+	return path, nil
+}
+
+// writeArchive 把工作区打包写入 path，配置了 opts.Cipher 时分块加密
+func writeArchive(path, workspace string, opts Options) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+	var enc io.WriteCloser
+	if opts.Cipher != nil {
+		if enc, err = opts.Cipher.NewEncryptWriter(f); err != nil {
+			return fmt.Errorf("encrypt backup: %w", err)
+		}
+		w = enc
+	}
+	if err := archive(w, workspace, opts.Dir); err != nil {
+		return err
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			return fmt.Errorf("encrypt backup: %w", err)
+		}
+	}
+	return f.Close()
+}
+
+// archive 把工作区打包为 tar.gz 写入 w，跳过 skipped 中的路径、备份目录本身和非普通文件
+func archive(w io.Writer, workspace, backupDir string) error {
+	root, err := filepath.Abs(workspace)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(root); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+	backupDir, _ = filepath.Abs(backupDir)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if skipped[filepath.ToSlash(rel)] || path == backupDir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// socket、管道和符号链接不备份
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Restore 把备份解压到工作区，覆盖同名文件（工作区中备份里没有的文件保持不变）
+// 参数:
+//
+//	path: 备份文件
+//	workspace: 工作区目录
+//	cipher: 解密用的 Cipher，备份未加密时可以为 nil
+//
+// 返回:
+//
+//	恢复的文件数量
+func Restore(path, workspace string, cipher *secrets.Cipher) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r, err := decryptedReader(bufio.NewReader(f), cipher)
+	if err != nil {
+		return 0, err
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	if err := os.MkdirAll(workspace, 0755); err != nil {
+		return 0, err
+	}
+	tr := tar.NewReader(gz)
+	restored := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return restored, nil
+		}
+		if err != nil {
+			return restored, fmt.Errorf("read backup archive: %w", err)
+		}
+
+		// 拒绝指向工作区之外的路径
+		name := filepath.FromSlash(strings.TrimSuffix(header.Name, "/"))
+		if !filepath.IsLocal(name) {
+			return restored, fmt.Errorf("invalid path in backup: %s", header.Name)
+		}
+		target := filepath.Join(workspace, name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return restored, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return restored, err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, header.FileInfo().Mode().Perm())
+			if err != nil {
+				return restored, err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return restored, err
+			}
+			os.Chtimes(target, header.ModTime, header.ModTime)
+			restored++
+		}
+	}
+}
+
+// decryptedReader 返回备份的 tar.gz 内容：分块加密的备份边读边解密，
+// 旧版本整体加密（"enc:v1:" 文本）的备份只能整体读入内存解密
+func decryptedReader(r *bufio.Reader, cipher *secrets.Cipher) (io.Reader, error) {
+	header, _ := r.Peek(len(secrets.StreamMagic))
+	stream := secrets.IsEncryptedStream(header)
+	legacy := !stream && secrets.IsEncrypted(string(header[:min(len(header), len(secrets.Prefix))]))
+	if !stream && !legacy {
+		return r, nil
+	}
+	if cipher == nil {
+		return nil, fmt.Errorf("backup is encrypted: %w", secrets.ErrNoKey)
+	}
+	if stream {
+		return cipher.NewDecryptReader(r)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = cipher.Decrypt(strings.TrimSpace(string(data))); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// List 返回备份目录中的备份，最新的在前
+// 目录不存在时返回空列表
+func List(dir string) ([]Info, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Info
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, namePrefix) {
+			continue
+		}
+		encrypted := strings.HasSuffix(name, EncryptedExt)
+		if !encrypted && !strings.HasSuffix(name, Ext) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, namePrefix), EncryptedExt), Ext)
+		created, err := time.ParseInLocation(timeLayout, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Info{
+			Name:      name,
+			Path:      filepath.Join(dir, name),
+			Size:      info.Size(),
+			Created:   created,
+			Encrypted: encrypted,
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Created.After(backups[j].Created) })
+	return backups, nil
+}
+
+// Prune 只保留最近的 keep 份备份，keep <= 0 时不删除
+// 返回:
+//
+//	被删除的备份文件名
+func Prune(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	backups, err := List(dir)
+	if err != nil || len(backups) <= keep {
+		return nil, err
+	}
+	var removed []string
+	for _, b := range backups[keep:] {
+		if err := os.Remove(b.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, b.Name)
+	}
+	return removed, nil
+}
+
+// Resolve 把命令行给出的备份转换为路径：已存在的路径原样返回，否则在备份目录中查找同名文件
+func Resolve(dir, name string) string {
+	if _, err := os.Stat(name); err == nil {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,300 @@
+// Package budget 为 LLM 调用提供每日花费上限
+//
+// ratelimit 按发送者和频道限制用量；budget 限制的是整个进程每天在每个提供商上的总用量，
+// 所有 Agent、子代理、记忆整理和定时任务的 LLM 调用都会计入：
+//   - 每天 token 用量（maxTokensPerDay）
+//   - 每天花费（maxCostPerDay，按 prices 中的单价估算，单位美元）
+//
+// 超出限制后新的 LLM 调用被拒绝（返回 *ExceededError），Agent 回复一条说明；
+// 配置了 fallbackModel 时改用更便宜的备用模型继续工作。
+// 用量保存在 workspace/budget.json，重启后仍然有效，每天在 resetTime（本地时间）清零。
+package budget
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit 描述一个提供商的每日限制，0 表示不限制
+type Limit struct {
+	MaxTokensPerDay int     // 每天最多消耗的 token 数
+	MaxCostPerDay   float64 // 每天最多的花费（美元）
+}
+
+// enabled 判断是否设置了任何限制
+func (l Limit) enabled() bool {
+	return l.MaxTokensPerDay > 0 || l.MaxCostPerDay > 0
+}
+
+// Price 描述一个模型的单价（每百万 token，美元）
+type Price struct {
+	Input  float64 // 输入（提示词）token 单价
+	Output float64 // 输出 token 单价
+}
+
+// Options 是 Tracker 的配置
+type Options struct {
+	Limits    map[string]Limit // 提供商名称（anthropic、openai）-> 每日限制
+	Prices    map[string]Price // 模型名称或前缀 -> 单价，用于估算花费
+	ResetAt   int              // 每天清零的时间，距午夜的分钟数（本地时间）
+	StatePath string           // 每日用量的保存位置，为空表示只保存在内存中
+}
+
+// usage 是一个提供商当天的用量
+type usage struct {
+	Calls  int     `json:"calls"`
+	Tokens int     `json:"tokens"`
+	Cost   float64 `json:"cost"`
+}
+
+// state 是持久化到磁盘的每日用量
+type state struct {
+	Day       string            `json:"day"`       // 预算日（YYYY-MM-DD），按 ResetAt 划分，跨日时清零
+	Providers map[string]*usage `json:"providers"` // 提供商名称 -> 用量
+}
+
+// Tracker 记录每个提供商的每日用量并检查限制
+type Tracker struct {
+	opts     Options
+	state    state
+	unpriced map[string]bool // 已经提示过缺少单价的模型
+	mu       sync.Mutex
+}
+
+// ExceededError 表示提供商的每日预算已用完
+type ExceededError struct {
+	Provider string
+	Reason   string    // 超出的是哪项限制，例如 "cost $5.03 of $5.00"
+	ResetAt  time.Time // 下一次清零的时间
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("daily budget for %s exhausted (%s), resets at %s", e.Provider, e.Reason, e.ResetAt.Format("2006-01-02 15:04"))
+}
+
+// New 创建 Tracker
+// 参数:
+//
+//	opts: 限制、单价和清零时间
+func New(opts Options) *Tracker {
+	t := &Tracker{
+		opts:     opts,
+		unpriced: make(map[string]bool),
+	}
+	t.load()
+	return t
+}
+
+// ParseResetTime 把 HH:MM 转换为距午夜的分钟数，空字符串表示午夜
+func ParseResetTime(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid reset time %q (expected HH:MM)", value)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// Enabled 判断是否设置了任何限制
+func (t *Tracker) Enabled() bool {
+	if t == nil {
+		return false
+	}
+	for _, limit := range t.opts.Limits {
+		if limit.enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// Check 检查提供商今天是否还有预算，用完时返回 *ExceededError
+func (t *Tracker) Check(provider string) error {
+	if !t.Enabled() {
+		return nil
+	}
+	limit := t.opts.Limits[provider]
+	if !limit.enabled() {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.rollover(now)
+
+	u := t.state.Providers[provider]
+	if u == nil {
+		return nil
+	}
+	var reason string
+	switch {
+	case limit.MaxTokensPerDay > 0 && u.Tokens >= limit.MaxTokensPerDay:
+		reason = fmt.Sprintf("%d of %d tokens", u.Tokens, limit.MaxTokensPerDay)
+	case limit.MaxCostPerDay > 0 && u.Cost >= limit.MaxCostPerDay:
+		reason = fmt.Sprintf("cost $%.2f of $%.2f", u.Cost, limit.MaxCostPerDay)
+	default:
+		return nil
+	}
+	return &ExceededError{Provider: provider, Reason: reason, ResetAt: t.nextReset(now)}
+}
+
+// Record 记录一次 LLM 调用的用量
+// 参数:
+//
+//	provider: 提供商名称
+//	model: 模型名称，用于查找单价
+//	tokens: 提供商返回的用量（prompt_tokens、completion_tokens、total_tokens）
+func (t *Tracker) Record(provider, model string, tokens map[string]int) {
+	if !t.Enabled() {
+		return
+	}
+
+	input, output := tokens["prompt_tokens"], tokens["completion_tokens"]
+	total := tokens["total_tokens"]
+	if total == 0 {
+		total = input + output
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover(time.Now())
+
+	u := t.state.Providers[provider]
+	if u == nil {
+		u = &usage{}
+		t.state.Providers[provider] = u
+	}
+	u.Calls++
+	u.Tokens += total
+	if price, ok := t.price(model); ok {
+		u.Cost += (float64(input)*price.Input + float64(output)*price.Output) / 1e6
+	} else if t.opts.Limits[provider].MaxCostPerDay > 0 && !t.unpriced[model] {
+		t.unpriced[model] = true
+		log.Printf("[Budget] 模型 %s 没有配置单价（budget.prices），它的花费不计入 maxCostPerDay", model)
+	}
+	t.save()
+}
+
+// Report 返回各提供商当天的用量（用于 /status），未启用时返回空字符串
+func (t *Tracker) Report() string {
+	if !t.Enabled() {
+		return ""
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.rollover(now)
+
+	names := make([]string, 0, len(t.opts.Limits))
+	for name, limit := range t.opts.Limits {
+		if limit.enabled() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\nBudget today (resets %s):", t.nextReset(now).Format("01-02 15:04"))
+	for _, name := range names {
+		limit := t.opts.Limits[name]
+		u := t.state.Providers[name]
+		if u == nil {
+			u = &usage{}
+		}
+		fmt.Fprintf(&sb, "\n  %s: %d tokens", name, u.Tokens)
+		if limit.MaxTokensPerDay > 0 {
+			fmt.Fprintf(&sb, " / %d", limit.MaxTokensPerDay)
+		}
+		fmt.Fprintf(&sb, ", $%.2f", u.Cost)
+		if limit.MaxCostPerDay > 0 {
+			fmt.Fprintf(&sb, " / $%.2f", limit.MaxCostPerDay)
+		}
+	}
+	return sb.String()
+}
+
+// price 查找模型的单价：先精确匹配，再取最长的前缀匹配（例如 "claude-sonnet-4" 匹配带日期的版本）
+func (t *Tracker) price(model string) (Price, bool) {
+	if price, ok := t.opts.Prices[model]; ok {
+		return price, true
+	}
+	best, found := "", false
+	for name := range t.opts.Prices {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best, found = name, true
+		}
+	}
+	return t.opts.Prices[best], found
+}
+
+// day 返回时间 t 所在的预算日
+func (t *Tracker) day(now time.Time) string {
+	return now.Add(-time.Duration(t.opts.ResetAt) * time.Minute).Format("2006-01-02")
+}
+
+// nextReset 返回下一次清零的时间
+func (t *Tracker) nextReset(now time.Time) time.Time {
+	reset := time.Date(now.Year(), now.Month(), now.Day(), t.opts.ResetAt/60, t.opts.ResetAt%60, 0, 0, now.Location())
+	if !reset.After(now) {
+		reset = reset.AddDate(0, 0, 1)
+	}
+	return reset
+}
+
+// rollover 跨预算日时清零用量（调用方需持有 t.mu）
+func (t *Tracker) rollover(now time.Time) {
+	today := t.day(now)
+	if t.state.Day != today {
+		t.state = state{Day: today, Providers: make(map[string]*usage)}
+	}
+}
+
+// load 读取保存的每日用量
+func (t *Tracker) load() {
+	t.rollover(time.Now())
+	if t.opts.StatePath == "" {
+		return
+	}
+	data, err := os.ReadFile(t.opts.StatePath)
+	if err != nil {
+		return
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		log.Printf("[Budget] 读取 %s 失败: %v", t.opts.StatePath, err)
+		return
+	}
+	if st.Day == t.state.Day && st.Providers != nil {
+		t.state = st
+	}
+}
+
+// save 保存每日用量（调用方需持有 t.mu）
+func (t *Tracker) save() {
+	if t.opts.StatePath == "" {
+		return
+	}
+	data, err := json.MarshalIndent(t.state, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(t.opts.StatePath), 0755); err != nil {
+		log.Printf("[Budget] 保存用量失败: %v", err)
+		return
+	}
+	if err := os.WriteFile(t.opts.StatePath, data, 0644); err != nil {
+		log.Printf("[Budget] 保存用量失败: %v", err)
+	}
+}
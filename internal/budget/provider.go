@@ -0,0 +1,112 @@
+package budget
+
+// provider.go - 在 LLM 提供商外层检查和记录每日预算
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/Ailoc/nanogrip/internal/providers"
+)
+
+// Provider 包装一个 LLM 提供商：调用前检查模型所属提供商的预算，调用后记录用量
+// 预算用完时，配置了备用模型就改用备用模型，否则返回 *ExceededError
+// 备用模型的调用仍然计入用量，但不受限制（不希望继续产生费用时不要配置备用模型）
+type Provider struct {
+	inner    providers.LLMProvider
+	tracker  *Tracker
+	fallback *providers.Fallback
+}
+
+// NewProvider 创建带预算检查的提供商
+// 参数:
+//
+//	inner: 被包装的提供商
+//	tracker: 共享的用量记录（所有提供商实例使用同一个）
+//	fallback: 预算用完后使用的备用模型，nil 表示直接拒绝
+func NewProvider(inner providers.LLMProvider, tracker *Tracker, fallback *providers.Fallback) *Provider {
+	return &Provider{
+		inner:    inner,
+		tracker:  tracker,
+		fallback: fallback,
+	}
+}
+
+// GetDefaultModel 返回被包装提供商的默认模型
+func (p *Provider) GetDefaultModel() string {
+	return p.inner.GetDefaultModel()
+}
+
+// Chat 检查预算后发送请求并记录用量
+func (p *Provider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDef, model string, maxTokens int, temperature float64) (*providers.LLMResponse, error) {
+	candidate, err := p.choose(model)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := candidate.Provider.Chat(ctx, messages, tools, candidate.Model, maxTokens, temperature)
+	if err == nil {
+		p.record(candidate.Model, resp)
+	}
+	return resp, err
+}
+
+// ChatStream 检查预算后发送流式请求并记录用量
+// 被选中的提供商不支持流式输出时，改用 Chat 并把完整回复作为一次增量
+func (p *Provider) ChatStream(ctx context.Context, messages []providers.Message, tools []providers.ToolDef, model string, maxTokens int, temperature float64, onDelta providers.StreamCallback) (*providers.LLMResponse, error) {
+	candidate, err := p.choose(model)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *providers.LLMResponse
+	if streaming, ok := candidate.Provider.(providers.StreamingLLMProvider); ok {
+		resp, err = streaming.ChatStream(ctx, messages, tools, candidate.Model, maxTokens, temperature, onDelta)
+	} else {
+		resp, err = candidate.Provider.Chat(ctx, messages, tools, candidate.Model, maxTokens, temperature)
+		if err == nil && onDelta != nil && resp.Content != "" {
+			onDelta(resp.Content)
+		}
+	}
+	if err == nil {
+		p.record(candidate.Model, resp)
+	}
+	return resp, err
+}
+
+// choose 返回本次请求使用的提供商和模型
+func (p *Provider) choose(model string) (providers.Fallback, error) {
+	if model == "" {
+		model = p.inner.GetDefaultModel()
+	}
+	err := p.tracker.Check(providerOf(model))
+	if err == nil {
+		return providers.Fallback{Provider: p.inner, Model: model}, nil
+	}
+
+	var exceeded *ExceededError
+	if p.fallback != nil && errors.As(err, &exceeded) {
+		if model != p.fallback.Model {
+			log.Printf("[Budget] %v，改用备用模型 %s", err, p.fallback.Model)
+		}
+		return *p.fallback, nil
+	}
+	return providers.Fallback{}, err
+}
+
+// record 记录一次成功调用的用量
+func (p *Provider) record(model string, resp *providers.LLMResponse) {
+	if resp == nil {
+		return
+	}
+	p.tracker.Record(providerOf(model), model, resp.Usage)
+}
+
+// providerOf 返回模型所属的提供商名称，无法识别时返回模型名称本身
+func providerOf(model string) string {
+	name, _, err := providers.ResolveModel(model)
+	if err != nil {
+		return model
+	}
+	return string(name)
+}
@@ -5,16 +5,20 @@
 //     之间无需直接依赖,降低了系统的耦合度。
 //  2. 异步处理: 采用基于 Go channel 的缓冲队列,实现了生产者-消费者模式,
 //     允许消息的异步发送和接收。
-//  3. 双向通信: 提供了 inbound(入站)和 outbound(出站)两个独立的消息通道,
+//  3. 双向通信: 提供了 inbound(入站)和 outbound(出站)两个方向的消息通道,
 //     分别处理从通道到智能体的消息和从智能体到通道的消息。
+//     出站消息按目标通道分发:每个通道适配器通过 SubscribeOutbound 只接收发给自己的消息。
 //  4. 流量控制: 通过缓冲区大小控制消息队列长度,防止系统过载。
 package bus
 
 import (
 	"context"
+	"log"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/Ailoc/nanogrip/internal/trace"
 )
 
 // Message 表示一个聊天消息的基础结构。
@@ -29,6 +33,10 @@ type Message struct {
 	Metadata   map[string]interface{} // 附加的元数据,用于存储通道特定的扩展信息
 	Timestamp  time.Time              // 消息的时间戳
 	SessionKey string                 // 会话密钥,用于关联和追踪会话上下文
+
+	// QueueSeq 是消息在持久化队列中的序号(未启用持久化时为 0),
+	// 处理完成后通过 MarkProcessed 标记
+	QueueSeq uint64
 }
 
 // InboundMessage 表示从外部通道进入系统的入站消息。
@@ -38,6 +46,20 @@ type InboundMessage struct {
 	Message // 嵌入 Message 结构体,继承所有字段
 }
 
+// ObserveKey 是入站消息元数据中的键,值为 true 表示消息只需记入会话历史、不回复
+// (频道的旁听模式下,群聊中没有对机器人说的消息)。
+const ObserveKey = "observe"
+
+// SenderNameKey 是入站消息元数据中发送者显示名称的键(例如 Telegram 的名字),
+// 旁听记录的消息用它标明是谁说的。
+const SenderNameKey = "sender_name"
+
+// Observed 判断消息是否只需记录、不回复(见 ObserveKey)。
+func (m Message) Observed() bool {
+	observed, _ := m.Metadata[ObserveKey].(bool)
+	return observed
+}
+
 // OutboundMessage 表示从系统发送到外部通道的出站消息。
 // 这种消息由智能体处理完成后发布到消息总线,然后由相应的通道适配器
 // 消费并发送给最终用户。出站消息流向: 智能体 -> MessageBus -> 通道
@@ -52,24 +74,33 @@ type OutboundMessage struct {
 // MessageBus 是一个异步消息总线,用于实现通道和智能体之间的解耦通信。
 //
 // 工作原理:
-// - 使用两个独立的 Go channel 作为消息队列(inbound 和 outbound)
-// - 每个 channel 都有缓冲区,允许一定数量的消息排队等待处理
-// - 采用发布-订阅模式:生产者发布消息,消费者订阅并消费消息
-// - 支持优雅关闭:通过 context 控制生命周期,确保资源正确释放
+//   - 入站消息按优先级使用两个 Go channel 作为队列,由智能体竞争消费,高优先级先处理(见 priority.go)
+//   - 出站消息按目标通道名称(主题)分发到各自的订阅队列(见 SubscribeOutbound),
+//     没有订阅者的消息不会静默丢失,而是交给 OnUndeliverable 设置的处理函数
+//   - 每个队列都有缓冲区,允许一定数量的消息排队等待处理
+//   - 采用发布-订阅模式:生产者发布消息,消费者订阅并消费消息
+//   - 支持优雅关闭:通过 context 控制生命周期,确保资源正确释放
 //
 // 线程安全:
 // - Go channel 本身是线程安全的,支持多个 goroutine 并发读写
 // - context 用于协调多个 goroutine 的生命周期
 // - sync.WaitGroup 用于等待所有后台任务完成
 type MessageBus struct {
-	inbound   chan InboundMessage  // 入站消息通道:存储从通道适配器到智能体的消息
-	outbound  chan OutboundMessage // 出站消息通道:存储从智能体到通道适配器的消息
-	ctx       context.Context      // 上下文对象,用于控制消息总线的生命周期
-	cancel    context.CancelFunc   // 取消函数,用于触发消息总线的关闭流程
-	wg        sync.WaitGroup       // 等待组,用于等待所有后台 goroutine 完成
-	mu        sync.RWMutex         // 保护关闭与发布之间的边界
-	closeOnce sync.Once            // 确保关闭流程只执行一次
-	closed    atomic.Bool          // 是否已关闭
+	inbound   chan InboundMessage // 高优先级入站消息通道:存储用户直接发来的消息
+	ctx       context.Context     // 上下文对象,用于控制消息总线的生命周期
+	cancel    context.CancelFunc  // 取消函数,用于触发消息总线的关闭流程
+	wg        sync.WaitGroup      // 等待组,用于等待所有后台 goroutine 完成
+	mu        sync.RWMutex        // 保护关闭与发布之间的边界,以及 outbound 和 undeliverable
+	closeOnce sync.Once           // 确保关闭流程只执行一次
+	closed    atomic.Bool         // 是否已关闭
+	dedup     *dedupCache         // 入站消息去重缓存,nil 表示不去重
+
+	inboundLow    chan InboundMessage             // 低优先级入站消息通道:子代理公告等后台消息
+	bufferSize    int                             // 队列的默认缓冲区大小
+	outbound      map[string]chan OutboundMessage // 出站订阅:通道名称 -> 该通道的出站队列
+	undeliverable func(OutboundMessage, error)    // 出站消息无法放入订阅队列时调用,nil 表示只记录日志
+
+	journal *queueJournal // 持久化队列,nil 表示不持久化
 }
 
 // New 创建并返回一个新的 MessageBus 实例。
@@ -91,10 +122,13 @@ type MessageBus struct {
 func New(bufferSize int) *MessageBus {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &MessageBus{
-		inbound:  make(chan InboundMessage, bufferSize),  // 创建带缓冲的入站消息通道
-		outbound: make(chan OutboundMessage, bufferSize), // 创建带缓冲的出站消息通道
-		ctx:      ctx,                                    // 设置上下文
-		cancel:   cancel,                                 // 保存取消函数
+		inbound:    make(chan InboundMessage, bufferSize), // 创建带缓冲的高优先级入站消息通道
+		inboundLow: make(chan InboundMessage, bufferSize), // 低优先级通道使用独立的缓冲区
+		outbound:   make(map[string]chan OutboundMessage), // 出站订阅在 SubscribeOutbound 时创建
+		bufferSize: bufferSize,                            // 出站订阅队列的默认大小
+		dedup:      newDedupCache(DefaultDedupTTL),        // 默认丢弃 10 分钟内重复投递的消息
+		ctx:        ctx,                                   // 设置上下文
+		cancel:     cancel,                                // 保存取消函数
 	}
 }
 
@@ -111,7 +145,7 @@ func New(bufferSize int) *MessageBus {
 //	        如果消息总线已关闭返回 context 错误
 //
 // 发布机制(使用 select 语句实现非阻塞发布):
-// 1. case b.inbound <- msg: 尝试将消息发送到入站通道
+// 1. case b.lane(msg) <- msg: 尝试将消息发送到所属优先级的入站通道
 //   - 如果通道有空间,消息立即被放入缓冲区,返回 nil
 //   - 如果通道已满且没有消费者在读取,会尝试下一个 case
 //
@@ -121,9 +155,14 @@ func New(bufferSize int) *MessageBus {
 // 3. default: 如果上述两个 case 都无法执行(即通道满且总线未关闭)
 //   - 立即返回 ErrBusFull 错误,避免阻塞调用者
 //
+// 消息按 PriorityOf 放入高优先级或低优先级通道,后台消息占满低优先级通道时不影响用户消息。
+//
 // 注意事项:
 // - 这是一个非阻塞操作,不会因为缓冲区满而永久等待
 // - 调用者应该处理 ErrBusFull 错误,可以选择重试或丢弃消息
+// - 带消息 ID 的消息会去重:同一通道、同一 ID 在 TTL 内再次发布时直接丢弃并返回 nil
+// - 没有追踪 ID 的消息会在元数据中加上 trace_id(见 trace 包)
+// - 启用持久化(EnablePersistence)时消息在入队前写入队列文件,处理完成后需调用 MarkProcessed
 func (b *MessageBus) PublishInbound(msg InboundMessage) error {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
@@ -132,12 +171,42 @@ func (b *MessageBus) PublishInbound(msg InboundMessage) error {
 		return context.Canceled
 	}
 
+	// 丢弃重复投递的消息(同一通道、同一消息 ID)
+	key := dedupKey(msg)
+	if key != "" && b.dedup != nil {
+		if !b.dedup.mark(key) {
+			log.Printf("[Bus] 丢弃重复的入站消息: %s", key)
+			return nil
+		}
+	}
+
+	// 为消息分配追踪 ID(复制元数据,不修改通道传入的 map)
+	if trace.FromMetadata(msg.Metadata) == "" {
+		metadata := make(map[string]interface{}, len(msg.Metadata)+1)
+		for k, v := range msg.Metadata {
+			metadata[k] = v
+		}
+		metadata[trace.MetadataKey] = trace.NewID()
+		msg.Metadata = metadata
+	}
+
+	// 先写入持久化队列再入队,入队失败时立即标记为已处理
+	if b.journal != nil {
+		msg.QueueSeq = b.journal.add(msg)
+	}
+
 	select {
 	case <-b.ctx.Done():
+		b.journal.done(msg.QueueSeq)
 		return b.ctx.Err()
-	case b.inbound <- msg:
+	case b.lane(msg) <- msg:
 		return nil
 	default:
+		b.journal.done(msg.QueueSeq)
+		// 发布失败时允许通道重试
+		if key != "" && b.dedup != nil {
+			b.dedup.forget(key)
+		}
 		return ErrBusFull
 	}
 }
@@ -155,11 +224,11 @@ func (b *MessageBus) PublishInbound(msg InboundMessage) error {
 //	error - 如果成功消费返回 nil;如果 context 被取消或超时返回相应错误
 //
 // 消费机制(使用 select 语句实现可取消的阻塞消费):
-// 1. case msg := <-b.inbound: 从入站通道接收消息
-//   - 如果通道中有消息,立即读取并返回
-//   - 如果通道为空,会阻塞等待,直到有新消息到达或 context 被取消
+// 1. 高优先级通道中有消息时立即读取并返回,低优先级的消息只在没有高优先级消息时处理
+//
+// 2. 两个通道都为空时阻塞等待,哪个通道先有新消息就返回哪个
 //
-// 2. case <-ctx.Done(): 等待 context 取消信号
+// 3. case <-ctx.Done(): 等待 context 取消信号
 //   - 如果 context 被取消(超时或主动取消),返回空消息和 context 错误
 //   - 这允许调用者设置超时或在需要时中断等待
 //
@@ -168,9 +237,18 @@ func (b *MessageBus) PublishInbound(msg InboundMessage) error {
 // - 可以通过传入带超时的 context 来避免无限期等待
 // - 多个 goroutine 可以同时消费,消息会被平均分配(竞争消费模式)
 func (b *MessageBus) ConsumeInbound(ctx context.Context) (InboundMessage, error) {
+	// 先检查高优先级通道,避免 select 在两个都就绪的通道间随机选择
+	select {
+	case msg := <-b.inbound:
+		return msg, nil
+	default:
+	}
+
 	select {
 	case msg := <-b.inbound:
 		return msg, nil
+	case msg := <-b.inboundLow:
+		return msg, nil
 	case <-b.ctx.Done():
 		return InboundMessage{}, b.ctx.Err()
 	case <-ctx.Done():
@@ -178,8 +256,53 @@ func (b *MessageBus) ConsumeInbound(ctx context.Context) (InboundMessage, error)
 	}
 }
 
+// SubscribeOutbound 订阅发往指定通道的出站消息。
+// 通道适配器(或为其发送消息的分发器)调用此方法,只接收 Channel 字段等于 channel 的消息,
+// 不需要由一个消费者替所有通道路由。
+//
+// 参数:
+//
+//	channel - 通道名称(如 "telegram")
+//	bufferSize - 订阅队列的缓冲区大小,<= 0 表示使用 New 的 bufferSize
+//
+// 返回:
+//
+//	<-chan OutboundMessage - 该通道的出站消息队列
+//
+// 注意事项:
+// - 每个通道只有一个订阅队列,重复订阅返回同一个队列(多个消费者竞争消费)
+// - 订阅之前发布的消息不会补发,应在发布者开始工作之前订阅
+// - 消息总线关闭时不会关闭队列(与 inbound 相同),消费者应同时监听自己的 context
+func (b *MessageBus) SubscribeOutbound(channel string, bufferSize int) <-chan OutboundMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if queue, ok := b.outbound[channel]; ok {
+		return queue
+	}
+	if bufferSize <= 0 {
+		bufferSize = b.bufferSize
+	}
+	queue := make(chan OutboundMessage, bufferSize)
+	b.outbound[channel] = queue
+	return queue
+}
+
+// OnUndeliverable 设置出站消息无法投递时的处理函数。
+// 目标通道没有订阅者(ErrNoSubscriber)或订阅队列已满(ErrBusFull)时,
+// PublishOutbound 除了返回错误,还会调用此函数(例如写入死信文件以便补发)。
+//
+// 参数:
+//
+//	fn - 处理函数,nil 表示只记录日志
+func (b *MessageBus) OnUndeliverable(fn func(msg OutboundMessage, err error)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.undeliverable = fn
+}
+
 // PublishOutbound 发布一条出站消息到消息总线。
-// 这个方法由智能体调用,将处理完成的响应发送给通道适配器。
+// 这个方法由智能体调用,将处理完成的响应发送给目标通道的订阅队列。
 //
 // 参数:
 //
@@ -187,23 +310,18 @@ func (b *MessageBus) ConsumeInbound(ctx context.Context) (InboundMessage, error)
 //
 // 返回:
 //
-//	error - 如果发布成功返回 nil;如果缓冲区已满返回 ErrBusFull;
-//	        如果消息总线已关闭返回 context 错误
+//	error - 如果发布成功返回 nil;如果目标通道没有订阅者返回 ErrNoSubscriber;
+//	        如果订阅队列已满返回 ErrBusFull;如果消息总线已关闭返回 context 错误
 //
 // 发布机制(与 PublishInbound 相同的非阻塞模式):
-// 1. case b.outbound <- msg: 尝试将消息发送到出站通道
-//   - 如果通道有空间,消息立即被放入缓冲区,返回 nil
-//   - 如果通道已满,会尝试下一个 case
-//
-// 2. case <-b.ctx.Done(): 检查消息总线是否已关闭
-//   - 如果已关闭,返回 context 的错误信息
-//
-// 3. default: 如果通道满且总线未关闭
-//   - 立即返回 ErrBusFull 错误,避免阻塞调用者
+// 1. 按 msg.Channel 查找订阅队列,找不到时记录日志并交给 OnUndeliverable 的处理函数
+// 2. case queue <- msg: 尝试将消息放入订阅队列
+// 3. case <-b.ctx.Done(): 检查消息总线是否已关闭
+// 4. default: 如果队列满且总线未关闭,交给处理函数并返回 ErrBusFull,避免阻塞调用者
 //
 // 使用场景:
 // - 智能体处理完入站消息后,通过此方法发送响应
-// - 响应会被放入出站队列,等待相应的通道适配器消费并发送
+// - 响应会被放入目标通道的队列,等待该通道的订阅者消费并发送
 func (b *MessageBus) PublishOutbound(msg OutboundMessage) error {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
@@ -212,48 +330,28 @@ func (b *MessageBus) PublishOutbound(msg OutboundMessage) error {
 		return context.Canceled
 	}
 
+	queue, ok := b.outbound[msg.Channel]
+	if !ok {
+		log.Printf("[Bus] 通道 %q 没有出站订阅者,消息无法投递 (chat_id=%s)", msg.Channel, msg.ChatID)
+		b.reportUndeliverable(msg, ErrNoSubscriber)
+		return ErrNoSubscriber
+	}
+
 	select {
 	case <-b.ctx.Done():
 		return b.ctx.Err()
-	case b.outbound <- msg:
+	case queue <- msg:
 		return nil
 	default:
+		b.reportUndeliverable(msg, ErrBusFull)
 		return ErrBusFull
 	}
 }
 
-// ConsumeOutbound 从消息总线消费下一条出站消息。
-// 这个方法由通道适配器调用,接收智能体发送的响应消息并发送给最终用户。
-//
-// 参数:
-//
-//	ctx - 上下文对象,用于控制消费操作的超时和取消
-//
-// 返回:
-//
-//	OutboundMessage - 消费到的出站消息
-//	error - 如果成功消费返回 nil;如果 context 被取消或超时返回相应错误
-//
-// 消费机制(与 ConsumeInbound 相同的可取消阻塞模式):
-// 1. case msg := <-b.outbound: 从出站通道接收消息
-//   - 如果通道中有消息,立即读取并返回
-//   - 如果通道为空,会阻塞等待,直到有新消息到达或 context 被取消
-//
-// 2. case <-ctx.Done(): 等待 context 取消信号
-//   - 如果 context 被取消,返回空消息和 context 错误
-//
-// 使用场景:
-// - 各个通道适配器在循环中调用此方法,等待并发送出站消息
-// - 每个通道适配器只处理发送给自己的消息(通过 Channel 字段识别)
-// - 多个通道适配器可以同时消费,根据 Channel 字段过滤自己的消息
-func (b *MessageBus) ConsumeOutbound(ctx context.Context) (OutboundMessage, error) {
-	select {
-	case msg := <-b.outbound:
-		return msg, nil
-	case <-b.ctx.Done():
-		return OutboundMessage{}, b.ctx.Err()
-	case <-ctx.Done():
-		return OutboundMessage{}, ctx.Err()
+// reportUndeliverable 调用 OnUndeliverable 设置的处理函数(调用方需持有 b.mu 的读锁)
+func (b *MessageBus) reportUndeliverable(msg OutboundMessage, err error) {
+	if b.undeliverable != nil {
+		b.undeliverable(msg, err)
 	}
 }
 
@@ -261,7 +359,7 @@ func (b *MessageBus) ConsumeOutbound(ctx context.Context) (OutboundMessage, erro
 //
 // 返回:
 //
-//	int - 入站通道缓冲区中的消息数量
+//	int - 两个优先级的入站通道缓冲区中的消息总数(分别查看见 InboundSizeOf)
 //
 // 用途:
 // - 监控消息积压情况,如果返回值接近缓冲区大小,说明智能体处理速度较慢
@@ -272,14 +370,14 @@ func (b *MessageBus) ConsumeOutbound(ctx context.Context) (OutboundMessage, erro
 // - len() 函数对 channel 的调用是原子操作,线程安全
 // - 返回值只是瞬时快照,调用后队列长度可能立即发生变化
 func (b *MessageBus) InboundSize() int {
-	return len(b.inbound)
+	return len(b.inbound) + len(b.inboundLow)
 }
 
 // OutboundSize 返回当前出站消息队列中待发送的消息数量。
 //
 // 返回:
 //
-//	int - 出站通道缓冲区中的消息数量
+//	int - 所有通道的出站订阅队列中的消息总数
 //
 // 用途:
 // - 监控消息发送积压情况,如果返回值较大,说明通道适配器发送速度较慢
@@ -290,7 +388,13 @@ func (b *MessageBus) InboundSize() int {
 // - len() 函数对 channel 的调用是原子操作,线程安全
 // - 返回值只是瞬时快照,调用后队列长度可能立即发生变化
 func (b *MessageBus) OutboundSize() int {
-	return len(b.outbound)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	size := 0
+	for _, queue := range b.outbound {
+		size += len(queue)
+	}
+	return size
 }
 
 // Close 优雅地关闭消息总线,释放所有资源。
@@ -298,12 +402,12 @@ func (b *MessageBus) OutboundSize() int {
 // 关闭流程:
 // 1. 调用 cancel() 函数,触发 context 取消
 //   - 这会导致所有阻塞在 PublishInbound/PublishOutbound 的调用收到取消信号
-//   - 所有正在进行的 ConsumeInbound/ConsumeOutbound 调用也会收到取消信号
+//   - 所有正在进行的 ConsumeInbound 调用也会收到取消信号
 //
 // 2. 等待所有后台 goroutine 完成(通过 sync.WaitGroup)
 //   - 确保所有正在处理的任务都已完成
 //
-// 3. 保留 inbound 和 outbound 通道不关闭
+// 3. 保留 inbound 和 outbound 订阅队列不关闭
 //   - Close 与生产者并发时关闭 channel 会导致 send panic
 //   - 关闭后发布方法通过上下文返回取消错误
 //
@@ -319,6 +423,7 @@ func (b *MessageBus) Close() {
 		b.cancel() // 触发 context 取消,通知所有正在等待的操作
 		b.mu.Unlock()
 		b.wg.Wait() // 等待所有后台 goroutine 完成
+		b.journal.close()
 	})
 }
 
@@ -326,7 +431,7 @@ func (b *MessageBus) Close() {
 //
 // 何时返回此错误:
 // - 当调用 PublishInbound 时,如果入站通道的缓冲区已满
-// - 当调用 PublishOutbound 时,如果出站通道的缓冲区已满
+// - 当调用 PublishOutbound 时,如果目标通道的出站订阅队列已满
 //
 // 错误处理建议:
 // 1. 重试策略: 可以在短暂延迟后重试发布操作
@@ -338,6 +443,10 @@ func (b *MessageBus) Close() {
 // 这是一个全局变量,所有 MessageBus 实例共享同一个错误对象。
 var ErrBusFull = &BusError{"message bus is full"}
 
+// ErrNoSubscriber 是出站消息的目标通道没有订阅者时返回的错误。
+// 通常表示通道未启用或名称写错;消息同时会交给 OnUndeliverable 设置的处理函数。
+var ErrNoSubscriber = &BusError{"no subscriber for outbound channel"}
+
 // BusError 是消息总线相关错误的类型。
 // 实现了 error 接口,可以直接作为错误返回。
 type BusError struct {
@@ -0,0 +1,82 @@
+package bus
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultDedupTTL 是入站消息去重的默认记忆时间
+const DefaultDedupTTL = 10 * time.Minute
+
+// dedupCache 记录最近发布过的入站消息,用于丢弃重复投递的消息。
+//
+// 通道在网络重试、重复推送(例如 Telegram 重新下发同一个 update)时,
+// 可能把同一条消息发布两次,导致智能体处理两遍、重复回复。
+// 缓存以 "通道:消息ID" 为键,在 TTL 内再次出现的相同键会被丢弃。
+// 没有消息 ID 的消息(例如子代理公告)不参与去重。
+type dedupCache struct {
+	ttl       time.Duration
+	seen      map[string]time.Time // 键 -> 首次发布时间
+	lastSweep time.Time            // 上次清理过期记录的时间
+	mu        sync.Mutex
+}
+
+// newDedupCache 创建去重缓存
+func newDedupCache(ttl time.Duration) *dedupCache {
+	return &dedupCache{
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+	}
+}
+
+// dedupKey 返回消息的去重键,没有消息 ID 时返回空字符串
+func dedupKey(msg InboundMessage) string {
+	if msg.ID == "" {
+		return ""
+	}
+	return msg.Channel + ":" + msg.ID
+}
+
+// mark 记录一条消息,如果该消息在 TTL 内已经出现过则返回 false
+func (d *dedupCache) mark(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(d.lastSweep) > d.ttl {
+		for k, t := range d.seen {
+			if now.Sub(t) > d.ttl {
+				delete(d.seen, k)
+			}
+		}
+		d.lastSweep = now
+	}
+
+	if t, ok := d.seen[key]; ok && now.Sub(t) <= d.ttl {
+		return false
+	}
+	d.seen[key] = now
+	return true
+}
+
+// forget 删除一条记录(消息发布失败时调用,允许通道重试)
+func (d *dedupCache) forget(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, key)
+}
+
+// SetDedupTTL 设置入站消息去重的记忆时间。
+//
+// 参数:
+//
+//	ttl - 记忆时间,<= 0 表示关闭去重
+func (b *MessageBus) SetDedupTTL(ttl time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ttl <= 0 {
+		b.dedup = nil
+		return
+	}
+	b.dedup = newDedupCache(ttl)
+}
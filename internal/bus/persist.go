@@ -0,0 +1,329 @@
+package bus
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/secrets"
+)
+
+// persist.go - 持久化入站队列
+// 入站消息默认只存在于 channel 缓冲区中,进程崩溃或重启时排队的消息会全部丢失。
+// 启用持久化后,每条入站消息在入队前追加到队列文件(通常为 workspace/queue.jsonl),
+// 处理完成后追加一条完成记录;下次启动时没有完成记录的消息会按原顺序重新入队。
+//
+// 队列文件每行一条记录:
+//
+//	{"op":"add","seq":1,"msg":{...}}
+//	{"op":"done","seq":1}
+//
+// 所有消息处理完成时文件被清空,启动时只保留未完成的记录,因此文件不会无限增长。
+// 队列文件权限为 0600;启用会话加密(secrets.encryptSessions)时每一行用同一个密钥加密,
+// 排队中的消息内容、元数据和媒体不会以明文保存在磁盘上。
+
+// journalRecord 是队列文件中的一条记录
+type journalRecord struct {
+	Op  string         `json:"op"`            // "add" 或 "done"
+	Seq uint64         `json:"seq"`           // 消息序号
+	Msg *queuedMessage `json:"msg,omitempty"` // 消息内容(仅 add 记录)
+}
+
+// queuedMessage 是队列文件中保存的入站消息
+type queuedMessage struct {
+	ID         string                 `json:"id,omitempty"`
+	Channel    string                 `json:"channel"`
+	SenderID   string                 `json:"sender_id"`
+	ChatID     string                 `json:"chat_id"`
+	Content    string                 `json:"content"`
+	Media      []string               `json:"media,omitempty"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp  time.Time              `json:"timestamp"`
+	SessionKey string                 `json:"session_key,omitempty"`
+}
+
+// queueJournal 负责读写队列文件
+// 所有方法在接收者为 nil 时什么也不做(未启用持久化)
+type queueJournal struct {
+	path    string
+	cipher  *secrets.Cipher // 加密每一行(nil 表示明文保存)
+	file    *os.File
+	nextSeq uint64
+	pending map[uint64]bool // 尚未处理完成的消息序号
+	mu      sync.Mutex
+}
+
+// EnablePersistence 启用持久化入站队列,并把上次未处理完成的消息重新入队
+// 应该在通道和智能体启动之前调用。
+//
+// 参数:
+//
+//	path - 队列文件路径(通常为 workspace/queue.jsonl)
+//	cipher - 加密队列文件的每一行,nil 表示明文保存(仍能读取之前加密的记录则需要密钥)
+//
+// 返回:
+//
+//	int - 重新入队的消息数量
+//	error - 队列文件无法读取或写入时返回错误
+func (b *MessageBus) EnablePersistence(path string, cipher *secrets.Cipher) (int, error) {
+	pending, err := readJournal(path, cipher)
+	if err != nil {
+		return 0, err
+	}
+
+	// 重写队列文件,只保留未完成的消息(序号从 1 重新开始)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	tmp := path + ".tmp"
+	os.Remove(tmp) // 上次留下的临时文件可能权限过宽
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	journal := &queueJournal{path: path, cipher: cipher, pending: make(map[uint64]bool)}
+	w := bufio.NewWriter(f)
+	for i := range pending {
+		journal.nextSeq++
+		pending[i].QueueSeq = journal.nextSeq
+		journal.pending[journal.nextSeq] = true
+		line, err := journal.encode(journalRecord{Op: "add", Seq: journal.nextSeq, Msg: toQueued(pending[i])})
+		if err != nil {
+			f.Close()
+			return 0, err
+		}
+		w.Write(line)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+
+	journal.file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	b.journal = journal
+	b.mu.Unlock()
+
+	// 通道可能重新投递同一条消息,重新入队的消息也参与去重
+	for _, msg := range pending {
+		if key := dedupKey(msg); key != "" && b.dedup != nil {
+			b.dedup.mark(key)
+		}
+	}
+
+	// 重新入队(缓冲区放不下时在后台等待)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for _, msg := range pending {
+			select {
+			case b.lane(msg) <- msg:
+			case <-b.ctx.Done():
+				return
+			}
+		}
+	}()
+	return len(pending), nil
+}
+
+// MarkProcessed 标记一条入站消息已处理完成(无论成功与否)
+// 未启用持久化或消息不在持久化队列中时什么也不做。
+func (b *MessageBus) MarkProcessed(msg InboundMessage) {
+	b.mu.RLock()
+	journal := b.journal
+	b.mu.RUnlock()
+	journal.done(msg.QueueSeq)
+}
+
+// readJournal 读取队列文件,按原顺序返回没有完成记录的消息
+// 文件不存在时返回空列表;无法解析的行(例如崩溃时写了一半的行)会被跳过;
+// 有加密的行但没有密钥、或者最后一行之外的加密行无法解密(密钥不正确)时返回错误,避免丢弃排队的消息
+func readJournal(path string, cipher *secrets.Cipher) ([]InboundMessage, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var order []uint64
+	added := make(map[uint64]InboundMessage)
+	finished := make(map[uint64]bool)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	// 无法解密的行只有在它是最后一行时才可能是崩溃时写了一半的行
+	var decryptErr error
+	for scanner.Scan() {
+		if decryptErr != nil {
+			return nil, fmt.Errorf("queue file %s: %w", path, decryptErr)
+		}
+		line := scanner.Bytes()
+		if secrets.IsEncrypted(string(line)) {
+			if cipher == nil {
+				return nil, fmt.Errorf("queue file %s is encrypted: %w", path, secrets.ErrNoKey)
+			}
+			plain, err := cipher.Decrypt(string(line))
+			if err != nil {
+				decryptErr = err
+				continue
+			}
+			line = plain
+		}
+		var record journalRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			continue
+		}
+		switch record.Op {
+		case "add":
+			if record.Msg != nil {
+				order = append(order, record.Seq)
+				added[record.Seq] = record.Msg.inbound()
+			}
+		case "done":
+			finished[record.Seq] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []InboundMessage
+	for _, seq := range order {
+		if !finished[seq] {
+			pending = append(pending, added[seq])
+		}
+	}
+	return pending, nil
+}
+
+// add 追加一条 add 记录,返回分配的序号(写入失败时记录日志,消息仍然入队)
+func (j *queueJournal) add(msg InboundMessage) uint64 {
+	if j == nil {
+		return 0
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.nextSeq++
+	seq := j.nextSeq
+	j.pending[seq] = true
+	if err := j.write(journalRecord{Op: "add", Seq: seq, Msg: toQueued(msg)}); err != nil {
+		log.Printf("[Bus] 写入持久化队列失败: %v", err)
+		return seq
+	}
+	// 确保消息在崩溃前已经落盘
+	j.file.Sync()
+	return seq
+}
+
+// done 追加一条 done 记录;所有消息都处理完成时清空文件
+func (j *queueJournal) done(seq uint64) {
+	if j == nil || seq == 0 {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.pending[seq] {
+		return
+	}
+	delete(j.pending, seq)
+	if len(j.pending) == 0 && j.file != nil {
+		if err := j.file.Truncate(0); err == nil {
+			return
+		}
+	}
+	if err := j.write(journalRecord{Op: "done", Seq: seq}); err != nil {
+		log.Printf("[Bus] 写入持久化队列失败: %v", err)
+	}
+}
+
+// write 把一条记录追加到队列文件
+func (j *queueJournal) write(record journalRecord) error {
+	if j.file == nil {
+		return os.ErrClosed
+	}
+	line, err := j.encode(record)
+	if err != nil {
+		return err
+	}
+	_, err = j.file.Write(line)
+	return err
+}
+
+// encode 序列化并(如已启用)加密一条记录,返回以换行结尾的一行
+func (j *queueJournal) encode(record journalRecord) ([]byte, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if j.cipher != nil {
+		encrypted, err := j.cipher.Encrypt(data)
+		if err != nil {
+			return nil, err
+		}
+		data = []byte(encrypted)
+	}
+	return append(data, '\n'), nil
+}
+
+// close 关闭队列文件(未完成的消息保留在文件中,下次启动时重新处理)
+func (j *queueJournal) close() {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+}
+
+// toQueued 把入站消息转换为队列文件中的格式
+func toQueued(msg InboundMessage) *queuedMessage {
+	return &queuedMessage{
+		ID:         msg.ID,
+		Channel:    msg.Channel,
+		SenderID:   msg.SenderID,
+		ChatID:     msg.ChatID,
+		Content:    msg.Content,
+		Media:      msg.Media,
+		Metadata:   msg.Metadata,
+		Timestamp:  msg.Timestamp,
+		SessionKey: msg.SessionKey,
+	}
+}
+
+// inbound 把队列文件中的消息还原为入站消息
+func (q *queuedMessage) inbound() InboundMessage {
+	return InboundMessage{Message: Message{
+		ID:         q.ID,
+		Channel:    q.Channel,
+		SenderID:   q.SenderID,
+		ChatID:     q.ChatID,
+		Content:    q.Content,
+		Media:      q.Media,
+		Metadata:   q.Metadata,
+		Timestamp:  q.Timestamp,
+		SessionKey: q.SessionKey,
+	}}
+}
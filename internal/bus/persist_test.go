@@ -0,0 +1,140 @@
+package bus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/secrets"
+)
+
+func newTestCipher(t *testing.T, fill byte) *secrets.Cipher {
+	t.Helper()
+	c, err := secrets.NewCipher(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// fillJournal 发布 first、second、third 三条消息，只处理完 second，然后关闭总线
+func fillJournal(t *testing.T, path string, c *secrets.Cipher) {
+	t.Helper()
+	b := New(10)
+	if _, err := b.EnablePersistence(path, c); err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"first", "second", "third"} {
+		msg := InboundMessage{Message: Message{Channel: "telegram", SenderID: "alice", ChatID: "42", Content: content}}
+		if err := b.PublishInbound(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		msg := consume(t, b)
+		if msg.Content == "second" {
+			b.MarkProcessed(msg)
+		}
+	}
+	b.Close()
+}
+
+func consume(t *testing.T, b *MessageBus) InboundMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, err := b.ConsumeInbound(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestJournalReplay(t *testing.T) {
+	key := newTestCipher(t, 1)
+	tests := []struct {
+		name    string
+		write   *secrets.Cipher // 写入队列文件时的密钥
+		read    *secrets.Cipher // 重启后读取队列文件时的密钥
+		want    []string
+		errIs   error
+		wantErr bool
+	}{
+		{"plaintext", nil, nil, []string{"first", "third"}, nil, false},
+		{"encrypted", key, key, []string{"first", "third"}, nil, false},
+		{"plaintext read with a key", nil, key, []string{"first", "third"}, nil, false},
+		{"encrypted without a key", key, nil, nil, secrets.ErrNoKey, true},
+		{"encrypted with a wrong key", key, newTestCipher(t, 2), nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "queue.jsonl")
+			fillJournal(t, path, tt.write)
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.write != nil && bytes.Contains(data, []byte("third")) {
+				t.Fatal("queue file contains plaintext")
+			}
+			if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0600 {
+				t.Fatalf("queue file mode = %v, want 0600", info.Mode().Perm())
+			}
+
+			b := New(10)
+			defer b.Close()
+			count, err := b.EnablePersistence(path, tt.read)
+			if tt.wantErr {
+				if err == nil || (tt.errIs != nil && !errors.Is(err, tt.errIs)) {
+					t.Fatalf("EnablePersistence() error = %v, want %v", err, tt.errIs)
+				}
+				// 读取失败时不能改写队列文件
+				if after, _ := os.ReadFile(path); !bytes.Equal(after, data) {
+					t.Fatal("queue file was rewritten")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(tt.want) {
+				t.Fatalf("replayed %d messages, want %d", count, len(tt.want))
+			}
+			for _, want := range tt.want {
+				if msg := consume(t, b); msg.Content != want || msg.SenderID != "alice" {
+					t.Fatalf("replayed %q from %q, want %q from alice", msg.Content, msg.SenderID, want)
+				}
+			}
+		})
+	}
+}
+
+func TestJournalSkipsTornLastLine(t *testing.T) {
+	key := newTestCipher(t, 1)
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	fillJournal(t, path, key)
+
+	// 模拟崩溃时写了一半的最后一行
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(secrets.Prefix + "AAAA\n")
+	f.Close()
+
+	b := New(10)
+	defer b.Close()
+	count, err := b.EnablePersistence(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("replayed %d messages, want 2", count)
+	}
+}
@@ -0,0 +1,51 @@
+package bus
+
+// priority.go - 入站消息优先级
+// 入站消息分为两条通道(lane):用户直接发来的消息走高优先级,子代理公告、定时任务、
+// 心跳和旁听记录等后台消息走低优先级。两条通道各有独立的缓冲区,
+// ConsumeInbound 总是先取高优先级的消息,因此后台消息再多也不会占满缓冲区、拖慢交互对话。
+//
+// 发布者可以在元数据中用 PriorityKey 显式指定优先级;未指定时按 PriorityOf 的规则推断。
+
+// Priority 是入站消息的优先级
+type Priority string
+
+const (
+	PriorityHigh Priority = "high" // 用户直接发来的消息(默认)
+	PriorityLow  Priority = "low"  // 后台消息:子代理公告、定时任务、心跳、旁听记录
+)
+
+// PriorityKey 是入站消息元数据中显式指定优先级的键,值为 "high" 或 "low"
+const PriorityKey = "priority"
+
+// PriorityOf 返回入站消息的优先级
+// 元数据中指定了 PriorityKey 时使用指定的值;否则 "system" 通道的消息(子代理公告等)
+// 和旁听模式下只记录不回复的消息为低优先级,其他消息为高优先级。
+func PriorityOf(msg InboundMessage) Priority {
+	if p, ok := msg.Metadata[PriorityKey].(string); ok {
+		switch Priority(p) {
+		case PriorityHigh, PriorityLow:
+			return Priority(p)
+		}
+	}
+	if msg.Channel == "system" || msg.Observed() {
+		return PriorityLow
+	}
+	return PriorityHigh
+}
+
+// lane 返回消息所属优先级的入站通道
+func (b *MessageBus) lane(msg InboundMessage) chan InboundMessage {
+	if PriorityOf(msg) == PriorityLow {
+		return b.inboundLow
+	}
+	return b.inbound
+}
+
+// InboundSizeOf 返回指定优先级的入站队列中待处理的消息数量,用于监控
+func (b *MessageBus) InboundSizeOf(p Priority) int {
+	if p == PriorityLow {
+		return len(b.inboundLow)
+	}
+	return len(b.inbound)
+}
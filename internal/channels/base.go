@@ -5,6 +5,7 @@ package channels
 
 import (
 	"context"
+	"log"
 
 	"github.com/Ailoc/nanogrip/internal/bus"
 )
@@ -34,6 +35,12 @@ type Channel interface {
 	Send(msg bus.OutboundMessage) error
 }
 
+// Checker 是能够校验凭据的频道实现的可选接口（nanogrip doctor 和 gateway 启动检查使用）
+type Checker interface {
+	// Check 用频道的凭据调用一次平台 API，返回机器人身份（例如 "@my_bot"）
+	Check() (string, error)
+}
+
 // BaseChannel 提供频道的通用功能实现
 // 该结构体包含所有频道共享的基础字段和方法，可被具体频道实现嵌入使用
 // 通过组合模式，避免代码重复，统一管理频道的基本属性
@@ -42,6 +49,8 @@ type BaseChannel struct {
 	config  interface{}     // 频道特定的配置对象，由各具体实现定义
 	bus     *bus.MessageBus // 消息总线，用于在频道间传递消息
 	running bool            // 频道运行状态标志，true表示正在运行
+
+	inputHandler func(channel, chatID, senderID, input string) bool // 交互式输入回调（审批、等待输入的命令），nil 表示不拦截
 }
 
 // NewBaseChannel 创建一个新的基础频道实例
@@ -74,3 +83,23 @@ func (c *BaseChannel) Name() string {
 func (c *BaseChannel) IsRunning() bool {
 	return c.running
 }
+
+// SetInputHandler 设置交互式输入回调
+// 工具调用等待用户答复时（审批提示、等待输入的 shell 命令），AgentLoop 正阻塞在这次调用上，
+// 用户的下一条文本消息需要在频道层交给这个回调，而不是发布到消息总线
+// 回调收到频道名称、聊天 ID、发送者 ID（与入站消息的 SenderID 相同）和文本
+func (c *BaseChannel) SetInputHandler(handler func(channel, chatID, senderID, input string) bool) {
+	c.inputHandler = handler
+}
+
+// handleInput 把一条文本消息交给交互式输入回调
+// 返回:
+//
+//	输入已被消费时返回 true（调用方不再发布到消息总线）
+func (c *BaseChannel) handleInput(chatID, senderID, input string) bool {
+	if c.inputHandler == nil || !c.inputHandler(c.name, chatID, senderID, input) {
+		return false
+	}
+	log.Printf("[%s] Input routed to interaction handler for chat %s", c.name, chatID)
+	return true
+}
@@ -0,0 +1,279 @@
+package channels
+
+// capabilities.go - 频道能力声明与出站消息降级
+//
+// 不同频道支持的消息长度、媒体类型和格式各不相同。
+// 频道通过 Capabilities 声明自己的能力：
+//   - Agent 在系统提示词中看到当前频道的能力，从而生成合适的回复
+//   - 出站分发器（Dispatcher）在投递前调用 Adapt，把频道不支持的内容降级
+//     （例如不支持的文件改为发送链接、超长说明文字拆成单独的消息）
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+)
+
+// 媒体类型
+const (
+	MediaPhoto    = "photo"
+	MediaDocument = "document"
+	MediaAudio    = "audio"
+	MediaVideo    = "video"
+)
+
+// Markdown 方言
+const (
+	MarkdownHTML     = "html"     // Markdown 会被转换为 HTML（如 Telegram）
+	MarkdownStandard = "markdown" // 原样发送标准 Markdown
+	MarkdownPlain    = "plain"    // 不支持格式，只显示纯文本
+)
+
+// Capabilities 描述一个频道能发送什么样的消息
+type Capabilities struct {
+	MaxMessageLength int      // 单条文本消息的最大长度（字符），0 表示不限制
+	MaxCaptionLength int      // 媒体说明文字的最大长度（字符），0 表示不限制
+	MediaTypes       []string // 支持的媒体类型，空表示不支持发送媒体
+	Markdown         string   // Markdown 方言
+	Buttons          bool     // 是否支持内联按钮
+}
+
+// CapabilityProvider 是频道可选实现的接口
+// 未实现该接口的频道视为只支持纯文本
+type CapabilityProvider interface {
+	Capabilities() Capabilities
+}
+
+// TypingIndicator 是频道可选实现的接口
+// 实现该接口的频道可以在 Agent 处理消息期间显示"正在输入…"
+type TypingIndicator interface {
+	// SendTyping 在指定聊天中显示输入状态（通常几秒后自动消失，需要定期重新发送）
+	SendTyping(chatID string) error
+}
+
+// Reactor 是频道可选实现的接口
+// 实现该接口的频道可以用表情回应用户的消息，作为不产生额外消息的处理状态反馈
+type Reactor interface {
+	// React 用表情回应指定消息（替换机器人之前的回应），emoji 为空表示移除回应
+	React(chatID, messageID, emoji string) error
+}
+
+// CapabilitiesOf 返回频道的能力声明
+func CapabilitiesOf(ch Channel) Capabilities {
+	if provider, ok := ch.(CapabilityProvider); ok {
+		return provider.Capabilities()
+	}
+	return Capabilities{Markdown: MarkdownPlain}
+}
+
+// SupportsMedia 判断是否支持某种媒体类型
+func (c Capabilities) SupportsMedia(mediaType string) bool {
+	for _, t := range c.MediaTypes {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// Describe 返回给 Agent 看的能力说明
+func (c Capabilities) Describe() string {
+	var parts []string
+
+	if c.MaxMessageLength > 0 {
+		parts = append(parts, fmt.Sprintf("max message length %d characters (longer replies are split)", c.MaxMessageLength))
+	}
+
+	if len(c.MediaTypes) > 0 {
+		media := "can send " + strings.Join(c.MediaTypes, ", ")
+		if c.MaxCaptionLength > 0 {
+			media += fmt.Sprintf(" (captions up to %d characters)", c.MaxCaptionLength)
+		}
+		media += "; other files are delivered as links or paths"
+		parts = append(parts, media)
+	} else {
+		parts = append(parts, "text only; files are delivered as links or paths")
+	}
+
+	switch c.Markdown {
+	case MarkdownHTML:
+		parts = append(parts, "Markdown is supported (converted to HTML)")
+	case MarkdownStandard:
+		parts = append(parts, "Markdown is supported")
+	default:
+		parts = append(parts, "no formatting; write plain text")
+	}
+
+	if c.Buttons {
+		parts = append(parts, "inline buttons are supported")
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// DetectMediaType 判断媒体类型
+// 优先使用消息中显式指定的类型，否则根据文件扩展名推断
+func DetectMediaType(media string, hint string) string {
+	switch hint {
+	case MediaPhoto, MediaDocument, MediaAudio, MediaVideo:
+		return hint
+	}
+
+	ext := strings.ToLower(filepath.Ext(strings.SplitN(media, "?", 2)[0]))
+	switch ext {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp":
+		return MediaPhoto
+	case ".mp4", ".mov", ".webm", ".mkv", ".avi":
+		return MediaVideo
+	case ".mp3", ".ogg", ".oga", ".m4a", ".wav", ".flac":
+		return MediaAudio
+	default:
+		return MediaDocument
+	}
+}
+
+// Adapt 按频道能力调整出站消息，返回实际要投递的消息列表
+// 降级规则：
+//  1. 不支持的媒体从附件中移除，改为在正文末尾附上链接（或本地路径）
+//  2. 带媒体的消息说明文字过长时，媒体不带说明发送，正文单独发送
+//  3. 正文超过最大长度时拆分为多条消息，内联按钮只保留在最后一条
+//
+// 参数:
+//
+//	msg: 原始出站消息
+//	caps: 目标频道的能力
+//
+// 返回: 降级后的消息列表（至少一条）
+func Adapt(msg bus.OutboundMessage, caps Capabilities) []bus.OutboundMessage {
+	hint, _ := msg.Metadata["media_type"].(string)
+
+	// 1. 过滤不支持的媒体
+	var supported, links []string
+	for _, media := range msg.Media {
+		media = strings.TrimSpace(media)
+		if media == "" {
+			continue
+		}
+		if caps.SupportsMedia(DetectMediaType(media, hint)) {
+			supported = append(supported, media)
+		} else {
+			links = append(links, fmt.Sprintf("📎 %s: %s", filepath.Base(media), media))
+		}
+	}
+
+	content := msg.Content
+	if len(links) > 0 {
+		if content != "" {
+			content += "\n\n"
+		}
+		content += strings.Join(links, "\n")
+	}
+
+	if len(supported) > 0 {
+		// 2. 说明文字过长时拆分为"媒体 + 正文"
+		if caps.MaxCaptionLength > 0 && len([]rune(content)) > caps.MaxCaptionLength {
+			mediaMsg := withMetadata(msg, msg.Metadata, false)
+			mediaMsg.Media = supported
+			mediaMsg.Content = ""
+			textMsg := withMetadata(msg, msg.Metadata, true)
+			textMsg.Content = content
+			return append([]bus.OutboundMessage{mediaMsg}, splitOutbound(textMsg, caps)...)
+		}
+
+		adapted := withMetadata(msg, msg.Metadata, true)
+		adapted.Media = supported
+		adapted.Content = content
+		return []bus.OutboundMessage{adapted}
+	}
+
+	// 3. 纯文本消息按长度拆分
+	adapted := withMetadata(msg, msg.Metadata, true)
+	adapted.Media = nil
+	adapted.Content = content
+	return splitOutbound(adapted, caps)
+}
+
+// splitOutbound 把超长文本消息拆分为多条
+// 原样发送 Markdown 的频道按代码块拆分，避免代码块被截断后格式错乱
+func splitOutbound(msg bus.OutboundMessage, caps Capabilities) []bus.OutboundMessage {
+	parts := splitMessage(msg.Content, caps.MaxMessageLength)
+	if caps.Markdown == MarkdownStandard {
+		parts = splitMarkdown(msg.Content, caps.MaxMessageLength)
+	}
+	if len(parts) <= 1 {
+		return []bus.OutboundMessage{msg}
+	}
+
+	result := make([]bus.OutboundMessage, 0, len(parts))
+	for i, part := range parts {
+		m := withMetadata(msg, msg.Metadata, i == len(parts)-1)
+		m.Content = part
+		m.Media = nil
+		result = append(result, m)
+	}
+	return result
+}
+
+// withMetadata 复制消息和元数据；keepButtons 为 false 时去掉内联按钮
+func withMetadata(msg bus.OutboundMessage, metadata map[string]interface{}, keepButtons bool) bus.OutboundMessage {
+	copied := make(map[string]interface{}, len(metadata))
+	for k, v := range metadata {
+		if k == "buttons" && !keepButtons {
+			continue
+		}
+		copied[k] = v
+	}
+	msg.Metadata = copied
+	return msg
+}
+
+// splitMarkdown 按长度拆分 Markdown 文本，并保持代码块完整
+// 拆分点落在 ``` 代码块内部时，在这一段末尾补上 ``` 关闭代码块，
+// 并在下一段开头重新打开（保留语言标记），每段仍然是合法的 Markdown
+func splitMarkdown(text string, maxLen int) []string {
+	if maxLen <= 0 || len([]rune(text)) <= maxLen {
+		return []string{text}
+	}
+
+	// 为补上的 "\n```" 和下一段开头的 "```lang\n" 预留长度
+	const reserve = 24
+	if maxLen <= reserve*2 {
+		return splitMessage(text, maxLen)
+	}
+
+	var parts []string
+	fence := "" // 上一段末尾未关闭的代码块开头（例如 "```go"）
+	for _, part := range splitMessage(text, maxLen-reserve) {
+		if fence != "" {
+			part = fence + "\n" + part
+		}
+		if fence = openFence(part); fence != "" {
+			part += "\n```"
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// openFence 返回文本末尾仍未关闭的代码块开头（例如 "```go"），没有时返回空字符串
+func openFence(text string) string {
+	open := ""
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "```") {
+			continue
+		}
+		if open != "" {
+			open = ""
+			continue
+		}
+		// 只保留语言标记（过长的标记会超出预留长度，直接丢弃）
+		open = "```"
+		if lang := strings.Fields(line[3:]); len(lang) > 0 && len(lang[0]) <= 12 {
+			open += lang[0]
+		}
+	}
+	return open
+}
@@ -0,0 +1,574 @@
+// Package channels - Discord频道实现
+// discord.go 实现了 Discord 斜杠命令（Interactions）的集成
+// Discord 把斜杠命令以 HTTP 请求发送到 gateway 的 /discord/interactions 端点（使用 Ed25519 签名），
+// 回复通过 REST API 发送；不需要保持 WebSocket 长连接，因此只响应斜杠命令，不读取普通聊天消息
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/config"
+	"github.com/Ailoc/nanogrip/internal/media"
+)
+
+const (
+	discordAPIBaseURL       = "https://discord.com/api/v10"
+	discordMessageMaxLength = 2000
+	discordInteractionTTL   = 14 * time.Minute
+)
+
+// Discord 交互类型和回应类型
+const (
+	discordInteractionPing    = 1
+	discordInteractionCommand = 2
+
+	discordResponsePong     = 1
+	discordResponseMessage  = 4
+	discordResponseDeferred = 5
+
+	discordFlagEphemeral = 64 // 只有命令发起人能看到的消息
+)
+
+// DiscordChannel Discord机器人频道实现
+// 主要特性：
+// 1. 启动时注册斜杠命令 /ask（提问，可附带文件）、/new（开始新会话）、/task（查看后台任务）
+// 2. 校验 Discord 请求签名，收到命令后先回复"正在思考"，Agent 的回复再替换这条消息
+// 3. 命令附带的文件下载到媒体目录，Agent 收到的是文件路径
+// 4. 按 2000 字符拆分长消息，拆分时保持 ``` 代码块完整
+// 5. 支持用户白名单（AllowFrom）进行访问控制
+type DiscordChannel struct {
+	*BaseChannel                             // 嵌入基础频道，继承通用功能
+	config       *config.DiscordConfig       // Discord配置
+	publicKey    ed25519.PublicKey           // 应用公钥，用于校验请求签名
+	allowFrom    map[string]bool             // 用户白名单，key为用户ID
+	httpClient   *http.Client                // HTTP客户端，用于调用Discord API
+	apiBaseURL   string                      // Discord API 基础地址，测试时可替换
+	mediaStore   *media.Manager              // 保存命令附带的文件
+	pending      map[string][]discordPending // 聊天 ID -> 等待回复的交互（按时间顺序）
+	mu           sync.Mutex                  // 保护 allowFrom 和 pending
+}
+
+// discordPending 是一个已回复"正在思考"、等待 Agent 回复的斜杠命令
+type discordPending struct {
+	token string    // 交互令牌，15 分钟内可以用它编辑原始回复
+	at    time.Time // 收到命令的时间
+}
+
+// discordInteraction 是 Discord 发来的交互请求
+type discordInteraction struct {
+	ID        string              `json:"id"`
+	Type      int                 `json:"type"`
+	Token     string              `json:"token"`
+	ChannelID string              `json:"channel_id"`
+	GuildID   string              `json:"guild_id"`
+	Member    *discordMember      `json:"member"` // 服务器中的命令
+	User      *discordUser        `json:"user"`   // 私信中的命令
+	Data      *discordCommandData `json:"data"`
+}
+
+type discordMember struct {
+	User *discordUser `json:"user"`
+}
+
+type discordUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type discordCommandData struct {
+	Name     string                 `json:"name"`
+	Options  []discordCommandOption `json:"options"`
+	Resolved struct {
+		Attachments map[string]discordAttachment `json:"attachments"`
+	} `json:"resolved"`
+}
+
+type discordCommandOption struct {
+	Name  string      `json:"name"`
+	Type  int         `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type discordAttachment struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	URL         string `json:"url"`
+}
+
+// discordCommands 是启动时注册的斜杠命令
+// 选项类型：3 = 字符串，11 = 附件
+var discordCommands = []map[string]interface{}{
+	{
+		"name":        "ask",
+		"description": "Ask the assistant",
+		"options": []map[string]interface{}{
+			{"type": 3, "name": "prompt", "description": "Your message", "required": true},
+			{"type": 11, "name": "file", "description": "An image or document to include"},
+		},
+	},
+	{
+		"name":        "new",
+		"description": "Start a new conversation",
+	},
+	{
+		"name":        "task",
+		"description": "List background tasks, or show one by id",
+		"options": []map[string]interface{}{
+			{"type": 3, "name": "id", "description": "Task id"},
+		},
+	},
+}
+
+// NewDiscordChannel 创建一个新的Discord频道实例
+// 参数:
+//
+//	cfg: Discord配置对象，包含令牌、应用 ID、公钥和白名单
+//	bus: 消息总线，用于发布收到的命令
+//
+// 返回: 初始化后的DiscordChannel指针
+func NewDiscordChannel(cfg *config.DiscordConfig, bus *bus.MessageBus) *DiscordChannel {
+	c := &DiscordChannel{
+		BaseChannel: NewBaseChannel("discord", cfg, bus),
+		config:      cfg,
+		httpClient:  &http.Client{Timeout: 60 * time.Second},
+		apiBaseURL:  discordAPIBaseURL,
+		pending:     make(map[string][]discordPending),
+	}
+	if key, err := hex.DecodeString(strings.TrimSpace(cfg.PublicKey)); err == nil && len(key) == ed25519.PublicKeySize {
+		c.publicKey = ed25519.PublicKey(key)
+	}
+	c.SetAllowFrom(cfg.AllowFrom)
+	return c
+}
+
+// SetAllowFrom 更新用户白名单（配置热重载时调用）
+func (c *DiscordChannel) SetAllowFrom(ids []string) {
+	allowFrom := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		allowFrom[id] = true
+	}
+	c.mu.Lock()
+	c.allowFrom = allowFrom
+	c.mu.Unlock()
+}
+
+// SetMediaManager 设置保存命令附带文件的媒体管理器
+func (c *DiscordChannel) SetMediaManager(store *media.Manager) {
+	c.mediaStore = store
+}
+
+// Capabilities 返回 Discord 频道的能力声明
+// Discord 原生支持 Markdown，任意类型的文件都可以作为附件上传
+func (c *DiscordChannel) Capabilities() Capabilities {
+	return Capabilities{
+		MaxMessageLength: discordMessageMaxLength,
+		MaxCaptionLength: discordMessageMaxLength,
+		MediaTypes:       []string{MediaPhoto, MediaDocument, MediaAudio, MediaVideo},
+		Markdown:         MarkdownStandard,
+	}
+}
+
+// Start 启动Discord频道
+// 检查配置并注册斜杠命令；命令注册失败只记录警告（之前注册过的命令仍然可用）
+func (c *DiscordChannel) Start(ctx context.Context) error {
+	if c.config.Token == "" || c.config.ApplicationID == "" {
+		return fmt.Errorf("Discord token or applicationId not configured")
+	}
+	if c.publicKey == nil {
+		return fmt.Errorf("Discord publicKey is missing or invalid")
+	}
+
+	if err := c.registerCommands(); err != nil {
+		log.Printf("Discord command registration warning: %v", err)
+	}
+
+	c.running = true
+	log.Println("Discord channel started (interactions endpoint: /discord/interactions)")
+	return nil
+}
+
+// Stop 停止Discord频道
+func (c *DiscordChannel) Stop() error {
+	c.running = false
+	log.Println("Discord channel stopped")
+	return nil
+}
+
+// registerCommands 覆盖注册斜杠命令
+// 配置了 guildId 时只注册到该服务器（立即生效），否则注册全局命令（可能需要几分钟才生效）
+func (c *DiscordChannel) registerCommands() error {
+	path := fmt.Sprintf("/applications/%s/commands", c.config.ApplicationID)
+	if c.config.GuildID != "" {
+		path = fmt.Sprintf("/applications/%s/guilds/%s/commands", c.config.ApplicationID, c.config.GuildID)
+	}
+	return c.doDiscord(http.MethodPut, path, discordCommands, nil, true)
+}
+
+// ServeHTTP 处理 Discord 发来的交互请求（斜杠命令）
+// Discord 要求 3 秒内回应，因此先回复"正在思考"，下载附件和发布消息在后台完成
+func (c *DiscordChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !c.verify(r.Header.Get("X-Signature-Ed25519"), r.Header.Get("X-Signature-Timestamp"), body) {
+		http.Error(w, "invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	switch interaction.Type {
+	case discordInteractionPing:
+		writeDiscordResponse(w, map[string]interface{}{"type": discordResponsePong})
+	case discordInteractionCommand:
+		c.handleCommand(w, interaction)
+	default:
+		http.Error(w, "unsupported interaction type", http.StatusBadRequest)
+	}
+}
+
+// verify 校验请求签名（Ed25519(timestamp + body)）
+func (c *DiscordChannel) verify(signature, timestamp string, body []byte) bool {
+	if c.publicKey == nil || signature == "" || timestamp == "" {
+		return false
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(c.publicKey, append([]byte(timestamp), body...), sig)
+}
+
+// handleCommand 处理一条斜杠命令
+func (c *DiscordChannel) handleCommand(w http.ResponseWriter, interaction discordInteraction) {
+	user := interaction.User
+	if interaction.Member != nil && interaction.Member.User != nil {
+		user = interaction.Member.User
+	}
+	if user == nil || interaction.Data == nil || interaction.ChannelID == "" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	if !c.allowed(user) {
+		log.Printf("Ignoring Discord command from unauthorized user: %s", user.ID)
+		writeDiscordResponse(w, map[string]interface{}{
+			"type": discordResponseMessage,
+			"data": map[string]interface{}{"content": "⛔ You are not allowed to use this bot.", "flags": discordFlagEphemeral},
+		})
+		return
+	}
+
+	content, attachment := discordCommandContent(interaction.Data)
+	if content == "" {
+		writeDiscordResponse(w, map[string]interface{}{
+			"type": discordResponseMessage,
+			"data": map[string]interface{}{"content": "Unknown command.", "flags": discordFlagEphemeral},
+		})
+		return
+	}
+
+	// 有工具调用在等待这个聊天的答复时，文本直接作为答复（Agent 此时阻塞在工具调用上，不会回复这条命令）
+	if attachment == nil && c.handleInput(interaction.ChannelID, user.ID, content) {
+		writeDiscordResponse(w, map[string]interface{}{
+			"type": discordResponseMessage,
+			"data": map[string]interface{}{"content": "↩️ Answer received.", "flags": discordFlagEphemeral},
+		})
+		return
+	}
+
+	// 先回复"正在思考"，Agent 的第一条回复会替换这条消息
+	c.mu.Lock()
+	c.pending[interaction.ChannelID] = append(c.pending[interaction.ChannelID], discordPending{token: interaction.Token, at: time.Now()})
+	c.mu.Unlock()
+	writeDiscordResponse(w, map[string]interface{}{"type": discordResponseDeferred})
+
+	go func() {
+		var media []string
+		if attachment != nil {
+			item, err := c.downloadAttachment(*attachment)
+			if err != nil {
+				log.Printf("Failed to download Discord attachment: %v", err)
+			} else {
+				media = append(media, item)
+			}
+		}
+
+		inbound := bus.InboundMessage{
+			Message: bus.Message{
+				ID:       interaction.ID,
+				Channel:  "discord",
+				SenderID: user.ID,
+				ChatID:   interaction.ChannelID,
+				Content:  content,
+				Media:    media,
+				Metadata: map[string]interface{}{
+					"discord_interaction_id": interaction.ID,
+					"discord_guild_id":       interaction.GuildID,
+					"discord_username":       user.Username,
+				},
+			},
+		}
+		if err := c.bus.PublishInbound(inbound); err != nil {
+			log.Printf("Error publishing inbound message: %v", err)
+		}
+	}()
+}
+
+// allowed 检查用户是否在白名单中（白名单为空表示不限制）
+func (c *DiscordChannel) allowed(user *discordUser) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.allowFrom) == 0 {
+		return true
+	}
+	return c.allowFrom[user.ID] || (user.Username != "" && c.allowFrom[user.Username])
+}
+
+// discordCommandContent 把斜杠命令转换为 Agent 收到的消息内容
+// /ask 使用 prompt 作为消息，/new 和 /task 转换为对应的聊天命令（/new、/tasks）
+// 返回: 消息内容（未知命令返回空字符串），以及附带的文件
+func discordCommandContent(data *discordCommandData) (string, *discordAttachment) {
+	options := make(map[string]interface{}, len(data.Options))
+	for _, option := range data.Options {
+		options[option.Name] = option.Value
+	}
+
+	switch data.Name {
+	case "ask":
+		prompt, _ := options["prompt"].(string)
+		var attachment *discordAttachment
+		if id, ok := options["file"].(string); ok {
+			if a, ok := data.Resolved.Attachments[id]; ok {
+				attachment = &a
+			}
+		}
+		return strings.TrimSpace(prompt), attachment
+	case "new":
+		return "/new", nil
+	case "task":
+		if id, _ := options["id"].(string); strings.TrimSpace(id) != "" {
+			return "/tasks " + strings.TrimSpace(id), nil
+		}
+		return "/tasks", nil
+	default:
+		return "", nil
+	}
+}
+
+// downloadAttachment 把命令附带的文件下载到媒体目录
+func (c *DiscordChannel) downloadAttachment(attachment discordAttachment) (string, error) {
+	if c.mediaStore == nil {
+		return "", fmt.Errorf("media storage is not configured")
+	}
+	req, err := http.NewRequest(http.MethodGet, attachment.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	return c.mediaStore.Download(c.httpClient, req, attachment.Filename)
+}
+
+// Send 通过Discord发送消息
+// 如果该聊天有等待回复的斜杠命令，第一段替换"正在思考"的消息，其余内容作为普通消息发送
+// 本地文件作为附件上传，链接直接附在文本中（Discord 会自动预览）
+func (c *DiscordChannel) Send(msg bus.OutboundMessage) error {
+	content := msg.Content
+	var files []string
+	for _, media := range msg.Media {
+		if strings.HasPrefix(media, "http://") || strings.HasPrefix(media, "https://") {
+			content = strings.TrimSpace(content + "\n" + media)
+			continue
+		}
+		files = append(files, media)
+	}
+
+	parts := splitMarkdown(content, discordMessageMaxLength)
+	for i, part := range parts {
+		var partFiles []string
+		if i == len(parts)-1 {
+			partFiles = files
+		}
+		if strings.TrimSpace(part) == "" && len(partFiles) == 0 {
+			continue
+		}
+		if err := c.sendPart(msg.ChatID, part, partFiles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendPart 发送一条消息，优先替换等待中的斜杠命令回复
+func (c *DiscordChannel) sendPart(chatID, content string, files []string) error {
+	payload := map[string]interface{}{
+		"content":          content,
+		"allowed_mentions": map[string]interface{}{"parse": []string{}}, // 不让模型的回复 @ 所有人
+	}
+
+	if token := c.takePending(chatID); token != "" {
+		path := fmt.Sprintf("/webhooks/%s/%s/messages/@original", c.config.ApplicationID, token)
+		err := c.doDiscordMessage(http.MethodPatch, path, payload, files, false)
+		if err == nil {
+			return nil
+		}
+		// 交互令牌可能已过期，改为普通消息发送
+		log.Printf("Discord interaction reply failed, sending as a channel message: %v", err)
+	}
+	return c.doDiscordMessage(http.MethodPost, fmt.Sprintf("/channels/%s/messages", chatID), payload, files, true)
+}
+
+// takePending 取出该聊天最早的、仍然有效的交互令牌
+func (c *DiscordChannel) takePending(chatID string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	queue := c.pending[chatID]
+	for len(queue) > 0 {
+		item := queue[0]
+		queue = queue[1:]
+		if time.Since(item.at) < discordInteractionTTL {
+			c.pending[chatID] = queue
+			return item.token
+		}
+	}
+	delete(c.pending, chatID)
+	return ""
+}
+
+// SendTyping 显示"正在输入…"状态（实现 TypingIndicator）
+// 状态持续约 10 秒，或在机器人发出下一条消息时消失
+func (c *DiscordChannel) SendTyping(chatID string) error {
+	return c.doDiscord(http.MethodPost, fmt.Sprintf("/channels/%s/typing", chatID), nil, nil, true)
+}
+
+// doDiscordMessage 发送或编辑一条消息，有附件时使用 multipart 上传
+func (c *DiscordChannel) doDiscordMessage(method, path string, payload map[string]interface{}, files []string, auth bool) error {
+	if len(files) == 0 {
+		return c.doDiscord(method, path, payload, nil, auth)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if err := writer.WriteField("payload_json", string(payloadJSON)); err != nil {
+		return err
+	}
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read attachment: %w", err)
+		}
+		part, err := writer.CreateFormFile(fmt.Sprintf("files[%d]", i), filepath.Base(file))
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, c.apiBaseURL+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return c.doRequest(req, nil, auth)
+}
+
+// doDiscord 调用 Discord REST API（JSON 请求）
+// 参数:
+//
+//	method: HTTP 方法
+//	path: API 路径（不含 /api/v10 前缀）
+//	payload: 请求体（为 nil 表示没有请求体）
+//	result: 响应解码目标（为 nil 表示忽略响应体）
+//	auth: 是否带上机器人令牌（交互 webhook 不需要）
+func (c *DiscordChannel) doDiscord(method, path string, payload, result interface{}, auth bool) error {
+	var reader io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.apiBaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.doRequest(req, result, auth)
+}
+
+// Check 获取机器人自己的用户信息，校验机器人令牌（实现 Checker）
+func (c *DiscordChannel) Check() (string, error) {
+	var me discordUser
+	if err := c.doDiscord(http.MethodGet, "/users/@me", nil, &me, true); err != nil {
+		return "", err
+	}
+	return me.Username, nil
+}
+
+// doRequest 发送请求并检查响应状态
+func (c *DiscordChannel) doRequest(req *http.Request, result interface{}, auth bool) error {
+	if auth {
+		req.Header.Set("Authorization", "Bot "+c.config.Token)
+	}
+	req.Header.Set("User-Agent", "DiscordBot (https://github.com/Ailoc/nanogrip, 1.0)")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// 不输出请求路径：交互 webhook 的路径中包含交互令牌
+		return fmt.Errorf("Discord API %s failed: status=%d, response=%q", req.Method, resp.StatusCode, string(body))
+	}
+	if result != nil && len(body) > 0 {
+		return json.Unmarshal(body, result)
+	}
+	return nil
+}
+
+// writeDiscordResponse 写入交互回应
+func writeDiscordResponse(w http.ResponseWriter, response map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,400 @@
+// dispatcher.go 实现出站消息的按频道分发
+// 每个频道在消息总线上订阅自己的出站队列（bus.SubscribeOutbound），由独立的发送 goroutine 消费，
+// 一个频道变慢（例如 Telegram 限流）不会拖慢其他频道。
+// 发往未启用频道的消息和队列已满时的新消息由消息总线交回（bus.OnUndeliverable），直接写入死信。
+// 发送失败时按退避时间重试，仍然失败的消息交给 OnDeadLetter（gateway 写入死信文件，便于排查和手动补发）。
+// 配置了免打扰时段的频道，时段内的后台消息先暂存，时段结束后合并发送（见 quiet.go）。
+// 用 Manager.Disable 停用的频道，消息暂存到 Manager.Enable 重新启用后按顺序发送（见 toggle.go）。
+package channels
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/trace"
+)
+
+// DispatcherOptions 是出站分发的配置
+type DispatcherOptions struct {
+	QueueSize     int           // 每个频道的出站订阅队列长度，队列满时新消息直接进入死信
+	MaxAttempts   int           // 每条消息最多发送次数（含第一次）
+	RetryDelay    time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	MaxRetryDelay time.Duration // 重试等待时间上限
+
+	// OnResult 每条消息（拆分后的每一段）投递结束后调用一次，用于写入投递回执
+	OnResult func(msg bus.OutboundMessage, attempts int, err error)
+
+	// OnDeadLetter 消息最终无法投递时调用（重试用尽、频道不存在、队列已满或关闭时未发送）
+	OnDeadLetter func(msg bus.OutboundMessage, attempts int, err error)
+}
+
+// Dispatcher 为每个频道订阅消息总线上的出站队列并发送其中的消息
+type Dispatcher struct {
+	manager *Manager
+	opts    DispatcherOptions
+	bus     *bus.MessageBus                       // Subscribe 时设置
+	ctx     context.Context                       // Run 时设置，为 nil 表示发送 goroutine 尚未启动
+	queues  map[string]<-chan bus.OutboundMessage // 频道名称 -> 出站订阅队列
+	mu      sync.Mutex                            // 保护 bus、ctx 和 queues
+	wg      sync.WaitGroup                        // 等待所有频道的发送 goroutine
+
+	quietMu sync.Mutex                       // 保护 quiet 和 held
+	quiet   map[string]QuietHours            // 频道名称 -> 免打扰时段
+	held    map[string][]bus.OutboundMessage // "频道\x00聊天 ID" -> 免打扰时段内暂存的消息
+
+	pausedMu sync.Mutex                       // 保护 paused
+	paused   map[string][]bus.OutboundMessage // 频道名称 -> 频道停用期间暂存的消息
+}
+
+// NewDispatcher 创建出站分发器
+// 参数:
+//
+//	manager: 频道管理器，每条消息发送前都会重新查找频道（热重载重启频道后仍能发送）
+//	opts: 分发配置，零值字段使用默认值
+func NewDispatcher(manager *Manager, opts DispatcherOptions) *Dispatcher {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = 2 * time.Second
+	}
+	if opts.MaxRetryDelay <= 0 {
+		opts.MaxRetryDelay = time.Minute
+	}
+	d := &Dispatcher{
+		manager: manager,
+		opts:    opts,
+		queues:  make(map[string]<-chan bus.OutboundMessage),
+		held:    make(map[string][]bus.OutboundMessage),
+		paused:  make(map[string][]bus.OutboundMessage),
+	}
+	manager.mu.Lock()
+	manager.onEnable = d.resume
+	manager.mu.Unlock()
+	return d
+}
+
+// SetQuietHours 设置各频道的免打扰时段（配置热重载时调用）
+// 不再处于免打扰时段的频道，暂存的消息在下一次检查时发送
+func (d *Dispatcher) SetQuietHours(quiet map[string]QuietHours) {
+	d.quietMu.Lock()
+	d.quiet = quiet
+	d.quietMu.Unlock()
+}
+
+// Subscribe 为配置中启用的和正在运行的频道订阅出站消息（已订阅的频道跳过），并接管无法投递的消息
+// gateway 在 Agent 等发布者开始工作之前调用，订阅之后、Run 之前发布的消息在队列中等待；
+// 热重载启用新频道后需要再次调用
+func (d *Dispatcher) Subscribe(msgBus *bus.MessageBus) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.bus == nil {
+		d.bus = msgBus
+		msgBus.OnUndeliverable(func(msg bus.OutboundMessage, err error) {
+			if err == bus.ErrBusFull {
+				err = fmt.Errorf("outbound queue for %s is full (%d messages)", msg.Channel, d.opts.QueueSize)
+			} else {
+				err = fmt.Errorf("channel %q not found", msg.Channel)
+			}
+			d.report(msg, 0, err)
+			d.deadLetter(context.Background(), msg, 0, err)
+		})
+	}
+	for _, name := range append(d.manager.Enabled(), d.manager.ListChannels()...) {
+		if _, ok := d.queues[name]; ok {
+			continue
+		}
+		queue := msgBus.SubscribeOutbound(name, d.opts.QueueSize)
+		d.queues[name] = queue
+		if d.ctx != nil {
+			d.startWorker(name, queue)
+		}
+	}
+}
+
+// Run 为订阅的频道启动发送 goroutine，直到 ctx 被取消
+// 返回前会等待所有频道的发送 goroutine 退出
+func (d *Dispatcher) Run(ctx context.Context, msgBus *bus.MessageBus) {
+	d.mu.Lock()
+	d.ctx = ctx
+	for name, queue := range d.queues {
+		d.startWorker(name, queue)
+	}
+	d.mu.Unlock()
+	d.Subscribe(msgBus)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.releaseLoop(ctx)
+	}()
+	<-ctx.Done()
+	d.wg.Wait()
+}
+
+// Enqueue 把消息重新发布到消息总线，由目标频道的发送 goroutine 发送
+// 无法投递时由 Subscribe 设置的处理函数写入死信
+func (d *Dispatcher) Enqueue(ctx context.Context, msg bus.OutboundMessage) {
+	d.mu.Lock()
+	msgBus := d.bus
+	d.mu.Unlock()
+	if msgBus == nil {
+		d.deadLetter(ctx, msg, 0, fmt.Errorf("dispatcher is not subscribed to the message bus"))
+		return
+	}
+	msgBus.PublishOutbound(msg)
+}
+
+// Pending 返回各频道等待发送的消息数（队列中的和频道停用期间暂存的）
+func (d *Dispatcher) Pending() map[string]int {
+	d.mu.Lock()
+	pending := make(map[string]int, len(d.queues))
+	for name, queue := range d.queues {
+		pending[name] = len(queue)
+	}
+	d.mu.Unlock()
+
+	d.pausedMu.Lock()
+	defer d.pausedMu.Unlock()
+	for name, parked := range d.paused {
+		pending[name] += len(parked)
+	}
+	return pending
+}
+
+// startWorker 启动频道的发送 goroutine（调用方需持有 d.mu）
+func (d *Dispatcher) startWorker(channel string, queue <-chan bus.OutboundMessage) {
+	ctx := d.ctx
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.worker(ctx, channel, queue)
+	}()
+}
+
+// worker 依次发送一个频道的消息
+// 退出时队列中剩余的消息写入死信
+func (d *Dispatcher) worker(ctx context.Context, channel string, queue <-chan bus.OutboundMessage) {
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case msg := <-queue:
+					d.deadLetter(ctx, msg, 0, fmt.Errorf("shutting down before delivery"))
+				default:
+					return
+				}
+			}
+		case msg := <-queue:
+			if d.park(ctx, msg) || d.hold(msg, time.Now()) {
+				continue
+			}
+			d.deliver(ctx, msg)
+		}
+	}
+}
+
+// deliver 发送一条消息（按频道能力拆分），失败时重试
+func (d *Dispatcher) deliver(ctx context.Context, msg bus.OutboundMessage) {
+	// 使用回复所属消息的追踪 ID
+	ctx = trace.WithID(ctx, trace.FromMetadata(msg.Metadata))
+	trace.Logf(ctx, "[Outbound] 发送消息: Channel=%s, ChatID=%s, Content=%.50s", msg.Channel, msg.ChatID, msg.Content)
+
+	ch := d.manager.GetChannel(msg.Channel)
+	if ch == nil {
+		err := fmt.Errorf("channel %q not found", msg.Channel)
+		d.report(msg, 0, err)
+		d.deadLetter(ctx, msg, 0, err)
+		return
+	}
+
+	// 按频道能力降级（不支持的媒体改为链接、超长消息拆分）
+	for _, part := range Adapt(msg, CapabilitiesOf(ch)) {
+		if !d.sendWithRetry(ctx, part) {
+			return // 后续分段不再发送，避免用户收到不完整的上下文
+		}
+	}
+}
+
+// sendWithRetry 发送一条消息，失败时按指数退避重试
+// 返回是否发送成功
+func (d *Dispatcher) sendWithRetry(ctx context.Context, msg bus.OutboundMessage) bool {
+	_, span := trace.Start(ctx, "outbound.send", "channel", msg.Channel, "chat_id", msg.ChatID)
+	delay := d.opts.RetryDelay
+	var err error
+	for attempt := 1; attempt <= d.opts.MaxAttempts; attempt++ {
+		// 发送或重试期间频道被停用，剩余的分段同样暂存，重新启用后按顺序发送
+		if d.park(ctx, msg) {
+			span.End(nil)
+			return true
+		}
+		// 重试时重新查找频道，热重载可能已经重启了它
+		ch := d.manager.GetChannel(msg.Channel)
+		if ch == nil {
+			err = fmt.Errorf("channel %q not found", msg.Channel)
+		} else {
+			err = ch.Send(msg)
+		}
+		if err == nil {
+			trace.Logf(ctx, "[Outbound] ✓ 消息已发送到 %s (%s)", msg.Channel, msg.ChatID)
+			span.SetAttr("attempts", attempt)
+			span.End(nil)
+			d.report(msg, attempt, nil)
+			return true
+		}
+
+		trace.Logf(ctx, "[Outbound] ❌ 发送到 %s (%s) 失败 (第 %d/%d 次): %v", msg.Channel, msg.ChatID, attempt, d.opts.MaxAttempts, err)
+		if attempt == d.opts.MaxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			span.SetAttr("attempts", attempt)
+			span.End(err)
+			d.report(msg, attempt, err)
+			d.deadLetter(ctx, msg, attempt, err)
+			return false
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > d.opts.MaxRetryDelay {
+			delay = d.opts.MaxRetryDelay
+		}
+	}
+
+	span.SetAttr("attempts", d.opts.MaxAttempts)
+	span.End(err)
+	d.report(msg, d.opts.MaxAttempts, err)
+	d.deadLetter(ctx, msg, d.opts.MaxAttempts, err)
+	return false
+}
+
+// report 调用投递结果回调
+func (d *Dispatcher) report(msg bus.OutboundMessage, attempts int, err error) {
+	if d.opts.OnResult != nil {
+		d.opts.OnResult(msg, attempts, err)
+	}
+}
+
+// deadLetter 记录无法投递的消息
+func (d *Dispatcher) deadLetter(ctx context.Context, msg bus.OutboundMessage, attempts int, cause error) {
+	trace.Logf(trace.WithID(ctx, trace.FromMetadata(msg.Metadata)), "[Outbound] ☠ 放弃投递到 %s (%s): %v", msg.Channel, msg.ChatID, cause)
+	if d.opts.OnDeadLetter != nil {
+		d.opts.OnDeadLetter(msg, attempts, cause)
+	}
+}
+
+// hold 免打扰时段内暂存后台消息
+// 返回消息是否已暂存
+func (d *Dispatcher) hold(msg bus.OutboundMessage, now time.Time) bool {
+	if !IsBackground(msg) {
+		return false
+	}
+	d.quietMu.Lock()
+	defer d.quietMu.Unlock()
+	quiet, ok := d.quiet[msg.Channel]
+	if !ok || !quiet.Active(now) {
+		return false
+	}
+	key := msg.Channel + "\x00" + msg.ChatID
+	d.held[key] = append(d.held[key], msg)
+	trace.Logf(trace.WithID(context.Background(), trace.FromMetadata(msg.Metadata)),
+		"[Outbound] 🌙 免打扰时段 (%s)，暂存发往 %s (%s) 的消息", quiet, msg.Channel, msg.ChatID)
+	return true
+}
+
+// park 暂存发往已停用频道的消息，每个频道最多暂存 QueueSize 条，超出的写入死信
+// 返回消息是否已暂存（或已写入死信）
+func (d *Dispatcher) park(ctx context.Context, msg bus.OutboundMessage) bool {
+	d.pausedMu.Lock()
+	// 在 pausedMu 内检查停用状态，和 resume 互斥，Enable 之后不会再有消息留在暂存区
+	if !d.manager.Disabled(msg.Channel) {
+		d.pausedMu.Unlock()
+		return false
+	}
+	full := len(d.paused[msg.Channel]) >= d.opts.QueueSize
+	if !full {
+		d.paused[msg.Channel] = append(d.paused[msg.Channel], msg)
+	}
+	d.pausedMu.Unlock()
+
+	if full {
+		err := fmt.Errorf("channel %s is disabled and %d messages are already waiting", msg.Channel, d.opts.QueueSize)
+		d.report(msg, 0, err)
+		d.deadLetter(ctx, msg, 0, err)
+		return true
+	}
+	trace.Logf(trace.WithID(ctx, trace.FromMetadata(msg.Metadata)),
+		"[Outbound] ⏸ 频道 %s 已停用，暂存发往 %s 的消息", msg.Channel, msg.ChatID)
+	return true
+}
+
+// resume 在频道重新启用后按顺序重新发布停用期间暂存的消息（由 Manager.Enable 调用）
+func (d *Dispatcher) resume(channel string) {
+	d.pausedMu.Lock()
+	parked := d.paused[channel]
+	delete(d.paused, channel)
+	d.pausedMu.Unlock()
+
+	if len(parked) > 0 {
+		trace.Logf(context.Background(), "[Outbound] ▶ 频道 %s 已重新启用，发送暂存的 %d 条消息", channel, len(parked))
+	}
+	for _, msg := range parked {
+		d.Enqueue(context.Background(), msg)
+	}
+}
+
+// releaseLoop 每分钟检查一次，把已经结束免打扰时段的频道中暂存的消息合并发送
+// 退出时仍暂存的消息（包括停用的频道暂存的消息）写入死信（可以用 "nanogrip outbox resend" 补发）
+func (d *Dispatcher) releaseLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			for _, held := range d.release(time.Time{}) {
+				for _, msg := range held {
+					d.deadLetter(ctx, msg, 0, fmt.Errorf("shutting down during quiet hours"))
+				}
+			}
+			d.pausedMu.Lock()
+			paused := d.paused
+			d.paused = make(map[string][]bus.OutboundMessage)
+			d.pausedMu.Unlock()
+			for channel, parked := range paused {
+				for _, msg := range parked {
+					d.deadLetter(ctx, msg, 0, fmt.Errorf("shutting down while channel %s is disabled", channel))
+				}
+			}
+			return
+		case now := <-ticker.C:
+			for _, held := range d.release(now) {
+				d.Enqueue(ctx, quietDigest(held))
+			}
+		}
+	}
+}
+
+// release 取出不再处于免打扰时段的聊天暂存的消息；now 为零值时取出全部
+func (d *Dispatcher) release(now time.Time) [][]bus.OutboundMessage {
+	d.quietMu.Lock()
+	defer d.quietMu.Unlock()
+	var released [][]bus.OutboundMessage
+	for key, held := range d.held {
+		if !now.IsZero() {
+			if quiet, ok := d.quiet[held[0].Channel]; ok && quiet.Active(now) {
+				continue
+			}
+		}
+		released = append(released, held)
+		delete(d.held, key)
+	}
+	return released
+}
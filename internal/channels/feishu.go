@@ -0,0 +1,800 @@
+// Package channels - 飞书频道实现
+// feishu.go 实现了飞书（Lark）自建应用机器人的集成
+// 飞书通过事件订阅把消息以 HTTP 请求发送到 gateway 的 /feishu/events 端点（可选 AES 加密和签名），
+// 回复通过开放平台 IM API 发送
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/config"
+	"github.com/Ailoc/nanogrip/internal/media"
+)
+
+const (
+	feishuAPIBaseURL       = "https://open.feishu.cn"
+	larkAPIBaseURL         = "https://open.larksuite.com"
+	feishuMessageMaxLength = 4000
+	feishuEventDedupTTL    = 10 * time.Minute
+)
+
+// feishuMentionPattern 匹配消息文本中的 @ 占位符（如 @_user_1）
+var feishuMentionPattern = regexp.MustCompile(`@_user_\d+\s*`)
+
+// FeishuChannel 飞书机器人频道实现
+// 主要特性：
+// 1. 处理事件订阅的 URL 校验，支持事件加密（AES-256-CBC）和签名校验
+// 2. 接收单聊和群聊（@机器人）中的文本、富文本、图片和文件消息
+// 3. 图片和文件下载到媒体目录，Agent 收到的是文件路径
+// 4. 回复以富文本（Markdown）发送，本地图片和文件先上传再发送
+// 5. 按 event_id 去重（飞书在未及时收到响应时会重试推送）
+// 6. 支持用户白名单（AllowFrom）进行访问控制
+type FeishuChannel struct {
+	*BaseChannel                      // 嵌入基础频道，继承通用功能
+	config       *config.FeishuConfig // 飞书配置
+	allowFrom    map[string]bool      // 用户白名单，key为用户 open_id
+	httpClient   *http.Client         // HTTP客户端，用于调用飞书 API
+	apiBaseURL   string               // 开放平台基础地址，测试时可替换
+	mediaStore   *media.Manager       // 保存消息中的图片和文件
+	mu           sync.Mutex           // 保护 allowFrom 和 seen
+
+	seen map[string]time.Time // 最近处理过的 event_id，用于去重
+
+	tokenMu     sync.Mutex // 保护 accessToken
+	accessToken string     // tenant_access_token
+	tokenExpiry time.Time  // accessToken 的过期时间
+
+	observe   bool   // 旁听模式：群聊中没有 @机器人 的消息只记录、不回复（见 observe.go）
+	botOpenID string // 机器人的 open_id，旁听模式下用于识别 @机器人，受 mu 保护
+}
+
+// feishuEnvelope 是事件回调的外层结构
+// 加密时只有 Encrypt 字段；URL 校验请求使用 Type/Token/Challenge；2.0 版本事件使用 Header/Event
+type feishuEnvelope struct {
+	Encrypt   string          `json:"encrypt"`
+	Type      string          `json:"type"`
+	Token     string          `json:"token"`
+	Challenge string          `json:"challenge"`
+	Schema    string          `json:"schema"`
+	Header    *feishuHeader   `json:"header"`
+	Event     json.RawMessage `json:"event"`
+}
+
+type feishuHeader struct {
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	Token     string `json:"token"`
+}
+
+// feishuMessageEvent 是 im.message.receive_v1 事件的内容
+type feishuMessageEvent struct {
+	Sender struct {
+		SenderID struct {
+			OpenID string `json:"open_id"`
+			UserID string `json:"user_id"`
+		} `json:"sender_id"`
+		SenderType string `json:"sender_type"`
+	} `json:"sender"`
+	Message struct {
+		MessageID   string `json:"message_id"`
+		ChatID      string `json:"chat_id"`
+		ChatType    string `json:"chat_type"` // p2p 或 group
+		MessageType string `json:"message_type"`
+		Content     string `json:"content"` // JSON 字符串，格式取决于 MessageType
+
+		Mentions []struct {
+			ID struct {
+				OpenID string `json:"open_id"`
+			} `json:"id"`
+			Name string `json:"name"`
+		} `json:"mentions"` // 消息中 @ 的用户和机器人
+	} `json:"message"`
+}
+
+// feishuResponse 是开放平台 API 的通用响应
+type feishuResponse struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// NewFeishuChannel 创建一个新的飞书频道实例
+// 参数:
+//
+//	cfg: 飞书配置对象，包含应用凭证、事件订阅密钥和白名单
+//	bus: 消息总线，用于发布收到的消息
+//
+// 返回: 初始化后的FeishuChannel指针
+func NewFeishuChannel(cfg *config.FeishuConfig, bus *bus.MessageBus) *FeishuChannel {
+	baseURL := feishuAPIBaseURL
+	if strings.EqualFold(cfg.Domain, "lark") {
+		baseURL = larkAPIBaseURL
+	}
+	c := &FeishuChannel{
+		BaseChannel: NewBaseChannel("feishu", cfg, bus),
+		config:      cfg,
+		httpClient:  &http.Client{Timeout: 60 * time.Second},
+		apiBaseURL:  baseURL,
+		seen:        make(map[string]time.Time),
+		observe:     observeMode("feishu", cfg.Mode),
+	}
+	c.SetAllowFrom(cfg.AllowFrom)
+	return c
+}
+
+// SetAllowFrom 更新用户白名单（配置热重载时调用）
+func (c *FeishuChannel) SetAllowFrom(ids []string) {
+	allowFrom := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		allowFrom[id] = true
+	}
+	c.mu.Lock()
+	c.allowFrom = allowFrom
+	c.mu.Unlock()
+}
+
+// SetMediaManager 设置保存消息中图片和文件的媒体管理器
+func (c *FeishuChannel) SetMediaManager(store *media.Manager) {
+	c.mediaStore = store
+}
+
+// Capabilities 返回飞书频道的能力声明
+// 富文本消息的 md 标签支持标准 Markdown，图片和任意文件都可以发送
+func (c *FeishuChannel) Capabilities() Capabilities {
+	return Capabilities{
+		MaxMessageLength: feishuMessageMaxLength,
+		MaxCaptionLength: feishuMessageMaxLength,
+		MediaTypes:       []string{MediaPhoto, MediaDocument, MediaAudio, MediaVideo},
+		Markdown:         MarkdownStandard,
+	}
+}
+
+// Start 启动飞书频道
+// 检查配置并获取一次访问令牌，以便尽早发现应用凭证错误
+func (c *FeishuChannel) Start(ctx context.Context) error {
+	if c.config.AppID == "" || c.config.AppSecret == "" {
+		return fmt.Errorf("Feishu appId or appSecret not configured")
+	}
+	if c.config.VerificationToken == "" && c.config.EncryptKey == "" {
+		log.Println("Warning: Feishu verificationToken and encryptKey are both empty, event callbacks are not authenticated")
+	}
+
+	if _, err := c.tenantAccessToken(); err != nil {
+		return fmt.Errorf("failed to get Feishu access token: %w", err)
+	}
+	if c.observe {
+		if _, err := c.openID(); err != nil {
+			log.Printf("Warning: failed to get Feishu bot info, will retry on the next group message: %v", err)
+		}
+	}
+
+	c.running = true
+	log.Println("Feishu channel started (event endpoint: /feishu/events)")
+	return nil
+}
+
+// Stop 停止飞书频道
+func (c *FeishuChannel) Stop() error {
+	c.running = false
+	log.Println("Feishu channel stopped")
+	return nil
+}
+
+// ServeHTTP 处理飞书发来的事件回调
+// 飞书要求 3 秒内响应，因此消息的下载和发布在后台完成
+func (c *FeishuChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	// 配置了 encryptKey 时，飞书发来的事件都经过加密并带有签名（URL 验证请求除外，它没有签名），
+	// 未加密或没有签名的请求不是飞书发来的
+	signature := r.Header.Get("X-Lark-Signature")
+	if signature != "" && c.config.EncryptKey != "" {
+		if !c.verifySignature(r.Header.Get("X-Lark-Request-Timestamp"), r.Header.Get("X-Lark-Request-Nonce"), signature, body) {
+			http.Error(w, "invalid request signature", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var envelope feishuEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if c.config.EncryptKey != "" && envelope.Encrypt == "" {
+		http.Error(w, "event is not encrypted", http.StatusUnauthorized)
+		return
+	}
+	if envelope.Encrypt != "" {
+		plain, err := c.decrypt(envelope.Encrypt)
+		if err != nil {
+			http.Error(w, "failed to decrypt event", http.StatusBadRequest)
+			return
+		}
+		envelope = feishuEnvelope{}
+		if err := json.Unmarshal(plain, &envelope); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	token := envelope.Token
+	if envelope.Header != nil {
+		token = envelope.Header.Token
+	}
+	if c.config.VerificationToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.config.VerificationToken)) != 1 {
+		http.Error(w, "invalid verification token", http.StatusUnauthorized)
+		return
+	}
+
+	if c.config.EncryptKey != "" && signature == "" && envelope.Type != "url_verification" {
+		http.Error(w, "missing request signature", http.StatusUnauthorized)
+		return
+	}
+
+	if envelope.Type == "url_verification" {
+		writeFeishuJSON(w, map[string]string{"challenge": envelope.Challenge})
+		return
+	}
+
+	// 先响应，避免飞书超时重试
+	writeFeishuJSON(w, map[string]string{})
+
+	if envelope.Header == nil || envelope.Header.EventType != "im.message.receive_v1" {
+		return
+	}
+	if c.duplicate(envelope.Header.EventID) {
+		return
+	}
+
+	var event feishuMessageEvent
+	if err := json.Unmarshal(envelope.Event, &event); err != nil {
+		log.Printf("Failed to parse Feishu message event: %v", err)
+		return
+	}
+	go c.handleMessage(event)
+}
+
+// verifySignature 校验请求签名：sha256(timestamp + nonce + encryptKey + body)
+func (c *FeishuChannel) verifySignature(timestamp, nonce, signature string, body []byte) bool {
+	h := sha256.New()
+	h.Write([]byte(timestamp + nonce + c.config.EncryptKey))
+	h.Write(body)
+	expected := hex.EncodeToString(h.Sum(nil))
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1
+}
+
+// decrypt 解密事件内容
+// 密钥为 sha256(encryptKey)，密文 base64 解码后前 16 字节是 IV，使用 AES-256-CBC + PKCS7 填充
+func (c *FeishuChannel) decrypt(encrypted string) ([]byte, error) {
+	if c.config.EncryptKey == "" {
+		return nil, fmt.Errorf("received an encrypted event but encryptKey is not configured")
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid ciphertext length %d", len(data))
+	}
+
+	key := sha256.Sum256([]byte(c.config.EncryptKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(plain, data[aes.BlockSize:])
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plain) {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, fmt.Errorf("invalid padding")
+		}
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+// duplicate 判断事件是否已经处理过，同时清理过期的记录
+func (c *FeishuChannel) duplicate(eventID string) bool {
+	if eventID == "" {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for id, at := range c.seen {
+		if now.Sub(at) > feishuEventDedupTTL {
+			delete(c.seen, id)
+		}
+	}
+	if _, ok := c.seen[eventID]; ok {
+		return true
+	}
+	c.seen[eventID] = now
+	return false
+}
+
+// handleMessage 处理一条收到的消息
+func (c *FeishuChannel) handleMessage(event feishuMessageEvent) {
+	if event.Sender.SenderType != "" && event.Sender.SenderType != "user" {
+		return
+	}
+	senderID := event.Sender.SenderID.OpenID
+	msg := event.Message
+	if !c.allowed(senderID, event.Sender.SenderID.UserID) {
+		log.Printf("Ignoring Feishu message from unauthorized user: %s", senderID)
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"message_id":     msg.MessageID,
+		"feishu_chat":    msg.ChatType,
+		"feishu_user_id": event.Sender.SenderID.UserID,
+	}
+
+	content, resource := feishuMessageContent(msg.MessageType, msg.Content)
+
+	// 旁听模式：群聊中没有 @机器人 的消息只记入历史（不下载附件）
+	if c.observe && msg.ChatType == "group" && !c.mentioned(event) {
+		if resource != nil {
+			content = strings.TrimSpace(content + " [" + resource.kind + "]")
+		}
+		if content == "" {
+			return
+		}
+		markObserved(metadata, "")
+		c.publish(msg.MessageID, senderID, msg.ChatID, content, nil, metadata)
+		return
+	}
+
+	// 有工具调用在等待这个聊天的答复时，纯文本消息直接作为答复
+	if resource == nil && content != "" && c.handleInput(msg.ChatID, senderID, content) {
+		return
+	}
+
+	var media []string
+	if resource != nil {
+		item, err := c.downloadResource(msg.MessageID, *resource)
+		if err != nil {
+			log.Printf("Failed to download Feishu %s: %v", resource.kind, err)
+		} else {
+			media = append(media, item)
+		}
+	}
+	if content == "" && len(media) == 0 {
+		return
+	}
+	c.publish(msg.MessageID, senderID, msg.ChatID, content, media, metadata)
+}
+
+// publish 把收到的消息发布到消息总线
+func (c *FeishuChannel) publish(messageID, senderID, chatID, content string, media []string, metadata map[string]interface{}) {
+	inbound := bus.InboundMessage{
+		Message: bus.Message{
+			ID:       messageID,
+			Channel:  "feishu",
+			SenderID: senderID,
+			ChatID:   chatID,
+			Content:  content,
+			Media:    media,
+			Metadata: metadata,
+		},
+	}
+	if err := c.bus.PublishInbound(inbound); err != nil {
+		log.Printf("Error publishing inbound message: %v", err)
+	}
+}
+
+// mentioned 判断消息是否 @ 了机器人
+// 无法获取机器人的 open_id 时，消息中有任何 @ 都视为 @机器人（宁可多回复，也不漏掉对机器人说的话）
+func (c *FeishuChannel) mentioned(event feishuMessageEvent) bool {
+	if len(event.Message.Mentions) == 0 {
+		return false
+	}
+	openID, err := c.openID()
+	if err != nil {
+		log.Printf("Failed to get Feishu bot info: %v", err)
+		return true
+	}
+	for _, mention := range event.Message.Mentions {
+		if mention.ID.OpenID == openID {
+			return true
+		}
+	}
+	return false
+}
+
+// openID 返回机器人的 open_id，第一次调用时通过 /open-apis/bot/v3/info 获取
+func (c *FeishuChannel) openID() (string, error) {
+	c.mu.Lock()
+	openID := c.botOpenID
+	c.mu.Unlock()
+	if openID != "" {
+		return openID, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.apiBaseURL+"/open-apis/bot/v3/info", nil)
+	if err != nil {
+		return "", err
+	}
+	token, err := c.tenantAccessToken()
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// 这个接口的机器人信息在 bot 字段中，而不是通用的 data 字段
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+		Bot  struct {
+			OpenID string `json:"open_id"`
+		} `json:"bot"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode bot info response: %w", err)
+	}
+	if result.Code != 0 || result.Bot.OpenID == "" {
+		return "", fmt.Errorf("code=%d, msg=%s", result.Code, result.Msg)
+	}
+
+	c.mu.Lock()
+	c.botOpenID = result.Bot.OpenID
+	c.mu.Unlock()
+	return result.Bot.OpenID, nil
+}
+
+// allowed 检查用户是否在白名单中（白名单为空表示不限制）
+func (c *FeishuChannel) allowed(openID, userID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.allowFrom) == 0 {
+		return true
+	}
+	return c.allowFrom[openID] || (userID != "" && c.allowFrom[userID])
+}
+
+// feishuResource 是消息中附带的图片或文件
+type feishuResource struct {
+	kind string // image 或 file（下载接口的 type 参数）
+	key  string // image_key 或 file_key
+	name string // 文件名（图片没有文件名）
+}
+
+// feishuMessageContent 解析消息内容
+// 文本和富文本转换为纯文本（去掉 @ 占位符），图片和文件返回需要下载的资源
+func feishuMessageContent(messageType, raw string) (string, *feishuResource) {
+	var content struct {
+		Text     string `json:"text"`
+		ImageKey string `json:"image_key"`
+		FileKey  string `json:"file_key"`
+		FileName string `json:"file_name"`
+	}
+
+	switch messageType {
+	case "text":
+		json.Unmarshal([]byte(raw), &content)
+		return strings.TrimSpace(feishuMentionPattern.ReplaceAllString(content.Text, "")), nil
+	case "post":
+		return feishuPostText(raw)
+	case "image":
+		json.Unmarshal([]byte(raw), &content)
+		if content.ImageKey == "" {
+			return "", nil
+		}
+		return "", &feishuResource{kind: "image", key: content.ImageKey}
+	case "file", "audio", "media":
+		json.Unmarshal([]byte(raw), &content)
+		if content.FileKey == "" {
+			return "", nil
+		}
+		return "", &feishuResource{kind: "file", key: content.FileKey, name: content.FileName}
+	default:
+		return "", nil
+	}
+}
+
+// feishuPostText 把富文本消息转换为纯文本，返回其中的第一张图片
+// 富文本内容格式：{"title": "...", "content": [[{"tag": "text", "text": "..."}, {"tag": "img", "image_key": "..."}]]}
+func feishuPostText(raw string) (string, *feishuResource) {
+	var post struct {
+		Title   string `json:"title"`
+		Content [][]struct {
+			Tag      string `json:"tag"`
+			Text     string `json:"text"`
+			Href     string `json:"href"`
+			ImageKey string `json:"image_key"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(raw), &post); err != nil {
+		return "", nil
+	}
+
+	var lines []string
+	if post.Title != "" {
+		lines = append(lines, post.Title)
+	}
+	var image *feishuResource
+	for _, paragraph := range post.Content {
+		var sb strings.Builder
+		for _, element := range paragraph {
+			switch element.Tag {
+			case "text", "code_block":
+				sb.WriteString(element.Text)
+			case "a":
+				sb.WriteString(element.Text)
+				if element.Href != "" && element.Href != element.Text {
+					sb.WriteString(" (" + element.Href + ")")
+				}
+			case "img":
+				if image == nil && element.ImageKey != "" {
+					image = &feishuResource{kind: "image", key: element.ImageKey}
+				}
+			}
+		}
+		lines = append(lines, sb.String())
+	}
+	text := feishuMentionPattern.ReplaceAllString(strings.Join(lines, "\n"), "")
+	return strings.TrimSpace(text), image
+}
+
+// downloadResource 把消息中的图片或文件下载到媒体目录
+func (c *FeishuChannel) downloadResource(messageID string, resource feishuResource) (string, error) {
+	if c.mediaStore == nil {
+		return "", fmt.Errorf("media storage is not configured")
+	}
+	token, err := c.tenantAccessToken()
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/open-apis/im/v1/messages/%s/resources/%s?type=%s", c.apiBaseURL, messageID, resource.key, resource.kind)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return c.mediaStore.Download(c.httpClient, req, resource.name)
+}
+
+// Send 通过飞书发送消息
+// 文本以富文本 md 标签发送（支持 Markdown），超长时按代码块拆分；
+// 本地图片和文件先上传再作为单独的消息发送，链接直接附在文本中
+func (c *FeishuChannel) Send(msg bus.OutboundMessage) error {
+	content := msg.Content
+	var files []string
+	for _, media := range msg.Media {
+		if strings.HasPrefix(media, "http://") || strings.HasPrefix(media, "https://") {
+			content = strings.TrimSpace(content + "\n" + media)
+			continue
+		}
+		files = append(files, media)
+	}
+
+	for _, part := range splitMarkdown(content, feishuMessageMaxLength) {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		post := map[string]interface{}{
+			"zh_cn": map[string]interface{}{
+				"content": [][]map[string]string{{{"tag": "md", "text": part}}},
+			},
+		}
+		if err := c.sendMessage(msg.ChatID, "post", post); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		if err := c.sendFile(msg.ChatID, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendFile 上传并发送一个本地文件，图片以图片消息发送，其他文件以文件消息发送
+func (c *FeishuChannel) sendFile(chatID, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read attachment: %w", err)
+	}
+	name := filepath.Base(path)
+
+	if strings.HasPrefix(http.DetectContentType(data), "image/") {
+		var result struct {
+			ImageKey string `json:"image_key"`
+		}
+		fields := map[string]string{"image_type": "message"}
+		if err := c.upload("/open-apis/im/v1/images", fields, "image", name, data, &result); err != nil {
+			return err
+		}
+		return c.sendMessage(chatID, "image", map[string]string{"image_key": result.ImageKey})
+	}
+
+	var result struct {
+		FileKey string `json:"file_key"`
+	}
+	fields := map[string]string{"file_type": "stream", "file_name": name}
+	if err := c.upload("/open-apis/im/v1/files", fields, "file", name, data, &result); err != nil {
+		return err
+	}
+	return c.sendMessage(chatID, "file", map[string]string{"file_key": result.FileKey})
+}
+
+// sendMessage 向群聊或单聊发送一条消息
+// 参数:
+//
+//	chatID: 会话 ID（chat_id）
+//	msgType: 消息类型（post、image、file 等）
+//	content: 消息内容，会编码为 JSON 字符串
+func (c *FeishuChannel) sendMessage(chatID, msgType string, content interface{}) error {
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	payload := map[string]string{
+		"receive_id": chatID,
+		"msg_type":   msgType,
+		"content":    string(contentJSON),
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.apiBaseURL+"/open-apis/im/v1/messages?receive_id_type=chat_id", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return c.doFeishu(req, nil)
+}
+
+// upload 以 multipart 上传图片或文件
+func (c *FeishuChannel) upload(path string, fields map[string]string, fileField, fileName string, data []byte, result interface{}) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			return err
+		}
+	}
+	part, err := writer.CreateFormFile(fileField, fileName)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.apiBaseURL+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return c.doFeishu(req, result)
+}
+
+// doFeishu 带上访问令牌调用开放平台 API，并检查响应中的 code
+// 参数:
+//
+//	req: 请求（不含 Authorization 头）
+//	result: data 字段的解码目标（为 nil 表示忽略）
+func (c *FeishuChannel) doFeishu(req *http.Request, result interface{}) error {
+	token, err := c.tenantAccessToken()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var apiResp feishuResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return fmt.Errorf("Feishu API %s failed: status=%d, response=%q", req.URL.Path, resp.StatusCode, string(body))
+	}
+	if apiResp.Code != 0 {
+		return fmt.Errorf("Feishu API %s failed: code=%d, msg=%s", req.URL.Path, apiResp.Code, apiResp.Msg)
+	}
+	if result != nil && len(apiResp.Data) > 0 {
+		return json.Unmarshal(apiResp.Data, result)
+	}
+	return nil
+}
+
+// tenantAccessToken 返回缓存的 tenant_access_token，过期前 5 分钟重新获取
+func (c *FeishuChannel) tenantAccessToken() (string, error) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.accessToken != "" && time.Until(c.tokenExpiry) > 5*time.Minute {
+		return c.accessToken, nil
+	}
+
+	data, err := json.Marshal(map[string]string{
+		"app_id":     c.config.AppID,
+		"app_secret": c.config.AppSecret,
+	})
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.httpClient.Post(c.apiBaseURL+"/open-apis/auth/v3/tenant_access_token/internal", "application/json; charset=utf-8", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code              int    `json:"code"`
+		Msg               string `json:"msg"`
+		TenantAccessToken string `json:"tenant_access_token"`
+		Expire            int    `json:"expire"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode access token response: %w", err)
+	}
+	if result.Code != 0 {
+		return "", fmt.Errorf("code=%d, msg=%s", result.Code, result.Msg)
+	}
+
+	c.accessToken = result.TenantAccessToken
+	c.tokenExpiry = time.Now().Add(time.Duration(result.Expire) * time.Second)
+	return c.accessToken, nil
+}
+
+// Check 获取 tenant_access_token，校验 App ID 和 App Secret（实现 Checker）
+func (c *FeishuChannel) Check() (string, error) {
+	if _, err := c.tenantAccessToken(); err != nil {
+		return "", err
+	}
+	return "app " + c.config.AppID, nil
+}
+
+// writeFeishuJSON 写入事件回调的 JSON 响应
+func writeFeishuJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,161 @@
+package channels
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/config"
+)
+
+// feishuDocVector 是飞书开放平台文档中的解密示例：encryptKey 为 "test key"，明文为 "hello world"
+const feishuDocVector = "P37w+VZImNgPEO1RBhJ6RtKl7n6zymIbEG1pReEzghk="
+
+// feishuSeal 按飞书的格式加密已经填充好的数据：base64(IV + AES-256-CBC 密文)
+func feishuSeal(t *testing.T, encryptKey string, padded []byte) string {
+	t.Helper()
+	key := sha256.Sum256([]byte(encryptKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := bytes.Repeat([]byte{7}, aes.BlockSize)
+	out := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+	return base64.StdEncoding.EncodeToString(append(iv, out...))
+}
+
+// feishuEncrypt 用 PKCS7 填充后加密
+func feishuEncrypt(t *testing.T, encryptKey string, plain []byte) string {
+	t.Helper()
+	n := aes.BlockSize - len(plain)%aes.BlockSize
+	return feishuSeal(t, encryptKey, append(plain, bytes.Repeat([]byte{byte(n)}, n)...))
+}
+
+// feishuSign 按飞书的规则计算请求签名：sha256(timestamp + nonce + encryptKey + body)
+func feishuSign(timestamp, nonce, encryptKey string, body []byte) string {
+	sum := sha256.Sum256(append([]byte(timestamp+nonce+encryptKey), body...))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFeishuDecrypt(t *testing.T) {
+	badPadding := append([]byte("hello world"), 1, 2, 3, 4, 5)
+
+	tests := []struct {
+		name      string
+		key       string
+		encrypted string
+		want      string
+		wantErr   bool
+	}{
+		{"documented vector", "test key", feishuDocVector, "hello world", false},
+		{"round trip", "s3cret", feishuEncrypt(t, "s3cret", []byte(`{"type":"url_verification"}`)), `{"type":"url_verification"}`, false},
+		{"wrong key", "other key", feishuDocVector, "", true},
+		{"no key configured", "", feishuDocVector, "", true},
+		{"not base64", "test key", "not base64!", "", true},
+		{"truncated", "test key", base64.StdEncoding.EncodeToString(make([]byte, aes.BlockSize)), "", true},
+		{"not block aligned", "test key", base64.StdEncoding.EncodeToString(make([]byte, 2*aes.BlockSize+1)), "", true},
+		{"inconsistent padding", "test key", feishuSeal(t, "test key", badPadding), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewFeishuChannel(&config.FeishuConfig{EncryptKey: tt.key}, bus.New(1))
+			got, err := c.decrypt(tt.encrypted)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decrypt() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || string(got) != tt.want {
+				t.Fatalf("decrypt() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeishuVerifySignature(t *testing.T) {
+	body := []byte(`{"encrypt":"abc"}`)
+	valid := feishuSign("1700000000", "nonce", "s3cret", body)
+
+	tests := []struct {
+		name             string
+		timestamp, nonce string
+		signature        string
+		body             []byte
+		want             bool
+	}{
+		{"valid", "1700000000", "nonce", valid, body, true},
+		{"tampered body", "1700000000", "nonce", valid, []byte(`{"encrypt":"abd"}`), false},
+		{"tampered timestamp", "1700000001", "nonce", valid, body, false},
+		{"tampered nonce", "1700000000", "other", valid, body, false},
+		{"signed with another key", "1700000000", "nonce", feishuSign("1700000000", "nonce", "other", body), body, false},
+		{"empty signature", "1700000000", "nonce", "", body, false},
+	}
+
+	c := NewFeishuChannel(&config.FeishuConfig{EncryptKey: "s3cret"}, bus.New(1))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.verifySignature(tt.timestamp, tt.nonce, tt.signature, tt.body); got != tt.want {
+				t.Errorf("verifySignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeishuServeHTTPAuthentication(t *testing.T) {
+	const key, token = "s3cret", "t0ken"
+	envelope := func(inner string) []byte {
+		return []byte(`{"encrypt":"` + feishuEncrypt(t, key, []byte(inner)) + `"}`)
+	}
+	event := envelope(`{"schema":"2.0","header":{"event_id":"1","event_type":"im.chat.updated_v1","token":"t0ken"},"event":{}}`)
+	wrongToken := envelope(`{"schema":"2.0","header":{"event_id":"2","event_type":"im.chat.updated_v1","token":"other"},"event":{}}`)
+	challenge := envelope(`{"type":"url_verification","token":"t0ken","challenge":"ping"}`)
+
+	tests := []struct {
+		name     string
+		body     []byte
+		signed   bool
+		tamper   bool // 签名后修改请求体
+		wantCode int
+		wantBody string
+	}{
+		{"signed encrypted event", event, true, false, http.StatusOK, "{}"},
+		{"url verification without signature", challenge, false, false, http.StatusOK, `"challenge":"ping"`},
+		{"tampered body", event, true, true, http.StatusUnauthorized, "invalid request signature"},
+		{"missing signature", event, false, false, http.StatusUnauthorized, "missing request signature"},
+		{"not encrypted", []byte(`{"type":"url_verification","token":"t0ken","challenge":"ping"}`), false, false, http.StatusUnauthorized, "not encrypted"},
+		{"wrong verification token", wrongToken, true, false, http.StatusUnauthorized, "invalid verification token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewFeishuChannel(&config.FeishuConfig{EncryptKey: key, VerificationToken: token}, bus.New(1))
+			body := tt.body
+			if tt.tamper {
+				body = envelope(`{"type":"url_verification","token":"t0ken","challenge":"forged"}`)
+			}
+			r := httptest.NewRequest("POST", "/feishu/events", bytes.NewReader(body))
+			if tt.signed {
+				r.Header.Set("X-Lark-Request-Timestamp", "1700000000")
+				r.Header.Set("X-Lark-Request-Nonce", "nonce")
+				r.Header.Set("X-Lark-Signature", feishuSign("1700000000", "nonce", key, tt.body))
+			}
+
+			w := httptest.NewRecorder()
+			c.ServeHTTP(w, r)
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Fatalf("ServeHTTP() = %d %q, want %d containing %q", w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+		})
+	}
+}
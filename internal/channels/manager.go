@@ -5,11 +5,17 @@ package channels
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net/http"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/Ailoc/nanogrip/internal/bus"
 	"github.com/Ailoc/nanogrip/internal/config"
+	"github.com/Ailoc/nanogrip/internal/media"
+	"github.com/Ailoc/nanogrip/internal/providers"
 )
 
 // Manager 频道管理器，负责管理多个聊天频道的生命周期
@@ -19,11 +25,20 @@ import (
 // 3. 提供频道查询和列表功能
 // 4. 使用读写锁保证并发安全
 type Manager struct {
-	bus      *bus.MessageBus    // 消息总线，用于在频道间传递消息
-	cfg      *config.Config     // 全局配置对象，包含所有频道的配置信息
-	channels map[string]Channel // 频道映射表，key为频道名称，value为频道实例
-	wg       sync.WaitGroup     // 等待组，用于优雅关闭时等待所有goroutine完成
-	mu       sync.RWMutex       // 读写锁，保护channels映射表的并发访问
+	bus      *bus.MessageBus               // 消息总线，用于在频道间传递消息
+	cfg      *config.Config                // 全局配置对象，包含所有频道的配置信息
+	channels map[string]Channel            // 频道映射表，key为频道名称，value为频道实例
+	cancels  map[string]context.CancelFunc // 各频道的取消函数，用于单独停止某个频道
+	wg       sync.WaitGroup                // 等待组，用于优雅关闭时等待所有goroutine完成
+	mu       sync.RWMutex                  // 读写锁，保护channels映射表的并发访问
+	media    *media.Manager                // 媒体管理器，保存用户发送的图片和文件（所有频道共用）
+
+	inputHandler func(channel, chatID, senderID, input string) bool // 交互式输入回调，启动频道时传给支持的频道
+
+	// 运行时停用的频道（见 toggle.go，由 mu 保护）
+	ctx      context.Context   // StartAll 的上下文，Enable 重新启动频道时使用
+	disabled map[string]bool   // 用 Disable 停用的频道，配置热重载不会启动它们
+	onEnable func(name string) // Enable 之后调用，出站分发器据此发送停用期间暂存的消息
 }
 
 // NewManager 创建一个新的频道管理器实例
@@ -38,9 +53,24 @@ func NewManager(bus *bus.MessageBus, cfg *config.Config) *Manager {
 		bus:      bus,
 		cfg:      cfg,
 		channels: make(map[string]Channel),
+		cancels:  make(map[string]context.CancelFunc),
+		media:    newMediaManager(cfg),
 	}
 }
 
+// newMediaManager 根据配置创建媒体管理器，文件保存在工作区的 media/ 目录
+func newMediaManager(cfg *config.Config) *media.Manager {
+	mc := cfg.Channels.Media
+	opts := media.Options{
+		MaxSize:      int64(mc.MaxSizeMB) << 20,
+		AllowedTypes: mc.AllowedTypes,
+	}
+	if mc.RetentionDays > 0 {
+		opts.Retention = time.Duration(mc.RetentionDays) * 24 * time.Hour
+	}
+	return media.NewManager(filepath.Join(cfg.GetWorkspacePath(), media.DirName), opts)
+}
+
 // StartAll 启动所有已启用的频道
 // 该方法会遍历配置文件中所有频道的启用状态，逐个创建和启动频道实例
 // 工作流程：
@@ -55,23 +85,349 @@ func NewManager(bus *bus.MessageBus, cfg *config.Config) *Manager {
 //
 // 返回: 始终返回nil（各频道启动失败不会导致方法失败）
 func (m *Manager) StartAll(ctx context.Context) error {
+	m.mu.Lock()
+	m.ctx = ctx
+	m.mu.Unlock()
+
+	// 定期清理过期的媒体文件
+	go m.media.Run(ctx)
+
 	// 启动 Telegram 频道
 	// Telegram使用HTTP长轮询方式接收消息，通过REST API发送消息
 	if m.cfg.Channels.Telegram.Enabled {
-		ch := NewTelegramChannel(&m.cfg.Channels.Telegram, m.bus)
-		if err := ch.Start(ctx); err != nil {
+		if err := m.startTelegram(ctx, m.cfg); err != nil {
 			log.Printf("Failed to start Telegram: %v", err)
-		} else {
-			m.mu.Lock()
-			m.channels["telegram"] = ch
-			m.mu.Unlock()
-			log.Println("Telegram channel started")
+		}
+	}
+
+	// 启动 Discord 频道
+	// Discord 斜杠命令通过 gateway 的 /discord/interactions 端点接收，通过REST API发送消息
+	if m.cfg.Channels.Discord.Enabled {
+		if err := m.startDiscord(ctx, m.cfg); err != nil {
+			log.Printf("Failed to start Discord: %v", err)
+		}
+	}
+
+	// 启动飞书频道
+	// 飞书消息通过 gateway 的 /feishu/events 端点（事件订阅）接收，通过 IM API 发送消息
+	if m.cfg.Channels.Feishu.Enabled {
+		if err := m.startFeishu(ctx, m.cfg); err != nil {
+			log.Printf("Failed to start Feishu: %v", err)
+		}
+	}
+
+	// 启动 Webhook 频道
+	// 外部事件通过 gateway 的 /hooks/<名称> 端点接收，回复转发到配置的聊天
+	if m.cfg.Channels.Webhook.Enabled {
+		if err := m.startWebhook(ctx, m.cfg); err != nil {
+			log.Printf("Failed to start Webhook: %v", err)
 		}
 	}
 
 	return nil
 }
 
+// startTelegram 创建并启动 Telegram 频道
+// 每个频道使用独立的子上下文，以便热重载时单独停止
+func (m *Manager) startTelegram(ctx context.Context, cfg *config.Config) error {
+	ch := NewTelegramChannel(&cfg.Channels.Telegram, m.bus)
+	ch.SetOffsetPath(filepath.Join(cfg.GetWorkspacePath(), "telegram-offset.json"))
+	ch.SetMediaManager(m.media)
+	if transcriber := m.newTranscriber(cfg); transcriber != nil {
+		ch.SetTranscriber(transcriber)
+	}
+	if m.inputHandler != nil {
+		ch.SetInputHandler(m.inputHandler)
+	}
+
+	chCtx, cancel := context.WithCancel(ctx)
+	if err := ch.Start(chCtx); err != nil {
+		cancel()
+		return err
+	}
+
+	m.mu.Lock()
+	m.channels["telegram"] = ch
+	m.cancels["telegram"] = cancel
+	m.mu.Unlock()
+	log.Println("Telegram channel started")
+	return nil
+}
+
+// startDiscord 创建并启动 Discord 频道
+func (m *Manager) startDiscord(ctx context.Context, cfg *config.Config) error {
+	ch := NewDiscordChannel(&cfg.Channels.Discord, m.bus)
+	ch.SetMediaManager(m.media)
+	if m.inputHandler != nil {
+		ch.SetInputHandler(m.inputHandler)
+	}
+
+	chCtx, cancel := context.WithCancel(ctx)
+	if err := ch.Start(chCtx); err != nil {
+		cancel()
+		return err
+	}
+
+	m.mu.Lock()
+	m.channels["discord"] = ch
+	m.cancels["discord"] = cancel
+	m.mu.Unlock()
+	return nil
+}
+
+// HandleDiscordInteraction 把 Discord 交互请求转给运行中的 Discord 频道
+// 注册到 gateway HTTP 服务；每次请求时重新查找频道，热重载重启频道后仍然有效
+func (m *Manager) HandleDiscordInteraction(w http.ResponseWriter, r *http.Request) {
+	ch, ok := m.GetChannel("discord").(*DiscordChannel)
+	if !ok {
+		http.Error(w, "discord channel is not running", http.StatusServiceUnavailable)
+		return
+	}
+	ch.ServeHTTP(w, r)
+}
+
+// startFeishu 创建并启动飞书频道
+func (m *Manager) startFeishu(ctx context.Context, cfg *config.Config) error {
+	ch := NewFeishuChannel(&cfg.Channels.Feishu, m.bus)
+	ch.SetMediaManager(m.media)
+	if m.inputHandler != nil {
+		ch.SetInputHandler(m.inputHandler)
+	}
+
+	chCtx, cancel := context.WithCancel(ctx)
+	if err := ch.Start(chCtx); err != nil {
+		cancel()
+		return err
+	}
+
+	m.mu.Lock()
+	m.channels["feishu"] = ch
+	m.cancels["feishu"] = cancel
+	m.mu.Unlock()
+	return nil
+}
+
+// HandleFeishuEvent 把飞书事件回调转给运行中的飞书频道
+// 注册到 gateway HTTP 服务；每次请求时重新查找频道，热重载重启频道后仍然有效
+func (m *Manager) HandleFeishuEvent(w http.ResponseWriter, r *http.Request) {
+	ch, ok := m.GetChannel("feishu").(*FeishuChannel)
+	if !ok {
+		http.Error(w, "feishu channel is not running", http.StatusServiceUnavailable)
+		return
+	}
+	ch.ServeHTTP(w, r)
+}
+
+// startWebhook 创建并启动 Webhook 频道
+func (m *Manager) startWebhook(ctx context.Context, cfg *config.Config) error {
+	ch := NewWebhookChannel(&cfg.Channels.Webhook, m.bus)
+
+	chCtx, cancel := context.WithCancel(ctx)
+	if err := ch.Start(chCtx); err != nil {
+		cancel()
+		return err
+	}
+
+	m.mu.Lock()
+	m.channels["webhook"] = ch
+	m.cancels["webhook"] = cancel
+	m.mu.Unlock()
+	return nil
+}
+
+// HandleWebhook 把外部事件转给运行中的 Webhook 频道
+// 注册到 gateway HTTP 服务；每次请求时重新查找频道，热重载重启频道后仍然有效
+func (m *Manager) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	ch, ok := m.GetChannel("webhook").(*WebhookChannel)
+	if !ok {
+		http.Error(w, "webhook channel is not running", http.StatusServiceUnavailable)
+		return
+	}
+	ch.ServeHTTP(w, r)
+}
+
+// stopChannel 停止并移除单个频道
+func (m *Manager) stopChannel(name string) {
+	m.mu.Lock()
+	ch := m.channels[name]
+	cancel := m.cancels[name]
+	delete(m.channels, name)
+	delete(m.cancels, name)
+	m.mu.Unlock()
+
+	if ch == nil {
+		return
+	}
+	log.Printf("Stopping channel: %s", name)
+	ch.Stop()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Apply 应用新的频道配置（配置热重载）
+// 新启用的频道会被启动，被禁用的频道会被停止（用 Disable 停用的频道视为禁用）；
+// 运行中的频道更新白名单，Token 变化时重启该频道
+// 参数:
+//
+//	ctx: 新启动频道使用的上下文
+//	cfg: 新的配置
+//
+// 返回: 运行中的频道是否发生变化（启动、停止或重启）
+func (m *Manager) Apply(ctx context.Context, cfg *config.Config) bool {
+	m.mu.Lock()
+	previous := m.cfg
+	m.cfg = cfg
+	ch := m.channels["telegram"]
+	m.mu.Unlock()
+
+	changed := m.applyDiscord(ctx, cfg, previous)
+	if m.applyFeishu(ctx, cfg, previous) {
+		changed = true
+	}
+	if m.applyWebhook(ctx, cfg) {
+		changed = true
+	}
+
+	tgCfg := cfg.Channels.Telegram
+	tgCfg.Enabled = tgCfg.Enabled && !m.Disabled("telegram")
+	switch {
+	case tgCfg.Enabled && ch == nil:
+		if err := m.startTelegram(ctx, cfg); err != nil {
+			log.Printf("Failed to start Telegram: %v", err)
+			return changed
+		}
+		return true
+	case !tgCfg.Enabled && ch != nil:
+		m.stopChannel("telegram")
+		return true
+	case ch != nil && tgCfg.Token != previous.Channels.Telegram.Token:
+		m.stopChannel("telegram")
+		if err := m.startTelegram(ctx, cfg); err != nil {
+			log.Printf("Failed to restart Telegram: %v", err)
+		}
+		return true
+	case ch != nil:
+		if tg, ok := ch.(*TelegramChannel); ok {
+			tg.SetAllowFrom(tgCfg.AllowFrom)
+		}
+	}
+	return changed
+}
+
+// applyDiscord 应用新的 Discord 配置，返回运行中的频道是否发生变化
+func (m *Manager) applyDiscord(ctx context.Context, cfg, previous *config.Config) bool {
+	ch := m.GetChannel("discord")
+	dcCfg, prev := cfg.Channels.Discord, previous.Channels.Discord
+	dcCfg.Enabled = dcCfg.Enabled && !m.Disabled("discord")
+	switch {
+	case dcCfg.Enabled && ch == nil:
+		if err := m.startDiscord(ctx, cfg); err != nil {
+			log.Printf("Failed to start Discord: %v", err)
+			return false
+		}
+		return true
+	case !dcCfg.Enabled && ch != nil:
+		m.stopChannel("discord")
+		return true
+	case ch != nil && (dcCfg.Token != prev.Token || dcCfg.ApplicationID != prev.ApplicationID ||
+		dcCfg.PublicKey != prev.PublicKey || dcCfg.GuildID != prev.GuildID):
+		m.stopChannel("discord")
+		if err := m.startDiscord(ctx, cfg); err != nil {
+			log.Printf("Failed to restart Discord: %v", err)
+		}
+		return true
+	case ch != nil:
+		if dc, ok := ch.(*DiscordChannel); ok {
+			dc.SetAllowFrom(dcCfg.AllowFrom)
+		}
+	}
+	return false
+}
+
+// applyFeishu 应用新的飞书配置，返回运行中的频道是否发生变化
+func (m *Manager) applyFeishu(ctx context.Context, cfg, previous *config.Config) bool {
+	ch := m.GetChannel("feishu")
+	fsCfg, prev := cfg.Channels.Feishu, previous.Channels.Feishu
+	fsCfg.Enabled = fsCfg.Enabled && !m.Disabled("feishu")
+	switch {
+	case fsCfg.Enabled && ch == nil:
+		if err := m.startFeishu(ctx, cfg); err != nil {
+			log.Printf("Failed to start Feishu: %v", err)
+			return false
+		}
+		return true
+	case !fsCfg.Enabled && ch != nil:
+		m.stopChannel("feishu")
+		return true
+	case ch != nil && (fsCfg.AppID != prev.AppID || fsCfg.AppSecret != prev.AppSecret ||
+		fsCfg.EncryptKey != prev.EncryptKey || fsCfg.VerificationToken != prev.VerificationToken ||
+		fsCfg.Domain != prev.Domain):
+		m.stopChannel("feishu")
+		if err := m.startFeishu(ctx, cfg); err != nil {
+			log.Printf("Failed to restart Feishu: %v", err)
+		}
+		return true
+	case ch != nil:
+		if fs, ok := ch.(*FeishuChannel); ok {
+			fs.SetAllowFrom(fsCfg.AllowFrom)
+		}
+	}
+	return false
+}
+
+// applyWebhook 应用新的 Webhook 配置，返回运行中的频道是否发生变化
+// Webhook 列表的修改直接生效，不需要重启频道
+func (m *Manager) applyWebhook(ctx context.Context, cfg *config.Config) bool {
+	ch := m.GetChannel("webhook")
+	whCfg := cfg.Channels.Webhook
+	whCfg.Enabled = whCfg.Enabled && !m.Disabled("webhook")
+	switch {
+	case whCfg.Enabled && ch == nil:
+		if err := m.startWebhook(ctx, cfg); err != nil {
+			log.Printf("Failed to start Webhook: %v", err)
+			return false
+		}
+		return true
+	case !whCfg.Enabled && ch != nil:
+		m.stopChannel("webhook")
+		return true
+	case ch != nil:
+		if wh, ok := ch.(*WebhookChannel); ok {
+			wh.SetHooks(whCfg.Hooks)
+		}
+	}
+	return false
+}
+
+// SetInputHandler 设置交互式输入回调
+// 必须在 StartAll 之前调用；回调返回 true 表示输入已被消费，不再发布到消息总线
+func (m *Manager) SetInputHandler(handler func(channel, chatID, senderID, input string) bool) {
+	m.inputHandler = handler
+}
+
+// newTranscriber 根据配置创建语音转写服务
+// 未配置或配置错误时返回nil（语音消息将无法转写，但不影响频道启动）
+func (m *Manager) newTranscriber(cfg *config.Config) providers.Transcriber {
+	tc := cfg.Providers.Transcription
+	transcriber, err := providers.NewTranscriber(providers.TranscriberOptions{
+		Provider: tc.Provider,
+		Model:    tc.Model,
+		Language: tc.Language,
+		Command:  tc.Command,
+		Timeout:  time.Duration(tc.Timeout) * time.Second,
+		OpenAI: providers.APIConfig{
+			APIKey:  cfg.Providers.OpenAI.APIKey,
+			APIBase: cfg.Providers.OpenAI.APIBase,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to create transcriber: %v", err)
+		return nil
+	}
+	return transcriber
+}
+
 // StopAll 停止所有正在运行的频道
 // 该方法会遍历所有已注册的频道，逐个调用Stop方法进行优雅关闭
 // 使用读锁保证在停止过程中不会有新的频道被添加或删除
@@ -84,6 +440,9 @@ func (m *Manager) StopAll() {
 	for name, ch := range m.channels {
 		log.Printf("Stopping channel: %s", name)
 		ch.Stop()
+		if cancel := m.cancels[name]; cancel != nil {
+			cancel()
+		}
 	}
 }
 
@@ -115,3 +474,104 @@ func (m *Manager) ListChannels() []string {
 	}
 	return names
 }
+
+// Enabled 列出配置中启用的频道名称（包括启动失败、尚未启动和用 Disable 停用的频道）
+// 出站分发器据此订阅消息总线，频道启动之前发布的消息在队列中等待，而不是因为找不到订阅者进入死信
+func (m *Manager) Enabled() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var names []string
+	if m.cfg.Channels.Telegram.Enabled {
+		names = append(names, "telegram")
+	}
+	if m.cfg.Channels.Discord.Enabled {
+		names = append(names, "discord")
+	}
+	if m.cfg.Channels.Feishu.Enabled {
+		names = append(names, "feishu")
+	}
+	if m.cfg.Channels.Webhook.Enabled {
+		names = append(names, "webhook")
+	}
+	return names
+}
+
+// SendTyping 在指定频道的聊天中显示"正在输入"状态
+// 频道未启动或不支持输入状态时什么也不做
+// 参数:
+//
+//	channel: 频道名称
+//	chatID: 聊天 ID
+func (m *Manager) SendTyping(channel, chatID string) error {
+	ch := m.GetChannel(channel)
+	if ch == nil {
+		return nil
+	}
+	if indicator, ok := ch.(TypingIndicator); ok {
+		return indicator.SendTyping(chatID)
+	}
+	return nil
+}
+
+// React 用表情回应指定频道中的一条消息
+// 频道未启动或不支持表情回应时什么也不做
+// 参数:
+//
+//	channel: 频道名称
+//	chatID: 聊天 ID
+//	messageID: 被回应的消息 ID
+//	emoji: 表情，为空表示移除回应
+func (m *Manager) React(channel, chatID, messageID, emoji string) error {
+	ch := m.GetChannel(channel)
+	if ch == nil {
+		return nil
+	}
+	if reactor, ok := ch.(Reactor); ok {
+		return reactor.React(chatID, messageID, emoji)
+	}
+	return nil
+}
+
+// Capabilities 返回所有已启动频道的能力声明
+// 返回: key 为频道名称的能力映射
+func (m *Manager) Capabilities() map[string]Capabilities {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	caps := make(map[string]Capabilities, len(m.channels))
+	for name, ch := range m.channels {
+		caps[name] = CapabilitiesOf(ch)
+	}
+	return caps
+}
+
+// NewSender 创建只用于发送消息的频道实例（不启动接收消息的轮询）
+// 用于在 gateway 之外发送消息，例如 "nanogrip outbox resend" 补发失败的消息
+// 参数:
+//
+//	cfg: 配置对象
+//	name: 频道名称
+//
+// 返回: 频道实例；频道未启用或不支持时返回错误
+func NewSender(cfg *config.Config, name string) (Channel, error) {
+	switch name {
+	case "telegram":
+		if !cfg.Channels.Telegram.Enabled || cfg.Channels.Telegram.Token == "" {
+			return nil, fmt.Errorf("channel %q is not enabled", name)
+		}
+		return NewTelegramChannel(&cfg.Channels.Telegram, nil), nil
+	case "discord":
+		if !cfg.Channels.Discord.Enabled || cfg.Channels.Discord.Token == "" {
+			return nil, fmt.Errorf("channel %q is not enabled", name)
+		}
+		return NewDiscordChannel(&cfg.Channels.Discord, nil), nil
+	case "feishu":
+		if !cfg.Channels.Feishu.Enabled || cfg.Channels.Feishu.AppID == "" {
+			return nil, fmt.Errorf("channel %q is not enabled", name)
+		}
+		return NewFeishuChannel(&cfg.Channels.Feishu, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown channel %q", name)
+	}
+}
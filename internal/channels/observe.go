@@ -0,0 +1,51 @@
+package channels
+
+// observe.go - 旁听模式（channels.<name>.mode: observe）
+// 机器人加入繁忙的团队群聊时，群里的消息只记入会话历史（之后可以问"Alice 昨天说了什么？"），
+// 不会触发回复；私聊、@机器人、回复机器人的消息以及命令照常处理。
+// 目前支持 Telegram 和飞书；Discord 只接收斜杠命令，本身就只在被调用时回复。
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+)
+
+// ModeObserve 旁听模式
+const ModeObserve = "observe"
+
+// observeMode 判断频道配置的 mode 是否为旁听模式，无法识别的值按默认（回复所有消息）处理并记录警告
+func observeMode(channel, mode string) bool {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "reply":
+		return false
+	case ModeObserve:
+		return true
+	default:
+		log.Printf("Warning: channels.%s.mode %q is not supported (expected reply or observe), replying to all messages", channel, mode)
+		return false
+	}
+}
+
+// markObserved 把消息标记为只记录、不回复
+// 参数:
+//
+//	metadata: 入站消息的元数据
+//	senderName: 发送者的显示名称，为空时 Agent 使用发送者 ID
+func markObserved(metadata map[string]interface{}, senderName string) {
+	metadata[bus.ObserveKey] = true
+	if senderName != "" {
+		metadata[bus.SenderNameKey] = senderName
+	}
+}
+
+// stripMention 去掉消息中 @机器人 的部分（不区分大小写），例如 "/status@my_bot" -> "/status"
+func stripMention(content, mention string) string {
+	if mention == "" {
+		return content
+	}
+	pattern := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(mention))
+	return strings.TrimSpace(pattern.ReplaceAllString(content, ""))
+}
@@ -0,0 +1,93 @@
+// quiet.go 实现免打扰时段
+// 时段内发往该频道的后台消息（定时任务、子代理结果）由 Dispatcher 暂存，
+// 时段结束后每个聊天合并为一条汇总消息发送；对用户消息的直接回复照常立即发送。
+package channels
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/i18n"
+)
+
+// backgroundMarkers 标记后台消息的元数据键（值为 true）
+var backgroundMarkers = []string{"from_cron", "from_subagent"}
+
+// QuietHours 每天的免打扰时段（本地时间）
+type QuietHours struct {
+	Start int // 开始时间，距午夜的分钟数
+	End   int // 结束时间，距午夜的分钟数；小于 Start 表示跨过午夜
+}
+
+// ParseQuietHours 解析 HH:MM 格式的开始和结束时间
+func ParseQuietHours(start, end string) (QuietHours, error) {
+	from, err := parseClock(start)
+	if err != nil {
+		return QuietHours{}, err
+	}
+	to, err := parseClock(end)
+	if err != nil {
+		return QuietHours{}, err
+	}
+	if from == to {
+		return QuietHours{}, fmt.Errorf("quiet hours start and end are both %s", start)
+	}
+	return QuietHours{Start: from, End: to}, nil
+}
+
+// parseClock 把 HH:MM 转换为距午夜的分钟数
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (expected HH:MM)", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Active 判断时间 t 是否处于免打扰时段
+func (q QuietHours) Active(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if q.Start < q.End {
+		return minute >= q.Start && minute < q.End
+	}
+	return minute >= q.Start || minute < q.End
+}
+
+// String 返回 HH:MM-HH:MM 格式的时段
+func (q QuietHours) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", q.Start/60, q.Start%60, q.End/60, q.End%60)
+}
+
+// IsBackground 判断出站消息是否是可以推迟的后台消息
+// 元数据中 "urgent" 为 true 的消息总是立即发送
+func IsBackground(msg bus.OutboundMessage) bool {
+	if urgent, _ := msg.Metadata["urgent"].(bool); urgent {
+		return false
+	}
+	for _, key := range backgroundMarkers {
+		if marked, _ := msg.Metadata[key].(bool); marked {
+			return true
+		}
+	}
+	return false
+}
+
+// quietDigest 把免打扰时段内暂存的消息合并为一条
+func quietDigest(held []bus.OutboundMessage) bus.OutboundMessage {
+	digest := bus.OutboundMessage{
+		Channel:  held[0].Channel,
+		ChatID:   held[0].ChatID,
+		Metadata: map[string]interface{}{"quiet_digest": true},
+	}
+	parts := make([]string, 0, len(held))
+	for _, msg := range held {
+		if content := strings.TrimSpace(msg.Content); content != "" {
+			parts = append(parts, content)
+		}
+		digest.Media = append(digest.Media, msg.Media...)
+	}
+	digest.Content = i18n.T(i18n.Default(), "quiet_digest", len(held)) + "\n\n" + strings.Join(parts, "\n\n---\n\n")
+	return digest
+}
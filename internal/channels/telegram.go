@@ -7,7 +7,6 @@ package channels
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -24,15 +23,20 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/Ailoc/nanogrip/internal/bus"
 	"github.com/Ailoc/nanogrip/internal/config"
+	"github.com/Ailoc/nanogrip/internal/media"
+	"github.com/Ailoc/nanogrip/internal/paths"
+	"github.com/Ailoc/nanogrip/internal/providers"
 )
 
 const (
 	telegramAPIBaseURL       = "https://api.telegram.org"
 	telegramFileBaseURL      = "https://api.telegram.org/file"
 	telegramMessageMaxLength = 4000
+	telegramCaptionMaxLength = 1024
 )
 
 // TelegramChannel Telegram机器人频道实现
@@ -43,25 +47,58 @@ const (
 // 4. 支持Markdown到HTML的自动转换
 // 5. 自动分割超长消息（最大4000字符）
 // 6. 支持交互式输入处理（当 Shell 命令需要用户输入时）
+// 7. 支持内联键盘按钮，按钮点击（callback_query）作为入站消息回传
+// 8. 支持语音消息转写（需要配置 providers.transcription）
 type TelegramChannel struct {
-	*BaseChannel                                          // 嵌入基础频道，继承通用功能
-	config       *config.TelegramConfig                   // Telegram配置
-	token        string                                   // Bot Token，用于API认证
-	allowFrom    map[string]bool                          // 用户白名单，key为用户ID，value始终为true
-	httpClient   *http.Client                             // HTTP客户端，用于调用Telegram API
-	apiBaseURL   string                                   // Telegram Bot API 基础地址，测试时可替换
-	fileBaseURL  string                                   // Telegram 文件下载基础地址，测试时可替换
-	chatIDs      map[string]int64                         // 用户ID到聊天ID的映射，用于回复消息
-	mu           sync.RWMutex                             // 读写锁，保护chatIDs和updateID的并发访问
-	updateID     int64                                    // 当前已处理的最大update_id，用于增量获取消息
-	updateIDMu   sync.Mutex                               // 保护updateID的互斥锁
-	inputHandler func(channel, chatID, input string) bool // 输入处理回调，用于交互式输入
+	*BaseChannel                        // 嵌入基础频道，继承通用功能
+	config       *config.TelegramConfig // Telegram配置
+	token        string                 // Bot Token，用于API认证
+	allowFrom    map[string]bool        // 用户白名单，key为用户ID，value始终为true
+	httpClient   *http.Client           // HTTP客户端，用于调用Telegram API
+	apiBaseURL   string                 // Telegram Bot API 基础地址，测试时可替换
+	fileBaseURL  string                 // Telegram 文件下载基础地址，测试时可替换
+	chatIDs      map[string]int64       // 用户ID到聊天ID的映射，用于回复消息
+	mu           sync.RWMutex           // 读写锁，保护chatIDs、allowFrom和updateID的并发访问
+	updateID     int64                  // 当前已处理的最大update_id，用于增量获取消息
+	updateIDMu   sync.Mutex             // 保护updateID的互斥锁
+	offsetPath   string                 // 保存updateID的文件路径，重启后不会重新处理旧消息（为空表示不保存）
+	mediaStore   *media.Manager         // 保存用户发送的图片和文档（为空表示不接收附件）
+	transcriber  providers.Transcriber  // 语音转写服务，nil 表示未配置
+
+	observe     bool   // 旁听模式：群聊中没有对机器人说的消息只记录、不回复（见 observe.go）
+	botUsername string // 机器人的用户名（不含 @），旁听模式下用于识别 @机器人，启动时获取
+
+	live   map[string]*liveMessage // 各回合正在编辑的消息，键为 "聊天ID:用户消息ID"（见 telegram_edit.go）
+	liveMu sync.Mutex              // 保护 live
 }
 
-// SetInputHandler 设置输入处理回调
-// 这个回调用于处理交互式输入，当 Shell 命令等待用户输入时，用户的消息会通过这个回调处理
-func (c *TelegramChannel) SetInputHandler(handler func(channel, chatID, input string) bool) {
-	c.inputHandler = handler
+// SetAllowFrom 更新用户白名单（配置热重载时调用）
+func (c *TelegramChannel) SetAllowFrom(ids []string) {
+	allowFrom := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		allowFrom[id] = true
+	}
+	c.mu.Lock()
+	c.allowFrom = allowFrom
+	c.mu.Unlock()
+}
+
+// Capabilities 返回 Telegram 频道的能力声明
+// 目前媒体只通过 sendPhoto 发送，其他类型的文件由出站分发器降级为链接
+func (c *TelegramChannel) Capabilities() Capabilities {
+	return Capabilities{
+		MaxMessageLength: telegramMessageMaxLength,
+		MaxCaptionLength: telegramCaptionMaxLength,
+		MediaTypes:       []string{MediaPhoto},
+		Markdown:         MarkdownHTML,
+		Buttons:          true,
+	}
+}
+
+// SetTranscriber 设置语音转写服务
+// 设置后，语音消息和音频文件会被转写为文字作为消息内容
+func (c *TelegramChannel) SetTranscriber(transcriber providers.Transcriber) {
+	c.transcriber = transcriber
 }
 
 // NewTelegramChannel 创建一个新的Telegram频道实例
@@ -91,6 +128,73 @@ func NewTelegramChannel(cfg *config.TelegramConfig, bus *bus.MessageBus) *Telegr
 		apiBaseURL:  telegramAPIBaseURL,
 		fileBaseURL: telegramFileBaseURL,
 		chatIDs:     make(map[string]int64),
+		observe:     observeMode("telegram", cfg.Mode),
+	}
+}
+
+// telegramOffset 是持久化的轮询进度
+type telegramOffset struct {
+	BotID  string `json:"bot_id"` // Token 中冒号前的机器人 ID，更换机器人后旧进度失效
+	Offset int64  `json:"offset"` // 下一次 getUpdates 使用的 offset
+}
+
+// SetOffsetPath 设置保存轮询进度（updateID）的文件路径
+// 必须在 Start 之前调用；Start 时读取保存的进度，重启后不会重新处理已经处理过的消息
+func (c *TelegramChannel) SetOffsetPath(path string) {
+	c.offsetPath = path
+}
+
+// SetMediaManager 设置保存用户发送的图片和文档的媒体管理器
+// 附件保存为本地文件，Agent 收到的是文件路径，可以用 document 工具提取文档文本
+func (c *TelegramChannel) SetMediaManager(store *media.Manager) {
+	c.mediaStore = store
+}
+
+// botID 返回 Token 中的机器人 ID
+func (c *TelegramChannel) botID() string {
+	if idx := strings.Index(c.token, ":"); idx != -1 {
+		return c.token[:idx]
+	}
+	return ""
+}
+
+// loadOffset 读取保存的轮询进度
+func (c *TelegramChannel) loadOffset() {
+	if c.offsetPath == "" {
+		return
+	}
+	data, err := os.ReadFile(c.offsetPath)
+	if err != nil {
+		return
+	}
+	var saved telegramOffset
+	if err := json.Unmarshal(data, &saved); err != nil || saved.BotID != c.botID() {
+		return
+	}
+
+	c.updateIDMu.Lock()
+	if saved.Offset > c.updateID {
+		c.updateID = saved.Offset
+	}
+	c.updateIDMu.Unlock()
+	log.Printf("Telegram polling resumes from update %d", saved.Offset)
+}
+
+// saveOffset 保存轮询进度
+func (c *TelegramChannel) saveOffset(offset int64) {
+	if c.offsetPath == "" {
+		return
+	}
+	data, err := json.Marshal(telegramOffset{BotID: c.botID(), Offset: offset})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.offsetPath), 0755); err != nil {
+		log.Printf("Failed to save Telegram offset: %v", err)
+		return
+	}
+	if err := os.WriteFile(c.offsetPath, data, 0644); err != nil {
+		log.Printf("Failed to save Telegram offset: %v", err)
 	}
 }
 
@@ -117,6 +221,19 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		log.Println("Telegram webhook disabled for long polling")
 	}
 
+	// 旁听模式需要知道机器人的用户名才能识别 @机器人
+	if c.observe {
+		if name, err := c.Check(); err != nil {
+			log.Printf("Warning: Telegram getMe failed, @mentions cannot be detected in observe mode: %v", err)
+		} else {
+			c.mu.Lock()
+			c.botUsername = strings.TrimPrefix(name, "@")
+			c.mu.Unlock()
+			log.Printf("Telegram observe mode: group messages are recorded, replying only to %s, replies and commands", name)
+		}
+	}
+
+	c.loadOffset()
 	c.running = true
 
 	// 启动消息轮询goroutine
@@ -277,6 +394,18 @@ func decodeTelegramEnvelope(method string, statusCode int, body []byte, result i
 	return nil
 }
 
+// Check 调用 getMe 校验机器人令牌（实现 Checker）
+func (c *TelegramChannel) Check() (string, error) {
+	var me struct {
+		Username string `json:"username"`
+	}
+	if err := c.doTelegramGET("getMe", nil, &me); err != nil {
+		// 请求地址中包含令牌，不能原样输出
+		return "", fmt.Errorf("%s", strings.ReplaceAll(err.Error(), c.token, "<token>"))
+	}
+	return "@" + me.Username, nil
+}
+
 func (c *TelegramChannel) deleteWebhook() error {
 	return c.doTelegramJSON("deleteWebhook", map[string]interface{}{
 		"drop_pending_updates": false,
@@ -302,12 +431,24 @@ func (c *TelegramChannel) Send(msg bus.OutboundMessage) error {
 		return fmt.Errorf("invalid chat_id: %w", err)
 	}
 	replyToMessageID := c.replyToMessageID(msg.Metadata)
+	replyMarkup := telegramInlineKeyboard(msg.Metadata["buttons"])
+
+	// 同一回合的确认、进度提示和回复合并为一条消息（见 telegram_edit.go）
+	if c.config != nil && c.config.EditReplies {
+		if handled, err := c.sendLive(chatID, msg, replyToMessageID, replyMarkup); handled {
+			return err
+		}
+	}
 
 	// 检查是否有媒体文件需要发送
 	if len(msg.Media) > 0 {
-		// 发送媒体文件（图片、视频、文档等）
-		for _, mediaURL := range msg.Media {
-			if err := c.sendMedia(chatID, mediaURL, msg.Content); err != nil {
+		// 发送媒体文件（图片、视频、文档等），按钮附加在最后一个媒体上
+		for i, mediaURL := range msg.Media {
+			var markup map[string]interface{}
+			if i == len(msg.Media)-1 {
+				markup = replyMarkup
+			}
+			if err := c.sendMedia(chatID, mediaURL, msg.Content, markup); err != nil {
 				return err
 			}
 		}
@@ -329,19 +470,13 @@ func (c *TelegramChannel) Send(msg bus.OutboundMessage) error {
 			partReplyToMessageID = replyToMessageID
 		}
 
-		if err := c.sendMessage(chatID, part, "HTML", partReplyToMessageID); err != nil {
-			if isTelegramHTMLParseError(err) {
-				plainText := telegramHTMLToPlainText(part)
-				if plainText == "" {
-					plainText = msg.Content
-				}
-				if fallbackErr := c.sendMessage(chatID, plainText, "", partReplyToMessageID); fallbackErr == nil {
-					log.Printf("Telegram HTML parse failed, sent plain text fallback: %v", err)
-					continue
-				} else {
-					return fmt.Errorf("%w; plain text fallback also failed: %v", err, fallbackErr)
-				}
-			}
+		// 内联键盘只附加在最后一段消息上
+		var partReplyMarkup map[string]interface{}
+		if i == len(parts)-1 {
+			partReplyMarkup = replyMarkup
+		}
+
+		if _, err := c.sendText(chatID, part, msg.Content, partReplyToMessageID, partReplyMarkup); err != nil {
 			return err
 		}
 	}
@@ -349,6 +484,70 @@ func (c *TelegramChannel) Send(msg bus.OutboundMessage) error {
 	return nil
 }
 
+// sendText 以 HTML 格式发送一段消息，HTML 解析失败时改为发送纯文本
+// 参数:
+//
+//	chatID: 目标聊天的ID
+//	text: HTML 格式的消息文本
+//	original: 原始消息内容（HTML 转纯文本为空时使用）
+//	replyToMessageID: 回复的消息 ID（0 表示不回复）
+//	replyMarkup: 可选的内联键盘
+//
+// 返回: 发送的消息 ID
+func (c *TelegramChannel) sendText(chatID int64, text, original string, replyToMessageID int64, replyMarkup map[string]interface{}) (int64, error) {
+	messageID, err := c.sendMessage(chatID, text, "HTML", replyToMessageID, replyMarkup)
+	if err == nil || !isTelegramHTMLParseError(err) {
+		return messageID, err
+	}
+
+	plainText := telegramHTMLToPlainText(text)
+	if plainText == "" {
+		plainText = original
+	}
+	messageID, fallbackErr := c.sendMessage(chatID, plainText, "", replyToMessageID, replyMarkup)
+	if fallbackErr != nil {
+		return 0, fmt.Errorf("%w; plain text fallback also failed: %v", err, fallbackErr)
+	}
+	log.Printf("Telegram HTML parse failed, sent plain text fallback: %v", err)
+	return messageID, nil
+}
+
+// SendTyping 显示"正在输入…"状态（实现 TypingIndicator）
+// Telegram 的输入状态持续约 5 秒，或在机器人发出下一条消息时消失
+func (c *TelegramChannel) SendTyping(chatID string) error {
+	id, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid chat_id: %w", err)
+	}
+	return c.doTelegramJSON("sendChatAction", map[string]interface{}{
+		"chat_id": id,
+		"action":  "typing",
+	}, nil)
+}
+
+// React 用表情回应一条消息（实现 Reactor）
+// 机器人对每条消息只能保留一个回应，新的回应会替换旧的；emoji 只能是 Telegram 允许的表情
+func (c *TelegramChannel) React(chatID, messageID, emoji string) error {
+	chat, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid chat_id: %w", err)
+	}
+	message, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid message_id: %w", err)
+	}
+
+	reaction := []map[string]interface{}{}
+	if emoji != "" {
+		reaction = append(reaction, map[string]interface{}{"type": "emoji", "emoji": emoji})
+	}
+	return c.doTelegramJSON("setMessageReaction", map[string]interface{}{
+		"chat_id":    chat,
+		"message_id": message,
+		"reaction":   reaction,
+	}, nil)
+}
+
 func (c *TelegramChannel) replyToMessageID(metadata map[string]interface{}) int64 {
 	if c.config == nil || !c.config.ReplyToMessage || metadata == nil {
 		return 0
@@ -381,15 +580,84 @@ func metadataInt64(value interface{}) int64 {
 	}
 }
 
+// telegramInlineKeyboard 将出站消息元数据中的 buttons 转换为 Telegram 的 inline_keyboard
+// 支持两种格式：
+//   - 二维数组：每个内层数组为一行按钮
+//   - 一维数组：所有按钮放在同一行
+//
+// 每个按钮为 {"text": "显示文字", "data": "回调数据"}，也可以用 "url" 代替 "data" 生成链接按钮。
+// 未提供 data 和 url 时，使用 text 作为回调数据。
+// 返回: reply_markup 对象；没有有效按钮时返回 nil
+func telegramInlineKeyboard(value interface{}) map[string]interface{} {
+	rows, ok := value.([]interface{})
+	if !ok || len(rows) == 0 {
+		return nil
+	}
+
+	// 一维数组视为单行按钮
+	if _, isButton := rows[0].(map[string]interface{}); isButton {
+		rows = []interface{}{rows}
+	}
+
+	keyboard := make([][]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		items, ok := row.([]interface{})
+		if !ok {
+			continue
+		}
+
+		buttons := make([]map[string]interface{}, 0, len(items))
+		for _, item := range items {
+			button, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			text, _ := button["text"].(string)
+			if text == "" {
+				continue
+			}
+
+			tgButton := map[string]interface{}{"text": text}
+			if link, _ := button["url"].(string); link != "" {
+				tgButton["url"] = link
+			} else {
+				data, _ := button["data"].(string)
+				if data == "" {
+					data = text
+				}
+				// Telegram 限制 callback_data 最多 64 字节，在字符边界截断（截出不完整的 UTF-8 字符会被拒绝）
+				if len(data) > 64 {
+					cut := 64
+					for cut > 0 && !utf8.RuneStart(data[cut]) {
+						cut--
+					}
+					data = data[:cut]
+				}
+				tgButton["callback_data"] = data
+			}
+			buttons = append(buttons, tgButton)
+		}
+		if len(buttons) > 0 {
+			keyboard = append(keyboard, buttons)
+		}
+	}
+
+	if len(keyboard) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"inline_keyboard": keyboard}
+}
+
 // sendMessage 发送单条消息到Telegram
 // 调用Telegram Bot API的sendMessage方法
 // 参数:
 //
 //	chatID: 目标聊天的ID
 //	text: 消息文本，支持HTML格式
+//	replyMarkup: 可选的内联键盘（nil 表示不附加按钮）
 //
-// 返回: API调用失败时返回错误
-func (c *TelegramChannel) sendMessage(chatID int64, text string, parseMode string, replyToMessageID int64) error {
+// 返回: 发送的消息 ID，API调用失败时返回错误
+func (c *TelegramChannel) sendMessage(chatID int64, text string, parseMode string, replyToMessageID int64, replyMarkup map[string]interface{}) (int64, error) {
 	// 构造请求数据
 	data := map[string]interface{}{
 		"chat_id": chatID,
@@ -402,8 +670,15 @@ func (c *TelegramChannel) sendMessage(chatID int64, text string, parseMode strin
 		data["reply_to_message_id"] = replyToMessageID
 		data["allow_sending_without_reply"] = true
 	}
+	if replyMarkup != nil {
+		data["reply_markup"] = replyMarkup
+	}
 
-	return c.doTelegramJSON("sendMessage", data, nil)
+	var result TelegramMessage
+	if err := c.doTelegramJSON("sendMessage", data, &result); err != nil {
+		return 0, err
+	}
+	return result.MessageID, nil
 }
 
 // sendMedia 发送媒体文件到Telegram
@@ -413,28 +688,32 @@ func (c *TelegramChannel) sendMessage(chatID int64, text string, parseMode strin
 //	chatID: 目标聊天的ID
 //	mediaURL: 媒体文件的URL或本地文件路径
 //	caption: 媒体的说明文字
+//	replyMarkup: 可选的内联键盘
 //
 // 返回: API调用失败时返回错误
-func (c *TelegramChannel) sendMedia(chatID int64, mediaURL string, caption string) error {
+func (c *TelegramChannel) sendMedia(chatID int64, mediaURL string, caption string, replyMarkup map[string]interface{}) error {
 	// 判断是 HTTP URL 还是本地文件
 	isHTTPURL := strings.HasPrefix(mediaURL, "http://") || strings.HasPrefix(mediaURL, "https://")
 
 	if isHTTPURL {
 		// HTTP URL - 使用 JSON 方式发送
-		return c.sendPhotoByURL(chatID, mediaURL, caption)
+		return c.sendPhotoByURL(chatID, mediaURL, caption, replyMarkup)
 	}
 
 	// 本地文件 - 使用 multipart/form-data 上传
-	return c.sendPhotoByFile(chatID, mediaURL, caption)
+	return c.sendPhotoByFile(chatID, mediaURL, caption, replyMarkup)
 }
 
 // sendPhotoByURL 通过 HTTP URL 发送图片
-func (c *TelegramChannel) sendPhotoByURL(chatID int64, photoURL string, caption string) error {
+func (c *TelegramChannel) sendPhotoByURL(chatID int64, photoURL string, caption string, replyMarkup map[string]interface{}) error {
 	// 构造请求数据
 	data := map[string]interface{}{
 		"chat_id": chatID,
 		"photo":   photoURL,
 	}
+	if replyMarkup != nil {
+		data["reply_markup"] = replyMarkup
+	}
 
 	// 添加说明文字（如果有）
 	if caption != "" {
@@ -460,20 +739,11 @@ func (c *TelegramChannel) sendPhotoByURL(chatID int64, photoURL string, caption
 }
 
 // sendPhotoByFile 通过本地文件发送图片
-func (c *TelegramChannel) sendPhotoByFile(chatID int64, filePath string, caption string) error {
+func (c *TelegramChannel) sendPhotoByFile(chatID int64, filePath string, caption string, replyMarkup map[string]interface{}) error {
 	apiURL := c.apiURL("sendPhoto")
 
 	// 展开 $HOME 和 ~ 路径
-	expandedPath := os.ExpandEnv(filePath)
-	// 处理 ~ 开头的路径
-	if strings.HasPrefix(filePath, "~/") {
-		homeDir, _ := os.UserHomeDir()
-		expandedPath = filepath.Join(homeDir, filePath[2:])
-	} else if filePath == "~" {
-		homeDir, _ := os.UserHomeDir()
-		expandedPath = homeDir
-	}
-	filePath = expandedPath
+	filePath = paths.ExpandHome(os.ExpandEnv(filePath))
 
 	// 打开本地文件
 	file, err := os.Open(filePath)
@@ -495,6 +765,15 @@ func (c *TelegramChannel) sendPhotoByFile(chatID int64, filePath string, caption
 		writer.WriteField("parse_mode", "HTML")
 	}
 
+	// 添加内联键盘（multipart 中需要以 JSON 字符串传递）
+	if replyMarkup != nil {
+		markupJSON, err := json.Marshal(replyMarkup)
+		if err != nil {
+			return fmt.Errorf("failed to marshal reply_markup: %w", err)
+		}
+		writer.WriteField("reply_markup", string(markupJSON))
+	}
+
 	// 添加图片文件
 	part, err := writer.CreateFormFile("photo", file.Name())
 	if err != nil {
@@ -590,6 +869,9 @@ func (c *TelegramChannel) pollUpdates(ctx context.Context) {
 			delay = baseDelay
 
 			// 处理每条更新
+			c.updateIDMu.Lock()
+			previous := c.updateID
+			c.updateIDMu.Unlock()
 			for _, update := range updates {
 				c.updateIDMu.Lock()
 				shouldProcess := update.UpdateID >= c.updateID
@@ -601,11 +883,19 @@ func (c *TelegramChannel) pollUpdates(ctx context.Context) {
 				c.updateIDMu.Unlock()
 
 				if shouldProcess {
-					// 使用新的goroutine处理消息，避免阻塞轮询
-					go c.handleUpdate(update)
+					// 使用新的goroutine处理消息，避免下载附件和转写语音阻塞轮询
+					go c.handleUpdate(ctx, update)
 				}
 			}
 
+			// 保存轮询进度，重启后从这里继续
+			c.updateIDMu.Lock()
+			current := c.updateID
+			c.updateIDMu.Unlock()
+			if current != previous {
+				c.saveOffset(current)
+			}
+
 			// 短暂休眠，避免过于频繁的请求
 			if !sleepWithContext(ctx, 1*time.Second) {
 				return
@@ -637,6 +927,7 @@ func (c *TelegramChannel) getUpdates() ([]TelegramUpdate, error) {
 
 	query := url.Values{}
 	query.Set("timeout", "60")
+	query.Set("allowed_updates", `["message","callback_query"]`)
 	if offset > 0 {
 		query.Set("offset", strconv.FormatInt(offset, 10))
 	}
@@ -650,17 +941,25 @@ func (c *TelegramChannel) getUpdates() ([]TelegramUpdate, error) {
 
 // handleUpdate 处理接收到的Telegram更新
 // 处理流程：
-// 1. 检查更新是否包含消息
+// 1. 检查更新是否包含消息（按钮回调交给 handleCallbackQuery）
 // 2. 提取消息文本、图片或文档
 // 3. 构建发送者ID（用户ID或用户ID|用户名）
 // 4. 检查用户是否在白名单中
 // 5. 保存chat_id用于后续回复
-// 6. 如果有图片，下载并转换为base64
-// 7. 将消息发布到消息总线
+// 6. 如果有图片或文档，下载到媒体目录
+// 7. 如果有语音或音频，下载并转写为文字
+// 8. 将消息发布到消息总线
 // 参数:
 //
+//	ctx: 频道的上下文，频道停止时取消（中断进行中的语音转写）
 //	update: Telegram更新对象，包含消息等信息
-func (c *TelegramChannel) handleUpdate(update TelegramUpdate) {
+func (c *TelegramChannel) handleUpdate(ctx context.Context, update TelegramUpdate) {
+	// 内联键盘按钮点击
+	if update.CallbackQuery != nil {
+		c.handleCallbackQuery(update)
+		return
+	}
+
 	if update.Message == nil {
 		return
 	}
@@ -678,47 +977,20 @@ func (c *TelegramChannel) handleUpdate(update TelegramUpdate) {
 	hasPhoto := len(msg.Photo) > 0
 	hasDocument := msg.Document != nil
 	hasCaption := msg.Caption != ""
+	hasAudio := msg.Voice != nil || msg.Audio != nil
 
-	// 有内容（文本、图片、文档或图片说明）才继续处理
-	if !hasText && !hasPhoto && !hasDocument && !hasCaption {
+	// 有内容（文本、图片、文档、图片说明或语音）才继续处理
+	if !hasText && !hasPhoto && !hasDocument && !hasCaption && !hasAudio {
 		return
 	}
 
-	// 构建发送者ID。普通私聊/群聊消息优先使用用户ID，频道消息或匿名管理员消息
-	// 可能没有 From 字段，此时退回到 chat ID，避免整个服务被特殊更新打崩。
 	chatIDStr := strconv.FormatInt(msg.Chat.ID, 10)
-	senderID := "chat:" + chatIDStr
-	allowKeys := []string{senderID, chatIDStr}
-	if msg.From != nil {
-		userID := strconv.FormatInt(msg.From.ID, 10)
-		senderID = userID
-		allowKeys = append(allowKeys, userID)
-		if msg.From.Username != "" {
-			senderID = fmt.Sprintf("%s|%s", userID, msg.From.Username)
-			allowKeys = append(allowKeys, senderID, msg.From.Username, "@"+msg.From.Username)
-		}
-	}
-
-	// 白名单检查：如果配置了白名单，则只处理白名单中的用户消息
-	if len(c.allowFrom) > 0 {
-		allowed := false
-		for _, key := range allowKeys {
-			if c.allowFrom[key] {
-				allowed = true
-				break
-			}
-		}
-		if !allowed {
-			log.Printf("Ignoring message from unauthorized user: %s", senderID)
-			return
-		}
+	senderID, allowed := c.authorizeSender(msg.Chat, msg.From)
+	if !allowed {
+		log.Printf("Ignoring message from unauthorized user: %s", senderID)
+		return
 	}
 
-	// 保存chat_id，用于后续回复消息
-	c.mu.Lock()
-	c.chatIDs[senderID] = msg.Chat.ID
-	c.mu.Unlock()
-
 	// 提取消息内容（优先使用text，如果没有则使用caption）
 	content := msg.Text
 	if content == "" {
@@ -728,38 +1000,78 @@ func (c *TelegramChannel) handleUpdate(update TelegramUpdate) {
 	// 检查是否有输入处理回调，并且消息是纯文本（不是图片或文档）
 	// 如果有交互式输入等待，将消息路由到输入处理器
 	// 只有纯文本消息（没有媒体）才路由到输入处理器
-	if c.inputHandler != nil && hasText && !hasPhoto && !hasDocument && !hasCaption {
+	if hasText && !hasPhoto && !hasDocument && !hasCaption {
 		// 调用输入处理回调
-		if c.inputHandler("telegram", chatIDStr, content) {
+		if c.handleInput(chatIDStr, senderID, content) {
 			// 输入已被处理，不发送到消息总线
-			log.Printf("Input routed to interaction handler for chat %s", chatIDStr)
 			return
 		}
 	}
 
-	// 处理图片和文档，下载为base64
+	// 旁听模式：群聊中没有对机器人说的消息只记入历史（不下载附件、不转写语音）
+	if c.observe && telegramGroupChat(msg.Chat) {
+		mention := c.mention()
+		if !c.addressed(msg, content, mention) {
+			c.publishObserved(update, msg, senderID, content)
+			return
+		}
+		content = stripMention(content, mention)
+	}
+
+	// 处理图片和文档，下载到媒体目录，Agent 收到的是文件路径
 	mediaList := []string{}
 
 	// 处理图片
 	if len(msg.Photo) > 0 {
 		// 获取最高分辨率的图片（最后一张）
 		photo := msg.Photo[len(msg.Photo)-1]
-		base64Data, err := c.downloadFileAsBase64(photo.FileID)
+		path, err := c.saveMedia(photo.FileID, "", "")
 		if err != nil {
 			log.Printf("Failed to download photo: %v", err)
 		} else {
-			// 添加图片的base64数据，格式为 data:image/jpeg;base64,xxx
-			mediaList = append(mediaList, base64Data)
+			mediaList = append(mediaList, path)
 		}
 	}
 
 	// 处理文档
 	if msg.Document != nil {
-		base64Data, err := c.downloadFileAsBase64(msg.Document.FileID)
+		path, err := c.saveMedia(msg.Document.FileID, msg.Document.FileName, msg.Document.MimeType)
 		if err != nil {
-			log.Printf("Failed to download document: %v", err)
+			log.Printf("Failed to save document: %v", err)
 		} else {
-			mediaList = append(mediaList, base64Data)
+			mediaList = append(mediaList, path)
+		}
+	}
+
+	metadata := telegramMessageMetadata(msg)
+
+	// 处理语音消息和音频文件：下载并转写为文字
+	if hasAudio {
+		fileID := ""
+		if msg.Voice != nil {
+			fileID = msg.Voice.FileID
+		} else {
+			fileID = msg.Audio.FileID
+		}
+
+		transcript, err := c.transcribeAudio(ctx, fileID)
+		if ctx.Err() != nil {
+			// 频道已停止，不再发布这条消息
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to transcribe audio: %v", err)
+			// 仍然通知 Agent 收到了语音，由它决定如何回复
+			transcript = fmt.Sprintf("[Voice message could not be transcribed: %v]", err)
+		} else {
+			metadata["voice_transcribed"] = true
+			transcript = "[Voice message] " + transcript
+		}
+
+		if content == "" {
+			content = transcript
+		} else {
+			content = content + "\n\n" + transcript
 		}
 	}
 
@@ -772,7 +1084,7 @@ func (c *TelegramChannel) handleUpdate(update TelegramUpdate) {
 			ChatID:   strconv.FormatInt(msg.Chat.ID, 10),
 			Content:  content,
 			Media:    mediaList,
-			Metadata: telegramMessageMetadata(msg),
+			Metadata: metadata,
 		},
 	}
 
@@ -781,6 +1093,184 @@ func (c *TelegramChannel) handleUpdate(update TelegramUpdate) {
 	}
 }
 
+// telegramGroupChat 判断是否是群聊
+func telegramGroupChat(chat *TelegramChat) bool {
+	return chat.Type == "group" || chat.Type == "supergroup"
+}
+
+// mention 返回 @机器人 的写法，用户名未知时返回空字符串
+func (c *TelegramChannel) mention() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.botUsername == "" {
+		return ""
+	}
+	return "@" + c.botUsername
+}
+
+// addressed 判断群聊消息是否是对机器人说的：命令、@机器人，或者回复机器人的消息
+func (c *TelegramChannel) addressed(msg *TelegramMessage, content, mention string) bool {
+	if strings.HasPrefix(content, "/") {
+		return true
+	}
+	if reply := msg.ReplyToMessage; reply != nil && reply.From != nil && strconv.FormatInt(reply.From.ID, 10) == c.botID() {
+		return true
+	}
+	return mention != "" && strings.Contains(strings.ToLower(content), strings.ToLower(mention))
+}
+
+// publishObserved 发布一条只记录、不回复的群聊消息，附件用文字说明代替
+func (c *TelegramChannel) publishObserved(update TelegramUpdate, msg *TelegramMessage, senderID, content string) {
+	var notes []string
+	if len(msg.Photo) > 0 {
+		notes = append(notes, "[photo]")
+	}
+	if msg.Document != nil {
+		notes = append(notes, fmt.Sprintf("[file: %s]", msg.Document.FileName))
+	}
+	if msg.Voice != nil {
+		notes = append(notes, "[voice message]")
+	} else if msg.Audio != nil {
+		notes = append(notes, "[audio]")
+	}
+	if len(notes) > 0 {
+		content = strings.TrimSpace(content + " " + strings.Join(notes, " "))
+	}
+
+	metadata := telegramMessageMetadata(msg)
+	name := ""
+	if msg.From != nil {
+		name = msg.From.FirstName
+		if name == "" {
+			name = msg.From.Username
+		}
+	}
+	markObserved(metadata, name)
+
+	inbound := bus.InboundMessage{
+		Message: bus.Message{
+			ID:       strconv.FormatInt(update.UpdateID, 10),
+			Channel:  "telegram",
+			SenderID: senderID,
+			ChatID:   strconv.FormatInt(msg.Chat.ID, 10),
+			Content:  content,
+			Metadata: metadata,
+		},
+	}
+	if err := c.bus.PublishInbound(inbound); err != nil {
+		log.Printf("Error publishing observed message: %v", err)
+	}
+}
+
+// authorizeSender 构建发送者ID并执行白名单检查
+// 普通私聊/群聊消息优先使用用户ID，频道消息或匿名管理员消息
+// 可能没有 From 字段，此时退回到 chat ID，避免整个服务被特殊更新打崩。
+// 通过检查后会保存chat_id，用于后续回复消息
+// 返回: 发送者ID，以及是否允许处理
+func (c *TelegramChannel) authorizeSender(chat *TelegramChat, from *TelegramUser) (string, bool) {
+	chatIDStr := strconv.FormatInt(chat.ID, 10)
+	senderID := "chat:" + chatIDStr
+	allowKeys := []string{senderID, chatIDStr}
+	if from != nil {
+		userID := strconv.FormatInt(from.ID, 10)
+		senderID = userID
+		allowKeys = append(allowKeys, userID)
+		if from.Username != "" {
+			senderID = fmt.Sprintf("%s|%s", userID, from.Username)
+			allowKeys = append(allowKeys, senderID, from.Username, "@"+from.Username)
+		}
+	}
+
+	// 白名单检查：如果配置了白名单，则只处理白名单中的用户消息
+	c.mu.RLock()
+	allowFrom := c.allowFrom
+	c.mu.RUnlock()
+	if len(allowFrom) > 0 {
+		allowed := false
+		for _, key := range allowKeys {
+			if allowFrom[key] {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return senderID, false
+		}
+	}
+
+	c.mu.Lock()
+	c.chatIDs[senderID] = chat.ID
+	c.mu.Unlock()
+
+	return senderID, true
+}
+
+// handleCallbackQuery 处理内联键盘按钮的点击
+// 处理流程：
+// 1. 调用 answerCallbackQuery 结束客户端的加载状态
+// 2. 执行与普通消息相同的白名单检查
+// 3. 将按钮的回调数据作为消息内容发布到消息总线，交给 AgentLoop 处理
+// 参数:
+//
+//	update: 包含 callback_query 的Telegram更新对象
+func (c *TelegramChannel) handleCallbackQuery(update TelegramUpdate) {
+	query := update.CallbackQuery
+
+	// 无论是否处理，都需要应答，否则客户端按钮会一直处于加载状态
+	if err := c.doTelegramJSON("answerCallbackQuery", map[string]interface{}{
+		"callback_query_id": query.ID,
+	}, nil); err != nil {
+		log.Printf("Failed to answer Telegram callback query %s: %v", query.ID, err)
+	}
+
+	// 来自内联消息（inline mode）的回调没有关联的聊天，无法回复
+	if query.Message == nil || query.Message.Chat == nil {
+		log.Printf("Ignoring Telegram callback query %s without chat information", query.ID)
+		return
+	}
+	if query.Data == "" {
+		return
+	}
+
+	senderID, allowed := c.authorizeSender(query.Message.Chat, query.From)
+	if !allowed {
+		log.Printf("Ignoring callback query from unauthorized user: %s", senderID)
+		return
+	}
+
+	chatIDStr := strconv.FormatInt(query.Message.Chat.ID, 10)
+
+	// 如果有交互式输入等待，按钮的选择同样可以作为输入
+	if c.handleInput(chatIDStr, senderID, query.Data) {
+		return
+	}
+
+	metadata := telegramMessageMetadata(query.Message)
+	// 按钮所在的消息由机器人发送，发送者信息应取点击者
+	if query.From != nil {
+		metadata["telegram_user_id"] = query.From.ID
+		metadata["telegram_username"] = query.From.Username
+		metadata["telegram_first_name"] = query.From.FirstName
+	}
+	metadata["telegram_callback_query_id"] = query.ID
+	metadata["callback_data"] = query.Data
+
+	inbound := bus.InboundMessage{
+		Message: bus.Message{
+			ID:       strconv.FormatInt(update.UpdateID, 10),
+			Channel:  "telegram",
+			SenderID: senderID,
+			ChatID:   chatIDStr,
+			Content:  query.Data,
+			Metadata: metadata,
+		},
+	}
+
+	if err := c.bus.PublishInbound(inbound); err != nil {
+		log.Printf("Error publishing callback query: %v", err)
+	}
+}
+
 func telegramMessageMetadata(msg *TelegramMessage) map[string]interface{} {
 	metadata := map[string]interface{}{
 		"telegram_message_id": msg.MessageID,
@@ -798,13 +1288,35 @@ func telegramMessageMetadata(msg *TelegramMessage) map[string]interface{} {
 	return metadata
 }
 
-// downloadFileAsBase64 下载Telegram文件并转换为base64
+// saveMedia 下载Telegram文件并交给媒体管理器保存
+// 参数:
+//
+//	fileID: Telegram文件的file_id
+//	name: 原始文件名（图片没有文件名，为空时使用 Telegram 服务器上的文件名）
+//	contentType: MIME类型（可以为空）
+//
+// 返回: 保存后的本地文件路径，错误信息
+func (c *TelegramChannel) saveMedia(fileID, name, contentType string) (string, error) {
+	if c.mediaStore == nil {
+		return "", fmt.Errorf("media storage is not configured")
+	}
+	data, filePath, err := c.downloadFile(fileID)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		name = filepath.Base(filePath)
+	}
+	return c.mediaStore.SaveBytes(data, name, contentType)
+}
+
+// downloadFile 下载Telegram文件的原始内容
 // 参数:
 //
 //	fileID: Telegram文件的file_id
 //
-// 返回: base64编码的文件数据（带MIME类型前缀），错误信息
-func (c *TelegramChannel) downloadFileAsBase64(fileID string) (string, error) {
+// 返回: 文件数据，Telegram服务器上的文件路径（含扩展名），错误信息
+func (c *TelegramChannel) downloadFile(fileID string) ([]byte, string, error) {
 	// 1. 获取文件信息
 	var fileInfo struct {
 		FileID   string `json:"file_id"`
@@ -814,49 +1326,62 @@ func (c *TelegramChannel) downloadFileAsBase64(fileID string) (string, error) {
 	query := url.Values{}
 	query.Set("file_id", fileID)
 	if err := c.doTelegramGET("getFile", query, &fileInfo); err != nil {
-		return "", fmt.Errorf("failed to get file info: %w", err)
+		return nil, "", fmt.Errorf("failed to get file info: %w", err)
 	}
 
 	// 2. 下载文件
 	resp, err := c.httpClient.Get(c.fileURL(fileInfo.FilePath))
 	if err != nil {
-		return "", fmt.Errorf("failed to download file: %w", err)
+		return nil, "", fmt.Errorf("failed to download file: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// 3. 读取文件内容
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file data: %w", err)
+		return nil, "", fmt.Errorf("failed to read file data: %w", err)
 	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("failed to download file: status=%d, response=%s", resp.StatusCode, string(data))
+		return nil, "", fmt.Errorf("failed to download file: status=%d, response=%s", resp.StatusCode, string(data))
 	}
 
-	// 4. 转换为base64
-	base64Data := base64.StdEncoding.EncodeToString(data)
+	return data, fileInfo.FilePath, nil
+}
+
+// transcribeAudio 下载语音/音频文件并转写为文字
+// 参数:
+//
+//	ctx: 上下文对象，取消时中断转写
+//	fileID: Telegram文件的file_id
+//
+// 返回: 转写文本，错误信息（未配置转写服务时返回错误）
+func (c *TelegramChannel) transcribeAudio(ctx context.Context, fileID string) (string, error) {
+	if c.transcriber == nil {
+		return "", fmt.Errorf("speech-to-text is not configured")
+	}
 
-	// 5. 根据文件扩展名确定MIME类型
-	mimeType := "application/octet-stream"
-	if strings.HasSuffix(fileInfo.FilePath, ".jpg") || strings.HasSuffix(fileInfo.FilePath, ".jpeg") {
-		mimeType = "image/jpeg"
-	} else if strings.HasSuffix(fileInfo.FilePath, ".png") {
-		mimeType = "image/png"
-	} else if strings.HasSuffix(fileInfo.FilePath, ".gif") {
-		mimeType = "image/gif"
-	} else if strings.HasSuffix(fileInfo.FilePath, ".pdf") {
-		mimeType = "application/pdf"
+	data, filePath, err := c.downloadFile(fileID)
+	if err != nil {
+		return "", err
 	}
 
-	// 6. 返回data URL格式
-	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64Data), nil
+	return c.transcriber.Transcribe(ctx, filePath, data)
 }
 
 // TelegramUpdate 表示Telegram的一次更新
 // 可能包含消息、编辑消息、回调查询等不同类型的更新
 type TelegramUpdate struct {
-	UpdateID int64            `json:"update_id"` // 更新ID，单调递增
-	Message  *TelegramMessage `json:"message"`   // 新消息
+	UpdateID      int64                  `json:"update_id"`      // 更新ID，单调递增
+	Message       *TelegramMessage       `json:"message"`        // 新消息
+	CallbackQuery *TelegramCallbackQuery `json:"callback_query"` // 内联键盘按钮点击
+}
+
+// TelegramCallbackQuery 表示内联键盘按钮的点击事件
+type TelegramCallbackQuery struct {
+	ID      string           `json:"id"`      // 回调查询ID，用于 answerCallbackQuery
+	From    *TelegramUser    `json:"from"`    // 点击按钮的用户
+	Message *TelegramMessage `json:"message"` // 按钮所在的消息（内联模式下可能为空）
+	Data    string           `json:"data"`    // 按钮的 callback_data
 }
 
 // TelegramMessage 表示Telegram消息
@@ -869,6 +1394,10 @@ type TelegramMessage struct {
 	Caption   string            `json:"caption"`    // 媒体文件的说明文字
 	Photo     []TelegramPhoto   `json:"photo"`      // 图片数组（如果消息包含图片）
 	Document  *TelegramDocument `json:"document"`   // 文档（如果消息包含文件）
+	Voice     *TelegramVoice    `json:"voice"`      // 语音消息
+	Audio     *TelegramAudio    `json:"audio"`      // 音频文件
+
+	ReplyToMessage *TelegramMessage `json:"reply_to_message"` // 被回复的消息（旁听模式下用于判断是否在回复机器人）
 }
 
 // TelegramPhoto 表示Telegram图片
@@ -887,6 +1416,23 @@ type TelegramDocument struct {
 	FileSize int    `json:"file_size"` // 文件大小
 }
 
+// TelegramVoice 表示Telegram语音消息（OGG/Opus 编码）
+type TelegramVoice struct {
+	FileID   string `json:"file_id"`   // 文件唯一ID
+	Duration int    `json:"duration"`  // 时长（秒）
+	MimeType string `json:"mime_type"` // MIME类型
+	FileSize int    `json:"file_size"` // 文件大小
+}
+
+// TelegramAudio 表示Telegram音频文件
+type TelegramAudio struct {
+	FileID   string `json:"file_id"`   // 文件唯一ID
+	Duration int    `json:"duration"`  // 时长（秒）
+	FileName string `json:"file_name"` // 文件名
+	MimeType string `json:"mime_type"` // MIME类型
+	FileSize int    `json:"file_size"` // 文件大小
+}
+
 // TelegramUser 表示Telegram用户
 // 包含用户的基本身份信息
 type TelegramUser struct {
@@ -0,0 +1,192 @@
+package channels
+
+// telegram_edit.go - 编辑同一条消息显示确认、进度和最终回复（channels.telegram.editReplies）
+// 多分钟的任务会先后发送确认、若干条进度提示和最终回复，每条都会产生一次通知。启用后：
+//  1. 回合的第一条确认或进度提示照常发送，并记住它的消息 ID
+//  2. 之后的进度提示通过 editMessageText 显示在确认下面
+//  3. 最终回复替换这条消息的内容（超长时其余分段照常发送；带媒体的回复会删除这条消息后照常发送）
+//
+// 回合通过用户消息的 ID 识别：确认和回复的元数据中带有 message_id，进度提示带有 source_message_id。
+// 定时任务、子代理结果等没有对应用户消息的出站消息不受影响。
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+)
+
+// liveMessageTTL 回合的消息超过这段时间没有更新就不再编辑（例如回合没有产生回复）
+const liveMessageTTL = time.Hour
+
+// liveMessage 是一个回合中正在被编辑的消息
+type liveMessage struct {
+	messageID int64     // Telegram 消息 ID
+	header    string    // 确认消息的内容（HTML），进度提示显示在它下面
+	updated   time.Time // 最后一次发送或编辑的时间
+}
+
+// liveTurn 返回出站消息所属回合的键（聊天 ID 和用户消息 ID），无法确定回合时返回空字符串
+func liveTurn(chatID int64, metadata map[string]interface{}) string {
+	for _, key := range []string{"source_message_id", "telegram_message_id", "message_id"} {
+		if id := metadataInt64(metadata[key]); id > 0 {
+			return fmt.Sprintf("%d:%d", chatID, id)
+		}
+	}
+	return ""
+}
+
+// sendLive 把确认、进度提示和最终回复合并到同一条消息
+// 返回:
+//
+//	消息是否已处理（false 表示调用方照常发送）以及发送错误
+func (c *TelegramChannel) sendLive(chatID int64, msg bus.OutboundMessage, replyToMessageID int64, replyMarkup map[string]interface{}) (bool, error) {
+	turn := liveTurn(chatID, msg.Metadata)
+	if turn == "" {
+		return false, nil
+	}
+	ack, _ := msg.Metadata["ack"].(bool)
+	progress, _ := msg.Metadata["progress"].(bool)
+	live := c.takeLive(turn)
+
+	if ack || progress {
+		text := markdownToHTML(msg.Content)
+		header := ""
+		switch {
+		case ack:
+			header = text
+		case live != nil && live.header != "":
+			header = live.header
+			text = header + "\n\n" + text
+		}
+		if len(text) > telegramMessageMaxLength {
+			c.putLive(turn, live)
+			return false, nil
+		}
+
+		if live != nil {
+			err := c.editText(chatID, live.messageID, text, msg.Content, nil)
+			if err == nil {
+				c.putLive(turn, &liveMessage{messageID: live.messageID, header: header, updated: time.Now()})
+				return true, nil
+			}
+			log.Printf("[Telegram] 编辑消息失败，改为发送新消息: %v", err)
+		}
+		messageID, err := c.sendText(chatID, text, msg.Content, replyToMessageID, replyMarkup)
+		if err != nil {
+			c.putLive(turn, live)
+			return true, err
+		}
+		c.putLive(turn, &liveMessage{messageID: messageID, header: header, updated: time.Now()})
+		return true, nil
+	}
+
+	// 最终回复
+	if live == nil {
+		return false, nil
+	}
+	if len(msg.Media) > 0 {
+		if err := c.deleteMessage(chatID, live.messageID); err != nil {
+			log.Printf("[Telegram] 删除确认消息失败: %v", err)
+		}
+		return false, nil
+	}
+
+	parts := splitMessage(markdownToHTML(msg.Content), telegramMessageMaxLength)
+	if len(parts) == 0 || strings.TrimSpace(parts[0]) == "" {
+		return false, nil
+	}
+	var markup map[string]interface{}
+	if len(parts) == 1 {
+		markup = replyMarkup
+	}
+	if err := c.editText(chatID, live.messageID, parts[0], msg.Content, markup); err != nil {
+		log.Printf("[Telegram] 编辑消息失败，改为发送新消息: %v", err)
+		return false, nil
+	}
+	for i, part := range parts[1:] {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		markup = nil
+		if i == len(parts)-2 {
+			markup = replyMarkup
+		}
+		if _, err := c.sendText(chatID, part, msg.Content, 0, markup); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// takeLive 取出回合正在编辑的消息（不存在时返回 nil）
+func (c *TelegramChannel) takeLive(turn string) *liveMessage {
+	c.liveMu.Lock()
+	defer c.liveMu.Unlock()
+	live := c.live[turn]
+	delete(c.live, turn)
+	return live
+}
+
+// putLive 保存回合正在编辑的消息，并清理过期的记录
+func (c *TelegramChannel) putLive(turn string, live *liveMessage) {
+	if live == nil {
+		return
+	}
+	c.liveMu.Lock()
+	defer c.liveMu.Unlock()
+	if c.live == nil {
+		c.live = make(map[string]*liveMessage)
+	}
+	for key, existing := range c.live {
+		if time.Since(existing.updated) > liveMessageTTL {
+			delete(c.live, key)
+		}
+	}
+	c.live[turn] = live
+}
+
+// editText 以 HTML 格式修改一条消息的内容，HTML 解析失败时改为纯文本
+// 内容没有变化（Telegram 返回 "message is not modified"）视为成功
+func (c *TelegramChannel) editText(chatID, messageID int64, text, original string, replyMarkup map[string]interface{}) error {
+	err := c.editMessage(chatID, messageID, text, "HTML", replyMarkup)
+	if err != nil && isTelegramHTMLParseError(err) {
+		plainText := telegramHTMLToPlainText(text)
+		if plainText == "" {
+			plainText = original
+		}
+		err = c.editMessage(chatID, messageID, plainText, "", replyMarkup)
+	}
+	var apiErr *telegramAPIError
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.Description, "message is not modified") {
+		return nil
+	}
+	return err
+}
+
+// editMessage 调用 editMessageText 修改一条消息
+func (c *TelegramChannel) editMessage(chatID, messageID int64, text, parseMode string, replyMarkup map[string]interface{}) error {
+	data := map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"text":       text,
+	}
+	if parseMode != "" {
+		data["parse_mode"] = parseMode
+	}
+	if replyMarkup != nil {
+		data["reply_markup"] = replyMarkup
+	}
+	return c.doTelegramJSON("editMessageText", data, nil)
+}
+
+// deleteMessage 删除一条消息
+func (c *TelegramChannel) deleteMessage(chatID, messageID int64) error {
+	return c.doTelegramJSON("deleteMessage", map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+	}, nil)
+}
@@ -0,0 +1,146 @@
+// toggle.go 实现运行时停用和重新启用单个频道（/channels disable|enable）
+// 停用的频道立即停止接收消息，发往它的出站消息由出站分发器暂存（见 Dispatcher.park），
+// 重新启用后频道重新启动，暂存的消息按顺序发送。
+// 停用状态只保存在内存中：配置热重载不会启动停用的频道，重启进程后恢复为配置文件中的状态。
+package channels
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/Ailoc/nanogrip/internal/config"
+)
+
+// Names 是管理器支持的频道名称
+var Names = []string{"telegram", "discord", "feishu", "webhook"}
+
+// ChannelStatus 描述一个频道的状态
+type ChannelStatus struct {
+	Name       string // 频道名称
+	Configured bool   // 配置文件中是否启用
+	Running    bool   // 是否正在运行
+	Disabled   bool   // 是否被 Disable 停用
+}
+
+// Disable 停用频道：停止频道，之后发往它的出站消息暂存到 Enable 时再发送
+// 参数:
+//
+//	name: 频道名称
+//
+// 返回: 频道不存在、未在配置中启用或已经停用时返回错误
+func (m *Manager) Disable(name string) error {
+	m.mu.Lock()
+	if err := m.checkConfigured(name); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	if m.disabled[name] {
+		m.mu.Unlock()
+		return fmt.Errorf("channel %s is already disabled", name)
+	}
+	if m.disabled == nil {
+		m.disabled = make(map[string]bool)
+	}
+	m.disabled[name] = true
+	m.mu.Unlock()
+
+	log.Printf("Channel %s disabled", name)
+	m.stopChannel(name)
+	return nil
+}
+
+// Enable 重新启用 Disable 停用的频道：启动频道，并发送停用期间暂存的消息
+// 参数:
+//
+//	name: 频道名称
+//
+// 返回: 频道没有被停用或启动失败时返回错误（启动失败时频道保持启用，下次配置热重载时重试）
+func (m *Manager) Enable(name string) error {
+	m.mu.Lock()
+	if !m.disabled[name] {
+		m.mu.Unlock()
+		return fmt.Errorf("channel %s is not disabled", name)
+	}
+	delete(m.disabled, name)
+	ctx, cfg, onEnable := m.ctx, m.cfg, m.onEnable
+	_, running := m.channels[name]
+	m.mu.Unlock()
+
+	log.Printf("Channel %s enabled", name)
+	var err error
+	// 停用期间配置热重载可能已经禁用了频道，这时只恢复暂存的消息（它们会因为找不到频道进入死信）
+	if !running && ctx != nil && configured(cfg, name) {
+		switch name {
+		case "telegram":
+			err = m.startTelegram(ctx, cfg)
+		case "discord":
+			err = m.startDiscord(ctx, cfg)
+		case "feishu":
+			err = m.startFeishu(ctx, cfg)
+		case "webhook":
+			err = m.startWebhook(ctx, cfg)
+		}
+	}
+	if onEnable != nil {
+		onEnable(name)
+	}
+	if err != nil {
+		return fmt.Errorf("start %s: %w", name, err)
+	}
+	return nil
+}
+
+// Disabled 判断频道是否被 Disable 停用
+func (m *Manager) Disabled(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.disabled[name]
+}
+
+// Status 返回所有支持的频道的状态（按名称排序）
+func (m *Manager) Status() []ChannelStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]ChannelStatus, 0, len(Names))
+	for _, name := range Names {
+		_, running := m.channels[name]
+		statuses = append(statuses, ChannelStatus{
+			Name:       name,
+			Configured: configured(m.cfg, name),
+			Running:    running,
+			Disabled:   m.disabled[name],
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// checkConfigured 检查频道是否存在并在配置中启用（调用者需持有 mu）
+func (m *Manager) checkConfigured(name string) error {
+	for _, known := range Names {
+		if known == name {
+			if !configured(m.cfg, name) {
+				return fmt.Errorf("channel %s is not enabled in the config file", name)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown channel %q", name)
+}
+
+// configured 判断频道是否在配置中启用
+func configured(cfg *config.Config, name string) bool {
+	switch name {
+	case "telegram":
+		return cfg.Channels.Telegram.Enabled
+	case "discord":
+		return cfg.Channels.Discord.Enabled
+	case "feishu":
+		return cfg.Channels.Feishu.Enabled
+	case "webhook":
+		return cfg.Channels.Webhook.Enabled
+	}
+	return false
+}
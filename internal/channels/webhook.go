@@ -0,0 +1,258 @@
+// Package channels - Webhook 频道实现
+// webhook.go 实现了接收外部事件的入站 Webhook 频道
+// 外部系统向 gateway 的 POST /hooks/<名称> 推送事件（HMAC 签名或共享令牌校验），
+// 事件作为 "webhook" 频道的消息发布到消息总线（发送者和聊天 ID 都是 Webhook 名称），
+// Agent 的回复转发到该 Webhook 配置的聊天（例如主人的 Telegram）
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/config"
+)
+
+const (
+	webhookMaxBody     = 1 << 20 // 请求体最大字节数
+	webhookMaxContent  = 20000   // 交给 Agent 的事件内容最大字符数
+	webhookDedupTTL    = 10 * time.Minute
+	webhookTokenHeader = "X-Webhook-Token"
+)
+
+// webhookDeliveryHeaders 标识一次投递的请求头，来源重试同一事件时用于去重
+var webhookDeliveryHeaders = []string{"X-GitHub-Delivery", "X-Gitlab-Event-UUID", "X-Request-Id", "Idempotency-Key"}
+
+// webhookEventHeaders 描述事件类型的请求头，附在事件内容前面帮助 Agent 理解事件
+var webhookEventHeaders = []string{"X-GitHub-Event", "X-Gitlab-Event", "X-Event-Type", "Content-Type"}
+
+// WebhookChannel 入站 Webhook 频道
+// 主要特性：
+// 1. 只接受配置中列出的 Webhook，按 HMAC-SHA256 签名或共享令牌校验请求
+// 2. 按投递 ID 请求头去重（来源在未及时收到响应时会重试推送）
+// 3. 回复不发回来源，而是转发到 Webhook 配置的频道和聊天
+type WebhookChannel struct {
+	*BaseChannel
+	mu    sync.Mutex
+	hooks map[string]config.WebhookHookConfig // 按名称索引的 Webhook 配置
+	seen  map[string]time.Time                // 最近处理过的投递 ID，用于去重
+}
+
+// NewWebhookChannel 创建一个新的 Webhook 频道实例
+// 参数:
+//
+//	cfg: Webhook 配置
+//	bus: 消息总线，用于发布收到的事件和转发回复
+//
+// 返回: 初始化后的WebhookChannel指针
+func NewWebhookChannel(cfg *config.WebhookConfig, bus *bus.MessageBus) *WebhookChannel {
+	c := &WebhookChannel{
+		BaseChannel: NewBaseChannel("webhook", cfg, bus),
+		seen:        make(map[string]time.Time),
+	}
+	c.SetHooks(cfg.Hooks)
+	return c
+}
+
+// SetHooks 更新 Webhook 列表（配置热重载时调用）
+// 没有配置 secret 和 token 的 Webhook 被忽略
+func (c *WebhookChannel) SetHooks(hooks []config.WebhookHookConfig) {
+	byName := make(map[string]config.WebhookHookConfig, len(hooks))
+	for _, hook := range hooks {
+		if hook.Name == "" {
+			continue
+		}
+		if hook.Secret == "" && hook.Token == "" {
+			log.Printf("Warning: Webhook %s 没有配置 secret 或 token，已忽略", hook.Name)
+			continue
+		}
+		byName[hook.Name] = hook
+	}
+	c.mu.Lock()
+	c.hooks = byName
+	c.mu.Unlock()
+}
+
+// Capabilities 返回 Webhook 频道的能力声明
+// 回复会转发到其他频道，由目标频道再按自己的能力降级
+func (c *WebhookChannel) Capabilities() Capabilities {
+	return Capabilities{Markdown: MarkdownStandard}
+}
+
+// Start 启动 Webhook 频道
+func (c *WebhookChannel) Start(ctx context.Context) error {
+	c.mu.Lock()
+	count := len(c.hooks)
+	c.mu.Unlock()
+	if count == 0 {
+		log.Println("Warning: Webhook channel has no usable hooks (each needs a secret or token)")
+	}
+	c.running = true
+	log.Printf("Webhook channel started (%d hooks, endpoint: /hooks/<name>)", count)
+	return nil
+}
+
+// Stop 停止 Webhook 频道
+func (c *WebhookChannel) Stop() error {
+	c.running = false
+	log.Println("Webhook channel stopped")
+	return nil
+}
+
+// ServeHTTP 处理 POST /hooks/<名称> 请求
+func (c *WebhookChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	c.mu.Lock()
+	hook, ok := c.hooks[name]
+	c.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, webhookMaxBody+1))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if len(body) > webhookMaxBody {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if !webhookAuthorized(hook, r, body) {
+		log.Printf("Rejected webhook %s: invalid signature or token", name)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	delivery := ""
+	for _, header := range webhookDeliveryHeaders {
+		if delivery = r.Header.Get(header); delivery != "" {
+			break
+		}
+	}
+	if c.duplicate(name, delivery) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	inbound := bus.InboundMessage{
+		Message: bus.Message{
+			ID:        delivery,
+			Channel:   "webhook",
+			SenderID:  name,
+			ChatID:    name,
+			Content:   webhookContent(hook, r, body),
+			Timestamp: time.Now(),
+			Metadata: map[string]interface{}{
+				"webhook":  name,
+				"delivery": delivery,
+			},
+		},
+	}
+	if err := c.bus.PublishInbound(inbound); err != nil {
+		log.Printf("Error publishing inbound message: %v", err)
+		http.Error(w, "queue full", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// webhookAuthorized 校验请求：配置了 secret 时校验 HMAC 签名，否则校验共享令牌
+func webhookAuthorized(hook config.WebhookHookConfig, r *http.Request, body []byte) bool {
+	if hook.Secret != "" {
+		signature := strings.TrimSpace(r.Header.Get(hook.SignatureHeader))
+		signature = strings.TrimPrefix(signature, "sha256=")
+		got, err := hex.DecodeString(signature)
+		if err != nil || len(got) == 0 {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(hook.Secret))
+		mac.Write(body)
+		return hmac.Equal(got, mac.Sum(nil))
+	}
+
+	token := r.Header.Get(webhookTokenHeader)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(hook.Token)) == 1
+}
+
+// webhookContent 把事件格式化为交给 Agent 的消息
+func webhookContent(hook config.WebhookHookConfig, r *http.Request, body []byte) string {
+	var sb strings.Builder
+	if hook.Prompt != "" {
+		sb.WriteString(strings.TrimSpace(hook.Prompt))
+		sb.WriteString("\n\n")
+	}
+	fmt.Fprintf(&sb, "[Webhook event from %s]\n", hook.Name)
+	for _, header := range webhookEventHeaders {
+		if value := r.Header.Get(header); value != "" {
+			fmt.Fprintf(&sb, "%s: %s\n", header, value)
+		}
+	}
+	sb.WriteString("\n")
+
+	payload := string(body)
+	if !utf8.ValidString(payload) {
+		payload = strings.ToValidUTF8(payload, "�")
+	}
+	if runes := []rune(payload); len(runes) > webhookMaxContent {
+		payload = string(runes[:webhookMaxContent]) + "\n…(truncated)"
+	}
+	sb.WriteString(payload)
+	return sb.String()
+}
+
+// duplicate 判断投递是否已经处理过，同时清理过期的记录
+func (c *WebhookChannel) duplicate(name, delivery string) bool {
+	if delivery == "" {
+		return false
+	}
+	key := name + ":" + delivery
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for id, at := range c.seen {
+		if now.Sub(at) > webhookDedupTTL {
+			delete(c.seen, id)
+		}
+	}
+	if _, ok := c.seen[key]; ok {
+		return true
+	}
+	c.seen[key] = now
+	return false
+}
+
+// Send 把 Agent 对 Webhook 事件的回复转发到该 Webhook 配置的聊天
+// 没有配置转发目标时只记录日志
+func (c *WebhookChannel) Send(msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	hook, ok := c.hooks[msg.ChatID]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown webhook %q", msg.ChatID)
+	}
+	if hook.Channel == "" || hook.ChatID == "" || hook.Channel == "webhook" {
+		log.Printf("Webhook %s 的回复没有转发目标（channel/chatId），已丢弃: %.80s", hook.Name, msg.Content)
+		return nil
+	}
+
+	msg.Channel = hook.Channel
+	msg.ChatID = hook.ChatID
+	return c.bus.PublishOutbound(msg)
+}
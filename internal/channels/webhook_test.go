@@ -0,0 +1,53 @@
+package channels
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Ailoc/nanogrip/internal/config"
+)
+
+func TestWebhookAuthorized(t *testing.T) {
+	body := []byte(`{"action":"opened"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	valid := hex.EncodeToString(mac.Sum(nil))
+
+	signed := config.WebhookHookConfig{Name: "github", Secret: "s3cret", SignatureHeader: "X-Hub-Signature-256"}
+	tokened := config.WebhookHookConfig{Name: "home", Token: "t0ken"}
+
+	tests := []struct {
+		name    string
+		hook    config.WebhookHookConfig
+		target  string
+		headers map[string]string
+		body    []byte
+		want    bool
+	}{
+		{"valid signature", signed, "/hooks/github", map[string]string{"X-Hub-Signature-256": "sha256=" + valid}, body, true},
+		{"valid signature without prefix", signed, "/hooks/github", map[string]string{"X-Hub-Signature-256": valid}, body, true},
+		{"missing signature", signed, "/hooks/github", nil, body, false},
+		{"signature not hex", signed, "/hooks/github", map[string]string{"X-Hub-Signature-256": "sha256=zz"}, body, false},
+		{"tampered body", signed, "/hooks/github", map[string]string{"X-Hub-Signature-256": "sha256=" + valid}, []byte(`{"action":"closed"}`), false},
+		{"token ignored when secret is set", signed, "/hooks/github?token=t0ken", map[string]string{webhookTokenHeader: "t0ken"}, body, false},
+		{"token header", tokened, "/hooks/home", map[string]string{webhookTokenHeader: "t0ken"}, body, true},
+		{"token query", tokened, "/hooks/home?token=t0ken", nil, body, true},
+		{"wrong token", tokened, "/hooks/home", map[string]string{webhookTokenHeader: "other"}, body, false},
+		{"missing token", tokened, "/hooks/home", nil, body, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.target, nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := webhookAuthorized(tt.hook, r, tt.body); got != tt.want {
+				t.Errorf("webhookAuthorized() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
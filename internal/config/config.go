@@ -1,9 +1,16 @@
 package config
 
 import (
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/Ailoc/nanogrip/internal/paths"
+	"github.com/Ailoc/nanogrip/internal/secrets"
 	"gopkg.in/yaml.v3"
 )
 
@@ -29,6 +36,418 @@ type Config struct {
 	// MCPServers MCP 服务器配置
 	// 用于连接外部 MCP 服务器以扩展工具能力
 	MCPServers map[string]MCPServerConfig `yaml:"mcpServers"`
+
+	// MCPRefreshInterval 定期刷新 MCP 工具列表的间隔（秒），0 表示只在启动和 /mcp reload 时获取
+	// 刷新时会重试启动失败的服务器，并同步服务器在运行中新增或删除的工具
+	// `yaml:"mcpRefreshInterval"` 表示此字段对应 YAML 文件中的 "mcpRefreshInterval" 键
+	MCPRefreshInterval int `yaml:"mcpRefreshInterval"`
+
+	// Gateway Gateway HTTP 服务配置（日历订阅等端点）
+	// `yaml:"gateway"` 表示此字段对应 YAML 文件中的 "gateway" 键
+	Gateway GatewayConfig `yaml:"gateway"`
+
+	// Outbox 出站消息归档配置
+	// `yaml:"outbox"` 表示此字段对应 YAML 文件中的 "outbox" 键
+	Outbox OutboxConfig `yaml:"outbox"`
+
+	// Notify 主人通知配置（启动、退出、崩溃循环）
+	// `yaml:"notify"` 表示此字段对应 YAML 文件中的 "notify" 键
+	Notify NotifyConfig `yaml:"notify"`
+
+	// Tracing 请求追踪配置（OpenTelemetry 导出）
+	// `yaml:"tracing"` 表示此字段对应 YAML 文件中的 "tracing" 键
+	Tracing TracingConfig `yaml:"tracing"`
+
+	// Secrets 静态数据加密配置
+	// `yaml:"secrets"` 表示此字段对应 YAML 文件中的 "secrets" 键
+	Secrets SecretsConfig `yaml:"secrets"`
+
+	// Redaction 密钥脱敏配置（工具结果、日志和会话文件）
+	// `yaml:"redaction"` 表示此字段对应 YAML 文件中的 "redaction" 键
+	Redaction RedactionConfig `yaml:"redaction"`
+
+	// Sessions 会话保留策略
+	// `yaml:"sessions"` 表示此字段对应 YAML 文件中的 "sessions" 键
+	Sessions SessionsConfig `yaml:"sessions"`
+
+	// RateLimit 限流和每日额度配置
+	// `yaml:"rateLimit"` 表示此字段对应 YAML 文件中的 "rateLimit" 键
+	RateLimit RateLimitConfig `yaml:"rateLimit"`
+
+	// Budget 每日花费上限配置（按提供商计算所有 LLM 调用）
+	// `yaml:"budget"` 表示此字段对应 YAML 文件中的 "budget" 键
+	Budget BudgetConfig `yaml:"budget"`
+
+	// Backup 工作区备份配置
+	// `yaml:"backup"` 表示此字段对应 YAML 文件中的 "backup" 键
+	Backup BackupConfig `yaml:"backup"`
+
+	// Admins 可以使用管理员命令（/status、/tools、/model、/memory）的发送者 ID
+	// 可以写 "123" 或 "telegram:123"；为空表示只有本地 CLI 可以使用
+	// `yaml:"admins"` 表示此字段对应 YAML 文件中的 "admins" 键
+	Admins []string `yaml:"admins"`
+
+	// Cron 配置文件中定义的定时任务
+	// `yaml:"cron"` 表示此字段对应 YAML 文件中的 "cron" 键
+	Cron CronConfig `yaml:"cron"`
+
+	// ReloadInterval 检查配置文件变化的间隔（秒），0 使用默认值 2，-1 关闭自动重载（仍可用 SIGHUP 触发）
+	// `yaml:"reloadInterval"` 表示此字段对应 YAML 文件中的 "reloadInterval" 键
+	ReloadInterval int `yaml:"reloadInterval"`
+}
+
+// RedactionConfig 包含密钥脱敏的配置
+// 默认启用：工具结果、日志和保存的会话中的已知密钥（本配置文件中的 apiKey、token 等）
+// 和看起来像密钥的字符串会被替换为 "[REDACTED]"
+type RedactionConfig struct {
+	// Disabled 关闭脱敏
+	// `yaml:"disabled"` 表示此字段对应 YAML 文件中的 "disabled" 键
+	Disabled bool `yaml:"disabled"`
+
+	// Patterns 额外的密钥格式（正则表达式），匹配的文本会被替换
+	// `yaml:"patterns"` 表示此字段对应 YAML 文件中的 "patterns" 键
+	Patterns []string `yaml:"patterns"`
+}
+
+// SecretsConfig 包含静态数据加密的配置
+// 密钥由 "nanogrip secrets init" 生成，保存在配置目录的 secret.key 或系统钥匙串中
+type SecretsConfig struct {
+	// EncryptSessions 是否加密会话文件（workspace/sessions/*.jsonl）、持久化入站队列（workspace/queue.jsonl）和出站归档中的消息原文
+	// `yaml:"encryptSessions"` 表示此字段对应 YAML 文件中的 "encryptSessions" 键
+	EncryptSessions bool `yaml:"encryptSessions"`
+}
+
+// SessionsConfig 包含会话保留策略的配置
+// 两项都为 0 时会话永久保留；过期会话删除前会先通过记忆整理提炼到 HISTORY.md
+type SessionsConfig struct {
+	// MaxAge 会话最长保留天数（按最后更新时间计算），0 表示不按时间过期
+	// `yaml:"maxAge"` 表示此字段对应 YAML 文件中的 "maxAge" 键
+	MaxAge int `yaml:"maxAge"`
+
+	// MaxCount 最多保留的会话数量，超出时归档最旧的会话，0 表示不限制
+	// `yaml:"maxCount"` 表示此字段对应 YAML 文件中的 "maxCount" 键
+	MaxCount int `yaml:"maxCount"`
+
+	// DisableTitles 不自动生成会话标题（默认在第一轮对话后用记忆整理的模型生成，nanogrip sessions list 中显示）
+	// `yaml:"disableTitles"` 表示此字段对应 YAML 文件中的 "disableTitles" 键
+	DisableTitles bool `yaml:"disableTitles"`
+}
+
+// RateLimitConfig 包含限流和每日额度的配置
+// allowFrom 中包含群聊时，群里任何人都能触发 Agent，限流可以避免 API 额度被耗尽
+// 所有限制为 0 表示不限制；每日用量保存在 workspace/usage.json
+type RateLimitConfig struct {
+	// PerSender 每个发送者的限制
+	// `yaml:"perSender"` 表示此字段对应 YAML 文件中的 "perSender" 键
+	PerSender RateLimits `yaml:"perSender"`
+
+	// PerChannel 每个频道（所有发送者合计）的限制
+	// `yaml:"perChannel"` 表示此字段对应 YAML 文件中的 "perChannel" 键
+	PerChannel RateLimits `yaml:"perChannel"`
+
+	// Exempt 不受限制的发送者 ID（例如主人自己），可以写 "123" 或 "telegram:123"
+	// `yaml:"exempt"` 表示此字段对应 YAML 文件中的 "exempt" 键
+	Exempt []string `yaml:"exempt"`
+}
+
+// RateLimits 描述一组限制，0 表示不限制
+type RateLimits struct {
+	// MessagesPerMinute 每分钟最多处理的消息数
+	// `yaml:"messagesPerMinute"` 表示此字段对应 YAML 文件中的 "messagesPerMinute" 键
+	MessagesPerMinute int `yaml:"messagesPerMinute"`
+
+	// LLMCallsPerDay 每天最多的 LLM 调用次数（一条消息可能触发多次调用）
+	// `yaml:"llmCallsPerDay"` 表示此字段对应 YAML 文件中的 "llmCallsPerDay" 键
+	LLMCallsPerDay int `yaml:"llmCallsPerDay"`
+
+	// TokensPerDay 每天最多消耗的 token 数
+	// `yaml:"tokensPerDay"` 表示此字段对应 YAML 文件中的 "tokensPerDay" 键
+	TokensPerDay int `yaml:"tokensPerDay"`
+}
+
+// BudgetConfig 包含每日花费上限的配置
+// 与 rateLimit 不同，这里限制的是所有 Agent、子代理、记忆整理和定时任务合计的用量；
+// 每日用量保存在 workspace/budget.json
+type BudgetConfig struct {
+	// Providers 每个提供商（anthropic、openai）的每日限制，未列出的提供商不限制
+	// `yaml:"providers"` 表示此字段对应 YAML 文件中的 "providers" 键
+	Providers map[string]BudgetLimits `yaml:"providers"`
+
+	// Prices 模型单价（每百万 token，美元），用于估算花费；键可以是模型名称或前缀
+	// 没有单价的模型只计入 token 用量
+	// `yaml:"prices"` 表示此字段对应 YAML 文件中的 "prices" 键
+	Prices map[string]ModelPrice `yaml:"prices"`
+
+	// FallbackModel 预算用完后改用的更便宜的模型，留空表示直接拒绝新的 LLM 调用
+	// 备用模型的调用仍然计入用量，但不受限制
+	// `yaml:"fallbackModel"` 表示此字段对应 YAML 文件中的 "fallbackModel" 键
+	FallbackModel string `yaml:"fallbackModel"`
+
+	// ResetTime 每天清零用量的时间（本地时间，HH:MM），默认值为 "00:00"
+	// `yaml:"resetTime"` 表示此字段对应 YAML 文件中的 "resetTime" 键
+	ResetTime string `yaml:"resetTime"`
+}
+
+// BackupConfig 包含工作区备份的配置
+// 备份包含会话、记忆、待办事项等工作区中的所有数据，可以用 "nanogrip backup" 手动创建和恢复
+type BackupConfig struct {
+	// Dir 备份目录，默认值为工作区旁边的 backups 目录（~/.nanogrip/backups）
+	// 建议设置为另一块磁盘或同步目录，避免和工作区一起丢失
+	// `yaml:"dir"` 表示此字段对应 YAML 文件中的 "dir" 键
+	Dir string `yaml:"dir"`
+
+	// Schedule 定时备份的 cron 表达式（例如 "0 3 * * *"），留空表示不定时备份
+	// 定时备份失败时通知 notify 中的主人
+	// `yaml:"schedule"` 表示此字段对应 YAML 文件中的 "schedule" 键
+	Schedule string `yaml:"schedule"`
+
+	// Keep 保留最近的几份备份，默认值为 7，-1 表示不删除旧备份
+	// `yaml:"keep"` 表示此字段对应 YAML 文件中的 "keep" 键
+	Keep int `yaml:"keep"`
+
+	// Encrypt 使用 secrets 的密钥加密备份（需要先运行 "nanogrip secrets init"）
+	// 恢复加密的备份需要同一个密钥，请另外妥善保存密钥
+	// `yaml:"encrypt"` 表示此字段对应 YAML 文件中的 "encrypt" 键
+	Encrypt bool `yaml:"encrypt"`
+}
+
+// BudgetLimits 描述一个提供商的每日限制，0 表示不限制
+type BudgetLimits struct {
+	// MaxTokensPerDay 每天最多消耗的 token 数
+	// `yaml:"maxTokensPerDay"` 表示此字段对应 YAML 文件中的 "maxTokensPerDay" 键
+	MaxTokensPerDay int `yaml:"maxTokensPerDay"`
+
+	// MaxCostPerDay 每天最多的花费（美元，按 prices 估算）
+	// `yaml:"maxCostPerDay"` 表示此字段对应 YAML 文件中的 "maxCostPerDay" 键
+	MaxCostPerDay float64 `yaml:"maxCostPerDay"`
+}
+
+// ModelPrice 描述一个模型的单价（每百万 token，美元）
+type ModelPrice struct {
+	// Input 输入（提示词）token 单价
+	// `yaml:"input"` 表示此字段对应 YAML 文件中的 "input" 键
+	Input float64 `yaml:"input"`
+
+	// Output 输出 token 单价
+	// `yaml:"output"` 表示此字段对应 YAML 文件中的 "output" 键
+	Output float64 `yaml:"output"`
+}
+
+// CronConfig 包含配置文件中定义的定时任务
+// 与聊天中创建的任务不同，这些任务随配置文件一起管理，修改后热重载即可生效
+type CronConfig struct {
+	// Jobs 任务列表
+	// `yaml:"jobs"` 表示此字段对应 YAML 文件中的 "jobs" 键
+	Jobs []CronJobConfig `yaml:"jobs"`
+
+	// Permissions Agent 模式任务无人值守执行时的默认工具权限，不设置表示不限制
+	// 聊天中创建的任务只能在此基础上进一步收紧；配置中的任务可以用自己的 permissions 覆盖
+	// `yaml:"permissions"` 表示此字段对应 YAML 文件中的 "permissions" 键
+	Permissions CronPermissions `yaml:"permissions"`
+
+	// Digest 每日或每周摘要任务
+	// `yaml:"digest"` 表示此字段对应 YAML 文件中的 "digest" 键
+	Digest DigestConfig `yaml:"digest"`
+
+	// History 每个任务保留的执行记录数（开始时间、耗时、成功或失败、回复开头），默认值为 20，设置为负数表示不记录
+	// 记录保存在 workspace/cron/history.json，可以用 cron 工具的 history 操作或 "nanogrip cron history" 查看
+	// `yaml:"history"` 表示此字段对应 YAML 文件中的 "history" 键
+	History int `yaml:"history"`
+
+	// AlertAfter 周期性任务连续失败多少次后通知主人（notify.channel / notify.chatId），恢复后再通知一次，默认值为 0 表示不通知
+	// `yaml:"alertAfter"` 表示此字段对应 YAML 文件中的 "alertAfter" 键
+	AlertAfter int `yaml:"alertAfter"`
+}
+
+// DigestConfig 包含摘要任务的配置
+// 到点后 Agent 把这段时间的对话、完成的待办和执行过的定时任务总结成一条消息，发送到指定聊天并追加到 HISTORY.md
+type DigestConfig struct {
+	// Enabled 是否启用摘要任务
+	// `yaml:"enabled"` 表示此字段对应 YAML 文件中的 "enabled" 键
+	Enabled bool `yaml:"enabled"`
+
+	// Period 摘要覆盖的时间段："daily"（默认，过去 24 小时）或 "weekly"（过去 7 天）
+	// `yaml:"period"` 表示此字段对应 YAML 文件中的 "period" 键
+	Period string `yaml:"period"`
+
+	// Cron 生成摘要的时间（Cron 表达式），默认 daily 为 "0 21 * * *"，weekly 为 "0 18 * * 0"
+	// `yaml:"cron"` 表示此字段对应 YAML 文件中的 "cron" 键
+	Cron string `yaml:"cron"`
+
+	// Channel 摘要发送到的频道，默认与 notify.channel 相同
+	// `yaml:"channel"` 表示此字段对应 YAML 文件中的 "channel" 键
+	Channel string `yaml:"channel"`
+
+	// To 摘要发送到的聊天 ID，默认与 notify.chatId 相同
+	// `yaml:"to"` 表示此字段对应 YAML 文件中的 "to" 键
+	To string `yaml:"to"`
+}
+
+// CronPermissions 限制 Agent 模式定时任务可以使用的工具
+type CronPermissions struct {
+	// Tools 允许的工具名称（支持 * 通配符，例如 "mcp_*"），为空表示不限制
+	// `yaml:"tools"` 表示此字段对应 YAML 文件中的 "tools" 键
+	Tools []string `yaml:"tools"`
+
+	// ReadOnly 文件系统只读（禁止写入、删除和修改文件，也不提供 shell 等执行命令的工具）
+	// `yaml:"readOnly"` 表示此字段对应 YAML 文件中的 "readOnly" 键
+	ReadOnly bool `yaml:"readOnly"`
+
+	// NoShell 禁止执行命令（shell、tmux、code_exec 和技能命令 skill_*）
+	// `yaml:"noShell"` 表示此字段对应 YAML 文件中的 "noShell" 键
+	NoShell bool `yaml:"noShell"`
+}
+
+// CronJobConfig 定义一个定时任务
+// Cron 和 Every 二选一；Command、Message 和 Template 三选一
+type CronJobConfig struct {
+	// Name 任务名称，在配置中必须唯一
+	// `yaml:"name"` 表示此字段对应 YAML 文件中的 "name" 键
+	Name string `yaml:"name"`
+
+	// Cron Cron 表达式，例如 "0 9 * * *"
+	// `yaml:"cron"` 表示此字段对应 YAML 文件中的 "cron" 键
+	Cron string `yaml:"cron"`
+
+	// Every 固定间隔（秒）
+	// `yaml:"every"` 表示此字段对应 YAML 文件中的 "every" 键
+	Every int `yaml:"every"`
+
+	// Command 交给 Agent 执行的命令
+	// `yaml:"command"` 表示此字段对应 YAML 文件中的 "command" 键
+	Command string `yaml:"command"`
+
+	// Message 直接发送的固定消息
+	// `yaml:"message"` 表示此字段对应 YAML 文件中的 "message" 键
+	Message string `yaml:"message"`
+
+	// Template 直接发送的消息模板名称（workspace/templates/<名称>.yaml），不经过模型
+	// `yaml:"template"` 表示此字段对应 YAML 文件中的 "template" 键
+	Template string `yaml:"template"`
+
+	// Variables 模板变量的值
+	// `yaml:"variables"` 表示此字段对应 YAML 文件中的 "variables" 键
+	Variables map[string]string `yaml:"variables"`
+
+	// Channel 结果发送到的频道，默认值为 "telegram"
+	// `yaml:"channel"` 表示此字段对应 YAML 文件中的 "channel" 键
+	Channel string `yaml:"channel"`
+
+	// To 结果发送到的聊天 ID
+	// `yaml:"to"` 表示此字段对应 YAML 文件中的 "to" 键
+	To string `yaml:"to"`
+
+	// Permissions 此任务的工具权限，不设置时使用 cron.permissions
+	// `yaml:"permissions"` 表示此字段对应 YAML 文件中的 "permissions" 键
+	Permissions *CronPermissions `yaml:"permissions"`
+
+	// Misfire 错过执行时间（进程停止、系统休眠等）后的处理：skip、run_once_late（默认）或 run_all_missed
+	// `yaml:"misfire"` 表示此字段对应 YAML 文件中的 "misfire" 键
+	Misfire string `yaml:"misfire"`
+
+	// SkipIfRunning 上一次执行尚未结束时是否跳过这一次，不设置时为 true
+	// `yaml:"skipIfRunning"` 表示此字段对应 YAML 文件中的 "skipIfRunning" 键
+	SkipIfRunning *bool `yaml:"skipIfRunning"`
+
+	// MaxRuntime Agent 模式每次执行的最长时间（秒），超时后取消，0 表示不限制
+	// `yaml:"maxRuntime"` 表示此字段对应 YAML 文件中的 "maxRuntime" 键
+	MaxRuntime int `yaml:"maxRuntime"`
+
+	// Jitter 每次执行前的最大随机延迟（秒），避免多个任务同时开始，0 表示不延迟
+	// `yaml:"jitter"` 表示此字段对应 YAML 文件中的 "jitter" 键
+	Jitter int `yaml:"jitter"`
+}
+
+// NotifyConfig 包含发给主人的运行状态通知配置
+// 只在 gateway 模式下生效，未设置 ChatID 时不发送任何通知
+type NotifyConfig struct {
+	// Channel 发送通知的频道，默认值为 "telegram"
+	// `yaml:"channel"` 表示此字段对应 YAML 文件中的 "channel" 键
+	Channel string `yaml:"channel"`
+
+	// ChatID 主人的聊天 ID
+	// `yaml:"chatId"` 表示此字段对应 YAML 文件中的 "chatId" 键
+	ChatID string `yaml:"chatId"`
+
+	// Startup 启动时发送通知（版本、已连接频道、定时任务和待办摘要）
+	// `yaml:"startup"` 表示此字段对应 YAML 文件中的 "startup" 键
+	Startup bool `yaml:"startup"`
+
+	// Shutdown 正常退出时发送告别消息
+	// `yaml:"shutdown"` 表示此字段对应 YAML 文件中的 "shutdown" 键
+	Shutdown bool `yaml:"shutdown"`
+
+	// CrashLoopThreshold 一小时内启动次数超过该值时发送崩溃循环告警，0 表示不告警，默认值为 3
+	// `yaml:"crashLoopThreshold"` 表示此字段对应 YAML 文件中的 "crashLoopThreshold" 键
+	CrashLoopThreshold int `yaml:"crashLoopThreshold"`
+}
+
+// OutboxConfig 包含出站消息归档的配置
+// 启用后每条实际投递到外部通道的消息都会记录到 workspace/outbox/YYYY-MM-DD.jsonl
+type OutboxConfig struct {
+	// Enabled 是否启用出站消息归档
+	// `yaml:"enabled"` 表示此字段对应 YAML 文件中的 "enabled" 键
+	Enabled bool `yaml:"enabled"`
+
+	// StoreContent 是否同时保存消息原文（否则只保存 SHA-256 哈希）
+	// `yaml:"storeContent"` 表示此字段对应 YAML 文件中的 "storeContent" 键
+	StoreContent bool `yaml:"storeContent"`
+}
+
+// TracingConfig 包含请求追踪的配置
+// 每条入站消息都有追踪 ID（日志中的 [trace=...]），配置 endpoint 后处理过程还会作为 OpenTelemetry span 导出
+type TracingConfig struct {
+	// Endpoint OTLP/HTTP 收集器地址（JSON 编码），例如 "http://localhost:4318/v1/traces"，为空表示不导出
+	// `yaml:"endpoint"` 表示此字段对应 YAML 文件中的 "endpoint" 键
+	Endpoint string `yaml:"endpoint"`
+
+	// ServiceName 导出的服务名称（service.name），默认值为 "nanogrip"
+	// `yaml:"serviceName"` 表示此字段对应 YAML 文件中的 "serviceName" 键
+	ServiceName string `yaml:"serviceName"`
+
+	// Headers 导出请求附加的请求头（例如认证令牌）
+	// `yaml:"headers"` 表示此字段对应 YAML 文件中的 "headers" 键
+	Headers map[string]string `yaml:"headers"`
+}
+
+// GatewayConfig 包含 Gateway HTTP 服务的配置
+type GatewayConfig struct {
+	// Host 监听地址
+	// `yaml:"host"` 表示此字段对应 YAML 文件中的 "host" 键
+	Host string `yaml:"host"`
+
+	// Port 监听端口，0 表示不启动 HTTP 服务
+	// `yaml:"port"` 表示此字段对应 YAML 文件中的 "port" 键
+	Port int `yaml:"port"`
+
+	// Token 访问令牌，为空表示不校验（仅建议在监听本机地址时留空）
+	// `yaml:"token"` 表示此字段对应 YAML 文件中的 "token" 键
+	Token string `yaml:"token"`
+
+	// PersistentQueue 是否把待处理的入站消息持久化到 workspace/queue.jsonl
+	// 启用后进程崩溃或重启前尚未处理的消息会在下次启动时重新处理
+	// `yaml:"persistentQueue"` 表示此字段对应 YAML 文件中的 "persistentQueue" 键
+	PersistentQueue bool `yaml:"persistentQueue"`
+
+	// Calendar 日历订阅（ICS）配置
+	// `yaml:"calendar"` 表示此字段对应 YAML 文件中的 "calendar" 键
+	Calendar CalendarFeedConfig `yaml:"calendar"`
+}
+
+// CalendarFeedConfig 包含日历订阅端点的配置
+// 启用后可在日历应用中订阅 http://host:port/calendar.ics 查看计划中的定时任务
+type CalendarFeedConfig struct {
+	// Enabled 是否启用日历订阅
+	// `yaml:"enabled"` 表示此字段对应 YAML 文件中的 "enabled" 键
+	Enabled bool `yaml:"enabled"`
+
+	// Days 导出未来多少天内的任务
+	// `yaml:"days"` 表示此字段对应 YAML 文件中的 "days" 键
+	Days int `yaml:"days"`
+
+	// MaxPerJob 每个任务最多导出的执行次数（避免高频任务刷屏）
+	// `yaml:"maxPerJob"` 表示此字段对应 YAML 文件中的 "maxPerJob" 键
+	MaxPerJob int `yaml:"maxPerJob"`
 }
 
 // AgentsConfig 包含代理的配置设置
@@ -37,6 +456,74 @@ type AgentsConfig struct {
 	// Defaults 代理的默认配置
 	// `yaml:"defaults"` 表示此字段对应 YAML 文件中的 "defaults" 键
 	Defaults AgentDefaults `yaml:"defaults"`
+
+	// Instances 额外的命名 Agent（仅 gateway 模式）
+	// 每个 Agent 有自己的工作区、模型、工具和会话，入站消息按频道、聊天 ID 或 /agent 命令路由
+	// `yaml:"instances"` 表示此字段对应 YAML 文件中的 "instances" 键
+	Instances []AgentInstanceConfig `yaml:"instances"`
+
+	// Routing 按请求的复杂度选择模型：简单的请求使用便宜、快速的模型，复杂任务使用主模型
+	// `yaml:"routing"` 表示此字段对应 YAML 文件中的 "routing" 键
+	Routing RoutingConfig `yaml:"routing"`
+}
+
+// RoutingConfig 包含按复杂度选择模型的配置
+// 附件、超长或多行的消息、代码块、链接和包含关键词的消息视为复杂，其余视为简单
+type RoutingConfig struct {
+	// Model 简单请求使用的模型（例如 "openai/gpt-4o-mini"），为空表示不路由
+	// `yaml:"model"` 表示此字段对应 YAML 文件中的 "model" 键
+	Model string `yaml:"model"`
+
+	// MaxChars 超过多少个字符的消息视为复杂，默认值为 200，负数表示不按长度判断
+	// `yaml:"maxChars"` 表示此字段对应 YAML 文件中的 "maxChars" 键
+	MaxChars int `yaml:"maxChars"`
+
+	// Keywords 包含任一关键词（不区分大小写）的消息视为复杂，不设置时使用内置的任务类关键词
+	// `yaml:"keywords"` 表示此字段对应 YAML 文件中的 "keywords" 键
+	Keywords []string `yaml:"keywords"`
+
+	// Classifier 规则判断为简单的消息，再让简单请求的模型做一次很短的分类调用确认
+	// `yaml:"classifier"` 表示此字段对应 YAML 文件中的 "classifier" 键
+	Classifier bool `yaml:"classifier"`
+}
+
+// DefaultRoutingKeywords 是 agents.routing.keywords 的默认值：出现这些词的请求通常需要多步操作
+var DefaultRoutingKeywords = []string{
+	"plan", "step", "research", "analyze", "analyse", "compare", "schedule", "remind",
+	"write", "create", "build", "fix", "debug", "refactor", "report", "todo",
+	"计划", "步骤", "调研", "分析", "比较", "提醒", "定时", "编写", "创建", "修复", "报告", "待办",
+}
+
+// AgentInstanceConfig 定义一个命名 Agent
+// 未设置的参数（maxTokens、temperature 等）沿用 agents.defaults
+type AgentInstanceConfig struct {
+	// Name Agent 名称，用于 /agent <名称> 切换，不能为 "default"
+	// `yaml:"name"` 表示此字段对应 YAML 文件中的 "name" 键
+	Name string `yaml:"name"`
+
+	// Model 使用的模型，默认与 agents.defaults.model 相同
+	// `yaml:"model"` 表示此字段对应 YAML 文件中的 "model" 键
+	Model string `yaml:"model"`
+
+	// Workspace 工作区路径，默认为 agents.defaults.workspace 加上 "-<名称>"
+	// `yaml:"workspace"` 表示此字段对应 YAML 文件中的 "workspace" 键
+	Workspace string `yaml:"workspace"`
+
+	// SystemPrompt 附加到系统提示词中的角色说明
+	// `yaml:"systemPrompt"` 表示此字段对应 YAML 文件中的 "systemPrompt" 键
+	SystemPrompt string `yaml:"systemPrompt"`
+
+	// Tools 允许使用的工具（支持 * 通配符，例如 "mcp_*"），为空表示全部工具
+	// `yaml:"tools"` 表示此字段对应 YAML 文件中的 "tools" 键
+	Tools []string `yaml:"tools"`
+
+	// Channels 路由到该 Agent 的频道（例如 "telegram"）
+	// `yaml:"channels"` 表示此字段对应 YAML 文件中的 "channels" 键
+	Channels []string `yaml:"channels"`
+
+	// ChatIDs 路由到该 Agent 的聊天，可以写 "123456" 或 "telegram:123456"，优先于 channels
+	// `yaml:"chatIds"` 表示此字段对应 YAML 文件中的 "chatIds" 键
+	ChatIDs []string `yaml:"chatIds"`
 }
 
 // AgentDefaults 包含代理的默认配置参数
@@ -52,6 +539,16 @@ type AgentDefaults struct {
 	// `yaml:"model"` 表示此字段对应 YAML 文件中的 "model" 键
 	Model string `yaml:"model"`
 
+	// Fallbacks 备用模型列表（按顺序尝试），例如 ["anthropic/claude-sonnet-4-5", "openai/gpt-4o-mini"]
+	// 主模型报错、超时或被限流（429）时，同一请求依次改用备用模型
+	// `yaml:"fallbacks"` 表示此字段对应 YAML 文件中的 "fallbacks" 键
+	Fallbacks []string `yaml:"fallbacks"`
+
+	// FallbackTimeout 配置了备用模型时，单次请求等待多少秒后改用下一个模型，0 表示不限制
+	// 最后一个备用模型不受此限制
+	// `yaml:"fallbackTimeout"` 表示此字段对应 YAML 文件中的 "fallbackTimeout" 键
+	FallbackTimeout int `yaml:"fallbackTimeout"`
+
 	// MaxTokens 单次请求的最大 token 数量
 	// 控制生成文本的长度上限，默认值为 8192
 	// `yaml:"maxTokens"` 表示此字段对应 YAML 文件中的 "maxTokens" 键
@@ -71,6 +568,108 @@ type AgentDefaults struct {
 	// 定义代理保留多少条历史消息进行上下文记忆，默认值为 50
 	// `yaml:"memoryWindow"` 表示此字段对应 YAML 文件中的 "memoryWindow" 键
 	MemoryWindow int `yaml:"memoryWindow"`
+
+	// MemoryScope 记忆范围，默认值为 "global"
+	// "global" 所有聊天共用 workspace/memory；"chat" 每个会话使用自己的 workspace/memory/<会话>/，
+	// 避免从一个用户那里记住的信息出现在另一个用户的上下文中
+	// `yaml:"memoryScope"` 表示此字段对应 YAML 文件中的 "memoryScope" 键
+	MemoryScope string `yaml:"memoryScope"`
+
+	// Language 系统生成的文本（/help、错误回复、通知等）使用的语言："auto"（默认）、"en" 或 "zh"
+	// "auto" 根据每个用户的消息检测语言；设置为固定语言时还会要求模型用该语言回复，用户可以用 /language 覆盖
+	// `yaml:"language"` 表示此字段对应 YAML 文件中的 "language" 键
+	Language string `yaml:"language"`
+
+	// SharedMemory memoryScope 为 "chat" 时，是否同时把全局的 memory/MEMORY.md 加载到每个聊天的上下文中（只读）
+	// `yaml:"sharedMemory"` 表示此字段对应 YAML 文件中的 "sharedMemory" 键
+	SharedMemory bool `yaml:"sharedMemory"`
+
+	// SessionIdleMinutes 会话空闲卸载时间（分钟）
+	// 超过该时间未访问的会话会从内存中卸载（已持久化到磁盘，下次访问时重新加载），
+	// 同时清空技能正文缓存，默认值为 30，设置为负数表示禁用
+	// `yaml:"sessionIdleMinutes"` 表示此字段对应 YAML 文件中的 "sessionIdleMinutes" 键
+	SessionIdleMinutes int `yaml:"sessionIdleMinutes"`
+
+	// MaxConcurrentSubagents 同时运行的后台子代理上限，默认值为 4，设置为负数表示不限制
+	// `yaml:"maxConcurrentSubagents"` 表示此字段对应 YAML 文件中的 "maxConcurrentSubagents" 键
+	MaxConcurrentSubagents int `yaml:"maxConcurrentSubagents"`
+
+	// MaxConcurrentSessions 同时处理消息的会话上限，默认值为 4，设置为 1 表示所有消息依次处理，负数表示不限制
+	// 同一会话的消息总是按顺序处理，不同会话的消息并行处理，一个用户的长任务不会阻塞其他用户
+	// `yaml:"maxConcurrentSessions"` 表示此字段对应 YAML 文件中的 "maxConcurrentSessions" 键
+	MaxConcurrentSessions int `yaml:"maxConcurrentSessions"`
+
+	// SubagentTimeout 单个子代理的运行时间上限（秒），超时后停止并通知来源聊天，默认值为 1800，设置为负数表示不限制
+	// `yaml:"subagentTimeout"` 表示此字段对应 YAML 文件中的 "subagentTimeout" 键
+	SubagentTimeout int `yaml:"subagentTimeout"`
+
+	// Reasoning 推理模型（o 系列、DeepSeek R1、Claude 扩展思考）的配置
+	// `yaml:"reasoning"` 表示此字段对应 YAML 文件中的 "reasoning" 键
+	Reasoning ReasoningConfig `yaml:"reasoning"`
+
+	// Consolidation 记忆整理（把旧消息提炼到 MEMORY.md 和 HISTORY.md）的配置
+	// `yaml:"consolidation"` 表示此字段对应 YAML 文件中的 "consolidation" 键
+	Consolidation ConsolidationConfig `yaml:"consolidation"`
+
+	// Timezone 默认时区（IANA 名称，例如 "Asia/Shanghai"），为空表示使用服务器的本地时区
+	// 用于提示词中的当前时间、cron 工具的 "at" 时间和 cron 表达式、摘要任务的生成时间；
+	// 频道提供了用户的时区时使用用户的时区，用户可以用 /timezone 覆盖
+	// `yaml:"timezone"` 表示此字段对应 YAML 文件中的 "timezone" 键
+	Timezone string `yaml:"timezone"`
+}
+
+// ConsolidationConfig 包含记忆整理的配置
+// 默认使用主模型，会话中未整理的消息达到 memoryWindow/2 条时立即在后台整理
+type ConsolidationConfig struct {
+	// Model 记忆整理使用的模型（通常是更便宜、更快的模型），为空表示使用主模型
+	// `yaml:"model"` 表示此字段对应 YAML 文件中的 "model" 键
+	Model string `yaml:"model"`
+
+	// Timeout 单次整理的超时时间（秒），默认值为 120
+	// `yaml:"timeout"` 表示此字段对应 YAML 文件中的 "timeout" 键
+	Timeout int `yaml:"timeout"`
+
+	// Threshold 未整理的消息达到多少条时触发整理，0 表示 memoryWindow/2
+	// `yaml:"threshold"` 表示此字段对应 YAML 文件中的 "threshold" 键
+	Threshold int `yaml:"threshold"`
+
+	// BatchSize 每次交给模型整理的消息条数，0 表示与 threshold 相同
+	// `yaml:"batchSize"` 表示此字段对应 YAML 文件中的 "batchSize" 键
+	BatchSize int `yaml:"batchSize"`
+
+	// KeepRecent 最近的多少条消息不参与整理（仍在对话上下文中），默认值为 0
+	// `yaml:"keepRecent"` 表示此字段对应 YAML 文件中的 "keepRecent" 键
+	KeepRecent int `yaml:"keepRecent"`
+
+	// IdleSeconds 会话空闲多少秒后再整理，0 表示达到阈值后立即整理
+	// 设置后整理不会与正在进行的对话争用模型，空闲时一次整理所有积压的消息
+	// `yaml:"idleSeconds"` 表示此字段对应 YAML 文件中的 "idleSeconds" 键
+	IdleSeconds int `yaml:"idleSeconds"`
+
+	// UserProfile 整理时是否同时学习用户档案（USER.md）："off"（默认）、"confirm" 或 "auto"
+	// "confirm" 把提议的更新发送到聊天，由管理员用 /profile accept 接受；"auto" 直接写入 USER.md
+	// `yaml:"userProfile"` 表示此字段对应 YAML 文件中的 "userProfile" 键
+	UserProfile string `yaml:"userProfile"`
+}
+
+// ReasoningConfig 包含推理模型的配置
+// 模型返回的思考过程（reasoning_content / thinking）默认丢弃，可以记录到日志或在 CLI 中显示
+type ReasoningConfig struct {
+	// Effort 推理强度："low"、"medium" 或 "high"，作为 reasoning_effort 发送给 OpenAI 兼容接口（o 系列模型），为空表示不发送
+	// `yaml:"effort"` 表示此字段对应 YAML 文件中的 "effort" 键
+	Effort string `yaml:"effort"`
+
+	// BudgetTokens Claude 扩展思考的 token 预算（至少 1024），0 表示不开启
+	// `yaml:"budgetTokens"` 表示此字段对应 YAML 文件中的 "budgetTokens" 键
+	BudgetTokens int `yaml:"budgetTokens"`
+
+	// Log 是否把模型的思考过程写入日志
+	// `yaml:"log"` 表示此字段对应 YAML 文件中的 "log" 键
+	Log bool `yaml:"log"`
+
+	// ShowInCLI 是否在 CLI 的回复前显示折叠的思考过程
+	// `yaml:"showInCli"` 表示此字段对应 YAML 文件中的 "showInCli" 键
+	ShowInCLI bool `yaml:"showInCli"`
 }
 
 // ChannelsConfig 包含消息通道的配置
@@ -79,6 +678,187 @@ type ChannelsConfig struct {
 	// Telegram Telegram 消息平台配置
 	// `yaml:"telegram"` 表示此字段对应 YAML 文件中的 "telegram" 键
 	Telegram TelegramConfig `yaml:"telegram"`
+
+	// Discord Discord 消息平台配置
+	// `yaml:"discord"` 表示此字段对应 YAML 文件中的 "discord" 键
+	Discord DiscordConfig `yaml:"discord"`
+
+	// Feishu 飞书（Lark）消息平台配置
+	// `yaml:"feishu"` 表示此字段对应 YAML 文件中的 "feishu" 键
+	Feishu FeishuConfig `yaml:"feishu"`
+
+	// Webhook 入站 Webhook 频道配置（外部系统推送的事件）
+	// `yaml:"webhook"` 表示此字段对应 YAML 文件中的 "webhook" 键
+	Webhook WebhookConfig `yaml:"webhook"`
+
+	// Outbound 出站消息投递配置（每个频道独立的队列、重试和死信）
+	// `yaml:"outbound"` 表示此字段对应 YAML 文件中的 "outbound" 键
+	Outbound OutboundConfig `yaml:"outbound"`
+
+	// Media 用户发送的图片和文件的下载配置（所有频道共用）
+	// `yaml:"media"` 表示此字段对应 YAML 文件中的 "media" 键
+	Media MediaConfig `yaml:"media"`
+}
+
+// DiscordConfig 包含 Discord 机器人的配置
+// 通过斜杠命令（/ask、/new、/task）交互：Discord 把命令以 HTTP 请求发送到
+// gateway 的 /discord/interactions 端点（需要配置 gateway.port，并在 Discord 开发者后台
+// 把 Interactions Endpoint URL 设置为 https://<你的域名>/discord/interactions）
+type DiscordConfig struct {
+	// Enabled 是否启用 Discord 频道
+	// `yaml:"enabled"` 表示此字段对应 YAML 文件中的 "enabled" 键
+	Enabled bool `yaml:"enabled"`
+
+	// Token 机器人令牌（Bot Token），用于发送消息和注册斜杠命令
+	// `yaml:"token"` 表示此字段对应 YAML 文件中的 "token" 键
+	Token string `yaml:"token"`
+
+	// ApplicationID 应用 ID（开发者后台 General Information 页面）
+	// `yaml:"applicationId"` 表示此字段对应 YAML 文件中的 "applicationId" 键
+	ApplicationID string `yaml:"applicationId"`
+
+	// PublicKey 应用公钥（十六进制），用于校验 Discord 发来的请求签名
+	// `yaml:"publicKey"` 表示此字段对应 YAML 文件中的 "publicKey" 键
+	PublicKey string `yaml:"publicKey"`
+
+	// GuildID 只在指定服务器注册斜杠命令（立即生效，便于测试），为空表示注册全局命令
+	// `yaml:"guildId"` 表示此字段对应 YAML 文件中的 "guildId" 键
+	GuildID string `yaml:"guildId"`
+
+	// AllowFrom 允许交互的用户 ID 白名单列表，为空表示不限制
+	// `yaml:"allowFrom"` 表示此字段对应 YAML 文件中的 "allowFrom" 键
+	AllowFrom []string `yaml:"allowFrom"`
+
+	// QuietHours 免打扰时段：定时任务和子代理等后台消息暂存，时段结束后合并为一条发送
+	// `yaml:"quietHours"` 表示此字段对应 YAML 文件中的 "quietHours" 键
+	QuietHours QuietHoursConfig `yaml:"quietHours"`
+}
+
+// FeishuConfig 包含飞书（Lark）自建应用机器人的配置
+// 飞书通过事件订阅把消息以 HTTP 请求发送到 gateway 的 /feishu/events 端点
+// （需要配置 gateway.port，并在开发者后台把请求地址设置为 https://<你的域名>/feishu/events，
+// 订阅 im.message.receive_v1 事件）
+type FeishuConfig struct {
+	// Enabled 是否启用飞书频道
+	// `yaml:"enabled"` 表示此字段对应 YAML 文件中的 "enabled" 键
+	Enabled bool `yaml:"enabled"`
+
+	// AppID 应用凭证中的 App ID
+	// `yaml:"appId"` 表示此字段对应 YAML 文件中的 "appId" 键
+	AppID string `yaml:"appId"`
+
+	// AppSecret 应用凭证中的 App Secret，用于获取 tenant_access_token
+	// `yaml:"appSecret"` 表示此字段对应 YAML 文件中的 "appSecret" 键
+	AppSecret string `yaml:"appSecret"`
+
+	// EncryptKey 事件订阅的 Encrypt Key，配置后事件内容会加密并校验签名，为空表示不加密
+	// `yaml:"encryptKey"` 表示此字段对应 YAML 文件中的 "encryptKey" 键
+	EncryptKey string `yaml:"encryptKey"`
+
+	// VerificationToken 事件订阅的 Verification Token，用于校验事件来源
+	// `yaml:"verificationToken"` 表示此字段对应 YAML 文件中的 "verificationToken" 键
+	VerificationToken string `yaml:"verificationToken"`
+
+	// Domain 开放平台域名："feishu"（默认，open.feishu.cn）或 "lark"（国际版，open.larksuite.com）
+	// `yaml:"domain"` 表示此字段对应 YAML 文件中的 "domain" 键
+	Domain string `yaml:"domain"`
+
+	// Mode 回复模式: "reply"（默认，回复所有消息）或 "observe"（旁听）
+	// 旁听模式下群聊消息只记入会话历史，只有私聊和 @机器人 的消息才会回复
+	// 需要为应用开通"获取群组中所有消息"权限，否则只能收到 @机器人 的消息
+	// `yaml:"mode"` 表示此字段对应 YAML 文件中的 "mode" 键
+	Mode string `yaml:"mode"`
+
+	// AllowFrom 允许交互的用户 open_id 白名单列表，为空表示不限制
+	// `yaml:"allowFrom"` 表示此字段对应 YAML 文件中的 "allowFrom" 键
+	AllowFrom []string `yaml:"allowFrom"`
+
+	// QuietHours 免打扰时段：定时任务和子代理等后台消息暂存，时段结束后合并为一条发送
+	// `yaml:"quietHours"` 表示此字段对应 YAML 文件中的 "quietHours" 键
+	QuietHours QuietHoursConfig `yaml:"quietHours"`
+}
+
+// WebhookConfig 包含入站 Webhook 频道的配置
+// 外部系统（GitHub、Grafana 告警、家庭自动化等）向 gateway 的 POST /hooks/<名称> 推送事件，
+// 事件作为 "webhook" 频道的消息交给 Agent 处理（发送者为 Webhook 名称），Agent 的回复转发到配置的聊天
+type WebhookConfig struct {
+	// Enabled 是否启用 Webhook 频道
+	// `yaml:"enabled"` 表示此字段对应 YAML 文件中的 "enabled" 键
+	Enabled bool `yaml:"enabled"`
+
+	// Hooks 允许的 Webhook 列表，未列出的名称一律拒绝
+	// `yaml:"hooks"` 表示此字段对应 YAML 文件中的 "hooks" 键
+	Hooks []WebhookHookConfig `yaml:"hooks"`
+}
+
+// WebhookHookConfig 定义一个 Webhook
+// Secret 和 Token 至少配置一个，否则该 Webhook 不接受任何请求
+type WebhookHookConfig struct {
+	// Name Webhook 名称，对应 URL 路径 /hooks/<名称>
+	// `yaml:"name"` 表示此字段对应 YAML 文件中的 "name" 键
+	Name string `yaml:"name"`
+
+	// Secret HMAC-SHA256 签名密钥，请求签名（十六进制，可带 "sha256=" 前缀）放在 SignatureHeader 中
+	// `yaml:"secret"` 表示此字段对应 YAML 文件中的 "secret" 键
+	Secret string `yaml:"secret"`
+
+	// SignatureHeader 签名所在的请求头，默认值为 "X-Hub-Signature-256"（GitHub 的格式）
+	// `yaml:"signatureHeader"` 表示此字段对应 YAML 文件中的 "signatureHeader" 键
+	SignatureHeader string `yaml:"signatureHeader"`
+
+	// Token 不支持签名的来源使用的共享令牌，通过 "X-Webhook-Token" 头或 "?token=" 查询参数传递
+	// `yaml:"token"` 表示此字段对应 YAML 文件中的 "token" 键
+	Token string `yaml:"token"`
+
+	// Prompt 附加在事件前面的说明，告诉 Agent 如何处理这类事件
+	// `yaml:"prompt"` 表示此字段对应 YAML 文件中的 "prompt" 键
+	Prompt string `yaml:"prompt"`
+
+	// Channel Agent 回复转发到的频道，默认与 notify.channel 相同
+	// `yaml:"channel"` 表示此字段对应 YAML 文件中的 "channel" 键
+	Channel string `yaml:"channel"`
+
+	// ChatID Agent 回复转发到的聊天 ID，默认与 notify.chatId 相同；为空时回复不转发
+	// `yaml:"chatId"` 表示此字段对应 YAML 文件中的 "chatId" 键
+	ChatID string `yaml:"chatId"`
+
+	// FullTools 处理该 Webhook 的事件时是否可以使用全部工具
+	// 默认为 false：文件系统只读，并且不能使用执行命令的工具（shell、tmux、code_exec、skill_*），
+	// 因为事件内容来自外部，可能包含提示词注入
+	// `yaml:"fullTools"` 表示此字段对应 YAML 文件中的 "fullTools" 键
+	FullTools bool `yaml:"fullTools"`
+}
+
+// OutboundConfig 包含出站消息投递的配置
+// 每个频道有独立的发送队列，发送失败按退避时间重试，最终失败的消息写入工作区的 outbox-failed.jsonl
+type OutboundConfig struct {
+	// QueueSize 每个频道的队列长度，队列满时新消息直接写入死信
+	// `yaml:"queueSize"` 表示此字段对应 YAML 文件中的 "queueSize" 键
+	QueueSize int `yaml:"queueSize"`
+
+	// MaxAttempts 每条消息最多发送次数（含第一次）
+	// `yaml:"maxAttempts"` 表示此字段对应 YAML 文件中的 "maxAttempts" 键
+	MaxAttempts int `yaml:"maxAttempts"`
+
+	// RetryDelay 第一次重试前等待的秒数，之后每次翻倍（最多 60 秒）
+	// `yaml:"retryDelay"` 表示此字段对应 YAML 文件中的 "retryDelay" 键
+	RetryDelay int `yaml:"retryDelay"`
+}
+
+// MediaConfig 包含用户发送的媒体文件的配置
+// 频道把图片和文件下载到工作区的 media/ 目录，通过消息总线传递文件路径（而不是 base64 数据）
+type MediaConfig struct {
+	// MaxSizeMB 单个文件的大小上限（MB），超过的文件不会下载
+	// `yaml:"maxSizeMB"` 表示此字段对应 YAML 文件中的 "maxSizeMB" 键
+	MaxSizeMB int `yaml:"maxSizeMB"`
+
+	// AllowedTypes 允许下载的 MIME 类型（支持前缀，如 "image/"），为空表示不限制
+	// `yaml:"allowedTypes"` 表示此字段对应 YAML 文件中的 "allowedTypes" 键
+	AllowedTypes []string `yaml:"allowedTypes"`
+
+	// RetentionDays 文件保留天数，过期的文件会被自动删除，负数表示永久保留
+	// `yaml:"retentionDays"` 表示此字段对应 YAML 文件中的 "retentionDays" 键
+	RetentionDays int `yaml:"retentionDays"`
 }
 
 // TelegramConfig 包含 Telegram 通道的配置
@@ -100,6 +880,95 @@ type TelegramConfig struct {
 	// ReplyToMessage 是否以回复消息的方式响应
 	// `yaml:"replyToMessage"` 表示此字段对应 YAML 文件中的 "replyToMessage" 键
 	ReplyToMessage bool `yaml:"replyToMessage"`
+
+	// Mode 回复模式: "reply"（默认，回复所有消息）或 "observe"（旁听）
+	// 旁听模式下群聊消息只记入会话历史，只有私聊、@机器人、回复机器人的消息和命令才会回复
+	// 需要在 BotFather 中关闭机器人的 Privacy Mode，否则机器人收不到群里的普通消息
+	// `yaml:"mode"` 表示此字段对应 YAML 文件中的 "mode" 键
+	Mode string `yaml:"mode"`
+
+	// Ack 快速确认配置
+	// 需要调用工具的较慢回合会先发送一条简短确认，再发送完整回复
+	// `yaml:"ack"` 表示此字段对应 YAML 文件中的 "ack" 键
+	Ack AckConfig `yaml:"ack"`
+
+	// Typing 处理消息期间显示"正在输入…"
+	// `yaml:"typing"` 表示此字段对应 YAML 文件中的 "typing" 键
+	Typing bool `yaml:"typing"`
+
+	// ProgressUpdates 模型开始执行待办中的某一步时发送简短的进度提示（例如 "Step 3/5: 生成图片"），
+	// 运行较久的 shell 命令和 web_fetch 下载也会定期报告最新的输出行或下载进度
+	// `yaml:"progressUpdates"` 表示此字段对应 YAML 文件中的 "progressUpdates" 键
+	ProgressUpdates bool `yaml:"progressUpdates"`
+
+	// EditReplies 快速确认、进度提示和最终回复使用同一条消息：先发送确认（或第一条进度提示），
+	// 之后的进度提示和最终回复通过 editMessageText 修改这条消息，减少多分钟任务产生的通知
+	// 编辑消息不会产生新通知，因此最终回复送达时用户不会收到提醒
+	// `yaml:"editReplies"` 表示此字段对应 YAML 文件中的 "editReplies" 键
+	EditReplies bool `yaml:"editReplies"`
+
+	// Reactions 用表情回应用户的消息表示处理状态（开始处理、处理完成）
+	// `yaml:"reactions"` 表示此字段对应 YAML 文件中的 "reactions" 键
+	Reactions ReactionsConfig `yaml:"reactions"`
+
+	// QuietHours 免打扰时段：定时任务和子代理等后台消息暂存，时段结束后合并为一条发送
+	// `yaml:"quietHours"` 表示此字段对应 YAML 文件中的 "quietHours" 键
+	QuietHours QuietHoursConfig `yaml:"quietHours"`
+}
+
+// QuietHoursConfig 包含免打扰时段的配置
+// 时段内定时任务、子代理结果等后台消息不立即发送，时段结束时合并为一条汇总发送；
+// 对用户消息的直接回复不受影响
+type QuietHoursConfig struct {
+	// Enabled 是否启用免打扰时段
+	// `yaml:"enabled"` 表示此字段对应 YAML 文件中的 "enabled" 键
+	Enabled bool `yaml:"enabled"`
+
+	// Start 开始时间（HH:MM，本地时间），默认 "23:00"
+	// `yaml:"start"` 表示此字段对应 YAML 文件中的 "start" 键
+	Start string `yaml:"start"`
+
+	// End 结束时间（HH:MM，本地时间），默认 "07:00"；早于开始时间表示跨过午夜
+	// `yaml:"end"` 表示此字段对应 YAML 文件中的 "end" 键
+	End string `yaml:"end"`
+}
+
+// ReactionsConfig 包含表情回应的配置
+// 比快速确认消息更轻量：不产生额外的消息，只在用户的消息上显示状态
+type ReactionsConfig struct {
+	// Enabled 是否启用表情回应
+	// `yaml:"enabled"` 表示此字段对应 YAML 文件中的 "enabled" 键
+	Enabled bool `yaml:"enabled"`
+
+	// Working 开始处理消息时添加的表情，默认 "👀"
+	// `yaml:"working"` 表示此字段对应 YAML 文件中的 "working" 键
+	Working string `yaml:"working"`
+
+	// Done 处理完成后替换成的表情，默认 "👌"（Telegram 只允许固定的一组表情，不包括 ✅）
+	// `yaml:"done"` 表示此字段对应 YAML 文件中的 "done" 键
+	Done string `yaml:"done"`
+}
+
+// AckConfig 包含"先确认、后回复"两段式响应的配置
+// 当一轮对话需要调用工具时，先告诉用户"已收到、正在处理"
+type AckConfig struct {
+	// Enabled 是否启用快速确认
+	// `yaml:"enabled"` 表示此字段对应 YAML 文件中的 "enabled" 键
+	Enabled bool `yaml:"enabled"`
+
+	// DelaySeconds 收到消息后超过多少秒仍未完成才发送确认
+	// 0 表示模型一开始调用工具就立即发送
+	// `yaml:"delaySeconds"` 表示此字段对应 YAML 文件中的 "delaySeconds" 键
+	DelaySeconds int `yaml:"delaySeconds"`
+
+	// Message 确认消息模板，{tools} 会被替换为正在调用的工具名称
+	// `yaml:"message"` 表示此字段对应 YAML 文件中的 "message" 键
+	Message string `yaml:"message"`
+
+	// UseModelText 模型在调用工具前输出了文字（如"我去查一下日志"）时，优先使用该文字作为确认
+	// 这段文字本来就会生成，不需要额外的 LLM 调用
+	// `yaml:"useModelText"` 表示此字段对应 YAML 文件中的 "useModelText" 键
+	UseModelText bool `yaml:"useModelText"`
 }
 
 // ProvidersConfig 包含官方 LLM 提供商配置。
@@ -112,6 +981,75 @@ type ProvidersConfig struct {
 	// OpenAI OpenAI (GPT) 提供商配置
 	// `yaml:"openai"` 表示此字段对应 YAML 文件中的 "openai" 键
 	OpenAI ProviderConfig `yaml:"openai"`
+
+	// Transcription 语音转写（STT）提供商配置
+	// 用于把频道收到的语音消息转写为文字
+	// `yaml:"transcription"` 表示此字段对应 YAML 文件中的 "transcription" 键
+	Transcription TranscriptionConfig `yaml:"transcription"`
+
+	// Embeddings 文本向量（Embedding）提供商配置，与对话模型分开配置
+	// 用于向量记忆、语义检索历史等功能
+	// `yaml:"embeddings"` 表示此字段对应 YAML 文件中的 "embeddings" 键
+	Embeddings EmbeddingsConfig `yaml:"embeddings"`
+}
+
+// EmbeddingsConfig 包含文本向量的配置
+// 支持 OpenAI 兼容的接口（OpenAI、LM Studio、vLLM 等）和 Ollama
+type EmbeddingsConfig struct {
+	// Provider 向量提供商："openai"（OpenAI 兼容接口）或 "ollama"，留空表示禁用
+	// `yaml:"provider"` 表示此字段对应 YAML 文件中的 "provider" 键
+	Provider string `yaml:"provider"`
+
+	// Model 向量模型，openai 默认 "text-embedding-3-small"，ollama 默认 "nomic-embed-text"
+	// `yaml:"model"` 表示此字段对应 YAML 文件中的 "model" 键
+	Model string `yaml:"model"`
+
+	// APIKey API 密钥，openai 留空时复用 providers.openai 的 apiKey 和 apiBase
+	// `yaml:"apiKey"` 表示此字段对应 YAML 文件中的 "apiKey" 键
+	APIKey string `yaml:"apiKey"`
+
+	// APIBase 接口地址，openai 兼容服务填写其 /v1 地址，ollama 默认 "http://localhost:11434"
+	// `yaml:"apiBase"` 表示此字段对应 YAML 文件中的 "apiBase" 键
+	APIBase string `yaml:"apiBase"`
+
+	// Dimensions 向量维度，仅 OpenAI text-embedding-3 系列模型支持，0 表示使用模型默认值
+	// `yaml:"dimensions"` 表示此字段对应 YAML 文件中的 "dimensions" 键
+	Dimensions int `yaml:"dimensions"`
+
+	// BatchSize 每次请求最多发送的文本条数，默认值为 64
+	// `yaml:"batchSize"` 表示此字段对应 YAML 文件中的 "batchSize" 键
+	BatchSize int `yaml:"batchSize"`
+
+	// Timeout 单次请求的超时时间（秒），默认值为 60
+	// `yaml:"timeout"` 表示此字段对应 YAML 文件中的 "timeout" 键
+	Timeout int `yaml:"timeout"`
+}
+
+// TranscriptionConfig 包含语音转写的配置
+// 支持 OpenAI Whisper API 和本地命令（如 whisper.cpp）两种方式
+type TranscriptionConfig struct {
+	// Provider 转写提供商："openai"（Whisper API）或 "command"（本地命令），留空表示禁用
+	// "openai" 复用 providers.openai 的 apiKey 和 apiBase
+	// `yaml:"provider"` 表示此字段对应 YAML 文件中的 "provider" 键
+	Provider string `yaml:"provider"`
+
+	// Model 转写模型，仅 openai 使用，默认值为 "whisper-1"
+	// `yaml:"model"` 表示此字段对应 YAML 文件中的 "model" 键
+	Model string `yaml:"model"`
+
+	// Language 音频语言（ISO-639-1，如 "zh"、"en"），留空表示自动识别
+	// `yaml:"language"` 表示此字段对应 YAML 文件中的 "language" 键
+	Language string `yaml:"language"`
+
+	// Command 本地转写命令，仅 command 使用，通过 /bin/sh -c 执行（Windows 上通过 cmd /C 执行）
+	// {file} 会被替换为下载的音频文件路径，命令的标准输出即为转写结果
+	// 例如："ffmpeg -loglevel error -y -i {file} -ar 16000 -ac 1 {file}.wav && whisper-cli -m ~/models/ggml-base.bin -nt -np -f {file}.wav"
+	// `yaml:"command"` 表示此字段对应 YAML 文件中的 "command" 键
+	Command string `yaml:"command"`
+
+	// Timeout 单次转写的超时时间（秒），默认值为 120
+	// `yaml:"timeout"` 表示此字段对应 YAML 文件中的 "timeout" 键
+	Timeout int `yaml:"timeout"`
 }
 
 // ProviderConfig 包含单个 LLM 提供商的具体配置信息
@@ -139,15 +1077,206 @@ type ToolsConfig struct {
 	// `yaml:"exec"` 表示此字段对应 YAML 文件中的 "exec" 键
 	Exec ExecToolConfig `yaml:"exec"`
 
+	// Email 邮件工具（send_email、search_email）配置
+	// `yaml:"email"` 表示此字段对应 YAML 文件中的 "email" 键
+	Email EmailConfig `yaml:"email"`
+
 	// RestrictToWorkspace 是否将文件操作限制在工作空间内
 	// 为 true 时，机器人只能访问和修改工作空间内的文件
 	// `yaml:"restrictToWorkspace"` 表示此字段对应 YAML 文件中的 "restrictToWorkspace" 键
 	RestrictToWorkspace bool `yaml:"restrictToWorkspace"`
 
+	// AllowedPaths 限制在工作区内时，额外允许文件工具访问的目录（默认只读）
+	// `yaml:"allowedPaths"` 表示此字段对应 YAML 文件中的 "allowedPaths" 键
+	AllowedPaths []AllowedPathConfig `yaml:"allowedPaths"`
+
 	// MCPServers MCP（Model Context Protocol）服务器配置
 	// 键为服务器名称，值为对应的配置
 	// `yaml:"mcpServers"` 表示此字段对应 YAML 文件中的 "mcpServers" 键
 	MCPServers map[string]MCPServerConfig `yaml:"mcpServers"`
+
+	// Overrides 工具描述覆盖配置
+	// 键为工具名称（包括 MCP 工具），用于在不重新编译的情况下调整工具描述、参数提示和使用示例
+	// `yaml:"overrides"` 表示此字段对应 YAML 文件中的 "overrides" 键
+	Overrides map[string]ToolOverrideConfig `yaml:"overrides"`
+
+	// Policies 工具权限策略，按顺序匹配，第一条命中的规则生效
+	// 没有规则命中的工具调用自动执行
+	// `yaml:"policies"` 表示此字段对应 YAML 文件中的 "policies" 键
+	Policies []ToolPolicyConfig `yaml:"policies"`
+
+	// Scopes 按频道和聊天限制可以使用的工具，所有命中的规则同时生效
+	// 受限的工具不会出现在发给模型的工具列表中（与 policies 的 deny 不同，模型根本看不到这些工具）
+	// `yaml:"scopes"` 表示此字段对应 YAML 文件中的 "scopes" 键
+	Scopes []ToolScopeConfig `yaml:"scopes"`
+
+	// ApprovalTimeout 等待用户确认的超时时间（秒），超时视为拒绝，默认值为 300
+	// `yaml:"approvalTimeout"` 表示此字段对应 YAML 文件中的 "approvalTimeout" 键
+	ApprovalTimeout int `yaml:"approvalTimeout"`
+
+	// Audit 工具调用审计日志配置
+	// `yaml:"audit"` 表示此字段对应 YAML 文件中的 "audit" 键
+	Audit AuditConfig `yaml:"audit"`
+
+	// MaxResultChars 单次工具结果放入上下文的最大字符数，默认值为 20000，负数表示不限制
+	// 超出时完整结果保存到 workspace/artifacts/tool-results，上下文中只保留开头和结尾的片段和文件路径
+	// `yaml:"maxResultChars"` 表示此字段对应 YAML 文件中的 "maxResultChars" 键
+	MaxResultChars int `yaml:"maxResultChars"`
+}
+
+// AuditConfig 包含工具调用审计日志的配置
+// 启用后每次工具调用都会记录到 workspace/audit/audit-YYYY-MM-DD.jsonl，可用 /audit 或 nanogrip audit 查看
+type AuditConfig struct {
+	// Enabled 是否启用审计日志
+	// `yaml:"enabled"` 表示此字段对应 YAML 文件中的 "enabled" 键
+	Enabled bool `yaml:"enabled"`
+
+	// RetentionDays 日志保留天数，过期的文件会被自动删除，默认值为 90，负数表示永久保留
+	// `yaml:"retentionDays"` 表示此字段对应 YAML 文件中的 "retentionDays" 键
+	RetentionDays int `yaml:"retentionDays"`
+}
+
+// AllowedPathConfig 描述一个额外允许文件工具访问的目录
+type AllowedPathConfig struct {
+	// Path 目录路径（支持 ~/ 开头）
+	// `yaml:"path"` 表示此字段对应 YAML 文件中的 "path" 键
+	Path string `yaml:"path"`
+
+	// Write 是否允许写入和删除，默认只读
+	// `yaml:"write"` 表示此字段对应 YAML 文件中的 "write" 键
+	Write bool `yaml:"write"`
+}
+
+// EmailConfig 包含邮件服务器的配置
+// SMTP 用于发送邮件（send_email 工具），IMAP 用于搜索和阅读邮件（search_email 工具），
+// 各自只有配置了 Host 时才注册对应的工具
+type EmailConfig struct {
+	// SMTP 发信服务器配置
+	// `yaml:"smtp"` 表示此字段对应 YAML 文件中的 "smtp" 键
+	SMTP SMTPConfig `yaml:"smtp"`
+
+	// IMAP 收信服务器配置
+	// `yaml:"imap"` 表示此字段对应 YAML 文件中的 "imap" 键
+	IMAP IMAPConfig `yaml:"imap"`
+
+	// AllowRecipients 允许的收件人地址或域名（域名同时匹配子域名），"*" 表示不限制
+	// 为空时只能发给自己（发件人地址）
+	// `yaml:"allowRecipients"` 表示此字段对应 YAML 文件中的 "allowRecipients" 键
+	AllowRecipients []string `yaml:"allowRecipients"`
+}
+
+// SMTPConfig 包含 SMTP 服务器的连接信息
+type SMTPConfig struct {
+	// Host 服务器地址，例如 smtp.gmail.com
+	// `yaml:"host"` 表示此字段对应 YAML 文件中的 "host" 键
+	Host string `yaml:"host"`
+
+	// Port 端口，465 使用隐式 TLS，其他端口使用 STARTTLS，默认值为 587
+	// `yaml:"port"` 表示此字段对应 YAML 文件中的 "port" 键
+	Port int `yaml:"port"`
+
+	// Username 登录用户名
+	// `yaml:"username"` 表示此字段对应 YAML 文件中的 "username" 键
+	Username string `yaml:"username"`
+
+	// Password 登录密码（建议使用应用专用密码）
+	// `yaml:"password"` 表示此字段对应 YAML 文件中的 "password" 键
+	Password string `yaml:"password"`
+
+	// From 发件人地址，为空时使用 Username
+	// `yaml:"from"` 表示此字段对应 YAML 文件中的 "from" 键
+	From string `yaml:"from"`
+}
+
+// IMAPConfig 包含 IMAP 服务器的连接信息
+type IMAPConfig struct {
+	// Host 服务器地址，例如 imap.gmail.com
+	// `yaml:"host"` 表示此字段对应 YAML 文件中的 "host" 键
+	Host string `yaml:"host"`
+
+	// Port 端口，993 使用隐式 TLS，其他端口使用 STARTTLS，默认值为 993
+	// `yaml:"port"` 表示此字段对应 YAML 文件中的 "port" 键
+	Port int `yaml:"port"`
+
+	// Username 登录用户名，为空时使用 SMTP 的用户名
+	// `yaml:"username"` 表示此字段对应 YAML 文件中的 "username" 键
+	Username string `yaml:"username"`
+
+	// Password 登录密码，为空时使用 SMTP 的密码
+	// `yaml:"password"` 表示此字段对应 YAML 文件中的 "password" 键
+	Password string `yaml:"password"`
+
+	// Mailbox 默认搜索的邮箱文件夹，默认值为 INBOX
+	// `yaml:"mailbox"` 表示此字段对应 YAML 文件中的 "mailbox" 键
+	Mailbox string `yaml:"mailbox"`
+}
+
+// ToolPolicyConfig 包含一条工具权限规则
+// 所有非空条件都满足时规则才会命中
+type ToolPolicyConfig struct {
+	// Tool 工具名称，"*" 表示所有工具
+	// `yaml:"tool"` 表示此字段对应 YAML 文件中的 "tool" 键
+	Tool string `yaml:"tool"`
+
+	// Action 处理方式："auto"（自动执行）、"confirm"（需要用户确认）、"deny"（禁止）
+	// `yaml:"action"` 表示此字段对应 YAML 文件中的 "action" 键
+	Action string `yaml:"action"`
+
+	// Channels 限定频道，为空表示所有频道
+	// `yaml:"channels"` 表示此字段对应 YAML 文件中的 "channels" 键
+	Channels []string `yaml:"channels"`
+
+	// Users 限定用户 ID 或用户名，为空表示所有用户
+	// `yaml:"users"` 表示此字段对应 YAML 文件中的 "users" 键
+	Users []string `yaml:"users"`
+
+	// Params 参数匹配，键为参数名，值为正则表达式
+	// 例如 {command: "\\brm\\b"} 只匹配包含 rm 的 shell 命令
+	// `yaml:"params"` 表示此字段对应 YAML 文件中的 "params" 键
+	Params map[string]string `yaml:"params"`
+}
+
+// ToolScopeConfig 定义一条按频道和聊天限制工具的规则
+type ToolScopeConfig struct {
+	// Channels 限定频道，为空表示所有频道
+	// `yaml:"channels"` 表示此字段对应 YAML 文件中的 "channels" 键
+	Channels []string `yaml:"channels"`
+
+	// Chats 限定聊天 ID，支持 * 通配符（例如 Telegram 群组的 "-*"），为空表示所有聊天
+	// `yaml:"chats"` 表示此字段对应 YAML 文件中的 "chats" 键
+	Chats []string `yaml:"chats"`
+
+	// Allow 只提供这些工具（支持 * 通配符），为空表示不限制
+	// `yaml:"allow"` 表示此字段对应 YAML 文件中的 "allow" 键
+	Allow []string `yaml:"allow"`
+
+	// Deny 不提供这些工具（支持 * 通配符），优先于 allow
+	// `yaml:"deny"` 表示此字段对应 YAML 文件中的 "deny" 键
+	Deny []string `yaml:"deny"`
+
+	// ReadOnly 文件系统只读（禁止写入、删除和修改文件，也不提供 shell 等执行命令的工具）
+	// `yaml:"readOnly"` 表示此字段对应 YAML 文件中的 "readOnly" 键
+	ReadOnly bool `yaml:"readOnly"`
+
+	// NoShell 不提供执行命令的工具（shell、tmux、code_exec 和技能命令 skill_*）
+	// `yaml:"noShell"` 表示此字段对应 YAML 文件中的 "noShell" 键
+	NoShell bool `yaml:"noShell"`
+}
+
+// ToolOverrideConfig 包含单个工具的描述覆盖配置
+// 某些模型对内置工具描述理解不佳时，可以通过此配置改写描述或补充示例
+type ToolOverrideConfig struct {
+	// Description 替换工具的描述，留空表示保留原描述
+	// `yaml:"description"` 表示此字段对应 YAML 文件中的 "description" 键
+	Description string `yaml:"description"`
+
+	// ParameterHints 参数提示，键为参数名，值会追加到该参数的描述后面
+	// `yaml:"parameterHints"` 表示此字段对应 YAML 文件中的 "parameterHints" 键
+	ParameterHints map[string]string `yaml:"parameterHints"`
+
+	// Examples 使用示例（few-shot），会以列表形式追加到工具描述末尾
+	// `yaml:"examples"` 表示此字段对应 YAML 文件中的 "examples" 键
+	Examples []string `yaml:"examples"`
 }
 
 // WebToolsConfig 包含网络工具的配置
@@ -156,6 +1285,54 @@ type WebToolsConfig struct {
 	// Search 网络搜索配置
 	// `yaml:"search"` 表示此字段对应 YAML 文件中的 "search" 键
 	Search WebSearchConfig `yaml:"search"`
+
+	// Fetch 网页抓取配置
+	// `yaml:"fetch"` 表示此字段对应 YAML 文件中的 "fetch" 键
+	Fetch WebFetchConfig `yaml:"fetch"`
+
+	// HTTP 通用 HTTP 请求（http_request 工具）配置
+	// `yaml:"http"` 表示此字段对应 YAML 文件中的 "http" 键
+	HTTP WebHTTPConfig `yaml:"http"`
+}
+
+// WebHTTPConfig 包含通用 HTTP 请求（http_request 工具）的配置
+// 只有 AllowDomains 非空时才注册 http_request 工具
+type WebHTTPConfig struct {
+	// AllowDomains 允许访问的域名，同时匹配其子域名，也可以写 "主机:端口"；"*" 表示允许所有域名
+	// `yaml:"allowDomains"` 表示此字段对应 YAML 文件中的 "allowDomains" 键
+	AllowDomains []string `yaml:"allowDomains"`
+
+	// DenyDomains 禁止访问的域名，优先于 AllowDomains
+	// `yaml:"denyDomains"` 表示此字段对应 YAML 文件中的 "denyDomains" 键
+	DenyDomains []string `yaml:"denyDomains"`
+
+	// Headers 按域名自动添加的请求头（例如 API 令牌），值中的 ${VAR} 会替换为环境变量
+	// 模型看不到这些请求头的值
+	// `yaml:"headers"` 表示此字段对应 YAML 文件中的 "headers" 键
+	Headers map[string]map[string]string `yaml:"headers"`
+
+	// Timeout 请求超时时间（秒）
+	// `yaml:"timeout"` 表示此字段对应 YAML 文件中的 "timeout" 键
+	Timeout int `yaml:"timeout"`
+
+	// MaxChars 返回给模型的响应正文的最大字符数
+	// `yaml:"maxChars"` 表示此字段对应 YAML 文件中的 "maxChars" 键
+	MaxChars int `yaml:"maxChars"`
+}
+
+// WebFetchConfig 包含网页抓取（web_fetch 工具）的配置
+type WebFetchConfig struct {
+	// Timeout 请求超时时间（秒）
+	// `yaml:"timeout"` 表示此字段对应 YAML 文件中的 "timeout" 键
+	Timeout int `yaml:"timeout"`
+
+	// MaxBytes 最多下载的字节数
+	// `yaml:"maxBytes"` 表示此字段对应 YAML 文件中的 "maxBytes" 键
+	MaxBytes int `yaml:"maxBytes"`
+
+	// MaxChars 默认返回给模型的最大字符数
+	// `yaml:"maxChars"` 表示此字段对应 YAML 文件中的 "maxChars" 键
+	MaxChars int `yaml:"maxChars"`
 }
 
 // WebSearchConfig 包含网络搜索的配置信息
@@ -165,13 +1342,26 @@ type WebSearchConfig struct {
 	// `yaml:"apiKey"` 表示此字段对应 YAML 文件中的 "apiKey" 键
 	APIKey string `yaml:"apiKey"`
 
-	// Provider 搜索提供商 (brave 或 tavily)
+	// Provider 搜索提供商 (tavily、brave、searxng、google 或 duckduckgo)
 	// `yaml:"provider"` 表示此字段对应 YAML 文件中的 "provider" 键
 	Provider string `yaml:"provider"`
 
 	// MaxResults 搜索返回的最大结果数
 	// `yaml:"maxResults"` 表示此字段对应 YAML 文件中的 "maxResults" 键
 	MaxResults int `yaml:"maxResults"`
+
+	// BaseURL SearXNG 实例地址，例如 http://localhost:8888
+	// `yaml:"baseUrl"` 表示此字段对应 YAML 文件中的 "baseUrl" 键
+	BaseURL string `yaml:"baseUrl"`
+
+	// CX Google Custom Search 的搜索引擎 ID
+	// `yaml:"cx"` 表示此字段对应 YAML 文件中的 "cx" 键
+	CX string `yaml:"cx"`
+
+	// Fallback 主提供商未配置或请求失败时使用的备用提供商
+	// 目前支持 "duckduckgo"（无需 API Key），设为 "none" 关闭
+	// `yaml:"fallback"` 表示此字段对应 YAML 文件中的 "fallback" 键
+	Fallback string `yaml:"fallback"`
 }
 
 // ExecToolConfig 包含 Shell 命令执行的配置
@@ -181,6 +1371,55 @@ type ExecToolConfig struct {
 	// 防止命令执行时间过长导致系统资源占用
 	// `yaml:"timeout"` 表示此字段对应 YAML 文件中的 "timeout" 键
 	Timeout int `yaml:"timeout"`
+
+	// Shell 执行命令的 shell: "sh"、"bash"、"powershell"、"pwsh"、"cmd"
+	// 为空（或 "auto"）时自动选择：Windows 上使用 pwsh（未安装时使用 powershell），其他系统使用 sh
+	// 启用沙箱时沙箱内始终使用 sh
+	// `yaml:"shell"` 表示此字段对应 YAML 文件中的 "shell" 键
+	Shell string `yaml:"shell"`
+
+	// Sandbox 命令执行沙箱: "none"（默认，直接在主机执行）、"bwrap"（bubblewrap）、"docker"
+	// 沙箱中根文件系统只读，只有工作空间可写
+	// `yaml:"sandbox"` 表示此字段对应 YAML 文件中的 "sandbox" 键
+	Sandbox string `yaml:"sandbox"`
+
+	// SandboxImage docker 沙箱使用的镜像
+	// `yaml:"sandboxImage"` 表示此字段对应 YAML 文件中的 "sandboxImage" 键
+	SandboxImage string `yaml:"sandboxImage"`
+
+	// CPUs 沙箱可用的 CPU 数量（docker 为 --cpus；bwrap 无法限制核数，改为按超时时间限制 CPU 秒数）
+	// `yaml:"cpus"` 表示此字段对应 YAML 文件中的 "cpus" 键
+	CPUs float64 `yaml:"cpus"`
+
+	// MemoryMB 沙箱可用的内存上限（MB），0 表示不限制
+	// `yaml:"memoryMB"` 表示此字段对应 YAML 文件中的 "memoryMB" 键
+	MemoryMB int `yaml:"memoryMB"`
+
+	// Network 沙箱中是否允许访问网络
+	// `yaml:"network"` 表示此字段对应 YAML 文件中的 "network" 键
+	Network bool `yaml:"network"`
+
+	// DenyCommands 额外禁止执行的命令（正则表达式），与内置黑名单（rm -rf /、mkfs、curl | sh 等）一起生效
+	// `yaml:"denyCommands"` 表示此字段对应 YAML 文件中的 "denyCommands" 键
+	DenyCommands []string `yaml:"denyCommands"`
+
+	// AllowCommands 允许执行的程序名（支持 * 通配符），配置后进入严格模式：命令中每一段的程序都必须在列表中
+	// 严格模式下不允许命令替换和进程替换，eval、exec 只有逐字列出时才允许
+	// `yaml:"allowCommands"` 表示此字段对应 YAML 文件中的 "allowCommands" 键
+	AllowCommands []string `yaml:"allowCommands"`
+
+	// ScrubEnv 额外从命令环境中去除的环境变量名（glob 模式）
+	// 默认已去除 *API_KEY*、*_TOKEN、*SECRET*、*PASSWORD* 等，以及值等于配置中密钥的变量
+	// `yaml:"scrubEnv"` 表示此字段对应 YAML 文件中的 "scrubEnv" 键
+	ScrubEnv []string `yaml:"scrubEnv"`
+
+	// InputTimeout interactive 模式的命令等待用户答复的超时时间（秒），超时后关闭命令的标准输入，默认值为 300
+	// `yaml:"inputTimeout"` 表示此字段对应 YAML 文件中的 "inputTimeout" 键
+	InputTimeout int `yaml:"inputTimeout"`
+
+	// Python code_exec 工具创建虚拟环境（workspace/.venv）使用的 Python 解释器，默认 python3（Windows 上为 python）
+	// `yaml:"python"` 表示此字段对应 YAML 文件中的 "python" 键
+	Python string `yaml:"python"`
 }
 
 // MCPServerConfig 包含 MCP 服务器的配置
@@ -222,31 +1461,45 @@ type MCPServerConfig struct {
 //
 // 功能说明:
 //  1. 自动展开路径中的 "~/" 为用户主目录
-//  2. 读取 YAML 配置文件
-//  3. 解析 YAML 内容到 Config 结构体
+//  2. 读取 YAML 配置文件；文件不存在但设置了 NANOGRIP_* 环境变量时只使用环境变量（见 envconfig.go）
+//  3. 解析 YAML 内容到 Config 结构体，NANOGRIP_* 环境变量覆盖文件中的值
 //  4. 为未设置的字段填充默认值
 func Load(path string) (*Config, error) {
-	// 尝试展开用户主目录
-	// 如果路径以 "~/" 开头，将其替换为实际的用户主目录路径
-	if len(path) >= 2 && path[0:2] == "~/" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return nil, err
-		}
-		path = filepath.Join(home, path[2:])
+	// 尝试展开用户主目录（"~/" 或 Windows 风格的 "~\"）
+	path = paths.ExpandHome(path)
+
+	// 加载配置文件同目录下的 .env（不覆盖已存在的环境变量）
+	if err := loadDotEnv(filepath.Join(filepath.Dir(path), ".env")); err != nil {
+		return nil, err
 	}
 
 	// 读取配置文件内容
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		if !os.IsNotExist(err) || !HasEnvConfig() {
+			return nil, err
+		}
+		log.Printf("[Config] %s 不存在，使用 %s* 环境变量中的配置", path, EnvPrefix)
 	}
 
-	// 解析 YAML 配置文件
+	// 解析 YAML 配置文件，并展开 ${VAR} 和 !env VAR 形式的环境变量引用
 	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	var unknown []string
+	decrypt := configDecrypter(filepath.Dir(path))
+	missing, err := unmarshalWithEnv(data, &cfg, decrypt, func(root *yaml.Node) error {
+		unknown, err = applyEnvConfig(root, decrypt)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		log.Printf("[Config] 警告: 以下环境变量未设置，已替换为空值: %s", strings.Join(missing, ", "))
+	}
+	if len(unknown) > 0 {
+		log.Printf("[Config] 警告: 以下环境变量无法对应到配置项，已忽略: %s", strings.Join(unknown, ", "))
+	}
 
 	// 设置默认值
 	// 如果配置文件中没有指定某些字段，则使用这些默认值
@@ -275,19 +1528,262 @@ func Load(path string) (*Config, error) {
 	if cfg.Agents.Defaults.MemoryWindow == 0 {
 		cfg.Agents.Defaults.MemoryWindow = 50
 	}
+	// 默认记忆整理超时时间
+	if cfg.Agents.Defaults.Consolidation.Timeout == 0 {
+		cfg.Agents.Defaults.Consolidation.Timeout = 120
+	}
+	if cfg.Agents.Defaults.Consolidation.UserProfile == "" {
+		cfg.Agents.Defaults.Consolidation.UserProfile = "off"
+	}
+	// 默认的模型路由阈值和关键词
+	if cfg.Agents.Routing.MaxChars == 0 {
+		cfg.Agents.Routing.MaxChars = 200
+	}
+	if cfg.Agents.Routing.Keywords == nil {
+		cfg.Agents.Routing.Keywords = DefaultRoutingKeywords
+	}
+	// 默认根据用户的消息检测语言
+	if cfg.Agents.Defaults.Language == "" {
+		cfg.Agents.Defaults.Language = "auto"
+	}
+	// 默认所有聊天共用一份记忆
+	if cfg.Agents.Defaults.MemoryScope == "" {
+		cfg.Agents.Defaults.MemoryScope = "global"
+	}
+	// 默认会话空闲卸载时间
+	if cfg.Agents.Defaults.SessionIdleMinutes == 0 {
+		cfg.Agents.Defaults.SessionIdleMinutes = 30
+	}
+	// 默认子代理并发数和超时时间
+	if cfg.Agents.Defaults.MaxConcurrentSubagents == 0 {
+		cfg.Agents.Defaults.MaxConcurrentSubagents = 4
+	}
+	if cfg.Agents.Defaults.SubagentTimeout == 0 {
+		cfg.Agents.Defaults.SubagentTimeout = 1800
+	}
+	// 默认追踪服务名称
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "nanogrip"
+	}
+	// 默认会话并发数
+	if cfg.Agents.Defaults.MaxConcurrentSessions == 0 {
+		cfg.Agents.Defaults.MaxConcurrentSessions = 4
+	}
+	// 默认出站投递配置
+	if cfg.Channels.Outbound.QueueSize == 0 {
+		cfg.Channels.Outbound.QueueSize = 1000
+	}
+	if cfg.Channels.Outbound.MaxAttempts == 0 {
+		cfg.Channels.Outbound.MaxAttempts = 3
+	}
+	if cfg.Channels.Outbound.RetryDelay == 0 {
+		cfg.Channels.Outbound.RetryDelay = 2
+	}
+	// 默认快速确认消息
+	if cfg.Channels.Telegram.Ack.Message == "" {
+		cfg.Channels.Telegram.Ack.Message = "⏳ On it — working on {tools}…"
+	}
+	// 默认表情回应
+	if cfg.Channels.Telegram.Reactions.Working == "" {
+		cfg.Channels.Telegram.Reactions.Working = "👀"
+	}
+	if cfg.Channels.Telegram.Reactions.Done == "" {
+		cfg.Channels.Telegram.Reactions.Done = "👌"
+	}
+	if cfg.Channels.Feishu.Domain == "" {
+		cfg.Channels.Feishu.Domain = "feishu"
+	}
+	if cfg.Channels.Media.MaxSizeMB == 0 {
+		cfg.Channels.Media.MaxSizeMB = 20
+	}
+	if cfg.Channels.Media.RetentionDays == 0 {
+		cfg.Channels.Media.RetentionDays = 7
+	}
+	if cfg.Providers.Transcription.Model == "" {
+		cfg.Providers.Transcription.Model = "whisper-1"
+	}
+	if cfg.Providers.Transcription.Timeout == 0 {
+		cfg.Providers.Transcription.Timeout = 120
+	}
+	if cfg.Providers.Embeddings.BatchSize == 0 {
+		cfg.Providers.Embeddings.BatchSize = 64
+	}
+	if cfg.Providers.Embeddings.Timeout == 0 {
+		cfg.Providers.Embeddings.Timeout = 60
+	}
+	if cfg.Tools.ApprovalTimeout == 0 {
+		cfg.Tools.ApprovalTimeout = 300
+	}
+	if cfg.Tools.MaxResultChars == 0 {
+		cfg.Tools.MaxResultChars = 20000
+	}
+	if cfg.Tools.Audit.RetentionDays == 0 {
+		cfg.Tools.Audit.RetentionDays = 90
+	}
+	if cfg.Gateway.Host == "" {
+		cfg.Gateway.Host = "127.0.0.1"
+	}
+	if cfg.Gateway.Calendar.Days == 0 {
+		cfg.Gateway.Calendar.Days = 14
+	}
+	if cfg.Gateway.Calendar.MaxPerJob == 0 {
+		cfg.Gateway.Calendar.MaxPerJob = 50
+	}
 	if cfg.Tools.Exec.Timeout == 0 {
 		cfg.Tools.Exec.Timeout = 60
 	}
+	if cfg.Tools.Exec.InputTimeout == 0 {
+		cfg.Tools.Exec.InputTimeout = 300
+	}
+	if cfg.Tools.Exec.Sandbox == "" {
+		cfg.Tools.Exec.Sandbox = "none"
+	}
+	if cfg.Tools.Exec.SandboxImage == "" {
+		cfg.Tools.Exec.SandboxImage = "debian:stable-slim"
+	}
 	if cfg.Tools.Web.Search.Provider == "" {
 		cfg.Tools.Web.Search.Provider = "tavily"
 	}
 	if cfg.Tools.Web.Search.MaxResults == 0 {
 		cfg.Tools.Web.Search.MaxResults = 5
 	}
+	if cfg.ReloadInterval == 0 {
+		cfg.ReloadInterval = 2
+	}
+	for i := range cfg.Cron.Jobs {
+		if cfg.Cron.Jobs[i].Channel == "" {
+			cfg.Cron.Jobs[i].Channel = "telegram"
+		}
+	}
+	if cfg.Notify.Channel == "" {
+		cfg.Notify.Channel = "telegram"
+	}
+	if cfg.Notify.CrashLoopThreshold == 0 {
+		cfg.Notify.CrashLoopThreshold = 3
+	}
+	if cfg.Backup.Keep == 0 {
+		cfg.Backup.Keep = 7
+	}
+	// 默认每个任务保留最近 20 条执行记录
+	if cfg.Cron.History == 0 {
+		cfg.Cron.History = 20
+	}
+	// 默认每天晚上生成摘要，发送给主人
+	if cfg.Cron.Digest.Period == "" {
+		cfg.Cron.Digest.Period = "daily"
+	}
+	if cfg.Cron.Digest.Cron == "" {
+		cfg.Cron.Digest.Cron = "0 21 * * *"
+		if cfg.Cron.Digest.Period == "weekly" {
+			cfg.Cron.Digest.Cron = "0 18 * * 0"
+		}
+	}
+	if cfg.Cron.Digest.Channel == "" {
+		cfg.Cron.Digest.Channel = cfg.Notify.Channel
+	}
+	if cfg.Cron.Digest.To == "" && cfg.Cron.Digest.Channel == cfg.Notify.Channel {
+		cfg.Cron.Digest.To = cfg.Notify.ChatID
+	}
+	// Webhook 默认使用 GitHub 的签名头，回复转发给主人
+	for i := range cfg.Channels.Webhook.Hooks {
+		hook := &cfg.Channels.Webhook.Hooks[i]
+		if hook.SignatureHeader == "" {
+			hook.SignatureHeader = "X-Hub-Signature-256"
+		}
+		if hook.Channel == "" {
+			hook.Channel = cfg.Notify.Channel
+		}
+		if hook.ChatID == "" && hook.Channel == cfg.Notify.Channel {
+			hook.ChatID = cfg.Notify.ChatID
+		}
+	}
+	// 免打扰时段默认 23:00 到次日 07:00
+	for _, quiet := range []*QuietHoursConfig{&cfg.Channels.Telegram.QuietHours, &cfg.Channels.Discord.QuietHours, &cfg.Channels.Feishu.QuietHours} {
+		if quiet.Start == "" {
+			quiet.Start = "23:00"
+		}
+		if quiet.End == "" {
+			quiet.End = "07:00"
+		}
+	}
+	if cfg.Budget.ResetTime == "" {
+		cfg.Budget.ResetTime = "00:00"
+	}
+	if cfg.Tools.Web.Search.Fallback == "" {
+		cfg.Tools.Web.Search.Fallback = "duckduckgo"
+	}
+	if cfg.Tools.Web.Fetch.Timeout == 0 {
+		cfg.Tools.Web.Fetch.Timeout = 30
+	}
+	if cfg.Tools.Web.Fetch.MaxBytes == 0 {
+		cfg.Tools.Web.Fetch.MaxBytes = 2 * 1024 * 1024
+	}
+	if cfg.Tools.Web.Fetch.MaxChars == 0 {
+		cfg.Tools.Web.Fetch.MaxChars = 20000
+	}
+	if cfg.Tools.Web.HTTP.Timeout == 0 {
+		cfg.Tools.Web.HTTP.Timeout = 30
+	}
+	if cfg.Tools.Web.HTTP.MaxChars == 0 {
+		cfg.Tools.Web.HTTP.MaxChars = 20000
+	}
+	if cfg.Tools.Email.SMTP.Port == 0 {
+		cfg.Tools.Email.SMTP.Port = 587
+	}
+	if cfg.Tools.Email.IMAP.Port == 0 {
+		cfg.Tools.Email.IMAP.Port = 993
+	}
+	if cfg.Tools.Email.IMAP.Username == "" {
+		cfg.Tools.Email.IMAP.Username = cfg.Tools.Email.SMTP.Username
+	}
+	if cfg.Tools.Email.IMAP.Password == "" {
+		cfg.Tools.Email.IMAP.Password = cfg.Tools.Email.SMTP.Password
+	}
+	if cfg.Tools.Email.IMAP.Mailbox == "" {
+		cfg.Tools.Email.IMAP.Mailbox = "INBOX"
+	}
+	if tz := cfg.Agents.Defaults.Timezone; tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil || strings.EqualFold(tz, "local") {
+			return nil, fmt.Errorf("agents.defaults.timezone: unknown time zone %q (use an IANA name such as Asia/Shanghai)", tz)
+		}
+	}
+	names := make(map[string]bool)
+	for i := range cfg.Agents.Instances {
+		inst := &cfg.Agents.Instances[i]
+		if inst.Name == "" || inst.Name == "default" || names[inst.Name] {
+			return nil, fmt.Errorf("agents.instances[%d]: name must be unique, non-empty and not \"default\"", i)
+		}
+		names[inst.Name] = true
+		if inst.Model == "" {
+			inst.Model = cfg.Agents.Defaults.Model
+		}
+		if inst.Workspace == "" {
+			inst.Workspace = strings.TrimRight(cfg.Agents.Defaults.Workspace, "/") + "-" + inst.Name
+		}
+	}
 
 	return &cfg, nil
 }
 
+// configDecrypter 返回解密配置值的函数
+// 只有配置中确实存在加密值时才读取密钥
+func configDecrypter(configDir string) func(string) (string, error) {
+	var c *secrets.Cipher
+	return func(value string) (string, error) {
+		if c == nil {
+			var err error
+			if c, err = secrets.Open(configDir); err != nil {
+				return "", err
+			}
+		}
+		plaintext, err := c.Decrypt(value)
+		if err != nil {
+			return "", err
+		}
+		return string(plaintext), nil
+	}
+}
+
 // GetWorkspacePath 返回展开后的工作空间路径
 // 这是 Config 结构体的方法，用于获取实际的工作空间目录路径
 // 返回:
@@ -299,17 +1795,23 @@ func Load(path string) (*Config, error) {
 //	如果工作空间路径以 "~/" 开头，会自动展开为用户主目录的完整路径
 //	例如："~/.nanogrip/workspace" 会被展开为 "/home/username/.nanogrip/workspace"
 func (c *Config) GetWorkspacePath() string {
-	// 检查工作空间路径是否以 "~/" 开头
-	if len(c.Agents.Defaults.Workspace) >= 2 && c.Agents.Defaults.Workspace[0:2] == "~/" {
-		// 获取用户主目录
-		home, err := os.UserHomeDir()
-		if err != nil {
-			// 如果无法获取主目录，返回原始路径
-			return c.Agents.Defaults.Workspace
-		}
-		// 将 "~/" 替换为实际的主目录路径
-		return filepath.Join(home, c.Agents.Defaults.Workspace[2:])
+	return expandHome(c.Agents.Defaults.Workspace)
+}
+
+// GetBackupPath 返回展开后的备份目录，未配置时为工作区旁边的 backups 目录
+func (c *Config) GetBackupPath() string {
+	if c.Backup.Dir != "" {
+		return expandHome(c.Backup.Dir)
 	}
-	// 如果不是以 "~/" 开头，直接返回原始路径
-	return c.Agents.Defaults.Workspace
+	return filepath.Join(filepath.Dir(filepath.Clean(c.GetWorkspacePath())), "backups")
+}
+
+// InstanceWorkspacePath 返回命名 Agent 展开后的工作区路径
+func (c *Config) InstanceWorkspacePath(inst AgentInstanceConfig) string {
+	return expandHome(inst.Workspace)
+}
+
+// expandHome 将以 "~/"（或 "~\"）开头的路径展开为用户主目录下的路径
+func expandHome(path string) string {
+	return paths.ExpandHome(path)
 }
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// env.go - 配置文件中的环境变量插值
+// 让 API Key、Token 等敏感信息可以来自环境变量或 .env 文件，而不必明文写在 config.yaml 中。
+//
+// 支持两种写法：
+//
+//	apiKey: "${OPENAI_API_KEY}"          # 字符串中的 ${VAR} 会被替换，可以与其他文本混用
+//	apiKey: "${OPENAI_API_KEY:-sk-xxx}"  # 变量未设置或为空时使用默认值
+//	token: !env TELEGRAM_TOKEN           # 整个值取自环境变量
+//
+// 写成 $${VAR} 可以保留字面量 ${VAR}。
+// 由 "nanogrip secrets encrypt" 生成的 "enc:v1:..." 加密值也会在这里解密。
+// 配置文件所在目录下的 .env 文件会在解析前加载，但不会覆盖已经存在的环境变量。
+
+// envPattern 匹配 $${VAR}（转义）或 ${VAR} / ${VAR:-default}
+var envPattern = regexp.MustCompile(`\$\$\{[^}]*\}|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// unmarshalWithEnv 解析 YAML 并展开其中的环境变量引用
+// 展开后以 "enc:v1:" 开头的值会通过 decrypt 解密
+// override 不为 nil 时在展开之后、解码之前调用，用于写入 NANOGRIP_* 环境变量中的配置（见 envconfig.go）
+// 返回:
+//
+//	未设置（且没有默认值）的环境变量名称，用于提示用户
+func unmarshalWithEnv(data []byte, out interface{}, decrypt func(string) (string, error), override func(root *yaml.Node) error) ([]string, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	missing := make(map[string]bool)
+	if err := expandNode(&root, missing, decrypt); err != nil {
+		return nil, err
+	}
+	if override != nil {
+		if err := override(&root); err != nil {
+			return nil, err
+		}
+	}
+	if root.Kind == 0 {
+		return nil, nil // 空文档
+	}
+	if err := root.Decode(out); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// expandNode 递归展开节点中的环境变量引用
+func expandNode(node *yaml.Node, missing map[string]bool, decrypt func(string) (string, error)) error {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode, yaml.MappingNode:
+		for i, child := range node.Content {
+			// 映射的键不做展开
+			if node.Kind == yaml.MappingNode && i%2 == 0 {
+				continue
+			}
+			if err := expandNode(child, missing, decrypt); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if node.Tag == "!env" {
+			name := strings.TrimSpace(node.Value)
+			if name == "" {
+				return fmt.Errorf("line %d: !env requires a variable name", node.Line)
+			}
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				missing[name] = true
+			}
+			node.Value = value
+			node.Tag = "!!str"
+			return decryptNode(node, decrypt)
+		}
+		if node.ShortTag() != "!!str" {
+			return nil
+		}
+		if strings.Contains(node.Value, "${") {
+			node.Value = expandEnv(node.Value, missing)
+			// 非引号的值重新推断类型，使 port: ${PORT} 这样的写法也能解析为数字
+			if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+				node.Tag = ""
+			}
+		}
+		return decryptNode(node, decrypt)
+	}
+	return nil
+}
+
+// decryptNode 解密 "enc:v1:" 开头的值
+func decryptNode(node *yaml.Node, decrypt func(string) (string, error)) error {
+	if !secrets.IsEncrypted(node.Value) {
+		return nil
+	}
+	value, err := decrypt(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	node.Value = value
+	node.Tag = "!!str"
+	return nil
+}
+
+// expandEnv 替换字符串中的 ${VAR} 和 ${VAR:-default}
+func expandEnv(s string, missing map[string]bool) string {
+	return envPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+		groups := envPattern.FindStringSubmatch(match)
+		name, def := groups[1], groups[2]
+		hasDefault := strings.Contains(match, ":-")
+
+		if value, ok := os.LookupEnv(name); ok && (value != "" || !hasDefault) {
+			return value
+		}
+		if hasDefault {
+			return def
+		}
+		missing[name] = true
+		return ""
+	})
+}
+
+// loadDotEnv 加载 .env 文件中的变量（不覆盖已存在的环境变量）
+// 文件不存在时直接返回
+// 支持 KEY=VALUE、export KEY=VALUE、# 注释以及单/双引号包裹的值
+func loadDotEnv(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", filepath.Base(path), lineNo)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		} else if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i]) // 行尾注释
+		}
+
+		if _, exists := os.LookupEnv(key); !exists {
+			os.Setenv(key, value)
+		}
+	}
+	return scanner.Err()
+}
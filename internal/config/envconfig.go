@@ -0,0 +1,233 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envconfig.go - 通过 NANOGRIP_* 环境变量提供配置
+// 在 Docker/Kubernetes 中运行时可以不挂载 config.yaml，所有配置项都来自环境变量；
+// 同时存在配置文件时，环境变量覆盖文件中的值。
+//
+// 变量名由 YAML 键路径得到：加上 NANOGRIP_ 前缀，各级键名转为大写并用 _ 连接：
+//
+//	NANOGRIP_PROVIDERS_OPENAI_APIKEY=sk-xxx      # providers.openai.apiKey
+//	NANOGRIP_CHANNELS_TELEGRAM_ENABLED=true      # channels.telegram.enabled
+//	NANOGRIP_CHANNELS_TELEGRAM_TOKEN=123:abc     # channels.telegram.token
+//	NANOGRIP_AGENTS_DEFAULTS_MODEL=openai/gpt-4o # agents.defaults.model
+//	NANOGRIP_WORKSPACE=/data/workspace           # agents.defaults.workspace 的简写
+//
+// 值的写法：
+//   - 字符串、数字、布尔值直接书写
+//   - 字符串列表用逗号分隔：NANOGRIP_CHANNELS_TELEGRAM_ALLOWFROM=123,456
+//   - 其他列表、映射和结构可以写成 YAML/JSON：NANOGRIP_MCPSERVERS='{"fs": {"command": "npx", "args": ["-y", "server"]}}'
+//   - 映射的键取变量名中对应的一段（以结构体为值的映射转为小写，如 NANOGRIP_MCPSERVERS_GITHUB_COMMAND），
+//     以字符串为值的映射使用剩余部分原样作为键（如 NANOGRIP_MCPSERVERS_GITHUB_ENV_GITHUB_TOKEN）
+//   - "enc:v1:..." 形式的加密值同样会被解密
+//
+// 无法对应到任何配置项的 NANOGRIP_* 变量会在加载时给出警告。
+
+// EnvPrefix 配置环境变量的前缀
+const EnvPrefix = "NANOGRIP_"
+
+// envAliases 常用配置项的简写（去掉前缀后的名称 -> 完整路径）
+var envAliases = map[string]string{
+	"WORKSPACE": "AGENTS_DEFAULTS_WORKSPACE",
+}
+
+// reservedEnv 以 NANOGRIP_ 开头但不是配置项的环境变量
+var reservedEnv = map[string]bool{
+	"NANOGRIP_CONFIG":          true, // 配置文件路径
+	"NANOGRIP_SECRET_KEY":      true, // 加密密钥（见 secrets 包）
+	"NANOGRIP_TMUX_SOCKET_DIR": true, // tmux 工具和技能的 socket 目录
+}
+
+// HasEnvConfig 判断是否通过 NANOGRIP_* 环境变量提供了配置
+// 配置文件不存在时，Load 据此决定是否只使用环境变量启动
+func HasEnvConfig() bool {
+	return len(configEnv()) > 0
+}
+
+// configEnv 返回作为配置项的 NANOGRIP_* 环境变量（名称 -> 值），不含保留变量
+func configEnv() map[string]string {
+	vars := make(map[string]string)
+	for _, entry := range os.Environ() {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) || reservedEnv[name] {
+			continue
+		}
+		vars[name] = value
+	}
+	return vars
+}
+
+// applyEnvConfig 把 NANOGRIP_* 环境变量写入解析后的 YAML 文档，覆盖文件中的值
+// 参数:
+//
+//	root: 配置文件的 YAML 文档节点（文件为空或不存在时为零值）
+//	decrypt: 解密 "enc:v1:" 开头的值
+//
+// 返回:
+//
+//	无法对应到配置项的变量名，用于提示用户
+func applyEnvConfig(root *yaml.Node, decrypt func(string) (string, error)) ([]string, error) {
+	vars := configEnv()
+	if len(vars) == 0 {
+		return nil, nil
+	}
+
+	if root.Kind != yaml.DocumentNode {
+		*root = yaml.Node{Kind: yaml.DocumentNode}
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		root.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+
+	// 按名称排序，使较短的路径（整个映射）先写入，较长的路径（其中的单个键）再覆盖
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var unknown []string
+	for _, name := range names {
+		path := strings.TrimPrefix(name, EnvPrefix)
+		if alias, ok := envAliases[path]; ok {
+			path = alias
+		}
+		keys, leaf, ok := resolveEnvPath(reflect.TypeOf(Config{}), strings.Split(path, "_"))
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		value, err := envValueNode(vars[name], leaf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if err := decryptNode(value, decrypt); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		setNode(root.Content[0], keys, value)
+	}
+	return unknown, nil
+}
+
+// resolveEnvPath 把变量名的各段对应到配置结构中的 YAML 键
+// 返回:
+//
+//	keys: YAML 键路径
+//	leaf: 最后一级的类型
+//	ok: 是否能对应到配置项
+func resolveEnvPath(t reflect.Type, parts []string) ([]string, reflect.Type, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if len(parts) == 0 {
+		return nil, t, true
+	}
+	if parts[0] == "" {
+		return nil, nil, false
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" || !strings.EqualFold(name, parts[0]) {
+				continue
+			}
+			keys, leaf, ok := resolveEnvPath(field.Type, parts[1:])
+			if !ok {
+				return nil, nil, false
+			}
+			return append([]string{name}, keys...), leaf, true
+		}
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, nil, false
+		}
+		elem := t.Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct {
+			// 值是字符串等简单类型：剩余部分整体作为键（通常是环境变量名或 HTTP 头）
+			return []string{strings.Join(parts, "_")}, elem, true
+		}
+		keys, leaf, ok := resolveEnvPath(elem, parts[1:])
+		if !ok {
+			return nil, nil, false
+		}
+		return append([]string{strings.ToLower(parts[0])}, keys...), leaf, true
+	}
+	return nil, nil, false
+}
+
+// envValueNode 把环境变量的值转换为 YAML 节点
+func envValueNode(value string, leaf reflect.Type) (*yaml.Node, error) {
+	switch leaf.Kind() {
+	case reflect.String:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+	case reflect.Slice:
+		if leaf.Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+			list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+				}
+			}
+			return list, nil
+		}
+	case reflect.Map, reflect.Struct, reflect.Interface:
+		// 按 YAML/JSON 解析
+	default:
+		// 数字和布尔值不指定类型，由解码时按目标字段推断
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: value}, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+		return nil, fmt.Errorf("invalid YAML/JSON value: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}, nil
+	}
+	return doc.Content[0], nil
+}
+
+// setNode 在映射节点中按键路径写入值，缺少的中间层自动创建
+func setNode(mapping *yaml.Node, keys []string, value *yaml.Node) {
+	key, rest := keys[0], keys[1:]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+		if len(rest) == 0 {
+			mapping.Content[i+1] = value
+			return
+		}
+		child := mapping.Content[i+1]
+		if child.Kind != yaml.MappingNode {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			mapping.Content[i+1] = child
+		}
+		setNode(child, rest, value)
+		return
+	}
+
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	if len(rest) == 0 {
+		mapping.Content = append(mapping.Content, keyNode, value)
+		return
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	mapping.Content = append(mapping.Content, keyNode, child)
+	setNode(child, rest, value)
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// secrets.go - 加密配置文件中的敏感字段
+// "nanogrip secrets encrypt-config" 使用这里的 EncryptFile，把明文的 API Key、Token 等替换为 "enc:v1:..."
+
+// sensitiveKeys 需要加密的配置键（小写）
+var sensitiveKeys = map[string]bool{
+	"apikey":       true,
+	"token":        true,
+	"secret":       true,
+	"password":     true,
+	"appsecret":    true,
+	"clientsecret": true,
+	"accesstoken":  true,
+}
+
+// EncryptFile 加密配置文件中明文保存的敏感字段
+// 已加密、为空或引用环境变量（${VAR}、!env）的值保持不变。
+// 修改前会把原文件备份为 <path>.bak。
+// 参数:
+//
+//	path: 配置文件路径
+//	c: 加密器
+//
+// 返回:
+//
+//	被加密的字段数量
+func EncryptFile(path string, c *secrets.Cipher) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return 0, err
+	}
+
+	count, err := encryptNode(&root, c)
+	if err != nil || count == 0 {
+		return count, err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&root); err != nil {
+		return 0, err
+	}
+	encoder.Close()
+
+	if err := os.WriteFile(path+".bak", data, 0600); err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// encryptNode 递归加密映射中敏感键对应的值
+func encryptNode(node *yaml.Node, c *secrets.Cipher) (int, error) {
+	count := 0
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 1 {
+			key := strings.ToLower(node.Content[i-1].Value)
+			if sensitiveKeys[key] && isPlainSecret(child) {
+				encrypted, err := c.Encrypt([]byte(child.Value))
+				if err != nil {
+					return count, err
+				}
+				child.Value = encrypted
+				child.Style = yaml.DoubleQuotedStyle
+				count++
+				continue
+			}
+		}
+		n, err := encryptNode(child, c)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// isPlainSecret 判断节点是否为需要加密的明文字符串
+func isPlainSecret(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode &&
+		node.Tag != "!env" &&
+		node.ShortTag() == "!!str" &&
+		node.Value != "" &&
+		!strings.Contains(node.Value, "${") &&
+		!secrets.IsEncrypted(node.Value)
+}
+
+// SecretValues 返回配置中所有敏感字段（与 encrypt-config 加密的字段相同）的值（已解密）
+// 以及 map 中键名疑似密钥的值（例如请求头 Authorization、MCP 服务器的 API_KEY 环境变量），用于脱敏
+func (c *Config) SecretValues() []string {
+	var values []string
+	collectSecrets(reflect.ValueOf(c).Elem(), &values)
+	return values
+}
+
+// collectSecrets 递归收集敏感字段的值
+func collectSecrets(v reflect.Value, values *[]string) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectSecrets(v.Elem(), values)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			key := strings.ToLower(strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0])
+			if field.Kind() == reflect.String && (sensitiveKeys[key] || looksSensitive(key) && key != "publickey") {
+				if field.String() != "" {
+					*values = append(*values, field.String())
+				}
+				continue
+			}
+			collectSecrets(field, values)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			collectSecrets(v.Index(i), values)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if iter.Key().Kind() == reflect.String && iter.Value().Kind() == reflect.String {
+				if looksSensitive(iter.Key().String()) && iter.Value().String() != "" {
+					*values = append(*values, iter.Value().String())
+				}
+				continue
+			}
+			collectSecrets(iter.Value(), values)
+		}
+	}
+}
+
+// looksSensitive 判断 map 的键名（环境变量名、请求头名）是否疑似密钥
+func looksSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range []string{"key", "token", "secret", "password", "authorization"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"log"
+	"os"
+	"time"
+)
+
+// watch.go - 配置文件变化监听
+// 定期检查配置文件的修改时间和大小，内容确实变化时调用回调。
+// 使用轮询而不是 inotify，可以跨平台工作，也能正确处理编辑器"写临时文件再重命名"的保存方式。
+
+// Watch 监听配置文件的变化，直到 ctx 被取消
+// 参数:
+//
+//	ctx: 上下文，取消后停止监听
+//	path: 配置文件路径
+//	interval: 检查间隔
+//	onChange: 文件内容变化时调用（在监听 goroutine 中同步执行）
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	modTime, size, sum := fileState(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				continue // 保存过程中文件可能短暂不存在
+			}
+			if info.ModTime().Equal(modTime) && info.Size() == size {
+				continue
+			}
+
+			newModTime, newSize, newSum := fileState(path)
+			modTime, size = newModTime, newSize
+			if newSum == sum {
+				continue // 只是被 touch，内容没有变化
+			}
+			sum = newSum
+
+			log.Printf("[Config] 检测到配置文件变化: %s", path)
+			onChange()
+		}
+	}
+}
+
+// fileState 返回文件的修改时间、大小和内容哈希
+func fileState(path string) (time.Time, int64, [sha256.Size]byte) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, 0, [sha256.Size]byte{}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return info.ModTime(), info.Size(), [sha256.Size]byte{}
+	}
+	return info.ModTime(), info.Size(), sha256.Sum256(data)
+}
@@ -0,0 +1,172 @@
+package cron
+
+// calendar.go - 日历订阅（iCalendar / ICS）导出
+//
+// 把即将执行的定时任务展开为日历事件，供日历应用订阅，
+// 这样就能在日历中看到机器人计划在什么时候做什么。
+//
+// 展开规则：
+//   - "at": 在时间窗口内时生成一个事件
+//   - "every": 从 NextRun 开始按固定间隔展开
+//   - "cron": 按 cron 表达式依次计算下一次执行时间
+//
+// 每个任务最多展开 maxPerJob 个事件，避免高频任务（如每分钟执行）撑爆日历。
+// 设置了 HideFromCalendar 的任务不会出现在订阅中。
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// calendarEventDuration 每个日历事件的显示时长
+const calendarEventDuration = 15 * time.Minute
+
+// CalendarEvent 表示一次计划中的任务执行
+type CalendarEvent struct {
+	Job   *Job      // 所属任务
+	Start time.Time // 计划执行时间
+}
+
+// UpcomingRuns 计算时间窗口内所有可见任务的计划执行时间
+//
+// 参数：
+//   - from: 窗口开始时间
+//   - horizon: 窗口长度
+//   - maxPerJob: 每个任务最多展开的次数
+//
+// 返回：
+//   - []CalendarEvent: 按时间排序的计划执行列表
+func (c *CronService) UpcomingRuns(from time.Time, horizon time.Duration, maxPerJob int) []CalendarEvent {
+	until := from.Add(horizon)
+
+	var events []CalendarEvent
+	for _, job := range c.ListJobs() {
+		if job.HideFromCalendar {
+			continue
+		}
+		for _, start := range c.expandSchedule(job, from, until, maxPerJob) {
+			events = append(events, CalendarEvent{Job: job, Start: start})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+	return events
+}
+
+// expandSchedule 展开单个任务在 [from, until) 内的执行时间
+func (c *CronService) expandSchedule(job *Job, from, until time.Time, maxPerJob int) []time.Time {
+	var times []time.Time
+	add := func(t time.Time) bool {
+		if t.Before(from) {
+			return true
+		}
+		if !t.Before(until) || len(times) >= maxPerJob {
+			return false
+		}
+		times = append(times, t)
+		return true
+	}
+
+	switch job.Schedule.Kind {
+	case "at":
+		add(time.UnixMilli(job.Schedule.AtMs))
+	case "every":
+		interval := time.Duration(job.Schedule.EveryMs) * time.Millisecond
+		if interval <= 0 {
+			return nil
+		}
+		t := job.NextRun
+		if t.Before(from) {
+			// 对齐到窗口开始之后的第一次执行
+			t = t.Add((from.Sub(t)/interval + 1) * interval)
+		}
+		for add(t) {
+			t = t.Add(interval)
+		}
+	case "cron":
+		sched, err := parseCronExpr(job.Schedule.CronExpr)
+		if err != nil {
+			return nil
+		}
+		t := from
+		if job.Schedule.TZ != "" {
+			if loc, err := time.LoadLocation(job.Schedule.TZ); err == nil {
+				t = t.In(loc)
+			}
+		}
+		for {
+			t = sched.Next(t)
+			if t.IsZero() || !add(t) {
+				break
+			}
+		}
+	}
+	return times
+}
+
+// CalendarFeed 生成 iCalendar 格式的日历订阅内容
+//
+// 参数：
+//   - from: 窗口开始时间
+//   - horizon: 窗口长度
+//   - maxPerJob: 每个任务最多展开的次数
+//
+// 返回：
+//   - string: text/calendar 内容
+func (c *CronService) CalendarFeed(from time.Time, horizon time.Duration, maxPerJob int) string {
+	var sb strings.Builder
+	writeLine := func(line string) {
+		sb.WriteString(line)
+		sb.WriteString("\r\n")
+	}
+
+	stamp := from.UTC().Format("20060102T150405Z")
+
+	writeLine("BEGIN:VCALENDAR")
+	writeLine("VERSION:2.0")
+	writeLine("PRODID:-//nanogrip//cron//EN")
+	writeLine("CALSCALE:GREGORIAN")
+	writeLine("METHOD:PUBLISH")
+	writeLine("X-WR-CALNAME:nanogrip")
+
+	for _, event := range c.UpcomingRuns(from, horizon, maxPerJob) {
+		job := event.Job
+
+		mode := "message"
+		description := job.Message
+		if job.TriggerAgent {
+			mode = "agent"
+			description = job.AgentCommand
+		}
+		if job.Channel != "" {
+			description += fmt.Sprintf("\n\nDeliver to: %s:%s", job.Channel, job.To)
+		}
+
+		writeLine("BEGIN:VEVENT")
+		writeLine(fmt.Sprintf("UID:%s-%d@nanogrip", job.ID, event.Start.Unix()))
+		writeLine("DTSTAMP:" + stamp)
+		writeLine("DTSTART:" + event.Start.UTC().Format("20060102T150405Z"))
+		writeLine("DTEND:" + event.Start.Add(calendarEventDuration).UTC().Format("20060102T150405Z"))
+		writeLine("SUMMARY:" + escapeICS(fmt.Sprintf("[%s] %s", mode, job.Name)))
+		writeLine("DESCRIPTION:" + escapeICS(description))
+		writeLine("CATEGORIES:" + escapeICS(job.Schedule.Kind))
+		writeLine("END:VEVENT")
+	}
+
+	writeLine("END:VCALENDAR")
+	return sb.String()
+}
+
+// escapeICS 按 RFC 5545 转义文本值
+func escapeICS(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, ";", `\;`)
+	s = strings.ReplaceAll(s, ",", `\,`)
+	s = strings.ReplaceAll(s, "\r\n", `\n`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return s
+}
@@ -0,0 +1,273 @@
+package cron
+
+// history.go - 任务执行记录和连续失败告警
+// 每次执行任务都记录开始时间、耗时、是否成功和回复的开头，每个任务只保留最近的若干条（见 SetHistory）。
+// 记录保存在文件中，配置文件中的任务（ID 固定）重启后仍能看到之前的执行记录。
+// 周期性任务连续失败达到阈值时通知主人，之后第一次成功时再通知一次（见 SetFailureAlert）。
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/i18n"
+)
+
+const (
+	// DefaultHistoryLimit 每个任务默认保留的执行记录数
+	DefaultHistoryLimit = 20
+	// maxHistoryJobs 最多保留执行记录的任务数（超出时丢弃最久没有执行的任务的记录）
+	maxHistoryJobs = 200
+	// runPreviewChars 执行记录中保留的回复或错误的字符数
+	runPreviewChars = 200
+)
+
+// Run 是任务的一次执行记录
+type Run struct {
+	JobID      string    `json:"job_id"`
+	JobName    string    `json:"job_name"`
+	Start      time.Time `json:"start"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`   // 失败原因，为空表示成功
+	Preview    string    `json:"preview,omitempty"` // 回复的开头
+}
+
+// OK 判断这次执行是否成功
+func (r Run) OK() bool {
+	return r.Error == ""
+}
+
+// historyState 是执行记录和告警的状态（由 CronService.historyMu 保护）
+type historyState struct {
+	runs       map[string][]Run // 任务 ID -> 执行记录（旧的在前）
+	limit      int              // 每个任务保留的记录数（<= 0 表示不记录）
+	path       string           // 保存记录的文件（为空表示只保存在内存中）
+	alertAfter int              // 连续失败多少次后通知主人（<= 0 表示不通知）
+	alertTo    [2]string        // 接收告警的频道和聊天 ID
+	failures   map[string]int   // 任务 ID -> 连续失败的次数
+	alerted    map[string]bool  // 已发送连续失败告警、尚未恢复的任务
+}
+
+// SetHistory 设置执行记录的保留条数和保存位置，并加载文件中已有的记录
+// 可以在运行时调用（配置热重载）
+//
+// 参数：
+//   - path: 保存记录的 JSON 文件，为空表示只保存在内存中
+//   - limit: 每个任务保留的记录数，<= 0 表示不记录
+func (c *CronService) SetHistory(path string, limit int) {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+
+	if c.history.runs == nil {
+		c.history.runs = make(map[string][]Run)
+	}
+	if path != "" && path != c.history.path {
+		if data, err := os.ReadFile(path); err == nil {
+			var saved map[string][]Run
+			if err := json.Unmarshal(data, &saved); err != nil {
+				log.Printf("[Cron] ⚠ 读取执行记录失败: %v", err)
+			} else {
+				for id, runs := range saved {
+					if _, ok := c.history.runs[id]; !ok {
+						c.history.runs[id] = runs
+					}
+				}
+			}
+		}
+	}
+	c.history.path = path
+	c.history.limit = limit
+	for id, runs := range c.history.runs {
+		if limit <= 0 {
+			delete(c.history.runs, id)
+		} else if len(runs) > limit {
+			c.history.runs[id] = runs[len(runs)-limit:]
+		}
+	}
+}
+
+// SetFailureAlert 设置周期性任务连续失败的告警
+// 可以在运行时调用（配置热重载）
+//
+// 参数：
+//   - after: 连续失败多少次后通知，<= 0 表示不通知
+//   - channel, chatID: 接收告警的频道和聊天（通常是主人）
+func (c *CronService) SetFailureAlert(after int, channel, chatID string) {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+	c.history.alertAfter = after
+	c.history.alertTo = [2]string{channel, chatID}
+}
+
+// History 返回任务最近的执行记录（新的在前）
+//
+// 参数：
+//   - jobID: 任务 ID，为空表示所有任务
+//   - limit: 最多返回的记录数，<= 0 表示不限
+func (c *CronService) History(jobID string, limit int) []Run {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+
+	var runs []Run
+	if jobID != "" {
+		runs = append(runs, c.history.runs[jobID]...)
+	} else {
+		for _, list := range c.history.runs {
+			runs = append(runs, list...)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Start.After(runs[j].Start) })
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs
+}
+
+// recordRun 记录一次执行，并在需要时发送连续失败告警或恢复通知
+func (c *CronService) recordRun(job *Job, start time.Time, response string, err error) {
+	run := Run{
+		JobID:      job.ID,
+		JobName:    job.Name,
+		Start:      start,
+		DurationMs: time.Since(start).Milliseconds(),
+		Preview:    previewText(response),
+	}
+	if err != nil {
+		run.Error = previewText(err.Error())
+	}
+
+	c.historyMu.Lock()
+	if c.history.limit > 0 {
+		runs := append(c.history.runs[job.ID], run)
+		if len(runs) > c.history.limit {
+			runs = runs[len(runs)-c.history.limit:]
+		}
+		c.history.runs[job.ID] = runs
+		c.pruneHistoryLocked()
+		c.saveHistoryLocked()
+	}
+
+	// 连续失败告警只针对周期性任务
+	if c.history.failures == nil {
+		c.history.failures = make(map[string]int)
+		c.history.alerted = make(map[string]bool)
+	}
+	failures := 0
+	if !run.OK() {
+		failures = c.history.failures[job.ID] + 1
+		c.history.failures[job.ID] = failures
+	} else {
+		delete(c.history.failures, job.ID)
+	}
+	var alert string
+	recurring := !job.DeleteAfterRun && job.Schedule.Kind != "at"
+	if recurring && c.history.alertAfter > 0 && c.history.alertTo[1] != "" {
+		lang := i18n.Default()
+		switch {
+		case failures == c.history.alertAfter:
+			c.history.alerted[job.ID] = true
+			alert = i18n.T(lang, "cron_failure_alert", job.Name, failures, run.Error)
+		case failures == 0 && c.history.alerted[job.ID]:
+			delete(c.history.alerted, job.ID)
+			alert = i18n.T(lang, "cron_recovered", job.Name)
+		}
+	}
+	alertTo := c.history.alertTo
+	c.historyMu.Unlock()
+
+	if alert == "" {
+		return
+	}
+	c.mu.RLock()
+	msgBus := c.messageBus
+	c.mu.RUnlock()
+	if msgBus == nil {
+		return
+	}
+	log.Printf("[Cron] 📣 任务 %s 告警: %s", job.Name, alert)
+	if err := msgBus.PublishOutbound(bus.OutboundMessage{
+		Channel:  alertTo[0],
+		ChatID:   alertTo[1],
+		Content:  alert,
+		Metadata: map[string]interface{}{"from_cron": true},
+	}); err != nil {
+		log.Printf("[Cron] ❌ 发送告警失败: %v", err)
+	}
+}
+
+// pruneHistoryLocked 只保留最近执行过的 maxHistoryJobs 个任务的记录（调用方持有 historyMu）
+func (c *CronService) pruneHistoryLocked() {
+	if len(c.history.runs) <= maxHistoryJobs {
+		return
+	}
+	ids := make([]string, 0, len(c.history.runs))
+	for id := range c.history.runs {
+		ids = append(ids, id)
+	}
+	last := func(id string) time.Time {
+		runs := c.history.runs[id]
+		return runs[len(runs)-1].Start
+	}
+	sort.Slice(ids, func(i, j int) bool { return last(ids[i]).After(last(ids[j])) })
+	for _, id := range ids[maxHistoryJobs:] {
+		delete(c.history.runs, id)
+	}
+}
+
+// saveHistoryLocked 把执行记录写入文件（调用方持有 historyMu）
+// 先写入临时文件再重命名，写入中途失败不会损坏已有的记录
+func (c *CronService) saveHistoryLocked() {
+	if c.history.path == "" {
+		return
+	}
+	data, err := json.Marshal(c.history.runs)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(c.history.path), 0755)
+	}
+	if err == nil {
+		tmp := c.history.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, c.history.path)
+		}
+	}
+	if err != nil {
+		log.Printf("[Cron] ⚠ 保存执行记录失败: %v", err)
+	}
+}
+
+// previewText 把文本压缩为一行并截断到 runPreviewChars 个字符
+func previewText(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if runes := []rune(s); len(runes) > runPreviewChars {
+		return string(runes[:runPreviewChars]) + "…"
+	}
+	return s
+}
+
+// FormatRuns 把执行记录格式化为每行一条的文本（用于 cron 工具和 CLI）
+//
+// 参数：
+//   - runs: 执行记录（通常来自 History）
+//   - loc: 显示时间使用的时区
+func FormatRuns(runs []Run, loc *time.Location) string {
+	var sb strings.Builder
+	for _, r := range runs {
+		status, detail := "✓", r.Preview
+		if !r.OK() {
+			status, detail = "✗", r.Error
+		}
+		duration := (time.Duration(r.DurationMs) * time.Millisecond).Round(100 * time.Millisecond)
+		fmt.Fprintf(&sb, "%s %s  %s (%s, %s)", status, r.Start.In(loc).Format("2006-01-02 15:04"), r.JobName, r.JobID, duration)
+		if detail != "" {
+			sb.WriteString(": " + detail)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,504 @@
+package cron
+
+// phrase.go - 自然语言调度短语
+// 模型把 "every weekday at 9" 之类的说法翻译成 cron 表达式时经常出错，
+// ParsePhrase 把常见的英文说法确定性地转换为 cron 表达式，并生成便于用户确认的说明。
+//
+// 标准的 5 字段 cron 表达式无法表示 "每月第一个星期一"，parseCronExpr 在标准写法之外支持：
+//   - 周字段 "d#n"：每月第 n 个星期 d（例如 "0 9 * * 1#1" 表示每月第一个星期一 9 点）
+//   - 周字段 "dL"：每月最后一个星期 d（例如 "0 17 * * 5L"）
+//   - 日字段 "L"：每月最后一天（例如 "0 9 L * *"）
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// maxFilteredSkips 扩展写法在找到下一次执行前最多跳过的候选时间
+const maxFilteredSkips = 1000
+
+// cronParser 解析 5 字段的 cron 表达式（分 时 日 月 周，与标准 Linux cron 一致，不含秒）
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// nthWeekdayField 周字段中的 "d#n" 和 "dL" 写法
+var nthWeekdayField = regexp.MustCompile(`(?i)^([0-7]|sun|mon|tue|wed|thu|fri|sat)(#[1-5]|l)$`)
+
+// filteredSchedule 在标准调度的基础上只保留满足条件的执行时间
+type filteredSchedule struct {
+	cron.Schedule
+	keep func(time.Time) bool
+}
+
+// Next 返回 t 之后第一个满足条件的执行时间，找不到时返回零值
+func (s filteredSchedule) Next(t time.Time) time.Time {
+	for i := 0; i < maxFilteredSkips; i++ {
+		t = s.Schedule.Next(t)
+		if t.IsZero() || s.keep(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseCronExpr 解析 cron 表达式，支持文件开头说明的扩展写法
+func parseCronExpr(expr string) (cron.Schedule, error) {
+	fields := strings.Fields(expr)
+	var keep func(time.Time) bool
+	if len(fields) == 5 {
+		if strings.EqualFold(fields[2], "L") {
+			if fields[4] != "*" && fields[4] != "?" {
+				return nil, fmt.Errorf("day of week must be * when day of month is L")
+			}
+			fields[2] = "28-31"
+			keep = func(t time.Time) bool { return t.AddDate(0, 0, 1).Month() != t.Month() }
+		} else if m := nthWeekdayField.FindStringSubmatch(fields[4]); m != nil {
+			if fields[2] != "*" && fields[2] != "?" {
+				return nil, fmt.Errorf("day of month must be * when day of week uses # or L")
+			}
+			fields[4] = m[1]
+			if strings.EqualFold(m[2], "L") {
+				keep = func(t time.Time) bool { return t.AddDate(0, 0, 7).Month() != t.Month() }
+			} else {
+				n := int(m[2][1] - '0')
+				keep = func(t time.Time) bool { return (t.Day()-1)/7+1 == n }
+			}
+		}
+	}
+
+	sched, err := cronParser.Parse(strings.Join(fields, " "))
+	if err != nil {
+		return nil, err
+	}
+	if keep == nil {
+		return sched, nil
+	}
+	return filteredSchedule{Schedule: sched, keep: keep}, nil
+}
+
+// Phrase 是自然语言调度短语的解析结果
+type Phrase struct {
+	CronExpr    string // 对应的 cron 表达式（可能使用 "d#n"、"dL"、"L" 扩展写法）
+	Description string // 便于用户确认的说明，例如 "Mon-Fri 09:00"
+}
+
+var (
+	phraseEveryMinute = regexp.MustCompile(`^(?:every|each) minute$`)
+	phraseMinutes     = regexp.MustCompile(`^(?:every|each) (\d+) ?(?:minutes|minute|mins|min)$`)
+	phraseHours       = regexp.MustCompile(`^(?:hourly|(?:every|each) (?:(\d+) ?)?(?:hours|hour|hrs|hr))(?: at :?(\d{1,2}))?$`)
+	phraseClock       = regexp.MustCompile(`^(\d{1,2})(?:[:h](\d{2})?)?(am|pm)?$`)
+	phraseDayOfMonth  = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)$`)
+	phraseAmPm        = regexp.MustCompile(`(\d) (am|pm)\b`)
+	phraseDotTime     = regexp.MustCompile(`(\d)\.(\d{2})`)
+)
+
+// phraseWeekdays 星期的英文名称和缩写（0 为星期日）
+var phraseWeekdays = map[string]int{
+	"sun": 0, "sunday": 0, "sundays": 0,
+	"mon": 1, "monday": 1, "mondays": 1,
+	"tue": 2, "tues": 2, "tuesday": 2, "tuesdays": 2,
+	"wed": 3, "weds": 3, "wednesday": 3, "wednesdays": 3,
+	"thu": 4, "thur": 4, "thurs": 4, "thursday": 4, "thursdays": 4,
+	"fri": 5, "friday": 5, "fridays": 5,
+	"sat": 6, "saturday": 6, "saturdays": 6,
+}
+
+// phraseMonths 月份的英文名称和缩写
+var phraseMonths = map[string]int{
+	"jan": 1, "january": 1, "feb": 2, "february": 2, "mar": 3, "march": 3,
+	"apr": 4, "april": 4, "may": 5, "jun": 6, "june": 6,
+	"jul": 7, "july": 7, "aug": 8, "august": 8, "sep": 9, "sept": 9, "september": 9,
+	"oct": 10, "october": 10, "nov": 11, "november": 11, "dec": 12, "december": 12,
+}
+
+// phraseOrdinals 序数词（-1 表示最后一个）
+var phraseOrdinals = map[string]int{
+	"first": 1, "1st": 1, "second": 2, "2nd": 2, "third": 3, "3rd": 3,
+	"fourth": 4, "4th": 4, "fifth": 5, "5th": 5, "last": -1,
+}
+
+// phraseFillers 不影响含义的词
+var phraseFillers = map[string]bool{
+	"every": true, "each": true, "on": true, "the": true, "of": true, "at": true,
+	"in": true, "and": true, "a": true, "an": true, "o'clock": true, "oclock": true,
+}
+
+var (
+	weekdayNames = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+	monthNames   = []string{"", "Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+	ordinalNames = map[int]string{1: "first", 2: "second", 3: "third", 4: "fourth", 5: "fifth", -1: "last"}
+)
+
+// ParsePhrase 把英文的调度短语转换为 cron 表达式
+//
+// 支持的说法（大小写不敏感）：
+//   - 间隔："every 15 minutes"、"hourly"、"every 2 hours at :30"
+//   - 每天 / 工作日 / 周末："every day at 9am"、"every weekday 9:30"、"weekends at noon"
+//   - 星期："every monday and thursday at 18:00"、"mon-fri 8am"
+//   - 每月："monthly on the 1st"、"on the 1st and 15th at 9"、"last day of the month"
+//   - 每月第几个星期："first Monday of the month"、"last friday of every month 5pm"
+//   - 每年："every year on Mar 5 at 10am"
+//
+// 没有给出时间时默认 09:00（说明中会注明）。
+//
+// 参数：
+//   - text: 调度短语
+//
+// 返回：
+//   - Phrase: cron 表达式和说明
+//   - error: 无法理解的短语，错误信息说明了原因
+func ParsePhrase(text string) (Phrase, error) {
+	s := strings.ToLower(strings.TrimSpace(text))
+	s = strings.NewReplacer(",", " ", "&", " ", ";", " ", "-", " - ", "a.m.", "am", "p.m.", "pm").Replace(s)
+	s = phraseDotTime.ReplaceAllString(s, "$1:$2")
+	s = strings.Join(strings.Fields(s), " ")
+	s = phraseAmPm.ReplaceAllString(s, "$1$2")
+	if s == "" {
+		return Phrase{}, fmt.Errorf("empty schedule")
+	}
+
+	// 按分钟或小时的间隔
+	if phraseEveryMinute.MatchString(s) {
+		return Phrase{CronExpr: "* * * * *", Description: "every minute"}, nil
+	}
+	if m := phraseMinutes.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if n < 1 || n > 59 || 60%n != 0 {
+			return Phrase{}, fmt.Errorf("every %d minutes does not divide the hour evenly; use every_seconds instead", n)
+		}
+		if n == 1 {
+			return Phrase{CronExpr: "* * * * *", Description: "every minute"}, nil
+		}
+		return Phrase{CronExpr: fmt.Sprintf("*/%d * * * *", n), Description: fmt.Sprintf("every %d minutes", n)}, nil
+	}
+	if m := phraseHours.FindStringSubmatch(s); m != nil {
+		n, minute := 1, 0
+		if m[1] != "" {
+			n, _ = strconv.Atoi(m[1])
+		}
+		if m[2] != "" {
+			minute, _ = strconv.Atoi(m[2])
+		}
+		if n < 1 || n > 23 || 24%n != 0 {
+			return Phrase{}, fmt.Errorf("every %d hours does not divide the day evenly; use every_seconds instead", n)
+		}
+		if minute > 59 {
+			return Phrase{}, fmt.Errorf("invalid minute %d", minute)
+		}
+		if n == 1 {
+			return Phrase{CronExpr: fmt.Sprintf("%d * * * *", minute), Description: fmt.Sprintf("every hour at :%02d", minute)}, nil
+		}
+		return Phrase{CronExpr: fmt.Sprintf("%d */%d * * *", minute, n), Description: fmt.Sprintf("every %d hours at :%02d", n, minute)}, nil
+	}
+
+	var (
+		dows    = make(map[int]bool)
+		doms    = make(map[int]bool)
+		months  = make(map[int]bool)
+		hours   = make(map[int]bool)
+		minute  = -1
+		nth     int  // 每月第几个星期（-1 为最后一个，0 表示未使用）
+		lastDay bool // 每月最后一天
+		period  string
+	)
+	addTime := func(h, m int) error {
+		if minute >= 0 && minute != m {
+			return fmt.Errorf("all times must share the same minute (e.g. 9:00 and 18:00); create separate jobs otherwise")
+		}
+		minute = m
+		hours[h] = true
+		return nil
+	}
+
+	tokens := strings.Fields(s)
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		next := ""
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+
+		if d, ok := phraseWeekdays[tok]; ok {
+			// 星期范围："mon-fri"、"monday to friday"
+			if next == "-" || next == "to" || next == "through" || next == "thru" {
+				if i+2 < len(tokens) {
+					if end, ok := phraseWeekdays[tokens[i+2]]; ok {
+						for day := d; ; day = (day + 1) % 7 {
+							dows[day] = true
+							if day == end {
+								break
+							}
+						}
+						i += 2
+						continue
+					}
+				}
+				return Phrase{}, fmt.Errorf("incomplete weekday range after %q", tok)
+			}
+			dows[d] = true
+			continue
+		}
+		if n, ok := phraseOrdinals[tok]; ok {
+			// "first monday"、"last friday" 表示每月第几个星期；"last day" 表示每月最后一天；其余为日期
+			if d, isDay := phraseWeekdays[next]; isDay {
+				if nth != 0 && nth != n {
+					return Phrase{}, fmt.Errorf("only one \"first/second/.../last <weekday>\" is supported per job")
+				}
+				nth = n
+				dows[d] = true
+				i++
+				continue
+			}
+			if next == "day" {
+				if n == -1 {
+					lastDay = true
+				} else {
+					doms[n] = true
+				}
+				i++
+				continue
+			}
+			if n > 0 {
+				doms[n] = true
+				continue
+			}
+			return Phrase{}, fmt.Errorf("\"last\" must be followed by a weekday or \"day\"")
+		}
+		if m := phraseDayOfMonth.FindStringSubmatch(tok); m != nil {
+			d, _ := strconv.Atoi(m[1])
+			if d < 1 || d > 31 {
+				return Phrase{}, fmt.Errorf("invalid day of month %q", tok)
+			}
+			doms[d] = true
+			continue
+		}
+		if mon, ok := phraseMonths[tok]; ok {
+			months[mon] = true
+			// "mar 5"：月份后面的数字是日期
+			if d, err := strconv.Atoi(next); err == nil && d >= 1 && d <= 31 {
+				doms[d] = true
+				i++
+			}
+			continue
+		}
+		if m := phraseClock.FindStringSubmatch(tok); m != nil {
+			switch next {
+			case "day", "days", "week", "weeks", "month", "months", "year", "years":
+				return Phrase{}, fmt.Errorf("repeating every %s %s is not supported by cron expressions; use every_seconds instead", tok, next)
+			}
+			// "the 15"、"5 march" 中的数字是日期
+			if _, isMonth := phraseMonths[next]; m[2] == "" && m[3] == "" && (isMonth || (i > 0 && tokens[i-1] == "the")) {
+				d, _ := strconv.Atoi(m[1])
+				if d < 1 || d > 31 {
+					return Phrase{}, fmt.Errorf("invalid day of month %q", tok)
+				}
+				doms[d] = true
+				continue
+			}
+			h, _ := strconv.Atoi(m[1])
+			mm := 0
+			if m[2] != "" {
+				mm, _ = strconv.Atoi(m[2])
+			}
+			switch m[3] {
+			case "am":
+				if h < 1 || h > 12 {
+					return Phrase{}, fmt.Errorf("invalid time %q", tok)
+				}
+				h %= 12
+			case "pm":
+				if h < 1 || h > 12 {
+					return Phrase{}, fmt.Errorf("invalid time %q", tok)
+				}
+				h = h%12 + 12
+			}
+			if h > 23 || mm > 59 {
+				return Phrase{}, fmt.Errorf("invalid time %q", tok)
+			}
+			if err := addTime(h, mm); err != nil {
+				return Phrase{}, err
+			}
+			continue
+		}
+
+		switch tok {
+		case "noon", "midday":
+			if err := addTime(12, 0); err != nil {
+				return Phrase{}, err
+			}
+		case "midnight":
+			if err := addTime(0, 0); err != nil {
+				return Phrase{}, err
+			}
+		case "weekday", "weekdays", "workday", "workdays":
+			for d := 1; d <= 5; d++ {
+				dows[d] = true
+			}
+		case "weekend", "weekends":
+			dows[0], dows[6] = true, true
+		case "day", "days", "daily":
+			period = "day"
+		case "week", "weeks", "weekly":
+			period = "week"
+		case "month", "months", "monthly":
+			period = "month"
+		case "year", "years", "yearly", "annually":
+			period = "year"
+		default:
+			if !phraseFillers[tok] {
+				return Phrase{}, fmt.Errorf("could not understand %q in schedule %q; use a phrase like \"every weekday at 9am\" or a cron expression", tok, text)
+			}
+		}
+	}
+
+	dayOfMonth := len(doms) > 0 || lastDay
+	switch {
+	case dayOfMonth && len(dows) > 0:
+		return Phrase{}, fmt.Errorf("a schedule cannot combine days of the month with weekdays")
+	case nth != 0 && len(dows) != 1:
+		return Phrase{}, fmt.Errorf("use a single weekday with first/second/.../last, e.g. \"first Monday of the month\"")
+	case period == "week" && len(dows) == 0:
+		return Phrase{}, fmt.Errorf("which day of the week? e.g. \"every week on Monday at 9am\"")
+	case period == "month" && !dayOfMonth && nth == 0:
+		return Phrase{}, fmt.Errorf("which day of the month? e.g. \"monthly on the 1st\" or \"first Monday of the month\"")
+	case period == "year" && (len(months) == 0 || (!dayOfMonth && nth == 0)):
+		return Phrase{}, fmt.Errorf("which date? e.g. \"every year on Mar 5 at 10am\"")
+	case len(months) > 0 && period == "month":
+		return Phrase{}, fmt.Errorf("a monthly schedule cannot be limited to specific months; list the months instead, e.g. \"on the 1st of Jan and Jul\"")
+	case period == "" && len(dows) == 0 && !dayOfMonth && len(months) == 0 && len(hours) == 0:
+		return Phrase{}, fmt.Errorf("could not find a day or time in schedule %q", text)
+	}
+
+	defaultTime := len(hours) == 0
+	if defaultTime {
+		hours[9] = true
+		minute = 0
+	}
+
+	domField, dowField := "*", "*"
+	var days string
+	switch {
+	case nth != 0:
+		d := sortedKeys(dows)[0]
+		if nth == -1 {
+			dowField = fmt.Sprintf("%dL", d)
+		} else {
+			dowField = fmt.Sprintf("%d#%d", d, nth)
+		}
+		days = fmt.Sprintf("%s %s of %s", ordinalNames[nth], weekdayNames[d], monthsDescription(months))
+	case lastDay:
+		domField = "L"
+		days = "last day of " + monthsDescription(months)
+	case len(doms) > 0:
+		list := sortedKeys(doms)
+		domField = joinInts(list, ",")
+		names := make([]string, len(list))
+		for i, d := range list {
+			names[i] = ordinalSuffix(d)
+		}
+		days = "the " + strings.Join(names, ", ") + " of " + monthsDescription(months)
+	case len(dows) > 0 && len(dows) < 7:
+		dowField = joinInts(sortedKeys(dows), ",")
+		days = weekdaysDescription(dows)
+		if len(months) > 0 {
+			days += " in " + monthsList(months)
+		}
+	default:
+		days = "every day"
+		if len(months) > 0 {
+			days += " in " + monthsList(months)
+		}
+	}
+
+	monthField := "*"
+	if len(months) > 0 {
+		monthField = joinInts(sortedKeys(months), ",")
+	}
+
+	hourList := sortedKeys(hours)
+	times := make([]string, len(hourList))
+	for i, h := range hourList {
+		times[i] = fmt.Sprintf("%02d:%02d", h, minute)
+	}
+	description := days + " " + strings.Join(times, ", ")
+	if defaultTime {
+		description += " (no time given, defaulting to 09:00)"
+	}
+
+	return Phrase{
+		CronExpr:    fmt.Sprintf("%d %s %s %s %s", minute, joinInts(hourList, ","), domField, monthField, dowField),
+		Description: description,
+	}, nil
+}
+
+// weekdaysDescription 返回星期的说明，例如 "Mon-Fri"、"Sat, Sun"、"Mon, Wed, Fri"（星期一在前）
+func weekdaysDescription(dows map[int]bool) string {
+	if len(dows) == 5 && !dows[0] && !dows[6] {
+		return "Mon-Fri"
+	}
+	var names []string
+	for _, d := range []int{1, 2, 3, 4, 5, 6, 0} {
+		if dows[d] {
+			names = append(names, weekdayNames[d])
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// monthsDescription 返回 "every month" 或月份列表
+func monthsDescription(months map[int]bool) string {
+	if len(months) == 0 {
+		return "every month"
+	}
+	return monthsList(months)
+}
+
+// monthsList 返回月份的缩写列表，例如 "Jan, Jul"
+func monthsList(months map[int]bool) string {
+	list := sortedKeys(months)
+	names := make([]string, len(list))
+	for i, m := range list {
+		names[i] = monthNames[m]
+	}
+	return strings.Join(names, ", ")
+}
+
+// ordinalSuffix 返回带英文序数后缀的数字，例如 1st、22nd、13th
+func ordinalSuffix(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// sortedKeys 返回集合中按升序排列的元素
+func sortedKeys(set map[int]bool) []int {
+	keys := make([]int, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// joinInts 用 sep 连接整数
+func joinInts(values []int, sep string) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, sep)
+}
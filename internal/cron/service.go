@@ -39,11 +39,15 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math/rand/v2"
+	"path"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Ailoc/nanogrip/internal/bus"
-	"github.com/robfig/cron/v3"
+	"github.com/Ailoc/nanogrip/internal/i18n"
 )
 
 // AgentExecutor 定义 Agent 执行器接口
@@ -57,6 +61,64 @@ type AgentExecutor interface {
 
 	// SetToolContext 设置工具上下文（用于 Cron 任务执行时设置正确的 Channel 和 ChatID）
 	SetToolContext(channel, chatID string)
+
+	// ProcessDirectWithPermissions 在指定 Channel 和 ChatID 下以受限的工具权限处理命令
+	ProcessDirectWithPermissions(ctx context.Context, channel, chatID, message string, perms Permissions) (string, error)
+}
+
+// Permissions 限制 Agent 模式任务无人值守执行时可以使用的工具
+type Permissions struct {
+	Tools    []string // 允许的工具名称（支持 * 通配符，为空表示不限制）
+	ReadOnly bool     // 文件系统只读（禁止写入、删除和修改文件，也不能执行命令）
+	NoShell  bool     // 禁止执行命令（shell、code_exec、技能命令等）
+}
+
+// Restrict 返回在 p 的基础上用 other 进一步收紧后的权限
+// 只读和禁止 shell 取并集；两者都限制了工具时，只保留 other 中 p 也允许的工具
+// 用于聊天中创建的任务：模型请求的权限不能超过配置的默认权限
+func (p Permissions) Restrict(other Permissions) Permissions {
+	result := Permissions{
+		ReadOnly: p.ReadOnly || other.ReadOnly,
+		NoShell:  p.NoShell || other.NoShell,
+	}
+	switch {
+	case len(p.Tools) == 0:
+		result.Tools = other.Tools
+	case len(other.Tools) == 0:
+		result.Tools = p.Tools
+	default:
+		for _, name := range other.Tools {
+			for _, pattern := range p.Tools {
+				if ok, _ := path.Match(pattern, name); ok || pattern == name {
+					result.Tools = append(result.Tools, name)
+					break
+				}
+			}
+		}
+		if len(result.Tools) == 0 {
+			// 没有交集时不允许任何工具（空列表表示不限制，所以用一个不存在的名称）
+			result.Tools = []string{"-"}
+		}
+	}
+	return result
+}
+
+// String 返回权限的简短描述（用于任务列表）
+func (p Permissions) String() string {
+	var parts []string
+	if len(p.Tools) > 0 {
+		parts = append(parts, "tools: "+strings.Join(p.Tools, ","))
+	}
+	if p.ReadOnly {
+		parts = append(parts, "read-only")
+	}
+	if p.NoShell {
+		parts = append(parts, "no shell")
+	}
+	if len(parts) == 0 {
+		return "unrestricted"
+	}
+	return strings.Join(parts, "; ")
 }
 
 // Job 表示一个定时任务
@@ -75,6 +137,56 @@ type Job struct {
 	// Agent 模式支持（方案4）
 	TriggerAgent bool   // 是否触发 Agent 执行（true=执行命令, false=发送固定消息）
 	AgentCommand string // Agent 要执行的命令内容
+
+	HideFromCalendar bool // 是否在日历订阅（ICS）中隐藏
+
+	// Builtin 内置任务类型（例如 "digest"），由 RegisterBuiltin 注册的处理函数执行，Message 作为参数
+	Builtin string
+	// Variables 内置任务的变量（例如 "template" 任务的模板变量）
+	Variables map[string]string
+
+	// Permissions Agent 模式执行时的工具权限（nil 表示使用 SetDefaultPermissions 设置的默认权限）
+	Permissions *Permissions
+
+	// 错过执行时间的处理
+	Misfire MisfirePolicy // 错过执行时间后的处理策略（为空表示 run_once_late）
+	LastRun time.Time     // 上次执行时间（恢复任务时据此计算错过的执行）
+
+	// 重叠执行、执行时间和随机延迟（见 checkAndRun）
+	AllowOverlap bool          // 上一次执行尚未结束时是否仍然开始新的执行（默认跳过这一次）
+	MaxRuntime   time.Duration // Agent 模式每次执行的最长时间，超时后取消（0 表示不限制）
+	Jitter       time.Duration // 每次执行前随机延迟 [0, Jitter)，避免多个任务同时开始（0 表示不延迟）
+}
+
+// MisfirePolicy 决定任务错过执行时间后如何处理
+// 进程停止、系统休眠或时钟跳变都会导致任务在应执行时间之后很久才被检查到
+type MisfirePolicy string
+
+const (
+	MisfireSkip    MisfirePolicy = "skip"           // 跳过错过的执行，等待下一次
+	MisfireRunOnce MisfirePolicy = "run_once_late"  // 补执行一次（默认）
+	MisfireRunAll  MisfirePolicy = "run_all_missed" // 补执行每一次错过的执行（最多 maxCatchUpRuns 次）
+)
+
+const (
+	// misfireGrace 超过应执行时间多久才算错过（在此之内按正常执行处理）
+	misfireGrace = time.Minute
+	// maxCatchUpRuns run_all_missed 策略最多补执行的次数
+	maxCatchUpRuns = 50
+	// maxOverlappingRuns 允许重叠执行的任务同时执行的最多次数，超出时跳过这一次
+	maxOverlappingRuns = 3
+)
+
+// ParseMisfirePolicy 解析错过执行策略，空字符串表示默认策略
+func ParseMisfirePolicy(value string) (MisfirePolicy, error) {
+	switch policy := MisfirePolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "":
+		return "", nil
+	case MisfireSkip, MisfireRunOnce, MisfireRunAll:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown misfire policy %q (use skip, run_once_late or run_all_missed)", value)
+	}
 }
 
 // Schedule 表示任务的调度配置
@@ -104,10 +216,23 @@ type CronService struct {
 	agentExecutor AgentExecutor   // Agent 执行器，用于触发 AI 命令执行
 	messageBus    *bus.MessageBus // 消息总线，用于发送消息结果（使用具体类型以匹配接口）
 
+	// defaultPerms 没有单独设置权限的 Agent 模式任务使用的权限（nil 表示不限制）
+	defaultPerms *Permissions
+
+	// builtins 内置任务类型的处理函数
+	builtins map[string]BuiltinFunc
+
 	stopChan   chan struct{}  // 停止信号通道
 	wakeupChan chan struct{}  // 新任务/任务变更唤醒通道
 	stopOnce   sync.Once      // 确保 Stop 只执行一次
 	wg         sync.WaitGroup // 等待组，用于跟踪调度 goroutine
+
+	// 执行记录和连续失败告警（见 history.go）
+	history   historyState
+	historyMu sync.Mutex
+
+	// running 正在执行（包括随机延迟中）的任务 ID -> 次数（由 mu 保护）
+	running map[string]int
 }
 
 // 移除之前的 MessageBus 接口定义，直接使用 bus.MessageBus
@@ -184,6 +309,7 @@ func NewCronService(runner func(job *Job)) *CronService {
 		runner:     runner,
 		stopChan:   make(chan struct{}),
 		wakeupChan: make(chan struct{}, 1),
+		history:    historyState{runs: make(map[string][]Run), limit: DefaultHistoryLimit},
 	}
 }
 
@@ -203,6 +329,23 @@ func (c *CronService) SetAgentExecutor(executor AgentExecutor) {
 	c.agentExecutor = executor
 }
 
+// SetDefaultPermissions 设置 Agent 模式任务无人值守执行时的默认工具权限
+// 任务自己设置了 Permissions 时以任务为准
+// 参数：
+//   - perms: 默认权限，nil 表示不限制
+func (c *CronService) SetDefaultPermissions(perms *Permissions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.defaultPerms = perms
+}
+
+// DefaultPermissions 返回 Agent 模式任务的默认工具权限（nil 表示不限制）
+func (c *CronService) DefaultPermissions() *Permissions {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.defaultPerms
+}
+
 // SetMessageBus 设置消息总线
 // 用于发送 Agent 执行结果到通信通道
 func (c *CronService) SetMessageBus(msgBus *bus.MessageBus) {
@@ -211,6 +354,22 @@ func (c *CronService) SetMessageBus(msgBus *bus.MessageBus) {
 	c.messageBus = msgBus
 }
 
+// BuiltinFunc 执行一个内置任务，返回要发送到任务频道的内容（为空表示不发送）
+type BuiltinFunc func(job *Job) (string, error)
+
+// RegisterBuiltin 注册内置任务类型的处理函数
+// 参数：
+//   - kind: 任务类型（Job.Builtin）
+//   - fn: 处理函数
+func (c *CronService) RegisterBuiltin(kind string, fn BuiltinFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.builtins == nil {
+		c.builtins = make(map[string]BuiltinFunc)
+	}
+	c.builtins[kind] = fn
+}
+
 // Start 启动定时任务服务
 //
 // 启动一个后台 goroutine 运行任务调度循环。
@@ -272,9 +431,16 @@ func (c *CronService) AddJob(job *Job) *Job {
 	defer c.mu.Unlock()
 
 	now := time.Now()
-	job.ID = fmt.Sprintf("job_%d", now.UnixNano())
+	if job.ID == "" {
+		job.ID = fmt.Sprintf("job_%d", now.UnixNano())
+	}
 	job.CreatedAt = now
-	job.NextRun = c.calculateNextRun(job.Schedule)
+	if !job.LastRun.IsZero() && job.Schedule.Kind != "at" {
+		// 恢复的任务从上次执行时间开始计算，停机期间错过的执行会在第一次检查时按 Misfire 策略处理
+		job.NextRun = c.nextRunAfter(job.Schedule, job.LastRun)
+	} else {
+		job.NextRun = c.calculateNextRun(job.Schedule)
+	}
 
 	// 【性能优化】简化日志输出
 	timeUntilRun := job.NextRun.Sub(now)
@@ -288,29 +454,37 @@ func (c *CronService) AddJob(job *Job) *Job {
 	return job
 }
 
-// executeJob 执行任务（支持 Agent 模式和 Message 模式）
+// executeJob 执行任务（支持 Agent 模式和 Message 模式），并记录执行结果
 func (c *CronService) executeJob(job *Job) {
 	// 记录任务信息以便调试
 	log.Printf("[Cron] 📋 任务详情: ID=%s, Name=%s, Channel=%q, ChatID=%q, TriggerAgent=%v",
 		job.ID, job.Name, job.Channel, job.To, job.TriggerAgent)
 
-	// 优先使用 Agent 模式
-	if job.TriggerAgent {
-		c.executeAgentJob(job)
-		return
-	}
-
-	// 兼容旧版：使用 runner 回调
-	if c.runner != nil {
+	start := time.Now()
+	var response string
+	var err error
+	switch {
+	case job.Builtin != "":
+		// 内置任务
+		response, err = c.executeBuiltinJob(job)
+	case job.TriggerAgent:
+		// 优先使用 Agent 模式
+		response, err = c.executeAgentJob(job)
+	case c.runner != nil:
+		// 兼容旧版：使用 runner 回调
 		log.Printf("[Cron] 📨 使用 runner 回调发送消息")
 		c.runner(job)
-	} else {
+		response = job.Message
+	default:
 		log.Printf("[Cron] ⚠ 警告：runner 为 nil，任务 %s 未执行", job.Name)
+		err = fmt.Errorf("no runner configured")
 	}
+	c.recordRun(job, start, response, err)
 }
 
 // executeAgentJob 执行 Agent 模式的任务
-func (c *CronService) executeAgentJob(job *Job) {
+// 返回 Agent 的回复，或者任务无法执行、执行失败的原因
+func (c *CronService) executeAgentJob(job *Job) (string, error) {
 	// 【关键调试】在函数入口就输出日志
 	log.Printf("[Cron] 🔵 executeAgentJob 开始执行: 任务=%s", job.Name)
 	// 强制刷新日志
@@ -321,6 +495,10 @@ func (c *CronService) executeAgentJob(job *Job) {
 	log.Printf("[Cron] 🔵 已获取锁")
 	executor := c.agentExecutor
 	msgBus := c.messageBus
+	perms := job.Permissions
+	if perms == nil {
+		perms = c.defaultPerms
+	}
 	c.mu.RUnlock()
 	// 强制刷新日志
 	// os.Stdout.Sync()
@@ -329,12 +507,12 @@ func (c *CronService) executeAgentJob(job *Job) {
 
 	if executor == nil {
 		log.Printf("[Cron] ⚠ 警告：AgentExecutor 未设置，任务 %s 无法执行", job.Name)
-		return
+		return "", fmt.Errorf("agent executor is not configured")
 	}
 
 	if msgBus == nil {
 		log.Printf("[Cron] ⚠ 警告：MessageBus 未设置，任务 %s 无法发送结果", job.Name)
-		return
+		return "", fmt.Errorf("message bus is not configured")
 	}
 
 	log.Printf("[Cron] 🤖 触发 Agent 执行前: 命令=%s, Channel=%s, ChatID=%s", job.AgentCommand, job.Channel, job.To)
@@ -342,24 +520,39 @@ func (c *CronService) executeAgentJob(job *Job) {
 	// 验证任务字段
 	if job.Channel == "" {
 		log.Printf("[Cron] ⚠ 警告：任务的 Channel 为空！")
-		return
+		return "", fmt.Errorf("job has no channel")
 	}
 	if job.To == "" {
 		log.Printf("[Cron] ⚠ 警告：任务的 ChatID 为空！")
-		return
+		return "", fmt.Errorf("job has no chat ID")
 	}
 
-	// 调用 Agent 执行命令
+	// 调用 Agent 执行命令，超过 MaxRuntime 时取消
 	log.Printf("[Cron] 🔄 准备调用 ProcessDirect...")
 	ctx := context.Background()
-	response, err := executor.ProcessDirectWithContext(ctx, job.Channel, job.To, job.AgentCommand)
+	if job.MaxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.MaxRuntime)
+		defer cancel()
+	}
+	var response string
+	var err error
+	if perms != nil {
+		log.Printf("[Cron] 🔒 以受限权限执行: %s", perms)
+		response, err = executor.ProcessDirectWithPermissions(ctx, job.Channel, job.To, job.AgentCommand, *perms)
+	} else {
+		response, err = executor.ProcessDirectWithContext(ctx, job.Channel, job.To, job.AgentCommand)
+	}
 	log.Printf("[Cron] 🔄 ProcessDirect 返回: response长度=%d, err=%v", len(response), err)
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("exceeded max runtime of %s", job.MaxRuntime)
+	}
 
 	if err != nil {
 		log.Printf("[Cron] ❌ Agent 执行失败: %v", err)
 		// 发送错误消息
-		c.sendResult(msgBus, job, fmt.Sprintf("❌ 任务执行失败: %v", err))
-		return
+		c.sendResult(msgBus, job, i18n.T(i18n.Default(), "cron_failed", err))
+		return "", err
 	}
 
 	log.Printf("[Cron] ✓ Agent 执行成功，响应长度: %d 字符", len(response))
@@ -368,6 +561,49 @@ func (c *CronService) executeAgentJob(job *Job) {
 	c.sendResult(msgBus, job, response)
 
 	log.Printf("[Cron] ✅ executeAgentJob 执行完成")
+	return response, nil
+}
+
+// waitJitter 在执行任务前等待 [0, Jitter) 的随机时间
+// 返回 false 表示等待期间服务已停止，不应再执行任务
+func (c *CronService) waitJitter(job *Job) bool {
+	if job.Jitter <= 0 {
+		return true
+	}
+	delay := rand.N(job.Jitter)
+	log.Printf("[Cron] 🎲 任务 %s 随机延迟 %s 后执行", job.Name, delay.Round(time.Second))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.stopChan:
+		return false
+	}
+}
+
+// executeBuiltinJob 执行内置任务，并把结果发送到任务频道
+// 返回处理函数的结果或错误
+func (c *CronService) executeBuiltinJob(job *Job) (string, error) {
+	c.mu.RLock()
+	fn := c.builtins[job.Builtin]
+	msgBus := c.messageBus
+	c.mu.RUnlock()
+
+	if fn == nil {
+		log.Printf("[Cron] ⚠ 警告：内置任务类型 %q 未注册，任务 %s 未执行", job.Builtin, job.Name)
+		return "", fmt.Errorf("builtin job type %q is not registered", job.Builtin)
+	}
+	result, err := fn(job)
+	content := result
+	if err != nil {
+		log.Printf("[Cron] ❌ 内置任务 %s 执行失败: %v", job.Name, err)
+		content = i18n.T(i18n.Default(), "cron_failed", err)
+	}
+	if content != "" && msgBus != nil {
+		c.sendResult(msgBus, job, content)
+	}
+	return result, err
 }
 
 // sendResult 发送任务执行结果到通信通道
@@ -464,6 +700,67 @@ func (c *CronService) RemoveJob(id string) bool {
 	return true
 }
 
+// ConfigJobPrefix 是配置文件中定义的任务 ID 前缀
+const ConfigJobPrefix = "config:"
+
+// SyncConfigJobs 用配置文件中定义的任务替换之前同步的配置任务
+// 用于启动和配置热重载：
+//   - 配置中已删除的任务会被移除
+//   - 定义发生变化的任务会重新调度
+//   - 定义未变的任务保持原有的下次执行时间
+//
+// 参数：
+//   - jobs: 配置中定义的任务，ID 必须以 ConfigJobPrefix 开头
+//
+// 返回：
+//   - added: 新增或重新调度的任务数
+//   - removed: 移除的任务数
+func (c *CronService) SyncConfigJobs(jobs []*Job) (added int, removed int) {
+	wanted := make(map[string]*Job, len(jobs))
+	for _, job := range jobs {
+		wanted[job.ID] = job
+	}
+
+	for _, existing := range c.ListJobs() {
+		if !strings.HasPrefix(existing.ID, ConfigJobPrefix) {
+			continue
+		}
+		if job, ok := wanted[existing.ID]; ok && sameDefinition(existing, job) {
+			delete(wanted, existing.ID)
+			continue
+		}
+		c.RemoveJob(existing.ID)
+		removed++
+	}
+
+	for _, job := range jobs {
+		if _, ok := wanted[job.ID]; ok {
+			c.AddJob(job)
+			added++
+		}
+	}
+	return added, removed
+}
+
+// sameDefinition 判断两个任务的定义是否相同（忽略 ID 以外的运行时字段）
+func sameDefinition(a, b *Job) bool {
+	return a.Name == b.Name &&
+		a.Message == b.Message &&
+		a.Schedule == b.Schedule &&
+		a.Channel == b.Channel &&
+		a.To == b.To &&
+		a.TriggerAgent == b.TriggerAgent &&
+		a.AgentCommand == b.AgentCommand &&
+		a.HideFromCalendar == b.HideFromCalendar &&
+		a.Builtin == b.Builtin &&
+		reflect.DeepEqual(a.Variables, b.Variables) &&
+		a.Misfire == b.Misfire &&
+		a.AllowOverlap == b.AllowOverlap &&
+		a.MaxRuntime == b.MaxRuntime &&
+		a.Jitter == b.Jitter &&
+		reflect.DeepEqual(a.Permissions, b.Permissions)
+}
+
 // ListJobs 列出所有任务
 //
 // 返回：
@@ -515,42 +812,128 @@ func (c *CronService) calculateNextRun(schedule Schedule) time.Time {
 // 支持标准 cron 表达式格式：
 //   - 5 字段：分 时 日 月 周 (如 "0 9 * * *" 表示每天 9 点)
 //   - 支持特殊字符：* / , -
+//   - 扩展写法：周字段 "1#1"（每月第一个星期一）、"5L"（每月最后一个星期五），日字段 "L"（每月最后一天）
 //
 // 时区处理：
 //   - 如果指定了 TZ 字段，使用该时区计算
 //   - 否则使用本地时区
 func (c *CronService) calculateCronNextRun(schedule Schedule, now time.Time) time.Time {
-	// 创建 cron parser，使用 5 字段格式（分 时 日 月 周）
-	// 注意：不包含秒字段，与标准 Linux cron 一致
-	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-
-	// 解析 cron 表达式
-	sched, err := parser.Parse(schedule.CronExpr)
+	nextTime, err := cronNext(schedule, now)
 	if err != nil {
-		log.Printf("[Cron] ⚠ 警告：解析 cron 表达式失败: %s, 错误: %v", schedule.CronExpr, err)
+		log.Printf("[Cron] ⚠ 警告：%v", err)
 		// 解析失败时，默认 1 小时后执行
 		return now.Add(1 * time.Hour)
 	}
 
+	log.Printf("[Cron] ✓ Cron 表达式解析成功: %s -> 下次执行: %v",
+		schedule.CronExpr, nextTime.Format("2006-01-02 15:04:05"))
+
+	return nextTime
+}
+
+// cronNext 计算 cron 表达式在 from 之后的下一次执行时间（不输出日志）
+func cronNext(schedule Schedule, from time.Time) (time.Time, error) {
+	// 解析 cron 表达式（5 字段格式：分 时 日 月 周，支持 phrase.go 中的扩展写法）
+	sched, err := parseCronExpr(schedule.CronExpr)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("解析 cron 表达式失败: %s, 错误: %v", schedule.CronExpr, err)
+	}
+
 	// 处理时区
-	baseTime := now
+	baseTime := from
 	if schedule.TZ != "" {
 		// 如果指定了时区，转换为该时区
-		loc, err := time.LoadLocation(schedule.TZ)
+		if loc, err := time.LoadLocation(schedule.TZ); err == nil {
+			baseTime = from.In(loc)
+		}
+	}
+
+	return sched.Next(baseTime), nil
+}
+
+// ValidateSchedule 检查调度配置是否有效
+// 用于在添加任务前拒绝无法执行的调度（例如错误的 cron 表达式）
+func ValidateSchedule(schedule Schedule) error {
+	switch schedule.Kind {
+	case "every":
+		if schedule.EveryMs <= 0 {
+			return fmt.Errorf("every interval must be positive")
+		}
+	case "at":
+		if schedule.AtMs <= 0 {
+			return fmt.Errorf("at time is required")
+		}
+	case "cron":
+		if schedule.TZ != "" {
+			if _, err := time.LoadLocation(schedule.TZ); err != nil {
+				return fmt.Errorf("invalid time zone %q: %v", schedule.TZ, err)
+			}
+		}
+		if _, err := cronNext(schedule, time.Now()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown schedule kind %q (expected every, cron or at)", schedule.Kind)
+	}
+	return nil
+}
+
+// nextRunAfter 计算周期性任务在 from 之后的下一次执行时间
+// 用于统计错过的执行，不输出日志；"at" 类型没有下一次，返回零值
+func (c *CronService) nextRunAfter(schedule Schedule, from time.Time) time.Time {
+	switch schedule.Kind {
+	case "every":
+		if schedule.EveryMs <= 0 {
+			return time.Time{}
+		}
+		return from.Add(time.Duration(schedule.EveryMs) * time.Millisecond)
+	case "cron":
+		next, err := cronNext(schedule, from)
 		if err != nil {
-			log.Printf("[Cron] ⚠ 警告：加载时区失败: %s, 错误: %v，使用本地时区", schedule.TZ, err)
-		} else {
-			baseTime = now.In(loc)
+			return from.Add(1 * time.Hour)
 		}
+		return next
+	default:
+		return time.Time{}
 	}
+}
 
-	// 计算下次执行时间
-	nextTime := sched.Next(baseTime)
+// missedRuns 统计任务在 now 之前错过的执行次数，并返回之后的下一次执行时间
+// "at" 类型任务错过一次，没有下一次执行时间
+func (c *CronService) missedRuns(job *Job, now time.Time) (int, time.Time) {
+	missed := 0
+	next := job.NextRun
+	for !next.IsZero() && !next.After(now) {
+		missed++
+		if missed > 100000 {
+			// 间隔极短的任务停机很久时避免长时间循环
+			next = c.calculateNextRun(job.Schedule)
+			break
+		}
+		next = c.nextRunAfter(job.Schedule, next)
+	}
+	return missed, next
+}
 
-	log.Printf("[Cron] ✓ Cron 表达式解析成功: %s -> 下次执行: %v",
-		schedule.CronExpr, nextTime.Format("2006-01-02 15:04:05"))
+// misfireRuns 按任务的错过执行策略决定现在执行几次，并返回之后的下一次执行时间
+// 调用者需持有锁
+func (c *CronService) misfireRuns(job *Job, now time.Time) (int, time.Time) {
+	missed, next := c.missedRuns(job, now)
+	policy := job.Misfire
+	if policy == "" {
+		policy = MisfireRunOnce
+	}
 
-	return nextTime
+	runs := 0
+	switch policy {
+	case MisfireRunOnce:
+		runs = 1
+	case MisfireRunAll:
+		runs = min(missed, maxCatchUpRuns)
+	}
+	log.Printf("[Cron] ⚠ 任务 %s 错过了 %d 次执行（应在 %s 执行），按 %s 策略补执行 %d 次",
+		job.Name, missed, job.NextRun.Format("2006-01-02 15:04:05"), policy, runs)
+	return runs, next
 }
 
 // runLoop 运行任务调度循环（智能唤醒版本）
@@ -674,26 +1057,59 @@ func (c *CronService) checkAndRun() {
 		// 从堆中弹出到期任务（O(log n)）
 		heap.Pop(c.heap)
 
+		// 超过宽限时间才检查到的任务按错过执行策略处理
+		runs := 1
+		var next time.Time
+		if late := now.Sub(item.job.NextRun); late > misfireGrace {
+			runs, next = c.misfireRuns(item.job, now)
+		}
+
+		// 上一次执行尚未结束时跳过这一次（允许重叠的任务最多同时执行 maxOverlappingRuns 次），
+		// 执行很慢的周期性任务不会不断堆积 goroutine
+		if n := c.running[item.job.ID]; runs > 0 && n > 0 && (!item.job.AllowOverlap || n >= maxOverlappingRuns) {
+			log.Printf("[Cron] ⏭ 跳过任务 %s：上一次执行尚未结束（正在执行 %d 次）", item.job.Name, n)
+			runs = 0
+		}
+
 		// 【性能优化】只在有任务执行时才输出日志，避免频繁 I/O
 		modeDesc := "message"
 		if item.job.TriggerAgent {
 			modeDesc = "agent"
 		}
-		log.Printf("[Cron] ✓ 执行任务: %s (Kind=%s, Mode=%s)", item.job.Name, item.job.Schedule.Kind, modeDesc)
-		processedCount++
+		if runs > 0 {
+			log.Printf("[Cron] ✓ 执行任务: %s (Kind=%s, Mode=%s, 次数=%d)", item.job.Name, item.job.Schedule.Kind, modeDesc, runs)
+			processedCount++
+			item.job.LastRun = now
+		}
 
 		// 在独立 goroutine 中执行任务，避免阻塞调度循环
 		jobCopy := *item.job // 复制任务，避免并发问题
-		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					log.Printf("[Cron] ❌ 任务执行 panic: %v", r)
+		if runs > 0 {
+			if c.running == nil {
+				c.running = make(map[string]int)
+			}
+			c.running[jobCopy.ID]++
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						log.Printf("[Cron] ❌ 任务执行 panic: %v", r)
+					}
+					c.mu.Lock()
+					if c.running[jobCopy.ID]--; c.running[jobCopy.ID] <= 0 {
+						delete(c.running, jobCopy.ID)
+					}
+					c.mu.Unlock()
+				}()
+				if !c.waitJitter(&jobCopy) {
+					return
+				}
+				for i := 0; i < runs; i++ {
+					log.Printf("[Cron] 🔄 Goroutine 开始执行任务: %s", jobCopy.Name)
+					c.executeJob(&jobCopy)
+					log.Printf("[Cron] 🔄 Goroutine 完成执行任务: %s", jobCopy.Name)
 				}
 			}()
-			log.Printf("[Cron] 🔄 Goroutine 开始执行任务: %s", jobCopy.Name)
-			c.executeJob(&jobCopy)
-			log.Printf("[Cron] 🔄 Goroutine 完成执行任务: %s", jobCopy.Name)
-		}()
+		}
 
 		// 处理任务后续：删除或重新调度
 		// 【关键修复】确保 "at" 类型任务只执行一次，即使 DeleteAfterRun 标志错误
@@ -703,8 +1119,11 @@ func (c *CronService) checkAndRun() {
 			delete(c.jobs, item.job.ID)
 			log.Printf("[Cron] ✓ 一次性任务已从 map 删除: %s", item.job.Name)
 		} else {
-			// 周期性任务，重新计算下次执行时间
-			item.job.NextRun = c.calculateNextRun(item.job.Schedule)
+			// 周期性任务，重新计算下次执行时间（错过执行时接着错过的周期往后排）
+			if next.IsZero() {
+				next = c.calculateNextRun(item.job.Schedule)
+			}
+			item.job.NextRun = next
 			// 重新插入堆中（O(log n)）
 			heap.Push(c.heap, item)
 			log.Printf("[Cron] ✓ 周期性任务已重新调度: %s, 下次: %v", item.job.Name, item.job.NextRun)
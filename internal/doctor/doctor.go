@@ -0,0 +1,263 @@
+// Package doctor 检查 nanogrip 的运行环境（nanogrip doctor 和 gateway 启动检查）
+//
+// 每项检查实际调用一次外部服务：工作区是否可写、LLM 提供商能否完成一次极短的对话、
+// 各频道的凭据是否有效、网络搜索的 API 密钥是否可用、MCP 服务器能否启动。
+// 检查失败时给出可以照着操作的修复建议，而不是只报告错误。
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/channels"
+	"github.com/Ailoc/nanogrip/internal/mcp"
+	"github.com/Ailoc/nanogrip/internal/providers"
+	"github.com/Ailoc/nanogrip/internal/tools"
+)
+
+// DefaultTimeout 每项检查的默认超时时间
+const DefaultTimeout = 30 * time.Second
+
+// Check 一项检查
+type Check struct {
+	Name string                                    // 检查名称，例如 "provider claude-sonnet-4"
+	Run  func(ctx context.Context) (string, error) // 执行检查，成功时返回简短说明
+	Hint string                                    // 检查失败时的修复建议
+}
+
+// Result 一项检查的结果
+type Result struct {
+	Name     string
+	Detail   string // 成功时的说明
+	Err      error  // 失败原因，nil 表示通过
+	Hint     string // 失败时的修复建议
+	Duration time.Duration
+}
+
+// OK 检查是否通过
+func (r Result) OK() bool {
+	return r.Err == nil
+}
+
+// Run 并行执行所有检查，结果顺序与 checks 相同
+// 参数:
+//
+//	timeout: 每项检查的超时时间，超时的检查记为失败（不等待它结束）
+func Run(ctx context.Context, checks []Check, timeout time.Duration) []Result {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = runOne(ctx, check, timeout)
+		}(i, check)
+	}
+	wg.Wait()
+	return results
+}
+
+// runOne 执行一项检查
+func runOne(ctx context.Context, check Check, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type outcome struct {
+		detail string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		detail, err := check.Run(ctx)
+		done <- outcome{detail, err}
+	}()
+
+	result := Result{Name: check.Name, Hint: check.Hint}
+	select {
+	case out := <-done:
+		result.Detail, result.Err = out.detail, out.err
+	case <-ctx.Done():
+		result.Err = fmt.Errorf("timed out after %s", timeout)
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// Failed 返回失败的检查数量
+func Failed(results []Result) int {
+	failed := 0
+	for _, r := range results {
+		if !r.OK() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Format 把检查结果格式化为每项一行（失败的检查附带原因和修复建议）
+func Format(results []Result) string {
+	var sb strings.Builder
+	for _, r := range results {
+		if r.OK() {
+			fmt.Fprintf(&sb, "✓ %s", r.Name)
+			if r.Detail != "" {
+				fmt.Fprintf(&sb, ": %s", r.Detail)
+			}
+			fmt.Fprintf(&sb, " (%s)\n", r.Duration.Round(time.Millisecond))
+			continue
+		}
+		fmt.Fprintf(&sb, "✗ %s: %v\n", r.Name, r.Err)
+		if r.Hint != "" {
+			fmt.Fprintf(&sb, "  → %s\n", r.Hint)
+		}
+	}
+	return sb.String()
+}
+
+// Workspace 检查工作区存在并且可写
+func Workspace(path string) Check {
+	return Check{
+		Name: "workspace",
+		Hint: fmt.Sprintf("运行 nanogrip init 创建工作区，或检查 %s 的权限和磁盘空间（也可以在配置文件中修改 workspace）", path),
+		Run: func(ctx context.Context) (string, error) {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return "", err
+			}
+			probe, err := os.CreateTemp(path, ".doctor-*")
+			if err != nil {
+				return "", err
+			}
+			name := probe.Name()
+			_, writeErr := probe.WriteString("ok")
+			closeErr := probe.Close()
+			os.Remove(name)
+			if writeErr != nil {
+				return "", writeErr
+			}
+			if closeErr != nil {
+				return "", closeErr
+			}
+			return path, nil
+		},
+	}
+}
+
+// Provider 检查 LLM 提供商：发送一次极短的对话
+// 参数:
+//
+//	provider: 提供商，创建失败时传入 nil 和 createErr
+//	model: 模型名称
+func Provider(provider providers.LLMProvider, model string, createErr error) Check {
+	return Check{
+		Name: "provider " + model,
+		Hint: "检查 providers.anthropic / providers.openai 的 apiKey 和 apiBase，以及 agents.defaults.model 是否是该提供商支持的模型名称",
+		Run: func(ctx context.Context) (string, error) {
+			if createErr != nil {
+				return "", createErr
+			}
+			resp, err := provider.Chat(ctx, []providers.Message{
+				{Role: "user", Content: "Reply with the single word OK."},
+			}, nil, model, 16, 0)
+			if err != nil {
+				return "", err
+			}
+			if resp.FinishReason == "error" {
+				return "", fmt.Errorf("%s", strings.TrimSpace(resp.Content))
+			}
+			return fmt.Sprintf("replied %q", truncate(strings.TrimSpace(resp.Content), 20)), nil
+		},
+	}
+}
+
+// Embeddings 检查文本向量提供商：计算一条短文本的向量
+// 参数:
+//
+//	embeddings: 向量提供商，创建失败时传入 nil 和 createErr
+//	name: 配置中的提供商名称
+func Embeddings(embeddings providers.EmbeddingsProvider, name string, createErr error) Check {
+	return Check{
+		Name: "embeddings " + name,
+		Hint: "检查 providers.embeddings 的 provider、model、apiKey 和 apiBase（ollama 需要先运行 ollama pull <模型>）",
+		Run: func(ctx context.Context) (string, error) {
+			if createErr != nil {
+				return "", createErr
+			}
+			vectors, err := embeddings.Embed(ctx, []string{"nanogrip"})
+			if err != nil {
+				return "", err
+			}
+			if len(vectors) != 1 || len(vectors[0]) == 0 {
+				return "", fmt.Errorf("empty embedding returned")
+			}
+			return fmt.Sprintf("%s, %d dimensions", embeddings.Model(), len(vectors[0])), nil
+		},
+	}
+}
+
+// Channel 检查频道凭据
+// 参数:
+//
+//	name: 频道名称
+//	channel: 频道实例（只调用 Check，不需要启动）
+//	hint: 检查失败时的修复建议
+func Channel(name string, channel channels.Checker, hint string) Check {
+	return Check{
+		Name: "channel " + name,
+		Hint: hint,
+		Run: func(ctx context.Context) (string, error) {
+			return channel.Check()
+		},
+	}
+}
+
+// WebSearch 检查网络搜索：用主提供商执行一次测试搜索
+func WebSearch(search *tools.WebSearchTool, provider string) Check {
+	return Check{
+		Name: "web search " + provider,
+		Hint: "检查 tools.web.search 的 provider、apiKey（google 还需要 cx，searxng 需要 baseUrl）；不需要搜索时可以设置 provider: duckduckgo",
+		Run: func(ctx context.Context) (string, error) {
+			if err := search.Check(ctx); err != nil {
+				return "", err
+			}
+			return "test query succeeded", nil
+		},
+	}
+}
+
+// MCPServer 检查 MCP 服务器能否启动并列出工具（检查结束后停止）
+func MCPServer(name string, cfg mcp.MCPConfig) Check {
+	hint := fmt.Sprintf("检查 mcpServers.%s 的 url 是否可以访问、headers 中的令牌是否有效", name)
+	if cfg.Command != "" {
+		command := strings.Join(append([]string{cfg.Command}, cfg.Args...), " ")
+		hint = fmt.Sprintf("检查 mcpServers.%s 的命令能否在终端中直接运行：%s（命令是否已安装、在 PATH 中，所需的环境变量是否已设置）", name, command)
+	}
+	return Check{
+		Name: "mcp " + name,
+		Hint: hint,
+		Run: func(ctx context.Context) (string, error) {
+			client := mcp.NewMCPClient(name, &cfg)
+			if err := client.Start(); err != nil {
+				return "", err
+			}
+			defer client.Stop()
+			return fmt.Sprintf("%d tools", len(client.GetTools())), nil
+		},
+	}
+}
+
+// truncate 按字符截断文本
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max]) + "…"
+}
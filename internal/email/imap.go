@@ -0,0 +1,474 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IMAPOptions 是 IMAP 服务器的连接信息
+type IMAPOptions struct {
+	Host     string // 服务器地址
+	Port     int    // 端口（993 使用隐式 TLS，其他端口使用 STARTTLS）
+	Username string // 登录用户名
+	Password string // 登录密码
+}
+
+// Criteria 是邮件搜索条件，空字段表示不限制
+type Criteria struct {
+	Mailbox string    // 邮箱文件夹，默认 INBOX
+	Text    string    // 在邮件头和正文中搜索
+	From    string    // 发件人包含
+	Subject string    // 主题包含
+	Since   time.Time // 此日期（含）之后收到的邮件
+	Unseen  bool      // 只搜索未读邮件
+	Limit   int       // 最多返回的邮件数（最新的优先），默认 10
+}
+
+// Summary 是搜索结果中的一封邮件
+type Summary struct {
+	UID     uint32
+	From    string
+	Subject string
+	Date    string
+	Seen    bool
+}
+
+// Mail 是读取到的完整邮件
+type Mail struct {
+	Summary
+	To          string
+	Body        string   // 纯文本正文（只有 HTML 时为去掉标签后的文本）
+	HTML        bool     // 正文是否来自 HTML
+	Attachments []string // 附件文件名
+}
+
+// Search 搜索邮件，按收到时间从新到旧返回
+// 参数:
+//
+//	ctx: 上下文对象
+//	opts: IMAP 服务器连接信息
+//	c: 搜索条件
+func Search(ctx context.Context, opts IMAPOptions, c Criteria) ([]Summary, error) {
+	conn, err := dialIMAP(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.logout()
+
+	if _, err := conn.command("EXAMINE " + quoteIMAP(mailboxName(c.Mailbox))); err != nil {
+		return nil, err
+	}
+
+	lines, err := conn.command("UID SEARCH " + searchQuery(c))
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, line := range lines {
+		if fields := strings.Fields(line.text); len(fields) >= 2 && fields[0] == "*" && strings.EqualFold(fields[1], "SEARCH") {
+			for _, f := range fields[2:] {
+				if n, err := strconv.ParseUint(f, 10, 32); err == nil {
+					uids = append(uids, uint32(n))
+				}
+			}
+		}
+	}
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(uids, func(i, j int) bool { return uids[i] > uids[j] })
+	limit := c.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	if len(uids) > limit {
+		uids = uids[:limit]
+	}
+
+	set := make([]string, len(uids))
+	for i, uid := range uids {
+		set[i] = strconv.FormatUint(uint64(uid), 10)
+	}
+	lines, err = conn.command("UID FETCH " + strings.Join(set, ",") + " (UID FLAGS BODY.PEEK[HEADER.FIELDS (FROM SUBJECT DATE)])")
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Summary
+	for _, line := range lines {
+		uid, ok := fetchUID(line.text)
+		if !ok || len(line.literals) == 0 {
+			continue
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(append(line.literals[0], '\r', '\n')))
+		if err != nil {
+			continue
+		}
+		results = append(results, Summary{
+			UID:     uid,
+			From:    decodeHeader(msg.Header.Get("From")),
+			Subject: decodeHeader(msg.Header.Get("Subject")),
+			Date:    msg.Header.Get("Date"),
+			Seen:    strings.Contains(line.text, `\Seen`),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].UID > results[j].UID })
+	return results, nil
+}
+
+// Fetch 读取一封邮件（不会标记为已读）
+// 参数:
+//
+//	ctx: 上下文对象
+//	opts: IMAP 服务器连接信息
+//	mailbox: 邮箱文件夹，默认 INBOX
+//	uid: 邮件 UID（来自 Search 的结果）
+func Fetch(ctx context.Context, opts IMAPOptions, mailbox string, uid uint32) (*Mail, error) {
+	conn, err := dialIMAP(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.logout()
+
+	if _, err := conn.command("EXAMINE " + quoteIMAP(mailboxName(mailbox))); err != nil {
+		return nil, err
+	}
+	lines, err := conn.command(fmt.Sprintf("UID FETCH %d (UID FLAGS BODY.PEEK[])", uid))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		if got, ok := fetchUID(line.text); !ok || got != uid || len(line.literals) == 0 {
+			continue
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(line.literals[0]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse message: %w", err)
+		}
+		result := &Mail{
+			Summary: Summary{
+				UID:     uid,
+				From:    decodeHeader(msg.Header.Get("From")),
+				Subject: decodeHeader(msg.Header.Get("Subject")),
+				Date:    msg.Header.Get("Date"),
+				Seen:    strings.Contains(line.text, `\Seen`),
+			},
+			To: decodeHeader(msg.Header.Get("To")),
+		}
+		var plain, html string
+		walkParts(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), "", msg.Body, &plain, &html, &result.Attachments)
+		if plain != "" {
+			result.Body = plain
+		} else {
+			result.Body = html
+			result.HTML = html != ""
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("message %d not found", uid)
+}
+
+// walkParts 递归遍历 MIME 结构，收集第一个纯文本正文、第一个 HTML 正文和附件文件名
+func walkParts(contentType, encoding, disposition string, body io.Reader, plain, html *string, attachments *[]string) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err != nil {
+				return
+			}
+			walkParts(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part.Header.Get("Content-Disposition"), part, plain, html, attachments)
+		}
+	}
+
+	if d, dparams, err := mime.ParseMediaType(disposition); err == nil && d == "attachment" || params["name"] != "" {
+		name := dparams["filename"]
+		if name == "" {
+			name = params["name"]
+		}
+		if name == "" {
+			name = "(unnamed " + mediaType + ")"
+		}
+		*attachments = append(*attachments, decodeHeader(name))
+		return
+	}
+
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(decodeTransfer(body, encoding), 5*1024*1024))
+	if err != nil && len(data) == 0 {
+		return
+	}
+	text := decodeCharset(data, params["charset"])
+	if mediaType == "text/plain" && *plain == "" {
+		*plain = text
+	} else if mediaType == "text/html" && *html == "" {
+		*html = text
+	}
+}
+
+// decodeTransfer 处理 Content-Transfer-Encoding
+func decodeTransfer(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+// newlineStripper 去掉 base64 内容中的换行符
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (s *newlineStripper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	j := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			p[j] = b
+			j++
+		}
+	}
+	return j, err
+}
+
+// decodeCharset 把常见字符集转换为 UTF-8（ISO-8859-1 按字节转换，其他字符集原样返回）
+func decodeCharset(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	default:
+		return strings.ToValidUTF8(string(data), "")
+	}
+}
+
+// decodeHeader 解码 RFC 2047 编码的邮件头
+func decodeHeader(value string) string {
+	dec := &mime.WordDecoder{}
+	if decoded, err := dec.DecodeHeader(value); err == nil {
+		return decoded
+	}
+	return value
+}
+
+// ===== IMAP 协议 =====
+
+// imapConn 是一个 IMAP 连接
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapLine 是一条服务器响应，字面量（{n}）的内容单独保存
+type imapLine struct {
+	text     string
+	literals [][]byte
+}
+
+var fetchUIDRe = regexp.MustCompile(`(?i)\bUID (\d+)`)
+
+// dialIMAP 连接并登录 IMAP 服务器
+func dialIMAP(ctx context.Context, opts IMAPOptions) (*imapConn, error) {
+	port := opts.Port
+	if port == 0 {
+		port = 993
+	}
+	addr := net.JoinHostPort(opts.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: opts.Host}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connect %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(5 * time.Minute))
+	}
+	if port == 993 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("imap greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting.text, "* OK") && !strings.HasPrefix(greeting.text, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("imap greeting: %s", greeting.text)
+	}
+
+	if port != 993 {
+		if _, err := c.command("STARTTLS"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		c.conn = tlsConn
+		c.r = bufio.NewReader(tlsConn)
+	}
+
+	if _, err := c.command("LOGIN " + quoteIMAP(opts.Username) + " " + quoteIMAP(opts.Password)); err != nil {
+		c.conn.Close()
+		return nil, fmt.Errorf("imap login failed: %w", err)
+	}
+	return c, nil
+}
+
+// command 发送命令并读取响应，直到收到带标签的完成响应
+// 返回: 无标签的响应列表；完成响应不是 OK 时返回错误
+func (c *imapConn) command(cmd string) ([]imapLine, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, cmd); err != nil {
+		return nil, err
+	}
+
+	var lines []imapLine
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line.text, tag+" ") {
+			status := strings.TrimPrefix(line.text, tag+" ")
+			if !strings.HasPrefix(strings.ToUpper(status), "OK") {
+				verb := strings.Fields(cmd)[0]
+				return nil, fmt.Errorf("imap %s: %s", verb, status)
+			}
+			return lines, nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+// readLine 读取一条响应，包括其中的字面量
+func (c *imapConn) readLine() (imapLine, error) {
+	var line imapLine
+	var text strings.Builder
+	for {
+		s, err := c.r.ReadString('\n')
+		if err != nil {
+			return line, err
+		}
+		s = strings.TrimRight(s, "\r\n")
+
+		// 行尾的 {n} 表示后面紧跟 n 字节的字面量
+		if strings.HasSuffix(s, "}") {
+			if i := strings.LastIndex(s, "{"); i != -1 {
+				if n, err := strconv.Atoi(strings.TrimSuffix(s[i+1:len(s)-1], "+")); err == nil {
+					data := make([]byte, n)
+					if _, err := io.ReadFull(c.r, data); err != nil {
+						return line, err
+					}
+					text.WriteString(s[:i])
+					line.literals = append(line.literals, data)
+					continue
+				}
+			}
+		}
+		text.WriteString(s)
+		line.text = text.String()
+		return line, nil
+	}
+}
+
+// logout 退出并关闭连接
+func (c *imapConn) logout() {
+	c.command("LOGOUT")
+	c.conn.Close()
+}
+
+// quoteIMAP 把字符串转换为 IMAP 带引号的字符串
+func quoteIMAP(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// mailboxName 返回邮箱文件夹名称，默认 INBOX
+func mailboxName(mailbox string) string {
+	if mailbox == "" {
+		return "INBOX"
+	}
+	return mailbox
+}
+
+// searchQuery 生成 UID SEARCH 的条件
+func searchQuery(c Criteria) string {
+	var parts []string
+	if c.Unseen {
+		parts = append(parts, "UNSEEN")
+	}
+	if !c.Since.IsZero() {
+		parts = append(parts, "SINCE "+c.Since.Format("2-Jan-2006"))
+	}
+	if c.From != "" {
+		parts = append(parts, "FROM "+quoteIMAP(c.From))
+	}
+	if c.Subject != "" {
+		parts = append(parts, "SUBJECT "+quoteIMAP(c.Subject))
+	}
+	if c.Text != "" {
+		parts = append(parts, "TEXT "+quoteIMAP(c.Text))
+	}
+	if len(parts) == 0 {
+		return "ALL"
+	}
+	// 非 ASCII 的搜索词需要声明字符集
+	query := strings.Join(parts, " ")
+	for _, r := range query {
+		if r > 127 {
+			return "CHARSET UTF-8 " + query
+		}
+	}
+	return query
+}
+
+// fetchUID 从 FETCH 响应中读取 UID
+func fetchUID(text string) (uint32, bool) {
+	if !strings.Contains(strings.ToUpper(text), "FETCH") {
+		return 0, false
+	}
+	m := fetchUIDRe.FindStringSubmatch(text)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(m[1], 10, 32)
+	return uint32(n), err == nil
+}
@@ -0,0 +1,255 @@
+// Package email 提供发送（SMTP）和读取（IMAP）邮件的最小客户端
+//
+// 只依赖标准库，供 send_email / search_email 工具使用：
+//   - Send 通过 SMTP 发送邮件，支持抄送和附件；465 端口使用隐式 TLS，其他端口在服务器支持时使用 STARTTLS
+//   - Search / Fetch 通过 IMAP 以只读方式（EXAMINE + BODY.PEEK）搜索和读取邮件，不会把邮件标记为已读
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialTimeout 连接邮件服务器的超时时间
+const dialTimeout = 30 * time.Second
+
+// SMTPOptions 是 SMTP 服务器的连接信息
+type SMTPOptions struct {
+	Host     string // 服务器地址
+	Port     int    // 端口（465 使用隐式 TLS，其他端口尝试 STARTTLS）
+	Username string // 登录用户名，为空表示不认证
+	Password string // 登录密码
+	From     string // 发件人地址，为空时使用 Username
+}
+
+// Attachment 是一个附件
+type Attachment struct {
+	Name string // 文件名
+	Data []byte // 文件内容
+}
+
+// Message 是一封待发送的邮件
+type Message struct {
+	To          []string
+	Cc          []string
+	Subject     string
+	Body        string // 纯文本正文
+	Attachments []Attachment
+}
+
+// Sender 返回实际使用的发件人地址
+func (o SMTPOptions) Sender() string {
+	if o.From != "" {
+		return o.From
+	}
+	return o.Username
+}
+
+// Send 通过 SMTP 发送邮件
+// 参数:
+//
+//	ctx: 上下文对象（用于连接超时和取消）
+//	opts: SMTP 服务器连接信息
+//	msg: 邮件内容
+func Send(ctx context.Context, opts SMTPOptions, msg Message) error {
+	from := opts.Sender()
+	if from == "" {
+		return fmt.Errorf("no sender address configured")
+	}
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return fmt.Errorf("invalid sender address %q: %w", from, err)
+	}
+	recipients := append(append([]string{}, msg.To...), msg.Cc...)
+	if len(recipients) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+
+	data, err := buildMessage(fromAddr, msg)
+	if err != nil {
+		return err
+	}
+
+	client, err := dialSMTP(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if opts.Username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(smtp.PlainAuth("", opts.Username, opts.Password, opts.Host)); err != nil {
+				return fmt.Errorf("smtp auth: %w", err)
+			}
+		}
+	}
+	if err := client.Mail(fromAddr.Address); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	for _, rcpt := range recipients {
+		addr, err := mail.ParseAddress(rcpt)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", rcpt, err)
+		}
+		if err := client.Rcpt(addr.Address); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s: %w", addr.Address, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	return client.Quit()
+}
+
+// dialSMTP 连接 SMTP 服务器
+func dialSMTP(ctx context.Context, opts SMTPOptions) (*smtp.Client, error) {
+	port := opts.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(opts.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: opts.Host}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connect %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(5 * time.Minute))
+	}
+	if port == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, opts.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("smtp handshake: %w", err)
+	}
+	if port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				client.Close()
+				return nil, fmt.Errorf("smtp STARTTLS: %w", err)
+			}
+		}
+	}
+	return client, nil
+}
+
+// buildMessage 生成 MIME 邮件
+// 没有附件时是 text/plain，有附件时是 multipart/mixed
+func buildMessage(from *mail.Address, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+
+	header("From", from.String())
+	header("To", strings.Join(msg.To, ", "))
+	if len(msg.Cc) > 0 {
+		header("Cc", strings.Join(msg.Cc, ", "))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(from.Address))
+	header("MIME-Version", "1.0")
+
+	if len(msg.Attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+
+	textPart, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(textPart, msg.Body); err != nil {
+		return nil, err
+	}
+
+	for _, att := range msg.Attachments {
+		contentType := mime.TypeByExtension(filepath.Ext(att.Name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		name := mime.QEncoding.Encode("utf-8", att.Name)
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {fmt.Sprintf("%s; name=%q", contentType, name)},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", name)},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(att.Data)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeQuotedPrintable 以 quoted-printable 编码写入正文（换行统一转换为 CRLF）
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// messageID 生成唯一的 Message-ID
+func messageID(from string) string {
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i != -1 {
+		domain = from[i+1:]
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().Unix(), hex.EncodeToString(b), domain)
+}
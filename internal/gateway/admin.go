@@ -0,0 +1,186 @@
+package gateway
+
+// admin.go - 本机管理接口
+// 运行中的 gateway 通过工作区中的 unix socket 提供 HTTP 管理接口，
+// CLI 子命令（例如 "nanogrip cron list"）通过它操作运行中的服务。
+// socket 文件权限为 0600，只有运行 gateway 的用户可以访问，因此不需要令牌。
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// AdminSocketName 是管理接口 socket 在工作区中的文件名
+const AdminSocketName = "admin.sock"
+
+// AdminSocketPath 返回工作区对应的管理接口 socket 路径
+func AdminSocketPath(workspace string) string {
+	return filepath.Join(workspace, AdminSocketName)
+}
+
+// AdminServer 是通过 unix socket 提供的管理接口服务器
+type AdminServer struct {
+	path string         // socket 路径
+	mux  *http.ServeMux // 路由
+	srv  *http.Server   // 底层 HTTP 服务器
+}
+
+// NewAdminServer 创建一个新的管理接口服务器
+// 参数:
+//
+//	path: socket 路径（见 AdminSocketPath）
+func NewAdminServer(path string) *AdminServer {
+	mux := http.NewServeMux()
+	return &AdminServer{
+		path: path,
+		mux:  mux,
+		srv:  &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+	}
+}
+
+// Handle 注册一个处理器
+// 参数:
+//
+//	pattern: 路由模式，支持方法和路径参数（如 "DELETE /cron/{id}"）
+//	handler: 处理函数
+func (s *AdminServer) Handle(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// Start 在后台启动管理接口
+// 如果 socket 文件已存在且有服务在监听（另一个 gateway 正在运行），返回错误；
+// 否则视为上次异常退出遗留的文件并删除
+func (s *AdminServer) Start() error {
+	if _, err := os.Stat(s.path); err == nil {
+		if conn, err := net.DialTimeout("unix", s.path, time.Second); err == nil {
+			conn.Close()
+			return fmt.Errorf("another gateway is already listening on %s", s.path)
+		}
+		os.Remove(s.path)
+	}
+
+	ln, err := net.Listen("unix", s.path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(s.path, 0600); err != nil {
+		ln.Close()
+		return err
+	}
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[Gateway] 管理接口异常退出: %v", err)
+		}
+	}()
+	log.Printf("[Gateway] 管理接口已启动: %s", s.path)
+	return nil
+}
+
+// Stop 关闭管理接口并删除 socket 文件
+func (s *AdminServer) Stop(ctx context.Context) error {
+	err := s.srv.Shutdown(ctx)
+	os.Remove(s.path)
+	return err
+}
+
+// WriteJSON 以 JSON 格式写入响应
+func WriteJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// WriteError 以 {"error": "..."} 格式写入错误响应
+func WriteError(w http.ResponseWriter, status int, err error) {
+	WriteJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// ErrGatewayNotRunning 表示无法连接到运行中的 gateway
+var ErrGatewayNotRunning = errors.New("gateway is not running (start it with \"nanogrip gateway\")")
+
+// AdminClient 是管理接口的客户端
+type AdminClient struct {
+	path   string
+	client *http.Client
+}
+
+// NewAdminClient 创建连接到指定 socket 的管理接口客户端
+func NewAdminClient(path string) *AdminClient {
+	return &AdminClient{
+		path: path,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}
+}
+
+// Do 发送一个请求并把 JSON 响应解码到 out
+// 参数:
+//
+//	method: HTTP 方法
+//	path: 请求路径（如 "/cron"）
+//	body: 请求体（为 nil 表示没有请求体），会编码为 JSON
+//	out: 响应解码目标（为 nil 表示忽略响应体）
+//
+// 返回:
+//
+//	连接失败时返回 ErrGatewayNotRunning，服务返回错误时返回其中的错误信息
+func (c *AdminClient) Do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, "http://nanogrip"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return ErrGatewayNotRunning
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return errors.New(apiErr.Error)
+		}
+		return fmt.Errorf("gateway returned %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
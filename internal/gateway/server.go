@@ -0,0 +1,104 @@
+// Package gateway 提供 Gateway 的 HTTP 服务
+//
+// 用于对外暴露只读的订阅端点（如日历订阅）和频道回调（如 Discord 斜杠命令），
+// 订阅端点都可以通过访问令牌保护。
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Server 是 Gateway 的 HTTP 服务器
+type Server struct {
+	addr  string         // 监听地址（host:port）
+	token string         // 访问令牌（为空表示不校验）
+	mux   *http.ServeMux // 路由
+	srv   *http.Server   // 底层 HTTP 服务器
+}
+
+// NewServer 创建一个新的 HTTP 服务器
+// 参数:
+//
+//	host: 监听地址
+//	port: 监听端口
+//	token: 访问令牌，可通过 "?token=" 查询参数或 "Authorization: Bearer" 头传递
+func NewServer(host string, port int, token string) *Server {
+	mux := http.NewServeMux()
+	addr := net.JoinHostPort(host, fmt.Sprintf("%d", port))
+	return &Server{
+		addr:  addr,
+		token: token,
+		mux:   mux,
+		srv: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Handle 注册一个需要令牌校验的处理器
+// 参数:
+//
+//	pattern: 路由模式（如 "/calendar.ics"）
+//	handler: 处理函数
+func (s *Server) Handle(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	})
+}
+
+// HandlePublic 注册一个不校验访问令牌的处理器
+// 用于由第三方调用、自行校验请求的端点（例如校验 Discord 签名的 /discord/interactions）
+func (s *Server) HandlePublic(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// authorized 检查请求是否携带了正确的访问令牌
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// Start 在后台启动 HTTP 服务器
+// 返回:
+//
+//	监听失败时返回错误
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[Gateway] HTTP 服务异常退出: %v", err)
+		}
+	}()
+	log.Printf("[Gateway] HTTP 服务已启动: http://%s", s.addr)
+	return nil
+}
+
+// Stop 优雅关闭 HTTP 服务器
+func (s *Server) Stop(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
@@ -0,0 +1,359 @@
+// Package i18n 本地化系统生成的文本
+//
+// 模型的回复本身跟随用户使用的语言；这里处理的是程序直接发出的文本，
+// 例如 /help、错误回复、定时任务失败通知和子代理完成提示。
+// 目前支持英文（en）和中文（zh），缺少翻译时使用英文。
+//
+// 每个会话的语言保存在会话元数据中（见 agent 包）；没有会话的场景（例如定时任务）
+// 使用 SetDefault 设置的默认语言。
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+const (
+	// English 英文
+	English = "en"
+	// Chinese 中文
+	Chinese = "zh"
+	// Auto 表示根据用户的消息自动检测语言（配置值，不是一种语言）
+	Auto = "auto"
+)
+
+// names 各语言的显示名称
+var names = map[string]string{
+	English: "English",
+	Chinese: "中文",
+}
+
+// aliases 语言名称的常见写法
+var aliases = map[string]string{
+	"en": English, "en-us": English, "en-gb": English, "english": English,
+	"zh": Chinese, "zh-cn": Chinese, "zh-hans": Chinese, "zh-tw": Chinese, "zh-hant": Chinese,
+	"cn": Chinese, "chinese": Chinese, "中文": Chinese,
+}
+
+// catalog 翻译表：键 → 语言 → 文本（可以包含 fmt 占位符）
+var catalog = map[string]map[string]string{
+	"new_session": {
+		English: "✨ New conversation started.",
+		Chinese: "新会话已创建",
+	},
+	"help_header": {
+		English: "🐈 nanobot commands:",
+		Chinese: "🐈 nanobot 命令：",
+	},
+	"help_new": {
+		English: "/new — Start a new conversation",
+		Chinese: "/new — 开始新会话",
+	},
+	"help_undo": {
+		English: "/undo — Remove the last exchange from this conversation",
+		Chinese: "/undo — 撤销本会话的最后一轮对话",
+	},
+	"help_fork": {
+		English: "/fork [name|restore name] — Save this conversation as a branch, list branches or go back to one",
+		Chinese: "/fork [名称|restore 名称] — 把本会话保存为分支、列出分支或回到某个分支",
+	},
+	"help_pin": {
+		English: "/pin [text|remove n|clear] — Keep standing instructions in context for this conversation",
+		Chinese: "/pin [内容|remove 序号|clear] — 固定本会话始终生效的指示",
+	},
+	"help_status": {
+		English: "/status — Show runtime and memory usage (admin)",
+		Chinese: "/status — 查看运行状态和内存占用（管理员）",
+	},
+	"help_tools": {
+		English: "/tools — List available tools (admin)",
+		Chinese: "/tools — 列出可用的工具（管理员）",
+	},
+	"help_model": {
+		English: "/model [name|reset] — Show or switch the model for this conversation (admin)",
+		Chinese: "/model [名称|reset] — 查看或切换本会话使用的模型（管理员）",
+	},
+	"help_memory": {
+		English: "/memory — Show long-term memory (admin)",
+		Chinese: "/memory — 查看长期记忆（管理员）",
+	},
+	"help_profile": {
+		English: "/profile [accept|reject] — Review proposed USER.md updates (admin)",
+		Chinese: "/profile [accept|reject] — 查看并确认 USER.md 的更新提议（管理员）",
+	},
+	"help_tasks": {
+		English: "/tasks — List background subagents (/tasks cancel <id> to stop one)",
+		Chinese: "/tasks — 列出后台子代理（/tasks cancel <id> 停止其中一个）",
+	},
+	"help_language": {
+		English: "/language [en|zh|auto] — Show or set the language for this conversation",
+		Chinese: "/language [en|zh|auto] — 查看或设置本会话的语言",
+	},
+	"help_timezone": {
+		English: "/timezone [zone|auto] — Show or set the time zone for this conversation (e.g. Europe/Berlin)",
+		Chinese: "/timezone [时区|auto] — 查看或设置本会话的时区（例如 Asia/Shanghai）",
+	},
+	"help_help": {
+		English: "/help — Show available commands",
+		Chinese: "/help — 显示可用的命令",
+	},
+	"error_reply": {
+		English: "Sorry, something went wrong: %v",
+		Chinese: "抱歉，处理消息时出错：%v",
+	},
+	"budget_exceeded": {
+		English: "⛔ Today's spending limit for %s has been reached, so I can't take on new work right now. The budget resets at %s.",
+		Chinese: "⛔ 今天 %s 的花费已达到上限，暂时无法处理新的请求。预算将在 %s 重置。",
+	},
+	"empty_reply": {
+		English: "I've completed processing but have no response to give.",
+		Chinese: "处理完成，但没有需要回复的内容。",
+	},
+	"background_done": {
+		English: "Background task completed.",
+		Chinese: "后台任务已完成。",
+	},
+	"admin_only": {
+		English: "⛔ %s is only available to admins.",
+		Chinese: "⛔ %s 仅限管理员使用。",
+	},
+	"cron_failed": {
+		English: "❌ Scheduled task failed: %v",
+		Chinese: "❌ 任务执行失败: %v",
+	},
+	"cron_failure_alert": {
+		English: "⚠️ Scheduled job \"%s\" has failed %d times in a row. Last error: %s",
+		Chinese: "⚠️ 定时任务「%s」已连续失败 %d 次。最近一次的错误：%s",
+	},
+	"cron_recovered": {
+		English: "✅ Scheduled job \"%s\" is running successfully again.",
+		Chinese: "✅ 定时任务「%s」已恢复正常。",
+	},
+	"profile_proposal": {
+		English: "📝 I'd like to update your profile (USER.md): %s\nReply /profile accept to apply it, /profile reject to discard it, or /profile to review it.",
+		Chinese: "📝 我想更新你的档案（USER.md）：%s\n回复 /profile accept 接受，/profile reject 丢弃，或 /profile 查看详情。",
+	},
+	"undo_done": {
+		English: "↩️ Removed the last exchange: %s",
+		Chinese: "↩️ 已撤销最后一轮对话：%s",
+	},
+	"undo_nothing": {
+		English: "Nothing to undo.",
+		Chinese: "没有可以撤销的对话。",
+	},
+	"undo_consolidated": {
+		English: "Note: it had already been saved to long-term memory, which is not changed.",
+		Chinese: "注意：这轮对话已经整理到长期记忆中，长期记忆不会被修改。",
+	},
+	"fork_saved": {
+		English: "🌿 Saved this conversation (%[2]d messages) as branch %[1]q. Use /fork restore %[1]s to come back to it.",
+		Chinese: "🌿 已把本会话（%[2]d 条消息）保存为分支 %[1]q，使用 /fork restore %[1]s 回到这个状态。",
+	},
+	"fork_list": {
+		English: "🌿 Branches: %s\nUse /fork restore <name> to switch this conversation to one.",
+		Chinese: "🌿 分支：%s\n使用 /fork restore <名称> 把本会话切换到某个分支。",
+	},
+	"fork_none": {
+		English: "No branches yet. Use /fork <name> to save this conversation as one.",
+		Chinese: "还没有分支，使用 /fork <名称> 把本会话保存为分支。",
+	},
+	"fork_restored": {
+		English: "🌿 Restored branch %q (%d messages).",
+		Chinese: "🌿 已回到分支 %q（%d 条消息）。",
+	},
+	"fork_unknown": {
+		English: "Unknown branch %q. Use /fork to list branches.",
+		Chinese: "没有名为 %q 的分支，使用 /fork 查看所有分支。",
+	},
+	"fork_usage": {
+		English: "Usage: /fork [name] or /fork restore <name> (names use letters, digits, - and _)",
+		Chinese: "用法：/fork [名称] 或 /fork restore <名称>（名称只能包含字母、数字、- 和 _）",
+	},
+	"pin_added": {
+		English: "📌 Pinned. It stays in context for this conversation:\n%s",
+		Chinese: "📌 已固定，本会话中始终生效：\n%s",
+	},
+	"pin_list": {
+		English: "📌 Pinned:\n%s\nUse /pin remove <n> or /pin clear to unpin.",
+		Chinese: "📌 已固定：\n%s\n使用 /pin remove <序号> 或 /pin clear 取消固定。",
+	},
+	"pin_none": {
+		English: "Nothing pinned. Use /pin <text> to keep an instruction in context for this conversation.",
+		Chinese: "还没有固定内容，使用 /pin <内容> 固定本会话始终生效的指示。",
+	},
+	"pin_removed": {
+		English: "📌 Unpinned: %s",
+		Chinese: "📌 已取消固定：%s",
+	},
+	"pin_cleared": {
+		English: "📌 All pins removed.",
+		Chinese: "📌 已清除所有固定内容。",
+	},
+	"pin_usage": {
+		English: "Usage: /pin <text>, /pin remove <n> or /pin clear",
+		Chinese: "用法：/pin <内容>、/pin remove <序号> 或 /pin clear",
+	},
+	"quiet_digest": {
+		English: "🌙 %d messages arrived during quiet hours:",
+		Chinese: "🌙 免打扰时段内收到 %d 条消息：",
+	},
+	"message_queued": {
+		English: "⏳ Still working on your previous request (%d message(s) queued). They will be handled in order once it is done.",
+		Chinese: "⏳ 还在处理你之前的请求（%d 条消息排队中），完成后会依次处理",
+	},
+	"language_current": {
+		English: "🌐 Language: %s (%s). Use /language <en|zh|auto> to change it.",
+		Chinese: "🌐 当前语言：%s（%s）。使用 /language <en|zh|auto> 修改。",
+	},
+	"language_source_user": {
+		English: "set by you",
+		Chinese: "由你设置",
+	},
+	"language_source_config": {
+		English: "configured default",
+		Chinese: "配置的默认语言",
+	},
+	"language_source_detected": {
+		English: "detected from your messages",
+		Chinese: "根据你的消息检测",
+	},
+	"language_source_default": {
+		English: "default",
+		Chinese: "默认",
+	},
+	"language_set": {
+		English: "🌐 Language set to %s.",
+		Chinese: "🌐 语言已设置为%s。",
+	},
+	"language_auto": {
+		English: "🌐 Language will follow your messages.",
+		Chinese: "🌐 语言将跟随你的消息自动切换。",
+	},
+	"language_unknown": {
+		English: "Unknown language %q. Supported: en, zh, auto.",
+		Chinese: "未知的语言 %q，支持：en、zh、auto。",
+	},
+	"timezone_current": {
+		English: "🕒 Time zone: %s (%s). Use /timezone <zone|auto> to change it, e.g. /timezone Europe/Berlin.",
+		Chinese: "🕒 当前时区：%s（%s）。使用 /timezone <时区|auto> 修改，例如 /timezone Asia/Shanghai。",
+	},
+	"timezone_source_user": {
+		English: "set by you",
+		Chinese: "由你设置",
+	},
+	"timezone_source_detected": {
+		English: "provided by the channel",
+		Chinese: "由频道提供",
+	},
+	"timezone_source_config": {
+		English: "configured default",
+		Chinese: "配置的默认时区",
+	},
+	"timezone_source_server": {
+		English: "server time zone",
+		Chinese: "服务器时区",
+	},
+	"timezone_set": {
+		English: "🕒 Time zone set to %s. Times, reminders and scheduled jobs now use it.",
+		Chinese: "🕒 时区已设置为 %s，时间、提醒和定时任务将按此时区计算。",
+	},
+	"timezone_auto": {
+		English: "🕒 Time zone setting cleared, now using %s.",
+		Chinese: "🕒 已清除时区设置，当前使用 %s。",
+	},
+	"timezone_unknown": {
+		English: "Unknown time zone %q. Use an IANA name such as Europe/Berlin, America/New_York or UTC.",
+		Chinese: "未知的时区 %q，请使用 IANA 名称，例如 Asia/Shanghai、America/New_York 或 UTC。",
+	},
+}
+
+// defaultLang 没有会话语言时使用的语言
+var defaultLang atomic.Value
+
+func init() {
+	defaultLang.Store(English)
+}
+
+// SetDefault 设置默认语言
+// "auto"、空字符串和无法识别的值恢复为英文
+func SetDefault(lang string) {
+	normalized, ok := Normalize(lang)
+	if !ok {
+		normalized = English
+	}
+	defaultLang.Store(normalized)
+}
+
+// Default 返回默认语言
+func Default() string {
+	return defaultLang.Load().(string)
+}
+
+// Normalize 把语言名称（例如 "zh-CN"、"English"）转换为支持的语言代码
+// 返回:
+//
+//	语言代码，不支持的语言第二个返回值为 false
+func Normalize(lang string) (string, bool) {
+	normalized, ok := aliases[strings.ToLower(strings.TrimSpace(strings.ReplaceAll(lang, "_", "-")))]
+	return normalized, ok
+}
+
+// Name 返回语言的显示名称
+func Name(lang string) string {
+	if name, ok := names[lang]; ok {
+		return name
+	}
+	return lang
+}
+
+// T 返回指定语言的文本
+// 参数:
+//
+//	lang: 语言代码（为空时使用默认语言）
+//	key: 文本的键
+//	args: fmt 格式化参数
+func T(lang, key string, args ...interface{}) string {
+	if lang == "" {
+		lang = Default()
+	}
+	translations := catalog[key]
+	text, ok := translations[lang]
+	if !ok {
+		text, ok = translations[English]
+	}
+	if !ok {
+		text = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// Detect 根据文本猜测语言
+// 命令（以 "/" 开头）和太短的文本无法判断，返回空字符串
+func Detect(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.HasPrefix(text, "/") {
+		return ""
+	}
+	han, latin := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			han++
+		case r < unicode.MaxASCII && unicode.IsLetter(r):
+			latin++
+		}
+	}
+	switch {
+	case han >= 2 && han*3 >= latin:
+		return Chinese
+	case latin >= 8 && han == 0:
+		return English
+	default:
+		return ""
+	}
+}
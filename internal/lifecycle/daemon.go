@@ -0,0 +1,165 @@
+package lifecycle
+
+// daemon.go - 后台运行（nanogrip daemon）和进程管理
+//
+// gateway 启动后把进程 ID 写入 workspace/nanogrip.pid，正常退出时删除，
+// "nanogrip daemon stop" 据此向运行中的实例发送 SIGTERM（无论它是由 daemon start、
+// systemd 还是在终端中直接启动的）。
+//
+// 由 systemd 以 Type=notify 启动时，gateway 在启动完成后通过 NOTIFY_SOCKET 发送 READY=1，
+// 退出前发送 STOPPING=1（sd_notify 协议，不依赖 libsystemd）。
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PidFileName 是进程 ID 文件在工作区中的文件名
+const PidFileName = "nanogrip.pid"
+
+// LogFileName 是后台运行时日志文件在工作区中的文件名
+const LogFileName = "nanogrip.log"
+
+// ErrNotRunning 表示没有运行中的实例
+var ErrNotRunning = errors.New("nanogrip is not running")
+
+// PidFilePath 返回工作区对应的进程 ID 文件路径
+func PidFilePath(workspace string) string {
+	return filepath.Join(workspace, PidFileName)
+}
+
+// WritePidFile 把当前进程 ID 写入文件
+// 文件中记录的进程仍在运行时返回错误（同一个工作区只能运行一个实例）
+func WritePidFile(path string) error {
+	if pid, err := RunningPid(path); err == nil && pid != os.Getpid() {
+		return fmt.Errorf("nanogrip is already running (pid %d)", pid)
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
+
+// RemovePidFile 删除进程 ID 文件（只删除记录的是当前进程的文件）
+func RemovePidFile(path string) {
+	if pid, err := readPidFile(path); err == nil && pid == os.Getpid() {
+		os.Remove(path)
+	}
+}
+
+// RunningPid 返回文件中记录的、仍在运行的进程 ID
+// 文件不存在或进程已经退出（遗留的文件）时返回 ErrNotRunning
+func RunningPid(path string) (int, error) {
+	pid, err := readPidFile(path)
+	if err != nil {
+		return 0, ErrNotRunning
+	}
+	if !processAlive(pid) {
+		return 0, ErrNotRunning
+	}
+	return pid, nil
+}
+
+// readPidFile 读取进程 ID 文件
+func readPidFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pid file %s", path)
+	}
+	return pid, nil
+}
+
+// Daemonize 在后台启动一个新的进程
+// 新进程脱离当前终端（新的会话），标准输入为 /dev/null，标准输出和标准错误追加到日志文件
+// 参数:
+//
+//	args: 命令行参数（不含可执行文件本身），例如 ["--config", "/path/config.yaml", "gateway"]
+//	logPath: 日志文件路径
+//
+// 返回:
+//
+//	新进程的 ID
+func Daemonize(args []string, logPath string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer logFile.Close()
+
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return 0, err
+	}
+	defer devNull.Close()
+
+	cmd := exec.Command(exe, args...)
+	cmd.Stdin = devNull
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detachedAttr()
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+	// 不等待子进程退出，释放相关资源
+	cmd.Process.Release()
+	return pid, nil
+}
+
+// StopProcess 向进程发送 SIGTERM（Windows 上直接结束进程）并等待它退出
+// 参数:
+//
+//	pid: 进程 ID
+//	timeout: 最长等待时间
+func StopProcess(pid int, timeout time.Duration) error {
+	if err := terminate(pid); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("process %d did not exit within %s", pid, timeout)
+}
+
+// NotifySystemd 按 sd_notify 协议向 systemd 发送状态（如 "READY=1"、"STOPPING=1"）
+// 没有设置 NOTIFY_SOCKET（不是由 systemd 以 Type=notify 启动）时什么也不做
+// 返回:
+//
+//	是否发送了通知
+func NotifySystemd(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// 以 @ 开头的是 Linux 抽象命名空间 socket
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package lifecycle
+
+// daemon_unix.go - 进程管理的 Unix 实现（信号）
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive 判断进程是否存在（发送信号 0 只做权限和存在性检查）
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// terminate 向进程发送 SIGTERM，gateway 收到后正常退出
+func terminate(pid int) error {
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return ErrNotRunning
+		}
+		return err
+	}
+	return nil
+}
+
+// detachedAttr 返回后台进程的属性：新的会话，脱离当前终端
+func detachedAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
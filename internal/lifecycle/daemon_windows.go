@@ -0,0 +1,39 @@
+//go:build windows
+
+package lifecycle
+
+// daemon_windows.go - 进程管理的 Windows 实现
+// Windows 没有 SIGTERM，无法请求另一个进程正常退出，daemon stop 只能直接结束进程。
+
+import (
+	"os"
+	"syscall"
+)
+
+// detachedProcess 是 Windows 的 DETACHED_PROCESS 创建标志：新进程不继承控制台
+const detachedProcess = 0x00000008
+
+// processAlive 判断进程是否存在（能否打开进程句柄）
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
+
+// terminate 结束进程
+func terminate(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return ErrNotRunning
+	}
+	defer process.Release()
+	return process.Kill()
+}
+
+// detachedAttr 返回后台进程的属性：新的进程组，不关联当前控制台
+func detachedAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess}
+}
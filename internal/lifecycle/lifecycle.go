@@ -0,0 +1,189 @@
+// Package lifecycle 记录 nanogrip 的启动与退出，用于给主人发送上下线通知
+//
+// 每次启动时在 workspace/lifecycle.json 中记录启动时间并标记为运行中，
+// 正常退出时清除运行标记。据此可以判断：
+//   - 上一次运行是否异常退出（启动时运行标记仍然存在）
+//   - 最近一小时内重启了多少次（由 systemd、docker 等进程管理器反复拉起时即为崩溃循环）
+package lifecycle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// crashWindow 统计重启次数的时间窗口
+const crashWindow = time.Hour
+
+// state 是持久化到磁盘的运行记录
+type state struct {
+	Version   string      `json:"version"`    // 上次启动的版本
+	Running   bool        `json:"running"`    // 是否正在运行（正常退出时清除）
+	LastStart time.Time   `json:"last_start"` // 上次启动时间
+	LastStop  time.Time   `json:"last_stop"`  // 上次正常退出时间
+	Starts    []time.Time `json:"starts"`     // 最近一小时内的启动时间
+}
+
+// StartReport 描述本次启动前的运行情况
+type StartReport struct {
+	UncleanExit      bool      // 上一次运行没有正常退出
+	PreviousStart    time.Time // 上一次启动时间
+	PreviousVersion  string    // 上一次运行的版本
+	RestartsLastHour int       // 最近一小时内的启动次数（含本次）
+}
+
+// Tracker 负责读写运行记录
+type Tracker struct {
+	path    string
+	started time.Time
+}
+
+// NewTracker 创建运行记录
+// 参数:
+//
+//	workspace: 工作区目录，记录保存在 workspace/lifecycle.json
+func NewTracker(workspace string) *Tracker {
+	return &Tracker{path: filepath.Join(workspace, "lifecycle.json")}
+}
+
+// Start 记录一次启动
+// 参数:
+//
+//	version: 当前版本
+//
+// 返回:
+//
+//	本次启动前的运行情况
+func (t *Tracker) Start(version string) (StartReport, error) {
+	now := time.Now()
+	t.started = now
+
+	st, err := t.load()
+	if err != nil {
+		return StartReport{}, err
+	}
+
+	report := StartReport{
+		UncleanExit:     st.Running,
+		PreviousStart:   st.LastStart,
+		PreviousVersion: st.Version,
+	}
+
+	starts := make([]time.Time, 0, len(st.Starts)+1)
+	for _, s := range st.Starts {
+		if now.Sub(s) < crashWindow {
+			starts = append(starts, s)
+		}
+	}
+	starts = append(starts, now)
+	report.RestartsLastHour = len(starts)
+
+	st.Version = version
+	st.Running = true
+	st.LastStart = now
+	st.Starts = starts
+	return report, t.save(st)
+}
+
+// Stop 记录一次正常退出
+func (t *Tracker) Stop() error {
+	st, err := t.load()
+	if err != nil {
+		return err
+	}
+	st.Running = false
+	st.LastStop = time.Now()
+	return t.save(st)
+}
+
+// Uptime 返回本次启动以来的运行时长
+func (t *Tracker) Uptime() time.Duration {
+	if t.started.IsZero() {
+		return 0
+	}
+	return time.Since(t.started)
+}
+
+func (t *Tracker) load() (state, error) {
+	var st state
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return st, nil
+		}
+		return st, err
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		// 记录损坏时从头开始，不影响启动
+		return state{}, nil
+	}
+	return st, nil
+}
+
+func (t *Tracker) save(st state) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.path)
+}
+
+// Summary 是启动通知中的状态摘要
+type Summary struct {
+	Version      string    // 当前版本
+	Channels     []string  // 已连接的频道
+	CronJobs     int       // 已计划的定时任务数
+	NextJob      string    // 下一个要执行的任务名称
+	NextRun      time.Time // 下一个任务的执行时间
+	TodoProjects int       // 有未完成待办的项目数
+	OpenTodos    int       // 未完成的待办数
+}
+
+// StartupMessage 生成启动通知
+func StartupMessage(report StartReport, summary Summary) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🟢 nanogrip %s started", summary.Version))
+	if report.PreviousVersion != "" && report.PreviousVersion != summary.Version {
+		sb.WriteString(fmt.Sprintf(" (upgraded from %s)", report.PreviousVersion))
+	}
+	sb.WriteString("\n")
+
+	if report.UncleanExit {
+		sb.WriteString(fmt.Sprintf("⚠️ The previous run (started %s) did not shut down cleanly.\n", report.PreviousStart.Format("2006-01-02 15:04")))
+	}
+
+	if len(summary.Channels) > 0 {
+		sb.WriteString("Channels: " + strings.Join(summary.Channels, ", ") + "\n")
+	} else {
+		sb.WriteString("Channels: none\n")
+	}
+
+	sb.WriteString(fmt.Sprintf("Scheduled jobs: %d", summary.CronJobs))
+	if summary.NextJob != "" {
+		sb.WriteString(fmt.Sprintf(" (next: %s at %s)", summary.NextJob, summary.NextRun.Format("2006-01-02 15:04")))
+	}
+	sb.WriteString("\n")
+	sb.WriteString(fmt.Sprintf("Open todos: %d in %d project(s)", summary.OpenTodos, summary.TodoProjects))
+	return sb.String()
+}
+
+// ShutdownMessage 生成退出通知
+func ShutdownMessage(version string, uptime time.Duration) string {
+	return fmt.Sprintf("🔴 nanogrip %s is shutting down (uptime %s). Bye!", version, uptime.Round(time.Second))
+}
+
+// CrashLoopMessage 生成崩溃循环告警
+func CrashLoopMessage(report StartReport) string {
+	return fmt.Sprintf("🚨 nanogrip has restarted %d times in the last hour — it may be crash-looping. Check the logs.", report.RestartsLastHour)
+}
@@ -7,6 +7,8 @@ import (
 	"context" // context 用于控制协程生命周期
 	"fmt"     // fmt 用于格式化输出
 	"log"     // log 用于日志记录
+	"reflect" // reflect 用于比较配置是否变化
+	"sort"    // sort 用于排序工具名称
 	"sync"    // sync 用于同步原语
 
 	"github.com/Ailoc/nanogrip/internal/tools"     // 工具接口定义
@@ -132,6 +134,8 @@ func (m *MCPClient) startHTTP() error {
 	// 获取工具列表
 	if err := m.fetchTools(); err != nil {
 		log.Printf("MCP client %s: 获取工具列表失败: %v", m.name, err)
+		mcpClient.Close()
+		m.mcpClient = nil
 		return err
 	}
 
@@ -184,6 +188,8 @@ func (m *MCPClient) startStdio() error {
 	// 获取工具列表
 	if err := m.fetchTools(); err != nil {
 		log.Printf("MCP client %s: 获取工具列表失败: %v", m.name, err)
+		mcpClient.Close()
+		m.mcpClient = nil
 		return err
 	}
 
@@ -255,6 +261,11 @@ func (t *mcpToolWrapper) Description() string {
 	return t.description
 }
 
+// Source 返回工具来源（"mcp:<服务器名称>"）
+func (t *mcpToolWrapper) Source() string {
+	return "mcp:" + t.mcpClient.name
+}
+
 // Parameters 返回工具参数定义
 func (t *mcpToolWrapper) Parameters() map[string]interface{} {
 	return t.parameters
@@ -296,9 +307,17 @@ func (t *mcpToolWrapper) ValidateParams(params map[string]interface{}) []string
 //   - string: 执行结果
 //   - error: 执行错误
 func (t *mcpToolWrapper) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	// 客户端可能在刷新时被重启，每次调用时读取当前的连接
+	t.mcpClient.mu.RLock()
+	conn, running := t.mcpClient.mcpClient, t.mcpClient.running
+	t.mcpClient.mu.RUnlock()
+	if !running || conn == nil {
+		return "", fmt.Errorf("MCP 服务器 %s 未运行", t.mcpClient.name)
+	}
+
 	// 调用 mcp-go 客户端的 CallTool
 	// CallToolRequest 使用 Params 字段，包含 Name 和 Arguments
-	result, err := t.mcpClient.mcpClient.CallTool(ctx, mcp.CallToolRequest{
+	result, err := conn.CallTool(ctx, mcp.CallToolRequest{
 		Params: mcp.CallToolParams{
 			Name:      t.name,
 			Arguments: params,
@@ -337,6 +356,29 @@ func (m *MCPClient) Stop() {
 	log.Printf("MCP client %s 已停止", m.name)
 }
 
+// RefreshTools 重新获取工具列表
+// 客户端未运行（例如启动失败）时重新启动，用于服务器启动较慢或运行中新增工具的情况
+func (m *MCPClient) RefreshTools() error {
+	m.mu.Lock()
+	running := m.running
+	m.mu.Unlock()
+	if !running {
+		return m.Start()
+	}
+
+	m.mu.Lock()
+	err := m.fetchTools()
+	m.mu.Unlock()
+	if err == nil {
+		return nil
+	}
+
+	// 获取失败通常表示连接已断开（例如服务器进程退出），重启一次
+	log.Printf("MCP client %s: 刷新工具列表失败，尝试重启: %v", m.name, err)
+	m.Stop()
+	return m.Start()
+}
+
 // GetTools 获取工具列表
 func (m *MCPClient) GetTools() []tools.Tool {
 	m.mu.RLock()
@@ -377,20 +419,116 @@ func (m *MCPManager) StartAll(configs map[string]MCPConfig) error {
 
 	for name, config := range configs {
 		// 创建客户端
+		config := config
 		mcpClient := NewMCPClient(name, &config)
 
+		// 注册客户端（启动失败的客户端也保留，RefreshTools 时会重试）
+		m.clients[name] = mcpClient
+
 		// 启动连接
 		if err := mcpClient.Start(); err != nil {
 			log.Printf("MCP 服务器 %s 启动失败: %v", name, err)
 			continue
 		}
+		log.Printf("MCP 服务器 %s 已启动", name)
+	}
+
+	return nil
+}
+
+// Sync 按新的配置增删 MCP 服务器（用于配置热重载）
+// 新增的服务器会被启动，删除的服务器会被停止，配置发生变化的服务器会重启
+// 参数：
+//   - configs: 新的 MCP 服务器配置映射
+//
+// 返回：
+//   - added: 新启动的服务器提供的工具
+//   - removed: 已停止的服务器原先提供的工具名称
+func (m *MCPManager) Sync(configs map[string]MCPConfig) (added []tools.Tool, removed []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, mcpClient := range m.clients {
+		if config, ok := configs[name]; ok && reflect.DeepEqual(*mcpClient.config, config) {
+			continue
+		}
+		for _, tool := range mcpClient.GetTools() {
+			removed = append(removed, tool.Name())
+		}
+		mcpClient.Stop()
+		delete(m.clients, name)
+		log.Printf("MCP 服务器 %s 已停止", name)
+	}
 
-		// 注册客户端
+	for name, config := range configs {
+		if _, ok := m.clients[name]; ok {
+			continue
+		}
+		config := config
+		mcpClient := NewMCPClient(name, &config)
 		m.clients[name] = mcpClient
+		if err := mcpClient.Start(); err != nil {
+			log.Printf("MCP 服务器 %s 启动失败: %v", name, err)
+			continue
+		}
+		added = append(added, mcpClient.GetTools()...)
 		log.Printf("MCP 服务器 %s 已启动", name)
 	}
 
-	return nil
+	return added, removed
+}
+
+// RefreshTools 重新获取所有服务器的工具列表，并重试启动失败的服务器
+// 返回：
+//   - current: 刷新后所有服务器提供的工具（定义可能已变化，应重新注册）
+//   - added: 新出现的工具名称
+//   - removed: 不再提供的工具名称
+func (m *MCPManager) RefreshTools() (current []tools.Tool, added []string, removed []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, mcpClient := range m.clients {
+		before := make(map[string]bool)
+		for _, tool := range mcpClient.GetTools() {
+			before[tool.Name()] = true
+		}
+
+		if err := mcpClient.RefreshTools(); err != nil {
+			log.Printf("MCP 服务器 %s 刷新失败: %v", name, err)
+		}
+
+		for _, tool := range mcpClient.GetTools() {
+			current = append(current, tool)
+			if before[tool.Name()] {
+				delete(before, tool.Name())
+			} else {
+				added = append(added, tool.Name())
+			}
+		}
+		for toolName := range before {
+			removed = append(removed, toolName)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return current, added, removed
+}
+
+// Status 返回每个服务器的运行状态和工具数量，按名称排序
+func (m *MCPManager) Status() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var lines []string
+	for name, mcpClient := range m.clients {
+		state := "running"
+		if !mcpClient.IsRunning() {
+			state = "not running"
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s, %d tools", name, state, len(mcpClient.GetTools())))
+	}
+	sort.Strings(lines)
+	return lines
 }
 
 // StopAll 停止所有 MCP 服务器
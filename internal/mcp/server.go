@@ -0,0 +1,131 @@
+package mcp
+
+// server.go - 把 nanogrip 自身作为 MCP 服务器
+// 将工具注册表中的工具（文件系统、Shell、待办、定时任务、记忆等）通过 MCP 协议暴露给其他客户端
+// （例如 Claude Desktop、编辑器），使它们可以复用同一个工作区和工具
+// 支持两种传输方式：stdio（由客户端启动进程）和 SSE（HTTP 长连接）
+
+import (
+	"context"       // context 用于控制服务生命周期
+	"crypto/subtle" // subtle 用于常量时间比较访问令牌
+	"encoding/json" // json 用于序列化工具参数 schema
+	"errors"        // errors 用于判断服务关闭错误
+	"net/http"      // http 用于 SSE 传输
+	"os"            // os 用于标准输入输出
+	"strings"       // strings 用于判断错误结果和校验令牌
+	"time"          // time 用于关闭超时
+
+	"github.com/Ailoc/nanogrip/internal/tools" // 工具接口定义
+	"github.com/mark3labs/mcp-go/mcp"          // mcp-go 核心类型
+	"github.com/mark3labs/mcp-go/server"       // mcp-go 服务端
+)
+
+// ServerChannel 是通过 MCP 服务器执行工具时的频道名
+// 工具权限策略（tools.policies）可以用它单独限制 MCP 客户端能使用的工具
+const ServerChannel = "mcp"
+
+// NewServer 创建一个暴露工具注册表中所有工具的 MCP 服务器
+// 工具描述会应用 tools.overrides，执行时经过与 Agent 相同的参数校验和权限策略
+// 参数:
+//
+//	name: 服务器名称
+//	version: 服务器版本
+//	registry: 要暴露的工具注册表
+//
+// 返回:
+//
+//	配置好的 MCP 服务器
+func NewServer(name, version string, registry *tools.ToolRegistry) *server.MCPServer {
+	s := server.NewMCPServer(name, version, server.WithToolCapabilities(false), server.WithRecovery())
+
+	for _, definition := range registry.GetDefinitions() {
+		fn, ok := definition["function"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		toolName, _ := fn["name"].(string)
+		description, _ := fn["description"].(string)
+		schema, err := json.Marshal(fn["parameters"])
+		if toolName == "" || err != nil {
+			continue
+		}
+
+		s.AddTool(mcp.NewToolWithRawSchema(toolName, description, schema), toolHandler(registry, toolName))
+	}
+	return s
+}
+
+// toolHandler 返回执行指定工具的 MCP 处理函数
+func toolHandler(registry *tools.ToolRegistry, name string) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		params := request.GetArguments()
+		if params == nil {
+			params = make(map[string]interface{})
+		}
+
+		ctx = tools.WithToolContext(ctx, ServerChannel, "")
+		result := registry.Execute(ctx, name, params)
+		if !result.OK() {
+			return mcp.NewToolResultError(result.Content), nil
+		}
+		return mcp.NewToolResultText(result.Content), nil
+	}
+}
+
+// ServeStdio 通过标准输入输出提供 MCP 服务，直到输入结束或 ctx 被取消
+// 标准输出只用于协议消息，日志必须写到标准错误
+func ServeStdio(ctx context.Context, s *server.MCPServer) error {
+	err := server.NewStdioServer(s).Listen(ctx, os.Stdin, os.Stdout)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// ServeSSE 通过 HTTP SSE 提供 MCP 服务，直到 ctx 被取消
+// 参数:
+//
+//	ctx: 上下文对象，取消时关闭服务
+//	s: MCP 服务器
+//	addr: 监听地址（例如 "127.0.0.1:8765"）
+//	token: 访问令牌，必填，请求需要带有 "Authorization: Bearer <token>" 头
+//	（不接受查询参数中的令牌，URL 会出现在代理和访问日志中）
+//
+// 返回:
+//
+//	令牌为空或监听失败时返回错误
+func ServeSSE(ctx context.Context, s *server.MCPServer, addr, token string) error {
+	// 暴露的工具包括 shell 和文件写入，不允许无认证的 SSE 服务
+	if token == "" {
+		return errors.New("an access token is required for SSE")
+	}
+	sse := server.NewSSEServer(s)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		sse.ServeHTTP(w, r)
+	})
+
+	httpServer := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		sse.Shutdown(shutdownCtx)
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// authorized 检查请求的 "Authorization: Bearer <token>" 头（常量时间比较）
+func authorized(r *http.Request, token string) bool {
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
@@ -0,0 +1,281 @@
+package media
+
+// media.go - 用户发送的媒体文件
+// 各频道把用户发送的图片和文件交给 Manager 保存到 workspace/media/，
+// 消息总线中传递的是本地文件路径，而不是几 MB 的 base64 字符串；
+// 只有调用视觉模型时才把图片读出来转换为 data URL（见 DataURL）。
+// 过期的文件由 Run 定期清理。
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DirName 是媒体目录在工作区中的名称
+const DirName = "media"
+
+// cleanupInterval 清理过期文件的间隔
+const cleanupInterval = time.Hour
+
+var (
+	// ErrTooLarge 表示文件超过大小上限
+	ErrTooLarge = errors.New("file exceeds the media size limit")
+	// ErrTypeNotAllowed 表示文件类型不在允许列表中
+	ErrTypeNotAllowed = errors.New("file type is not allowed")
+)
+
+// imageTypes 是视觉模型支持的图片扩展名及其 MIME 类型
+var imageTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// Options 是 Manager 的配置
+type Options struct {
+	MaxSize      int64         // 单个文件的大小上限（字节），0 表示不限制
+	AllowedTypes []string      // 允许的 MIME 类型（支持 "image/" 这样的前缀），为空表示不限制
+	Retention    time.Duration // 文件保留时间，0 表示永久保留
+}
+
+// Manager 负责下载、保存和清理用户发送的媒体文件
+type Manager struct {
+	dir  string
+	opts Options
+}
+
+// NewManager 创建媒体管理器
+// 参数:
+//
+//	dir: 保存文件的目录（通常为 workspace/media），在第一次保存时创建
+//	opts: 大小、类型和保留时间限制
+func NewManager(dir string, opts Options) *Manager {
+	return &Manager{dir: dir, opts: opts}
+}
+
+// Dir 返回保存文件的目录
+func (m *Manager) Dir() string {
+	return m.dir
+}
+
+// Save 把 r 的内容保存为媒体文件
+// 参数:
+//
+//	r: 文件内容，读取时检查大小上限
+//	name: 原始文件名（可以为空，只使用其中的文件名部分）
+//	contentType: MIME 类型（为空时根据扩展名或内容推断）
+//
+// 返回:
+//
+//	保存后的本地文件路径；超过大小上限返回 ErrTooLarge，类型不允许返回 ErrTypeNotAllowed
+func (m *Manager) Save(r io.Reader, name, contentType string) (string, error) {
+	if m.opts.MaxSize > 0 {
+		r = io.LimitReader(r, m.opts.MaxSize+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if m.opts.MaxSize > 0 && int64(len(data)) > m.opts.MaxSize {
+		return "", fmt.Errorf("%w (%d MB)", ErrTooLarge, m.opts.MaxSize>>20)
+	}
+
+	contentType = detectType(data, name, contentType)
+	if !m.allowed(contentType) {
+		return "", fmt.Errorf("%w: %s", ErrTypeNotAllowed, contentType)
+	}
+
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(m.dir, fileName(name, contentType))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// SaveBytes 保存内存中的文件内容（见 Save）
+func (m *Manager) SaveBytes(data []byte, name, contentType string) (string, error) {
+	return m.Save(bytes.NewReader(data), name, contentType)
+}
+
+// Download 发送请求并把响应内容保存为媒体文件
+// 参数:
+//
+//	client: HTTP 客户端
+//	req: 下载请求（可以带上频道需要的认证头）
+//	name: 原始文件名，为空时使用 URL 中的文件名
+func (m *Manager) Download(client *http.Client, req *http.Request, name string) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download failed: status %d", resp.StatusCode)
+	}
+	if m.opts.MaxSize > 0 && resp.ContentLength > m.opts.MaxSize {
+		return "", fmt.Errorf("%w (%d MB)", ErrTooLarge, m.opts.MaxSize>>20)
+	}
+	if name == "" {
+		name = filepath.Base(req.URL.Path)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/octet-stream") {
+		contentType = "" // 通用类型，改为根据文件名和内容推断
+	}
+	return m.Save(resp.Body, name, contentType)
+}
+
+// Cleanup 删除超过保留时间的文件
+// 返回: 删除的文件数量
+func (m *Manager) Cleanup() (int, error) {
+	if m.opts.Retention <= 0 {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(m.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-m.opts.Retention)
+	removed := 0
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if os.Remove(filepath.Join(m.dir, entry.Name())) == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Run 定期清理过期文件，直到 ctx 被取消
+func (m *Manager) Run(ctx context.Context) {
+	if m.opts.Retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for {
+		if n, err := m.Cleanup(); err != nil {
+			log.Printf("[Media] 清理过期文件失败: %v", err)
+		} else if n > 0 {
+			log.Printf("[Media] 已删除 %d 个过期文件", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// allowed 判断 MIME 类型是否在允许列表中
+func (m *Manager) allowed(contentType string) bool {
+	if len(m.opts.AllowedTypes) == 0 {
+		return true
+	}
+	for _, allowed := range m.opts.AllowedTypes {
+		if strings.HasSuffix(allowed, "/") && strings.HasPrefix(contentType, allowed) {
+			return true
+		}
+		if contentType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// IsImage 判断本地文件是否是视觉模型支持的图片（按扩展名）
+func IsImage(path string) bool {
+	_, ok := imageTypes[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// DataURL 读取本地图片并转换为 data URL（用于发送给视觉模型）
+func DataURL(path string) (string, error) {
+	contentType, ok := imageTypes[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return "", fmt.Errorf("%s is not a supported image", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("data:%s;base64,%s", contentType, base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// detectType 确定文件的 MIME 类型：优先使用给定的类型，其次是扩展名，最后根据内容推断
+func detectType(data []byte, name, contentType string) string {
+	if contentType == "" {
+		contentType = mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	if idx := strings.Index(contentType, ";"); idx != -1 {
+		contentType = contentType[:idx]
+	}
+	return strings.TrimSpace(strings.ToLower(contentType))
+}
+
+// fileName 生成保存用的文件名：时间 + 随机后缀 + 原始文件名，避免覆盖
+// 原始文件名没有扩展名时根据 MIME 类型补上（视觉模型按扩展名识别图片）
+func fileName(name, contentType string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		name = ""
+	}
+	ext := ""
+	if filepath.Ext(name) == "" {
+		ext = extensionFor(contentType)
+	}
+
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	prefix := time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+	if name == "" {
+		return prefix + ext
+	}
+	return prefix + "-" + name + ext
+}
+
+// extensionFor 返回 MIME 类型对应的常用扩展名
+func extensionFor(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "application/pdf":
+		return ".pdf"
+	}
+	if exts, err := mime.ExtensionsByType(contentType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
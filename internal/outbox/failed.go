@@ -0,0 +1,161 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+)
+
+// failed.go - 投递失败的消息
+// 重试多次仍然无法投递的消息写入 workspace/outbox-failed.jsonl（死信文件），
+// 可以用 "nanogrip outbox failed" 查看，用 "nanogrip outbox resend" 重新发送。
+// 死信文件保存完整的消息内容，不受 archive.storeContent 影响。
+
+// FailedFileName 是死信文件的文件名（位于工作区根目录，不在归档目录中）
+const FailedFileName = "outbox-failed.jsonl"
+
+// Failed 是死信文件中的一条记录
+type Failed struct {
+	Time     time.Time              `json:"time"`               // 放弃投递的时间
+	Channel  string                 `json:"channel"`            // 目标通道
+	ChatID   string                 `json:"chat_id"`            // 目标聊天 ID
+	Content  string                 `json:"content"`            // 消息内容
+	Media    []string               `json:"media,omitempty"`    // 媒体文件
+	Metadata map[string]interface{} `json:"metadata,omitempty"` // 消息元数据（按钮、回复等）
+	Attempts int                    `json:"attempts"`           // 已尝试的次数
+	Error    string                 `json:"error"`              // 最后一次失败的原因
+}
+
+// Message 把记录还原为出站消息
+func (f Failed) Message() bus.OutboundMessage {
+	return bus.OutboundMessage{
+		Channel:  f.Channel,
+		ChatID:   f.ChatID,
+		Content:  f.Content,
+		Media:    f.Media,
+		Metadata: f.Metadata,
+	}
+}
+
+// FailedLog 负责读写死信文件
+type FailedLog struct {
+	path string
+	mu   sync.Mutex // 保护文件读写
+}
+
+// NewFailedLog 创建死信文件读写器
+// 参数:
+//
+//	path: 死信文件路径（通常为 workspace/outbox-failed.jsonl）
+func NewFailedLog(path string) *FailedLog {
+	return &FailedLog{path: path}
+}
+
+// Path 返回死信文件路径
+func (l *FailedLog) Path() string {
+	return l.path
+}
+
+// Append 记录一条无法投递的消息
+// 参数:
+//
+//	msg: 出站消息
+//	attempts: 已尝试的次数
+//	cause: 最后一次失败的原因
+func (l *FailedLog) Append(msg bus.OutboundMessage, attempts int, cause error) error {
+	record := Failed{
+		Time:     time.Now(),
+		Channel:  msg.Channel,
+		ChatID:   msg.ChatID,
+		Content:  msg.Content,
+		Media:    msg.Media,
+		Metadata: msg.Metadata,
+		Attempts: attempts,
+	}
+	if cause != nil {
+		record.Error = cause.Error()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// List 返回所有无法投递的消息（按写入顺序）
+// 文件不存在时返回空列表
+func (l *FailedLog) List() ([]Failed, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Failed
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r Failed
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue // 跳过损坏的行
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// Replace 用给定的记录覆盖死信文件（用于补发后移除已送达的消息）
+// 先写临时文件再重命名，避免中途失败时丢失记录
+func (l *FailedLog) Replace(records []Failed) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(records) == 0 {
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	var data []byte
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
@@ -0,0 +1,277 @@
+// Package outbox 提供出站消息归档
+//
+// 归档记录每一条真正投递到外部通道的消息（目标、时间、内容哈希、投递状态），
+// 按天写入 workspace/outbox/YYYY-MM-DD.jsonl，用于合规审计。
+//
+// 与会话历史不同：会话只记录 Agent 视角的对话，
+// 而归档记录的是实际发出去的内容，包括工具消息、定时任务结果、审批提示等。
+// 归档文件权限为 0600；保存消息原文时，启用会话加密（secrets.encryptSessions）后原文加密保存（见 SetCipher）。
+package outbox
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/secrets"
+)
+
+// 投递状态
+const (
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Record 是归档中的一条记录
+type Record struct {
+	Time        time.Time `json:"time"`               // 投递时间
+	Channel     string    `json:"channel"`            // 目标通道
+	ChatID      string    `json:"chat_id"`            // 目标聊天 ID
+	ContentHash string    `json:"content_hash"`       // 内容的 SHA-256 哈希
+	Length      int       `json:"length"`             // 内容长度（字节）
+	Media       int       `json:"media,omitempty"`    // 附带的媒体数量
+	Status      string    `json:"status"`             // 投递状态: delivered 或 failed
+	Error       string    `json:"error,omitempty"`    // 投递失败的原因
+	Attempts    int       `json:"attempts,omitempty"` // 发送次数（重试过时记录，1 次不记录）
+	Content     string    `json:"content,omitempty"`  // 消息内容（仅在 storeContent 时记录，设置了加密器时为密文）
+}
+
+// Archive 负责写入出站消息归档
+type Archive struct {
+	dir          string     // 归档目录
+	storeContent bool       // 是否同时保存消息原文
+	mu           sync.Mutex // 保护文件写入
+
+	cipher *secrets.Cipher // 加密保存的消息原文（nil 表示明文保存）
+}
+
+// NewArchive 创建出站消息归档
+// 参数:
+//
+//	dir: 归档目录（通常为 workspace/outbox）
+//	storeContent: 是否保存消息原文（否则只保存哈希）
+func NewArchive(dir string, storeContent bool) *Archive {
+	return &Archive{
+		dir:          dir,
+		storeContent: storeContent,
+	}
+}
+
+// SetCipher 加密之后保存的消息原文（哈希、目标等其他字段保持明文，仍可以查询）
+// 参数:
+//
+//	c: 加密器，nil 表示明文保存
+func (a *Archive) SetCipher(c *secrets.Cipher) {
+	if a != nil {
+		a.cipher = c
+	}
+}
+
+// Dir 返回归档目录
+func (a *Archive) Dir() string {
+	return a.dir
+}
+
+// Record 记录一次投递结果
+// 参数:
+//
+//	msg: 出站消息
+//	sendErr: 投递错误（nil 表示投递成功）
+func (a *Archive) Record(msg bus.OutboundMessage, sendErr error) error {
+	return a.RecordDelivery(msg, 1, sendErr)
+}
+
+// RecordDelivery 记录一次投递结果（投递回执），包含发送次数
+// 参数:
+//
+//	msg: 出站消息
+//	attempts: 发送次数（含重试）
+//	sendErr: 最后一次发送的错误（nil 表示投递成功）
+func (a *Archive) RecordDelivery(msg bus.OutboundMessage, attempts int, sendErr error) error {
+	if a == nil {
+		return nil
+	}
+
+	record := Record{
+		Time:        time.Now(),
+		Channel:     msg.Channel,
+		ChatID:      msg.ChatID,
+		ContentHash: HashContent(msg.Content),
+		Length:      len(msg.Content),
+		Media:       len(msg.Media),
+		Status:      StatusDelivered,
+	}
+	if sendErr != nil {
+		record.Status = StatusFailed
+		record.Error = sendErr.Error()
+	}
+	if attempts > 1 {
+		record.Attempts = attempts
+	}
+	if a.storeContent {
+		record.Content = msg.Content
+		if a.cipher != nil {
+			encrypted, err := a.cipher.Encrypt([]byte(msg.Content))
+			if err != nil {
+				return err
+			}
+			record.Content = encrypted
+		}
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.fileFor(record.Time), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	f.Chmod(0600) // 之前创建的归档文件可能权限过宽
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// DecryptContent 解密记录中加密保存的消息原文，原文未加密时原样返回
+func (r Record) DecryptContent(c *secrets.Cipher) (string, error) {
+	if !secrets.IsEncrypted(r.Content) {
+		return r.Content, nil
+	}
+	if c == nil {
+		return "", secrets.ErrNoKey
+	}
+	plain, err := c.Decrypt(r.Content)
+	return string(plain), err
+}
+
+// fileFor 返回某一天的归档文件路径
+func (a *Archive) fileFor(t time.Time) string {
+	return filepath.Join(a.dir, t.Format("2006-01-02")+".jsonl")
+}
+
+// HashContent 计算消息内容的 SHA-256 哈希
+// 可用于核对某条消息是否曾经发出（例如 nanogrip outbox --hash）
+func HashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Query 归档查询条件
+type Query struct {
+	Since   time.Time // 开始时间（含），零值表示不限
+	Until   time.Time // 结束时间（不含），零值表示不限
+	Channel string    // 按通道过滤
+	ChatID  string    // 按聊天 ID 过滤
+	Status  string    // 按投递状态过滤
+	Hash    string    // 按内容哈希（前缀）过滤
+	Limit   int       // 最多返回的记录数（取最新的），0 表示不限
+}
+
+// Search 在归档目录中查询记录
+// 参数:
+//
+//	dir: 归档目录
+//	q: 查询条件
+//
+// 返回:
+//
+//	按时间排序的记录列表
+func Search(dir string, q Query) ([]Record, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var records []Record
+	for _, file := range files {
+		// 文件名即日期，可以跳过明显不在时间范围内的文件
+		day, err := time.ParseInLocation("2006-01-02", strings.TrimSuffix(filepath.Base(file), ".jsonl"), time.Local)
+		if err == nil {
+			if !q.Since.IsZero() && day.Add(24*time.Hour).Before(q.Since) {
+				continue
+			}
+			if !q.Until.IsZero() && !day.Before(q.Until) {
+				continue
+			}
+		}
+
+		fileRecords, err := readFile(file, q)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		records = append(records, fileRecords...)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[len(records)-q.Limit:]
+	}
+	return records, nil
+}
+
+// readFile 读取单个归档文件中满足条件的记录
+func readFile(path string, q Query) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue // 跳过损坏的行
+		}
+		if q.matches(r) {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// matches 判断记录是否满足查询条件
+func (q Query) matches(r Record) bool {
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !r.Time.Before(q.Until) {
+		return false
+	}
+	if q.Channel != "" && r.Channel != q.Channel {
+		return false
+	}
+	if q.ChatID != "" && r.ChatID != q.ChatID {
+		return false
+	}
+	if q.Status != "" && r.Status != q.Status {
+		return false
+	}
+	if q.Hash != "" && !strings.HasPrefix(r.ContentHash, q.Hash) {
+		return false
+	}
+	return true
+}
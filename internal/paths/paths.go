@@ -0,0 +1,37 @@
+// Package paths 提供跨平台的路径处理
+//
+// 配置文件和模型给出的路径常以 "~" 开头。不同 shell 对 "~" 的处理并不一致
+// （Windows 的 cmd 和部分 PowerShell 版本完全不展开），所以统一在程序内部按 os.UserHomeDir 展开，
+// 同时接受 "~/" 和 Windows 风格的 "~\"。
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandHome 把 "~"、"~/..." 和 "~\..." 展开为用户主目录下的路径
+// 其他路径（包括 "~user" 形式）原样返回；无法获取主目录时也原样返回
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	if path == "~" {
+		return home
+	}
+	return filepath.Join(home, filepath.FromSlash(path[2:]))
+}
+
+// HomeDir 返回用户主目录下的路径，例如 HomeDir(".nanogrip", "config.yaml")
+func HomeDir(elem ...string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append([]string{home}, elem...)...), nil
+}
@@ -0,0 +1,115 @@
+// Package presets 提供工作区初始化预设
+//
+// 每个预设包含一组面向特定用途的文件：
+//   - AGENTS.md / SOUL.md: Agent 的工作规则和语气
+//   - skills/: 入门技能
+//   - workflows/: 示例工作流（由定时任务或用户引用）
+//   - cron.yaml: 建议的定时任务（config.yaml 中 cron.jobs 的片段）
+//
+// 模板文件通过 embed 打包进二进制文件，"nanogrip init --preset <名称>" 时写入工作区。
+package presets
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// cronFile 是预设中定时任务片段的文件名（不写入工作区）
+const cronFile = "cron.yaml"
+
+// Preset 描述一个初始化预设
+type Preset struct {
+	Name        string // 预设名称
+	Description string // 简短说明
+}
+
+// presets 所有可用的预设（按展示顺序）
+var presets = []Preset{
+	{Name: "personal", Description: "个人助理：日程规划、提醒、每周回顾"},
+	{Name: "devops", Description: "运维助手：故障排查、每日健康检查、磁盘监控"},
+	{Name: "research", Description: "研究助手：文献综述、阅读笔记、每周摘要"},
+}
+
+// List 返回所有可用的预设
+func List() []Preset {
+	return append([]Preset(nil), presets...)
+}
+
+// Get 根据名称查找预设
+func Get(name string) (Preset, bool) {
+	for _, p := range presets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Preset{}, false
+}
+
+// Install 把预设文件写入工作区
+// 已存在的文件不会被覆盖，以免破坏用户修改过的内容
+// 参数:
+//
+//	name: 预设名称
+//	workspace: 工作区目录
+//
+// 返回:
+//
+//	written: 写入的文件（相对工作区的路径）
+//	skipped: 因已存在而跳过的文件
+func Install(name string, workspace string) (written []string, skipped []string, err error) {
+	if _, ok := Get(name); !ok {
+		return nil, nil, fmt.Errorf("unknown preset: %s", name)
+	}
+
+	root := path.Join("templates", name)
+	err = fs.WalkDir(templates, root, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		rel := strings.TrimPrefix(p, root+"/")
+		if rel == cronFile {
+			return nil
+		}
+
+		target := filepath.Join(workspace, filepath.FromSlash(rel))
+		if _, err := os.Stat(target); err == nil {
+			skipped = append(skipped, rel)
+			return nil
+		}
+
+		data, err := templates.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return err
+		}
+		written = append(written, rel)
+		return nil
+	})
+	return written, skipped, err
+}
+
+// CronJobs 返回预设建议的定时任务
+// 返回值是 config.yaml 中 cron.jobs 列表的 YAML 片段（已缩进两格）
+func CronJobs(name string) (string, error) {
+	if _, ok := Get(name); !ok {
+		return "", fmt.Errorf("unknown preset: %s", name)
+	}
+	data, err := templates.ReadFile(path.Join("templates", name, cronFile))
+	if err != nil {
+		return "", nil
+	}
+	return string(data), nil
+}
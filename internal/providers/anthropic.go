@@ -34,7 +34,7 @@ func NewAnthropicProvider(apiKey string, apiBase string, defaultModel string) *A
 }
 
 func (p *AnthropicProvider) Chat(ctx context.Context, messages []Message, tools []ToolDef, model string, maxTokens int, temperature float64) (*LLMResponse, error) {
-	params, err := p.messageParams(messages, tools, model, maxTokens, temperature)
+	params, err := p.messageParams(messages, tools, model, maxTokens, temperature, ReasoningFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +48,7 @@ func (p *AnthropicProvider) Chat(ctx context.Context, messages []Message, tools
 }
 
 func (p *AnthropicProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDef, model string, maxTokens int, temperature float64, onDelta StreamCallback) (*LLMResponse, error) {
-	params, err := p.messageParams(messages, tools, model, maxTokens, temperature)
+	params, err := p.messageParams(messages, tools, model, maxTokens, temperature, ReasoningFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -76,7 +76,7 @@ func (p *AnthropicProvider) ChatStream(ctx context.Context, messages []Message,
 	return parseAnthropicResponse(&message), nil
 }
 
-func (p *AnthropicProvider) messageParams(messages []Message, tools []ToolDef, model string, maxTokens int, temperature float64) (anthropic.MessageNewParams, error) {
+func (p *AnthropicProvider) messageParams(messages []Message, tools []ToolDef, model string, maxTokens int, temperature float64, reasoning ReasoningOptions) (anthropic.MessageNewParams, error) {
 	apiModel, err := normalizeModelForProvider(ProviderAnthropic, model, p.defaultModel)
 	if err != nil {
 		return anthropic.MessageNewParams{}, err
@@ -91,11 +91,17 @@ func (p *AnthropicProvider) messageParams(messages []Message, tools []ToolDef, m
 	}
 
 	params := anthropic.MessageNewParams{
-		Model:       anthropic.Model(apiModel),
-		MaxTokens:   int64(maxTokens),
-		Messages:    anthropicMessages,
-		System:      systemPrompt,
-		Temperature: anthropic.Float(temperature),
+		Model:     anthropic.Model(apiModel),
+		MaxTokens: int64(maxTokens),
+		Messages:  anthropicMessages,
+		System:    systemPrompt,
+	}
+	if reasoning.BudgetTokens > 0 {
+		// Extended thinking counts against max_tokens and requires the default temperature.
+		params.Thinking = anthropic.ThinkingConfigParamOfEnabled(int64(reasoning.BudgetTokens))
+		params.MaxTokens += int64(reasoning.BudgetTokens)
+	} else {
+		params.Temperature = anthropic.Float(temperature)
 	}
 	if len(tools) > 0 {
 		params.Tools = toAnthropicTools(tools)
@@ -131,7 +137,12 @@ func toAnthropicMessages(messages []Message) ([]anthropic.MessageParam, []anthro
 		switch msg.Role {
 		case "system":
 			if msg.Content != "" {
-				systemPrompt = append(systemPrompt, anthropic.TextBlockParam{Text: msg.Content})
+				block := anthropic.TextBlockParam{Text: msg.Content}
+				if msg.Cache {
+					// Cache the tools and the stable system prompt prefix across requests.
+					block.CacheControl = anthropic.NewCacheControlEphemeralParam()
+				}
+				systemPrompt = append(systemPrompt, block)
 			}
 		case "assistant":
 			result = append(result, anthropic.NewAssistantMessage(anthropicAssistantBlocks(msg)...))
@@ -168,7 +179,11 @@ func anthropicUserBlocks(msg Message) ([]anthropic.ContentBlockParamUnion, error
 }
 
 func anthropicAssistantBlocks(msg Message) []anthropic.ContentBlockParamUnion {
-	blocks := make([]anthropic.ContentBlockParamUnion, 0, len(msg.Tools)+1)
+	blocks := make([]anthropic.ContentBlockParamUnion, 0, len(msg.Tools)+2)
+	if msg.ReasoningSignature != "" {
+		// With extended thinking, tool-use turns must start with the unmodified thinking block.
+		blocks = append(blocks, anthropic.NewThinkingBlock(msg.ReasoningSignature, msg.Reasoning))
+	}
 	if msg.Content != "" {
 		blocks = append(blocks, anthropic.NewTextBlock(msg.Content))
 	}
@@ -290,6 +305,7 @@ func parseAnthropicResponse(message *anthropic.Message) *LLMResponse {
 
 	var contentParts []string
 	var reasoningParts []string
+	var signature string
 	toolCalls := make([]ToolCallRequest, 0)
 
 	for _, block := range message.Content {
@@ -298,6 +314,7 @@ func parseAnthropicResponse(message *anthropic.Message) *LLMResponse {
 			contentParts = append(contentParts, block.Text)
 		case "thinking":
 			reasoningParts = append(reasoningParts, block.Thinking)
+			signature = block.Signature
 		case "tool_use":
 			toolCalls = append(toolCalls, ToolCallRequest{
 				ID:        block.ID,
@@ -309,12 +326,20 @@ func parseAnthropicResponse(message *anthropic.Message) *LLMResponse {
 
 	inputTokens := int(message.Usage.InputTokens + message.Usage.CacheCreationInputTokens + message.Usage.CacheReadInputTokens)
 	outputTokens := int(message.Usage.OutputTokens)
+	usage := map[string]int{
+		"prompt_tokens":     inputTokens,
+		"completion_tokens": outputTokens,
+		"total_tokens":      inputTokens + outputTokens,
+		"cached_tokens":     int(message.Usage.CacheReadInputTokens),
+	}
 
 	return &LLMResponse{
 		Content:          strings.Join(contentParts, ""),
 		ToolCalls:        toolCalls,
 		FinishReason:     string(message.StopReason),
-		Usage:            map[string]int{"prompt_tokens": inputTokens, "completion_tokens": outputTokens, "total_tokens": inputTokens + outputTokens},
+		Usage:            usage,
 		ReasoningContent: strings.Join(reasoningParts, ""),
+
+		ReasoningSignature: signature,
 	}
 }
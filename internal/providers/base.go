@@ -23,6 +23,9 @@ type LLMResponse struct {
 	FinishReason     string            // 完成原因，如"stop"、"length"、"tool_calls"等
 	Usage            map[string]int    // token使用统计，包括prompt_tokens、completion_tokens等
 	ReasoningContent string            // 推理内容（如 Anthropic thinking blocks），用于存储模型的思考过程
+
+	// ReasoningSignature Anthropic 思考块的签名，工具调用循环中需要和思考内容一起原样传回
+	ReasoningSignature string
 }
 
 // HasToolCalls 检查响应中是否包含工具调用
@@ -40,6 +43,13 @@ type Message struct {
 	Tools      []ToolCallRequest `json:"tool_calls,omitempty"`   // 当角色为assistant时，包含的工具调用请求
 	ToolCallID string            `json:"tool_call_id,omitempty"` // 当角色为tool时，对应的工具调用ID
 	Name       string            `json:"name,omitempty"`         // 工具名称或函数名称（用于工具响应消息）
+
+	// 助手消息的思考过程及其签名：开启 Anthropic 扩展思考时，带工具调用的助手消息必须附带原始思考块
+	Reasoning          string `json:"reasoning,omitempty"`
+	ReasoningSignature string `json:"reasoning_signature,omitempty"`
+
+	// 提示词缓存断点：到这条消息为止的前缀在各次请求之间保持不变，支持提示词缓存的提供商（Anthropic）会在这里标记 cache_control
+	Cache bool `json:"cache,omitempty"`
 }
 
 // LLMProvider 是 LLM 提供商的核心接口。
@@ -0,0 +1,254 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// DefaultOllamaBase is the default address of a local Ollama server.
+const DefaultOllamaBase = "http://localhost:11434"
+
+// EmbeddingsProvider turns text into vectors for semantic search.
+// It is configured separately from the chat model (providers.embeddings), so a
+// cheap or local embedding model can be used alongside any LLMProvider.
+type EmbeddingsProvider interface {
+	// Embed returns one vector per input text, in the same order.
+	// Large inputs are split into batches by the implementation.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+
+	// Model returns the embedding model name. Vectors from different models
+	// are not comparable, so stored vectors should record it.
+	Model() string
+}
+
+// EmbeddingsOptions contains the settings needed to create an EmbeddingsProvider.
+type EmbeddingsOptions struct {
+	Provider   string // "openai" (any OpenAI-compatible endpoint) or "ollama"; empty disables embeddings
+	Model      string
+	Dimensions int // requested vector size (OpenAI text-embedding-3 models only); 0 uses the model default
+	BatchSize  int // maximum texts per request; 0 uses the default
+	Timeout    time.Duration
+	API        APIConfig // endpoint and key; for "openai" an empty key falls back to OpenAI below
+	OpenAI     APIConfig // providers.openai, reused when API has no key
+}
+
+// NewEmbeddingsProvider creates the configured embeddings backend.
+// It returns nil without error when embeddings are disabled.
+func NewEmbeddingsProvider(opts EmbeddingsOptions) (EmbeddingsProvider, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 60 * time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 64
+	}
+
+	switch strings.ToLower(strings.TrimSpace(opts.Provider)) {
+	case "":
+		return nil, nil
+	case "openai":
+		api := opts.API
+		if api.APIKey == "" && api.APIBase == "" {
+			api = opts.OpenAI
+		}
+		// Self-hosted OpenAI-compatible servers usually need no key; the
+		// official endpoint does.
+		if api.APIBase == "" && !hasCredential(api, "OPENAI_API_KEY") {
+			return nil, fmt.Errorf("openai embeddings require providers.embeddings.apiKey, providers.openai.apiKey or OPENAI_API_KEY")
+		}
+		if opts.Model == "" {
+			opts.Model = "text-embedding-3-small"
+		}
+		return NewOpenAIEmbeddings(api, opts.Model, opts.Dimensions, opts.BatchSize, opts.Timeout), nil
+	case "ollama":
+		if opts.Model == "" {
+			opts.Model = "nomic-embed-text"
+		}
+		return NewOllamaEmbeddings(opts.API.APIBase, opts.Model, opts.BatchSize, opts.Timeout), nil
+	default:
+		return nil, fmt.Errorf("unsupported embeddings provider %q", opts.Provider)
+	}
+}
+
+// OpenAIEmbeddings uses the OpenAI embeddings API or any compatible endpoint
+// (LM Studio, vLLM, llama.cpp server, ...).
+type OpenAIEmbeddings struct {
+	client     openai.Client
+	model      string
+	dimensions int
+	batchSize  int
+}
+
+func NewOpenAIEmbeddings(api APIConfig, model string, dimensions int, batchSize int, timeout time.Duration) *OpenAIEmbeddings {
+	options := []option.RequestOption{
+		option.WithRequestTimeout(timeout),
+	}
+	if api.APIKey != "" {
+		options = append(options, option.WithAPIKey(api.APIKey))
+	} else if api.APIBase != "" {
+		// The SDK refuses to send requests without a key; local servers ignore it.
+		options = append(options, option.WithAPIKey("none"))
+	}
+	if api.APIBase != "" {
+		options = append(options, option.WithBaseURL(api.APIBase))
+	}
+
+	return &OpenAIEmbeddings{
+		client:     openai.NewClient(options...),
+		model:      model,
+		dimensions: dimensions,
+		batchSize:  batchSize,
+	}
+}
+
+func (e *OpenAIEmbeddings) Model() string {
+	return e.model
+}
+
+func (e *OpenAIEmbeddings) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return embedInBatches(texts, e.batchSize, func(batch []string) ([][]float32, error) {
+		params := openai.EmbeddingNewParams{
+			Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: batch},
+			Model: openai.EmbeddingModel(e.model),
+		}
+		if e.dimensions > 0 {
+			params.Dimensions = openai.Int(int64(e.dimensions))
+		}
+
+		resp, err := e.client.Embeddings.New(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("openai embeddings failed: %w", err)
+		}
+		if len(resp.Data) != len(batch) {
+			return nil, fmt.Errorf("openai embeddings returned %d vectors for %d inputs", len(resp.Data), len(batch))
+		}
+
+		// The API documents Index; do not rely on response order.
+		data := resp.Data
+		sort.Slice(data, func(i, j int) bool { return data[i].Index < data[j].Index })
+		vectors := make([][]float32, len(data))
+		for i, item := range data {
+			vectors[i] = toFloat32(item.Embedding)
+		}
+		return vectors, nil
+	})
+}
+
+// OllamaEmbeddings uses the /api/embed endpoint of an Ollama server.
+type OllamaEmbeddings struct {
+	baseURL    string
+	model      string
+	batchSize  int
+	httpClient *http.Client
+}
+
+func NewOllamaEmbeddings(baseURL string, model string, batchSize int, timeout time.Duration) *OllamaEmbeddings {
+	if baseURL == "" {
+		baseURL = DefaultOllamaBase
+	}
+	return &OllamaEmbeddings{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		model:      model,
+		batchSize:  batchSize,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+func (e *OllamaEmbeddings) Model() string {
+	return e.model
+}
+
+func (e *OllamaEmbeddings) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return embedInBatches(texts, e.batchSize, func(batch []string) ([][]float32, error) {
+		body, err := json.Marshal(map[string]interface{}{
+			"model": e.model,
+			"input": batch,
+		})
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/api/embed", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := e.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("ollama embeddings failed: %w", err)
+		}
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("ollama embeddings failed: status=%d, response=%q", resp.StatusCode, strings.TrimSpace(string(respBody)))
+		}
+
+		var result struct {
+			Embeddings [][]float32 `json:"embeddings"`
+		}
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return nil, fmt.Errorf("decode ollama embeddings: %w", err)
+		}
+		if len(result.Embeddings) != len(batch) {
+			return nil, fmt.Errorf("ollama embeddings returned %d vectors for %d inputs", len(result.Embeddings), len(batch))
+		}
+		return result.Embeddings, nil
+	})
+}
+
+// embedInBatches calls embed for consecutive batches of at most size texts
+// and concatenates the results.
+func embedInBatches(texts []string, size int, embed func(batch []string) ([][]float32, error)) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += size {
+		end := start + size
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := embed(texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func toFloat32(values []float64) []float32 {
+	result := make([]float32, len(values))
+	for i, v := range values {
+		result[i] = float32(v)
+	}
+	return result
+}
+
+// CosineSimilarity returns the cosine similarity of two vectors, or 0 when
+// their lengths differ or either is zero.
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,115 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Fallback is one entry of a fallback chain: a provider and the model to request from it.
+type Fallback struct {
+	Provider LLMProvider
+	Model    string
+}
+
+// FallbackProvider wraps a primary provider with an ordered list of fallbacks.
+// When a request to the primary fails (error, timeout, rate limit), the same
+// request is retried against each fallback in turn until one succeeds.
+type FallbackProvider struct {
+	primary   LLMProvider
+	fallbacks []Fallback
+	timeout   time.Duration // per-attempt timeout for all but the last candidate; 0 disables it
+}
+
+// NewFallbackProvider creates a provider that fails over from primary to fallbacks.
+// timeout limits how long each attempt may take before moving on to the next
+// candidate; the last candidate is never cut short. Zero disables the limit.
+func NewFallbackProvider(primary LLMProvider, fallbacks []Fallback, timeout time.Duration) *FallbackProvider {
+	return &FallbackProvider{
+		primary:   primary,
+		fallbacks: fallbacks,
+		timeout:   timeout,
+	}
+}
+
+// GetDefaultModel returns the primary provider's default model.
+func (p *FallbackProvider) GetDefaultModel() string {
+	return p.primary.GetDefaultModel()
+}
+
+// Chat sends the request to the primary provider and fails over on error.
+func (p *FallbackProvider) Chat(ctx context.Context, messages []Message, tools []ToolDef, model string, maxTokens int, temperature float64) (*LLMResponse, error) {
+	return p.run(ctx, model, func(ctx context.Context, candidate Fallback) (*LLMResponse, bool, error) {
+		resp, err := candidate.Provider.Chat(ctx, messages, tools, candidate.Model, maxTokens, temperature)
+		return resp, false, err
+	})
+}
+
+// ChatStream streams from the primary provider and fails over on error.
+// Once a candidate has streamed any text to onDelta, its error is returned as is,
+// because retrying would show the user a second, different answer.
+func (p *FallbackProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDef, model string, maxTokens int, temperature float64, onDelta StreamCallback) (*LLMResponse, error) {
+	return p.run(ctx, model, func(ctx context.Context, candidate Fallback) (*LLMResponse, bool, error) {
+		streaming, ok := candidate.Provider.(StreamingLLMProvider)
+		if !ok {
+			resp, err := candidate.Provider.Chat(ctx, messages, tools, candidate.Model, maxTokens, temperature)
+			if err == nil && onDelta != nil && resp.Content != "" {
+				onDelta(resp.Content)
+			}
+			return resp, false, err
+		}
+
+		emitted := false
+		resp, err := streaming.ChatStream(ctx, messages, tools, candidate.Model, maxTokens, temperature, func(delta string) {
+			if delta != "" {
+				emitted = true
+			}
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		})
+		return resp, emitted, err
+	})
+}
+
+// run tries each candidate in order until one succeeds.
+// attempt reports whether output was already emitted, in which case no failover happens.
+func (p *FallbackProvider) run(ctx context.Context, model string, attempt func(context.Context, Fallback) (*LLMResponse, bool, error)) (*LLMResponse, error) {
+	candidates := append([]Fallback{{Provider: p.primary, Model: model}}, p.fallbacks...)
+
+	var errs []string
+	for i, candidate := range candidates {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if p.timeout > 0 && i < len(candidates)-1 {
+			attemptCtx, cancel = context.WithTimeout(ctx, p.timeout)
+		}
+		resp, emitted, err := attempt(attemptCtx, candidate)
+		timedOut := attemptCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancel()
+
+		if err == nil {
+			if i > 0 {
+				log.Printf("LLM request served by fallback %s after %d failed attempt(s)", candidate.Model, i)
+			}
+			return resp, nil
+		}
+		if ctx.Err() != nil || emitted {
+			return nil, err
+		}
+		if timedOut {
+			err = fmt.Errorf("timed out after %s", p.timeout)
+		}
+
+		name := candidate.Model
+		if name == "" {
+			name = candidate.Provider.GetDefaultModel()
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		if i < len(candidates)-1 {
+			log.Printf("LLM request to %s failed, trying fallback %s: %v", name, candidates[i+1].Model, err)
+		}
+	}
+	return nil, fmt.Errorf("all models failed: %s", strings.Join(errs, "; "))
+}
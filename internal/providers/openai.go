@@ -2,11 +2,14 @@ package providers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/packages/respjson"
 	"github.com/openai/openai-go/shared"
 )
 
@@ -34,7 +37,7 @@ func NewOpenAIProvider(apiKey string, apiBase string, defaultModel string) *Open
 }
 
 func (p *OpenAIProvider) Chat(ctx context.Context, messages []Message, tools []ToolDef, model string, maxTokens int, temperature float64) (*LLMResponse, error) {
-	params, err := p.chatCompletionParams(messages, tools, model, maxTokens, temperature)
+	params, err := p.chatCompletionParams(messages, tools, model, maxTokens, temperature, ReasoningFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +51,7 @@ func (p *OpenAIProvider) Chat(ctx context.Context, messages []Message, tools []T
 }
 
 func (p *OpenAIProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDef, model string, maxTokens int, temperature float64, onDelta StreamCallback) (*LLMResponse, error) {
-	params, err := p.chatCompletionParams(messages, tools, model, maxTokens, temperature)
+	params, err := p.chatCompletionParams(messages, tools, model, maxTokens, temperature, ReasoningFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -57,9 +60,13 @@ func (p *OpenAIProvider) ChatStream(ctx context.Context, messages []Message, too
 	defer stream.Close()
 
 	acc := openai.ChatCompletionAccumulator{}
+	var reasoning strings.Builder // the accumulator drops non-standard fields such as reasoning_content
 	for stream.Next() {
 		chunk := stream.Current()
 		acc.AddChunk(chunk)
+		if len(chunk.Choices) > 0 {
+			reasoning.WriteString(openaiReasoningField(chunk.Choices[0].Delta.JSON.ExtraFields))
+		}
 
 		if onDelta != nil && len(chunk.Choices) > 0 {
 			delta := chunk.Choices[0].Delta.Content
@@ -75,10 +82,14 @@ func (p *OpenAIProvider) ChatStream(ctx context.Context, messages []Message, too
 		return nil, fmt.Errorf("openai chat completion stream failed: %w", err)
 	}
 
-	return parseOpenAIResponse(&acc.ChatCompletion), nil
+	resp := parseOpenAIResponse(&acc.ChatCompletion)
+	if resp.ReasoningContent == "" {
+		resp.ReasoningContent = reasoning.String()
+	}
+	return resp, nil
 }
 
-func (p *OpenAIProvider) chatCompletionParams(messages []Message, tools []ToolDef, model string, maxTokens int, temperature float64) (openai.ChatCompletionNewParams, error) {
+func (p *OpenAIProvider) chatCompletionParams(messages []Message, tools []ToolDef, model string, maxTokens int, temperature float64, reasoning ReasoningOptions) (openai.ChatCompletionNewParams, error) {
 	apiModel, err := normalizeModelForProvider(ProviderOpenAI, model, p.defaultModel)
 	if err != nil {
 		return openai.ChatCompletionNewParams{}, err
@@ -90,9 +101,14 @@ func (p *OpenAIProvider) chatCompletionParams(messages []Message, tools []ToolDe
 	}
 
 	params := openai.ChatCompletionNewParams{
-		Model:       shared.ChatModel(apiModel),
-		Messages:    openAIMessages,
-		Temperature: openai.Float(temperature),
+		Model:    shared.ChatModel(apiModel),
+		Messages: openAIMessages,
+	}
+	if reasoning.Effort != "" {
+		// reasoning models only accept the default temperature
+		params.ReasoningEffort = shared.ReasoningEffort(reasoning.Effort)
+	} else {
+		params.Temperature = openai.Float(temperature)
 	}
 	if maxTokens > 0 {
 		params.MaxCompletionTokens = openai.Int(int64(maxTokens))
@@ -201,12 +217,28 @@ func parseOpenAIResponse(completion *openai.ChatCompletion) *LLMResponse {
 		"prompt_tokens":     int(completion.Usage.PromptTokens),
 		"completion_tokens": int(completion.Usage.CompletionTokens),
 		"total_tokens":      int(completion.Usage.TotalTokens),
+		"cached_tokens":     int(completion.Usage.PromptTokensDetails.CachedTokens),
 	}
 
 	return &LLMResponse{
-		Content:      content,
-		ToolCalls:    toolCalls,
-		FinishReason: choice.FinishReason,
-		Usage:        usage,
+		Content:          content,
+		ToolCalls:        toolCalls,
+		FinishReason:     choice.FinishReason,
+		Usage:            usage,
+		ReasoningContent: openaiReasoningField(message.JSON.ExtraFields),
+	}
+}
+
+// openaiReasoningField extracts reasoning_content, a non-standard field returned by
+// OpenAI-compatible reasoning models such as DeepSeek R1.
+func openaiReasoningField(fields map[string]respjson.Field) string {
+	field, ok := fields["reasoning_content"]
+	if !ok || field.Raw() == "" {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal([]byte(field.Raw()), &text); err != nil {
+		return ""
 	}
+	return text
 }
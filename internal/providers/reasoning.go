@@ -0,0 +1,26 @@
+package providers
+
+import "context"
+
+// ReasoningOptions controls extended reasoning for models that support it.
+// The zero value leaves reasoning at the provider's default.
+type ReasoningOptions struct {
+	// Effort is sent as reasoning_effort ("low", "medium" or "high") to OpenAI-compatible APIs (o-series models).
+	Effort string
+	// BudgetTokens enables Anthropic extended thinking with the given token budget; 0 disables it.
+	BudgetTokens int
+}
+
+type reasoningKey struct{}
+
+// WithReasoning returns a context that asks providers to apply the given reasoning options.
+// Options travel with the request context so the LLMProvider interface stays unchanged.
+func WithReasoning(ctx context.Context, opts ReasoningOptions) context.Context {
+	return context.WithValue(ctx, reasoningKey{}, opts)
+}
+
+// ReasoningFrom returns the reasoning options attached to ctx, if any.
+func ReasoningFrom(ctx context.Context) ReasoningOptions {
+	opts, _ := ctx.Value(reasoningKey{}).(ReasoningOptions)
+	return opts
+}
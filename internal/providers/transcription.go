@@ -0,0 +1,168 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// Transcriber converts audio (voice notes, audio files) into text.
+type Transcriber interface {
+	Transcribe(ctx context.Context, filename string, data []byte) (string, error)
+}
+
+// TranscriberOptions contains the settings needed to create a Transcriber.
+type TranscriberOptions struct {
+	Provider string // "openai" or "command"; empty disables transcription
+	Model    string
+	Language string
+	Command  string
+	Timeout  time.Duration
+	OpenAI   APIConfig
+}
+
+// NewTranscriber creates the configured speech-to-text backend.
+// It returns nil without error when transcription is disabled.
+func NewTranscriber(opts TranscriberOptions) (Transcriber, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 120 * time.Second
+	}
+
+	switch strings.ToLower(strings.TrimSpace(opts.Provider)) {
+	case "":
+		return nil, nil
+	case "openai":
+		if !hasCredential(opts.OpenAI, "OPENAI_API_KEY") {
+			return nil, fmt.Errorf("openai transcription requires providers.openai.apiKey or OPENAI_API_KEY")
+		}
+		return NewOpenAITranscriber(opts.OpenAI.APIKey, opts.OpenAI.APIBase, opts.Model, opts.Language, opts.Timeout), nil
+	case "command":
+		if strings.TrimSpace(opts.Command) == "" {
+			return nil, fmt.Errorf("command transcription requires providers.transcription.command")
+		}
+		return NewCommandTranscriber(opts.Command, opts.Timeout), nil
+	default:
+		return nil, fmt.Errorf("unsupported transcription provider %q", opts.Provider)
+	}
+}
+
+// OpenAITranscriber uses the OpenAI audio transcription API (Whisper).
+type OpenAITranscriber struct {
+	client   openai.Client
+	model    string
+	language string
+}
+
+func NewOpenAITranscriber(apiKey string, apiBase string, model string, language string, timeout time.Duration) *OpenAITranscriber {
+	options := []option.RequestOption{
+		option.WithRequestTimeout(timeout),
+	}
+	if apiKey != "" {
+		options = append(options, option.WithAPIKey(apiKey))
+	}
+	if apiBase != "" {
+		options = append(options, option.WithBaseURL(apiBase))
+	}
+	if model == "" {
+		model = "whisper-1"
+	}
+
+	return &OpenAITranscriber{
+		client:   openai.NewClient(options...),
+		model:    model,
+		language: language,
+	}
+}
+
+func (t *OpenAITranscriber) Transcribe(ctx context.Context, filename string, data []byte) (string, error) {
+	params := openai.AudioTranscriptionNewParams{
+		File:  openai.File(bytes.NewReader(data), filepath.Base(filename), ""),
+		Model: openai.AudioModel(t.model),
+	}
+	if t.language != "" {
+		params.Language = openai.String(t.language)
+	}
+
+	transcription, err := t.client.Audio.Transcriptions.New(ctx, params)
+	if err != nil {
+		return "", fmt.Errorf("openai transcription failed: %w", err)
+	}
+	return strings.TrimSpace(transcription.Text), nil
+}
+
+// CommandTranscriber runs a local command such as whisper.cpp.
+// The audio is written to a temporary file whose path replaces {file} in the
+// command; the command's stdout is used as the transcript.
+type CommandTranscriber struct {
+	command string
+	timeout time.Duration
+}
+
+func NewCommandTranscriber(command string, timeout time.Duration) *CommandTranscriber {
+	return &CommandTranscriber{
+		command: command,
+		timeout: timeout,
+	}
+}
+
+func (t *CommandTranscriber) Transcribe(ctx context.Context, filename string, data []byte) (string, error) {
+	dir, err := os.MkdirTemp("", "nanogrip-audio-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Base(filename)
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		name = "audio"
+	}
+	audioPath := filepath.Join(dir, name)
+	if err := os.WriteFile(audioPath, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write audio file: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	command := t.command
+	if strings.Contains(command, "{file}") {
+		command = strings.ReplaceAll(command, "{file}", shellQuote(audioPath))
+	} else {
+		command = command + " " + shellQuote(audioPath)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("transcription command timed out after %s", t.timeout)
+		}
+		return "", fmt.Errorf("transcription command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// shellQuote quotes a path for the shell that runs the command: single quotes
+// for /bin/sh, double quotes for cmd.exe (Windows paths cannot contain ").
+func shellQuote(value string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + value + `"`
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
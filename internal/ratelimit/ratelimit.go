@@ -0,0 +1,261 @@
+// Package ratelimit 为入站消息提供限流和每日额度
+//
+// allowFrom 白名单可以包含群聊，群里任何人都能触发 Agent 消耗 API 额度。
+// Limiter 在 AgentLoop 处理消息之前检查：
+//   - 每分钟消息数（按发送者、按频道）
+//   - 每天 LLM 调用次数（按发送者、按频道）
+//   - 每天 token 用量（按发送者、按频道）
+//
+// 超出限制时 Agent 回复一条礼貌的提示，而不是继续调用模型。
+// 每日用量保存在 workspace/usage.json，重启后仍然有效，每天零点（本地时间）清零。
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Limits 描述一组限制，0 表示不限制
+type Limits struct {
+	MessagesPerMinute int // 每分钟最多处理的消息数
+	LLMCallsPerDay    int // 每天最多的 LLM 调用次数
+	TokensPerDay      int // 每天最多消耗的 token 数
+}
+
+// enabled 判断是否设置了任何限制
+func (l Limits) enabled() bool {
+	return l.MessagesPerMinute > 0 || l.LLMCallsPerDay > 0 || l.TokensPerDay > 0
+}
+
+// Options 是 Limiter 的配置
+type Options struct {
+	PerSender  Limits   // 每个发送者（channel:senderID）的限制
+	PerChannel Limits   // 每个频道（所有发送者合计）的限制
+	Exempt     []string // 不受限制的发送者 ID（例如主人自己），可以写 "123" 或 "telegram:123"
+	StatePath  string   // 每日用量的保存位置，为空表示只保存在内存中
+}
+
+// usage 是一个键（发送者或频道）当天的用量
+type usage struct {
+	LLMCalls int `json:"llm_calls"`
+	Tokens   int `json:"tokens"`
+}
+
+// state 是持久化到磁盘的每日用量
+type state struct {
+	Day   string            `json:"day"`   // 日期（YYYY-MM-DD），跨天时清零
+	Usage map[string]*usage `json:"usage"` // "sender:channel:id" 或 "channel:name" -> 用量
+}
+
+// Limiter 检查和记录消息、LLM 调用和 token 用量
+type Limiter struct {
+	opts   Options
+	exempt map[string]bool
+	recent map[string][]time.Time // 键 -> 最近一分钟内的消息时间
+	state  state
+	mu     sync.Mutex
+}
+
+// Decision 是一次检查的结果
+type Decision struct {
+	Allowed bool   // 是否允许处理
+	Reason  string // 拒绝原因（给用户看的提示）
+	Notify  bool   // 是否需要回复提示（同一原因每分钟只提示一次，避免刷屏）
+}
+
+// New 创建 Limiter
+// 参数:
+//
+//	opts: 限制配置
+func New(opts Options) *Limiter {
+	l := &Limiter{
+		opts:   opts,
+		exempt: make(map[string]bool, len(opts.Exempt)),
+		recent: make(map[string][]time.Time),
+	}
+	for _, id := range opts.Exempt {
+		l.exempt[id] = true
+	}
+	l.load()
+	return l
+}
+
+// Enabled 判断是否设置了任何限制
+func (l *Limiter) Enabled() bool {
+	return l != nil && (l.opts.PerSender.enabled() || l.opts.PerChannel.enabled())
+}
+
+// Allow 检查是否允许处理一条消息，允许时计入每分钟消息数
+// 参数:
+//
+//	channel: 频道名称
+//	senderID: 发送者 ID
+func (l *Limiter) Allow(channel, senderID string) Decision {
+	if !l.Enabled() || l.isExempt(channel, senderID) {
+		return Decision{Allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover()
+
+	now := time.Now()
+	senderKey, channelKey := senderKey(channel, senderID), channelKey(channel)
+
+	checks := []struct {
+		key    string
+		limits Limits
+		scope  string
+	}{
+		{senderKey, l.opts.PerSender, "you"},
+		{channelKey, l.opts.PerChannel, "this channel"},
+	}
+
+	for _, c := range checks {
+		u := l.state.Usage[c.key]
+		if u != nil && c.limits.LLMCallsPerDay > 0 && u.LLMCalls >= c.limits.LLMCallsPerDay {
+			return l.deny(c.key+":daily", fmt.Sprintf("⛔ The daily request limit for %s has been reached (%d). Please try again tomorrow.", c.scope, c.limits.LLMCallsPerDay), now)
+		}
+		if u != nil && c.limits.TokensPerDay > 0 && u.Tokens >= c.limits.TokensPerDay {
+			return l.deny(c.key+":daily", fmt.Sprintf("⛔ The daily usage budget for %s has been used up. Please try again tomorrow.", c.scope), now)
+		}
+		if c.limits.MessagesPerMinute > 0 && len(l.window(c.key, now)) >= c.limits.MessagesPerMinute {
+			return l.deny(c.key+":minute", fmt.Sprintf("⏳ Too many messages from %s — the limit is %d per minute. Please wait a moment and try again.", c.scope, c.limits.MessagesPerMinute), now)
+		}
+	}
+
+	l.recent[senderKey] = append(l.recent[senderKey], now)
+	l.recent[channelKey] = append(l.recent[channelKey], now)
+	return Decision{Allowed: true}
+}
+
+// RecordLLM 记录一次 LLM 调用和消耗的 token
+// 参数:
+//
+//	channel: 频道名称
+//	senderID: 触发调用的发送者 ID
+//	tokens: 本次调用消耗的 token 数
+func (l *Limiter) RecordLLM(channel, senderID string, tokens int) {
+	if !l.Enabled() || l.isExempt(channel, senderID) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover()
+	for _, key := range []string{senderKey(channel, senderID), channelKey(channel)} {
+		u := l.state.Usage[key]
+		if u == nil {
+			u = &usage{}
+			l.state.Usage[key] = u
+		}
+		u.LLMCalls++
+		u.Tokens += tokens
+	}
+	l.save()
+}
+
+// Usage 返回发送者当天的 LLM 调用次数和 token 用量
+func (l *Limiter) Usage(channel, senderID string) (int, int) {
+	if l == nil {
+		return 0, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover()
+	if u := l.state.Usage[senderKey(channel, senderID)]; u != nil {
+		return u.LLMCalls, u.Tokens
+	}
+	return 0, 0
+}
+
+// deny 生成拒绝结果（调用方需持有 l.mu）
+// 同一原因每分钟只提示一次
+func (l *Limiter) deny(noticeKey, reason string, now time.Time) Decision {
+	key := "notice:" + noticeKey
+	notify := len(l.window(key, now)) == 0
+	if notify {
+		l.recent[key] = append(l.recent[key], now)
+	}
+	return Decision{Reason: reason, Notify: notify}
+}
+
+// window 返回键在最近一分钟内的记录，并清理过期的记录（调用方需持有 l.mu）
+func (l *Limiter) window(key string, now time.Time) []time.Time {
+	times := l.recent[key]
+	i := 0
+	for i < len(times) && now.Sub(times[i]) >= time.Minute {
+		i++
+	}
+	if i == len(times) {
+		delete(l.recent, key)
+		return nil
+	}
+	times = times[i:]
+	l.recent[key] = times
+	return times
+}
+
+// rollover 跨天时清零每日用量（调用方需持有 l.mu）
+func (l *Limiter) rollover() {
+	today := time.Now().Format("2006-01-02")
+	if l.state.Day != today {
+		l.state = state{Day: today, Usage: make(map[string]*usage)}
+	}
+}
+
+// isExempt 判断发送者是否不受限制
+func (l *Limiter) isExempt(channel, senderID string) bool {
+	return l.exempt[senderID] || l.exempt[channel+":"+senderID]
+}
+
+// load 读取保存的每日用量
+func (l *Limiter) load() {
+	l.rollover()
+	if l.opts.StatePath == "" {
+		return
+	}
+	data, err := os.ReadFile(l.opts.StatePath)
+	if err != nil {
+		return
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		log.Printf("[RateLimit] 读取 %s 失败: %v", l.opts.StatePath, err)
+		return
+	}
+	if st.Day == l.state.Day && st.Usage != nil {
+		l.state = st
+	}
+}
+
+// save 保存每日用量（调用方需持有 l.mu）
+func (l *Limiter) save() {
+	if l.opts.StatePath == "" {
+		return
+	}
+	data, err := json.MarshalIndent(l.state, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(l.opts.StatePath), 0755); err != nil {
+		log.Printf("[RateLimit] 保存用量失败: %v", err)
+		return
+	}
+	if err := os.WriteFile(l.opts.StatePath, data, 0644); err != nil {
+		log.Printf("[RateLimit] 保存用量失败: %v", err)
+	}
+}
+
+func senderKey(channel, senderID string) string {
+	return "sender:" + channel + ":" + senderID
+}
+
+func channelKey(channel string) string {
+	return "channel:" + channel
+}
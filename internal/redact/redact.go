@@ -0,0 +1,131 @@
+// Package redact 从文本中去除密钥
+//
+// 工具输出（例如 env 命令、读取配置文件）中的 API Key、Token 和密码会进入日志、
+// 模型上下文和会话文件。Redactor 把两类内容替换为 "[REDACTED]"：
+//   - 配置中的已知密钥（providers 的 apiKey、频道 token 等），按原文精确匹配
+//   - 看起来像密钥的字符串：常见服务的密钥格式、Bearer 令牌、私钥块，
+//     以及 PASSWORD=...、api_key: ... 这样的赋值（保留名称，只替换值）
+//
+// 当前使用的 Redactor 是全局的（Set），启动前就生效的默认 Redactor 只包含内置规则。
+package redact
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Placeholder 是替换密钥的文本
+const Placeholder = "[REDACTED]"
+
+// minSecretLength 已知密钥的最短长度，更短的值（例如 "true"、端口号）容易误伤正常文本
+const minSecretLength = 8
+
+// builtinPatterns 内置的密钥格式
+var builtinPatterns = []string{
+	`sk-(?:ant-)?[A-Za-z0-9_\-]{20,}`,   // OpenAI / Anthropic
+	`gh[pousr]_[A-Za-z0-9]{30,}`,        // GitHub token
+	`github_pat_[A-Za-z0-9_]{30,}`,      // GitHub fine-grained token
+	`xox[abprs]-[A-Za-z0-9\-]{10,}`,     // Slack token
+	`AKIA[0-9A-Z]{16}`,                  // AWS access key ID
+	`AIza[0-9A-Za-z_\-]{35}`,            // Google API key
+	`\b\d{8,10}:AA[A-Za-z0-9_\-]{33}\b`, // Telegram bot token
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`, // 私钥块
+}
+
+// prefixedPatterns 只替换第二个分组（值）的规则，保留前面的名称便于阅读
+var prefixedPatterns = []*regexp.Regexp{
+	// Authorization: Bearer xxx
+	regexp.MustCompile(`(?i)(\bbearer\s+)([A-Za-z0-9._~+/=\-]{16,})`),
+	// PASSWORD=xxx、api_key: "xxx"、"token": "xxx"
+	regexp.MustCompile(`(?i)(\b[a-z0-9_\-]*(?:password|passwd|secret|token|api_?key|access_?key|private_?key)[a-z0-9_\-]*"?\s*[:=]\s*["']?)([^\s"',;]{6,})`),
+}
+
+// Redactor 去除文本中的密钥
+type Redactor struct {
+	secrets  []string         // 已知密钥（按长度从长到短，避免部分替换）
+	patterns []*regexp.Regexp // 密钥格式
+}
+
+// New 创建 Redactor
+// 参数:
+//
+//	secrets: 已知密钥的原文（过短的值会被忽略）
+//	patterns: 额外的密钥格式（正则表达式），匹配的整段文本会被替换
+//
+// 返回:
+//
+//	Redactor，以及无效的正则表达式导致的错误（其余规则仍然生效）
+func New(secrets []string, patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	seen := make(map[string]bool)
+	for _, secret := range secrets {
+		secret = strings.TrimSpace(secret)
+		if len(secret) < minSecretLength || seen[secret] {
+			continue
+		}
+		seen[secret] = true
+		r.secrets = append(r.secrets, secret)
+	}
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+
+	for _, pattern := range builtinPatterns {
+		r.patterns = append(r.patterns, regexp.MustCompile(pattern))
+	}
+	var firstErr error
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, firstErr
+}
+
+// String 返回去除密钥后的文本
+func (r *Redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, secret := range r.secrets {
+		if strings.Contains(s, secret) {
+			s = strings.ReplaceAll(s, secret, Placeholder)
+		}
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, Placeholder)
+	}
+	for _, re := range prefixedPatterns {
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			groups := re.FindStringSubmatch(match)
+			if groups[2] == Placeholder || strings.HasPrefix(groups[2], Placeholder) {
+				return match
+			}
+			return groups[1] + Placeholder
+		})
+	}
+	return s
+}
+
+// current 是当前使用的 Redactor
+var current atomic.Pointer[Redactor]
+
+func init() {
+	r, _ := New(nil, nil)
+	current.Store(r)
+}
+
+// Set 设置当前使用的 Redactor（nil 表示不再去除密钥）
+func Set(r *Redactor) {
+	current.Store(r)
+}
+
+// String 使用当前的 Redactor 去除文本中的密钥
+func String(s string) string {
+	return current.Load().String(s)
+}
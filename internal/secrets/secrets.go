@@ -0,0 +1,226 @@
+// Package secrets 提供静态数据加密
+//
+// 使用 AES-256-GCM 加密配置中的 API Key 和会话文件内容。
+// 加密后的值以 "enc:v1:" 开头，后接 base64 编码的 nonce+密文，可以直接写在 config.yaml 中。
+//
+// 密钥的查找顺序：
+//  1. 环境变量 NANOGRIP_SECRET_KEY（base64 编码的 32 字节密钥）
+//  2. 配置目录下的 secret.key 文件（由 "nanogrip secrets init" 生成，权限 0600）
+//  3. 系统钥匙串（macOS 的 security 命令，Linux 的 secret-tool 命令）
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Prefix 是加密值的前缀
+const Prefix = "enc:v1:"
+
+// KeyFileName 是配置目录下密钥文件的名称
+const KeyFileName = "secret.key"
+
+// keySize AES-256 密钥长度
+const keySize = 32
+
+// 钥匙串中保存密钥使用的服务名和账户名
+const (
+	keychainService = "nanogrip"
+	keychainAccount = "secret-key"
+)
+
+// ErrNoKey 表示没有找到加密密钥
+var ErrNoKey = errors.New("no encryption key found; run \"nanogrip secrets init\" first")
+
+// Cipher 负责加密和解密
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher 使用 32 字节密钥创建 Cipher
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt 加密数据，返回带 Prefix 的字符串
+func (c *Cipher) Encrypt(plaintext []byte) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, plaintext, nil)
+	return Prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密由 Encrypt 生成的字符串
+func (c *Cipher) Decrypt(value string) ([]byte, error) {
+	if !IsEncrypted(value) {
+		return nil, fmt.Errorf("value is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, Prefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, fmt.Errorf("invalid encrypted value: too short")
+	}
+	plaintext, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed (wrong key?): %w", err)
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted 判断字符串是否为加密值
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Open 查找密钥并创建 Cipher
+// 参数:
+//
+//	configDir: 配置文件所在目录（secret.key 的位置）
+//
+// 返回:
+//
+//	找不到密钥时返回 ErrNoKey
+func Open(configDir string) (*Cipher, error) {
+	key, err := LoadKey(configDir)
+	if err != nil {
+		return nil, err
+	}
+	return NewCipher(key)
+}
+
+// LoadKey 按顺序从环境变量、密钥文件和系统钥匙串查找密钥
+func LoadKey(configDir string) ([]byte, error) {
+	if encoded := strings.TrimSpace(os.Getenv("NANOGRIP_SECRET_KEY")); encoded != "" {
+		return decodeKey(encoded, "NANOGRIP_SECRET_KEY")
+	}
+
+	path := filepath.Join(configDir, KeyFileName)
+	if data, err := os.ReadFile(path); err == nil {
+		return decodeKey(string(data), path)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if encoded, err := readKeychain(); err == nil && encoded != "" {
+		return decodeKey(encoded, "keychain")
+	}
+	return nil, ErrNoKey
+}
+
+// Init 生成新密钥
+// 参数:
+//
+//	configDir: 配置目录，useKeychain 为 false 时密钥写入 configDir/secret.key
+//	useKeychain: 是否保存到系统钥匙串
+//
+// 返回:
+//
+//	密钥的保存位置说明；已存在密钥时返回错误，避免旧数据无法解密
+func Init(configDir string, useKeychain bool) (string, error) {
+	if _, err := LoadKey(configDir); err == nil {
+		return "", fmt.Errorf("an encryption key already exists")
+	}
+
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	if useKeychain {
+		if err := writeKeychain(encoded); err != nil {
+			return "", err
+		}
+		return "system keychain (service \"" + keychainService + "\")", nil
+	}
+
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(configDir, KeyFileName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(encoded + "\n"); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func decodeKey(encoded string, source string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key in %s: %w", source, err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("invalid encryption key in %s: expected %d bytes", source, keySize)
+	}
+	return key, nil
+}
+
+// readKeychain 从系统钥匙串读取密钥
+func readKeychain() (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keychainService, "-a", keychainAccount, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", keychainService, "account", keychainAccount)
+	default:
+		return "", fmt.Errorf("system keychain is not supported on %s", runtime.GOOS)
+	}
+	if cmd.Err != nil {
+		return "", cmd.Err // 命令不存在
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// writeKeychain 把密钥保存到系统钥匙串
+func writeKeychain(encoded string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "add-generic-password", "-s", keychainService, "-a", keychainAccount, "-w", encoded)
+	case "linux":
+		cmd = exec.Command("secret-tool", "store", "--label=nanogrip secret key", "service", keychainService, "account", keychainAccount)
+		cmd.Stdin = bytes.NewBufferString(encoded)
+	default:
+		return fmt.Errorf("system keychain is not supported on %s", runtime.GOOS)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to store key in keychain: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package secrets
+
+// stream.go - 大文件的分块加密
+// Encrypt 需要把整个明文放在内存中，并且输出是 base64 文本，不适合备份这样的大文件。
+// 分块加密把数据切成固定大小的块，每块单独用 AES-256-GCM 加密后直接写出，内存占用只有一个块。
+//
+// 格式：StreamMagic、12 字节基础 nonce，然后是若干个块，每块为 4 字节大端长度加密文。
+// 第 i 块的 nonce 是基础 nonce 的最后 8 字节与 i 异或的结果，最后一块的附加数据为 {1}，其余为 {0}，
+// 因此块被调换顺序、删除或文件被截断时都无法解密。
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StreamMagic 是分块加密数据的开头
+const StreamMagic = "NGENCS1\n"
+
+// streamChunkSize 每块明文的大小
+const streamChunkSize = 64 * 1024
+
+// IsEncryptedStream 判断数据开头是否为分块加密数据
+func IsEncryptedStream(header []byte) bool {
+	return bytes.HasPrefix(header, []byte(StreamMagic))
+}
+
+// streamWriter 分块加密写入
+type streamWriter struct {
+	c       *Cipher
+	w       io.Writer
+	nonce   []byte
+	counter uint64
+	buf     []byte
+	closed  bool
+}
+
+// NewEncryptWriter 返回分块加密的 Writer，写入的数据加密后写到 w
+// 必须调用 Close 写入最后一块，否则数据无法解密（Close 不会关闭 w）
+func (c *Cipher) NewEncryptWriter(w io.Writer) (io.WriteCloser, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, StreamMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(nonce); err != nil {
+		return nil, err
+	}
+	return &streamWriter{c: c, w: w, nonce: nonce, buf: make([]byte, 0, streamChunkSize)}, nil
+}
+
+// Write 缓存数据，每满一块加密写出
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New("write to closed encrypt writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		n := copy(s.buf[len(s.buf):cap(s.buf)], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+		written += n
+		// 缓冲区满并且还有数据时才写出，保证最后一块由 Close 写出
+		if len(s.buf) == cap(s.buf) && len(p) > 0 {
+			if err := s.flush(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close 写出最后一块（可能为空）
+func (s *streamWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.flush(true)
+}
+
+// flush 加密并写出缓冲区中的一块
+func (s *streamWriter) flush(final bool) error {
+	sealed := s.c.aead.Seal(nil, chunkNonce(s.nonce, s.counter), s.buf, chunkAD(final))
+	s.counter++
+	s.buf = s.buf[:0]
+
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(sealed)))
+	if _, err := s.w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := s.w.Write(sealed)
+	return err
+}
+
+// streamReader 分块解密读取
+type streamReader struct {
+	c       *Cipher
+	r       io.Reader
+	nonce   []byte
+	counter uint64
+	plain   []byte
+	done    bool
+}
+
+// NewDecryptReader 返回读取 NewEncryptWriter 写入的数据的 Reader
+// 数据被篡改、截断或密钥不正确时 Read 返回错误
+func (c *Cipher) NewDecryptReader(r io.Reader) (io.Reader, error) {
+	header := make([]byte, len(StreamMagic)+c.aead.NonceSize())
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("invalid encrypted stream: %w", err)
+	}
+	if !IsEncryptedStream(header) {
+		return nil, fmt.Errorf("invalid encrypted stream: bad header")
+	}
+	return &streamReader{c: c, r: r, nonce: header[len(StreamMagic):]}, nil
+}
+
+// Read 返回解密后的数据，需要时读取并解密下一块
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+// next 读取并解密下一块
+func (s *streamReader) next() error {
+	var size [4]byte
+	if _, err := io.ReadFull(s.r, size[:]); err != nil {
+		return fmt.Errorf("encrypted stream is truncated: %w", err)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > streamChunkSize+uint32(s.c.aead.Overhead()) {
+		return fmt.Errorf("invalid encrypted stream: chunk too large")
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(s.r, sealed); err != nil {
+		return fmt.Errorf("encrypted stream is truncated: %w", err)
+	}
+
+	nonce := chunkNonce(s.nonce, s.counter)
+	plain, err := s.c.aead.Open(nil, nonce, sealed, chunkAD(false))
+	if err != nil {
+		if plain, err = s.c.aead.Open(nil, nonce, sealed, chunkAD(true)); err != nil {
+			return fmt.Errorf("decryption failed (wrong key?): %w", err)
+		}
+		s.done = true
+	}
+	s.counter++
+	s.plain = plain
+	return nil
+}
+
+// chunkNonce 返回第 counter 块的 nonce
+func chunkNonce(base []byte, counter uint64) []byte {
+	nonce := make([]byte, len(base))
+	copy(nonce, base)
+	tail := nonce[len(nonce)-8:]
+	binary.BigEndian.PutUint64(tail, binary.BigEndian.Uint64(tail)^counter)
+	return nonce
+}
+
+// chunkAD 返回块的附加数据，标记是否为最后一块
+func chunkAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
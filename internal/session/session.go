@@ -28,11 +28,19 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/Ailoc/nanogrip/internal/redact"
+	"github.com/Ailoc/nanogrip/internal/secrets"
 )
 
 // Message 表示一条聊天消息
@@ -44,6 +52,7 @@ type Message struct {
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // 助手调用的工具列表（仅 assistant 角色）
 	ToolCallID string     `json:"tool_call_id,omitempty"` // 工具结果对应的调用 ID（仅 tool 角色）
 	Name       string     `json:"name,omitempty"`         // 工具名称（仅 tool 角色）
+	Media      []string   `json:"media,omitempty"`        // 附带的媒体文件路径或 URL（仅 user 角色）
 }
 
 // ToolCall 表示消息中的工具调用
@@ -60,6 +69,9 @@ type FunctionCall struct {
 	Arguments string `json:"arguments"` // 函数参数（JSON 字符串格式）
 }
 
+// TitleKey 会话元数据中保存自动生成的标题的键
+const TitleKey = "title"
+
 // Session 表示一个对话会话
 //
 // Session 包含会话的所有消息和元数据，并提供线程安全的访问方法。
@@ -118,6 +130,21 @@ func (s *Session) AddMessage(role, content string, toolCalls []ToolCall) {
 	s.UpdatedAt = time.Now()
 }
 
+// AddMessageWithMedia 添加一条附带媒体文件的消息
+// 只保存文件路径或 URL，之后的回合可以重新读取图片发送给视觉模型
+func (s *Session) AddMessageWithMedia(role, content string, media []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Messages = append(s.Messages, Message{
+		Role:      role,
+		Content:   content,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Media:     media,
+	})
+	s.UpdatedAt = time.Now()
+}
+
 // GetHistory 获取最近的消息历史，以 LLM API 兼容的格式返回
 //
 // 该方法会将内部的 Message 结构转换为 map 格式，方便直接传递给 LLM API。
@@ -153,6 +180,9 @@ func (s *Session) GetHistory(maxMessages int) []map[string]interface{} {
 		if m.Name != "" {
 			entry["name"] = m.Name
 		}
+		if len(m.Media) > 0 {
+			entry["media"] = m.Media
+		}
 
 		result = append(result, entry)
 	}
@@ -172,6 +202,46 @@ func (s *Session) Clear() {
 	s.UpdatedAt = time.Now()
 }
 
+// Truncate 只保留前 n 条消息
+//
+// 该方法是线程安全的；合并索引超过 n 时一并调整（已经整理到长期记忆的内容不会被撤销）。
+//
+// 参数：
+//   - n: 保留的消息数量
+func (s *Session) Truncate(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n < 0 || n >= len(s.Messages) {
+		return
+	}
+	s.Messages = s.Messages[:n]
+	if s.LastConsolidated > n {
+		s.LastConsolidated = n
+	}
+	s.UpdatedAt = time.Now()
+}
+
+// Clone 复制会话的消息和元数据，作为新会话
+//
+// 参数：
+//   - key: 新会话的标识符
+//
+// 返回：
+//   - *Session: 新会话（创建时间为当前时间）
+func (s *Session) Clone(key string) *Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clone := NewSession(key)
+	clone.Messages = append(clone.Messages, s.Messages...)
+	clone.LastConsolidated = s.LastConsolidated
+	for k, v := range s.Metadata {
+		clone.Metadata[k] = v
+	}
+	return clone
+}
+
 // SessionManager 管理对话会话的生命周期和持久化
 //
 // SessionManager 职责：
@@ -184,18 +254,23 @@ func (s *Session) Clear() {
 //   - 最大缓存数量：1000 个会话
 //   - 超过限制时，删除最少使用的会话
 //   - 访问会话时会更新其使用时间
+//   - EvictIdle 可卸载长时间未访问的会话（会话已持久化，下次访问时从磁盘重新加载）
 //
 // JSONL 持久化格式：
 //   - 每个会话保存为一个 .jsonl 文件
 //   - 文件名是会话 key 的安全文件名版本
 //   - 第一行是元数据，后续每行是一条消息
 type SessionManager struct {
-	workspace   string              // 工作区根目录路径
-	sessionsDir string              // 会话文件存储目录（workspace/sessions）
-	cache       map[string]*Session // 会话缓存，键为会话 key
-	cacheMu     sync.RWMutex        // 缓存读写锁
-	maxCache    int                 // 最大缓存数量
-	accessOrder []string            // 访问顺序，用于 LRU 淘汰
+	workspace   string               // 工作区根目录路径
+	sessionsDir string               // 会话文件存储目录（workspace/sessions）
+	cache       map[string]*Session  // 会话缓存，键为会话 key
+	cacheMu     sync.RWMutex         // 缓存读写锁
+	maxCache    int                  // 最大缓存数量
+	accessOrder []string             // 访问顺序，用于 LRU 淘汰
+	lastAccess  map[string]time.Time // 每个缓存会话的最后访问时间，用于空闲卸载
+	cipher      *secrets.Cipher      // 会话文件加密（nil 表示明文保存）
+	readCipher  *secrets.Cipher      // 只用于读取已加密记录的密钥（关闭加密后仍能读取之前加密的会话）
+	readOnly    map[string]bool      // 有记录无法解密的会话，不允许保存（保存会覆盖这些记录），键为会话 key
 }
 
 // NewSessionManager 创建一个新的会话管理器
@@ -212,7 +287,64 @@ func NewSessionManager(workspace string) *SessionManager {
 		cache:       make(map[string]*Session),
 		maxCache:    1000, // 默认最大缓存 1000 个会话
 		accessOrder: make([]string, 0, 100),
+		lastAccess:  make(map[string]time.Time),
+		readOnly:    make(map[string]bool),
+	}
+}
+
+// ErrReadOnly 表示会话文件中有无法解密的记录，保存会永久丢失这些记录
+var ErrReadOnly = errors.New("session has records that cannot be decrypted; not saving to avoid losing them")
+
+// SetCipher 启用会话文件加密
+//
+// 启用后每一行（元数据和消息）都单独加密保存为 "enc:v1:..."。
+// 之前保存的明文会话仍然可以读取，下次保存时会被加密。
+//
+// 参数：
+//   - c: 加密器，nil 表示明文保存
+func (sm *SessionManager) SetCipher(c *secrets.Cipher) {
+	sm.cipher = c
+}
+
+// SetReadCipher 设置只用于读取的密钥
+//
+// 关闭加密（SetCipher(nil)）后，之前加密保存的会话仍然用这个密钥读取，下次保存时改为明文。
+//
+// 参数：
+//   - c: 加密器，nil 表示没有可用的密钥
+func (sm *SessionManager) SetReadCipher(c *secrets.Cipher) {
+	sm.readCipher = c
+}
+
+// decodeLine 解密（如有需要）并返回一行的 JSON 内容
+func (sm *SessionManager) decodeLine(line []byte) ([]byte, error) {
+	if !secrets.IsEncrypted(string(line)) {
+		return line, nil
+	}
+	c := sm.cipher
+	if c == nil {
+		c = sm.readCipher
+	}
+	if c == nil {
+		return nil, secrets.ErrNoKey
+	}
+	return c.Decrypt(string(line))
+}
+
+// encodeLine 序列化并（如已启用）加密一行内容
+func (sm *SessionManager) encodeLine(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if sm.cipher != nil {
+		encrypted, err := sm.cipher.Encrypt(data)
+		if err != nil {
+			return nil, err
+		}
+		data = []byte(encrypted)
 	}
+	return append(data, '\n'), nil
 }
 
 // EnsureDir 确保目录存在，如果不存在则创建
@@ -249,6 +381,7 @@ func (sm *SessionManager) GetOrCreate(key string) *Session {
 		sm.cacheMu.RUnlock()
 		sm.cacheMu.Lock()
 		sm.moveToEnd(key)
+		sm.lastAccess[key] = time.Now()
 		sm.cacheMu.Unlock()
 		return session
 	}
@@ -266,8 +399,11 @@ func (sm *SessionManager) GetOrCreate(key string) *Session {
 		// 淘汰最少使用的会话
 		sm.evictOldest()
 	}
+	if _, exists := sm.cache[key]; !exists {
+		sm.accessOrder = append(sm.accessOrder, key)
+	}
 	sm.cache[key] = session
-	sm.accessOrder = append(sm.accessOrder, key)
+	sm.lastAccess[key] = time.Now()
 	sm.cacheMu.Unlock()
 
 	return session
@@ -295,6 +431,56 @@ func (sm *SessionManager) evictOldest() {
 	oldestKey := sm.accessOrder[0]
 	sm.accessOrder = sm.accessOrder[1:]
 	delete(sm.cache, oldestKey)
+	delete(sm.lastAccess, oldestKey)
+}
+
+// removeFromOrder 从访问顺序中移除 key（调用方需持有 cacheMu）
+func (sm *SessionManager) removeFromOrder(key string) {
+	for i, k := range sm.accessOrder {
+		if k == key {
+			sm.accessOrder = append(sm.accessOrder[:i], sm.accessOrder[i+1:]...)
+			return
+		}
+	}
+}
+
+// EvictIdle 卸载超过 maxIdle 未被访问的会话
+//
+// 会话在每次处理消息后都会保存到磁盘，因此卸载只释放内存，
+// 下次 GetOrCreate 时会从磁盘重新加载。
+//
+// 参数：
+//   - maxIdle: 最大空闲时长，<= 0 时不做任何处理
+//
+// 返回：
+//   - int: 被卸载的会话数量
+func (sm *SessionManager) EvictIdle(maxIdle time.Duration) int {
+	if maxIdle <= 0 {
+		return 0
+	}
+
+	sm.cacheMu.Lock()
+	defer sm.cacheMu.Unlock()
+
+	cutoff := time.Now().Add(-maxIdle)
+	evicted := 0
+	for key := range sm.cache {
+		if last, ok := sm.lastAccess[key]; ok && last.After(cutoff) {
+			continue
+		}
+		delete(sm.cache, key)
+		delete(sm.lastAccess, key)
+		sm.removeFromOrder(key)
+		evicted++
+	}
+	return evicted
+}
+
+// CacheSize 返回当前缓存的会话数量
+func (sm *SessionManager) CacheSize() int {
+	sm.cacheMu.RLock()
+	defer sm.cacheMu.RUnlock()
+	return len(sm.cache)
 }
 
 // load 从磁盘加载会话
@@ -331,10 +517,54 @@ func (sm *SessionManager) load(key string) *Session {
 	}
 	defer file.Close()
 
+	session, undecryptable := sm.parse(key, file)
+	if undecryptable > 0 {
+		// 保存会用内存中不完整的历史覆盖文件，这些记录将永久丢失
+		log.Printf("[Session] 会话 %s 有 %d 条记录无法解密（密钥缺失或不正确），会话在本次运行中不会被保存", key, undecryptable)
+		sm.cacheMu.Lock()
+		sm.readOnly[key] = true
+		sm.cacheMu.Unlock()
+	}
+	return session
+}
+
+// LoadFile 从指定路径加载会话文件（例如 nanogrip replay 回放的会话）
+// 会话不会放入缓存；启用加密时使用会话管理器的密钥解密
+//
+// 参数：
+//   - path: 会话文件路径（.jsonl）
+//
+// 返回：
+//   - *Session: 加载的会话，会话键取自文件中的元数据（没有时使用文件名）
+//   - error: 文件无法读取或有记录无法解密时返回错误
+func (sm *SessionManager) LoadFile(path string) (*Session, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	session, undecryptable := sm.parse(strings.TrimSuffix(filepath.Base(path), ".jsonl"), file)
+	if undecryptable > 0 {
+		return nil, fmt.Errorf("%d record(s) in %s cannot be decrypted: %w", undecryptable, path, secrets.ErrNoKey)
+	}
+	return session, nil
+}
+
+// parse 解析会话文件的内容
+// 参数：
+//   - key: 会话标识符（元数据中记录了会话键时以元数据为准）
+//   - file: 会话文件
+//
+// 返回：
+//   - *Session: 解析出的会话（跳过无法解析的行）
+//   - int: 无法解密的记录数
+func (sm *SessionManager) parse(key string, file io.Reader) (*Session, int) {
 	var messages []Message
 	metadata := make(map[string]interface{})
 	var createdAt time.Time
 	lastConsolidated := 0
+	undecryptable := 0
 
 	reader := bufio.NewReader(file)
 	for {
@@ -350,6 +580,14 @@ func (sm *SessionManager) load(key string) *Session {
 			continue
 		}
 
+		if decoded, err := sm.decodeLine(line); err != nil {
+			log.Printf("[Session] 无法解密会话 %s 中的记录: %v", key, err)
+			undecryptable++
+			line = nil
+		} else {
+			line = decoded
+		}
+
 		var data map[string]interface{}
 		if err := json.Unmarshal(line, &data); err != nil {
 			if readErr == io.EOF {
@@ -362,6 +600,9 @@ func (sm *SessionManager) load(key string) *Session {
 		}
 
 		if data["_type"] == "metadata" {
+			if fileKey, ok := data["key"].(string); ok && fileKey != "" {
+				key = fileKey
+			}
 			if rawMetadata, ok := data["metadata"].(map[string]interface{}); ok {
 				metadata = rawMetadata
 			}
@@ -395,7 +636,67 @@ func (sm *SessionManager) load(key string) *Session {
 		session.CreatedAt = createdAt
 	}
 
-	return session
+	return session, undecryptable
+}
+
+// redactMessage 返回去除密钥后的消息副本（不修改内存中的会话）
+func redactMessage(msg Message) Message {
+	msg.Content = redact.String(msg.Content)
+	if len(msg.ToolCalls) > 0 {
+		calls := make([]ToolCall, len(msg.ToolCalls))
+		for i, tc := range msg.ToolCalls {
+			tc.Function.Arguments = redactArguments(tc.Function.Arguments)
+			calls[i] = tc
+		}
+		msg.ToolCalls = calls
+	}
+	return msg
+}
+
+// redactArguments 去除工具调用参数（JSON）中的密钥
+// 逐个处理解析出的字符串值再重新编码，避免替换破坏 JSON 的转义；参数不是合法 JSON 时按普通文本处理
+func redactArguments(args string) string {
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(args), &parsed); err != nil {
+		return redact.String(args)
+	}
+	redacted, changed := redactValue(parsed)
+	if !changed {
+		return args
+	}
+	data, err := json.Marshal(redacted)
+	if err != nil {
+		return redact.String(args)
+	}
+	return string(data)
+}
+
+// redactValue 递归去除 JSON 值中字符串的密钥，第二个返回值表示是否有改动
+func redactValue(v interface{}) (interface{}, bool) {
+	switch val := v.(type) {
+	case string:
+		redacted := redact.String(val)
+		return redacted, redacted != val
+	case map[string]interface{}:
+		changed := false
+		for key, item := range val {
+			if redacted, ok := redactValue(item); ok {
+				val[key] = redacted
+				changed = true
+			}
+		}
+		return val, changed
+	case []interface{}:
+		changed := false
+		for i, item := range val {
+			if redacted, ok := redactValue(item); ok {
+				val[i] = redacted
+				changed = true
+			}
+		}
+		return val, changed
+	}
+	return v, false
 }
 
 // Save 将会话保存到磁盘
@@ -417,24 +718,36 @@ func (sm *SessionManager) load(key string) *Session {
 //   - session: 要保存的会话
 //
 // 返回：
-//   - error: 保存失败时返回错误
+//   - error: 保存失败时返回错误；会话有无法解密的记录时返回 ErrReadOnly
 func (sm *SessionManager) Save(session *Session) error {
-	if err := EnsureDir(sm.sessionsDir); err != nil {
+	// 文件中有无法解密的记录时不覆盖（包括 /new 创建的同名新会话）
+	sm.cacheMu.RLock()
+	readOnly := sm.readOnly[session.Key]
+	sm.cacheMu.RUnlock()
+	if readOnly {
+		return ErrReadOnly
+	}
+
+	// 会话中通常包含个人数据，目录和文件只允许当前用户访问
+	if err := os.MkdirAll(sm.sessionsDir, 0700); err != nil {
 		return err
 	}
 
 	safeKey := safeFilename(session.Key)
 	path := filepath.Join(sm.sessionsDir, safeKey+".jsonl")
 
-	file, err := os.Create(path)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
+	file.Chmod(0600) // 修正旧版本创建的 0644 文件
 
-	encoder := json.NewEncoder(file)
+	encoder := lineEncoder{sm: sm, w: file}
+	session.mu.RLock()
+	defer session.mu.RUnlock()
 
-	// Write metadata
+	// Write metadata（message_count 让 ListSessions 不必读取整个文件）
 	metadata := map[string]interface{}{
 		"_type":             "metadata",
 		"key":               session.Key,
@@ -442,27 +755,46 @@ func (sm *SessionManager) Save(session *Session) error {
 		"updated_at":        session.UpdatedAt.Format(time.RFC3339),
 		"metadata":          session.Metadata,
 		"last_consolidated": session.LastConsolidated,
+		"message_count":     len(session.Messages),
 	}
 	if err := encoder.Encode(metadata); err != nil {
 		return err
 	}
 
-	// Write messages
-	session.mu.RLock()
-	defer session.mu.RUnlock()
+	// Write messages（去除密钥，见 redact 包）
 	for _, msg := range session.Messages {
-		if err := encoder.Encode(msg); err != nil {
+		if err := encoder.Encode(redactMessage(msg)); err != nil {
 			return err
 		}
 	}
 
 	sm.cacheMu.Lock()
+	if _, exists := sm.cache[session.Key]; !exists {
+		sm.accessOrder = append(sm.accessOrder, session.Key)
+	}
 	sm.cache[session.Key] = session
+	sm.lastAccess[session.Key] = time.Now()
 	sm.cacheMu.Unlock()
 
 	return nil
 }
 
+// lineEncoder 按行写入会话记录，启用加密时每行单独加密
+type lineEncoder struct {
+	sm *SessionManager
+	w  io.Writer
+}
+
+// Encode 写入一行记录
+func (e lineEncoder) Encode(v interface{}) error {
+	line, err := e.sm.encodeLine(v)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(line)
+	return err
+}
+
 // Invalidate 从缓存中移除会话
 //
 // 调用此方法后，下次 GetOrCreate 会从磁盘重新加载会话。
@@ -473,6 +805,8 @@ func (sm *SessionManager) Save(session *Session) error {
 func (sm *SessionManager) Invalidate(key string) {
 	sm.cacheMu.Lock()
 	delete(sm.cache, key)
+	delete(sm.lastAccess, key)
+	sm.removeFromOrder(key)
 	sm.cacheMu.Unlock()
 }
 
@@ -482,8 +816,11 @@ func (sm *SessionManager) Invalidate(key string) {
 // 返回所有会话的基本信息（key、创建时间、更新时间、文件路径）。
 //
 // 返回：
-//   - []map[string]interface{}: 会话信息列表，每个会话包含：
+//   - []map[string]interface{}: 会话信息列表（最近更新的在前），每个会话包含：
 //   - key: 会话标识符
+//   - channel: 会话所属的频道（key 中第一个 ":" 之前的部分）
+//   - title: 自动生成的标题（可能为空）
+//   - message_count: 消息数量
 //   - created_at: 创建时间
 //   - updated_at: 更新时间
 //   - path: 文件路径
@@ -506,32 +843,131 @@ func (sm *SessionManager) ListSessions() []map[string]interface{} {
 		}
 
 		var metadata map[string]interface{}
-		decoder := json.NewDecoder(file)
+		reader := bufio.NewReader(file)
+		firstLine, _ := reader.ReadBytes('\n')
 		var data map[string]interface{}
-		if err := decoder.Decode(&data); err == nil {
-			if data["_type"] == "metadata" {
+		if line, err := sm.decodeLine(bytes.TrimSpace(firstLine)); err == nil {
+			if err := json.Unmarshal(line, &data); err == nil && data["_type"] == "metadata" {
 				metadata = data
 			}
 		}
-		file.Close()
 
 		if metadata != nil {
 			key, _ := metadata["key"].(string)
 			if key == "" {
 				key = entry.Name()[:len(entry.Name())-len(".jsonl")]
 			}
+			title := ""
+			if meta, ok := metadata["metadata"].(map[string]interface{}); ok {
+				title, _ = meta[TitleKey].(string)
+			}
+			// 旧版本保存的会话没有 message_count，按行数计算
+			count, ok := metadata["message_count"].(float64)
+			if !ok {
+				count = float64(countLines(reader))
+			}
+			channel, _, _ := strings.Cut(key, ":")
 			sessions = append(sessions, map[string]interface{}{
-				"key":        key,
-				"created_at": metadata["created_at"],
-				"updated_at": metadata["updated_at"],
-				"path":       path,
+				"key":           key,
+				"channel":       channel,
+				"title":         title,
+				"message_count": int(count),
+				"created_at":    metadata["created_at"],
+				"updated_at":    metadata["updated_at"],
+				"path":          path,
 			})
 		}
+		file.Close()
 	}
 
+	sort.SliceStable(sessions, func(i, j int) bool {
+		a, _ := sessions[i]["updated_at"].(string)
+		b, _ := sessions[j]["updated_at"].(string)
+		return sessionTime(a).After(sessionTime(b))
+	})
 	return sessions
 }
 
+// countLines 返回剩余内容中的非空行数
+func countLines(r io.Reader) int {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	count := 0
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// sessionTime 解析元数据中的 RFC3339 时间，无效时返回零值
+func sessionTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
+
+// Expired 返回超出保留策略的会话 key（最旧的在前）
+//
+// 会话的最后更新时间取自元数据行的 updated_at，缺失时使用文件修改时间。
+// 超过 maxAge 未更新的会话，以及按更新时间排序后超出 maxCount 的最旧会话都会被返回。
+//
+// 参数：
+//   - maxAge: 最长保留时间，<= 0 表示不按时间过期
+//   - maxCount: 最多保留的会话数量，<= 0 表示不限制
+//
+// 返回：
+//   - []string: 应该归档的会话 key
+func (sm *SessionManager) Expired(maxAge time.Duration, maxCount int) []string {
+	type entry struct {
+		key     string
+		updated time.Time
+	}
+
+	var entries []entry
+	for _, info := range sm.ListSessions() {
+		key, _ := info["key"].(string)
+		path, _ := info["path"].(string)
+		updated, err := time.Parse(time.RFC3339, fmt.Sprint(info["updated_at"]))
+		if err != nil {
+			stat, statErr := os.Stat(path)
+			if statErr != nil {
+				continue
+			}
+			updated = stat.ModTime()
+		}
+		entries = append(entries, entry{key: key, updated: updated})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].updated.Before(entries[j].updated) })
+
+	var expired []string
+	cutoff := time.Now().Add(-maxAge)
+	for i, e := range entries {
+		tooOld := maxAge > 0 && e.updated.Before(cutoff)
+		tooMany := maxCount > 0 && len(entries)-i > maxCount
+		if tooOld || tooMany {
+			expired = append(expired, e.key)
+		}
+	}
+	return expired
+}
+
+// Delete 删除会话文件并从缓存中移除
+//
+// 参数：
+//   - key: 会话标识符
+//
+// 返回：
+//   - error: 删除失败时返回错误（文件不存在不视为错误）
+func (sm *SessionManager) Delete(key string) error {
+	sm.Invalidate(key)
+	path := filepath.Join(sm.sessionsDir, safeFilename(key)+".jsonl")
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 // safeFilename 将字符串转换为安全的文件名
 //
 // 转换规则：
@@ -0,0 +1,123 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Ailoc/nanogrip/internal/secrets"
+)
+
+func newTestCipher(t *testing.T, fill byte) *secrets.Cipher {
+	t.Helper()
+	c, err := secrets.NewCipher(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// saveEncrypted 用 c 加密保存一个有两条消息的会话，返回会话文件的内容
+func saveEncrypted(t *testing.T, workspace string, c *secrets.Cipher) []byte {
+	t.Helper()
+	sm := NewSessionManager(workspace)
+	sm.SetCipher(c)
+	sess := NewSession("telegram:42")
+	sess.AddMessage("user", "my password is hunter2", nil)
+	sess.AddMessage("assistant", "noted", nil)
+	if err := sm.Save(sess); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(workspace, "sessions", "telegram_42.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSessionCipherRoundTrip(t *testing.T) {
+	workspace := t.TempDir()
+	c := newTestCipher(t, 1)
+	data := saveEncrypted(t, workspace, c)
+	if bytes.Contains(data, []byte("hunter2")) {
+		t.Fatal("session file contains plaintext")
+	}
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		if !secrets.IsEncrypted(string(line)) {
+			t.Fatalf("line is not encrypted: %s", line)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		cipher      *secrets.Cipher
+		readCipher  *secrets.Cipher
+		wantHistory bool
+	}{
+		{"same key", c, nil, true},
+		{"encryption turned off with the key available", nil, c, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := NewSessionManager(workspace)
+			sm.SetCipher(tt.cipher)
+			sm.SetReadCipher(tt.readCipher)
+			sess := sm.GetOrCreate("telegram:42")
+			if got := len(sess.Messages); got != 2 {
+				t.Fatalf("loaded %d messages, want 2", got)
+			}
+			if sess.Messages[0].Content != "my password is hunter2" {
+				t.Fatalf("unexpected content %q", sess.Messages[0].Content)
+			}
+			if err := sm.Save(sess); err != nil {
+				t.Fatalf("Save() = %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionUndecryptableRecordsAreNotOverwritten(t *testing.T) {
+	tests := []struct {
+		name   string
+		cipher *secrets.Cipher
+	}{
+		{"encryption turned off without a key", nil},
+		{"wrong key", newTestCipher(t, 2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			original := saveEncrypted(t, workspace, newTestCipher(t, 1))
+
+			sm := NewSessionManager(workspace)
+			sm.SetCipher(tt.cipher)
+			sess := sm.GetOrCreate("telegram:42")
+			if len(sess.Messages) != 0 {
+				t.Fatalf("loaded %d messages from undecryptable records", len(sess.Messages))
+			}
+
+			sess.AddMessage("user", "hello", nil)
+			if err := sm.Save(sess); !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("Save() = %v, want ErrReadOnly", err)
+			}
+			// /new 创建的同名新会话同样不能覆盖文件
+			if err := sm.Save(NewSession("telegram:42")); !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("Save(new session) = %v, want ErrReadOnly", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(workspace, "sessions", "telegram_42.jsonl"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, original) {
+				t.Fatal("session file was modified")
+			}
+
+			if _, err := sm.LoadFile(filepath.Join(workspace, "sessions", "telegram_42.jsonl")); err == nil {
+				t.Fatal("LoadFile() succeeded with undecryptable records")
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package skills
+
+// commands.go - 技能声明的可执行命令
+// 技能目录中可以放一个 tools.json，声明一组可执行命令（脚本 + 参数定义），
+// 加载时每个命令注册为一个工具 skill_<技能>_<命令>，模型可以直接调用，而不必根据说明文档拼 shell 命令。
+//
+// tools.json 格式：
+//
+//	[
+//	  {
+//	    "name": "forecast",
+//	    "description": "Get the weather forecast for a city",
+//	    "command": "python3 scripts/forecast.py",
+//	    "args": ["--city {city}", "--days {days}"],
+//	    "parameters": {
+//	      "type": "object",
+//	      "properties": {
+//	        "city": {"type": "string"},
+//	        "days": {"type": "integer"}
+//	      },
+//	      "required": ["city"]
+//	    }
+//	  }
+//	]
+//
+// 命令在技能目录中执行；args 中的 {参数名} 替换为调用参数（自动加引号），
+// 引用了未提供参数的 args 项整项省略。
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// CommandsFile 是技能声明可执行命令的文件名（与 SKILL.md 位于同一目录）
+const CommandsFile = "tools.json"
+
+// maxToolNameLength 是 LLM 接口允许的工具名称最大长度
+const maxToolNameLength = 64
+
+// invalidToolNameChars 匹配工具名称中不允许的字符
+var invalidToolNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// Command 是技能声明的一个可执行命令
+type Command struct {
+	Name        string                 `json:"name"`        // 命令名称（工具名称中的 <命令> 部分）
+	Description string                 `json:"description"` // 命令说明（作为工具描述）
+	Command     string                 `json:"command"`     // 要执行的命令（相对技能目录）
+	Args        []string               `json:"args"`        // 参数模板，{参数名} 会被替换为调用参数
+	Parameters  map[string]interface{} `json:"parameters"`  // 参数定义（JSON Schema）
+}
+
+// LoadCommands 读取技能目录中的 tools.json
+//
+// 参数：
+//   - dir: 技能目录
+//
+// 返回：
+//   - []Command: 声明的命令，没有 tools.json 时为 nil
+//   - error: 文件格式错误或命令缺少 name/command 时返回错误
+func LoadCommands(dir string) ([]Command, error) {
+	data, err := os.ReadFile(filepath.Join(dir, CommandsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var commands []Command
+	if err := json.Unmarshal(data, &commands); err != nil {
+		return nil, fmt.Errorf("%s: %w", CommandsFile, err)
+	}
+	for i, cmd := range commands {
+		if cmd.Name == "" || cmd.Command == "" {
+			return nil, fmt.Errorf("%s: command #%d needs a name and a command", CommandsFile, i+1)
+		}
+		if cmd.Parameters == nil {
+			commands[i].Parameters = map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			}
+		}
+	}
+	return commands, nil
+}
+
+// CommandToolName 返回技能命令注册的工具名称：skill_<技能>_<命令>
+func CommandToolName(skillName, command string) string {
+	name := "skill_" + skillName + "_" + command
+	name = invalidToolNameChars.ReplaceAllString(name, "_")
+	if len(name) > maxToolNameLength {
+		name = name[:maxToolNameLength]
+	}
+	return name
+}
+
+// BuildArgs 根据参数模板生成命令行参数
+//
+// 参数：
+//   - templates: args 模板（每项按空格拆分为多个参数）
+//   - params: 调用参数
+//
+// 返回：
+//   - []string: 替换后的参数（未加引号）
+func BuildArgs(templates []string, params map[string]interface{}) []string {
+	placeholder := regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+	var args []string
+	for _, tmpl := range templates {
+		// 引用了未提供参数的项整项省略（用于可选参数）
+		missing := false
+		for _, match := range placeholder.FindAllStringSubmatch(tmpl, -1) {
+			if value, ok := params[match[1]]; !ok || value == nil {
+				missing = true
+				break
+			}
+		}
+		if missing {
+			continue
+		}
+
+		for _, word := range strings.Fields(tmpl) {
+			args = append(args, placeholder.ReplaceAllStringFunc(word, func(m string) string {
+				return formatArg(params[m[1:len(m)-1]])
+			}))
+		}
+	}
+	return args
+}
+
+// formatArg 把调用参数转换为命令行参数（对象和数组使用 JSON）
+func formatArg(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%f", v), "0"), ".")
+	case bool:
+		return fmt.Sprintf("%t", v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
@@ -0,0 +1,263 @@
+package skills
+
+// manage.go - 技能管理（nanogrip skills 命令）
+// 支持从 git 仓库或本地目录安装技能到 workspace/skills、启用/禁用技能，
+// 并在安装时校验 SKILL.md 的 frontmatter，报告缺少的依赖。
+//
+// 被禁用的技能记录在 workspace/skills/.disabled 中（每行一个名称），
+// 内置技能和工作区技能都可以禁用，禁用后不会出现在技能摘要中。
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// disabledFile 记录被禁用技能的文件名（位于 workspace/skills 中）
+const disabledFile = ".disabled"
+
+// skillNamePattern 是合法的技能名称（同时也是目录名）
+var skillNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Disabled 返回被禁用的技能名称
+func (s *SkillsLoader) Disabled() map[string]bool {
+	disabled := make(map[string]bool)
+	data, err := os.ReadFile(filepath.Join(s.workspaceSkills, disabledFile))
+	if err != nil {
+		return disabled
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if name := strings.TrimSpace(line); name != "" && !strings.HasPrefix(name, "#") {
+			disabled[name] = true
+		}
+	}
+	return disabled
+}
+
+// AllSkills 列出所有技能，包括被禁用和缺少依赖的技能（用于 nanogrip skills list）
+func (s *SkillsLoader) AllSkills() []*Skill {
+	return s.listSkills(false, nil)
+}
+
+// SetEnabled 启用或禁用一个技能
+//
+// 参数：
+//   - name: 技能名称
+//   - enabled: true 表示启用，false 表示禁用
+//
+// 返回：
+//   - error: 技能不存在或写入失败时返回错误
+func (s *SkillsLoader) SetEnabled(name string, enabled bool) error {
+	if s.LoadSkill(name) == nil {
+		return fmt.Errorf("skill %q not found", name)
+	}
+
+	disabled := s.Disabled()
+	if enabled {
+		delete(disabled, name)
+	} else {
+		disabled[name] = true
+	}
+
+	names := make([]string, 0, len(disabled))
+	for n := range disabled {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	if err := os.MkdirAll(s.workspaceSkills, 0755); err != nil {
+		return err
+	}
+	content := ""
+	if len(names) > 0 {
+		content = strings.Join(names, "\n") + "\n"
+	}
+	return os.WriteFile(filepath.Join(s.workspaceSkills, disabledFile), []byte(content), 0644)
+}
+
+// MissingRequirements 返回技能缺少的依赖，格式: "CLI: git, ENV: API_KEY"，全部满足时返回空字符串
+func (s *SkillsLoader) MissingRequirements(skill *Skill) string {
+	return s.getMissingRequirements(&skill.Metadata)
+}
+
+// ValidateSkill 校验技能目录中的 SKILL.md
+//
+// 检查项：文件存在、以 frontmatter 开头且正确闭合、包含 name 和 description、
+// metadata 是合法的 JSON、name 是合法的目录名、tools.json（如果有）格式正确
+//
+// 参数：
+//   - dir: 技能目录
+//
+// 返回：
+//   - *SkillMetadata: 解析出的元数据
+//   - []string: 发现的问题（为空表示校验通过）
+//   - error: SKILL.md 无法读取时返回错误
+func ValidateSkill(dir string) (*SkillMetadata, []string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "SKILL.md"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("read SKILL.md: %w", err)
+	}
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	var problems []string
+	if !strings.HasPrefix(content, "---\n") {
+		problems = append(problems, "SKILL.md does not start with a --- frontmatter block")
+	} else if !regexp.MustCompile(`(?s)^---\n.*?\n---`).MatchString(content) {
+		problems = append(problems, "frontmatter is not closed with ---")
+	}
+
+	loader := &SkillsLoader{}
+	metadata := loader.parseSkillMetadata(content)
+	if metadata.Name == "" {
+		problems = append(problems, "frontmatter is missing name")
+	} else if !skillNamePattern.MatchString(metadata.Name) {
+		problems = append(problems, fmt.Sprintf("name %q must contain only letters, digits, '.', '_' and '-'", metadata.Name))
+	}
+	if metadata.Description == "" || metadata.Description == metadata.Name {
+		problems = append(problems, "frontmatter is missing description")
+	}
+	if metadata.Metadata != "" {
+		var raw map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.Trim(metadata.Metadata, "'")), &raw); err != nil {
+			problems = append(problems, fmt.Sprintf("metadata is not valid JSON: %v", err))
+		}
+	}
+	if _, err := LoadCommands(dir); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return metadata, problems, nil
+}
+
+// Install 从 git 仓库或本地目录安装技能到 workspace/skills
+//
+// source 可以是：
+//   - 本地目录（包含 SKILL.md）
+//   - git 仓库地址（https://、git@ 或以 .git 结尾），仓库根目录需要包含 SKILL.md；
+//     技能位于子目录时用 "#" 指定，例如 https://github.com/user/repo#skills/weather
+//
+// 参数：
+//   - source: 技能来源
+//   - force: 为 true 时覆盖同名的工作区技能
+//
+// 返回：
+//   - *Skill: 安装后的技能
+//   - error: 下载失败、SKILL.md 校验失败或技能已存在时返回错误
+func (s *SkillsLoader) Install(source string, force bool) (*Skill, error) {
+	dir := source
+	if isGitSource(source) {
+		repo, subdir, _ := strings.Cut(source, "#")
+		// 以 "-" 开头的值会被 git 当作选项（例如 --upload-pack=...）
+		if strings.HasPrefix(repo, "-") {
+			return nil, fmt.Errorf("invalid repository %q", repo)
+		}
+		tmp, err := os.MkdirTemp("", "nanogrip-skill-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+
+		cmd := exec.Command("git", "clone", "--depth", "1", "--", repo, tmp)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("git clone failed: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		dir = filepath.Join(tmp, filepath.FromSlash(subdir))
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", source)
+	}
+
+	metadata, problems, err := ValidateSkill(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid SKILL.md:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+
+	target := filepath.Join(s.workspaceSkills, metadata.Name)
+	if _, err := os.Stat(target); err == nil {
+		if !force {
+			return nil, fmt.Errorf("skill %q already exists at %s", metadata.Name, target)
+		}
+		if err := os.RemoveAll(target); err != nil {
+			return nil, err
+		}
+	}
+	if err := copySkillDir(dir, target); err != nil {
+		return nil, err
+	}
+
+	// 清除旧的缓存，重新加载
+	s.mu.Lock()
+	delete(s.skillsCache, "workspace:"+metadata.Name)
+	delete(s.contentCache, "workspace:"+metadata.Name)
+	s.mu.Unlock()
+
+	skill := s.loadSkill(metadata.Name, "workspace")
+	if skill == nil {
+		return nil, fmt.Errorf("skill %q was copied but could not be loaded", metadata.Name)
+	}
+	return skill, nil
+}
+
+// isGitSource 判断技能来源是否是 git 仓库地址
+func isGitSource(source string) bool {
+	repo, _, _ := strings.Cut(source, "#")
+	return strings.HasPrefix(repo, "https://") || strings.HasPrefix(repo, "http://") ||
+		strings.HasPrefix(repo, "git@") || strings.HasPrefix(repo, "ssh://") ||
+		strings.HasSuffix(repo, ".git")
+}
+
+// copySkillDir 复制技能目录（跳过 .git 等隐藏目录）
+func copySkillDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." && strings.HasPrefix(d.Name(), ".") && d.IsDir() {
+			return filepath.SkipDir
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil // 跳过符号链接等特殊文件
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
@@ -16,9 +16,10 @@
 //	always: true
 //	---
 //
-// metadata 字段包含 JSON 格式的需求定义：
-//   - bins: 需要的命令行工具列表
-//   - env: 需要的环境变量列表
+// metadata 字段可以是单行 JSON，也可以是嵌套的 YAML（键名 nanogrip 或 nanobot，不区分大小写）：
+//   - requires.bins: 需要的命令行工具列表
+//   - requires.env: 需要的环境变量列表
+//   - os: 支持的操作系统（runtime.GOOS，例如 darwin、linux、windows），为空表示不限
 //
 // 只有满足所有需求的技能才会被标记为 available=true
 package skills
@@ -26,10 +27,15 @@ package skills
 import (
 	"encoding/json"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Skill 表示一个技能及其元数据和内容
@@ -38,7 +44,7 @@ type Skill struct {
 	Name        string        // 技能名称（目录名）
 	Path        string        // SKILL.md 文件的完整路径
 	Source      string        // 技能来源: "workspace" 或 "builtin"
-	Content     string        // SKILL.md 文件的完整内容（包含 frontmatter）
+	Content     string        // SKILL.md 文件的完整内容（包含 frontmatter），仅 LoadSkill 返回时填充
 	Metadata    SkillMetadata // 从 frontmatter 解析的元数据
 	Available   bool          // 是否满足所有需求（bins 和 env）
 	Description string        // 技能描述（用于显示）
@@ -61,6 +67,8 @@ type SkillMetadata struct {
 	Metadata    string            `yaml:"metadata"`    // JSON 字符串，包含 nanobot 配置
 	Always      bool              // 如果为 true，技能会始终加载到代理上下文
 	Requires    SkillRequirements `yaml:"-"` // 从 Metadata JSON 解析的需求
+
+	OS []string `yaml:"-"` // 支持的操作系统（runtime.GOOS），为空表示不限
 }
 
 // SkillRequirements 定义技能运行所需的依赖
@@ -76,13 +84,16 @@ type SkillRequirements struct {
 //  1. 从 workspace/skills 和 builtin skills 目录扫描技能
 //  2. 解析每个技能的 SKILL.md 文件的 YAML frontmatter
 //  3. 检查技能需求是否满足（bins 和 env）
-//  4. 缓存已加载的技能以提高性能
+//  4. 缓存已加载的技能元数据以提高性能
+//  5. 技能正文只在注入上下文时按需读取，并可随时清空（ClearContentCache）
 type SkillsLoader struct {
 	workspace       string                    // 工作区根目录路径
 	workspaceSkills string                    // 工作区技能目录路径（workspace/skills）
 	builtinSkills   string                    // 内置技能目录路径
-	skillsCache     map[string]*Skill         // 技能缓存，键为 "source:name"
+	skillsCache     map[string]*Skill         // 技能缓存（仅元数据，不含正文），键为 "source:name"
 	metadataCache   map[string]*SkillMetadata // 元数据缓存（当前未使用）
+	contentCache    map[string]string         // 技能正文缓存，键为 "source:name"，按需加载
+	mu              sync.Mutex                // 保护 skillsCache 和 contentCache
 }
 
 // NewSkillsLoader 创建一个新的技能加载器
@@ -100,6 +111,7 @@ func NewSkillsLoader(workspace string, builtinSkills string) *SkillsLoader {
 		builtinSkills:   builtinSkills,
 		skillsCache:     make(map[string]*Skill),
 		metadataCache:   make(map[string]*SkillMetadata),
+		contentCache:    make(map[string]string),
 	}
 }
 
@@ -113,16 +125,23 @@ func NewSkillsLoader(workspace string, builtinSkills string) *SkillsLoader {
 // 参数：
 //   - filterUnavailable: 如果为 true，只返回 available=true 的技能
 //
+// 被禁用的技能（见 SetEnabled）不会返回。
+//
 // 返回：
 //   - []*Skill: 技能列表
 func (s *SkillsLoader) ListSkills(filterUnavailable bool) []*Skill {
+	return s.listSkills(filterUnavailable, s.Disabled())
+}
+
+// listSkills 扫描工作区和内置技能目录，跳过 disabled 中的技能
+func (s *SkillsLoader) listSkills(filterUnavailable bool, disabled map[string]bool) []*Skill {
 	var result []*Skill
 
 	// Workspace skills (highest priority)
 	if _, err := os.Stat(s.workspaceSkills); err == nil {
 		entries, _ := os.ReadDir(s.workspaceSkills)
 		for _, entry := range entries {
-			if entry.IsDir() {
+			if entry.IsDir() && !disabled[entry.Name()] {
 				skillFile := filepath.Join(s.workspaceSkills, entry.Name(), "SKILL.md")
 				if _, err := os.Stat(skillFile); err == nil {
 					skill := s.loadSkill(entry.Name(), "workspace")
@@ -143,7 +162,7 @@ func (s *SkillsLoader) ListSkills(filterUnavailable bool) []*Skill {
 		if _, err := os.Stat(s.builtinSkills); err == nil {
 			entries, _ := os.ReadDir(s.builtinSkills)
 			for _, entry := range entries {
-				if entry.IsDir() {
+				if entry.IsDir() && !disabled[entry.Name()] {
 					// Skip if already loaded from workspace
 					exists := false
 					for _, existing := range result {
@@ -183,17 +202,20 @@ func (s *SkillsLoader) ListSkills(filterUnavailable bool) []*Skill {
 //  3. 读取 SKILL.md 文件内容
 //  4. 解析 YAML frontmatter 获取元数据
 //  5. 检查技能需求是否满足
-//  6. 缓存技能并返回
+//  6. 缓存技能元数据并返回（正文不常驻内存，见 skillContent）
 //
 // 参数：
 //   - name: 技能名称（目录名）
 //   - source: 技能来源（"workspace" 或 "builtin"）
 //
 // 返回：
-//   - *Skill: 加载的技能，如果加载失败返回 nil
+//   - *Skill: 加载的技能（Content 为空），如果加载失败返回 nil
 func (s *SkillsLoader) loadSkill(name string, source string) *Skill {
 	cacheKey := source + ":" + name
-	if skill, ok := s.skillsCache[cacheKey]; ok {
+	s.mu.Lock()
+	skill, ok := s.skillsCache[cacheKey]
+	s.mu.Unlock()
+	if ok {
 		return skill
 	}
 
@@ -217,20 +239,92 @@ func (s *SkillsLoader) loadSkill(name string, source string) *Skill {
 
 	metadata := s.parseSkillMetadata(string(content))
 
-	skill := &Skill{
+	skill = &Skill{
 		Name:        name,
 		Path:        skillPath,
 		Source:      source,
-		Content:     string(content),
 		Metadata:    *metadata,
 		Available:   s.checkRequirements(metadata),
 		Description: metadata.Description,
 	}
 
+	s.mu.Lock()
 	s.skillsCache[cacheKey] = skill
+	s.mu.Unlock()
 	return skill
 }
 
+// skillContent 按需读取技能正文
+// 首次注入上下文时读取文件并缓存，ClearContentCache 之后会重新读取
+//
+// 参数：
+//   - skill: 通过 loadSkill 得到的技能
+//
+// 返回：
+//   - string: SKILL.md 的完整内容，读取失败时返回空字符串
+func (s *SkillsLoader) skillContent(skill *Skill) string {
+	cacheKey := skill.Source + ":" + skill.Name
+
+	s.mu.Lock()
+	content, ok := s.contentCache[cacheKey]
+	s.mu.Unlock()
+	if ok {
+		return content
+	}
+
+	data, err := os.ReadFile(skill.Path)
+	if err != nil {
+		return ""
+	}
+	content = string(data)
+
+	s.mu.Lock()
+	s.contentCache[cacheKey] = content
+	s.mu.Unlock()
+	return content
+}
+
+// ClearContentCache 清空技能正文缓存，只保留元数据
+// 用于空闲时释放内存，下次注入技能时会重新从磁盘读取
+//
+// 返回：
+//   - int: 被释放的正文字节数
+func (s *SkillsLoader) ClearContentCache() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	freed := 0
+	for _, content := range s.contentCache {
+		freed += len(content)
+	}
+	s.contentCache = make(map[string]string)
+	return freed
+}
+
+// Invalidate 清空技能元数据和正文缓存
+// 技能目录中的文件被修改后调用，下次使用时重新扫描和读取
+func (s *SkillsLoader) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skillsCache = make(map[string]*Skill)
+	s.contentCache = make(map[string]string)
+}
+
+// CacheStats 返回缓存统计信息
+//
+// 返回：
+//   - skills: 已缓存元数据的技能数量
+//   - contentBytes: 当前缓存的技能正文字节数
+func (s *SkillsLoader) CacheStats() (skills int, contentBytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, content := range s.contentCache {
+		contentBytes += len(content)
+	}
+	return len(s.skillsCache), contentBytes
+}
+
 // LoadSkill 按名称加载一个特定技能
 //
 // 加载优先级：
@@ -240,15 +334,24 @@ func (s *SkillsLoader) loadSkill(name string, source string) *Skill {
 // 参数：
 //   - name: 技能名称
 //
+// 返回的技能是缓存的副本，Content 字段已按需填充正文。
+//
 // 返回：
 //   - *Skill: 找到的技能，如果都没找到返回 nil
 func (s *SkillsLoader) LoadSkill(name string) *Skill {
 	// Check workspace first
-	if skill := s.loadSkill(name, "workspace"); skill != nil {
-		return skill
+	skill := s.loadSkill(name, "workspace")
+	if skill == nil {
+		// Check builtin
+		skill = s.loadSkill(name, "builtin")
 	}
-	// Check builtin
-	return s.loadSkill(name, "builtin")
+	if skill == nil {
+		return nil
+	}
+
+	loaded := *skill
+	loaded.Content = s.skillContent(skill)
+	return &loaded
 }
 
 // LoadSkillsForContext 加载指定的技能以包含在代理上下文中
@@ -287,6 +390,7 @@ func (s *SkillsLoader) LoadSkillsForContext(skillNames []string) string {
 //	    <name>git-ops</name>
 //	    <description>Git operations</description>
 //	    <location>/path/to/skill/SKILL.md</location>
+//	    <tools>skill_git-ops_status</tools>
 //	  </skill>
 //	  <skill available="false">
 //	    <name>docker-ops</name>
@@ -316,6 +420,15 @@ func (s *SkillsLoader) BuildSkillsSummary() string {
 		lines = append(lines, "    <description>"+escapeXML(skill.Description)+"</description>")
 		lines = append(lines, "    <location>"+skill.Path+"</location>")
 
+		// 技能声明的命令已注册为工具，可以直接调用
+		if commands, err := LoadCommands(filepath.Dir(skill.Path)); err == nil && len(commands) > 0 {
+			names := make([]string, 0, len(commands))
+			for _, cmd := range commands {
+				names = append(names, CommandToolName(skill.Name, cmd.Name))
+			}
+			lines = append(lines, "    <tools>"+strings.Join(names, ", ")+"</tools>")
+		}
+
 		// Show missing requirements for unavailable skills
 		if !available {
 			missing := s.getMissingRequirements(&skill.Metadata)
@@ -353,9 +466,10 @@ func (s *SkillsLoader) GetAlwaysSkills() []string {
 // YAML Frontmatter 解析过程：
 //  1. 检查文件是否以 "---" 开头
 //  2. 使用正则表达式提取 frontmatter 块（第一个 --- 和第二个 --- 之间的内容）
-//  3. 逐行解析 YAML 键值对（使用简单的字符串分割，不依赖 YAML 库）
-//  4. 解析 metadata 字段中的嵌套 JSON 结构
-//  5. 从 JSON 中提取 nanobot.requires.bins 和 nanobot.requires.env
+//  3. 用 YAML 库解析；frontmatter 不是合法 YAML 时（例如描述中有未加引号的冒号），
+//     改为逐行解析顶层的键值对
+//  4. metadata 是字符串时按 JSON 解析，是映射时直接使用（嵌套 YAML 写法）
+//  5. 从中提取 nanogrip（或 nanobot）下的 requires.bins、requires.env 和 os
 //
 // YAML frontmatter 格式：
 //
@@ -385,6 +499,9 @@ func (s *SkillsLoader) GetAlwaysSkills() []string {
 func (s *SkillsLoader) parseSkillMetadata(content string) *SkillMetadata {
 	metadata := &SkillMetadata{}
 
+	// Windows 上编辑过的文件使用 CRLF 换行
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
 	// Check for YAML frontmatter
 	if strings.HasPrefix(content, "---") {
 		re := regexp.MustCompile(`(?s)^---\n(.*?)\n---`)
@@ -392,25 +509,44 @@ func (s *SkillsLoader) parseSkillMetadata(content string) *SkillMetadata {
 		if match != nil {
 			yamlContent := match[1]
 
-			// Simple YAML parsing
-			lines := strings.Split(yamlContent, "\n")
-			for _, line := range lines {
-				if strings.Contains(line, ":") {
-					parts := strings.SplitN(line, ":", 2)
-					if len(parts) == 2 {
-						key := strings.TrimSpace(parts[0])
-						value := strings.TrimSpace(parts[1])
-						value = strings.Trim(value, "\"")
-
-						switch key {
-						case "name":
-							metadata.Name = value
-						case "description":
-							metadata.Description = value
-						case "metadata":
-							metadata.Metadata = value
-						case "always":
-							metadata.Always = value == "true"
+			var frontmatter struct {
+				Name        string      `yaml:"name"`
+				Description string      `yaml:"description"`
+				Metadata    interface{} `yaml:"metadata"`
+				Always      bool        `yaml:"always"`
+			}
+			var settings map[string]interface{}
+			if err := yaml.Unmarshal([]byte(yamlContent), &frontmatter); err == nil {
+				metadata.Name = frontmatter.Name
+				metadata.Description = frontmatter.Description
+				metadata.Always = frontmatter.Always
+				switch value := frontmatter.Metadata.(type) {
+				case string:
+					metadata.Metadata = value
+				case map[string]interface{}:
+					settings = value
+				}
+			} else {
+				// Simple YAML parsing
+				lines := strings.Split(yamlContent, "\n")
+				for _, line := range lines {
+					if strings.Contains(line, ":") {
+						parts := strings.SplitN(line, ":", 2)
+						if len(parts) == 2 {
+							key := strings.TrimSpace(parts[0])
+							value := strings.TrimSpace(parts[1])
+							value = strings.Trim(value, "\"")
+
+							switch key {
+							case "name":
+								metadata.Name = value
+							case "description":
+								metadata.Description = value
+							case "metadata":
+								metadata.Metadata = value
+							case "always":
+								metadata.Always = value == "true"
+							}
 						}
 					}
 				}
@@ -418,28 +554,11 @@ func (s *SkillsLoader) parseSkillMetadata(content string) *SkillMetadata {
 
 			// Parse nested JSON metadata
 			if metadata.Metadata != "" {
-				var nanobotData map[string]interface{}
-				if err := json.Unmarshal([]byte(metadata.Metadata), &nanobotData); err == nil {
-					if nb, ok := nanobotData["nanobot"].(map[string]interface{}); ok {
-						if requires, ok := nb["requires"].(map[string]interface{}); ok {
-							if bins, ok := requires["bins"].([]interface{}); ok {
-								for _, b := range bins {
-									if bStr, ok := b.(string); ok {
-										metadata.Requires.Bins = append(metadata.Requires.Bins, bStr)
-									}
-								}
-							}
-							if env, ok := requires["env"].([]interface{}); ok {
-								for _, e := range env {
-									if eStr, ok := e.(string); ok {
-										metadata.Requires.Env = append(metadata.Requires.Env, eStr)
-									}
-								}
-							}
-						}
-					}
+				if err := json.Unmarshal([]byte(strings.Trim(metadata.Metadata, "'")), &settings); err != nil {
+					settings = nil
 				}
 			}
+			applySkillSettings(metadata, settings)
 		}
 	}
 
@@ -451,11 +570,46 @@ func (s *SkillsLoader) parseSkillMetadata(content string) *SkillMetadata {
 	return metadata
 }
 
+// applySkillSettings 从 metadata 中的 nanogrip（或 nanobot）配置提取需求和支持的操作系统
+// 参数：
+//   - metadata: 要填充的元数据
+//   - settings: metadata 字段解析后的内容，键名不区分大小写
+func applySkillSettings(metadata *SkillMetadata, settings map[string]interface{}) {
+	var nb map[string]interface{}
+	for key, value := range settings {
+		switch strings.ToLower(key) {
+		case "nanogrip", "nanobot":
+			nb, _ = value.(map[string]interface{})
+		}
+	}
+	if nb == nil {
+		return
+	}
+	if requires, ok := nb["requires"].(map[string]interface{}); ok {
+		metadata.Requires.Bins = append(metadata.Requires.Bins, stringList(requires["bins"])...)
+		metadata.Requires.Env = append(metadata.Requires.Env, stringList(requires["env"])...)
+	}
+	metadata.OS = append(metadata.OS, stringList(nb["os"])...)
+}
+
+// stringList 把 JSON/YAML 解析出的列表转换为字符串切片，忽略非字符串元素
+func stringList(value interface{}) []string {
+	items, _ := value.([]interface{})
+	var result []string
+	for _, item := range items {
+		if str, ok := item.(string); ok {
+			result = append(result, str)
+		}
+	}
+	return result
+}
+
 // checkRequirements 检查技能需求是否满足
 //
 // 检查项：
-//  1. Bins: 检查 PATH 中是否存在所需的命令行工具
-//  2. Env: 检查是否设置了所需的环境变量
+//  1. OS: 当前操作系统是否在支持列表中
+//  2. Bins: 检查 PATH 中是否存在所需的命令行工具
+//  3. Env: 检查是否设置了所需的环境变量
 //
 // 只有所有需求都满足时，技能才会被标记为 available=true
 //
@@ -465,6 +619,9 @@ func (s *SkillsLoader) parseSkillMetadata(content string) *SkillMetadata {
 // 返回：
 //   - bool: 如果所有需求都满足返回 true，否则返回 false
 func (s *SkillsLoader) checkRequirements(metadata *SkillMetadata) bool {
+	if !supportsOS(metadata.OS) {
+		return false
+	}
 	for _, bin := range metadata.Requires.Bins {
 		if !hasCommand(bin) {
 			return false
@@ -486,10 +643,14 @@ func (s *SkillsLoader) checkRequirements(metadata *SkillMetadata) bool {
 //   - metadata: 技能元数据
 //
 // 返回：
-//   - string: 缺失需求的描述，格式: "CLI: git, ENV: API_KEY"
+//   - string: 缺失需求的描述，格式: "OS: darwin/linux, CLI: git, ENV: API_KEY"
 func (s *SkillsLoader) getMissingRequirements(metadata *SkillMetadata) string {
 	var missing []string
 
+	if !supportsOS(metadata.OS) {
+		missing = append(missing, "OS: "+strings.Join(metadata.OS, "/"))
+	}
+
 	for _, bin := range metadata.Requires.Bins {
 		if !hasCommand(bin) {
 			missing = append(missing, "CLI: "+bin)
@@ -520,7 +681,7 @@ func (s *SkillsLoader) getMissingRequirements(metadata *SkillMetadata) string {
 //   - string: 移除 frontmatter 后的内容
 func stripFrontmatter(content string) string {
 	if strings.HasPrefix(content, "---") {
-		re := regexp.MustCompile(`(?s)^---\n.*?\n---\n`)
+		re := regexp.MustCompile(`(?s)^---\r?\n.*?\r?\n---\r?\n`)
 		return re.ReplaceAllString(content, "")
 	}
 	return content
@@ -545,11 +706,23 @@ func escapeXML(s string) string {
 	return s
 }
 
+// supportsOS 判断当前操作系统是否在列表中，列表为空表示不限
+func supportsOS(list []string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, goos := range list {
+		if strings.EqualFold(strings.TrimSpace(goos), runtime.GOOS) {
+			return true
+		}
+	}
+	return false
+}
+
 // hasCommand 检查命令是否存在于 PATH 中
 //
-// 检查策略：
-//  1. 如果命令包含路径分隔符（/ 或 \），直接检查该路径是否存在
-//  2. 否则，在 PATH 环境变量的所有目录中搜索该命令
+// 使用 exec.LookPath 查找：Windows 上会按 PATHEXT 尝试 .exe、.cmd、.bat 等扩展名，
+// 其他系统上还会检查文件是否可执行。命令包含路径分隔符时直接检查该路径。
 //
 // 这个函数用于验证技能需求的 bins 是否满足。
 //
@@ -559,26 +732,9 @@ func escapeXML(s string) string {
 // 返回：
 //   - bool: 如果命令存在返回 true，否则返回 false
 func hasCommand(cmd string) bool {
-	// Check if command exists using shell
-	// On Unix, we can use "which" or "command -v"
-	// For simplicity, we'll just check common paths
-	path := os.Getenv("PATH")
-	if path == "" {
+	if cmd == "" {
 		return false
 	}
-
-	// If cmd contains path separator, check directly
-	if strings.Contains(cmd, "/") || strings.Contains(cmd, "\\") {
-		_, err := os.Stat(cmd)
-		return err == nil
-	}
-
-	// Search in PATH
-	for _, dir := range strings.Split(path, string(os.PathListSeparator)) {
-		fullPath := filepath.Join(dir, cmd)
-		if _, err := os.Stat(fullPath); err == nil {
-			return true
-		}
-	}
-	return false
+	_, err := exec.LookPath(cmd)
+	return err == nil
 }
@@ -0,0 +1,273 @@
+// Package templates 出站消息模板
+//
+// 模板保存在 workspace/templates/<名称>.yaml 中，定义一条带变量的固定格式消息，
+// 例如服务器状态报告、每日汇总。定时任务和自动化流程用模板发送格式一致的消息，
+// 不需要每次让模型重新组织格式：
+//
+//	description: 服务器状态报告
+//	variables:
+//	  host: {required: true}
+//	  load: {default: "unknown"}
+//	content: |
+//	  🖥 **{{.host}}** ({{now "2006-01-02 15:04"}})
+//	  Load: {{.load}}
+//
+// 内容使用 Go text/template 语法，变量通过 {{.名称}} 引用。
+// 模板文件每次使用时重新读取，修改后立即生效。
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dir 模板目录名（位于工作区根目录）
+const Dir = "templates"
+
+// namePattern 合法的模板名称（同时也是文件名）
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// Variable 描述模板的一个变量
+type Variable struct {
+	// Description 变量说明（列出模板时显示给模型）
+	Description string `yaml:"description"`
+
+	// Default 未提供时使用的默认值
+	Default string `yaml:"default"`
+
+	// Required 是否必须提供（有默认值时忽略）
+	Required bool `yaml:"required"`
+}
+
+// Template 一个消息模板
+type Template struct {
+	// Name 模板名称（文件名去掉扩展名）
+	Name string `yaml:"-"`
+
+	// Description 模板用途说明
+	Description string `yaml:"description"`
+
+	// Variables 模板变量
+	Variables map[string]Variable `yaml:"variables"`
+
+	// Content 消息正文模板
+	Content string `yaml:"content"`
+
+	// Media 随消息发送的媒体 URL 或本地路径（多个用逗号分隔，也可以使用变量）
+	Media string `yaml:"media"`
+
+	// MediaType 媒体类型：photo、document、audio 或 video，为空时根据扩展名判断
+	MediaType string `yaml:"mediaType"`
+}
+
+// Store 从工作区读取模板
+type Store struct {
+	dir string
+}
+
+// NewStore 创建模板存储
+// 参数:
+//
+//	workspace: 工作区路径，模板位于 workspace/templates/
+func NewStore(workspace string) *Store {
+	return &Store{dir: filepath.Join(workspace, Dir)}
+}
+
+// Dir 返回模板目录
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Get 读取指定名称的模板
+func (s *Store) Get(name string) (*Template, error) {
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid template name %q", name)
+	}
+	for _, ext := range []string{".yaml", ".yml"} {
+		data, err := os.ReadFile(filepath.Join(s.dir, name+ext))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return parse(name, data)
+	}
+	return nil, fmt.Errorf("template %q not found in %s", name, s.dir)
+}
+
+// List 返回所有模板（按名称排序），无法解析的模板文件作为错误一并返回
+func (s *Store) List() ([]*Template, []error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, []error{err}
+	}
+
+	var list []*Template
+	var errs []error
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if !namePattern.MatchString(name) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tmpl, err := parse(name, data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		list = append(list, tmpl)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, errs
+}
+
+// parse 解析模板文件
+func parse(name string, data []byte) (*Template, error) {
+	tmpl := &Template{}
+	if err := yaml.Unmarshal(data, tmpl); err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+	tmpl.Name = name
+	if strings.TrimSpace(tmpl.Content) == "" {
+		return nil, fmt.Errorf("template %s: content is empty", name)
+	}
+	return tmpl, nil
+}
+
+// Rendered 渲染后的消息
+type Rendered struct {
+	Content   string
+	Media     string
+	MediaType string
+}
+
+// Render 用变量渲染模板
+// 参数:
+//
+//	vars: 变量值，缺少的变量使用默认值；缺少必需变量时返回错误
+func (t *Template) Render(vars map[string]interface{}) (*Rendered, error) {
+	data := make(map[string]interface{}, len(t.Variables)+len(vars))
+	for name, v := range t.Variables {
+		if v.Default != "" {
+			data[name] = v.Default
+		}
+	}
+	for name, value := range vars {
+		data[name] = value
+	}
+
+	var missing []string
+	for name, v := range t.Variables {
+		if _, ok := data[name]; !ok {
+			if v.Required {
+				missing = append(missing, name)
+				continue
+			}
+			data[name] = ""
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("template %s: missing required variables: %s", t.Name, strings.Join(missing, ", "))
+	}
+
+	content, err := execute(t.Name, t.Content, data)
+	if err != nil {
+		return nil, err
+	}
+	media, err := execute(t.Name+".media", t.Media, data)
+	if err != nil {
+		return nil, err
+	}
+	return &Rendered{Content: strings.TrimRight(content, "\n"), Media: strings.TrimSpace(media), MediaType: t.MediaType}, nil
+}
+
+// Usage 返回模板的简短说明（名称、用途和变量），供模型选择模板
+func (t *Template) Usage() string {
+	line := t.Name
+	if t.Description != "" {
+		line += ": " + t.Description
+	}
+	names := make([]string, 0, len(t.Variables))
+	for name := range t.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := t.Variables[name]
+		item := "\n  - " + name
+		switch {
+		case v.Default != "":
+			item += fmt.Sprintf(" (default %q)", v.Default)
+		case v.Required:
+			item += " (required)"
+		}
+		if v.Description != "" {
+			item += ": " + v.Description
+		}
+		line += item
+	}
+	return line
+}
+
+// funcs 模板中可以使用的函数
+var funcs = template.FuncMap{
+	"now":   func(layout string) string { return time.Now().Format(layout) },
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"join": func(items interface{}, sep string) string {
+		list, ok := items.([]interface{})
+		if !ok {
+			return fmt.Sprint(items)
+		}
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep)
+	},
+	"default": func(fallback string, value interface{}) interface{} {
+		if value == nil || fmt.Sprint(value) == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// execute 执行一段模板文本（引用未定义的变量时返回错误）
+func execute(name, text string, data map[string]interface{}) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("template %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
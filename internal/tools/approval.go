@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+)
+
+// approval.go - 工具调用审批
+// 此文件实现了需要用户确认的工具调用流程：向用户发送审批提示，等待 yes/no 回复后再执行
+
+// Approver 是工具调用审批的接口
+type Approver interface {
+	// RequestApproval 向指定聊天发送审批提示并等待用户答复
+	// 返回是否批准，以及用户的原始回复
+	RequestApproval(ctx context.Context, channel, chatID, prompt string) (bool, string, error)
+}
+
+// ApprovalManager 通过消息总线向用户发送审批提示，并通过频道的输入回调接收答复
+//
+// 等待审批时 AgentLoop 阻塞在这次工具调用上，同一会话的后续消息会排队等它完成，
+// 用户的回复无法经过消息总线到达，因此答复需要在频道层通过 HandleInput 拦截（见 BaseChannel.SetInputHandler）。
+type ApprovalManager struct {
+	bus     *bus.MessageBus
+	timeout time.Duration
+	pending map[string]pendingReply // 等待中的审批，键为 "channel:chatID"
+	mu      sync.Mutex
+}
+
+// pendingReply 是一个等待用户答复的请求
+type pendingReply struct {
+	reply  chan string // 接收答复
+	sender string      // 触发请求的用户，只接受他的答复（为空表示聊天中的任何人都可以答复，例如定时任务）
+}
+
+// accepts 判断发送者的输入是否可以作为答复
+func (p pendingReply) accepts(senderID string) bool {
+	return p.sender == "" || p.sender == senderID
+}
+
+// NewApprovalManager 创建审批管理器
+// 参数:
+//
+//	msgBus: 消息总线，用于发送审批提示
+//	timeout: 等待用户答复的超时时间，超时视为拒绝
+//
+// 返回:
+//
+//	审批管理器实例
+func NewApprovalManager(msgBus *bus.MessageBus, timeout time.Duration) *ApprovalManager {
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	return &ApprovalManager{
+		bus:     msgBus,
+		timeout: timeout,
+		pending: make(map[string]pendingReply),
+	}
+}
+
+// RequestApproval 发送审批提示并阻塞等待答复
+// 同一聊天同时只允许一个等待中的审批；ctx 中有触发工具调用的用户时（见 WithToolSender），只接受他的答复
+func (m *ApprovalManager) RequestApproval(ctx context.Context, channel, chatID, prompt string) (bool, string, error) {
+	if channel == "" || chatID == "" {
+		return false, "", fmt.Errorf("no chat to ask for approval")
+	}
+
+	key := channel + ":" + chatID
+	reply := make(chan string, 1)
+	toolCtx, _ := ToolContextFrom(ctx)
+
+	m.mu.Lock()
+	if _, exists := m.pending[key]; exists {
+		m.mu.Unlock()
+		return false, "", fmt.Errorf("another approval is already pending in this chat")
+	}
+	m.pending[key] = pendingReply{reply: reply, sender: toolCtx.SenderID}
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.pending, key)
+		m.mu.Unlock()
+	}()
+
+	err := m.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Content: prompt + "\n\nReply **yes** to approve or **no** to cancel.",
+		Metadata: map[string]interface{}{
+			"approval": true,
+			"buttons": []interface{}{
+				[]interface{}{
+					map[string]interface{}{"text": "✅ Approve", "data": "yes"},
+					map[string]interface{}{"text": "❌ Deny", "data": "no"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return false, "", fmt.Errorf("failed to send approval prompt: %w", err)
+	}
+
+	log.Printf("[Approval] 等待用户确认: %s", key)
+
+	timer := time.NewTimer(m.timeout)
+	defer timer.Stop()
+
+	select {
+	case answer := <-reply:
+		return isApprovalYes(answer), answer, nil
+	case <-timer.C:
+		return false, "", fmt.Errorf("no answer within %s", m.timeout)
+	case <-ctx.Done():
+		return false, "", ctx.Err()
+	}
+}
+
+// HandleInput 处理用户输入，如果该聊天有等待中的审批则作为答复
+// 签名与 BaseChannel.SetInputHandler 的回调一致；不是请求审批的用户发送的消息不作为答复
+// 返回:
+//
+//	输入被审批消费时返回 true（不再进入消息总线）
+func (m *ApprovalManager) HandleInput(channel, chatID, senderID, input string) bool {
+	key := channel + ":" + chatID
+
+	m.mu.Lock()
+	pending, ok := m.pending[key]
+	ok = ok && pending.accepts(senderID)
+	if ok {
+		delete(m.pending, key)
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	select {
+	case pending.reply <- strings.TrimSpace(input):
+	default:
+	}
+	return true
+}
+
+// isApprovalYes 判断用户答复是否表示同意
+// 除明确的同意外，其它任何答复都视为拒绝
+func isApprovalYes(answer string) bool {
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "yes", "y", "ok", "approve", "approved", "confirm", "是", "好", "确认", "同意":
+		return true
+	default:
+		return false
+	}
+}
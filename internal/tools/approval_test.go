@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+)
+
+// waitPrompt 等待审批或输入提示发到聊天中（此时请求已经登记）
+func waitPrompt(t *testing.T, prompts <-chan bus.OutboundMessage) {
+	t.Helper()
+	select {
+	case <-prompts:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no prompt was sent")
+	}
+}
+
+// senderCases 是审批和输入共用的发送者匹配用例
+var senderCases = []struct {
+	name      string
+	requester string // 触发工具调用的用户，为空表示没有真实用户（定时任务、Webhook）
+	answerer  string
+	consumed  bool
+}{
+	{"requester answers", "alice", "alice", true},
+	{"other sender passes through", "alice", "bob", false},
+	{"anyone answers without a requester", "", "bob", true},
+}
+
+func TestApprovalManagerSenderMatching(t *testing.T) {
+	for _, tt := range senderCases {
+		t.Run(tt.name, func(t *testing.T) {
+			msgBus := bus.New(10)
+			prompts := msgBus.SubscribeOutbound("telegram", 10)
+			m := NewApprovalManager(msgBus, time.Second)
+
+			ctx := WithToolContext(context.Background(), "telegram", "42")
+			if tt.requester != "" {
+				ctx = WithToolSender(ctx, tt.requester)
+			}
+			done := make(chan bool, 1)
+			go func() {
+				approved, _, _ := m.RequestApproval(ctx, "telegram", "42", "run shell")
+				done <- approved
+			}()
+			waitPrompt(t, prompts)
+
+			if got := m.HandleInput("telegram", "42", tt.answerer, "yes"); got != tt.consumed {
+				t.Fatalf("HandleInput() = %v, want %v", got, tt.consumed)
+			}
+			if !tt.consumed {
+				// 请求仍在等待，发起者的答复依然有效
+				if !m.HandleInput("telegram", "42", tt.requester, "yes") {
+					t.Fatal("requester's answer was not accepted")
+				}
+			}
+			if approved := <-done; !approved {
+				t.Fatal("expected the request to be approved")
+			}
+		})
+	}
+}
+
+func TestInteractionManagerSenderMatching(t *testing.T) {
+	for _, tt := range senderCases {
+		t.Run(tt.name, func(t *testing.T) {
+			msgBus := bus.New(10)
+			prompts := msgBus.SubscribeOutbound("telegram", 10)
+			m := NewInteractionManager(msgBus, time.Second)
+
+			ctx := WithToolContext(context.Background(), "telegram", "42")
+			if tt.requester != "" {
+				ctx = WithToolSender(ctx, tt.requester)
+			}
+			done := make(chan string, 1)
+			go func() {
+				answer, _ := m.AskInput(ctx, "telegram", "42", "Password:")
+				done <- answer
+			}()
+			waitPrompt(t, prompts)
+
+			if got := m.HandleInput("telegram", "42", tt.answerer, "hunter2"); got != tt.consumed {
+				t.Fatalf("HandleInput() = %v, want %v", got, tt.consumed)
+			}
+			if !tt.consumed && !m.HandleInput("telegram", "42", tt.requester, "hunter2") {
+				t.Fatal("requester's answer was not accepted")
+			}
+			if answer := <-done; answer != "hunter2" {
+				t.Fatalf("AskInput() = %q, want %q", answer, "hunter2")
+			}
+		})
+	}
+}
+
+func TestApprovalManagerWithoutPendingRequest(t *testing.T) {
+	m := NewApprovalManager(bus.New(1), time.Second)
+	if m.HandleInput("telegram", "42", "alice", "yes") {
+		t.Fatal("input was consumed without a pending approval")
+	}
+}
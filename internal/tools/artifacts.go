@@ -0,0 +1,128 @@
+package tools
+
+// artifacts.go - 过长的工具结果保存为文件
+// 读取大文件、冗长的命令输出等结果原样放进上下文会占满模型的窗口；
+// 超过上限的结果完整保存到 workspace/artifacts/tool-results，上下文中只保留开头和结尾的片段、
+// 文件路径，以及用 filesystem 工具按行读取或搜索的说明。
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultMaxResultChars 单次工具结果放入上下文的默认最大字符数
+const DefaultMaxResultChars = 20000
+
+// artifactRetention 工具结果文件的保留时间，过期的文件在保存新文件时删除
+const artifactRetention = 7 * 24 * time.Hour
+
+// unsafeNameChars 文件名中需要替换的字符
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// ArtifactHook 返回一个执行后钩子：结果超过 maxChars 个字符时保存到 dir 并替换为摘要
+// 参数:
+//
+//	dir: 保存结果文件的目录（通常是 workspace/artifacts/tool-results）
+//	maxChars: 放入上下文的最大字符数，<= 0 表示不限制
+func ArtifactHook(dir string, maxChars int) PostHook {
+	return func(ctx context.Context, name string, params map[string]interface{}, result string, err error, elapsed time.Duration) string {
+		if maxChars <= 0 || len(result) <= maxChars {
+			return result
+		}
+		runes := []rune(result)
+		if len(runes) <= maxChars {
+			return result
+		}
+
+		// 分段读取已保存的结果文件时不再重复保存，只提示使用更小的范围
+		path, _ := params["path"].(string)
+		if name != "filesystem" || !isArtifact(dir, path) {
+			saved, saveErr := saveArtifact(dir, name, result)
+			if saveErr != nil {
+				log.Printf("[Tool] 保存 %s 的结果失败: %v", name, saveErr)
+				return truncateResult(runes, maxChars, "")
+			}
+			path = saved
+		}
+		return truncateResult(runes, maxChars, path)
+	}
+}
+
+// truncateResult 保留结果的开头和结尾，中间替换为说明
+// path 为空表示完整结果没有保存
+func truncateResult(runes []rune, maxChars int, path string) string {
+	head, tail := maxChars/2, maxChars/4
+	text := string(runes)
+	lines := strings.Count(text, "\n")
+	if !strings.HasSuffix(text, "\n") {
+		lines++
+	}
+
+	var note string
+	if path == "" {
+		note = fmt.Sprintf("[Output truncated: %d characters, %d lines. The middle part was omitted.]", len(runes), lines)
+	} else {
+		note = fmt.Sprintf("[Output too large for the context: %d characters, %d lines. The full output was saved to %s\n"+
+			"Read a range with filesystem operation=read path=%s offset=<first line> limit=<lines>, "+
+			"or search it with filesystem operation=grep.]", len(runes), lines, path, path)
+	}
+	return string(runes[:head]) + "\n\n" + note + "\n\n" + string(runes[len(runes)-tail:])
+}
+
+// saveArtifact 把完整结果保存为文件，并删除过期的结果文件
+// 返回:
+//
+//	文件的绝对路径
+func saveArtifact(dir, tool, result string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	pruneArtifacts(dir)
+
+	name := fmt.Sprintf("%s-%s.txt", time.Now().Format("20060102-150405.000"), unsafeNameChars.ReplaceAllString(tool, "_"))
+	path, err := filepath.Abs(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(result), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// pruneArtifacts 删除超过保留时间的结果文件
+func pruneArtifacts(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-artifactRetention)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err == nil && !entry.IsDir() && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// isArtifact 判断路径是否是 dir 中保存的结果文件
+func isArtifact(dir, path string) bool {
+	if path == "" {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return filepath.Dir(absPath) == absDir
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 // base.go - 工具接口定义和基础实现
@@ -26,12 +27,21 @@ type Tool interface {
 	Execute(ctx context.Context, params map[string]interface{}) (string, error)
 }
 
+// SourcedTool 是由外部提供的工具（例如 MCP 服务器上的工具）
+// Source 返回来源的名称，用于 /tools 等列表中区分内置工具
+type SourcedTool interface {
+	Tool
+	Source() string
+}
+
 type toolContextKey struct{}
 
 // ToolContext carries the default chat target for context-aware tools.
 type ToolContext struct {
-	Channel string
-	ChatID  string
+	Channel  string
+	ChatID   string
+	SenderID string
+	Location *time.Location // the user's time zone (nil means the server's local time zone)
 }
 
 // WithToolContext attaches the current chat target to a context.
@@ -39,12 +49,48 @@ func WithToolContext(ctx context.Context, channel, chatID string) context.Contex
 	return context.WithValue(ctx, toolContextKey{}, ToolContext{Channel: channel, ChatID: chatID})
 }
 
+// WithToolSender records the user who triggered the current tool calls.
+func WithToolSender(ctx context.Context, senderID string) context.Context {
+	toolCtx, _ := ToolContextFrom(ctx)
+	toolCtx.SenderID = senderID
+	return context.WithValue(ctx, toolContextKey{}, toolCtx)
+}
+
+// WithToolTimezone records the time zone of the conversation that triggered the current tool calls.
+func WithToolTimezone(ctx context.Context, loc *time.Location) context.Context {
+	toolCtx, _ := ToolContextFrom(ctx)
+	toolCtx.Location = loc
+	return context.WithValue(ctx, toolContextKey{}, toolCtx)
+}
+
+// ToolLocation returns the user's time zone stored in ctx, or time.Local if none was set.
+func ToolLocation(ctx context.Context) *time.Location {
+	if toolCtx, ok := ToolContextFrom(ctx); ok && toolCtx.Location != nil {
+		return toolCtx.Location
+	}
+	return time.Local
+}
+
 // ToolContextFrom returns the current chat target stored in ctx.
 func ToolContextFrom(ctx context.Context) (ToolContext, bool) {
 	toolCtx, ok := ctx.Value(toolContextKey{}).(ToolContext)
 	return toolCtx, ok
 }
 
+type progressKey struct{}
+
+// WithProgress attaches a callback that receives short progress notes from tools.
+func WithProgress(ctx context.Context, report func(note string)) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// ReportProgress sends a progress note to the callback stored in ctx, if any.
+func ReportProgress(ctx context.Context, note string) {
+	if report, ok := ctx.Value(progressKey{}).(func(string)); ok && report != nil {
+		report(note)
+	}
+}
+
 // BaseTool 提供工具的通用功能实现
 // 其他具体工具可以通过嵌入此结构体来复用基础功能
 type BaseTool struct {
@@ -139,37 +185,6 @@ func RequiredParameterNames(schema map[string]interface{}) []string {
 	}
 }
 
-// ToolResult 表示工具执行的结果
-// 用于统一封装工具执行的成功/失败状态和输出信息
-type ToolResult struct {
-	Success bool   // 执行是否成功
-	Output  string // 输出内容
-	Error   error  // 错误信息（如果有）
-}
-
-// NewToolResult 创建一个新的工具结果实例
-// 参数:
-//
-//	success: 是否成功
-//	output: 输出内容
-//	err: 错误信息
-func NewToolResult(success bool, output string, err error) ToolResult {
-	return ToolResult{
-		Success: success,
-		Output:  output,
-		Error:   err,
-	}
-}
-
-// String 返回结果的字符串表示
-// 如果有错误则返回错误信息，否则返回输出内容
-func (r ToolResult) String() string {
-	if r.Error != nil {
-		return fmt.Sprintf("Error: %v", r.Error)
-	}
-	return r.Output
-}
-
 // JSONString 将任意值转换为JSON字符串
 // 这是一个辅助函数，用于将结果序列化为JSON格式
 // 参数:
@@ -0,0 +1,309 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// codeexec.go - Python 代码执行工具
+// 此文件实现了 CodeExecTool：把模型给出的脚本保存到 workspace/code，在工作区的虚拟环境（workspace/.venv）中执行，
+// 执行前自动用 pip 安装声明的依赖，返回包含退出码、耗时、stdout 和 stderr 的 JSON 结果。
+// 取代了"用 shell 的 cat > file << EOF 写脚本再 python3 执行"的做法（转义容易出错，依赖也无处安装）。
+
+const (
+	codeDirName       = "code"
+	venvDirName       = ".venv"
+	venvInstalledFile = "nanogrip-installed.txt" // 已安装的依赖（位于虚拟环境目录中），避免每次都调用 pip
+
+	codeInstallTimeout = 5 * time.Minute // 创建虚拟环境和安装依赖的超时时间
+	maxCodeOutputChars = 20000           // stdout 和 stderr 各自最多返回的字符数（保留末尾）
+)
+
+// pipRequirement 允许的依赖写法：包名，可带 extras 和版本约束（例如 "pandas>=2.0"、"requests[socks]"）
+// 不允许以 - 开头，防止把 pip 选项当作依赖传入
+var pipRequirement = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*(\[[A-Za-z0-9._,-]+\])?\s*([<>=!~]=?\s*[A-Za-z0-9.*+!_-]+\s*,?\s*)*$`)
+
+// codeScriptName 脚本文件名：只允许文件名（不含目录），以 .py 结尾
+var codeScriptName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*\.py$`)
+
+// codeExecResult 是 code_exec 返回给模型的结果
+type codeExecResult struct {
+	Script     string   `json:"script"`              // 保存的脚本路径
+	ExitCode   int      `json:"exit_code"`           // 退出码，超时为 -1
+	TimedOut   bool     `json:"timed_out,omitempty"` // 是否超时被终止
+	DurationMS int64    `json:"duration_ms"`         // 执行耗时（不含安装依赖）
+	Installed  []string `json:"installed,omitempty"` // 本次新安装的依赖
+	Stdout     string   `json:"stdout"`
+	Stderr     string   `json:"stderr"`
+}
+
+// CodeExecTool 在工作区的虚拟环境中执行 Python 脚本
+type CodeExecTool struct {
+	BaseTool
+	workspace string
+	python    string         // 创建虚拟环境使用的解释器
+	timeout   time.Duration  // 脚本执行的超时时间
+	policy    *CommandPolicy // 执行前从环境变量中去除密钥（nil 表示不清理）
+	mu        sync.Mutex     // 串行化虚拟环境的创建和依赖的安装
+}
+
+// NewCodeExecTool 创建一个新的代码执行工具
+// 参数:
+//
+//	workspace: 工作区目录路径（脚本保存在 workspace/code，虚拟环境位于 workspace/.venv）
+//	python: 创建虚拟环境使用的 Python 解释器，为空时使用 DefaultPython
+//	timeout: 脚本执行的超时时间（秒）
+//
+// 返回:
+//
+//	配置好的CodeExecTool实例
+func NewCodeExecTool(workspace, python string, timeout int) *CodeExecTool {
+	if python == "" {
+		python = DefaultPython()
+	}
+	if timeout <= 0 {
+		timeout = 60
+	}
+
+	return &CodeExecTool{
+		BaseTool: NewBaseTool(
+			"code_exec",
+			"Run a Python script in the workspace's virtual environment. The code is saved to a file in workspace/code and executed with the workspace as the working directory. "+
+				"List third-party packages in 'dependencies' and they are pip-installed into the environment first (already installed ones are skipped). "+
+				"Returns JSON with exit_code, duration_ms, stdout and stderr. Use this instead of writing scripts with shell heredocs or python3 -c.",
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"code": map[string]interface{}{
+						"type":        "string",
+						"description": "Complete Python source code to run",
+					},
+					"dependencies": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "pip packages the script needs, e.g. [\"pillow\", \"pandas>=2.0\"]",
+					},
+					"filename": map[string]interface{}{
+						"type":        "string",
+						"description": "File name to save the script as in workspace/code (e.g. \"chart.py\"); by default a new timestamped name is used",
+					},
+				},
+				"required": []string{"code"},
+			},
+		),
+		workspace: workspace,
+		python:    python,
+		timeout:   time.Duration(timeout) * time.Second,
+	}
+}
+
+// DefaultPython 返回当前系统默认的 Python 解释器名称（Windows 上为 python，其他系统为 python3）
+func DefaultPython() string {
+	if runtime.GOOS == "windows" {
+		return "python"
+	}
+	return "python3"
+}
+
+// Available 判断创建虚拟环境使用的解释器是否存在
+func (t *CodeExecTool) Available() bool {
+	_, err := exec.LookPath(t.python)
+	return err == nil
+}
+
+// SetPolicy 设置命令策略，执行脚本和 pip 时按策略清理环境变量
+func (t *CodeExecTool) SetPolicy(policy *CommandPolicy) {
+	t.policy = policy
+}
+
+// Execute 保存并执行脚本
+// 参数:
+//
+//	ctx: 上下文对象
+//	params: 参数map，必须包含"code"，可选"dependencies"和"filename"
+//
+// 返回:
+//
+//	JSON 格式的执行结果；脚本以非零退出码结束不视为工具错误
+func (t *CodeExecTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	code, _ := params["code"].(string)
+	if strings.TrimSpace(code) == "" {
+		return "", fmt.Errorf("missing code parameter")
+	}
+
+	var deps []string
+	if list, ok := params["dependencies"].([]interface{}); ok {
+		for _, item := range list {
+			dep, _ := item.(string)
+			dep = strings.TrimSpace(dep)
+			if dep == "" {
+				continue
+			}
+			if !pipRequirement.MatchString(dep) {
+				return "", fmt.Errorf("invalid dependency %q: use a package name with an optional version, e.g. pandas>=2.0", dep)
+			}
+			deps = append(deps, dep)
+		}
+	}
+
+	name, _ := params["filename"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "run-" + time.Now().Format("20060102-150405") + ".py"
+	} else if !codeScriptName.MatchString(name) {
+		return "", fmt.Errorf("invalid filename %q: use a plain file name ending in .py", name)
+	}
+	script := filepath.Join(t.workspace, codeDirName, name)
+	if err := atomicWriteFile(script, []byte(code), 0644); err != nil {
+		return "", fmt.Errorf("failed to save script: %w", err)
+	}
+
+	python, installed, err := t.prepare(ctx, deps)
+	if err != nil {
+		return "", err
+	}
+
+	result := t.run(ctx, python, script)
+	result.Installed = installed
+	return JSONString(result), nil
+}
+
+// prepare 确保虚拟环境存在并安装缺少的依赖
+// 返回:
+//
+//	虚拟环境中的解释器路径，以及本次新安装的依赖
+func (t *CodeExecTool) prepare(ctx context.Context, deps []string) (string, []string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, codeInstallTimeout)
+	defer cancel()
+
+	venv := filepath.Join(t.workspace, venvDirName)
+	python := venvPython(venv)
+	if _, err := os.Stat(python); err != nil {
+		ReportToolProgress(ctx, Progress{Percent: -1, Message: "creating virtual environment"})
+		if out, err := t.command(ctx, t.python, "-m", "venv", venv).CombinedOutput(); err != nil {
+			return "", nil, fmt.Errorf("failed to create virtual environment with %s: %v\n%s", t.python, err, tailChars(string(out), 2000))
+		}
+	}
+
+	installedPath := filepath.Join(venv, venvInstalledFile)
+	done := make(map[string]bool)
+	if data, err := os.ReadFile(installedPath); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				done[line] = true
+			}
+		}
+	}
+	var missing []string
+	for _, dep := range deps {
+		key := strings.ToLower(strings.Join(strings.Fields(dep), ""))
+		if !done[key] {
+			missing = append(missing, dep)
+			done[key] = true
+		}
+	}
+	if len(missing) == 0 {
+		return python, nil, nil
+	}
+
+	ReportToolProgress(ctx, Progress{Percent: -1, Message: "installing " + strings.Join(missing, ", ")})
+	args := append([]string{"-m", "pip", "install", "--disable-pip-version-check", "--no-input", "-q"}, missing...)
+	if out, err := t.command(ctx, python, args...).CombinedOutput(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", nil, fmt.Errorf("installing dependencies timed out after %s", codeInstallTimeout)
+		}
+		return "", nil, fmt.Errorf("pip install %s failed: %v\n%s", strings.Join(missing, " "), err, tailChars(string(out), 2000))
+	}
+
+	keys := make([]string, 0, len(done))
+	for key := range done {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	_ = atomicWriteFile(installedPath, []byte(strings.Join(keys, "\n")+"\n"), 0644)
+	return python, missing, nil
+}
+
+// run 在虚拟环境中执行脚本，输出同时作为进度报告
+func (t *CodeExecTool) run(ctx context.Context, python, script string) codeExecResult {
+	result := codeExecResult{Script: script}
+
+	runCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := t.command(runCtx, python, script)
+	cmd.Stdout = &progressWriter{ctx: ctx, buf: &stdout}
+	cmd.Stderr = &progressWriter{ctx: ctx, buf: &stderr}
+
+	start := time.Now()
+	err := cmd.Run()
+	result.DurationMS = time.Since(start).Milliseconds()
+	result.Stdout = tailChars(stdout.String(), maxCodeOutputChars)
+	result.Stderr = tailChars(stderr.String(), maxCodeOutputChars)
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case runCtx.Err() == context.DeadlineExceeded:
+		result.ExitCode = -1
+		result.TimedOut = true
+		result.Stderr += fmt.Sprintf("\n[killed: timed out after %s]", t.timeout)
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		result.ExitCode = -1
+		result.Stderr += "\n" + err.Error()
+	}
+	return result
+}
+
+// command 创建在工作区中执行的命令，环境变量按策略清理，并激活虚拟环境
+func (t *CodeExecTool) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = t.workspace
+
+	env := os.Environ()
+	if t.policy != nil {
+		env = t.policy.Env(env)
+	}
+	venv := filepath.Join(t.workspace, venvDirName)
+	for i, kv := range env {
+		if key, value, _ := strings.Cut(kv, "="); strings.EqualFold(key, "PATH") {
+			env[i] = key + "=" + filepath.Dir(venvPython(venv)) + string(os.PathListSeparator) + value
+		}
+	}
+	cmd.Env = append(env, "VIRTUAL_ENV="+venv, "PYTHONUNBUFFERED=1", "PYTHONIOENCODING=utf-8")
+	return cmd
+}
+
+// venvPython 返回虚拟环境中解释器的路径
+func venvPython(venv string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(venv, "Scripts", "python.exe")
+	}
+	return filepath.Join(venv, "bin", "python")
+}
+
+// tailChars 只保留 s 最后 n 个字符，截断时在开头注明
+func tailChars(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return fmt.Sprintf("[... %d characters omitted]\n", len(runes)-n) + string(runes[len(runes)-n:])
+}
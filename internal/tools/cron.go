@@ -13,6 +13,9 @@ import (
 // cron.go - 定时任务调度工具
 // 此文件实现了定时任务和提醒功能，支持添加、列出和删除定时任务
 
+// maxHistoryRuns history 操作最多返回的执行记录数
+const maxHistoryRuns = 20
+
 // CronTool 提供定时调度功能
 // 允许代理创建和管理定时任务、提醒和周期性任务
 //
@@ -39,13 +42,13 @@ func NewCronTool(cronService *cron.CronService) *CronTool {
 	return &CronTool{
 		BaseTool: NewBaseTool(
 			"cron",
-			"Schedule reminders and recurring tasks. Actions: add, list, remove.\n\nFor add action:\n- Use 'mode' to specify execution mode: 'message' (send fixed text) or 'agent' (trigger AI command execution)\n- For 'message' mode: use 'message' parameter for the text content\n- For 'agent' mode: use 'command' parameter for the AI command to execute\n- Use 'once_seconds' for one-time reminders (e.g., remind me in 2 minutes)\n- Use 'every_seconds' for recurring tasks (e.g., every 5 minutes)\n- Use 'at' for specific time (e.g., '2026-02-12T10:30:00')\n\nExamples:\n- Message mode: {\"action\":\"add\", \"mode\":\"message\", \"message\":\"Hello\", \"once_seconds\":60}\n- Agent mode: {\"action\":\"add\", \"mode\":\"agent\", \"command\":\"查询今天天气\", \"every_seconds\":3600}",
+			"Schedule reminders and recurring tasks. Actions: add, list, remove, history (recent runs with success/failure, optionally for one job_id).\n\nFor add action:\n- Use 'mode' to specify execution mode: 'message' (send fixed text) or 'agent' (trigger AI command execution)\n- For 'message' mode: use 'message' parameter for the text content\n- For 'agent' mode: use 'command' parameter for the AI command to execute\n- Use 'once_seconds' for one-time reminders (e.g., remind me in 2 minutes)\n- Use 'every_seconds' for recurring tasks (e.g., every 5 minutes)\n- Use 'at' for specific time (e.g., '2026-02-12T10:30:00')\n- Use 'schedule' for recurring calendar schedules in plain English (e.g., 'every weekday at 9am', 'first Monday of the month'); prefer it over writing cron_expr yourself\n\nThe reply confirms the parsed schedule and the next run time; repeat them to the user.\n\nExamples:\n- Message mode: {\"action\":\"add\", \"mode\":\"message\", \"message\":\"Hello\", \"once_seconds\":60}\n- Agent mode: {\"action\":\"add\", \"mode\":\"agent\", \"command\":\"查询今天天气\", \"every_seconds\":3600}",
 			map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
 					"action": map[string]interface{}{
 						"type":        "string",
-						"enum":        []string{"add", "list", "remove"},
+						"enum":        []string{"add", "list", "remove", "history"},
 						"description": "Action to perform",
 					},
 					"mode": map[string]interface{}{
@@ -69,17 +72,61 @@ func NewCronTool(cronService *cron.CronService) *CronTool {
 						"type":        "integer",
 						"description": "Interval in seconds for RECURRING tasks (e.g., 300 for 'every 5 minutes'). The job will repeat indefinitely.",
 					},
+					"schedule": map[string]interface{}{
+						"type":        "string",
+						"description": "Recurring schedule in plain English, evaluated in the user's time zone: 'every weekday at 9am', 'mon, wed and fri 18:00', 'every 15 minutes', 'monthly on the 1st and 15th at 9', 'first Monday of the month', 'last friday of every month 5pm', 'every year on Mar 5 at 10am'",
+					},
 					"cron_expr": map[string]interface{}{
 						"type":        "string",
-						"description": "Cron expression like '0 9 * * *' (for scheduled tasks)",
+						"description": "Cron expression like '0 9 * * *' (for scheduled tasks), evaluated in the user's time zone",
 					},
 					"at": map[string]interface{}{
 						"type":        "string",
-						"description": "ISO datetime for one-time execution (e.g., '2026-02-12T10:30:00')",
+						"description": "ISO datetime for one-time execution in the user's local time (e.g., '2026-02-12T10:30:00'), the same time zone as the current time in your context",
 					},
 					"job_id": map[string]interface{}{
 						"type":        "string",
-						"description": "Job ID (for remove)",
+						"description": "Job ID (for remove; optional for history)",
+					},
+					"calendar": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Show this job in the user's calendar feed (default: true). Set false for noisy or private jobs.",
+					},
+					"misfire": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{string(cron.MisfireSkip), string(cron.MisfireRunOnce), string(cron.MisfireRunAll)},
+						"description": "What to do when the job's time was missed (gateway down, machine asleep): skip it, run once late (default), or run every missed execution",
+					},
+					"skip_if_running": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Skip a run while the previous run of this job is still in progress (default: true). Set false only if runs may safely overlap.",
+					},
+					"max_runtime_seconds": map[string]interface{}{
+						"type":        "integer",
+						"description": "Cancel an agent-mode run after this many seconds (default: no limit)",
+					},
+					"jitter_seconds": map[string]interface{}{
+						"type":        "integer",
+						"description": "Delay each run by a random 0..N seconds so many jobs don't start at the same moment (default: 0)",
+					},
+					"permissions": map[string]interface{}{
+						"type":        "object",
+						"description": "Restrict the tools an agent-mode job may use when it runs unattended (recommended for recurring jobs). Cannot grant more than the configured default.",
+						"properties": map[string]interface{}{
+							"tools": map[string]interface{}{
+								"type":        "array",
+								"items":       map[string]interface{}{"type": "string"},
+								"description": "Allowed tool names (supports * wildcards); empty means all tools",
+							},
+							"read_only": map[string]interface{}{
+								"type":        "boolean",
+								"description": "Forbid writing, deleting or patching files",
+							},
+							"no_shell": map[string]interface{}{
+								"type":        "boolean",
+								"description": "Forbid shell commands",
+							},
+						},
 					},
 				},
 				"required": []string{"action"},
@@ -129,6 +176,8 @@ func (t *CronTool) Execute(ctx context.Context, params map[string]interface{}) (
 		return t.listJobs()
 	case "remove":
 		return t.removeJob(params)
+	case "history":
+		return t.jobHistory(ctx, params)
 	default:
 		return "Unknown action: " + action, nil
 	}
@@ -139,7 +188,8 @@ func (t *CronTool) Execute(ctx context.Context, params map[string]interface{}) (
 //  1. message 模式：发送固定的消息内容（兼容旧版）
 //  2. agent 模式：触发 Agent 执行命令，可以调用工具、查询数据等
 //
-// 支持三种调度方式：周期性（every_seconds）、一次性（once_seconds, at）、cron表达式（cron_expr）
+// 支持四种调度方式：周期性（every_seconds）、一次性（once_seconds, at）、自然语言短语（schedule）、cron表达式（cron_expr）
+// 短语和 cron 表达式在创建前校验，返回结果中包含解析后的调度说明和下次执行时间，供模型向用户确认
 // 参数:
 //
 //	params: 参数map，必须包含"action"，可选"mode"（默认message）
@@ -154,8 +204,10 @@ func (t *CronTool) addJob(ctx context.Context, params map[string]interface{}) (s
 	command, _ := params["command"].(string)
 	everySeconds, _ := params["every_seconds"].(float64)
 	onceSeconds, _ := params["once_seconds"].(float64)
+	phrase, _ := params["schedule"].(string)
 	cronExpr, _ := params["cron_expr"].(string)
 	at, _ := params["at"].(string)
+	loc := ToolLocation(ctx)
 
 	// 默认模式为 message
 	if mode == "" {
@@ -181,7 +233,7 @@ func (t *CronTool) addJob(ctx context.Context, params map[string]interface{}) (s
 	}
 
 	if channel == "" || chatID == "" {
-		return "Error: no session context (channel/chat_id)", nil
+		return "", fmt.Errorf("no session context (channel/chat_id)")
 	}
 
 	// 根据模式验证参数
@@ -192,7 +244,7 @@ func (t *CronTool) addJob(ctx context.Context, params map[string]interface{}) (s
 	if mode == "agent" {
 		// Agent 模式：需要 command 参数
 		if command == "" {
-			return "Error: 'command' parameter is required for agent mode", nil
+			return "", fmt.Errorf("'command' parameter is required for agent mode")
 		}
 		taskContent = command
 		triggerAgent = true
@@ -201,7 +253,7 @@ func (t *CronTool) addJob(ctx context.Context, params map[string]interface{}) (s
 	} else {
 		// Message 模式：需要 message 参数
 		if message == "" {
-			return "Error: 'message' parameter is required for message mode", nil
+			return "", fmt.Errorf("'message' parameter is required for message mode")
 		}
 		taskContent = message
 		triggerAgent = false
@@ -211,6 +263,7 @@ func (t *CronTool) addJob(ctx context.Context, params map[string]interface{}) (s
 	// 构建调度配置
 	schedule := cron.Schedule{}
 	deleteAfter := false // 默认不删除
+	scheduled := ""      // 返回给模型的调度说明
 
 	if onceSeconds > 0 {
 		// 一次性延迟任务（N秒后执行一次）
@@ -229,22 +282,38 @@ func (t *CronTool) addJob(ctx context.Context, params map[string]interface{}) (s
 		}
 		deleteAfter = false
 		log.Printf("[CronTool] 创建周期性任务: %s, 每%d秒执行一次", taskContent, int64(everySeconds))
-	} else if cronExpr != "" {
-		// Cron表达式任务（如：每天9点执行）
+	} else if phrase != "" || cronExpr != "" {
+		// 自然语言短语或 Cron 表达式任务（如：每个工作日 9 点执行）
+		scheduled = "cron '" + cronExpr + "'"
+		if phrase != "" {
+			parsed, err := cron.ParsePhrase(phrase)
+			if err != nil {
+				return "", err
+			}
+			cronExpr, scheduled = parsed.CronExpr, parsed.Description
+		}
 		schedule = cron.Schedule{
 			Kind:     "cron",
 			CronExpr: cronExpr,
 		}
+		// 按用户的时区计算（未设置时区时使用服务器的本地时区）
+		if loc != time.Local {
+			schedule.TZ = loc.String()
+		}
+		if err := cron.ValidateSchedule(schedule); err != nil {
+			return "", err
+		}
+		scheduled += " " + zoneName(loc)
 		deleteAfter = false
 		log.Printf("[CronTool] 创建cron任务: %s, 表达式: %s", taskContent, cronExpr)
 	} else if at != "" {
-		// 一次性任务（在指定时间执行一次）
-		targetTime, err := time.ParseInLocation("2006-01-02T15:04:05", at, time.Local)
+		// 一次性任务（在指定时间执行一次），时间按用户的时区解析
+		targetTime, err := time.ParseInLocation("2006-01-02T15:04:05", at, loc)
 		if err != nil {
-			targetTime, err = time.ParseInLocation("2006-01-02T15:04", at, time.Local)
+			targetTime, err = time.ParseInLocation("2006-01-02T15:04", at, loc)
 		}
 		if err != nil {
-			return "Error: invalid 'at' datetime format. Use 'YYYY-MM-DDTHH:MM:SS' or 'YYYY-MM-DDTHH:MM'", nil
+			return "", fmt.Errorf("invalid 'at' datetime format. Use 'YYYY-MM-DDTHH:MM:SS' or 'YYYY-MM-DDTHH:MM'")
 		}
 
 		log.Printf("[CronTool] 解析时间: 输入='%s', 解析结果=%v, UnixMs=%d",
@@ -255,7 +324,7 @@ func (t *CronTool) addJob(ctx context.Context, params map[string]interface{}) (s
 		}
 		deleteAfter = true
 	} else {
-		return "Error: either once_seconds, every_seconds, cron_expr, or at is required", nil
+		return "", fmt.Errorf("either once_seconds, every_seconds, schedule, cron_expr, or at is required")
 	}
 
 	// 创建任务
@@ -271,6 +340,29 @@ func (t *CronTool) addJob(ctx context.Context, params map[string]interface{}) (s
 		TriggerAgent: triggerAgent,
 		AgentCommand: agentCommand,
 	}
+	if visible, ok := params["calendar"].(bool); ok && !visible {
+		job.HideFromCalendar = true
+	}
+	if triggerAgent {
+		job.Permissions = t.jobPermissions(params["permissions"])
+	}
+	if misfire, ok := params["misfire"].(string); ok {
+		policy, err := cron.ParseMisfirePolicy(misfire)
+		if err != nil {
+			return "", err
+		}
+		job.Misfire = policy
+	}
+	if skip, ok := params["skip_if_running"].(bool); ok && !skip {
+		job.AllowOverlap = true
+	}
+	maxRuntime, _ := params["max_runtime_seconds"].(float64)
+	jitter, _ := params["jitter_seconds"].(float64)
+	if maxRuntime < 0 || jitter < 0 {
+		return "", fmt.Errorf("max_runtime_seconds and jitter_seconds must not be negative")
+	}
+	job.MaxRuntime = time.Duration(maxRuntime) * time.Second
+	job.Jitter = time.Duration(jitter) * time.Second
 
 	// 添加到调度器
 	t.cronService.AddJob(job)
@@ -279,7 +371,38 @@ func (t *CronTool) addJob(ctx context.Context, params map[string]interface{}) (s
 	if !triggerAgent {
 		modeDesc = "message"
 	}
-	return fmt.Sprintf("Created %s job '%s' (id: %s, type: %s)", modeDesc, job.Name, job.ID, schedule.Kind), nil
+	result := fmt.Sprintf("Created %s job '%s' (id: %s, type: %s)", modeDesc, job.Name, job.ID, schedule.Kind)
+	if scheduled != "" {
+		result += ", scheduled for " + scheduled
+	}
+	if !job.NextRun.IsZero() {
+		result += ", next run " + job.NextRun.In(loc).Format("2006-01-02 15:04 (Mon)")
+	}
+	return result, nil
+}
+
+// zoneName 返回时区的名称，服务器的本地时区没有 IANA 名称，使用时区缩写
+func zoneName(loc *time.Location) string {
+	if loc == time.Local {
+		return time.Now().Format("MST")
+	}
+	return loc.String()
+}
+
+// jobPermissions 解析 permissions 参数，并用配置的默认权限收紧
+// 没有请求权限时返回 nil（执行时使用默认权限）
+func (t *CronTool) jobPermissions(value interface{}) *cron.Permissions {
+	requested, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	perms := cron.Permissions{Tools: stringListParam(requested["tools"])}
+	perms.ReadOnly, _ = requested["read_only"].(bool)
+	perms.NoShell, _ = requested["no_shell"].(bool)
+	if defaults := t.cronService.DefaultPermissions(); defaults != nil {
+		perms = defaults.Restrict(perms)
+	}
+	return &perms
 }
 
 // listJobs 列出所有已调度的任务
@@ -311,8 +434,33 @@ func (t *CronTool) listJobs() (string, error) {
 		if job.TriggerAgent {
 			mode = "agent"
 		}
+		if job.Builtin != "" {
+			mode = job.Builtin
+		}
 
-		result += fmt.Sprintf("- %s (id: %s, type: %s, mode: %s)\n", job.Name, job.ID, jobType, mode)
+		result += fmt.Sprintf("- %s (id: %s, type: %s, mode: %s", job.Name, job.ID, jobType, mode)
+		if job.HideFromCalendar {
+			result += ", hidden from calendar"
+		}
+		if job.Misfire != "" {
+			result += ", misfire: " + string(job.Misfire)
+		}
+		if job.Schedule.TZ != "" {
+			result += ", time zone: " + job.Schedule.TZ
+		}
+		if job.AllowOverlap {
+			result += ", overlap allowed"
+		}
+		if job.MaxRuntime > 0 {
+			result += ", max runtime: " + job.MaxRuntime.String()
+		}
+		if job.Jitter > 0 {
+			result += ", jitter: " + job.Jitter.String()
+		}
+		if job.TriggerAgent && job.Permissions != nil {
+			result += ", permissions: " + job.Permissions.String()
+		}
+		result += ")\n"
 	}
 
 	result += "\nTo remove a job, use 'remove' action with the job_id."
@@ -333,7 +481,7 @@ func (t *CronTool) removeJob(params map[string]interface{}) (string, error) {
 
 	// 验证参数
 	if jobID == "" {
-		return "Error: job_id is required for remove", nil
+		return "", fmt.Errorf("job_id is required for remove")
 	}
 
 	// 执行删除
@@ -343,3 +491,23 @@ func (t *CronTool) removeJob(params map[string]interface{}) (string, error) {
 
 	return "Job " + jobID + " not found", nil
 }
+
+// jobHistory 返回任务最近的执行记录
+// 参数:
+//
+//	params: 参数map，可选"job_id"（为空表示所有任务）
+//
+// 返回:
+//
+//	执行记录（新的在前），时间按用户的时区显示
+func (t *CronTool) jobHistory(ctx context.Context, params map[string]interface{}) (string, error) {
+	jobID, _ := params["job_id"].(string)
+	runs := t.cronService.History(jobID, maxHistoryRuns)
+	if len(runs) == 0 {
+		if jobID != "" {
+			return "No runs recorded for job " + jobID + ".", nil
+		}
+		return "No job runs recorded yet.", nil
+	}
+	return "Recent runs (newest first, ✓ success, ✗ failure):\n" + cron.FormatRuns(runs, ToolLocation(ctx)), nil
+}
@@ -0,0 +1,674 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// document.go - 文档提取工具
+// 此文件实现了 DocumentTool：从 PDF、DOCX、PPTX、XLSX 和纯文本文件中提取文本，
+// 按固定大小分块写入工作区，返回统计信息、开头部分和文件路径，
+// 模型可以据此总结文档，或者用 filesystem 工具逐块阅读
+
+const (
+	defaultDocumentChunkChars = 4000             // 默认每块的字符数
+	documentPreviewChars      = 3000             // 返回结果中预览的字符数
+	maxDocumentBytes          = 50 * 1024 * 1024 // 最多处理 50MB 的文件
+	maxDocumentXMLBytes       = 20 * 1024 * 1024 // Office 文件中单个 XML 部件最多读取 20MB
+)
+
+// DocumentTool 提供文档文本提取功能
+// PDF 优先使用 pdftotext（poppler-utils），未安装时使用内置的简单解析器（只支持常见的文本编码）
+// Office 文件（docx/pptx/xlsx）直接解析其中的 XML，不需要外部程序
+type DocumentTool struct {
+	BaseTool
+	workspace string          // 工作区目录，提取结果写入 workspace/documents
+	files     *FilesystemTool // 用于解析路径和检查工作区限制
+}
+
+// NewDocumentTool 创建一个新的文档提取工具
+// 参数:
+//
+//	workspace: 工作区目录路径
+//	restrict: 是否限制只能读取工作区内的文件
+//
+// 返回:
+//
+//	配置好的DocumentTool实例
+func NewDocumentTool(workspace string, restrict bool) *DocumentTool {
+	return &DocumentTool{
+		BaseTool: NewBaseTool(
+			"document",
+			"Extract the text of a document (PDF, DOCX, PPTX, XLSX, or plain text such as TXT/MD/CSV) so it can be read or summarized. "+
+				"Use this for files the user attached (shown as [File: path]). "+
+				"The full text and fixed-size chunks are written to the workspace; the result contains statistics, the beginning of the text and the paths. "+
+				"For long documents, read the chunk files one by one with the filesystem tool.",
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Path to the document",
+					},
+					"chunk_size": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("Characters per chunk (default %d)", defaultDocumentChunkChars),
+					},
+				},
+				"required": []string{"path"},
+			},
+		),
+		workspace: workspace,
+		files:     &FilesystemTool{workspace: workspace, restrict: restrict},
+	}
+}
+
+// SetAllowedRoots 设置限制在工作区内时额外允许读取的目录（见 FilesystemTool.SetAllowedRoots）
+func (t *DocumentTool) SetAllowedRoots(roots []AllowedRoot) {
+	t.files.SetAllowedRoots(roots)
+}
+
+// Execute 提取文档文本并分块写入工作区
+// 参数:
+//
+//	ctx: 上下文对象（用于取消 pdftotext）
+//	params: 参数map，必须包含"path"，可选"chunk_size"
+//
+// 返回:
+//
+//	统计信息、文本开头和结果文件路径
+func (t *DocumentTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	path, _ := params["path"].(string)
+	if path == "" {
+		return "", fmt.Errorf("missing path parameter")
+	}
+	chunkSize := defaultDocumentChunkChars
+	if v, ok := params["chunk_size"].(float64); ok && v > 0 {
+		chunkSize = int(v)
+	}
+
+	resolved, err := t.files.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", resolved)
+	}
+	if info.Size() > maxDocumentBytes {
+		return "", fmt.Errorf("document is too large (%d bytes, limit %d)", info.Size(), maxDocumentBytes)
+	}
+
+	text, err := extractDocumentText(ctx, resolved)
+	if err != nil {
+		return "", err
+	}
+	text = normalizeDocumentText(text)
+	if text == "" {
+		return fmt.Sprintf("No text could be extracted from %s (it may be a scanned document or use an unsupported encoding).", resolved), nil
+	}
+
+	outDir := filepath.Join(t.workspace, "documents", documentSlug(resolved))
+	fullPath, chunkPaths, err := writeDocumentChunks(outDir, text, chunkSize)
+	if err != nil {
+		return "", err
+	}
+
+	runes := []rune(text)
+	var result strings.Builder
+	fmt.Fprintf(&result, "Extracted %d characters (%d words, %d lines) from %s\n", len(runes), len(strings.Fields(text)), strings.Count(text, "\n")+1, resolved)
+	fmt.Fprintf(&result, "Full text: %s\n", fullPath)
+	if len(chunkPaths) == 1 {
+		fmt.Fprintf(&result, "\n%s", text)
+		return result.String(), nil
+	}
+
+	preview := runes
+	if len(preview) > documentPreviewChars {
+		preview = preview[:documentPreviewChars]
+	}
+	fmt.Fprintf(&result, "Chunks (%d, ~%d characters each): %s ... %s\n", len(chunkPaths), chunkSize, chunkPaths[0], filepath.Base(chunkPaths[len(chunkPaths)-1]))
+	fmt.Fprintf(&result, "\nBeginning of the document:\n%s\n... (read the chunk files for the rest)", string(preview))
+	return result.String(), nil
+}
+
+// extractDocumentText 根据文件扩展名选择提取方式
+func extractDocumentText(ctx context.Context, path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		return extractPDFText(ctx, path)
+	case ".docx":
+		return extractDocxText(path)
+	case ".pptx":
+		return extractPptxText(path)
+	case ".xlsx":
+		return extractXlsxText(path)
+	case ".doc", ".ppt", ".xls":
+		return "", fmt.Errorf("legacy Office format %s is not supported; convert it to the newer format (docx/pptx/xlsx) first", filepath.Ext(path))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) != -1 {
+		return "", fmt.Errorf("unsupported document type: %s", filepath.Base(path))
+	}
+	return string(data), nil
+}
+
+// normalizeDocumentText 统一换行符，去掉行尾空白和多余的空行
+func normalizeDocumentText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.ReplaceAll(text, "\f", "\n")
+
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	blank := 0
+	for _, line := range lines {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line == "" {
+			blank++
+			if blank > 1 {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// documentSlugRe 匹配文件名中不适合作为目录名的字符
+var documentSlugRe = regexp.MustCompile(`[^\p{L}\p{N}._-]+`)
+
+// documentSlug 根据文件名生成结果目录名
+func documentSlug(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	slug := strings.Trim(documentSlugRe.ReplaceAllString(name, "-"), "-.")
+	if slug == "" {
+		slug = "document"
+	}
+	return slug
+}
+
+// writeDocumentChunks 写入全文和分块文件
+// 分块尽量在段落或行的边界处切分
+// 返回: 全文文件路径，分块文件路径列表
+func writeDocumentChunks(dir, text string, chunkSize int) (string, []string, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return "", nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, err
+	}
+
+	fullPath := filepath.Join(dir, "full.txt")
+	if err := os.WriteFile(fullPath, []byte(text+"\n"), 0644); err != nil {
+		return "", nil, err
+	}
+
+	var chunkPaths []string
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		end := start + chunkSize
+		if end >= len(runes) {
+			end = len(runes)
+		} else if cut := chunkBoundary(runes[start:end]); cut > 0 {
+			end = start + cut
+		}
+
+		chunkPath := filepath.Join(dir, fmt.Sprintf("chunk-%03d.txt", len(chunkPaths)+1))
+		if err := os.WriteFile(chunkPath, []byte(strings.TrimSpace(string(runes[start:end]))+"\n"), 0644); err != nil {
+			return "", nil, err
+		}
+		chunkPaths = append(chunkPaths, chunkPath)
+		start = end
+	}
+	return fullPath, chunkPaths, nil
+}
+
+// chunkBoundary 在块的后半部分寻找段落或行的结尾，找不到时返回 0（按固定长度切分）
+func chunkBoundary(chunk []rune) int {
+	s := string(chunk)
+	half := len(string(chunk[:len(chunk)/2]))
+	for _, sep := range []string{"\n\n", "\n", ". "} {
+		if i := strings.LastIndex(s, sep); i >= half {
+			return utf8.RuneCountInString(s[:i+len(sep)])
+		}
+	}
+	return 0
+}
+
+// ===== PDF =====
+
+var (
+	pdfStreamRe = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+	pdfTokenRe  = regexp.MustCompile(`\((?:\\.|[^\\)])*\)|\[|\]|[A-Za-z'"*]+|-?[0-9.]+`)
+)
+
+// extractPDFText 提取 PDF 文本，优先使用 pdftotext
+func extractPDFText(ctx context.Context, path string) (string, error) {
+	if bin, err := exec.LookPath("pdftotext"); err == nil {
+		out, err := exec.CommandContext(ctx, bin, "-layout", "-enc", "UTF-8", path, "-").Output()
+		if err == nil {
+			return string(out), nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return "", fmt.Errorf("%s is not a PDF file", filepath.Base(path))
+	}
+	return extractPDFStreams(data), nil
+}
+
+// extractPDFStreams 是不依赖外部程序的简单 PDF 文本提取
+// 解压 FlateDecode 内容流，读取 Tj/TJ/'/" 操作符中的字符串。
+// 使用自定义字体编码（CID 字体、子集字体）的 PDF 无法正确提取，这种情况建议安装 pdftotext
+func extractPDFStreams(data []byte) string {
+	var out strings.Builder
+	for _, loc := range pdfStreamRe.FindAllSubmatchIndex(data, -1) {
+		dict := string(data[loc[2]:loc[3]])
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end == -1 {
+			break
+		}
+		raw := data[start : start+end]
+
+		if strings.Contains(dict, "/Subtype/Image") || strings.Contains(dict, "/Subtype /Image") {
+			continue
+		}
+		if strings.Contains(dict, "/FlateDecode") {
+			r, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				continue
+			}
+			raw, _ = io.ReadAll(io.LimitReader(r, maxDocumentBytes))
+			r.Close()
+		} else if strings.Contains(dict, "/Filter") {
+			continue // 其他压缩方式不支持
+		}
+		if !bytes.Contains(raw, []byte("BT")) {
+			continue
+		}
+		out.WriteString(pdfContentText(raw))
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// pdfContentText 解析一个内容流中的文本操作符
+func pdfContentText(content []byte) string {
+	var out strings.Builder
+	var operands []string
+	inArray := false
+	var array strings.Builder
+
+	for _, tok := range pdfTokenRe.FindAll(content, -1) {
+		s := string(tok)
+		switch {
+		case s[0] == '(':
+			text := pdfUnescape(s[1 : len(s)-1])
+			if inArray {
+				array.WriteString(text)
+			} else {
+				operands = append(operands, text)
+			}
+		case s == "[":
+			inArray = true
+			array.Reset()
+		case s == "]":
+			inArray = false
+			operands = append(operands, array.String())
+		case inArray:
+			// TJ 数组中的字距调整：较大的负值通常表示单词间距
+			if n, err := strconv.ParseFloat(s, 64); err == nil && n < -200 {
+				array.WriteString(" ")
+			}
+		case s == "Tj" || s == "TJ":
+			if len(operands) > 0 {
+				out.WriteString(operands[len(operands)-1])
+			}
+			operands = operands[:0]
+		case s == "'" || s == "\"":
+			out.WriteString("\n")
+			if len(operands) > 0 {
+				out.WriteString(operands[len(operands)-1])
+			}
+			operands = operands[:0]
+		case s == "T*" || s == "ET":
+			out.WriteString("\n")
+			operands = operands[:0]
+		case s == "Td" || s == "TD":
+			// 纵向移动表示换行，横向移动表示同一行的下一段
+			if len(operands) >= 2 && operands[len(operands)-1] != "0" {
+				out.WriteString("\n")
+			} else {
+				out.WriteString(" ")
+			}
+			operands = operands[:0]
+		case isPDFNumber(s):
+			operands = append(operands, s)
+		default:
+			operands = operands[:0]
+		}
+	}
+	return out.String()
+}
+
+// isPDFNumber 判断记号是否为数字
+func isPDFNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// pdfUnescape 处理 PDF 字符串中的转义序列
+func pdfUnescape(s string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			out.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 't':
+			out.WriteByte('\t')
+		case 'b', 'f':
+		case '\n', '\r':
+			// 行继续
+		default:
+			if s[i] >= '0' && s[i] <= '7' {
+				j := i
+				for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+					j++
+				}
+				n, _ := strconv.ParseUint(s[i:j], 8, 8)
+				out.WriteRune(rune(n)) // 按 Latin-1 解释
+				i = j - 1
+			} else {
+				out.WriteByte(s[i])
+			}
+		}
+	}
+
+	// 字符串本身可能是 Latin-1 编码，逐字节转换为 UTF-8
+	result := out.String()
+	if utf8.ValidString(result) {
+		return result
+	}
+	runes := make([]rune, 0, len(result))
+	for i := 0; i < len(result); i++ {
+		runes = append(runes, rune(result[i]))
+	}
+	return string(runes)
+}
+
+// ===== Office (OOXML) =====
+
+// readZipXML 打开 Office 文件中的一个 XML 部件
+func readZipXML(f *zip.File) (*xml.Decoder, func(), error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return xml.NewDecoder(io.LimitReader(rc, maxDocumentXMLBytes)), func() { rc.Close() }, nil
+}
+
+// ooxmlText 提取 XML 部件中的文本
+// textElem 是文本元素名（w:t 或 a:t），paraElem 是段落元素名（w:p 或 a:p）
+func ooxmlText(f *zip.File, textElem, paraElem string) (string, error) {
+	dec, closeFn, err := readZipXML(f)
+	if err != nil {
+		return "", err
+	}
+	defer closeFn()
+
+	var out strings.Builder
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return out.String(), err
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case textElem:
+				inText = true
+			case "tab":
+				out.WriteString("\t")
+			case "br", "cr":
+				out.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case textElem:
+				inText = false
+			case paraElem:
+				out.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				out.Write(el)
+			}
+		}
+	}
+	return out.String(), nil
+}
+
+// extractDocxText 提取 Word 文档正文
+func extractDocxText(path string) (string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open docx: %w", err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			return ooxmlText(f, "t", "p")
+		}
+	}
+	return "", fmt.Errorf("word/document.xml not found in %s", filepath.Base(path))
+}
+
+// numberedParts 返回 zip 中匹配 prefix + 数字 + ".xml" 的部件，按数字排序
+func numberedParts(zr *zip.ReadCloser, prefix string) []*zip.File {
+	var parts []*zip.File
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, prefix) && strings.HasSuffix(f.Name, ".xml") {
+			if _, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(f.Name, prefix), ".xml")); err == nil {
+				parts = append(parts, f)
+			}
+		}
+	}
+	num := func(f *zip.File) int {
+		n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(f.Name, prefix), ".xml"))
+		return n
+	}
+	sort.Slice(parts, func(i, j int) bool { return num(parts[i]) < num(parts[j]) })
+	return parts
+}
+
+// extractPptxText 提取 PowerPoint 每页幻灯片的文本
+func extractPptxText(path string) (string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open pptx: %w", err)
+	}
+	defer zr.Close()
+
+	var out strings.Builder
+	for i, f := range numberedParts(zr, "ppt/slides/slide") {
+		text, err := ooxmlText(f, "t", "p")
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&out, "--- Slide %d ---\n%s\n", i+1, text)
+	}
+	return out.String(), nil
+}
+
+// extractXlsxText 提取 Excel 工作表内容，每行输出为制表符分隔的文本
+func extractXlsxText(path string) (string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open xlsx: %w", err)
+	}
+	defer zr.Close()
+
+	var shared []string
+	for _, f := range zr.File {
+		if f.Name == "xl/sharedStrings.xml" {
+			if shared, err = xlsxSharedStrings(f); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	var out strings.Builder
+	for i, f := range numberedParts(zr, "xl/worksheets/sheet") {
+		text, err := xlsxSheetText(f, shared)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&out, "--- Sheet %d ---\n%s\n", i+1, text)
+	}
+	return out.String(), nil
+}
+
+// xlsxSharedStrings 读取共享字符串表
+func xlsxSharedStrings(f *zip.File) ([]string, error) {
+	dec, closeFn, err := readZipXML(f)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	var shared []string
+	var current strings.Builder
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return shared, err
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			if el.Name.Local == "si" {
+				current.Reset()
+			} else if el.Name.Local == "t" {
+				inText = true
+			}
+		case xml.EndElement:
+			if el.Name.Local == "si" {
+				shared = append(shared, current.String())
+			} else if el.Name.Local == "t" {
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				current.Write(el)
+			}
+		}
+	}
+	return shared, nil
+}
+
+// xlsxSheetText 读取一个工作表，共享字符串按索引替换
+func xlsxSheetText(f *zip.File, shared []string) (string, error) {
+	dec, closeFn, err := readZipXML(f)
+	if err != nil {
+		return "", err
+	}
+	defer closeFn()
+
+	var out strings.Builder
+	var row []string
+	var value strings.Builder
+	cellType := ""
+	inValue := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return out.String(), err
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "row":
+				row = row[:0]
+			case "c":
+				cellType = ""
+				for _, attr := range el.Attr {
+					if attr.Name.Local == "t" {
+						cellType = attr.Value
+					}
+				}
+				value.Reset()
+			case "v", "t":
+				inValue = true
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				cell := value.String()
+				if cellType == "s" {
+					if idx, err := strconv.Atoi(cell); err == nil && idx >= 0 && idx < len(shared) {
+						cell = shared[idx]
+					}
+				}
+				row = append(row, cell)
+			case "row":
+				out.WriteString(strings.TrimRight(strings.Join(row, "\t"), "\t"))
+				out.WriteString("\n")
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(el)
+			}
+		}
+	}
+	return out.String(), nil
+}
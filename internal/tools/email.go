@@ -0,0 +1,351 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/email"
+)
+
+// email.go - 邮件工具
+// 此文件实现了 SendEmailTool（通过 SMTP 发送邮件，支持附件）和 SearchEmailTool（通过 IMAP 搜索和阅读邮件）
+// 与聊天频道无关，Agent 可以在任何频道中使用，例如 "把报告发到我的邮箱"
+
+const (
+	maxEmailAttachmentBytes = 20 * 1024 * 1024 // 所有附件合计最多 20MB
+	maxEmailBodyChars       = 20000            // search_email 阅读邮件时最多返回的正文字符数
+)
+
+// SendEmailTool 提供发送邮件的功能
+// 收件人必须在允许列表中：列表为空时只能发给自己（发件人地址），"*" 表示不限制
+type SendEmailTool struct {
+	BaseTool
+	smtp    email.SMTPOptions
+	allow   []string        // 允许的收件人地址或域名
+	files   *FilesystemTool // 用于解析附件路径和检查工作区限制
+	timeout time.Duration
+}
+
+// NewSendEmailTool 创建一个新的发送邮件工具
+// 参数:
+//
+//	smtp: SMTP 服务器连接信息
+//	allowRecipients: 允许的收件人地址或域名（例如 "me@example.com"、"example.com"），"*" 表示不限制
+//	workspace: 工作区目录路径（相对路径的附件从这里查找）
+//	restrict: 是否限制附件只能来自工作区
+//
+// 返回:
+//
+//	配置好的SendEmailTool实例
+func NewSendEmailTool(smtp email.SMTPOptions, allowRecipients []string, workspace string, restrict bool) *SendEmailTool {
+	return &SendEmailTool{
+		BaseTool: NewBaseTool(
+			"send_email",
+			fmt.Sprintf("Send an email (plain text, optionally with file attachments) from %s. "+
+				"Use this when the user asks to email something, e.g. 'email me the report'. "+
+				"Only allowed recipients can be used; sending to the sender's own address is always allowed.", smtp.Sender()),
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"to": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Recipient addresses (defaults to the sender's own address)",
+					},
+					"cc": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "CC addresses",
+					},
+					"subject": map[string]interface{}{
+						"type":        "string",
+						"description": "Email subject",
+					},
+					"body": map[string]interface{}{
+						"type":        "string",
+						"description": "Plain text body",
+					},
+					"attachments": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Paths of files to attach (relative paths are resolved in the workspace)",
+					},
+				},
+				"required": []string{"subject", "body"},
+			},
+		),
+		smtp:    smtp,
+		allow:   normalizeDomains(allowRecipients),
+		files:   &FilesystemTool{workspace: workspace, restrict: restrict},
+		timeout: 2 * time.Minute,
+	}
+}
+
+// SetAllowedRoots 设置限制在工作区内时额外允许读取附件的目录（见 FilesystemTool.SetAllowedRoots）
+func (t *SendEmailTool) SetAllowedRoots(roots []AllowedRoot) {
+	t.files.SetAllowedRoots(roots)
+}
+
+// Execute 发送邮件
+// 参数:
+//
+//	ctx: 上下文对象
+//	params: 参数map，必须包含"subject"和"body"，可选"to"、"cc"和"attachments"
+//
+// 返回:
+//
+//	发送结果
+func (t *SendEmailTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	subject, _ := params["subject"].(string)
+	body, _ := params["body"].(string)
+	if strings.TrimSpace(subject) == "" && strings.TrimSpace(body) == "" {
+		return "", fmt.Errorf("missing subject and body")
+	}
+
+	to := stringListParam(params["to"])
+	cc := stringListParam(params["cc"])
+	if len(to) == 0 {
+		to = []string{t.smtp.Sender()}
+	}
+	for _, addr := range append(append([]string{}, to...), cc...) {
+		if err := t.checkRecipient(addr); err != nil {
+			return "", err
+		}
+	}
+
+	msg := email.Message{To: to, Cc: cc, Subject: subject, Body: body}
+	total := 0
+	for _, path := range stringListParam(params["attachments"]) {
+		resolved, err := t.files.resolvePath(path)
+		if err != nil {
+			return "", err
+		}
+		data, err := os.ReadFile(resolved)
+		if err != nil {
+			return "", fmt.Errorf("failed to read attachment: %w", err)
+		}
+		total += len(data)
+		if total > maxEmailAttachmentBytes {
+			return "", fmt.Errorf("attachments are too large (limit %d MB in total)", maxEmailAttachmentBytes/1024/1024)
+		}
+		msg.Attachments = append(msg.Attachments, email.Attachment{Name: filepath.Base(resolved), Data: data})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	if err := email.Send(ctx, t.smtp, msg); err != nil {
+		return "", fmt.Errorf("failed to send email: %w", err)
+	}
+
+	result := fmt.Sprintf("Email sent to %s", strings.Join(to, ", "))
+	if len(cc) > 0 {
+		result += fmt.Sprintf(" (cc %s)", strings.Join(cc, ", "))
+	}
+	if len(msg.Attachments) > 0 {
+		result += fmt.Sprintf(" with %d attachment(s)", len(msg.Attachments))
+	}
+	return result, nil
+}
+
+// checkRecipient 检查收件人是否允许
+func (t *SendEmailTool) checkRecipient(addr string) error {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return fmt.Errorf("invalid email address %q", addr)
+	}
+	address := strings.ToLower(parsed.Address)
+	if self, err := mail.ParseAddress(t.smtp.Sender()); err == nil && strings.EqualFold(self.Address, address) {
+		return nil
+	}
+
+	domain := address[strings.LastIndex(address, "@")+1:]
+	for _, rule := range t.allow {
+		if rule == "*" || rule == address || domainMatches(rule, domain, domain) {
+			return nil
+		}
+	}
+	return fmt.Errorf("recipient %s is not allowed (add it or its domain to tools.email.allowRecipients)", parsed.Address)
+}
+
+// SearchEmailTool 提供搜索和阅读邮件的功能（只读，不会把邮件标记为已读）
+type SearchEmailTool struct {
+	BaseTool
+	imap    email.IMAPOptions
+	mailbox string
+	timeout time.Duration
+}
+
+// NewSearchEmailTool 创建一个新的邮件搜索工具
+// 参数:
+//
+//	imap: IMAP 服务器连接信息
+//	mailbox: 默认搜索的邮箱文件夹（为空表示 INBOX）
+//
+// 返回:
+//
+//	配置好的SearchEmailTool实例
+func NewSearchEmailTool(imap email.IMAPOptions, mailbox string) *SearchEmailTool {
+	return &SearchEmailTool{
+		BaseTool: NewBaseTool(
+			"search_email",
+			"Search the user's mailbox (read-only) and read messages. "+
+				"Without 'uid' it returns matching messages (newest first) with their UIDs; "+
+				"with 'uid' it returns the full text of that message and the names of its attachments.",
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query": map[string]interface{}{
+						"type":        "string",
+						"description": "Text to search for in headers and body",
+					},
+					"from": map[string]interface{}{
+						"type":        "string",
+						"description": "Only messages whose sender contains this text",
+					},
+					"subject": map[string]interface{}{
+						"type":        "string",
+						"description": "Only messages whose subject contains this text",
+					},
+					"since": map[string]interface{}{
+						"type":        "string",
+						"description": "Only messages received on or after this date (YYYY-MM-DD)",
+					},
+					"unseen": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Only unread messages",
+					},
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": "Maximum number of messages to list (default 10)",
+					},
+					"mailbox": map[string]interface{}{
+						"type":        "string",
+						"description": "Mailbox folder (default INBOX)",
+					},
+					"uid": map[string]interface{}{
+						"type":        "integer",
+						"description": "UID of a message to read in full",
+					},
+				},
+			},
+		),
+		imap:    imap,
+		mailbox: mailbox,
+		timeout: 2 * time.Minute,
+	}
+}
+
+// Execute 搜索或阅读邮件
+// 参数:
+//
+//	ctx: 上下文对象
+//	params: 参数map，包含"uid"时阅读该邮件，否则按"query"、"from"、"subject"、"since"、"unseen"搜索
+//
+// 返回:
+//
+//	邮件列表或邮件正文
+func (t *SearchEmailTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	mailbox, _ := params["mailbox"].(string)
+	if mailbox == "" {
+		mailbox = t.mailbox
+	}
+
+	if uid, ok := params["uid"].(float64); ok && uid > 0 {
+		msg, err := email.Fetch(ctx, t.imap, mailbox, uint32(uid))
+		if err != nil {
+			return "", err
+		}
+		return formatMail(msg), nil
+	}
+
+	criteria := email.Criteria{
+		Mailbox: mailbox,
+		Text:    stringParam(params, "query"),
+		From:    stringParam(params, "from"),
+		Subject: stringParam(params, "subject"),
+	}
+	criteria.Unseen, _ = params["unseen"].(bool)
+	if v, ok := params["limit"].(float64); ok && v > 0 {
+		criteria.Limit = int(v)
+	}
+	if since := stringParam(params, "since"); since != "" {
+		parsed, err := time.Parse("2006-01-02", since)
+		if err != nil {
+			return "", fmt.Errorf("invalid since date %q, expected YYYY-MM-DD", since)
+		}
+		criteria.Since = parsed
+	}
+
+	results, err := email.Search(ctx, t.imap, criteria)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "No matching messages.", nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d message(s), newest first:\n", len(results))
+	for _, m := range results {
+		unread := ""
+		if !m.Seen {
+			unread = " [unread]"
+		}
+		fmt.Fprintf(&sb, "- uid %d%s: %s\n  from: %s\n  date: %s\n", m.UID, unread, m.Subject, m.From, m.Date)
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// formatMail 格式化一封完整的邮件
+func formatMail(msg *email.Mail) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Subject: %s\nFrom: %s\nTo: %s\nDate: %s\n", msg.Subject, msg.From, msg.To, msg.Date)
+	if len(msg.Attachments) > 0 {
+		fmt.Fprintf(&sb, "Attachments: %s\n", strings.Join(msg.Attachments, ", "))
+	}
+
+	body := msg.Body
+	if msg.HTML {
+		body = parseHTML(body).textContent()
+	}
+	body = strings.TrimSpace(body)
+	if runes := []rune(body); len(runes) > maxEmailBodyChars {
+		body = string(runes[:maxEmailBodyChars]) + "\n... (truncated)"
+	}
+	fmt.Fprintf(&sb, "\n%s", body)
+	return sb.String()
+}
+
+// stringListParam 读取字符串数组参数，也接受逗号分隔的字符串
+func stringListParam(value interface{}) []string {
+	var result []string
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+				result = append(result, strings.TrimSpace(s))
+			}
+		}
+	case []string:
+		for _, s := range v {
+			if strings.TrimSpace(s) != "" {
+				result = append(result, strings.TrimSpace(s))
+			}
+		}
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if strings.TrimSpace(s) != "" {
+				result = append(result, strings.TrimSpace(s))
+			}
+		}
+	}
+	return result
+}
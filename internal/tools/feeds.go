@@ -0,0 +1,567 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// feeds.go - RSS/Atom 订阅工具
+// 此文件实现了 FeedsTool：订阅、列出、取消订阅 RSS/Atom 源，并获取上次检查之后的新条目
+// 订阅和已读记录保存在 workspace/feeds.json，适合由 cron 的 agent 模式任务定时调用，
+// 例如 "每天早上检查我的订阅并总结新内容"
+
+const (
+	feedsFileName      = "feeds.json"
+	maxFeedBytes       = 5 * 1024 * 1024 // 单个订阅源最多下载 5MB
+	maxFeedSeen        = 500             // 每个订阅源最多记住的已读条目数
+	maxFeedItems       = 20              // fetch_new 默认每个订阅源最多返回的条目数
+	maxFeedSummaryChar = 300             // 条目摘要最多显示的字符数
+)
+
+// Feed 是一个订阅源
+type Feed struct {
+	URL         string    `json:"url"`                    // 订阅地址
+	Title       string    `json:"title"`                  // 订阅源标题
+	AddedAt     time.Time `json:"added_at"`               // 订阅时间
+	LastChecked time.Time `json:"last_checked,omitempty"` // 上次检查时间
+	LastError   string    `json:"last_error,omitempty"`   // 上次检查的错误
+	Seen        []string  `json:"seen"`                   // 已读条目的 ID（最新的在后面）
+}
+
+// feedsData 是 feeds.json 的内容
+type feedsData struct {
+	Feeds []*Feed `json:"feeds"`
+}
+
+// FeedItem 是订阅源中的一个条目
+type FeedItem struct {
+	ID        string
+	Title     string
+	Link      string
+	Published string
+	Summary   string
+}
+
+// FeedsTool 提供 RSS/Atom 订阅功能
+type FeedsTool struct {
+	BaseTool
+	workspace  string
+	httpClient *http.Client
+	mu         sync.Mutex // 保护 feeds.json 的读写
+}
+
+// NewFeedsTool 创建一个新的订阅工具
+// 参数:
+//
+//	workspace: 工作区目录路径（订阅保存在 workspace/feeds.json）
+//	timeout: 请求超时时间（秒）
+//
+// 返回:
+//
+//	配置好的FeedsTool实例
+func NewFeedsTool(workspace string, timeout int) *FeedsTool {
+	if timeout <= 0 {
+		timeout = 30
+	}
+
+	return &FeedsTool{
+		BaseTool: NewBaseTool(
+			"feeds",
+			"Monitor RSS/Atom feeds. Actions: subscribe, list, unsubscribe, fetch_new.\n\n"+
+				"- subscribe: add the feed at 'url'; existing entries are marked as seen, so only later entries count as new\n"+
+				"- list: show subscriptions and when they were last checked\n"+
+				"- unsubscribe: remove the feed at 'url'\n"+
+				"- fetch_new: return entries published since the last check (all feeds, or only 'url') and mark them as seen\n\n"+
+				"For a daily digest, schedule a cron job in agent mode, e.g. {\"action\":\"add\", \"mode\":\"agent\", \"cron_expr\":\"0 8 * * *\", \"command\":\"Use the feeds tool (fetch_new) and summarize the new items\"}.",
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"action": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"subscribe", "list", "unsubscribe", "fetch_new"},
+						"description": "Action to perform",
+					},
+					"url": map[string]interface{}{
+						"type":        "string",
+						"description": "Feed URL (for subscribe and unsubscribe; optional for fetch_new)",
+					},
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("Maximum new entries to return per feed (for fetch_new, default %d)", maxFeedItems),
+					},
+				},
+				"required": []string{"action"},
+			},
+		),
+		workspace: workspace,
+		httpClient: &http.Client{
+			Timeout: time.Duration(timeout) * time.Second,
+		},
+	}
+}
+
+// Execute 执行订阅操作
+// 参数:
+//
+//	ctx: 上下文对象
+//	params: 参数map，必须包含"action"，可选"url"和"limit"
+//
+// 返回:
+//
+//	操作结果
+func (t *FeedsTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	action, _ := params["action"].(string)
+	feedURL, _ := params["url"].(string)
+	feedURL = strings.TrimSpace(feedURL)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch action {
+	case "subscribe":
+		return t.subscribe(ctx, feedURL)
+	case "list":
+		return t.list()
+	case "unsubscribe":
+		return t.unsubscribe(feedURL)
+	case "fetch_new":
+		limit := maxFeedItems
+		if v, ok := params["limit"].(float64); ok && v > 0 {
+			limit = int(v)
+		}
+		return t.fetchNew(ctx, feedURL, limit)
+	default:
+		return "", fmt.Errorf("unknown action: %s", action)
+	}
+}
+
+// subscribe 添加订阅，当前已有的条目全部标记为已读
+func (t *FeedsTool) subscribe(ctx context.Context, feedURL string) (string, error) {
+	if feedURL == "" {
+		return "", fmt.Errorf("missing url parameter")
+	}
+	if !strings.Contains(feedURL, "://") {
+		feedURL = "https://" + feedURL
+	}
+
+	data, err := t.load()
+	if err != nil {
+		return "", err
+	}
+	if findFeed(data, feedURL) != nil {
+		return fmt.Sprintf("Already subscribed to %s", feedURL), nil
+	}
+
+	title, items, err := t.fetch(ctx, feedURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to read feed %s: %w", feedURL, err)
+	}
+
+	feed := &Feed{URL: feedURL, Title: title, AddedAt: time.Now(), LastChecked: time.Now()}
+	for i := len(items) - 1; i >= 0; i-- {
+		feed.markSeen(items[i].ID)
+	}
+	data.Feeds = append(data.Feeds, feed)
+	if err := t.save(data); err != nil {
+		return "", err
+	}
+
+	result := fmt.Sprintf("Subscribed to %s (%s), %d existing entries marked as seen.", feed.displayName(), feedURL, len(items))
+	if len(items) > 0 {
+		result += fmt.Sprintf("\nLatest: %s", items[0].Title)
+	}
+	return result, nil
+}
+
+// list 列出所有订阅
+func (t *FeedsTool) list() (string, error) {
+	data, err := t.load()
+	if err != nil {
+		return "", err
+	}
+	if len(data.Feeds) == 0 {
+		return "No feeds subscribed.", nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Subscribed feeds (%d):\n", len(data.Feeds))
+	for _, feed := range data.Feeds {
+		fmt.Fprintf(&sb, "- %s\n  %s\n", feed.displayName(), feed.URL)
+		if !feed.LastChecked.IsZero() {
+			fmt.Fprintf(&sb, "  last checked: %s\n", feed.LastChecked.Format("2006-01-02 15:04"))
+		}
+		if feed.LastError != "" {
+			fmt.Fprintf(&sb, "  last error: %s\n", feed.LastError)
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// unsubscribe 取消订阅
+func (t *FeedsTool) unsubscribe(feedURL string) (string, error) {
+	if feedURL == "" {
+		return "", fmt.Errorf("missing url parameter")
+	}
+	data, err := t.load()
+	if err != nil {
+		return "", err
+	}
+	for i, feed := range data.Feeds {
+		if feedURLMatches(feed.URL, feedURL) {
+			data.Feeds = append(data.Feeds[:i], data.Feeds[i+1:]...)
+			if err := t.save(data); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Unsubscribed from %s", feed.displayName()), nil
+		}
+	}
+	return "", fmt.Errorf("not subscribed to %s", feedURL)
+}
+
+// fetchNew 获取新条目并标记为已读
+// 某个订阅源失败时记录错误并继续检查其他订阅源
+func (t *FeedsTool) fetchNew(ctx context.Context, feedURL string, limit int) (string, error) {
+	data, err := t.load()
+	if err != nil {
+		return "", err
+	}
+
+	feeds := data.Feeds
+	if feedURL != "" {
+		feed := findFeed(data, feedURL)
+		if feed == nil {
+			return "", fmt.Errorf("not subscribed to %s", feedURL)
+		}
+		feeds = []*Feed{feed}
+	}
+	if len(feeds) == 0 {
+		return "No feeds subscribed. Use the subscribe action first.", nil
+	}
+
+	var sb strings.Builder
+	total := 0
+	for _, feed := range feeds {
+		title, items, err := t.fetch(ctx, feed.URL)
+		feed.LastChecked = time.Now()
+		if err != nil {
+			feed.LastError = err.Error()
+			fmt.Fprintf(&sb, "## %s\nError: %v\n\n", feed.displayName(), err)
+			continue
+		}
+		feed.LastError = ""
+		if title != "" {
+			feed.Title = title
+		}
+
+		var fresh []FeedItem
+		for _, item := range items {
+			if !feed.hasSeen(item.ID) {
+				fresh = append(fresh, item)
+			}
+		}
+		// 条目通常按从新到旧排列，标记时从旧到新，保证最新的条目最后被淘汰
+		for i := len(fresh) - 1; i >= 0; i-- {
+			feed.markSeen(fresh[i].ID)
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+
+		total += len(fresh)
+		fmt.Fprintf(&sb, "## %s (%d new)\n", feed.displayName(), len(fresh))
+		for i, item := range fresh {
+			if i >= limit {
+				fmt.Fprintf(&sb, "... and %d more\n", len(fresh)-limit)
+				break
+			}
+			writeFeedItem(&sb, item)
+		}
+		sb.WriteString("\n")
+	}
+
+	if err := t.save(data); err != nil {
+		return "", err
+	}
+	if total == 0 {
+		return strings.TrimSpace("No new entries.\n\n" + sb.String()), nil
+	}
+	return strings.TrimSpace(fmt.Sprintf("%d new entries:\n\n%s", total, sb.String())), nil
+}
+
+// writeFeedItem 输出一个条目
+func writeFeedItem(sb *strings.Builder, item FeedItem) {
+	fmt.Fprintf(sb, "- %s\n", item.Title)
+	if item.Link != "" {
+		fmt.Fprintf(sb, "  %s\n", item.Link)
+	}
+	if item.Published != "" {
+		fmt.Fprintf(sb, "  published: %s\n", item.Published)
+	}
+	if item.Summary != "" {
+		fmt.Fprintf(sb, "  %s\n", item.Summary)
+	}
+}
+
+// fetch 下载并解析订阅源
+// 返回: 订阅源标题，条目列表（保持源中的顺序），错误信息
+func (t *FeedsTool) fetch(ctx context.Context, feedURL string) (string, []FeedItem, error) {
+	target, err := url.Parse(feedURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return "", nil, fmt.Errorf("invalid url: only http and https URLs are supported")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", target.String(), nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; nanogrip/1.0; +https://github.com/Ailoc/nanogrip)")
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, text/xml;q=0.9, */*;q=0.5")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedBytes))
+	if err != nil {
+		return "", nil, err
+	}
+	return parseFeed(body, target)
+}
+
+// ===== 解析 =====
+
+// rssItem 是 RSS 2.0 / RSS 1.0 (RDF) 的条目
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Description string `xml:"description"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+// atomEntry 是 Atom 的条目
+type atomEntry struct {
+	Title string `xml:"title"`
+	ID    string `xml:"id"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+	Summary   string `xml:"summary"`
+	Content   string `xml:"content"`
+}
+
+// feedDocument 同时覆盖 RSS 2.0（rss/channel/item）、RSS 1.0（rdf:RDF/item）和 Atom（feed/entry）
+type feedDocument struct {
+	XMLName xml.Name
+	Title   string `xml:"title"`
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// parseFeed 解析 RSS 或 Atom 文档
+func parseFeed(body []byte, base *url.URL) (string, []FeedItem, error) {
+	var doc feedDocument
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.Strict = false
+	dec.CharsetReader = feedCharsetReader
+	if err := dec.Decode(&doc); err != nil {
+		return "", nil, fmt.Errorf("not a valid RSS/Atom feed: %w", err)
+	}
+
+	var items []FeedItem
+	title := strings.TrimSpace(doc.Channel.Title)
+	switch {
+	case len(doc.Entries) > 0 || strings.EqualFold(doc.XMLName.Local, "feed"):
+		title = strings.TrimSpace(doc.Title)
+		for _, e := range doc.Entries {
+			link := ""
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			if link == "" && len(e.Links) > 0 {
+				link = e.Links[0].Href
+			}
+			published := e.Published
+			if published == "" {
+				published = e.Updated
+			}
+			summary := e.Summary
+			if summary == "" {
+				summary = e.Content
+			}
+			items = append(items, newFeedItem(e.ID, e.Title, link, published, summary, base))
+		}
+	default:
+		rssItems := doc.Channel.Items
+		if len(rssItems) == 0 {
+			rssItems = doc.Items
+			if title == "" {
+				title = strings.TrimSpace(doc.Title)
+			}
+		}
+		if len(rssItems) == 0 && doc.Channel.Title == "" && !strings.EqualFold(doc.XMLName.Local, "rss") && !strings.EqualFold(doc.XMLName.Local, "RDF") {
+			return "", nil, fmt.Errorf("not a valid RSS/Atom feed: unexpected root element <%s>", doc.XMLName.Local)
+		}
+		for _, it := range rssItems {
+			published := it.PubDate
+			if published == "" {
+				published = it.Date
+			}
+			summary := it.Description
+			if summary == "" {
+				summary = it.Content
+			}
+			items = append(items, newFeedItem(it.GUID, it.Title, it.Link, published, summary, base))
+		}
+	}
+	return title, items, nil
+}
+
+// newFeedItem 整理一个条目：解析相对链接、把 HTML 摘要转为纯文本，缺少 ID 时用链接或标题代替
+func newFeedItem(id, title, link, published, summary string, base *url.URL) FeedItem {
+	link = strings.TrimSpace(link)
+	if u, err := base.Parse(link); err == nil && link != "" {
+		link = u.String()
+	}
+
+	item := FeedItem{
+		ID:        strings.TrimSpace(id),
+		Title:     strings.Join(strings.Fields(title), " "),
+		Link:      link,
+		Published: strings.TrimSpace(published),
+		Summary:   strings.Join(strings.Fields(parseHTML(summary).textContent()), " "),
+	}
+	if item.Title == "" {
+		item.Title = "(untitled)"
+	}
+	if runes := []rune(item.Summary); len(runes) > maxFeedSummaryChar {
+		item.Summary = string(runes[:maxFeedSummaryChar]) + "..."
+	}
+	if item.ID == "" {
+		item.ID = item.Link
+	}
+	if item.ID == "" {
+		item.ID = item.Title + "|" + item.Published
+	}
+	return item
+}
+
+// feedCharsetReader 支持非 UTF-8 编码的订阅源
+// ISO-8859-1 按字节转换，其他编码原样读取（大部分内容仍然可读）
+func feedCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "latin-1":
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return strings.NewReader(string(runes)), nil
+	default:
+		return input, nil
+	}
+}
+
+// ===== 存储 =====
+
+// load 读取 feeds.json，文件不存在时返回空列表
+func (t *FeedsTool) load() (*feedsData, error) {
+	data := &feedsData{}
+	raw, err := os.ReadFile(filepath.Join(t.workspace, feedsFileName))
+	if os.IsNotExist(err) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, data); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", feedsFileName, err)
+	}
+	return data, nil
+}
+
+// save 写入 feeds.json
+func (t *FeedsTool) save(data *feedsData) error {
+	return atomicWriteJSON(filepath.Join(t.workspace, feedsFileName), data)
+}
+
+// findFeed 按 URL 查找订阅
+func findFeed(data *feedsData, feedURL string) *Feed {
+	for _, feed := range data.Feeds {
+		if feedURLMatches(feed.URL, feedURL) {
+			return feed
+		}
+	}
+	return nil
+}
+
+// feedURLMatches 比较订阅地址，忽略协议前缀和末尾的斜杠
+func feedURLMatches(a, b string) bool {
+	normalize := func(s string) string {
+		s = strings.TrimSpace(s)
+		s = strings.TrimPrefix(s, "https://")
+		s = strings.TrimPrefix(s, "http://")
+		return strings.TrimRight(s, "/")
+	}
+	return normalize(a) == normalize(b)
+}
+
+// displayName 返回订阅源的显示名称
+func (f *Feed) displayName() string {
+	if f.Title != "" {
+		return f.Title
+	}
+	return f.URL
+}
+
+// hasSeen 判断条目是否已读
+func (f *Feed) hasSeen(id string) bool {
+	for _, seen := range f.Seen {
+		if seen == id {
+			return true
+		}
+	}
+	return false
+}
+
+// markSeen 记录已读条目，超过上限时淘汰最早的记录
+func (f *Feed) markSeen(id string) {
+	if f.hasSeen(id) {
+		return
+	}
+	f.Seen = append(f.Seen, id)
+	if len(f.Seen) > maxFeedSeen {
+		f.Seen = f.Seen[len(f.Seen)-maxFeedSeen:]
+	}
+}
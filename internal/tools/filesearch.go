@@ -0,0 +1,451 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// filesearch.go - 文件系统工具的搜索和编辑操作
+// 此文件实现了 glob（按模式查找文件）、grep（搜索文件内容）和 patch（编辑文件）
+// 这些操作都经过 resolvePath 的工作区检查，比通过 shell 调用 grep/sed 更安全
+
+const (
+	maxGlobResults = 200             // glob 最多返回的文件数
+	maxGrepMatches = 200             // grep 最多返回的匹配行数
+	maxGrepFile    = 2 * 1024 * 1024 // grep 跳过超过此大小的文件
+	maxGrepLine    = 300             // grep 输出中每行最多显示的字符数
+)
+
+// skipSearchDirs 搜索时跳过的目录
+var skipSearchDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	".venv":        true,
+	"__pycache__":  true,
+}
+
+// glob 查找 root 下匹配 pattern 的文件
+// pattern 支持 ** 匹配任意层级目录，例如 "**/*.go"、"docs/**/README.md"
+// 参数:
+//
+//	ctx: 上下文对象（用于取消长时间遍历）
+//	root: 搜索的根目录
+//	pattern: glob 模式（相对于 root）
+//
+// 返回:
+//
+//	匹配的文件路径列表（相对于 root）
+func (t *FilesystemTool) glob(ctx context.Context, root, pattern string) (string, error) {
+	pattern = filepath.ToSlash(pattern)
+	if _, err := filepath.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return "", fmt.Errorf("invalid glob pattern: %w", err)
+	}
+
+	var matches []string
+	truncated := false
+	err := walkFiles(ctx, root, func(path, rel string) error {
+		if matchGlob(pattern, rel) {
+			if len(matches) >= maxGlobResults {
+				truncated = true
+				return filepath.SkipAll
+			}
+			matches = append(matches, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(matches) == 0 {
+		return fmt.Sprintf("No files matching '%s' under %s", pattern, root), nil
+	}
+
+	sort.Strings(matches)
+	result := strings.Join(matches, "\n")
+	if truncated {
+		result += fmt.Sprintf("\n... (showing first %d matches; narrow the pattern)", maxGlobResults)
+	}
+	return result, nil
+}
+
+// grep 在 root 下的文件中搜索正则表达式
+// 参数:
+//
+//	ctx: 上下文对象
+//	root: 搜索的根目录或单个文件
+//	pattern: 正则表达式
+//	include: 文件名过滤 glob（为空表示所有文件）
+//	ignoreCase: 是否忽略大小写
+//
+// 返回:
+//
+//	"文件:行号: 内容" 格式的匹配结果
+func (t *FilesystemTool) grep(ctx context.Context, root, pattern, include string, ignoreCase bool) (string, error) {
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regular expression: %w", err)
+	}
+
+	var results []string
+	truncated := false
+	err = walkFiles(ctx, root, func(path, rel string) error {
+		if include != "" && !matchGlob(filepath.ToSlash(include), filepath.Base(rel)) && !matchGlob(filepath.ToSlash(include), rel) {
+			return nil
+		}
+
+		fileMatches, err := grepFile(path, re)
+		if err != nil {
+			return nil // 无法读取的文件直接跳过
+		}
+		for _, m := range fileMatches {
+			if len(results) >= maxGrepMatches {
+				truncated = true
+				return filepath.SkipAll
+			}
+			results = append(results, rel+":"+m)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(results) == 0 {
+		return fmt.Sprintf("No matches for '%s' under %s", pattern, root), nil
+	}
+
+	result := strings.Join(results, "\n")
+	if truncated {
+		result += fmt.Sprintf("\n... (showing first %d matches; narrow the pattern or use include)", maxGrepMatches)
+	}
+	return result, nil
+}
+
+// grepFile 在单个文件中搜索，跳过二进制文件和过大的文件
+// 返回 "行号: 内容" 格式的匹配列表
+func grepFile(path string, re *regexp.Regexp) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxGrepFile {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	head := data
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, nil // 二进制文件
+	}
+
+	var matches []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxGrepFile)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if !re.MatchString(line) {
+			continue
+		}
+		if len(line) > maxGrepLine {
+			line = line[:maxGrepLine] + "..."
+		}
+		matches = append(matches, fmt.Sprintf("%d: %s", lineNo, line))
+	}
+	return matches, scanner.Err()
+}
+
+// walkFiles 遍历 root 下的所有普通文件
+// root 本身是文件时只回调一次；跳过 skipSearchDirs 中的目录
+// 回调参数为文件的绝对路径和相对于 root 的路径（使用 / 分隔）
+func walkFiles(ctx context.Context, root string, fn func(path, rel string) error) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fn(root, filepath.Base(root))
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // 跳过无权限的目录
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if path != root && skipSearchDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		return fn(path, filepath.ToSlash(rel))
+	})
+	if err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// matchGlob 判断相对路径是否匹配 glob 模式
+// 在 filepath.Match 的基础上支持 "**" 匹配零个或多个目录层级
+// 不含 "/" 的模式（如 "*.go"）匹配任意层级下的文件名
+func matchGlob(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") && !strings.Contains(pattern, "**") {
+		ok, _ := filepath.Match(pattern, filepath.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments 逐段匹配路径
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// ** 可以匹配零个或多个路径段
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		parts = parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// patch 编辑文件
+// 支持两种方式：
+//  1. old_string/new_string：精确替换（old_string 必须恰好出现一次）
+//  2. diff：应用统一差异格式（unified diff）的补丁
+//
+// 参数:
+//
+//	path: 文件的绝对路径
+//	params: 工具参数
+//
+// 返回:
+//
+//	编辑结果描述
+func (t *FilesystemTool) patch(path string, params map[string]interface{}) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	original := string(data)
+
+	var updated string
+	if diff, _ := params["diff"].(string); diff != "" {
+		updated, err = applyUnifiedDiff(original, diff)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		oldString, ok := params["old_string"].(string)
+		if !ok || oldString == "" {
+			return "", fmt.Errorf("patch requires either 'diff' or 'old_string'")
+		}
+		newString, _ := params["new_string"].(string)
+
+		switch count := strings.Count(original, oldString); count {
+		case 0:
+			return "", fmt.Errorf("old_string not found in %s", path)
+		case 1:
+			updated = strings.Replace(original, oldString, newString, 1)
+		default:
+			return "", fmt.Errorf("old_string occurs %d times in %s; include more surrounding context to make it unique", count, path)
+		}
+	}
+
+	if updated == original {
+		return fmt.Sprintf("No changes made to %s", path), nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(updated), info.Mode().Perm()); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("File patched successfully: %s (%d -> %d bytes)", path, len(original), len(updated)), nil
+}
+
+// diffHunk 表示统一差异格式中的一个块
+type diffHunk struct {
+	oldStart int      // 原文件起始行号（从 1 开始）
+	oldLines []string // 上下文行和删除行
+	newLines []string // 上下文行和新增行
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// applyUnifiedDiff 将统一差异格式的补丁应用到文本
+// 行号只作为定位提示：每个块会在原文中查找与其上下文完全一致的位置（优先选择离提示行号最近的位置），
+// 因此模型给出的行号略有偏差时也能正确应用
+func applyUnifiedDiff(original, diff string) (string, error) {
+	hunks, err := parseUnifiedDiff(diff)
+	if err != nil {
+		return "", err
+	}
+
+	trailingNewline := strings.HasSuffix(original, "\n")
+	lines := strings.Split(strings.TrimSuffix(original, "\n"), "\n")
+	if original == "" {
+		lines = nil
+	}
+
+	offset := 0 // 已应用的块造成的行数变化
+	cursor := 0 // 下一个块只能出现在此行之后
+	for i, hunk := range hunks {
+		expected := hunk.oldStart - 1 + offset
+		pos := findHunk(lines, hunk.oldLines, cursor, expected)
+		if pos < 0 {
+			return "", fmt.Errorf("hunk %d (at line %d) does not match the file content", i+1, hunk.oldStart)
+		}
+
+		merged := make([]string, 0, len(lines)-len(hunk.oldLines)+len(hunk.newLines))
+		merged = append(merged, lines[:pos]...)
+		merged = append(merged, hunk.newLines...)
+		merged = append(merged, lines[pos+len(hunk.oldLines):]...)
+		lines = merged
+
+		offset += len(hunk.newLines) - len(hunk.oldLines)
+		cursor = pos + len(hunk.newLines)
+	}
+
+	result := strings.Join(lines, "\n")
+	if trailingNewline || original == "" {
+		result += "\n"
+	}
+	return result, nil
+}
+
+// parseUnifiedDiff 解析统一差异格式
+// 忽略 "---"、"+++" 文件头和 "\ No newline at end of file" 标记
+func parseUnifiedDiff(diff string) ([]diffHunk, error) {
+	var hunks []diffHunk
+	var current *diffHunk
+
+	for _, line := range strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n") {
+		if m := hunkHeader.FindStringSubmatch(line); m != nil {
+			hunks = append(hunks, diffHunk{})
+			current = &hunks[len(hunks)-1]
+			fmt.Sscanf(m[1], "%d", &current.oldStart)
+			continue
+		}
+		if current == nil || strings.HasPrefix(line, `\`) {
+			continue
+		}
+		if strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "+"):
+			current.newLines = append(current.newLines, line[1:])
+		case strings.HasPrefix(line, "-"):
+			current.oldLines = append(current.oldLines, line[1:])
+		case strings.HasPrefix(line, " "):
+			current.oldLines = append(current.oldLines, line[1:])
+			current.newLines = append(current.newLines, line[1:])
+		case line == "":
+			// 某些编辑器会去掉空上下文行前面的空格
+			current.oldLines = append(current.oldLines, "")
+			current.newLines = append(current.newLines, "")
+		default:
+			return nil, fmt.Errorf("invalid diff line: %q", line)
+		}
+	}
+
+	// 去掉因 diff 末尾换行产生的多余空上下文行
+	for i := range hunks {
+		h := &hunks[i]
+		for len(h.oldLines) > 0 && len(h.newLines) > 0 &&
+			h.oldLines[len(h.oldLines)-1] == "" && h.newLines[len(h.newLines)-1] == "" {
+			h.oldLines = h.oldLines[:len(h.oldLines)-1]
+			h.newLines = h.newLines[:len(h.newLines)-1]
+		}
+	}
+
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("no hunks found in diff (expected lines starting with @@)")
+	}
+	return hunks, nil
+}
+
+// findHunk 在 lines[from:] 中查找与 block 完全一致的位置
+// 有多个位置时返回离 expected 最近的一个；找不到返回 -1
+func findHunk(lines, block []string, from, expected int) int {
+	if len(block) == 0 {
+		// 纯新增的块：直接使用提示行号
+		if expected < from {
+			expected = from
+		}
+		if expected > len(lines) {
+			expected = len(lines)
+		}
+		return expected
+	}
+
+	best := -1
+	for pos := from; pos+len(block) <= len(lines); pos++ {
+		match := true
+		for j, l := range block {
+			if lines[pos+j] != l {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		if best < 0 || abs(pos-expected) < abs(best-expected) {
+			best = pos
+		}
+	}
+	return best
+}
+
+// abs 返回整数的绝对值
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/paths"
 )
 
 // filesystem.go - 文件系统操作工具
@@ -18,6 +20,14 @@ type FilesystemTool struct {
 	BaseTool
 	workspace string // 工作区目录路径
 	restrict  bool   // 是否限制操作仅在工作区内
+
+	roots []AllowedRoot // 限制在工作区内时，额外允许访问的目录
+}
+
+// AllowedRoot 是限制在工作区内时额外允许访问的目录
+type AllowedRoot struct {
+	Path  string // 目录路径（支持 ~/ 开头）
+	Write bool   // 是否允许写入和删除（否则只读）
 }
 
 // NewFilesystemTool 创建一个新的文件系统工具
@@ -33,22 +43,60 @@ func NewFilesystemTool(workspace string, restrict bool) *FilesystemTool {
 	return &FilesystemTool{
 		BaseTool: NewBaseTool(
 			"filesystem",
-			"Perform file operations (read, write, list, delete)",
+			"Perform file operations (read, write, list, delete, exists, glob, grep, patch).\n\n"+
+				"- read: return the file content; use 'offset' and 'limit' to read only a range of lines from large files\n"+
+				"- glob: find files under 'path' matching 'pattern' (supports ** for any depth, e.g. '**/*.go')\n"+
+				"- grep: search file contents under 'path' for the regular expression 'pattern', optionally only in files matching 'include'; returns file:line: text\n"+
+				"- patch: edit the file at 'path' either by replacing 'old_string' (must occur exactly once) with 'new_string', or by applying a unified 'diff'\n"+
+				"Prefer these operations over shell grep/find/sed.",
 			map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
 					"operation": map[string]interface{}{
 						"type":        "string",
-						"description": "Operation to perform: read, write, list, delete, exists",
+						"enum":        []string{"read", "write", "list", "delete", "exists", "glob", "grep", "patch"},
+						"description": "Operation to perform: read, write, list, delete, exists, glob, grep, patch",
 					},
 					"path": map[string]interface{}{
 						"type":        "string",
-						"description": "File or directory path",
+						"description": "File or directory path (the base directory for glob and grep)",
 					},
 					"content": map[string]interface{}{
 						"type":        "string",
 						"description": "Content to write (for write operation)",
 					},
+					"pattern": map[string]interface{}{
+						"type":        "string",
+						"description": "Glob pattern (for glob) or regular expression (for grep)",
+					},
+					"offset": map[string]interface{}{
+						"type":        "integer",
+						"description": "First line to read, starting at 1 (for read)",
+					},
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": "Maximum number of lines to read (for read)",
+					},
+					"include": map[string]interface{}{
+						"type":        "string",
+						"description": "Only search files whose name matches this glob, e.g. '*.go' (for grep)",
+					},
+					"ignore_case": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Case-insensitive search (for grep)",
+					},
+					"old_string": map[string]interface{}{
+						"type":        "string",
+						"description": "Exact text to replace; must occur exactly once in the file (for patch)",
+					},
+					"new_string": map[string]interface{}{
+						"type":        "string",
+						"description": "Replacement text (for patch)",
+					},
+					"diff": map[string]interface{}{
+						"type":        "string",
+						"description": "Unified diff to apply to the file (for patch, instead of old_string/new_string)",
+					},
 				},
 				"required": []string{"operation", "path"},
 			},
@@ -58,6 +106,14 @@ func NewFilesystemTool(workspace string, restrict bool) *FilesystemTool {
 	}
 }
 
+// SetAllowedRoots 设置限制在工作区内时额外允许访问的目录
+// 参数:
+//
+//	roots: 允许访问的目录及其读写权限
+func (t *FilesystemTool) SetAllowedRoots(roots []AllowedRoot) {
+	t.roots = roots
+}
+
 // Execute 执行文件系统操作
 // 根据operation参数执行相应的文件操作
 // 参数:
@@ -81,8 +137,9 @@ func (t *FilesystemTool) Execute(ctx context.Context, params map[string]interfac
 		return "", fmt.Errorf("missing path parameter")
 	}
 
-	// 解析路径（处理相对路径和工作区限制）
-	resolvedPath, err := t.resolvePath(path)
+	// 解析路径（处理相对路径和工作区限制），写入、删除和修改需要写权限
+	write := operation == "write" || operation == "delete" || operation == "patch"
+	resolvedPath, err := t.resolvePathFor(path, write)
 	if err != nil {
 		return "", err
 	}
@@ -90,6 +147,11 @@ func (t *FilesystemTool) Execute(ctx context.Context, params map[string]interfac
 	// 根据操作类型执行相应功能
 	switch operation {
 	case "read":
+		offset, _ := params["offset"].(float64)
+		limit, _ := params["limit"].(float64)
+		if offset > 0 || limit > 0 {
+			return t.readLines(resolvedPath, int(offset), int(limit))
+		}
 		return t.readFile(resolvedPath)
 	case "write":
 		content, _ := params["content"].(string)
@@ -103,14 +165,8 @@ func (t *FilesystemTool) Execute(ctx context.Context, params map[string]interfac
 	case "list":
 		return t.listDir(resolvedPath)
 	case "delete":
-		if t.restrict {
-			absWorkspace, err := filepath.Abs(t.workspace)
-			if err != nil {
-				return "", err
-			}
-			if resolvedPath == absWorkspace {
-				return "", fmt.Errorf("refusing to delete workspace root: %s", resolvedPath)
-			}
+		if t.restrict && t.isRoot(resolvedPath) {
+			return "", fmt.Errorf("refusing to delete the workspace or an allowed root directory: %s", resolvedPath)
 		}
 		err := t.deletePath(resolvedPath)
 		if err != nil {
@@ -120,12 +176,28 @@ func (t *FilesystemTool) Execute(ctx context.Context, params map[string]interfac
 		return fmt.Sprintf("File deleted successfully: %s", resolvedPath), nil
 	case "exists":
 		return fmt.Sprintf("%v", t.exists(resolvedPath)), nil
+	case "glob":
+		pattern, _ := params["pattern"].(string)
+		if pattern == "" {
+			return "", fmt.Errorf("missing pattern parameter")
+		}
+		return t.glob(ctx, resolvedPath, pattern)
+	case "grep":
+		pattern, _ := params["pattern"].(string)
+		if pattern == "" {
+			return "", fmt.Errorf("missing pattern parameter")
+		}
+		include, _ := params["include"].(string)
+		ignoreCase, _ := params["ignore_case"].(bool)
+		return t.grep(ctx, resolvedPath, pattern, include, ignoreCase)
+	case "patch":
+		return t.patch(resolvedPath, params)
 	default:
 		return "", fmt.Errorf("unknown operation: %s", operation)
 	}
 }
 
-// resolvePath 解析路径，处理相对路径和工作区限制
+// resolvePath 解析路径，处理相对路径和工作区限制（只读访问）
 // 将相对路径转换为绝对路径，并检查是否在工作区内（如果启用了限制）
 // 参数:
 //
@@ -135,14 +207,25 @@ func (t *FilesystemTool) Execute(ctx context.Context, params map[string]interfac
 //
 //	解析后的绝对路径，如果违反限制则返回错误
 func (t *FilesystemTool) resolvePath(path string) (string, error) {
+	return t.resolvePathFor(path, false)
+}
+
+// resolvePathFor 解析路径并检查访问权限
+// 启用工作区限制时，按解析符号链接和 ".." 之后的真实路径检查：
+// 路径必须位于工作区或 roots 中的目录内，写入时对应的目录必须允许写入。
+// 工作区内指向外部的符号链接因此无法绕过限制。
+// 参数:
+//
+//	path: 原始路径
+//	write: 是否需要写权限（写入、删除、修改）
+//
+// 返回:
+//
+//	解析后的绝对路径（启用限制时为真实路径），如果违反限制则返回错误
+func (t *FilesystemTool) resolvePathFor(path string, write bool) (string, error) {
 	// 展开用户主目录
-	if strings.HasPrefix(path, "~/") {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", err
-		}
-		path = filepath.Join(home, path[2:])
-	} else if !filepath.IsAbs(path) {
+	path = expandHomePath(path)
+	if !filepath.IsAbs(path) {
 		// 相对路径 - 使用工作区
 		path = filepath.Join(t.workspace, path)
 	}
@@ -152,20 +235,92 @@ func (t *FilesystemTool) resolvePath(path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if !t.restrict {
+		return absPath, nil
+	}
 
-	// 检查工作区限制
-	if t.restrict {
-		absWorkspace, err := filepath.Abs(t.workspace)
-		if err != nil {
-			return "", err
+	// 检查工作区限制（使用真实路径，防止通过符号链接访问外部文件）
+	realPath, err := canonicalPath(absPath)
+	if err != nil {
+		return "", err
+	}
+	if workspace, err := canonicalPath(t.workspace); err == nil && isWithin(workspace, realPath) {
+		return realPath, nil
+	}
+	readOnlyMatch := ""
+	for _, root := range t.roots {
+		rootPath, err := canonicalPath(expandHomePath(root.Path))
+		if err != nil || !isWithin(rootPath, realPath) {
+			continue
 		}
-		rel, err := filepath.Rel(absWorkspace, absPath)
-		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) || filepath.IsAbs(rel) {
-			return "", fmt.Errorf("path '%s' is outside workspace", path)
+		if !write || root.Write {
+			return realPath, nil
 		}
+		readOnlyMatch = root.Path
+	}
+	if readOnlyMatch != "" {
+		return "", fmt.Errorf("path '%s' is in a read-only allowed path (%s)", path, readOnlyMatch)
 	}
+	return "", fmt.Errorf("path '%s' is outside workspace", path)
+}
 
-	return absPath, nil
+// isRoot 判断路径是否为工作区或允许访问的目录本身（不允许删除）
+func (t *FilesystemTool) isRoot(path string) bool {
+	for _, root := range append([]string{t.workspace}, rootPaths(t.roots)...) {
+		if rootPath, err := canonicalPath(expandHomePath(root)); err == nil && rootPath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// rootPaths 返回允许访问的目录路径
+func rootPaths(roots []AllowedRoot) []string {
+	paths := make([]string, 0, len(roots))
+	for _, root := range roots {
+		paths = append(paths, root.Path)
+	}
+	return paths
+}
+
+// expandHomePath 展开 ~/ 开头的路径
+func expandHomePath(path string) string {
+	return paths.ExpandHome(path)
+}
+
+// canonicalPath 返回解析符号链接后的绝对路径
+// 路径不存在时（例如要创建的新文件）解析已存在的上级目录，再拼接剩余部分；
+// 指向不存在目标的符号链接会返回错误，避免写入时跟随链接写到外部
+func canonicalPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	if info, lerr := os.Lstat(path); lerr == nil && info.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("path '%s' is a symlink to a missing target", path)
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+	resolvedParent, err := canonicalPath(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolvedParent, filepath.Base(path)), nil
+}
+
+// isWithin 判断 path 是否为 root 或位于 root 之内（两者都应为真实路径）
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) && !filepath.IsAbs(rel)
 }
 
 // readFile 读取文件内容
@@ -184,6 +339,35 @@ func (t *FilesystemTool) readFile(path string) (string, error) {
 	return string(data), nil
 }
 
+// readLines 读取文件中的一段行，结果以 "[Lines a-b of n]" 开头，方便模型继续往后读
+// 参数:
+//
+//	path: 文件的绝对路径
+//	offset: 起始行号（从 1 开始，<= 0 表示第 1 行）
+//	limit: 最多读取的行数（<= 0 表示读到文件末尾）
+func (t *FilesystemTool) readLines(path string, offset, limit int) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if offset <= 0 {
+		offset = 1
+	}
+	if offset > len(lines) {
+		return fmt.Sprintf("[%s has %d lines; offset %d is past the end]", path, len(lines), offset), nil
+	}
+	end := len(lines)
+	if limit > 0 && offset-1+limit < end {
+		end = offset - 1 + limit
+	}
+	header := fmt.Sprintf("[Lines %d-%d of %d]\n", offset, end, len(lines))
+	return header + strings.Join(lines[offset-1:end], ""), nil
+}
+
 // writeFile 写入内容到文件
 // 如果文件所在目录不存在，会自动创建目录
 // 参数:
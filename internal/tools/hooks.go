@@ -0,0 +1,83 @@
+package tools
+
+// hooks.go - 工具执行钩子
+// 钩子让集成方在不修改各个工具实现的情况下，在每次工具调用前后插入自己的逻辑，
+// 例如审计日志、从工具输出中去除密钥、统计指标或额外的权限检查。
+// 钩子按添加顺序执行；注册表的所有视图（Scoped）共享同一组钩子。
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PreHook 在工具执行前调用
+// 返回非 nil 的错误时工具不会执行，错误信息作为结果返回给模型
+// 参数:
+//
+//	ctx: 工具调用的上下文（包含 ToolContext 和追踪 ID）
+//	name: 工具名称
+//	params: 工具参数（钩子不应修改）
+type PreHook func(ctx context.Context, name string, params map[string]interface{}) error
+
+// PostHook 在工具调用结束后调用（包括被拒绝或执行失败的调用），返回值替换原结果
+// 参数:
+//
+//	ctx: 工具调用的上下文
+//	name: 工具名称
+//	params: 工具参数
+//	result: 返回给模型的结果（或上一个钩子修改后的结果）
+//	err: 调用失败的原因（包括被拦截、被拒绝等没有执行的调用），成功时为 nil
+//	elapsed: 调用耗时（包括等待用户确认的时间）
+type PostHook func(ctx context.Context, name string, params map[string]interface{}, result string, err error, elapsed time.Duration) string
+
+// toolHooks 保存注册表的钩子
+type toolHooks struct {
+	mu   sync.RWMutex
+	pre  []PreHook
+	post []PostHook
+}
+
+// AddPreHook 添加一个工具执行前的钩子
+func (r *ToolRegistry) AddPreHook(hook PreHook) {
+	r.hooks.mu.Lock()
+	defer r.hooks.mu.Unlock()
+	r.hooks.pre = append(r.hooks.pre, hook)
+}
+
+// AddPostHook 添加一个工具执行后的钩子
+func (r *ToolRegistry) AddPostHook(hook PostHook) {
+	r.hooks.mu.Lock()
+	defer r.hooks.mu.Unlock()
+	r.hooks.post = append(r.hooks.post, hook)
+}
+
+// runPreHooks 依次调用执行前的钩子
+// 返回:
+//
+//	空字符串表示允许执行，否则为返回给模型的错误信息
+func (h *toolHooks) runPreHooks(ctx context.Context, name string, params map[string]interface{}) string {
+	h.mu.RLock()
+	hooks := h.pre
+	h.mu.RUnlock()
+
+	for _, hook := range hooks {
+		if err := hook(ctx, name, params); err != nil {
+			return fmt.Sprintf(`Error: Tool '%s' was blocked: %v`, name, err)
+		}
+	}
+	return ""
+}
+
+// runPostHooks 依次调用执行后的钩子，返回最终的结果
+func (h *toolHooks) runPostHooks(ctx context.Context, name string, params map[string]interface{}, result string, err error, elapsed time.Duration) string {
+	h.mu.RLock()
+	hooks := h.post
+	h.mu.RUnlock()
+
+	for _, hook := range hooks {
+		result = hook(ctx, name, params, result, err, elapsed)
+	}
+	return result
+}
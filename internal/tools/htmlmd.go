@@ -0,0 +1,758 @@
+package tools
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// htmlmd.go - HTML 解析与 Markdown 转换
+// 此文件实现了一个宽松的 HTML 解析器（容忍未闭合标签等常见错误）、
+// 简单的 CSS 选择器匹配，以及去除页面样板内容后转换为 Markdown 的功能，供 web_fetch 工具使用
+
+// htmlNode 是解析后的 HTML 节点
+type htmlNode struct {
+	tag      string            // 标签名（小写），文本节点为空
+	text     string            // 文本节点的内容（已反转义）
+	attrs    map[string]string // 属性
+	children []*htmlNode       // 子节点
+	parent   *htmlNode         // 父节点
+}
+
+// voidElements 没有结束标签的元素
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// rawTextElements 内容不按 HTML 解析的元素
+var rawTextElements = map[string]bool{
+	"script": true, "style": true, "textarea": true,
+}
+
+// autoClose 打开某个标签时会隐式关闭的标签
+var autoClose = map[string][]string{
+	"li": {"li"},
+	"dt": {"dt", "dd"},
+	"dd": {"dt", "dd"},
+	"tr": {"tr", "td", "th"},
+	"td": {"td", "th"},
+	"th": {"td", "th"},
+	"p":  {"p"},
+}
+
+// blockClosesP 打开这些块级标签时会隐式关闭 <p>
+var blockClosesP = map[string]bool{
+	"div": true, "ul": true, "ol": true, "table": true, "pre": true, "blockquote": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"section": true, "article": true, "header": true, "footer": true, "hr": true,
+}
+
+// parseHTML 解析 HTML 文档
+// 返回虚拟根节点（tag 为 "#root"）
+func parseHTML(src string) *htmlNode {
+	root := &htmlNode{tag: "#root"}
+	stack := []*htmlNode{root}
+	top := func() *htmlNode { return stack[len(stack)-1] }
+
+	appendText := func(text string) {
+		if text == "" {
+			return
+		}
+		parent := top()
+		parent.children = append(parent.children, &htmlNode{text: html.UnescapeString(text), parent: parent})
+	}
+
+	lower := strings.ToLower(src)
+	i := 0
+	for i < len(src) {
+		lt := strings.IndexByte(src[i:], '<')
+		if lt < 0 {
+			appendText(src[i:])
+			break
+		}
+		appendText(src[i : i+lt])
+		i += lt
+
+		switch {
+		case strings.HasPrefix(src[i:], "<!--"):
+			end := strings.Index(src[i+4:], "-->")
+			if end < 0 {
+				return root
+			}
+			i += 4 + end + 3
+			continue
+		case strings.HasPrefix(src[i:], "<!") || strings.HasPrefix(src[i:], "<?"):
+			end := strings.IndexByte(src[i:], '>')
+			if end < 0 {
+				return root
+			}
+			i += end + 1
+			continue
+		case strings.HasPrefix(src[i:], "</"):
+			end := strings.IndexByte(src[i:], '>')
+			if end < 0 {
+				return root
+			}
+			name := strings.ToLower(strings.TrimSpace(src[i+2 : i+end]))
+			i += end + 1
+			// 关闭最近的同名元素（忽略没有对应开始标签的结束标签）
+			for j := len(stack) - 1; j > 0; j-- {
+				if stack[j].tag == name {
+					stack = stack[:j]
+					break
+				}
+			}
+			continue
+		}
+
+		// 开始标签
+		name, attrs, selfClosing, next := parseStartTag(src, i)
+		if name == "" {
+			appendText("<")
+			i++
+			continue
+		}
+		i = next
+
+		// 隐式关闭
+		for {
+			t := top().tag
+			closes := false
+			for _, c := range autoClose[name] {
+				if t == c {
+					closes = true
+				}
+			}
+			if t == "p" && blockClosesP[name] {
+				closes = true
+			}
+			if !closes || len(stack) == 1 {
+				break
+			}
+			stack = stack[:len(stack)-1]
+		}
+
+		parent := top()
+		node := &htmlNode{tag: name, attrs: attrs, parent: parent}
+		parent.children = append(parent.children, node)
+
+		if rawTextElements[name] {
+			end := strings.Index(lower[i:], "</"+name)
+			if end < 0 {
+				end = len(src) - i
+			}
+			node.children = append(node.children, &htmlNode{text: src[i : i+end], parent: node})
+			i += end
+			if gt := strings.IndexByte(src[i:], '>'); gt >= 0 {
+				i += gt + 1
+			}
+			continue
+		}
+
+		if !selfClosing && !voidElements[name] {
+			stack = append(stack, node)
+		}
+	}
+
+	return root
+}
+
+// parseStartTag 解析从 src[i] 开始的开始标签
+// 返回标签名、属性、是否自闭合以及标签之后的位置；不是合法标签时返回空标签名
+func parseStartTag(src string, i int) (string, map[string]string, bool, int) {
+	j := i + 1
+	for j < len(src) && (isTagNameChar(src[j])) {
+		j++
+	}
+	if j == i+1 {
+		return "", nil, false, i
+	}
+	name := strings.ToLower(src[i+1 : j])
+	attrs := make(map[string]string)
+
+	for j < len(src) {
+		for j < len(src) && isSpace(src[j]) {
+			j++
+		}
+		if j >= len(src) {
+			break
+		}
+		if src[j] == '>' {
+			return name, attrs, false, j + 1
+		}
+		if strings.HasPrefix(src[j:], "/>") {
+			return name, attrs, true, j + 2
+		}
+
+		// 属性名
+		k := j
+		for k < len(src) && !isSpace(src[k]) && src[k] != '=' && src[k] != '>' && !strings.HasPrefix(src[k:], "/>") {
+			k++
+		}
+		attrName := strings.ToLower(src[j:k])
+		if k == j {
+			k++ // 跳过无法识别的字符
+		}
+		j = k
+		for j < len(src) && isSpace(src[j]) {
+			j++
+		}
+
+		value := ""
+		if j < len(src) && src[j] == '=' {
+			j++
+			for j < len(src) && isSpace(src[j]) {
+				j++
+			}
+			if j < len(src) && (src[j] == '"' || src[j] == '\'') {
+				quote := src[j]
+				end := strings.IndexByte(src[j+1:], quote)
+				if end < 0 {
+					end = len(src) - j - 1
+				}
+				value = src[j+1 : j+1+end]
+				j += end + 2
+			} else {
+				k := j
+				for k < len(src) && !isSpace(src[k]) && src[k] != '>' {
+					k++
+				}
+				value = src[j:k]
+				j = k
+			}
+		}
+		if attrName != "" && attrName != "/" {
+			attrs[attrName] = html.UnescapeString(value)
+		}
+	}
+	return name, attrs, false, len(src)
+}
+
+func isTagNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == ':'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// textContent 返回节点的全部文本
+func (n *htmlNode) textContent() string {
+	if n.tag == "" {
+		return n.text
+	}
+	var sb strings.Builder
+	for _, c := range n.children {
+		sb.WriteString(c.textContent())
+	}
+	return sb.String()
+}
+
+// find 深度优先查找第一个满足条件的节点
+func (n *htmlNode) find(match func(*htmlNode) bool) *htmlNode {
+	for _, c := range n.children {
+		if c.tag == "" {
+			continue
+		}
+		if match(c) {
+			return c
+		}
+		if found := c.find(match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll 深度优先查找所有满足条件的节点
+func (n *htmlNode) findAll(match func(*htmlNode) bool) []*htmlNode {
+	var result []*htmlNode
+	for _, c := range n.children {
+		if c.tag == "" {
+			continue
+		}
+		if match(c) {
+			result = append(result, c)
+		}
+		result = append(result, c.findAll(match)...)
+	}
+	return result
+}
+
+// hasClass 判断节点是否包含某个 class
+func (n *htmlNode) hasClass(class string) bool {
+	for _, c := range strings.Fields(n.attrs["class"]) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================
+// CSS 选择器
+// ============================================
+
+// selectorStep 是选择器中的一个复合选择器，如 "div.content#main[data-x=1]"
+type selectorStep struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   map[string]string // 值为 "\x00" 表示只要求属性存在
+	child   bool              // 与前一步是子代关系（>）而不是后代关系
+}
+
+var selectorToken = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9-]*|\*)?((?:[#.][a-zA-Z0-9_-]+|\[[^\]]+\])*)$`)
+var selectorPart = regexp.MustCompile(`[#.][a-zA-Z0-9_-]+|\[[^\]]+\]`)
+
+// parseSelector 解析 CSS 选择器（支持标签、#id、.class、[attr]、[attr=value]、后代和子代组合，以及逗号分组）
+func parseSelector(selector string) ([][]selectorStep, bool) {
+	var groups [][]selectorStep
+	for _, group := range strings.Split(selector, ",") {
+		group = strings.ReplaceAll(group, ">", " > ")
+		var steps []selectorStep
+		child := false
+		for _, token := range strings.Fields(group) {
+			if token == ">" {
+				child = true
+				continue
+			}
+			m := selectorToken.FindStringSubmatch(token)
+			if m == nil {
+				return nil, false
+			}
+			step := selectorStep{tag: strings.ToLower(m[1]), child: child, attrs: map[string]string{}}
+			if step.tag == "*" {
+				step.tag = ""
+			}
+			for _, part := range selectorPart.FindAllString(m[2], -1) {
+				switch part[0] {
+				case '#':
+					step.id = part[1:]
+				case '.':
+					step.classes = append(step.classes, part[1:])
+				case '[':
+					inner := part[1 : len(part)-1]
+					if k, v, ok := strings.Cut(inner, "="); ok {
+						step.attrs[strings.ToLower(strings.TrimSpace(k))] = strings.Trim(strings.TrimSpace(v), `"'`)
+					} else {
+						step.attrs[strings.ToLower(strings.TrimSpace(inner))] = "\x00"
+					}
+				}
+			}
+			steps = append(steps, step)
+			child = false
+		}
+		if len(steps) == 0 {
+			return nil, false
+		}
+		groups = append(groups, steps)
+	}
+	return groups, len(groups) > 0
+}
+
+// matchStep 判断节点是否匹配单个复合选择器
+func (s selectorStep) matchStep(n *htmlNode) bool {
+	if n == nil || n.tag == "" || n.tag == "#root" {
+		return false
+	}
+	if s.tag != "" && n.tag != s.tag {
+		return false
+	}
+	if s.id != "" && n.attrs["id"] != s.id {
+		return false
+	}
+	for _, c := range s.classes {
+		if !n.hasClass(c) {
+			return false
+		}
+	}
+	for k, v := range s.attrs {
+		actual, ok := n.attrs[k]
+		if !ok || (v != "\x00" && actual != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSelector 从右向左匹配选择器链
+func matchSelector(n *htmlNode, steps []selectorStep) bool {
+	last := len(steps) - 1
+	if !steps[last].matchStep(n) {
+		return false
+	}
+	if last == 0 {
+		return true
+	}
+	rest := steps[:last]
+	if steps[last].child {
+		return matchSelector(n.parent, rest)
+	}
+	for p := n.parent; p != nil; p = p.parent {
+		if matchSelector(p, rest) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectNodes 返回文档中匹配选择器的所有节点（按文档顺序，忽略被其他匹配节点包含的节点）
+func selectNodes(root *htmlNode, groups [][]selectorStep) []*htmlNode {
+	matched := root.findAll(func(n *htmlNode) bool {
+		for _, steps := range groups {
+			if matchSelector(n, steps) {
+				return true
+			}
+		}
+		return false
+	})
+
+	var result []*htmlNode
+	for _, n := range matched {
+		nested := false
+		for _, r := range result {
+			for p := n.parent; p != nil; p = p.parent {
+				if p == r {
+					nested = true
+					break
+				}
+			}
+		}
+		if !nested {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// ============================================
+// Markdown 转换
+// ============================================
+
+// boilerplateTags 转换时整体跳过的元素
+var boilerplateTags = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true, "svg": true,
+	"canvas": true, "iframe": true, "nav": true, "footer": true, "aside": true, "form": true,
+	"button": true, "select": true, "input": true, "textarea": true, "dialog": true,
+}
+
+// boilerplatePattern 根据 class/id 判断是否为样板内容（导航、广告、分享按钮等）
+var boilerplatePattern = regexp.MustCompile(`(?i)(^|[\s_-])(cookie|consent|banner|sidebar|breadcrumbs?|share|sharing|social|related|newsletter|subscribe|advert|ads|promo|popup|modal|navbar|menu|skip-link|comments?)($|[\s_-])`)
+
+// listIndent 嵌套列表缩进的占位符
+// 渲染过程中会多次清理行首空白，用占位符保护缩进，最后再替换为空格
+const listIndent = "\x01"
+
+// mdRenderer 把 HTML 节点渲染为 Markdown
+type mdRenderer struct {
+	base       *url.URL // 用于解析相对链接
+	pre        int      // 当前处于 <pre> 中的层数
+	skipFilter bool     // 是否跳过样板过滤（用户指定了选择器时）
+}
+
+// htmlToMarkdown 将 HTML 文档转换为 Markdown
+// 参数:
+//
+//	src: HTML 源码
+//	base: 页面地址（用于解析相对链接）
+//	selector: 可选的 CSS 选择器，只提取匹配的元素
+//
+// 返回:
+//
+//	页面标题、Markdown 正文；选择器无效或没有匹配时返回错误信息
+func htmlToMarkdown(src string, base *url.URL, selector string) (string, string, error) {
+	root := parseHTML(src)
+
+	title := ""
+	if t := root.find(func(n *htmlNode) bool { return n.tag == "title" }); t != nil {
+		title = collapseSpaces(t.textContent())
+	}
+
+	r := &mdRenderer{base: base}
+
+	var nodes []*htmlNode
+	if selector != "" {
+		groups, ok := parseSelector(selector)
+		if !ok {
+			return title, "", fmt.Errorf("invalid or unsupported CSS selector: %s", selector)
+		}
+		nodes = selectNodes(root, groups)
+		if len(nodes) == 0 {
+			return title, "", fmt.Errorf("no elements match selector: %s", selector)
+		}
+		r.skipFilter = true
+	} else {
+		nodes = []*htmlNode{mainContent(root)}
+	}
+
+	var sb strings.Builder
+	for _, n := range nodes {
+		sb.WriteString(r.render(n))
+		sb.WriteString("\n\n")
+	}
+	markdown := strings.ReplaceAll(cleanMarkdown(sb.String()), listIndent, "  ")
+	return title, markdown, nil
+}
+
+// mainContent 选择页面的主体内容
+// 优先级：<main> / role=main > 唯一的 <article> > <body> > 整个文档
+func mainContent(root *htmlNode) *htmlNode {
+	if n := root.find(func(n *htmlNode) bool { return n.tag == "main" || n.attrs["role"] == "main" }); n != nil {
+		return n
+	}
+	if articles := root.findAll(func(n *htmlNode) bool { return n.tag == "article" }); len(articles) == 1 {
+		return articles[0]
+	}
+	if n := root.find(func(n *htmlNode) bool { return n.tag == "body" }); n != nil {
+		return n
+	}
+	return root
+}
+
+// isBoilerplate 判断元素是否为样板内容
+func (r *mdRenderer) isBoilerplate(n *htmlNode) bool {
+	if boilerplateTags[n.tag] {
+		return true
+	}
+	if r.skipFilter {
+		return false
+	}
+	if n.tag == "header" && !hasAncestor(n, "article", "main") {
+		return true
+	}
+	switch n.tag {
+	case "body", "main", "article", "#root":
+		return false
+	}
+	if n.attrs["aria-hidden"] == "true" || n.attrs["hidden"] != "" {
+		return true
+	}
+	return boilerplatePattern.MatchString(n.attrs["class"]) || boilerplatePattern.MatchString(n.attrs["id"])
+}
+
+// hasAncestor 判断节点是否位于指定标签之内
+func hasAncestor(n *htmlNode, tags ...string) bool {
+	for p := n.parent; p != nil; p = p.parent {
+		for _, t := range tags {
+			if p.tag == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// renderChildren 依次渲染子节点
+func (r *mdRenderer) renderChildren(n *htmlNode) string {
+	var sb strings.Builder
+	for _, c := range n.children {
+		sb.WriteString(r.render(c))
+	}
+	return sb.String()
+}
+
+// render 渲染单个节点
+func (r *mdRenderer) render(n *htmlNode) string {
+	if n.tag == "" {
+		if r.pre > 0 {
+			return n.text
+		}
+		return collapseSpaces(n.text)
+	}
+	if r.isBoilerplate(n) {
+		return ""
+	}
+
+	switch n.tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		text := strings.TrimSpace(r.renderChildren(n))
+		if text == "" {
+			return ""
+		}
+		level := int(n.tag[1] - '0')
+		return "\n\n" + strings.Repeat("#", level) + " " + strings.ReplaceAll(text, "\n", " ") + "\n\n"
+	case "p", "div", "section", "article", "main", "header", "figure", "figcaption", "dl", "address", "details", "summary":
+		return "\n\n" + r.renderChildren(n) + "\n\n"
+	case "dt":
+		return "\n\n**" + strings.TrimSpace(r.renderChildren(n)) + "**\n"
+	case "dd":
+		return "\n" + strings.TrimSpace(r.renderChildren(n)) + "\n"
+	case "br":
+		return "\n"
+	case "hr":
+		return "\n\n---\n\n"
+	case "strong", "b":
+		return wrapInline(r.renderChildren(n), "**")
+	case "em", "i":
+		return wrapInline(r.renderChildren(n), "*")
+	case "del", "s", "strike":
+		return wrapInline(r.renderChildren(n), "~~")
+	case "code", "kbd", "samp":
+		if r.pre > 0 {
+			return r.renderChildren(n)
+		}
+		text := strings.TrimSpace(n.textContent())
+		if text == "" {
+			return ""
+		}
+		return "`" + text + "`"
+	case "pre":
+		r.pre++
+		text := strings.Trim(n.textContent(), "\n")
+		r.pre--
+		lang := ""
+		if code := n.find(func(c *htmlNode) bool { return c.tag == "code" }); code != nil {
+			for _, class := range strings.Fields(code.attrs["class"]) {
+				if strings.HasPrefix(class, "language-") {
+					lang = strings.TrimPrefix(class, "language-")
+				}
+			}
+		}
+		return "\n\n```" + lang + "\n" + text + "\n```\n\n"
+	case "a":
+		text := strings.TrimSpace(r.renderChildren(n))
+		href := r.resolve(n.attrs["href"])
+		if text == "" {
+			return ""
+		}
+		if href == "" || strings.HasPrefix(href, "javascript:") || strings.HasPrefix(href, "#") {
+			return text
+		}
+		return "[" + text + "](" + href + ")"
+	case "img":
+		alt := strings.TrimSpace(n.attrs["alt"])
+		src := r.resolve(n.attrs["src"])
+		if alt == "" || src == "" {
+			return ""
+		}
+		return "![" + alt + "](" + src + ")"
+	case "ul", "ol":
+		return "\n\n" + r.renderList(n) + "\n\n"
+	case "li":
+		// 不在列表中的 li
+		return "\n- " + strings.TrimSpace(r.renderChildren(n)) + "\n"
+	case "blockquote":
+		text := cleanMarkdown(r.renderChildren(n))
+		if text == "" {
+			return ""
+		}
+		lines := strings.Split(text, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		return "\n\n" + strings.Join(lines, "\n") + "\n\n"
+	case "table":
+		return "\n\n" + r.renderTable(n) + "\n\n"
+	default:
+		return r.renderChildren(n)
+	}
+}
+
+// renderList 渲染有序或无序列表，嵌套列表缩进两个空格
+func (r *mdRenderer) renderList(list *htmlNode) string {
+	var items []string
+	index := 1
+	for _, c := range list.children {
+		if c.tag != "li" {
+			continue
+		}
+		marker := "- "
+		if list.tag == "ol" {
+			marker = strconv.Itoa(index) + ". "
+			index++
+		}
+
+		content := cleanMarkdown(r.renderChildren(c))
+		content = strings.ReplaceAll(content, "\n\n", "\n")
+		lines := strings.Split(content, "\n")
+		for i := 1; i < len(lines); i++ {
+			lines[i] = listIndent + lines[i]
+		}
+		items = append(items, marker+strings.Join(lines, "\n"))
+	}
+	return strings.Join(items, "\n")
+}
+
+// renderTable 渲染表格，第一行作为表头
+func (r *mdRenderer) renderTable(table *htmlNode) string {
+	rows := table.findAll(func(n *htmlNode) bool { return n.tag == "tr" })
+	var lines []string
+	columns := 0
+	for i, row := range rows {
+		var cells []string
+		for _, cell := range row.children {
+			if cell.tag != "td" && cell.tag != "th" {
+				continue
+			}
+			text := strings.TrimSpace(collapseSpaces(r.renderChildren(cell)))
+			cells = append(cells, strings.ReplaceAll(text, "|", `\|`))
+		}
+		if len(cells) == 0 {
+			continue
+		}
+		if i == 0 || columns == 0 {
+			columns = len(cells)
+			lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+			continue
+		}
+		lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resolve 将相对链接解析为绝对链接
+func (r *mdRenderer) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || r.base == nil {
+		return href
+	}
+	u, err := r.base.Parse(href)
+	if err != nil {
+		return href
+	}
+	return u.String()
+}
+
+// wrapInline 用标记包裹行内文本，保留两侧空白
+func wrapInline(text, mark string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	prefix := text[:len(text)-len(strings.TrimLeft(text, " \n"))]
+	suffix := text[len(strings.TrimRight(text, " \n")):]
+	return prefix + mark + trimmed + mark + suffix
+}
+
+var spacesPattern = regexp.MustCompile(`[ \t\r\n\f\x{00a0}]+`)
+var blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+
+// collapseSpaces 把连续空白合并为一个空格
+func collapseSpaces(s string) string {
+	return spacesPattern.ReplaceAllString(s, " ")
+}
+
+// cleanMarkdown 清理多余的空白行和行首行尾空格
+func cleanMarkdown(s string) string {
+	lines := strings.Split(s, "\n")
+	inFence := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			lines[i] = strings.TrimSpace(line)
+			continue
+		}
+		if !inFence {
+			lines[i] = strings.TrimSpace(line)
+		}
+	}
+	s = strings.Join(lines, "\n")
+	s = blankLinesPattern.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,339 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// httprequest.go - 通用 HTTP 请求工具
+// 此文件实现了 HTTPRequestTool：向允许的域名发送 GET/POST/PUT/PATCH/DELETE 请求，
+// 用于调用用户自己的 API（智能家居、GitHub、天气等），
+// 在 restrictToWorkspace 开启、无法通过 shell 执行 curl 时也能使用
+
+const (
+	defaultHTTPMaxChars = 20000            // 默认最多返回 20000 个字符
+	maxHTTPResponseSize = 10 * 1024 * 1024 // 最多读取 10MB 的响应
+)
+
+// httpMethods 支持的请求方法
+var httpMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// HTTPRequestTool 提供通用的 HTTP 请求功能
+// 只能访问 allow 列表中的域名（deny 列表优先），重定向目标同样需要检查
+type HTTPRequestTool struct {
+	BaseTool
+	allow      []string                     // 允许访问的域名，"*" 表示所有域名
+	deny       []string                     // 禁止访问的域名
+	headers    map[string]map[string]string // 域名 -> 自动添加的请求头
+	maxChars   int                          // 返回的响应正文最大字符数
+	httpClient *http.Client                 // HTTP客户端，配置了超时和重定向检查
+}
+
+// NewHTTPRequestTool 创建一个新的 HTTP 请求工具
+// 参数:
+//
+//	timeout: 请求超时时间（秒）
+//	maxChars: 返回的响应正文最大字符数（<= 0 使用默认值 20000）
+//
+// 返回:
+//
+//	配置好的HTTPRequestTool实例（需要调用 SetDomains 设置允许的域名）
+func NewHTTPRequestTool(timeout int, maxChars int) *HTTPRequestTool {
+	if timeout <= 0 {
+		timeout = 30
+	}
+	if maxChars <= 0 {
+		maxChars = defaultHTTPMaxChars
+	}
+
+	t := &HTTPRequestTool{
+		BaseTool: NewBaseTool(
+			"http_request",
+			"Send an HTTP request to an API and return the status, headers and body. "+
+				"Use this to call web APIs (e.g. home automation, GitHub, weather) instead of running curl in the shell. "+
+				"Only configured domains are reachable. Use 'json' for a JSON body or 'body' for raw text. "+
+				"To read a web page as text, prefer web_fetch.",
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"method": map[string]interface{}{
+						"type":        "string",
+						"enum":        httpMethods,
+						"description": "HTTP method (default GET)",
+					},
+					"url": map[string]interface{}{
+						"type":        "string",
+						"description": "The http(s) URL to request",
+					},
+					"headers": map[string]interface{}{
+						"type":        "object",
+						"description": "Request headers, e.g. {\"Accept\": \"application/json\"}",
+					},
+					"body": map[string]interface{}{
+						"type":        "string",
+						"description": "Raw request body",
+					},
+					"json": map[string]interface{}{
+						"type":        "object",
+						"description": "JSON request body (sets Content-Type: application/json)",
+					},
+					"max_chars": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("Maximum characters of the response body to return (default %d)", maxChars),
+					},
+				},
+				"required": []string{"url"},
+			},
+		),
+		maxChars: maxChars,
+	}
+	t.httpClient = &http.Client{
+		Timeout: time.Duration(timeout) * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+			}
+			if err := t.checkHost(req.URL); err != nil {
+				return err
+			}
+			t.redirectHeaders(req, via[len(via)-1].URL)
+			return nil
+		},
+	}
+	return t
+}
+
+// SetDomains 设置允许和禁止访问的域名
+// 域名同时匹配其子域名，也可以写 "主机:端口" 只匹配该端口；allow 中的 "*" 表示所有域名
+func (t *HTTPRequestTool) SetDomains(allow, deny []string) {
+	t.allow = normalizeDomains(allow)
+	t.deny = normalizeDomains(deny)
+}
+
+// SetHeaders 设置按域名自动添加的请求头，值中的 ${VAR} 会替换为环境变量
+func (t *HTTPRequestTool) SetHeaders(headers map[string]map[string]string) {
+	t.headers = make(map[string]map[string]string, len(headers))
+	for domain, values := range headers {
+		expanded := make(map[string]string, len(values))
+		for name, value := range values {
+			expanded[name] = os.ExpandEnv(value)
+		}
+		t.headers[strings.ToLower(strings.TrimSpace(domain))] = expanded
+	}
+}
+
+// Execute 发送 HTTP 请求
+// 参数:
+//
+//	ctx: 上下文对象
+//	params: 参数map，必须包含"url"，可选"method"、"headers"、"body"、"json"和"max_chars"
+//
+// 返回:
+//
+//	响应状态、主要响应头和正文（非 2xx 状态不视为错误，正文通常包含 API 的错误说明）
+func (t *HTTPRequestTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	rawURL, _ := params["url"].(string)
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", fmt.Errorf("missing url parameter")
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return "", fmt.Errorf("invalid url: only http and https URLs are supported")
+	}
+	if err := t.checkHost(target); err != nil {
+		return "", err
+	}
+
+	method, _ := params["method"].(string)
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		method = "GET"
+	}
+	if !containsString(httpMethods, method) {
+		return "", fmt.Errorf("unsupported method %s (supported: %s)", method, strings.Join(httpMethods, ", "))
+	}
+
+	var body io.Reader
+	contentType := ""
+	if v, ok := params["json"]; ok && v != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid json body: %w", err)
+		}
+		body = strings.NewReader(string(data))
+		contentType = "application/json"
+	} else if s, ok := params["body"].(string); ok && s != "" {
+		body = strings.NewReader(s)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "nanogrip/1.0 (+https://github.com/Ailoc/nanogrip)")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if headers, ok := params["headers"].(map[string]interface{}); ok {
+		for name, value := range headers {
+			req.Header.Set(name, fmt.Sprint(value))
+		}
+	}
+	// 配置中的请求头最后设置，模型不能覆盖（也不会在结果中看到）
+	for name, value := range t.configuredHeaders(target) {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		// 只有 GET 和 HEAD 请求可以安全地重试
+		if method == "GET" || method == "HEAD" {
+			err = transientNetwork(err)
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseSize))
+	if err != nil {
+		return "", err
+	}
+
+	maxChars := t.maxChars
+	if v, ok := params["max_chars"].(float64); ok && v > 0 {
+		maxChars = int(v)
+	}
+	return formatHTTPResponse(resp, data, maxChars), nil
+}
+
+// checkHost 检查 URL 的主机是否允许访问
+func (t *HTTPRequestTool) checkHost(u *url.URL) error {
+	host := strings.ToLower(u.Hostname())
+	hostPort := host
+	if port := u.Port(); port != "" {
+		hostPort = net.JoinHostPort(host, port)
+	}
+
+	for _, d := range t.deny {
+		if domainMatches(d, host, hostPort) {
+			return fmt.Errorf("domain %s is denied by tools.web.http.denyDomains", host)
+		}
+	}
+	for _, d := range t.allow {
+		if d == "*" || domainMatches(d, host, hostPort) {
+			return nil
+		}
+	}
+	return fmt.Errorf("domain %s is not in tools.web.http.allowDomains", host)
+}
+
+// redirectHeaders 重定向到另一个来源（协议或主机不同）时，去掉为原来源配置的请求头，换成为新来源配置的请求头
+// 配置的请求头通常是 API 密钥，不能发给别的主机
+func (t *HTTPRequestTool) redirectHeaders(req *http.Request, from *url.URL) {
+	if req.URL.Scheme == from.Scheme && strings.EqualFold(req.URL.Host, from.Host) {
+		return
+	}
+	for name := range t.configuredHeaders(from) {
+		req.Header.Del(name)
+	}
+	for name, value := range t.configuredHeaders(req.URL) {
+		req.Header.Set(name, value)
+	}
+}
+
+// configuredHeaders 返回配置中匹配该 URL 的请求头
+func (t *HTTPRequestTool) configuredHeaders(u *url.URL) map[string]string {
+	host := strings.ToLower(u.Hostname())
+	hostPort := host
+	if port := u.Port(); port != "" {
+		hostPort = net.JoinHostPort(host, port)
+	}
+
+	result := make(map[string]string)
+	for domain, values := range t.headers {
+		if domainMatches(domain, host, hostPort) {
+			for name, value := range values {
+				result[name] = value
+			}
+		}
+	}
+	return result
+}
+
+// normalizeDomains 统一域名格式：小写、去掉协议和 "*." 前缀
+func normalizeDomains(domains []string) []string {
+	result := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		d = strings.TrimPrefix(d, "https://")
+		d = strings.TrimPrefix(d, "http://")
+		d = strings.TrimRight(d, "/")
+		if d != "*" {
+			d = strings.TrimPrefix(d, "*.")
+		}
+		if d != "" {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// domainMatches 判断主机是否匹配域名规则
+// 规则带端口时比较 "主机:端口"，否则比较主机名；子域名同样匹配
+func domainMatches(rule, host, hostPort string) bool {
+	target := host
+	if _, _, err := net.SplitHostPort(rule); err == nil {
+		target = hostPort
+	}
+	return target == rule || strings.HasSuffix(target, "."+rule)
+}
+
+// formatHTTPResponse 格式化响应：状态行、主要响应头和截断后的正文
+func formatHTTPResponse(resp *http.Response, data []byte, maxChars int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "HTTP %s\n", resp.Status)
+
+	var names []string
+	for name := range resp.Header {
+		switch strings.ToLower(name) {
+		case "content-type", "content-length", "location", "retry-after", "etag", "last-modified",
+			"x-ratelimit-remaining", "x-ratelimit-reset":
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&sb, "%s: %s\n", name, resp.Header.Get(name))
+	}
+
+	if len(data) == 0 {
+		sb.WriteString("\n(empty body)")
+		return sb.String()
+	}
+	if !utf8.Valid(data) && http.DetectContentType(data) == "application/octet-stream" {
+		fmt.Fprintf(&sb, "\n(binary body, %d bytes)", len(data))
+		return sb.String()
+	}
+
+	text := strings.ToValidUTF8(string(data), "")
+	runes := []rune(text)
+	sb.WriteString("\n")
+	if len(runes) > maxChars {
+		sb.WriteString(string(runes[:maxChars]))
+		fmt.Fprintf(&sb, "\n... (truncated, %d of %d characters shown)", maxChars, len(runes))
+	} else {
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
@@ -0,0 +1,179 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+)
+
+// interaction.go - 等待输入的命令与用户之间的输入转发
+// 命令（例如 shell 工具的 interactive 模式）等待输入时，InteractionManager 把提示发到原聊天，
+// 用户的下一条文本消息在频道层被拦截（见 BaseChannel.SetInputHandler）并交给命令；
+// 回复 /abort 终止命令，超时未答复时命令的标准输入被关闭。
+
+// ErrInputAborted 表示用户回复 /abort 终止了等待输入的命令
+var ErrInputAborted = errors.New("aborted by the user")
+
+// Interactor 是向用户询问命令所需输入的接口
+type Interactor interface {
+	// AskInput 把命令的提示发送到指定聊天并等待用户答复
+	// 用户回复 /abort 时返回 ErrInputAborted
+	AskInput(ctx context.Context, channel, chatID, prompt string) (string, error)
+}
+
+type interactorKey struct{}
+
+// WithInteractor 在 ctx 中附加 Interactor（由 ToolRegistry 在执行工具前设置）
+func WithInteractor(ctx context.Context, interactor Interactor) context.Context {
+	return context.WithValue(ctx, interactorKey{}, interactor)
+}
+
+// InteractorFrom 返回 ctx 中的 Interactor，没有时返回 nil
+func InteractorFrom(ctx context.Context) Interactor {
+	interactor, _ := ctx.Value(interactorKey{}).(Interactor)
+	return interactor
+}
+
+// InteractionManager 通过消息总线向用户发送命令的输入提示，并通过频道的输入回调接收答复
+// 与 ApprovalManager 相同，等待答复时 AgentLoop 阻塞在工具调用上，答复需要在频道层拦截
+type InteractionManager struct {
+	bus     *bus.MessageBus
+	timeout time.Duration
+	pending map[string]pendingReply // 等待中的输入，键为 "channel:chatID"
+	mu      sync.Mutex
+}
+
+// NewInteractionManager 创建输入转发管理器
+// 参数:
+//
+//	msgBus: 消息总线，用于发送输入提示
+//	timeout: 等待用户答复的超时时间（<= 0 使用默认值 5 分钟）
+//
+// 返回:
+//
+//	输入转发管理器实例
+func NewInteractionManager(msgBus *bus.MessageBus, timeout time.Duration) *InteractionManager {
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	return &InteractionManager{
+		bus:     msgBus,
+		timeout: timeout,
+		pending: make(map[string]pendingReply),
+	}
+}
+
+// AskInput 发送输入提示并阻塞等待答复
+// 同一聊天同时只允许一个等待中的输入；与审批相同，只接受触发工具调用的用户的答复
+func (m *InteractionManager) AskInput(ctx context.Context, channel, chatID, prompt string) (string, error) {
+	if channel == "" || chatID == "" {
+		return "", fmt.Errorf("no chat to ask for input")
+	}
+
+	key := channel + ":" + chatID
+	reply := make(chan string, 1)
+	toolCtx, _ := ToolContextFrom(ctx)
+
+	m.mu.Lock()
+	if _, exists := m.pending[key]; exists {
+		m.mu.Unlock()
+		return "", fmt.Errorf("another command is already waiting for input in this chat")
+	}
+	m.pending[key] = pendingReply{reply: reply, sender: toolCtx.SenderID}
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.pending, key)
+		m.mu.Unlock()
+	}()
+
+	err := m.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Content: "⌨️ The command is waiting for input:\n\n```\n" + prompt + "\n```\n\nReply with the text to send, or /abort to stop the command.",
+		Metadata: map[string]interface{}{
+			"input_request": true,
+			"buttons": []interface{}{
+				[]interface{}{
+					map[string]interface{}{"text": "⛔ Abort", "data": "/abort"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to send input prompt: %w", err)
+	}
+
+	log.Printf("[Interaction] 等待用户输入: %s", key)
+
+	timer := time.NewTimer(m.timeout)
+	defer timer.Stop()
+
+	select {
+	case answer := <-reply:
+		if isAbort(answer) {
+			return "", ErrInputAborted
+		}
+		return answer, nil
+	case <-timer.C:
+		return "", fmt.Errorf("no answer within %s", m.timeout)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// HandleInput 处理用户输入，如果该聊天有等待输入的命令则作为答复
+// 签名与 BaseChannel.SetInputHandler 的回调一致
+// 返回:
+//
+//	输入被命令消费时返回 true（不再进入消息总线）
+func (m *InteractionManager) HandleInput(channel, chatID, senderID, input string) bool {
+	key := channel + ":" + chatID
+
+	m.mu.Lock()
+	pending, ok := m.pending[key]
+	ok = ok && pending.accepts(senderID)
+	if ok {
+		delete(m.pending, key)
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	select {
+	case pending.reply <- input:
+	default:
+	}
+	return true
+}
+
+// InputHandlers 把多个输入回调合并为一个，依次调用直到某个回调消费了输入
+func InputHandlers(handlers ...func(channel, chatID, senderID, input string) bool) func(channel, chatID, senderID, input string) bool {
+	return func(channel, chatID, senderID, input string) bool {
+		for _, handler := range handlers {
+			if handler(channel, chatID, senderID, input) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// isAbort 判断用户答复是否表示终止命令
+func isAbort(answer string) bool {
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "/abort", "/cancel", "/stop":
+		return true
+	default:
+		return false
+	}
+}
@@ -11,6 +11,8 @@ type SaveMemoryTool struct {
 	BaseTool
 	// memoryStore 用于读取和写入记忆
 	memoryStore MemoryStoreInterface
+	// scope 按聊天选择记忆存储（nil 表示始终使用 memoryStore）
+	scope func(ctx context.Context) MemoryStoreInterface
 }
 
 // MemoryStoreInterface 定义记忆存储的接口
@@ -45,6 +47,11 @@ func NewSaveMemoryTool(memoryStore MemoryStoreInterface) *SaveMemoryTool {
 	}
 }
 
+// SetScope 设置按聊天选择记忆存储的函数（按聊天隔离记忆时使用）
+func (t *SaveMemoryTool) SetScope(scope func(ctx context.Context) MemoryStoreInterface) {
+	t.scope = scope
+}
+
 // Execute 执行保存记忆
 // 将历史条目追加到 HISTORY.md，并更新 MEMORY.md
 func (t *SaveMemoryTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
@@ -52,23 +59,28 @@ func (t *SaveMemoryTool) Execute(ctx context.Context, params map[string]interfac
 	memoryUpdate, _ := params["memory_update"].(string)
 
 	if historyEntry == "" && memoryUpdate == "" {
-		return "Error: history_entry and memory_update are required", nil
+		return "", fmt.Errorf("history_entry and memory_update are required")
+	}
+
+	store := t.memoryStore
+	if t.scope != nil {
+		store = t.scope(ctx)
 	}
 
 	// 追加历史条目到 HISTORY.md
 	if historyEntry != "" {
-		if err := t.memoryStore.AppendHistory(historyEntry); err != nil {
-			return fmt.Sprintf("Error saving history: %v", err), nil
+		if err := store.AppendHistory(historyEntry); err != nil {
+			return "", fmt.Errorf("failed to save history: %w", err)
 		}
 	}
 
 	// 更新长期记忆 MEMORY.md
 	if memoryUpdate != "" {
-		currentMemory := t.memoryStore.ReadLongTerm()
+		currentMemory := store.ReadLongTerm()
 		// 只有当新内容与当前内容不同时才更新
 		if memoryUpdate != currentMemory {
-			if err := t.memoryStore.WriteLongTerm(memoryUpdate); err != nil {
-				return fmt.Sprintf("Error saving memory: %v", err), nil
+			if err := store.WriteLongTerm(memoryUpdate); err != nil {
+				return "", fmt.Errorf("failed to save memory: %w", err)
 			}
 		}
 	}
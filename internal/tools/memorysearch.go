@@ -0,0 +1,392 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// memorysearch.go - 记忆检索工具
+// 此文件实现了 MemorySearchTool：对 memory/HISTORY.md（记忆整理和会话归档写入的摘要）和每日笔记
+// （memory/YYYY-MM-DD.md）建立 BM25 索引，按相关度返回带日期的片段
+// 索引保存在内存中，文件变化（修改时间或大小）后下一次搜索时自动重建
+// 按聊天隔离记忆时，只检索当前聊天的记忆目录（以及共享的全局记忆）
+
+const (
+	memorySearchDefaultLimit = 5   // 默认返回的片段数
+	memorySearchMaxLimit     = 20  // 最多返回的片段数
+	memorySnippetChars       = 600 // 每个片段最多显示的字符数
+
+	// BM25 参数
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+var (
+	// historyDatePattern 匹配历史条目开头的 [YYYY-MM-DD HH:MM] 或 [YYYY-MM-DD]
+	historyDatePattern = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2})(?:[ T](\d{2}:\d{2}))?`)
+	// dailyNotePattern 匹配每日笔记的文件名
+	dailyNotePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\.md$`)
+)
+
+// memoryEntry 是索引中的一个片段
+type memoryEntry struct {
+	date   string         // 日期（YYYY-MM-DD，可能带时间），未知时为空
+	source string         // 来源文件名
+	text   string         // 片段原文
+	terms  map[string]int // 词频
+	length int            // 词数
+}
+
+// memoryIndex 是一组记忆目录的 BM25 索引
+type memoryIndex struct {
+	signature string         // 建立索引时各文件的修改时间和大小
+	entries   []memoryEntry  // 索引的片段
+	docFreq   map[string]int // 每个词出现在多少个片段中
+	avgLength float64        // 片段平均词数
+}
+
+// MemorySearchTool 提供检索历史记忆的功能
+type MemorySearchTool struct {
+	BaseTool
+	memoryDir string                             // 记忆根目录（workspace/memory）
+	scope     func(ctx context.Context) []string // 返回当前聊天要检索的记忆目录（nil 表示只检索 memoryDir）
+	mu        sync.Mutex                         // 保护 indexes
+	indexes   map[string]*memoryIndex            // 按目录组合缓存的索引
+}
+
+// NewMemorySearchTool 创建一个新的记忆检索工具
+// 参数:
+//
+//	workspace: 工作区目录路径（记忆文件在 workspace/memory 下）
+//
+// 返回:
+//
+//	配置好的MemorySearchTool实例
+func NewMemorySearchTool(workspace string) *MemorySearchTool {
+	return &MemorySearchTool{
+		BaseTool: NewBaseTool(
+			"memory_search",
+			"Search past conversations and events: the history log (summaries of earlier conversations) and daily notes. "+
+				"Returns the most relevant dated snippets. Use this to answer questions like "+
+				"'what did we decide about the server migration last month?' before saying you don't remember.",
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query": map[string]interface{}{
+						"type":        "string",
+						"description": "Keywords to search for (e.g. 'server migration decision')",
+					},
+					"since": map[string]interface{}{
+						"type":        "string",
+						"description": "Only entries on or after this date (YYYY-MM-DD)",
+					},
+					"until": map[string]interface{}{
+						"type":        "string",
+						"description": "Only entries on or before this date (YYYY-MM-DD)",
+					},
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": "Maximum number of snippets to return (default 5, max 20)",
+					},
+				},
+				"required": []string{"query"},
+			},
+		),
+		memoryDir: filepath.Join(workspace, "memory"),
+		indexes:   make(map[string]*memoryIndex),
+	}
+}
+
+// SetScope 设置按聊天选择记忆目录的函数（按聊天隔离记忆时使用）
+// 参数:
+//
+//	scope: 根据上下文中的聊天信息返回要检索的记忆目录
+func (t *MemorySearchTool) SetScope(scope func(ctx context.Context) []string) {
+	t.scope = scope
+}
+
+// Execute 搜索记忆
+// 参数:
+//
+//	ctx: 上下文对象
+//	params: 参数map，必须包含"query"，可选"since"、"until"和"limit"
+//
+// 返回:
+//
+//	按相关度排序的带日期片段
+func (t *MemorySearchTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	query := stringParam(params, "query")
+	terms := memoryTerms(query)
+	if len(terms) == 0 {
+		return "", fmt.Errorf("missing query")
+	}
+
+	since, until := stringParam(params, "since"), stringParam(params, "until")
+	for _, date := range []string{since, until} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return "", fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+		}
+	}
+	limit := memorySearchDefaultLimit
+	if v, ok := params["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+	if limit > memorySearchMaxLimit {
+		limit = memorySearchMaxLimit
+	}
+
+	dirs := []string{t.memoryDir}
+	if t.scope != nil {
+		dirs = t.scope(ctx)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	index, err := t.index(dirs)
+	if err != nil {
+		return "", err
+	}
+	if len(index.entries) == 0 {
+		return "No history has been recorded yet.", nil
+	}
+
+	type hit struct {
+		entry *memoryEntry
+		score float64
+	}
+	var hits []hit
+	for i := range index.entries {
+		entry := &index.entries[i]
+		day := entry.date
+		if len(day) > 10 {
+			day = day[:10]
+		}
+		if (since != "" && (day == "" || day < since)) || (until != "" && (day == "" || day > until)) {
+			continue
+		}
+		if score := index.score(entry, terms); score > 0 {
+			hits = append(hits, hit{entry: entry, score: score})
+		}
+	}
+	if len(hits) == 0 {
+		return fmt.Sprintf("No history entries match %q.", query), nil
+	}
+
+	// 相关度相同时较新的在前
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].entry.date > hits[j].entry.date
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d matching entries (most relevant first):\n", len(hits))
+	for _, h := range hits {
+		date := h.entry.date
+		if date == "" {
+			date = "undated"
+		}
+		// 日期已经显示在标题中，去掉条目开头重复的 [YYYY-MM-DD HH:MM]
+		text := h.entry.text
+		if historyDatePattern.MatchString(text) {
+			if end := strings.Index(text, "]"); end != -1 {
+				text = strings.TrimSpace(text[end+1:])
+			}
+		}
+		if runes := []rune(text); len(runes) > memorySnippetChars {
+			text = string(runes[:memorySnippetChars]) + "..."
+		}
+		fmt.Fprintf(&sb, "\n[%s] (%s)\n%s\n", date, h.entry.source, text)
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// score 计算片段与查询词的 BM25 得分
+func (idx *memoryIndex) score(entry *memoryEntry, terms []string) float64 {
+	n := float64(len(idx.entries))
+	score := 0.0
+	for _, term := range terms {
+		tf := float64(entry.terms[term])
+		if tf == 0 {
+			continue
+		}
+		df := float64(idx.docFreq[term])
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		norm := tf + bm25K1*(1-bm25B+bm25B*float64(entry.length)/idx.avgLength)
+		score += idf * tf * (bm25K1 + 1) / norm
+	}
+	return score
+}
+
+// index 返回一组记忆目录的索引，文件变化时重建
+func (t *MemorySearchTool) index(dirs []string) (*memoryIndex, error) {
+	files := memorySourceFiles(dirs)
+
+	var sig strings.Builder
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&sig, "%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	key := strings.Join(dirs, "\x00")
+	if idx, ok := t.indexes[key]; ok && idx.signature == sig.String() {
+		return idx, nil
+	}
+
+	var entries []memoryEntry
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+		}
+
+		// 来源显示为相对记忆根目录的路径（按聊天隔离时带有聊天目录名）
+		source, err := filepath.Rel(t.memoryDir, path)
+		if err != nil {
+			source = filepath.Base(path)
+		}
+
+		// 每日笔记的片段使用文件名中的日期
+		fileDate := ""
+		if m := dailyNotePattern.FindStringSubmatch(filepath.Base(path)); m != nil {
+			fileDate = m[1]
+		}
+		for _, paragraph := range splitParagraphs(string(data)) {
+			date := fileDate
+			if m := historyDatePattern.FindStringSubmatch(paragraph); m != nil {
+				date = m[1]
+				if m[2] != "" {
+					date += " " + m[2]
+				}
+			}
+			entries = append(entries, newMemoryEntry(date, source, paragraph))
+		}
+	}
+
+	idx := &memoryIndex{signature: sig.String(), entries: entries, docFreq: make(map[string]int), avgLength: 1}
+	totalLength := 0
+	for _, entry := range entries {
+		totalLength += entry.length
+		for term := range entry.terms {
+			idx.docFreq[term]++
+		}
+	}
+	if len(entries) > 0 && totalLength > 0 {
+		idx.avgLength = float64(totalLength) / float64(len(entries))
+	}
+	t.indexes[key] = idx
+	return idx, nil
+}
+
+// memorySourceFiles 返回要索引的文件：每个目录下的 HISTORY.md 和所有每日笔记
+func memorySourceFiles(dirs []string) []string {
+	var files []string
+	for _, dir := range dirs {
+		files = append(files, filepath.Join(dir, "HISTORY.md"))
+		dirEntries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range dirEntries {
+			if !entry.IsDir() && dailyNotePattern.MatchString(entry.Name()) {
+				files = append(files, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	return files
+}
+
+// newMemoryEntry 创建一个索引片段
+func newMemoryEntry(date, source, text string) memoryEntry {
+	terms := memoryTerms(text)
+	freq := make(map[string]int, len(terms))
+	for _, term := range terms {
+		freq[term]++
+	}
+	return memoryEntry{date: date, source: source, text: text, terms: freq, length: len(terms)}
+}
+
+// splitParagraphs 按空行把文本拆分为段落，跳过 Markdown 标题行
+func splitParagraphs(text string) []string {
+	var paragraphs []string
+	var current []string
+	flush := func() {
+		if p := strings.TrimSpace(strings.Join(current, "\n")); p != "" {
+			paragraphs = append(paragraphs, p)
+		}
+		current = current[:0]
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "# ") {
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+	return paragraphs
+}
+
+// memoryTerms 把文本拆分为检索词
+// 字母和数字按单词切分（转为小写），中日韩文字按相邻两字切分（单字保留为一个词）
+func memoryTerms(text string) []string {
+	var terms []string
+	var word []rune
+	var cjk []rune
+
+	flushWord := func() {
+		if len(word) > 0 {
+			terms = append(terms, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		switch len(cjk) {
+		case 0:
+		case 1:
+			terms = append(terms, string(cjk))
+		default:
+			for i := 0; i+1 < len(cjk); i++ {
+				terms = append(terms, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return terms
+}
@@ -4,11 +4,55 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
+
+	"github.com/Ailoc/nanogrip/internal/bus"
+	"github.com/Ailoc/nanogrip/internal/trace"
 )
 
 // message.go - 消息发送工具
 // 此文件实现了向聊天频道发送消息的工具，支持多种消息平台
+// 工具只负责确定发送目标并把消息交给桥接器；Markdown 方言转换和按长度拆分
+// 由频道层的出站分发器根据目标频道的能力完成（见 channels.Adapt）
+
+// maxMessageRecipients 一次调用最多发送的接收者数量
+const maxMessageRecipients = 20
+
+// OutgoingMessage 消息工具发出的一条消息
+// 以 JSON 编码写入发送通道，由桥接器转换为出站消息
+type OutgoingMessage struct {
+	Channel   string        `json:"channel"`
+	ChatID    string        `json:"chat_id"`
+	Content   string        `json:"content"`
+	Media     []string      `json:"media,omitempty"`
+	MediaType string        `json:"media_type,omitempty"`
+	Buttons   []interface{} `json:"buttons,omitempty"`
+	TraceID   string        `json:"trace_id,omitempty"`
+}
+
+// Outbound 转换为出站消息
+func (m OutgoingMessage) Outbound() bus.OutboundMessage {
+	msg := bus.OutboundMessage{
+		Channel:  m.Channel,
+		ChatID:   m.ChatID,
+		Content:  m.Content,
+		Media:    m.Media,
+		Metadata: map[string]interface{}{},
+	}
+	if m.MediaType != "" {
+		msg.Metadata["media_type"] = m.MediaType
+	}
+	// 内联按钮（由频道自行解析，例如 Telegram 的 inline_keyboard）
+	if len(m.Buttons) > 0 {
+		msg.Metadata["buttons"] = m.Buttons
+	}
+	// 追踪 ID（关联发出这条消息的入站消息）
+	if m.TraceID != "" {
+		msg.Metadata[trace.MetadataKey] = m.TraceID
+	}
+	return msg
+}
 
 // MessageTool 提供消息发送功能
 // 允许代理向指定的聊天频道发送消息，支持Telegram、WhatsApp、Discord等
@@ -32,21 +76,33 @@ func NewMessageTool(sendChan chan<- string) *MessageTool {
 	return &MessageTool{
 		BaseTool: NewBaseTool(
 			"message",
-			"Send a message to a chat channel. Supports text and images (via URLs or local paths).",
+			"Send a message to a chat channel. Supports text, media files (via URLs or local paths), inline buttons and several recipients at once. Defaults to the current chat.",
 			map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
 					"content": map[string]interface{}{
 						"type":        "string",
-						"description": "Message content to send",
+						"description": "Message content in standard Markdown. It is converted to the target channel's format and split to fit its length limit automatically.",
 					},
 					"channel": map[string]interface{}{
 						"type":        "string",
-						"description": "Channel name (telegram, whatsapp, discord, etc.)",
+						"description": "Channel name (telegram, whatsapp, discord, etc.). Default: the current channel",
 					},
 					"chat_id": map[string]interface{}{
 						"type":        "string",
-						"description": "Chat ID to send to",
+						"description": "Chat ID to send to. Default: the current chat",
+					},
+					"recipients": map[string]interface{}{
+						"type":        "array",
+						"description": "Send the same message to several chats instead of channel/chat_id. Each recipient is {\"chat_id\"} or {\"channel\", \"chat_id\"} (channel defaults to the current channel).",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"channel": map[string]interface{}{"type": "string"},
+								"chat_id": map[string]interface{}{"type": "string"},
+							},
+							"required": []string{"chat_id"},
+						},
 					},
 					"media": map[string]interface{}{
 						"type":        "string",
@@ -54,7 +110,24 @@ func NewMessageTool(sendChan chan<- string) *MessageTool {
 					},
 					"media_type": map[string]interface{}{
 						"type":        "string",
-						"description": "Media type: photo, document, audio, video. Default: photo",
+						"enum":        []string{"photo", "document", "file", "audio", "video"},
+						"description": "Media type: photo, document (or file), audio, video. Default: detected from the file extension. Channels that cannot send a type get a link instead.",
+					},
+					"buttons": map[string]interface{}{
+						"type":        "array",
+						"description": "Optional inline buttons (Telegram). Array of rows, each row an array of {\"text\", \"data\"} objects (or {\"text\", \"url\"} for links). When the user taps a button, its data comes back as the user's next message. Use this for confirm/cancel choices, e.g. [[{\"text\":\"Confirm\",\"data\":\"confirm\"},{\"text\":\"Cancel\",\"data\":\"cancel\"}]]",
+						"items": map[string]interface{}{
+							"type": "array",
+							"items": map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"text": map[string]interface{}{"type": "string"},
+									"data": map[string]interface{}{"type": "string"},
+									"url":  map[string]interface{}{"type": "string"},
+								},
+								"required": []string{"text"},
+							},
+						},
 					},
 				},
 				"required": []string{"content"},
@@ -78,13 +151,12 @@ func (t *MessageTool) SetContext(channel string, chatID string) {
 }
 
 // Execute 发送消息
-// 将消息内容、频道和聊天ID打包成JSON，通过通道发送
-// 如果未指定 channel 或 chat_id，将使用 SetContext 设置的默认值
-// 支持发送图片、视频等媒体文件
+// 把消息编码为 JSON 通过通道发送，每个接收者一条
+// 未指定 channel 或 chat_id 时使用当前工具上下文（没有上下文时使用 SetContext 设置的值）
 // 参数:
 //
 //	ctx: 上下文对象
-//	params: 参数map，必须包含"content"，可选"channel"、"chat_id"、"media"和"media_type"
+//	params: 参数map，必须包含"content"，可选"channel"、"chat_id"、"recipients"、"media"、"media_type"和"buttons"
 //
 // 返回:
 //
@@ -96,64 +168,110 @@ func (t *MessageTool) Execute(ctx context.Context, params map[string]interface{}
 		return "", fmt.Errorf("missing or invalid content parameter")
 	}
 
-	// 获取可选参数，优先使用参数值，否则使用上下文默认值
-	channel, _ := params["channel"].(string)
-	chatID, _ := params["chat_id"].(string)
-
-	// 获取媒体参数
-	media, _ := params["media"].(string)
-	mediaType, _ := params["media_type"].(string)
+	msg := OutgoingMessage{
+		Content: content,
+		TraceID: trace.IDFrom(ctx),
+	}
 
-	// 如果未提供，使用上下文默认值
-	if channel == "" {
-		if toolCtx, ok := ToolContextFrom(ctx); ok {
-			channel = toolCtx.Channel
-		} else {
-			t.mu.RLock()
-			channel = t.channel
-			t.mu.RUnlock()
+	// 媒体参数（多个用逗号分隔）
+	if media, _ := params["media"].(string); media != "" {
+		for _, m := range strings.Split(media, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				msg.Media = append(msg.Media, m)
+			}
 		}
 	}
-	if chatID == "" {
-		if toolCtx, ok := ToolContextFrom(ctx); ok {
-			chatID = toolCtx.ChatID
-		} else {
-			t.mu.RLock()
-			chatID = t.chatID
-			t.mu.RUnlock()
-		}
+	mediaType, _ := params["media_type"].(string)
+	switch mediaType = strings.ToLower(strings.TrimSpace(mediaType)); mediaType {
+	case "", "photo", "document", "audio", "video":
+		msg.MediaType = mediaType
+	case "file":
+		msg.MediaType = "document"
+	default:
+		return "", fmt.Errorf("invalid media_type %q: use photo, document, audio or video", mediaType)
 	}
+	msg.Buttons, _ = params["buttons"].([]interface{})
 
-	// 构建消息对象
-	msg := map[string]interface{}{
-		"content": content,
+	targets, err := t.targets(ctx, params)
+	if err != nil {
+		return "", err
 	}
 
-	// 添加可选字段
-	if channel != "" {
-		msg["channel"] = channel
-	}
-	if chatID != "" {
-		msg["chat_id"] = chatID
+	for i, target := range targets {
+		msg.Channel, msg.ChatID = target[0], target[1]
+		msgJSON, err := json.Marshal(msg)
+		if err != nil {
+			return "", err
+		}
+
+		// 尝试发送到通道（非阻塞）
+		select {
+		case t.sendChan <- string(msgJSON):
+		default:
+			if i == 0 {
+				return "", fmt.Errorf("message channel not ready")
+			}
+			return "", fmt.Errorf("message channel full: sent to %d of %d recipients", i, len(targets))
+		}
 	}
-	if media != "" {
-		msg["media"] = media
+
+	if len(targets) > 1 {
+		return fmt.Sprintf("Message sent to %d recipients", len(targets)), nil
 	}
-	if mediaType != "" {
-		msg["media_type"] = mediaType
+	return "Message sent", nil
+}
+
+// targets 返回发送目标列表，每项为 [频道, 聊天ID]
+func (t *MessageTool) targets(ctx context.Context, params map[string]interface{}) ([][2]string, error) {
+	currentChannel, currentChatID := t.current(ctx)
+
+	recipients, _ := params["recipients"].([]interface{})
+	if len(recipients) == 0 {
+		channel, _ := params["channel"].(string)
+		chatID, _ := params["chat_id"].(string)
+		if channel == "" {
+			channel = currentChannel
+		}
+		if chatID == "" {
+			chatID = currentChatID
+		}
+		if channel == "" || chatID == "" {
+			return nil, fmt.Errorf("no current chat: specify channel and chat_id")
+		}
+		return [][2]string{{channel, chatID}}, nil
 	}
 
-	// 序列化为JSON
-	msgJSON, err := json.Marshal(msg)
-	if err != nil {
-		return "", err
+	if len(recipients) > maxMessageRecipients {
+		return nil, fmt.Errorf("too many recipients: %d (limit %d)", len(recipients), maxMessageRecipients)
 	}
+	targets := make([][2]string, 0, len(recipients))
+	seen := make(map[[2]string]bool, len(recipients))
+	for _, r := range recipients {
+		recipient, _ := r.(map[string]interface{})
+		channel, _ := recipient["channel"].(string)
+		chatID, _ := recipient["chat_id"].(string)
+		if channel == "" {
+			channel = currentChannel
+		}
+		if channel == "" || chatID == "" {
+			return nil, fmt.Errorf("invalid recipient %v: chat_id is required (and channel when there is no current chat)", r)
+		}
+		target := [2]string{channel, chatID}
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
 
-	// 尝试发送到通道（非阻塞）
-	select {
-	case t.sendChan <- string(msgJSON):
-		return "Message sent", nil
-	default:
-		return "", fmt.Errorf("message channel not ready")
+// current 返回当前的频道和聊天ID
+// 优先使用请求上下文中的工具上下文（并发处理多个会话时 SetContext 的值可能属于其他会话）
+func (t *MessageTool) current(ctx context.Context) (string, string) {
+	if toolCtx, ok := ToolContextFrom(ctx); ok {
+		return toolCtx.Channel, toolCtx.ChatID
 	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.channel, t.chatID
 }
@@ -0,0 +1,146 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// pin.go - 固定内容工具
+// 固定的内容（长期有效的指示，例如"始终用西班牙语回答"、"项目根目录是 X"）保存在会话元数据中，
+// 每次请求都放在上下文靠前的位置，不会随着历史消息超出 memoryWindow 而丢失。
+
+const (
+	// MaxPins 每个会话最多固定的条数
+	MaxPins = 10
+	// MaxPinLength 每条固定内容的最大字符数
+	MaxPinLength = 500
+)
+
+// PinStore 保存每个聊天的固定内容（由 Agent 实现）
+type PinStore interface {
+	// Pins 返回聊天的固定内容
+	Pins(channel, chatID string) []string
+	// SetPins 替换聊天的固定内容
+	SetPins(channel, chatID string, pins []string) error
+}
+
+// AddPin 把一条内容追加到固定列表
+// 返回:
+//
+//	新的固定列表；内容为空、过长、重复或超出条数上限时返回错误
+func AddPin(pins []string, text string) ([]string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("nothing to pin")
+	}
+	if len([]rune(text)) > MaxPinLength {
+		return nil, fmt.Errorf("pinned text is too long (%d characters, limit %d)", len([]rune(text)), MaxPinLength)
+	}
+	for _, pin := range pins {
+		if pin == text {
+			return nil, fmt.Errorf("already pinned")
+		}
+	}
+	if len(pins) >= MaxPins {
+		return nil, fmt.Errorf("too many pins (limit %d); remove one first", MaxPins)
+	}
+	return append(append([]string(nil), pins...), text), nil
+}
+
+// RemovePin 删除固定列表中的第 index 条（从 1 开始）
+func RemovePin(pins []string, index int) ([]string, error) {
+	if index < 1 || index > len(pins) {
+		return nil, fmt.Errorf("no pin #%d (there are %d)", index, len(pins))
+	}
+	result := append([]string(nil), pins[:index-1]...)
+	return append(result, pins[index:]...), nil
+}
+
+// FormatPins 把固定列表格式化为编号列表
+func FormatPins(pins []string) string {
+	lines := make([]string, len(pins))
+	for i, pin := range pins {
+		lines[i] = fmt.Sprintf("%d. %s", i+1, pin)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// PinTool 管理当前聊天的固定内容
+type PinTool struct {
+	BaseTool
+	store PinStore
+}
+
+// NewPinTool 创建固定内容工具
+// 参数:
+//
+//	store: 固定内容的存储
+func NewPinTool(store PinStore) *PinTool {
+	return &PinTool{
+		BaseTool: NewBaseTool(
+			"pin",
+			"Pin a standing instruction or fact to this conversation so it always stays in context, even after older messages scroll out (e.g. \"always answer in Spanish\", \"project root is ~/src/app\"). Only pin things the user wants to hold for the whole conversation.",
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"action": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"add", "list", "remove", "clear"},
+						"description": "add a pin, list pins, remove one by number, or clear all",
+					},
+					"text": map[string]interface{}{
+						"type":        "string",
+						"description": "Text to pin (for add)",
+					},
+					"index": map[string]interface{}{
+						"type":        "integer",
+						"description": "Pin number to remove, starting at 1 (for remove)",
+					},
+				},
+				"required": []string{"action"},
+			},
+		),
+		store: store,
+	}
+}
+
+// Execute 执行固定内容操作
+func (t *PinTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	toolCtx, ok := ToolContextFrom(ctx)
+	if !ok || toolCtx.Channel == "" || toolCtx.ChatID == "" {
+		return "", fmt.Errorf("pins are only available in a chat")
+	}
+	pins := t.store.Pins(toolCtx.Channel, toolCtx.ChatID)
+
+	action, _ := params["action"].(string)
+	var err error
+	switch action {
+	case "list":
+		if len(pins) == 0 {
+			return "No pins", nil
+		}
+		return FormatPins(pins), nil
+	case "add":
+		text, _ := params["text"].(string)
+		pins, err = AddPin(pins, text)
+	case "remove":
+		index, _ := params["index"].(float64)
+		pins, err = RemovePin(pins, int(index))
+	case "clear":
+		pins = nil
+	default:
+		return "", fmt.Errorf("unknown action %q (use add, list, remove or clear)", action)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := t.store.SetPins(toolCtx.Channel, toolCtx.ChatID, pins); err != nil {
+		return "", fmt.Errorf("failed to save pins: %w", err)
+	}
+	if len(pins) == 0 {
+		return "All pins removed", nil
+	}
+	return "Pins updated:\n" + FormatPins(pins), nil
+}
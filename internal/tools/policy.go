@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// policy.go - 工具权限策略
+// 此文件实现了工具调用的权限策略：按频道/用户/参数决定工具是自动执行、需要确认还是禁止
+
+// PolicyAction 表示策略对一次工具调用的处理方式
+type PolicyAction string
+
+const (
+	PolicyAuto    PolicyAction = "auto"    // 自动执行（默认）
+	PolicyConfirm PolicyAction = "confirm" // 执行前需要用户确认
+	PolicyDeny    PolicyAction = "deny"    // 禁止执行
+)
+
+// PolicyRule 描述一条工具权限规则
+// 所有非空条件都满足时规则才会命中
+type PolicyRule struct {
+	Tool     string            // 工具名称，"*" 表示所有工具
+	Action   PolicyAction      // 命中后的处理方式
+	Channels []string          // 限定频道（为空表示所有频道）
+	Users    []string          // 限定用户（为空表示所有用户）
+	Params   map[string]string // 参数匹配，键为参数名，值为正则表达式
+}
+
+// compiledRule 是预编译参数正则后的规则
+type compiledRule struct {
+	PolicyRule
+	params map[string]*regexp.Regexp
+}
+
+// ToolPolicy 按顺序匹配规则，第一条命中的规则生效
+// 没有规则命中时使用 PolicyAuto
+type ToolPolicy struct {
+	rules []compiledRule
+}
+
+// NewToolPolicy 创建工具权限策略
+// 参数:
+//
+//	rules: 规则列表，按顺序匹配
+//
+// 返回:
+//
+//	策略实例，规则配置错误时返回错误
+func NewToolPolicy(rules []PolicyRule) (*ToolPolicy, error) {
+	policy := &ToolPolicy{}
+	for i, rule := range rules {
+		action := PolicyAction(strings.ToLower(string(rule.Action)))
+		switch action {
+		case PolicyAuto, PolicyConfirm, PolicyDeny:
+		case "safe":
+			action = PolicyAuto
+		default:
+			return nil, fmt.Errorf("policy rule %d: unknown action %q (use auto, confirm or deny)", i, rule.Action)
+		}
+		if rule.Tool == "" {
+			return nil, fmt.Errorf("policy rule %d: tool is required", i)
+		}
+		rule.Action = action
+
+		compiled := compiledRule{PolicyRule: rule, params: make(map[string]*regexp.Regexp)}
+		for name, pattern := range rule.Params {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("policy rule %d: invalid pattern for %s: %w", i, name, err)
+			}
+			compiled.params[name] = re
+		}
+		policy.rules = append(policy.rules, compiled)
+	}
+	return policy, nil
+}
+
+// Decide 决定一次工具调用的处理方式
+// 参数:
+//
+//	toolName: 工具名称
+//	params: 工具参数
+//	channel: 当前频道
+//	senderID: 当前用户ID（Telegram 格式可能为 "id|username"）
+//
+// 返回:
+//
+//	命中规则的处理方式，没有命中时返回 PolicyAuto
+func (p *ToolPolicy) Decide(toolName string, params map[string]interface{}, channel, senderID string) PolicyAction {
+	if p == nil {
+		return PolicyAuto
+	}
+
+	for _, rule := range p.rules {
+		if rule.Tool != "*" && rule.Tool != toolName {
+			continue
+		}
+		if len(rule.Channels) > 0 && !containsString(rule.Channels, channel) {
+			continue
+		}
+		if len(rule.Users) > 0 && !matchUser(rule.Users, senderID) {
+			continue
+		}
+		if !matchParams(rule.params, params) {
+			continue
+		}
+		return rule.Action
+	}
+	return PolicyAuto
+}
+
+// stricter 返回两种处理方式中更严格的一种（deny > confirm > auto）
+func stricter(a, b PolicyAction) PolicyAction {
+	rank := map[PolicyAction]int{PolicyAuto: 0, PolicyConfirm: 1, PolicyDeny: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// matchUser 检查发送者是否在用户列表中
+// 支持匹配完整的 senderID，以及 "id|username" 中的任一部分
+func matchUser(users []string, senderID string) bool {
+	candidates := []string{senderID}
+	for _, part := range strings.Split(senderID, "|") {
+		candidates = append(candidates, part, "@"+part)
+	}
+	for _, candidate := range candidates {
+		if candidate != "" && containsString(users, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchParams 检查参数是否满足所有正则条件
+func matchParams(patterns map[string]*regexp.Regexp, params map[string]interface{}) bool {
+	for name, re := range patterns {
+		value, ok := params[name]
+		if !ok {
+			return false
+		}
+		if !re.MatchString(fmt.Sprintf("%v", value)) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
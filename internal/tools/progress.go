@@ -0,0 +1,135 @@
+package tools
+
+// progress.go - 长时间运行的工具报告中间进度
+// 工具通过 ReportToolProgress 报告百分比或最新的一行输出（例如 shell 的标准输出、web_fetch 已下载的字节数），
+// Agent 在调用工具时附加一个 ProgressReporter，节流后作为进度提示转发给用户，长命令不再看起来像卡住了。
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress 是工具执行过程中的一次进度更新
+type Progress struct {
+	Percent float64 // 完成百分比（0-100），小于 0 表示总量未知
+	Message string  // 最新的一行输出或简短说明
+}
+
+// ProgressReporter 接收正在执行的工具报告的进度
+// Report 可能在多个 goroutine 中并发调用，实现需要自行加锁和节流
+type ProgressReporter interface {
+	Report(p Progress)
+}
+
+type progressReporterKey struct{}
+
+// WithProgressReporter 在 ctx 中附加进度接收者
+func WithProgressReporter(ctx context.Context, r ProgressReporter) context.Context {
+	return context.WithValue(ctx, progressReporterKey{}, r)
+}
+
+// ReportToolProgress 把进度发送给 ctx 中的 ProgressReporter，没有接收者时忽略
+func ReportToolProgress(ctx context.Context, p Progress) {
+	if r, ok := ctx.Value(progressReporterKey{}).(ProgressReporter); ok && r != nil {
+		r.Report(p)
+	}
+}
+
+// progressWriter 把写入的内容保存到 buf，同时把最后一个完整的非空行作为进度报告
+// 进度条通常用 \r 覆盖同一行，因此 \r 也视为行结束
+type progressWriter struct {
+	ctx     context.Context
+	buf     *bytes.Buffer
+	partial []byte      // 尚未结束的行
+	tail    *outputTail // 不为 nil 时同时记录最后一行（shell 的 interactive 模式）
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.buf.Write(p)
+	data := append(w.partial, p...)
+	end := bytes.LastIndexAny(data, "\r\n")
+	if end == -1 {
+		w.partial = data
+		w.tail.update(string(data), true)
+		return n, err
+	}
+	lines := strings.FieldsFunc(string(data[:end]), func(r rune) bool { return r == '\r' || r == '\n' })
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			ReportToolProgress(w.ctx, Progress{Percent: -1, Message: line})
+			if end == len(data)-1 {
+				w.tail.update(line, false)
+			}
+			break
+		}
+	}
+	w.partial = append([]byte(nil), data[end+1:]...)
+	if len(w.partial) > 0 {
+		w.tail.update(string(w.partial), true)
+	}
+	return n, err
+}
+
+// outputTail 记录命令最近输出的一行，用于判断命令是否在等待输入
+type outputTail struct {
+	mu      sync.Mutex
+	line    string    // 最后一行输出
+	partial bool      // 最后一行还没有换行（提示通常不换行）
+	updated time.Time // 最后一次输出的时间
+	seq     int       // 输出的次数，用于避免对同一个提示重复询问
+}
+
+// update 记录新的最后一行，tail 为 nil 时忽略
+func (o *outputTail) update(line string, partial bool) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.line = strings.TrimSpace(line)
+	o.partial = partial
+	o.updated = time.Now()
+	o.seq++
+}
+
+// waiting 判断命令是否在等待输入：seen 之后有新的输出，已经 idle 没有输出，且最后一行像是提示
+// 返回:
+//
+//	提示内容、当前的输出次数，以及是否在等待输入
+func (o *outputTail) waiting(idle time.Duration, seen int) (string, int, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.seq == seen || o.line == "" || time.Since(o.updated) < idle {
+		return "", o.seq, false
+	}
+	if !o.partial && !strings.ContainsAny(o.line[len(o.line)-1:], ":?>])") {
+		return "", o.seq, false
+	}
+	return o.line, o.seq, true
+}
+
+// progressReader 统计已读取的字节数并报告下载进度
+type progressReader struct {
+	ctx   context.Context
+	r     io.Reader
+	read  int64
+	total int64 // 预期的总字节数，<= 0 表示未知
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.read += int64(n)
+		percent := -1.0
+		if r.total > 0 {
+			percent = min(float64(r.read)*100/float64(r.total), 100)
+		}
+		ReportToolProgress(r.ctx, Progress{Percent: percent, Message: fmt.Sprintf("%d KB downloaded", r.read/1024)})
+	}
+	return n, err
+}
@@ -2,19 +2,59 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path"
 	"sort"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Ailoc/nanogrip/internal/trace"
 )
 
 // registry.go - 工具注册表
 // 此文件实现了工具的注册、管理和执行功能，提供线程安全的工具注册中心
 
+const (
+	// maxToolRetries 临时失败的工具调用最多重试的次数
+	maxToolRetries = 2
+	// toolRetryDelay 第一次重试前的等待时间，之后每次翻倍
+	toolRetryDelay = time.Second
+)
+
 // ToolRegistry 管理工具的注册和执行
 // 提供线程安全的工具注册、查询和执行服务
 type ToolRegistry struct {
-	mu    sync.RWMutex    // 读写互斥锁，保证并发安全
-	tools map[string]Tool // 工具映射表，键为工具名称，值为工具实例
+	mu        sync.RWMutex            // 读写互斥锁，保证并发安全
+	tools     map[string]Tool         // 工具映射表，键为工具名称，值为工具实例
+	overrides map[string]ToolOverride // 工具描述覆盖，键为工具名称
+	policy    *ToolPolicy             // 工具权限策略（nil 表示全部自动执行）
+	approver  Approver                // 需要确认的工具调用的审批者（nil 表示无法审批）
+	allowed   []string                // 允许注册的工具名称（支持 * 通配符，为空表示不限制）
+	readOnly  bool                    // 文件系统只读（见 Scope）
+
+	hooks *toolHooks // 工具执行钩子（与所有视图共享，见 hooks.go）
+
+	interactor Interactor // 等待输入的命令通过它询问用户（nil 表示不支持交互，见 interaction.go）
+}
+
+// Scope 描述注册表的一个受限视图
+// 用于无人值守的执行（例如 Agent 模式的定时任务），限制其可以使用的工具
+type Scope struct {
+	Allow    []string // 允许的工具名称（支持 * 通配符，为空表示不限制）
+	Deny     []string // 禁止的工具名称（支持 * 通配符），优先于 Allow
+	ReadOnly bool     // 文件系统只读：禁止 filesystem 的 write、delete、patch 操作，并移除执行命令的工具（见 isShellTool）
+	NoShell  bool     // 禁止执行命令的工具：shell、tmux、code_exec 和技能命令 skill_*
+}
+
+// ToolOverride 描述对某个工具 schema 的覆盖
+// 用于在配置中调整工具描述，而无需修改代码
+type ToolOverride struct {
+	Description    string            // 替换工具描述（为空表示保留原描述）
+	ParameterHints map[string]string // 追加到参数描述后的提示，键为参数名
+	Examples       []string          // 追加到工具描述末尾的使用示例
 }
 
 // NewToolRegistry 创建一个新的工具注册表
@@ -22,6 +62,7 @@ type ToolRegistry struct {
 func NewToolRegistry() *ToolRegistry {
 	return &ToolRegistry{
 		tools: make(map[string]Tool),
+		hooks: &toolHooks{},
 	}
 }
 
@@ -33,9 +74,116 @@ func NewToolRegistry() *ToolRegistry {
 func (r *ToolRegistry) Register(tool Tool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	if !r.isAllowed(tool.Name()) {
+		return
+	}
 	r.tools[tool.Name()] = tool
 }
 
+// SetAllowed 限制注册表中可以使用的工具
+// 设置后不在列表中的工具会在 Register 时被忽略，已注册的工具也会被移除
+// 参数:
+//
+//	names: 工具名称，支持 * 通配符（例如 "mcp_*"），为空表示不限制
+func (r *ToolRegistry) SetAllowed(names []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.allowed = names
+	for name := range r.tools {
+		if !r.isAllowed(name) {
+			delete(r.tools, name)
+		}
+	}
+}
+
+// isAllowed 检查工具名称是否在允许列表中（调用者需持有锁）
+func (r *ToolRegistry) isAllowed(name string) bool {
+	return len(r.allowed) == 0 || matchAny(r.allowed, name)
+}
+
+// matchAny 检查名称是否匹配任一模式（支持 * 通配符）
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Scoped 返回只包含 scope 允许的工具的注册表视图
+// 视图与原注册表共享工具实例、描述覆盖、权限策略、审批者和钩子；之后注册到原注册表的工具不会出现在视图中
+// 设置了任何限制时同时移除 spawn，子代理不应成为绕过限制的途径
+// （子代理只能使用生成它的注册表视图中的工具，见 RegistryFrom）
+// 参数:
+//
+//	scope: 视图的限制
+//
+// 返回:
+//
+//	新的注册表视图
+func (r *ToolRegistry) Scoped(scope Scope) *ToolRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	view := &ToolRegistry{
+		tools:     make(map[string]Tool),
+		overrides: r.overrides,
+		policy:    r.policy,
+		approver:  r.approver,
+		allowed:   scope.Allow,
+		readOnly:  r.readOnly || scope.ReadOnly,
+		hooks:     r.hooks,
+
+		interactor: r.interactor,
+	}
+	for name, tool := range r.tools {
+		if !view.isAllowed(name) || matchAny(scope.Deny, name) {
+			continue
+		}
+		// 命令可以修改文件，只读视图同样不提供；Deny 中禁止了 shell 时也不提供其他执行命令的工具
+		if isShellTool(name) && (scope.NoShell || scope.ReadOnly || matchAny(scope.Deny, "shell")) {
+			continue
+		}
+		if (scope.NoShell || scope.ReadOnly || len(scope.Deny) > 0 || len(scope.Allow) > 0) && name == "spawn" {
+			continue
+		}
+		view.tools[name] = tool
+	}
+	return view
+}
+
+// isShellTool 判断工具是否执行任意命令：shell、tmux、code_exec，以及通过 shell 工具执行的技能命令 skill_*
+func isShellTool(name string) bool {
+	switch name {
+	case "shell", "tmux", "code_exec":
+		return true
+	}
+	return strings.HasPrefix(name, "skill_")
+}
+
+// registryKey 是上下文中保存正在执行工具的注册表的键
+type registryKey struct{}
+
+// RegistryFrom 返回正在执行当前工具的注册表（可能是受限视图），不在工具执行中时返回 nil
+// spawn 据此让子代理只能使用调用者可以使用的工具
+func RegistryFrom(ctx context.Context) *ToolRegistry {
+	registry, _ := ctx.Value(registryKey{}).(*ToolRegistry)
+	return registry
+}
+
+// writesFiles 判断一次工具调用是否会修改文件系统（只读视图中禁止）
+func writesFiles(name string, params map[string]interface{}) bool {
+	if name != "filesystem" {
+		return false
+	}
+	switch operation, _ := params["operation"].(string); operation {
+	case "write", "delete", "patch":
+		return true
+	}
+	return false
+}
+
 // Unregister 注销一个工具
 // 从注册表中移除指定名称的工具
 // 参数:
@@ -93,14 +241,200 @@ func (r *ToolRegistry) GetDefinitions() []map[string]interface{} {
 
 	definitions := make([]map[string]interface{}, 0, len(r.tools))
 	for _, name := range names {
-		definitions = append(definitions, r.tools[name].ToSchema())
+		schema := r.tools[name].ToSchema()
+		if override, ok := r.overrides[name]; ok {
+			schema = applyToolOverride(schema, override)
+		}
+		definitions = append(definitions, schema)
 	}
 
 	return definitions
 }
 
+// SetOverrides 设置工具描述覆盖
+// 覆盖在 GetDefinitions 时应用，因此对之后注册的工具（如 MCP 工具）同样生效
+// 参数:
+//
+//	overrides: 键为工具名称的覆盖配置
+func (r *ToolRegistry) SetOverrides(overrides map[string]ToolOverride) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.overrides = overrides
+}
+
+// SetPolicy 设置工具权限策略
+// 参数:
+//
+//	policy: 权限策略，nil 表示所有工具自动执行
+func (r *ToolRegistry) SetPolicy(policy *ToolPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policy = policy
+}
+
+// SetApprover 设置审批者
+// 策略要求确认的工具调用会通过审批者询问用户
+// 参数:
+//
+//	approver: 审批者，nil 表示需要确认的工具调用一律拒绝
+func (r *ToolRegistry) SetApprover(approver Approver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.approver = approver
+}
+
+// SetInteractor 设置等待输入的命令询问用户的方式
+// 工具执行时通过 InteractorFrom(ctx) 获取（例如 shell 工具的 interactive 模式）
+// 参数:
+//
+//	interactor: 输入转发者，nil 表示命令无法向用户询问输入
+func (r *ToolRegistry) SetInteractor(interactor Interactor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interactor = interactor
+}
+
+// checkPolicy 根据权限策略检查一次工具调用
+// 返回:
+//
+//	允许执行时为 nil，否则为没有执行的调用结果
+func (r *ToolRegistry) checkPolicy(ctx context.Context, name string, params map[string]interface{}) *ToolResult {
+	r.mu.RLock()
+	policy := r.policy
+	approver := r.approver
+	r.mu.RUnlock()
+
+	toolCtx, _ := ToolContextFrom(ctx)
+	action := policy.Decide(name, params, toolCtx.Channel, toolCtx.SenderID)
+	// 技能命令通过 shell 执行，shell 工具的规则同样适用（按实际执行的命令匹配参数），取更严格的处理方式
+	if skill, ok := r.Get(name).(*SkillTool); ok {
+		shellParams := map[string]interface{}{"command": skill.commandLine(params)}
+		action = stricter(action, policy.Decide("shell", shellParams, toolCtx.Channel, toolCtx.SenderID))
+	}
+	switch action {
+	case PolicyDeny:
+		return denied(CodeDenied, fmt.Sprintf(`Error: Tool '%s' is not allowed by policy in this chat`, name))
+	case PolicyConfirm:
+		if approver == nil {
+			return denied(CodeDenied, fmt.Sprintf(`Error: Tool '%s' requires user confirmation, but approval is not available in this channel`, name))
+		}
+
+		args := JSONString(params)
+		if len(args) > 500 {
+			// 在字符边界截断，避免截出不完整的 UTF-8 字符
+			cut := 500
+			for cut > 0 && !utf8.RuneStart(args[cut]) {
+				cut--
+			}
+			args = args[:cut] + "..."
+		}
+		prompt := fmt.Sprintf("⚠️ Approval required: the agent wants to run `%s`\n\n%s", name, args)
+
+		approved, answer, err := approver.RequestApproval(ctx, toolCtx.Channel, toolCtx.ChatID, prompt)
+		if err != nil {
+			return denied(CodeDenied, fmt.Sprintf(`Error: Tool '%s' was not executed: approval failed: %v`, name, err))
+		}
+		if !approved {
+			return denied(CodeDeclined, fmt.Sprintf(`Tool '%s' was not executed: the user declined (reply: %q). Do not retry this action unless the user asks again.`, name, answer))
+		}
+	}
+	return nil
+}
+
+// denied 返回一次没有执行的调用结果，message 同时作为返回给模型的内容和错误
+func denied(code ErrorCode, message string) *ToolResult {
+	return &ToolResult{Status: StatusDenied, Content: message, Code: code, Err: errors.New(message)}
+}
+
+// failed 返回一次执行失败的调用结果
+func failed(code ErrorCode, message string, err error) ToolResult {
+	if err == nil {
+		err = errors.New(message)
+	}
+	return ToolResult{Status: StatusError, Content: message, Code: code, Err: err}
+}
+
+// applyToolOverride 将覆盖配置应用到工具 schema
+// 不会修改工具自身的 schema，而是返回一份修改后的副本
+// 参数:
+//
+//	schema: 工具的 OpenAI 格式 schema
+//	override: 覆盖配置
+//
+// 返回:
+//
+//	应用覆盖后的 schema
+func applyToolOverride(schema map[string]interface{}, override ToolOverride) map[string]interface{} {
+	fn, ok := schema["function"].(map[string]interface{})
+	if !ok {
+		return schema
+	}
+
+	newFn := make(map[string]interface{}, len(fn))
+	for k, v := range fn {
+		newFn[k] = v
+	}
+
+	// 替换描述并追加使用示例
+	description, _ := newFn["description"].(string)
+	if override.Description != "" {
+		description = override.Description
+	}
+	if len(override.Examples) > 0 {
+		var sb strings.Builder
+		sb.WriteString(description)
+		sb.WriteString("\n\nExamples:")
+		for _, example := range override.Examples {
+			sb.WriteString("\n- ")
+			sb.WriteString(example)
+		}
+		description = sb.String()
+	}
+	newFn["description"] = description
+
+	// 追加参数提示
+	if params, ok := newFn["parameters"].(map[string]interface{}); ok && len(override.ParameterHints) > 0 {
+		newParams := make(map[string]interface{}, len(params))
+		for k, v := range params {
+			newParams[k] = v
+		}
+
+		if props, ok := params["properties"].(map[string]interface{}); ok {
+			newProps := make(map[string]interface{}, len(props))
+			for k, v := range props {
+				newProps[k] = v
+			}
+			for paramName, hint := range override.ParameterHints {
+				prop, ok := props[paramName].(map[string]interface{})
+				if !ok || hint == "" {
+					continue
+				}
+				newProp := make(map[string]interface{}, len(prop))
+				for k, v := range prop {
+					newProp[k] = v
+				}
+				if existing, _ := prop["description"].(string); existing != "" {
+					newProp["description"] = existing + " " + hint
+				} else {
+					newProp["description"] = hint
+				}
+				newProps[paramName] = newProp
+			}
+			newParams["properties"] = newProps
+		}
+		newFn["parameters"] = newParams
+	}
+
+	newSchema := make(map[string]interface{}, len(schema))
+	for k, v := range schema {
+		newSchema[k] = v
+	}
+	newSchema["function"] = newFn
+	return newSchema
+}
+
 // Execute 根据名称执行工具
-// 这是工具执行的入口函数，负责查找、验证和执行工具
+// 这是工具执行的入口函数，负责调用钩子，以及查找、验证、权限检查和执行工具（临时失败时自动重试）
 // 参数:
 //
 //	ctx: 上下文对象，用于控制超时和取消
@@ -109,26 +443,80 @@ func (r *ToolRegistry) GetDefinitions() []map[string]interface{} {
 //
 // 返回:
 //
-//	工具执行结果的字符串表示
-func (r *ToolRegistry) Execute(ctx context.Context, name string, params map[string]interface{}) string {
+//	工具调用的结果，Content 已经过执行后钩子处理
+func (r *ToolRegistry) Execute(ctx context.Context, name string, params map[string]interface{}) ToolResult {
+	start := time.Now()
+	var result ToolResult
+	if blocked := r.hooks.runPreHooks(ctx, name, params); blocked != "" {
+		result = *denied(CodeBlocked, blocked)
+	} else {
+		result = r.execute(ctx, name, params)
+	}
+	result.Content = r.hooks.runPostHooks(ctx, name, params, result.Content, result.Err, time.Since(start))
+	return result
+}
+
+// execute 查找、验证、检查权限并执行工具
+// 临时失败（CodeTransient）时只重试工具本身：钩子、权限检查和用户确认只进行一次
+func (r *ToolRegistry) execute(ctx context.Context, name string, params map[string]interface{}) ToolResult {
 	// 查找工具
 	tool := r.Get(name)
 	if tool == nil {
-		return fmt.Sprintf(`Error: Tool '%s' not found`, name)
+		return failed(CodeNotFound, fmt.Sprintf(`Error: Tool '%s' not found`, name), nil)
 	}
 
 	// 验证参数
-	if errors := tool.ValidateParams(params); len(errors) > 0 {
-		return fmt.Sprintf(`Error: Invalid parameters for tool '%s': %v`, name, errors)
+	if errs := tool.ValidateParams(params); len(errs) > 0 {
+		return failed(CodeInvalidParams, fmt.Sprintf(`Error: Invalid parameters for tool '%s': %v`, name, errs), nil)
+	}
+
+	if r.readOnly && writesFiles(name, params) {
+		return *denied(CodeDenied, fmt.Sprintf(`Error: Tool '%s' cannot modify files: the filesystem is read-only in this run`, name))
+	}
+
+	// 检查权限策略（可能需要等待用户确认）
+	if result := r.checkPolicy(ctx, name, params); result != nil {
+		return *result
 	}
 
-	// 执行工具
+	r.mu.RLock()
+	interactor := r.interactor
+	r.mu.RUnlock()
+	if interactor != nil {
+		ctx = WithInteractor(ctx, interactor)
+	}
+	ctx = context.WithValue(ctx, registryKey{}, r)
+
+	delay := toolRetryDelay
+	for attempt := 0; ; attempt++ {
+		result := r.run(ctx, tool, name, params)
+		result.Retries = attempt
+		if !result.Retryable() || attempt == maxToolRetries {
+			return result
+		}
+		trace.Logf(ctx, "[Tool] %s 临时失败，%s 后重试 (%d/%d): %v", name, delay, attempt+1, maxToolRetries, result.Err)
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// run 执行一次工具（记录在消息的追踪中）
+func (r *ToolRegistry) run(ctx context.Context, tool Tool, name string, params map[string]interface{}) ToolResult {
+	ctx, span := trace.Start(ctx, "tool.execute", "tool", name)
 	result, err := tool.Execute(ctx, params)
+	span.End(err)
 	if err != nil {
-		return fmt.Sprintf(`Error executing %s: %v`, name, err)
+		code := errorCode(ctx, err)
+		trace.Logf(ctx, "[Tool] %s 执行失败 (%s, %s): %v", name, span.Duration().Round(time.Millisecond), code, err)
+		return failed(code, fmt.Sprintf(`Error executing %s: %v`, name, err), err)
 	}
+	trace.Logf(ctx, "[Tool] %s 执行完成 (%s)", name, span.Duration().Round(time.Millisecond))
 
-	return result
+	return ToolResult{Status: StatusOK, Content: result}
 }
 
 // ToolNames 返回所有已注册工具的名称列表
@@ -0,0 +1,125 @@
+package tools
+
+// result.go - 工具调用的结构化结果
+// 工具通过返回的 error 报告失败，注册表把结果整理为 ToolResult：
+// 返回给模型的内容之外，还带有状态和错误码，调用方据此决定是否重试、如何统计，而不必解析结果文本。
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+)
+
+// ToolStatus 表示一次工具调用的结果状态
+type ToolStatus string
+
+const (
+	// StatusOK 工具执行成功
+	StatusOK ToolStatus = "ok"
+	// StatusError 工具不存在、参数无效或执行失败
+	StatusError ToolStatus = "error"
+	// StatusDenied 工具没有执行：被钩子、权限策略、只读限制拦截，或用户拒绝
+	StatusDenied ToolStatus = "denied"
+)
+
+// ErrorCode 说明工具调用失败的原因
+type ErrorCode string
+
+const (
+	CodeNotFound      ErrorCode = "not_found"      // 工具不存在
+	CodeInvalidParams ErrorCode = "invalid_params" // 缺少必需参数
+	CodeBlocked       ErrorCode = "blocked"        // 被执行前的钩子拦截
+	CodeDenied        ErrorCode = "denied"         // 被权限策略或只读限制禁止
+	CodeDeclined      ErrorCode = "declined"       // 用户拒绝了确认请求
+	CodeCanceled      ErrorCode = "canceled"       // 调用的上下文被取消
+	CodeTimeout       ErrorCode = "timeout"        // 执行超时
+	CodeTransient     ErrorCode = "transient"      // 临时故障（网络错误、限流、服务端错误），可以重试
+	CodeFailed        ErrorCode = "failed"         // 其他执行错误
+)
+
+// ToolResult 是一次工具调用的结果
+type ToolResult struct {
+	Status  ToolStatus // 结果状态
+	Content string     // 返回给模型的内容（失败时为错误信息，已经过执行后钩子处理）
+	Code    ErrorCode  // 失败原因，成功时为空
+	Err     error      // 失败时的错误，成功时为 nil
+	Retries int        // 临时失败后重试的次数（见 ToolRegistry.execute）
+}
+
+// OK 判断工具是否执行成功
+func (r ToolResult) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Retryable 判断失败是否是临时的，可以原样重试
+func (r ToolResult) Retryable() bool {
+	return r.Code == CodeTransient
+}
+
+// String 返回给模型的内容
+func (r ToolResult) String() string {
+	return r.Content
+}
+
+// transientError 标记可以重试的错误
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// Transient 把 err 标记为临时错误，注册表会以 CodeTransient 报告，代理循环会重试这次调用
+// 只应用于重试没有副作用的操作（例如搜索、GET 请求）
+// 参数:
+//
+//	err: 原始错误，为 nil 时返回 nil
+func Transient(err error) error {
+	if err == nil || IsTransient(err) {
+		return err
+	}
+	return &transientError{err: err}
+}
+
+// IsTransient 判断 err 是否被标记为临时错误（包括被 fmt.Errorf 的 %w 包装的情况）
+func IsTransient(err error) bool {
+	var t *transientError
+	return errors.As(err, &t)
+}
+
+// transientNetwork 把网络层的错误（连接失败、超时）标记为临时错误，其他错误原样返回
+// http.Client 返回的 *url.Error 本身也实现了 net.Error，因此检查它包装的错误，
+// 避免把重定向检查等拒绝请求的错误当作临时错误
+func transientNetwork(err error) error {
+	inner := err
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		inner = urlErr.Err
+	}
+	var netErr net.Error
+	if errors.As(inner, &netErr) {
+		return Transient(err)
+	}
+	return err
+}
+
+// transientStatus 判断 HTTP 状态码是否表示临时故障（429 和 5xx）
+func transientStatus(code int) bool {
+	return code == 429 || code >= 500
+}
+
+// errorCode 根据工具返回的错误确定错误码
+func errorCode(ctx context.Context, err error) ErrorCode {
+	var netErr net.Error
+	switch {
+	case ctx.Err() != nil:
+		// 调用本身被取消（例如 /stop），重试没有意义
+		return CodeCanceled
+	case IsTransient(err):
+		return CodeTransient
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return CodeTimeout
+	}
+	return CodeFailed
+}
@@ -0,0 +1,216 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// sandbox.go - Shell 命令执行沙箱
+// 此文件实现了在受限环境中执行 shell 命令的功能：
+//   - bwrap: 使用 bubblewrap 只读挂载系统目录（见 bwrapSystemPaths），只有工作空间可写，通过 ulimit 限制内存和 CPU 时间；
+//     主目录（包括 ~/.nanogrip 中的配置文件和密钥）和其他主机文件在沙箱中不可见
+//   - docker: 在一次性容器中执行，根文件系统只读，通过 --cpus/--memory 限制资源
+
+// 沙箱模式
+const (
+	SandboxNone   = "none"
+	SandboxBwrap  = "bwrap"
+	SandboxDocker = "docker"
+)
+
+// SandboxOptions 沙箱配置
+type SandboxOptions struct {
+	Mode      string  // 沙箱模式: none、bwrap、docker
+	Workspace string  // 工作空间路径（沙箱内唯一可写的目录）
+	Image     string  // docker 镜像
+	CPUs      float64 // CPU 上限（docker --cpus）
+	MemoryMB  int     // 内存上限（MB），0 表示不限制
+	Network   bool    // 是否允许联网
+}
+
+// bwrapSystemPaths 是 bwrap 沙箱中只读挂载的系统路径（不存在的路径跳过）
+// 只包含执行常用命令所需的程序、库和 /etc 中的必要文件，不挂载整个根文件系统
+var bwrapSystemPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32", "/opt",
+	"/etc/alternatives", "/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d",
+	"/etc/ssl", "/etc/ca-certificates", "/etc/pki",
+	"/etc/passwd", "/etc/group", "/etc/nsswitch.conf", "/etc/localtime",
+	"/etc/hosts", "/etc/resolv.conf", "/run/systemd/resolve",
+}
+
+// Sandbox 把 shell 命令包装为在受限环境中执行的命令
+type Sandbox struct {
+	opts SandboxOptions
+}
+
+// NewSandbox 创建命令执行沙箱
+// 参数:
+//
+//	opts: 沙箱配置
+//
+// 返回:
+//
+//	沙箱实例；模式为 none（或空）时返回 nil
+//	模式未知或所需程序未安装时返回错误
+func NewSandbox(opts SandboxOptions) (*Sandbox, error) {
+	switch opts.Mode {
+	case "", SandboxNone:
+		return nil, nil
+	case SandboxBwrap, SandboxDocker:
+		if _, err := exec.LookPath(opts.Mode); err != nil {
+			return nil, fmt.Errorf("sandbox %q is not installed: %w", opts.Mode, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown sandbox mode %q (expected none, bwrap or docker)", opts.Mode)
+	}
+
+	if opts.Workspace == "" {
+		return nil, fmt.Errorf("sandbox requires a workspace directory")
+	}
+	if err := os.MkdirAll(opts.Workspace, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	return &Sandbox{opts: opts}, nil
+}
+
+// Mode 返回沙箱模式
+func (s *Sandbox) Mode() string {
+	return s.opts.Mode
+}
+
+// Command 创建在沙箱中执行的命令
+// 参数:
+//
+//	ctx: 上下文（超时后命令会被终止）
+//	shell: 要执行的 shell（如 /bin/sh）
+//	args: shell 参数（如 -c "command"）
+//	timeout: 命令超时时间（bwrap 用于限制 CPU 秒数）
+//	dir: 主机上的工作目录，为空表示工作空间；工作空间之外的目录以只读方式挂载到沙箱中
+//
+// 返回:
+//
+//	命令实例，以及超时后用于清理沙箱的函数（可能为 nil）
+func (s *Sandbox) Command(ctx context.Context, shell string, args []string, timeout time.Duration, dir string) (*exec.Cmd, func()) {
+	if s.opts.Mode == SandboxDocker {
+		return s.dockerCommand(ctx, shell, args, dir)
+	}
+	return s.bwrapCommand(ctx, shell, args, timeout, dir), nil
+}
+
+// inWorkspace 返回 dir 相对于工作空间的路径，dir 不在工作空间中时返回 false
+func (s *Sandbox) inWorkspace(dir string) (string, bool) {
+	ws, err := filepath.Abs(s.opts.Workspace)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(ws, dir)
+	if err != nil || (rel != "." && !filepath.IsLocal(rel)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// bwrapCommand 使用 bubblewrap 包装命令
+func (s *Sandbox) bwrapCommand(ctx context.Context, shell string, args []string, timeout time.Duration, dir string) *exec.Cmd {
+	ws := s.opts.Workspace
+	chdir := ws
+	var extra []string
+	if dir != "" {
+		chdir = dir
+		if _, ok := s.inWorkspace(dir); !ok {
+			extra = append(extra, "--ro-bind", dir, dir)
+		}
+	}
+
+	var bwrapArgs []string
+	for _, path := range bwrapSystemPaths {
+		bwrapArgs = append(bwrapArgs, "--ro-bind-try", path, path)
+	}
+	bwrapArgs = append(bwrapArgs,
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		"--bind", ws, ws,
+	)
+	bwrapArgs = append(bwrapArgs, extra...)
+	bwrapArgs = append(bwrapArgs,
+		"--chdir", chdir,
+		"--setenv", "HOME", ws, // 主机的主目录不可见
+		"--unshare-all",
+		"--die-with-parent",
+		"--new-session",
+	)
+	if s.opts.Network {
+		bwrapArgs = append(bwrapArgs, "--share-net")
+	}
+
+	// bwrap 本身不限制资源，通过 ulimit 限制内存（虚拟内存）和 CPU 时间
+	// "$0" "$@" 会原样执行被包装的 shell 和参数
+	limits := ""
+	if s.opts.MemoryMB > 0 {
+		limits += fmt.Sprintf("ulimit -v %d; ", s.opts.MemoryMB*1024)
+	}
+	if timeout > 0 {
+		limits += fmt.Sprintf("ulimit -t %d; ", int(math.Ceil(timeout.Seconds())))
+	}
+	bwrapArgs = append(bwrapArgs, "--", "/bin/sh", "-c", limits+`exec "$0" "$@"`, shell)
+	bwrapArgs = append(bwrapArgs, args...)
+
+	return exec.CommandContext(ctx, SandboxBwrap, bwrapArgs...)
+}
+
+// dockerCommand 使用一次性 docker 容器包装命令
+// 超时后终止 docker 客户端并不会停止容器，因此返回一个 docker kill 清理函数
+func (s *Sandbox) dockerCommand(ctx context.Context, shell string, args []string, dir string) (*exec.Cmd, func()) {
+	name := "nanogrip-sh-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	// 工作目录映射为容器中的路径：工作空间中的目录位于 /workspace 下，其他目录只读挂载到 /skill
+	workdir := "/workspace"
+	var mounts []string
+	if dir != "" {
+		if rel, ok := s.inWorkspace(dir); ok {
+			workdir = "/workspace/" + filepath.ToSlash(rel)
+		} else {
+			workdir = "/skill"
+			mounts = append(mounts, "-v", dir+":/skill:ro")
+		}
+	}
+
+	dockerArgs := []string{
+		"run", "--rm",
+		"-i", // 保持标准输入打开，interactive 模式的命令需要读取用户的答复
+		"--name", name,
+		"--read-only",
+		"--tmpfs", "/tmp",
+		"--pids-limit", "256",
+		"--security-opt", "no-new-privileges",
+		"-v", s.opts.Workspace + ":/workspace",
+		"-w", workdir,
+		"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+	}
+	dockerArgs = append(dockerArgs, mounts...)
+	if !s.opts.Network {
+		dockerArgs = append(dockerArgs, "--network", "none")
+	}
+	if s.opts.CPUs > 0 {
+		dockerArgs = append(dockerArgs, "--cpus", strconv.FormatFloat(s.opts.CPUs, 'f', -1, 64))
+	}
+	if s.opts.MemoryMB > 0 {
+		dockerArgs = append(dockerArgs, "--memory", fmt.Sprintf("%dm", s.opts.MemoryMB))
+	}
+	dockerArgs = append(dockerArgs, s.opts.Image, shell)
+	dockerArgs = append(dockerArgs, args...)
+
+	kill := func() {
+		killCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = exec.CommandContext(killCtx, SandboxDocker, "kill", name).Run()
+	}
+	return exec.CommandContext(ctx, SandboxDocker, dockerArgs...), kill
+}
@@ -0,0 +1,42 @@
+package tools
+
+// scope.go - 按频道和聊天限制工具
+// 例如邮件频道不提供 shell，群聊中文件系统只读。受限的工具不会出现在发给模型的工具定义中，
+// 模型即使调用也会得到"工具不存在"的错误。
+
+// ScopeRule 描述一条按频道和聊天限制工具的规则
+// Channels 和 Chats 都满足时规则命中，所有命中的规则同时生效
+type ScopeRule struct {
+	Channels []string // 限定频道（为空表示所有频道）
+	Chats    []string // 限定聊天 ID，支持 * 通配符（例如 Telegram 群组的 "-*"），为空表示所有聊天
+	Scope             // 命中后的限制
+}
+
+// matches 检查规则是否适用于指定的聊天
+func (rule ScopeRule) matches(channel, chatID string) bool {
+	if len(rule.Channels) > 0 && !containsString(rule.Channels, channel) {
+		return false
+	}
+	return len(rule.Chats) == 0 || matchAny(rule.Chats, chatID)
+}
+
+// ScopedFor 返回应用了所有命中规则的注册表视图（见 Scoped）
+// 多条规则命中时依次应用，结果是这些限制的交集
+// 参数:
+//
+//	rules: 限制规则
+//	channel: 当前频道
+//	chatID: 当前聊天 ID
+//
+// 返回:
+//
+//	没有规则命中时返回注册表本身，否则返回受限视图
+func (r *ToolRegistry) ScopedFor(rules []ScopeRule, channel, chatID string) *ToolRegistry {
+	registry := r
+	for _, rule := range rules {
+		if rule.matches(channel, chatID) {
+			registry = registry.Scoped(rule.Scope)
+		}
+	}
+	return registry
+}
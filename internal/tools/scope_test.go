@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// stubTool 是只有名称的测试工具
+type stubTool struct {
+	BaseTool
+}
+
+func (t *stubTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	return "ok", nil
+}
+
+func newStubRegistry(names ...string) *ToolRegistry {
+	registry := NewToolRegistry()
+	for _, name := range names {
+		registry.Register(&stubTool{BaseTool: NewBaseTool(name, name, map[string]interface{}{"type": "object"})})
+	}
+	return registry
+}
+
+func TestScoped(t *testing.T) {
+	all := []string{"code_exec", "filesystem", "shell", "skill_deploy", "spawn", "tmux", "web_fetch"}
+
+	tests := []struct {
+		name  string
+		scope Scope
+		want  []string
+	}{
+		{"no restriction", Scope{}, all},
+		{"no shell", Scope{NoShell: true}, []string{"filesystem", "web_fetch"}},
+		{"read only", Scope{ReadOnly: true}, []string{"filesystem", "web_fetch"}},
+		{"deny shell drops every shell tool", Scope{Deny: []string{"shell"}}, []string{"filesystem", "web_fetch"}},
+		{"deny wildcard", Scope{Deny: []string{"web_*"}}, []string{"code_exec", "filesystem", "shell", "skill_deploy", "tmux"}},
+		{"allow list drops spawn", Scope{Allow: []string{"filesystem", "spawn", "skill_*"}}, []string{"filesystem", "skill_deploy"}},
+		{"deny wins over allow", Scope{Allow: []string{"filesystem", "shell"}, Deny: []string{"shell"}}, []string{"filesystem"}},
+	}
+
+	registry := newStubRegistry(all...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := registry.Scoped(tt.scope).ToolNames(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Scoped(%+v) = %v, want %v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopedFor(t *testing.T) {
+	rules := []ScopeRule{
+		{Channels: []string{"telegram"}, Chats: []string{"-*"}, Scope: Scope{ReadOnly: true}},
+		{Channels: []string{"webhook"}, Chats: []string{"github"}, Scope: Scope{ReadOnly: true, NoShell: true}},
+		{Chats: []string{"*guest"}, Scope: Scope{Deny: []string{"web_fetch"}}},
+	}
+	registry := newStubRegistry("filesystem", "shell", "skill_deploy", "web_fetch")
+
+	tests := []struct {
+		name            string
+		channel, chatID string
+		want            []string
+	}{
+		{"private chat is not restricted", "telegram", "42", []string{"filesystem", "shell", "skill_deploy", "web_fetch"}},
+		{"group chat is read only", "telegram", "-100", []string{"filesystem", "web_fetch"}},
+		{"restricted webhook", "webhook", "github", []string{"filesystem", "web_fetch"}},
+		{"other webhook", "webhook", "home", []string{"filesystem", "shell", "skill_deploy", "web_fetch"}},
+		{"rule without channels matches every channel", "discord", "guest", []string{"filesystem", "shell", "skill_deploy"}},
+		{"matching rules combine", "telegram", "-guest", []string{"filesystem"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := registry.ScopedFor(rules, tt.channel, tt.chatID).ToolNames(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ScopedFor(%s, %s) = %v, want %v", tt.channel, tt.chatID, got, tt.want)
+			}
+		})
+	}
+}
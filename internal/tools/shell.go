@@ -3,9 +3,15 @@ package tools
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"os"
 	"os/exec"
+	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,11 +19,39 @@ import (
 // 此文件实现了在系统shell中执行命令的工具，支持超时控制
 
 // ShellTool 提供shell命令执行功能
-// 允许代理执行系统命令并获取输出结果，支持bash和sh
-// 注意：对于需要交互式输入的命令，请使用 tmux 技能
+// 允许代理执行系统命令并获取输出结果，支持 sh、bash，以及 Windows 上的 PowerShell 和 cmd
+// interactive 模式下命令等待输入时，提示会转发给用户，答复写入命令的标准输入（见 relayInput）；
+// 从终端读取密码的命令和全屏程序仍需使用 tmux 技能
 type ShellTool struct {
 	BaseTool
-	timeout time.Duration // 命令执行超时时间
+	timeout  time.Duration // 命令执行超时时间
+	sandbox  *Sandbox      // 命令执行沙箱（nil 表示直接在主机执行）
+	disabled string        // 不为空时拒绝执行命令（如沙箱配置有误）
+
+	policy *CommandPolicy // 命令黑白名单和环境变量清理（nil 表示不检查）
+
+	shell string // 执行命令的 shell：sh、bash、powershell、pwsh、cmd（见 SetShell）
+}
+
+// shellDescription 各 shell 模式下的工具描述，提示模型使用对应的语法
+var shellDescription = map[string]string{
+	"sh":         "Execute a shell command and return its output. For commands that ask questions (confirmations, prompts), set interactive to true: the prompt is relayed to the user and their reply is typed into the command. Passwords read from the terminal and full-screen programs need the tmux skill.",
+	"bash":       "Execute a bash command and return its output. For commands that ask questions (confirmations, prompts), set interactive to true: the prompt is relayed to the user and their reply is typed into the command. Passwords read from the terminal and full-screen programs need the tmux skill.",
+	"powershell": "Execute a Windows PowerShell command and return its output. Use PowerShell syntax (Get-ChildItem, $env:NAME, ; between commands). Interactive commands are not supported.",
+	"pwsh":       "Execute a PowerShell 7 command and return its output. Use PowerShell syntax (Get-ChildItem, $env:NAME, ; between commands). Interactive commands are not supported.",
+	"cmd":        "Execute a Windows cmd.exe command and return its output. Use cmd syntax (dir, type, %NAME%, && between commands). Interactive commands are not supported.",
+}
+
+// DefaultShell 返回当前系统默认的 shell 模式
+// Windows 上优先使用 PowerShell 7（pwsh），没有安装时使用系统自带的 Windows PowerShell；其他系统使用 sh
+func DefaultShell() string {
+	if runtime.GOOS != "windows" {
+		return "sh"
+	}
+	if _, err := exec.LookPath("pwsh"); err == nil {
+		return "pwsh"
+	}
+	return "powershell"
 }
 
 // NewShellTool 创建一个新的shell工具
@@ -32,7 +66,7 @@ func NewShellTool(timeout int) *ShellTool {
 	return &ShellTool{
 		BaseTool: NewBaseTool(
 			"shell",
-			"Execute a shell command and return its output. For interactive commands (passwords, confirmations), use the tmux skill.",
+			"Execute a shell command and return its output. For commands that ask questions (confirmations, prompts), set interactive to true: the prompt is relayed to the user and their reply is typed into the command. Passwords read from the terminal and full-screen programs need the tmux skill.",
 			map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -40,14 +74,71 @@ func NewShellTool(timeout int) *ShellTool {
 						"type":        "string",
 						"description": "The shell command to execute",
 					},
+					"interactive": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Relay prompts from the command to the user and send their replies to its stdin (only in chats)",
+					},
 				},
 				"required": []string{"command"},
 			},
 		),
 		timeout: time.Duration(timeout) * time.Second,
+		shell:   "sh",
 	}
 }
 
+// SetShell 设置执行命令的 shell
+// 参数:
+//
+//	mode: sh、bash、powershell、pwsh、cmd，空字符串或 auto 表示使用 DefaultShell
+//
+// 返回:
+//
+//	mode 不受支持时返回错误
+func (t *ShellTool) SetShell(mode string) error {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" || mode == "auto" {
+		mode = DefaultShell()
+	}
+	description, ok := shellDescription[mode]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q (expected sh, bash, powershell, pwsh or cmd)", mode)
+	}
+	t.shell = mode
+	t.description = description
+	return nil
+}
+
+// Shell 返回执行命令的 shell 模式
+func (t *ShellTool) Shell() string {
+	return t.shell
+}
+
+// SetSandbox 设置命令执行沙箱
+// 参数:
+//
+//	sandbox: 沙箱实例，nil 表示直接在主机执行
+func (t *ShellTool) SetSandbox(sandbox *Sandbox) {
+	t.sandbox = sandbox
+}
+
+// SetPolicy 设置命令策略（见 shellpolicy.go）
+// 参数:
+//
+//	policy: 命令策略，nil 表示不检查命令、不清理环境变量
+func (t *ShellTool) SetPolicy(policy *CommandPolicy) {
+	t.policy = policy
+}
+
+// Disable 禁用命令执行
+// 用于沙箱不可用的情况：拒绝执行，而不是退回到主机上执行
+// 参数:
+//
+//	reason: 返回给模型的原因
+func (t *ShellTool) Disable(reason string) {
+	t.disabled = reason
+}
+
 // Execute 执行shell命令
 // 在系统shell中执行指定命令，返回标准输出和标准错误
 // 参数:
@@ -59,46 +150,85 @@ func NewShellTool(timeout int) *ShellTool {
 //
 //	命令的标准输出内容，如果有错误则附加stderr信息
 func (t *ShellTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	return t.ExecuteIn(ctx, "", params)
+}
+
+// ExecuteIn 在指定的工作目录中执行命令（技能命令在技能目录中执行）
+// 参数:
+//
+//	ctx: 上下文对象
+//	dir: 主机上的工作目录，为空表示当前目录（启用沙箱时为工作空间）
+//	params: 参数 map，同 Execute
+func (t *ShellTool) ExecuteIn(ctx context.Context, dir string, params map[string]interface{}) (string, error) {
 	// 获取命令参数
 	command, ok := params["command"].(string)
 	if !ok || command == "" {
 		return "", fmt.Errorf("missing or invalid command parameter")
 	}
+	if t.disabled != "" {
+		return "", fmt.Errorf("shell is disabled: %s", t.disabled)
+	}
+	if err := t.policy.Check(command); err != nil {
+		return "", fmt.Errorf("command blocked by policy: %v", err)
+	}
 
 	// 创建带超时的上下文
 	timeoutCtx, cancel := context.WithTimeout(ctx, t.timeout)
 	defer cancel()
 
-	// 确定使用的shell
-	shell := "/bin/sh"
-	args := []string{"-c", command}
-
-	// 检查是否有shebang指定使用bash
-	if strings.HasPrefix(command, "#!") {
-		parts := strings.SplitN(command, "\n", 2)
-		if len(parts) > 0 {
-			shebang := strings.TrimPrefix(parts[0], "#!")
-			if shebang == "/bin/bash" || shebang == "/usr/bin/env bash" {
-				shell = "/bin/bash"
-			}
-		}
+	// 创建命令（启用沙箱时在受限环境中执行，沙箱内始终使用 /bin/sh）
+	var cmd *exec.Cmd
+	var cleanup func()
+	if t.sandbox != nil {
+		shell, args := unixShell(command, false)
+		cmd, cleanup = t.sandbox.Command(timeoutCtx, shell, args, t.timeout, dir)
+	} else {
+		shell, args := t.shellCommand(command)
+		cmd = exec.CommandContext(timeoutCtx, shell, args...)
+		cmd.Dir = dir
+	}
+	if t.policy != nil {
+		cmd.Env = t.policy.Env(os.Environ())
+	}
+	// interactive 模式需要记录最近的输出，判断命令是否在等待输入
+	interactive, _ := params["interactive"].(bool)
+	interactor := InteractorFrom(ctx)
+	toolCtx, _ := ToolContextFrom(ctx)
+	var tail *outputTail
+	if interactive && interactor != nil && toolCtx.ChatID != "" {
+		tail = &outputTail{}
 	}
 
-	// 创建命令
-	cmd := exec.CommandContext(timeoutCtx, shell, args...)
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	// 输出在保存的同时作为进度报告，长时间运行的命令可以显示最新的一行
+	cmd.Stdout = &progressWriter{ctx: ctx, buf: &stdout, tail: tail}
+	cmd.Stderr = &progressWriter{ctx: ctx, buf: &stderr, tail: tail}
 
 	// 设置 stdin 为 nil，防止命令等待交互式输入
 	cmd.Stdin = nil
 
 	// 执行命令
-	err := cmd.Run()
+	var err error
+	var aborted atomic.Bool
+	if tail == nil {
+		err = cmd.Run()
+	} else {
+		err = runInteractive(timeoutCtx, cmd, tail, interactor, toolCtx, func() {
+			aborted.Store(true)
+			cancel()
+		})
+	}
 	output := stdout.String()
+	if err != nil && timeoutCtx.Err() != nil && cleanup != nil {
+		cleanup()
+	}
 
 	// 处理错误情况
 	if err != nil {
+		if aborted.Load() {
+			return output, fmt.Errorf("command aborted by the user")
+		}
+
 		// 检查是否超时
 		if timeoutCtx.Err() == context.DeadlineExceeded {
 			return "", fmt.Errorf("command timed out after %v", t.timeout)
@@ -133,3 +263,114 @@ func (t *ShellTool) Execute(ctx context.Context, params map[string]interface{})
 
 	return output, nil
 }
+
+// shellCommand 返回在主机上执行命令使用的程序和参数
+func (t *ShellTool) shellCommand(command string) (string, []string) {
+	switch t.shell {
+	case "powershell", "pwsh":
+		// -NonInteractive 使等待输入的命令直接失败，而不是一直挂起到超时
+		return t.shell, []string{"-NoProfile", "-NonInteractive", "-Command", command}
+	case "cmd":
+		return "cmd", []string{"/C", command}
+	case "bash":
+		return unixShell(command, true)
+	default:
+		return unixShell(command, false)
+	}
+}
+
+// unixShell 返回 sh 或 bash 的程序和参数
+// 命令以 bash 的 shebang 开头时使用 bash；Windows 上（Git Bash、MSYS2）在 PATH 中查找
+func unixShell(command string, bash bool) (string, []string) {
+	// 检查是否有shebang指定使用bash
+	if strings.HasPrefix(command, "#!") {
+		shebang := strings.TrimSpace(strings.TrimPrefix(strings.SplitN(command, "\n", 2)[0], "#!"))
+		if shebang == "/bin/bash" || shebang == "/usr/bin/env bash" {
+			bash = true
+		}
+	}
+	shell := "sh"
+	if bash {
+		shell = "bash"
+	}
+	if runtime.GOOS != "windows" {
+		shell = "/bin/" + shell
+	}
+	return shell, []string{"-c", command}
+}
+
+const (
+	// inputIdle 命令没有新的输出超过这个时间，且最后一行像是提示时，认为它在等待输入
+	inputIdle = 2 * time.Second
+	// inputPollInterval 检查命令是否在等待输入的间隔
+	inputPollInterval = 500 * time.Millisecond
+)
+
+// runInteractive 执行命令，命令等待输入时通过 interactor 询问用户
+// 参数:
+//
+//	ctx: 命令的上下文（包含超时），等待答复的时间也计入超时
+//	cmd: 尚未启动的命令，输出需要已经写入 tail
+//	tail: 命令最近的输出
+//	interactor: 输入转发者
+//	toolCtx: 发送提示的聊天
+//	abort: 用户回复 /abort 时调用，用于终止命令
+func runInteractive(ctx context.Context, cmd *exec.Cmd, tail *outputTail, interactor Interactor, toolCtx ToolContext, abort func()) error {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	relayCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		relayInput(relayCtx, stdin, tail, interactor, toolCtx, abort)
+	}()
+
+	err = cmd.Wait()
+	stop()
+	<-done
+	return err
+}
+
+// relayInput 在命令等待输入时把提示转发给用户，并把答复写入命令的标准输入
+// 用户回复 /abort 时调用 abort；超时未答复时关闭标准输入，命令会读到 EOF
+func relayInput(ctx context.Context, stdin io.WriteCloser, tail *outputTail, interactor Interactor, toolCtx ToolContext, abort func()) {
+	ticker := time.NewTicker(inputPollInterval)
+	defer ticker.Stop()
+
+	seen := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		prompt, seq, ok := tail.waiting(inputIdle, seen)
+		if !ok {
+			continue
+		}
+		seen = seq
+
+		answer, err := interactor.AskInput(ctx, toolCtx.Channel, toolCtx.ChatID, prompt)
+		switch {
+		case errors.Is(err, ErrInputAborted):
+			abort()
+			return
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			log.Printf("[Shell] 等待用户输入失败，关闭命令的标准输入: %v", err)
+			stdin.Close()
+			return
+		}
+		if _, err := io.WriteString(stdin, answer+"\n"); err != nil {
+			return
+		}
+	}
+}
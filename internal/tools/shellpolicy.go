@@ -0,0 +1,185 @@
+package tools
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// shellpolicy.go - shell 命令策略
+// 在执行前检查命令：
+//   - 黑名单：匹配任一正则表达式的命令被拒绝（内置 rm -rf /、mkfs、curl | sh 等明显危险的命令）
+//   - 白名单（严格模式）：配置后命令中每一段（以 ; && || | 和换行分隔）的程序名都必须在列表中，
+//     并且不允许 $(...)、`...` 命令替换和 <(...)、>(...) 进程替换（否则可以绕过检查）；
+//     eval 和 exec 会把参数当作命令执行，只有白名单中逐字列出时才允许（通配符不算）
+//
+// 同时在执行前清理子进程的环境变量，去除 API Key、Token 等密钥，
+// 避免模型通过 env、printenv 或把环境变量发到外部来获取它们。
+// 黑名单只是最后一道防线，无法识别所有危险命令；需要更强的隔离时请使用沙箱（tools.exec.sandbox）。
+
+// defaultDenyPatterns 内置的危险命令
+var defaultDenyPatterns = []string{
+	`\brm\s+(-[a-zA-Z]+\s+)*(/|/\*|~|~/|\$HOME|\$HOME/)(\s|$|;|&|\|)`, // 删除根目录或主目录（配合 -r 时）
+	`\bmkfs(\.[a-z0-9]+)?\b`,                               // 格式化文件系统
+	`\bdd\b[^;&|]*\bof=/dev/(sd|hd|vd|xvd|nvme|mmcblk)`,    // 覆盖磁盘
+	`>\s*/dev/(sd|hd|vd|xvd|nvme|mmcblk)`,                  // 重定向写入磁盘
+	`\b(curl|wget)\b[^;&]*\|\s*(sudo\s+)?(ba|z|da|k)?sh\b`, // 下载并直接执行脚本
+	`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`,             // fork 炸弹
+	`\b(shutdown|reboot|halt|poweroff)\b`,                  // 关机和重启
+	`\bchmod\s+(-[a-zA-Z]+\s+)*[0-7]*777\s+/(\s|$)`,        // 根目录权限
+}
+
+// defaultScrubEnv 默认从子进程环境中去除的变量名（glob 模式，不区分大小写）
+var defaultScrubEnv = []string{
+	"*API_KEY*", "*APIKEY*", "*_TOKEN", "*_TOKEN_*", "*SECRET*", "*PASSWORD*", "*PASSWD*",
+	"*ACCESS_KEY*", "*PRIVATE_KEY*", "*CREDENTIALS*",
+}
+
+// segmentSeparator 分隔命令中的各段
+var segmentSeparator = regexp.MustCompile(`&&|\|\||[;|\n&]`)
+
+// fdRedirect 匹配 2>&1、&> 这样的重定向（其中的 & 不是命令分隔符）
+var fdRedirect = regexp.MustCompile(`\d*[<>]&\d*-?|&>>?`)
+
+// indirectCommands 把参数当作命令执行的 shell 内置命令，白名单中逐字列出时才允许
+var indirectCommands = map[string]bool{"eval": true, "exec": true}
+
+// CommandPolicy 是 shell 命令的执行策略
+type CommandPolicy struct {
+	deny         []*regexp.Regexp // 黑名单
+	allow        []string         // 白名单程序名（支持 * 通配符），为空表示不启用严格模式
+	scrubEnv     []string         // 要去除的环境变量名（glob，大写）
+	secretValues map[string]bool  // 值等于这些密钥的环境变量也会被去除
+}
+
+// NewCommandPolicy 创建命令策略
+// 参数:
+//
+//	deny: 额外的黑名单（正则表达式），与内置黑名单一起生效
+//	allow: 白名单程序名（例如 "ls"、"git"、"python*"），为空表示不启用严格模式
+//	scrubEnv: 额外要去除的环境变量名（glob 模式，例如 "MY_SERVICE_*"）
+//	secretValues: 已知的密钥（例如配置中的 API Key），值与之相同的环境变量会被去除
+//
+// 返回:
+//
+//	命令策略，正则表达式无效时返回错误
+func NewCommandPolicy(deny, allow, scrubEnv, secretValues []string) (*CommandPolicy, error) {
+	p := &CommandPolicy{allow: allow, secretValues: make(map[string]bool)}
+	for _, pattern := range append(append([]string{}, defaultDenyPatterns...), deny...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+		p.deny = append(p.deny, re)
+	}
+	for _, name := range append(append([]string{}, defaultScrubEnv...), scrubEnv...) {
+		p.scrubEnv = append(p.scrubEnv, strings.ToUpper(name))
+	}
+	for _, value := range secretValues {
+		if value != "" {
+			p.secretValues[value] = true
+		}
+	}
+	return p, nil
+}
+
+// Check 检查命令是否允许执行
+// 返回:
+//
+//	nil 表示允许，否则为拒绝的原因
+func (p *CommandPolicy) Check(command string) error {
+	if p == nil {
+		return nil
+	}
+	for _, re := range p.deny {
+		if re.MatchString(command) {
+			return fmt.Errorf("command matches the deny list (%s)", re.String())
+		}
+	}
+	if len(p.allow) == 0 {
+		return nil
+	}
+
+	if strings.Contains(command, "$(") || strings.Contains(command, "`") {
+		return fmt.Errorf("command substitution is not allowed in allowlist mode")
+	}
+	if strings.Contains(command, "<(") || strings.Contains(command, ">(") {
+		return fmt.Errorf("process substitution is not allowed in allowlist mode")
+	}
+	for _, segment := range segmentSeparator.Split(fdRedirect.ReplaceAllString(command, " "), -1) {
+		program := commandName(segment)
+		if program == "" {
+			continue
+		}
+		if indirectCommands[program] && !p.listed(program) {
+			return fmt.Errorf("'%s' runs its arguments as a command and must be listed explicitly in the command allowlist", program)
+		}
+		if !p.allowed(program) {
+			return fmt.Errorf("'%s' is not in the command allowlist (allowed: %s)", program, strings.Join(p.allow, ", "))
+		}
+	}
+	return nil
+}
+
+// allowed 判断程序名是否在白名单中
+func (p *CommandPolicy) allowed(program string) bool {
+	for _, pattern := range p.allow {
+		if ok, _ := path.Match(pattern, program); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// listed 判断程序名是否逐字出现在白名单中（不按通配符匹配）
+func (p *CommandPolicy) listed(program string) bool {
+	for _, name := range p.allow {
+		if name == program {
+			return true
+		}
+	}
+	return false
+}
+
+// commandName 返回命令片段中的程序名（跳过 VAR=value 前缀，去掉目录）
+func commandName(segment string) string {
+	for _, field := range strings.Fields(segment) {
+		if strings.Contains(field, "=") && !strings.HasPrefix(field, "=") {
+			continue // 环境变量赋值
+		}
+		field = strings.Trim(field, "()")
+		return path.Base(field)
+	}
+	return ""
+}
+
+// Env 返回去除密钥后的环境变量
+// 参数:
+//
+//	environ: 原始环境变量（os.Environ() 格式）
+func (p *CommandPolicy) Env(environ []string) []string {
+	env := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if p.scrubbed(name, value) {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+// scrubbed 判断环境变量是否需要去除
+func (p *CommandPolicy) scrubbed(name, value string) bool {
+	if p.secretValues[value] {
+		return true
+	}
+	upper := strings.ToUpper(name)
+	for _, pattern := range p.scrubEnv {
+		if ok, _ := path.Match(pattern, upper); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/skills"
+)
+
+// skill.go - 技能命令工具
+// 技能可以在 tools.json 中声明可执行命令（见 skills.LoadCommands），
+// 每个命令注册为一个 skill_<技能>_<命令> 工具，通过 shell 工具执行（沿用它的沙箱、超时和命令策略），
+// 工具权限中 shell 的规则、noShell 和 readOnly 同样适用于它们
+
+// SkillTool 执行技能声明的一个命令
+type SkillTool struct {
+	BaseTool
+	dir     string         // 技能目录（命令在这里执行）
+	command skills.Command // 命令定义
+	shell   *ShellTool     // 实际执行命令的 shell 工具
+}
+
+// NewSkillTool 创建技能命令工具
+// 参数:
+//
+//	skill: 声明命令的技能
+//	command: 命令定义
+//	shell: 用于执行命令的 shell 工具
+func NewSkillTool(skill *skills.Skill, command skills.Command, shell *ShellTool) *SkillTool {
+	description := command.Description
+	if description == "" {
+		description = fmt.Sprintf("Run the %s command of the %s skill", command.Name, skill.Name)
+	}
+	// 沙箱按绝对路径挂载工作目录
+	dir := filepath.Dir(skill.Path)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return &SkillTool{
+		BaseTool: NewBaseTool(skills.CommandToolName(skill.Name, command.Name), description, command.Parameters),
+		dir:      dir,
+		command:  command,
+		shell:    shell,
+	}
+}
+
+// Execute 在技能目录中执行命令，参数按 args 模板替换并加上引号
+// 工作目录作为进程的工作目录传给 shell 工具（沙箱中映射为对应路径），而不是在命令前加 cd，
+// 这样命令白名单只需要允许技能的程序本身
+func (t *SkillTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	return t.shell.ExecuteIn(ctx, t.dir, map[string]interface{}{"command": t.commandLine(params)})
+}
+
+// commandLine 返回按参数展开后要执行的命令（权限策略按它匹配 shell 工具的规则）
+func (t *SkillTool) commandLine(params map[string]interface{}) string {
+	parts := []string{t.command.Command}
+	for _, arg := range skills.BuildArgs(t.command.Args, params) {
+		parts = append(parts, shellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// RegisterSkillTools 把技能声明的命令注册为工具
+// 只注册可用（依赖满足）且未禁用的技能；tools.json 格式错误的技能会被跳过。
+// 之前注册的技能命令工具会先被移除，因此技能修改后可以再次调用以刷新。
+// 返回: 注册的工具数量，以及被跳过的技能的错误
+func RegisterSkillTools(registry *ToolRegistry, loader *skills.SkillsLoader, shell *ShellTool) (int, []error) {
+	for _, name := range registry.ToolNames() {
+		if _, ok := registry.Get(name).(*SkillTool); ok {
+			registry.Unregister(name)
+		}
+	}
+
+	var errs []error
+	count := 0
+	for _, skill := range loader.ListSkills(true) {
+		commands, err := skills.LoadCommands(filepath.Dir(skill.Path))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("skill %s: %w", skill.Name, err))
+			continue
+		}
+		for _, command := range commands {
+			registry.Register(NewSkillTool(skill, command, shell))
+			count++
+		}
+	}
+	return count, errs
+}
+
+// shellQuote 用单引号包裹参数，防止被 shell 解释
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -2,20 +2,37 @@ package tools
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"sync"
+	"time"
 )
 
 // spawn.go - 子代理生成工具
 // 此文件实现了生成子代理的工具，允许主代理创建后台运行的子代理来处理长时间任务
 
+// FastModel 是 spawn 工具的 model 参数中表示快速模型（agents.routing.model）的别名
+const FastModel = "fast"
+
+// SpawnOptions 是生成子代理的可选设置
+type SpawnOptions struct {
+	Label   string        // 可读标签
+	Model   string        // 子代理使用的模型（FastModel 表示快速模型，为空表示默认模型）
+	Tools   []string      // 子代理可以使用的工具（支持 * 通配符，为空表示全部）
+	Timeout time.Duration // 运行时间上限（0 表示使用配置的上限，不能超过配置的上限）
+
+	// Registry 是调用 spawn 的注册表视图，子代理的工具从中选择（为 nil 表示子代理管理器的完整注册表）
+	Registry *ToolRegistry
+}
+
 // SpawnTool 允许代理生成子代理来执行后台任务
 // 用于将长时间运行的任务委派给独立的子代理，避免阻塞主代理
 type SpawnTool struct {
 	BaseTool
 	// spawnFunc 是实际的子代理生成函数
-	// 参数: task（任务描述）, label（可读标签）, originChannel（来源频道）, originChatID（来源聊天ID）
+	// 参数: task（任务描述）, opts（标签、模型、工具和运行时间）, originChannel（来源频道）, originChatID（来源聊天ID）
 	// 返回: 生成结果的描述字符串
-	spawnFunc func(task string, label string, originChannel string, originChatID string) string
+	spawnFunc func(task string, opts SpawnOptions, originChannel string, originChatID string) string
 	channel   string // 当前上下文频道
 	chatID    string // 当前上下文聊天ID
 	mu        sync.RWMutex
@@ -29,11 +46,11 @@ type SpawnTool struct {
 // 返回:
 //
 //	配置好的SpawnTool实例
-func NewSpawnTool(spawnFunc func(task string, label string, originChannel string, originChatID string) string) *SpawnTool {
+func NewSpawnTool(spawnFunc func(task string, opts SpawnOptions, originChannel string, originChatID string) string) *SpawnTool {
 	return &SpawnTool{
 		BaseTool: NewBaseTool(
 			"spawn",
-			"Spawn a subagent to run a task in the background. The subagent runs independently and will notify you when complete.\n\n**WHEN TO USE SPAWN:**\n• Tasks taking >2 minutes (large file processing, web scraping, batch operations)\n• Parallel independent tasks (multiple searches, concurrent file operations)\n• Long-running monitoring or polling tasks\n• Tasks where you want to continue working while it completes\n\n**WHEN NOT TO USE:**\n• Quick queries (<30 seconds) - just do them directly\n• Simple file reads/writes - use read/write tools directly\n• Tasks that depend on each other - run sequentially instead\n\n**USAGE:**\n{\"task\": \"your specific task description\", \"label\": \"optional readable name\"}",
+			"Spawn a subagent to run a task in the background. The subagent runs independently and will notify you when complete.\n\n**WHEN TO USE SPAWN:**\n• Tasks taking >2 minutes (large file processing, web scraping, batch operations)\n• Parallel independent tasks (multiple searches, concurrent file operations)\n• Long-running monitoring or polling tasks\n• Tasks where you want to continue working while it completes\n\n**WHEN NOT TO USE:**\n• Quick queries (<30 seconds) - just do them directly\n• Simple file reads/writes - use read/write tools directly\n• Tasks that depend on each other - run sequentially instead\n\n**OPTIONS:**\n• model: \"fast\" runs the subagent on the cheap, fast model - good for simple research or summarizing in parallel\n• tools: give the subagent only the tools it needs, e.g. [\"web_search\", \"web_fetch\"] for research without shell access\n• timeout_seconds: stop the subagent after this long\n\n**USAGE:**\n{\"task\": \"your specific task description\", \"label\": \"optional readable name\"}\n{\"task\": \"research topic X\", \"model\": \"fast\", \"tools\": [\"web_search\", \"web_fetch\"], \"timeout_seconds\": 300}",
 			map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -45,6 +62,19 @@ func NewSpawnTool(spawnFunc func(task string, label string, originChannel string
 						"type":        "string",
 						"description": "Optional human-readable label for the task",
 					},
+					"model": map[string]interface{}{
+						"type":        "string",
+						"description": "Model for the subagent: \"fast\" for the cheap, fast model, or a model name; defaults to your own model",
+					},
+					"tools": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Tool names the subagent may use (supports * wildcards); defaults to all tools",
+					},
+					"timeout_seconds": map[string]interface{}{
+						"type":        "integer",
+						"description": "Stop the subagent after this many seconds (cannot exceed the configured limit)",
+					},
 				},
 				"required": []string{"task"},
 			},
@@ -72,7 +102,7 @@ func (t *SpawnTool) SetContext(channel string, chatID string) {
 // 参数:
 //
 //	ctx: 上下文对象
-//	params: 参数map，必须包含"task"，可选"label"
+//	params: 参数map，必须包含"task"，可选"label"、"model"、"tools"和"timeout_seconds"
 //
 // 返回:
 //
@@ -80,12 +110,29 @@ func (t *SpawnTool) SetContext(channel string, chatID string) {
 func (t *SpawnTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
 	// 获取任务描述
 	task, _ := params["task"].(string)
-	// 获取可选的标签
-	label, _ := params["label"].(string)
+	// 获取可选的标签、模型、工具和运行时间
+	var opts SpawnOptions
+	opts.Label, _ = params["label"].(string)
+	opts.Model, _ = params["model"].(string)
+	opts.Model = strings.TrimSpace(opts.Model)
+	if list, ok := params["tools"].([]interface{}); ok {
+		for _, item := range list {
+			if name, _ := item.(string); strings.TrimSpace(name) != "" {
+				opts.Tools = append(opts.Tools, strings.TrimSpace(name))
+			}
+		}
+	}
+	timeout, _ := params["timeout_seconds"].(float64)
+	if timeout < 0 {
+		return "", fmt.Errorf("timeout_seconds must not be negative")
+	}
+	opts.Timeout = time.Duration(timeout) * time.Second
+	// 子代理不能使用调用者（按聊天或任务权限受限时）无权使用的工具
+	opts.Registry = RegistryFrom(ctx)
 
 	// 验证任务参数
 	if task == "" {
-		return "Error: task is required", nil
+		return "", fmt.Errorf("task is required")
 	}
 
 	// 使用上下文默认值（通过 SetContext 设置）
@@ -116,7 +163,7 @@ func (t *SpawnTool) Execute(ctx context.Context, params map[string]interface{})
 
 	// 如果提供了生成函数，则执行
 	if t.spawnFunc != nil {
-		return t.spawnFunc(task, label, originChannel, originChatID), nil
+		return t.spawnFunc(task, opts, originChannel, originChatID), nil
 	}
 
 	return "Spawn service not available", nil
@@ -0,0 +1,238 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// subagents.go - 子代理管理工具
+// 此文件实现了查看和取消后台子代理的工具，让代理和用户了解后台正在运行什么
+
+// SubagentInfo 描述一个子代理任务的状态
+type SubagentInfo struct {
+	ID         string    // 任务 ID
+	Label      string    // 任务标签
+	Task       string    // 任务描述
+	Status     string    // running、ok、error 或 cancelled
+	Channel    string    // 来源频道
+	ChatID     string    // 来源聊天 ID
+	Started    time.Time // 开始时间
+	Finished   time.Time // 结束时间（运行中为零值）
+	Iterations int       // 已完成的 LLM 迭代次数
+	LastTool   string    // 最近一次调用的工具
+	Result     string    // 最终结果或错误信息（运行中为空）
+
+	Model string   // 创建时指定的模型（为空表示默认模型）
+	Tools []string // 创建时指定的工具（为空表示全部）
+}
+
+// SubagentResultKey 子代理结果公告的消息元数据中保存 SubagentResult 的键
+const SubagentResultKey = "subagent_result"
+
+// SubagentResult 是子代理的结构化结果
+// 子代理结束时保存在它的子工作区（subworkspace/<任务ID>/result.json），并随结果公告放在消息元数据中
+type SubagentResult struct {
+	TaskID    string             `json:"task_id"`
+	Label     string             `json:"label"`
+	Task      string             `json:"task"`
+	Status    string             `json:"status"`            // running、ok、error、timeout 或 cancelled
+	Channel   string             `json:"channel,omitempty"` // 来源频道
+	ChatID    string             `json:"chat_id,omitempty"` // 来源聊天 ID
+	Summary   string             `json:"summary,omitempty"` // 子代理的最终回复或错误信息
+	Artifacts []SubagentArtifact `json:"artifacts,omitempty"`
+	Metrics   SubagentMetrics    `json:"metrics"`
+	Started   time.Time          `json:"started"`
+	Finished  time.Time          `json:"finished"`
+}
+
+// SubagentArtifact 是子代理在子工作区中生成的文件
+type SubagentArtifact struct {
+	Path string `json:"path"` // 绝对路径
+	Size int64  `json:"size"` // 文件大小（字节）
+}
+
+// SubagentMetrics 是子代理运行的统计
+type SubagentMetrics struct {
+	DurationMs       int64  `json:"duration_ms"`
+	Iterations       int    `json:"iterations"`
+	ToolCalls        int    `json:"tool_calls"`
+	PromptTokens     int    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int    `json:"completion_tokens,omitempty"`
+	Model            string `json:"model,omitempty"` // 指定的模型（为空表示默认模型）
+}
+
+// SubagentResultFrom 从消息元数据中取出子代理的结构化结果
+// 入站队列持久化后元数据会变成 JSON 解码的 map，这里同时处理两种形式
+func SubagentResultFrom(metadata map[string]interface{}) (SubagentResult, bool) {
+	switch v := metadata[SubagentResultKey].(type) {
+	case SubagentResult:
+		return v, true
+	case *SubagentResult:
+		return *v, v != nil
+	case map[string]interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return SubagentResult{}, false
+		}
+		var result SubagentResult
+		if err := json.Unmarshal(data, &result); err != nil || result.TaskID == "" {
+			return SubagentResult{}, false
+		}
+		return result, true
+	}
+	return SubagentResult{}, false
+}
+
+// SubagentController 是 subagents 和 get_task_result 工具需要的子代理管理接口
+// 由 agent.SubagentManager 实现
+type SubagentController interface {
+	// ListTasks 返回运行中和最近结束的子代理任务
+	ListTasks() []SubagentInfo
+	// TaskInfo 返回指定任务的状态
+	TaskInfo(taskID string) (SubagentInfo, bool)
+	// CancelTask 取消运行中的任务，任务不存在或已结束时返回 false
+	CancelTask(taskID string) bool
+	// TaskResult 返回指定任务的结构化结果（运行中的任务只有统计）
+	TaskResult(taskID string) (SubagentResult, bool)
+}
+
+// SubagentsTool 允许代理查看、查询和取消后台子代理
+type SubagentsTool struct {
+	BaseTool
+	controller SubagentController
+}
+
+// NewSubagentsTool 创建一个新的子代理管理工具
+// 参数:
+//
+//	controller: 子代理管理器
+//
+// 返回:
+//
+//	配置好的SubagentsTool实例
+func NewSubagentsTool(controller SubagentController) *SubagentsTool {
+	return &SubagentsTool{
+		BaseTool: NewBaseTool(
+			"subagents",
+			"Inspect and control background subagents started with the spawn tool. Actions: list (running and recently finished subagents of this chat), status (details and result of one subagent), cancel (stop a running or stuck subagent).",
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"action": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"list", "status", "cancel"},
+						"description": "Action to perform",
+					},
+					"task_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Subagent task ID (for status and cancel)",
+					},
+				},
+				"required": []string{"action"},
+			},
+		),
+		controller: controller,
+	}
+}
+
+// Execute 执行子代理管理操作
+func (t *SubagentsTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	action, _ := params["action"].(string)
+	taskID, _ := params["task_id"].(string)
+	var channel, chatID string
+	if toolCtx, ok := ToolContextFrom(ctx); ok {
+		channel, chatID = toolCtx.Channel, toolCtx.ChatID
+	}
+
+	switch action {
+	case "list":
+		return FormatSubagentList(t.controller.ListTasks(), channel, chatID), nil
+	case "status":
+		if taskID == "" {
+			return "", fmt.Errorf("task_id is required")
+		}
+		info, ok := t.controller.TaskInfo(taskID)
+		if !ok || !SubagentVisible(info, channel, chatID) {
+			return fmt.Sprintf("No subagent with id %s", taskID), nil
+		}
+		return FormatSubagentStatus(info), nil
+	case "cancel":
+		if taskID == "" {
+			return "", fmt.Errorf("task_id is required")
+		}
+		if info, ok := t.controller.TaskInfo(taskID); !ok || !SubagentVisible(info, channel, chatID) {
+			return fmt.Sprintf("No subagent with id %s", taskID), nil
+		}
+		if !t.controller.CancelTask(taskID) {
+			return fmt.Sprintf("Subagent %s is not running", taskID), nil
+		}
+		return fmt.Sprintf("Subagent %s cancelled", taskID), nil
+	default:
+		return "Unknown action: " + action, nil
+	}
+}
+
+// SubagentVisible 判断子代理任务是否可以在指定聊天中查看和控制
+// channel 和 chatID 为空（没有聊天上下文）时所有任务都可见，否则只有来自该聊天的任务可见
+func SubagentVisible(info SubagentInfo, channel, chatID string) bool {
+	return channel == "" || chatID == "" || (info.Channel == channel && info.ChatID == chatID)
+}
+
+// FormatSubagentList 格式化子代理列表
+// channel 和 chatID 非空时只列出来自该聊天的任务
+func FormatSubagentList(tasks []SubagentInfo, channel, chatID string) string {
+	var running, finished []string
+	for _, info := range tasks {
+		if !SubagentVisible(info, channel, chatID) {
+			continue
+		}
+		if info.Status == "running" {
+			line := fmt.Sprintf("• %s [%s] running for %s, %d iteration(s)", info.ID, info.Label, time.Since(info.Started).Round(time.Second), info.Iterations)
+			if info.LastTool != "" {
+				line += ", last tool: " + info.LastTool
+			}
+			running = append(running, line)
+		} else {
+			finished = append(finished, fmt.Sprintf("• %s [%s] %s %s ago", info.ID, info.Label, info.Status, time.Since(info.Finished).Round(time.Second)))
+		}
+	}
+
+	if len(running) == 0 && len(finished) == 0 {
+		return "No background subagents."
+	}
+	var sb strings.Builder
+	if len(running) > 0 {
+		sb.WriteString(fmt.Sprintf("Running (%d):\n%s\n", len(running), strings.Join(running, "\n")))
+	}
+	if len(finished) > 0 {
+		sb.WriteString(fmt.Sprintf("Recently finished (%d):\n%s\n", len(finished), strings.Join(finished, "\n")))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// FormatSubagentStatus 格式化单个子代理的详细状态
+func FormatSubagentStatus(info SubagentInfo) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Subagent %s [%s]\nStatus: %s\nStarted: %s\n", info.ID, info.Label, info.Status, info.Started.Format("2006-01-02 15:04:05")))
+	if !info.Finished.IsZero() {
+		sb.WriteString(fmt.Sprintf("Finished: %s (took %s)\n", info.Finished.Format("2006-01-02 15:04:05"), info.Finished.Sub(info.Started).Round(time.Second)))
+	}
+	if info.Model != "" {
+		sb.WriteString(fmt.Sprintf("Model: %s\n", info.Model))
+	}
+	if len(info.Tools) > 0 {
+		sb.WriteString(fmt.Sprintf("Tools: %s\n", strings.Join(info.Tools, ", ")))
+	}
+	sb.WriteString(fmt.Sprintf("Iterations: %d\n", info.Iterations))
+	if info.LastTool != "" {
+		sb.WriteString(fmt.Sprintf("Last tool: %s\n", info.LastTool))
+	}
+	sb.WriteString(fmt.Sprintf("Task: %s", info.Task))
+	if info.Result != "" {
+		sb.WriteString("\n\nResult:\n" + info.Result)
+	}
+	return sb.String()
+}
@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// taskresult.go - 子代理结构化结果查询工具
+// 此文件实现了 get_task_result 工具：按任务 ID 返回子代理的结构化结果（状态、摘要、生成的文件和统计），
+// 主代理可以据此读取子代理生成的文件，而不必从结果公告的文字中解析路径。
+
+// TaskResultTool 返回子代理的结构化结果
+type TaskResultTool struct {
+	BaseTool
+	controller SubagentController
+}
+
+// NewTaskResultTool 创建一个新的子代理结果查询工具
+// 参数:
+//
+//	controller: 子代理管理器
+//
+// 返回:
+//
+//	配置好的TaskResultTool实例
+func NewTaskResultTool(controller SubagentController) *TaskResultTool {
+	return &TaskResultTool{
+		BaseTool: NewBaseTool(
+			"get_task_result",
+			"Get the structured result of a subagent started with the spawn tool: status (running, ok, error, timeout, cancelled), summary, artifacts (absolute paths and sizes of the files it created) and metrics (duration, iterations, tool calls, tokens). "+
+				"Use it after a subagent report to find and read the files it produced.",
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"task_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Subagent task ID (from the spawn reply or the subagent report)",
+					},
+				},
+				"required": []string{"task_id"},
+			},
+		),
+		controller: controller,
+	}
+}
+
+// Execute 返回任务的结构化结果
+// 参数:
+//
+//	ctx: 上下文对象
+//	params: 参数map，必须包含"task_id"
+//
+// 返回:
+//
+//	JSON 格式的 SubagentResult
+func (t *TaskResultTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	taskID, _ := params["task_id"].(string)
+	taskID = strings.TrimSpace(taskID)
+	if taskID == "" {
+		return "", fmt.Errorf("task_id is required")
+	}
+	var channel, chatID string
+	if toolCtx, ok := ToolContextFrom(ctx); ok {
+		channel, chatID = toolCtx.Channel, toolCtx.ChatID
+	}
+	result, ok := t.controller.TaskResult(taskID)
+	// 只返回来自当前聊天的任务结果（旧版本保存的结果没有来源聊天，也不返回）
+	if !ok || !SubagentVisible(SubagentInfo{Channel: result.Channel, ChatID: result.ChatID}, channel, chatID) {
+		return "", fmt.Errorf("no subagent with id %s", taskID)
+	}
+	return JSONString(result), nil
+}
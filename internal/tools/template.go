@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Ailoc/nanogrip/internal/templates"
+)
+
+// template.go - 消息模板工具
+// 用 workspace/templates/ 中的模板发送格式固定的消息（状态报告、每日汇总等），
+// 模型只需要提供变量值，不必每次重新组织格式。发送通过消息工具完成，目标规则与 message 工具相同。
+
+// SendTemplateTool 列出、预览和发送消息模板
+type SendTemplateTool struct {
+	BaseTool
+	store    *templates.Store
+	messages *MessageTool // 实际发送消息的工具
+}
+
+// NewSendTemplateTool 创建消息模板工具
+// 参数:
+//
+//	workspace: 工作区路径（模板位于 workspace/templates/）
+//	messages: 用于发送渲染结果的消息工具
+func NewSendTemplateTool(workspace string, messages *MessageTool) *SendTemplateTool {
+	return &SendTemplateTool{
+		BaseTool: NewBaseTool(
+			"send_template",
+			"Send a predefined message template from workspace/templates/ with variable values filled in. Use this for recurring reports so the format stays consistent. Actions: list (show templates and their variables), preview (render without sending), send (default).",
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"action": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"list", "preview", "send"},
+						"description": "What to do. Default: send",
+					},
+					"name": map[string]interface{}{
+						"type":        "string",
+						"description": "Template name (required for preview and send)",
+					},
+					"variables": map[string]interface{}{
+						"type":        "object",
+						"description": "Variable values, e.g. {\"host\": \"web-1\", \"load\": \"0.42\"}",
+					},
+					"channel": map[string]interface{}{
+						"type":        "string",
+						"description": "Channel name. Default: the current channel",
+					},
+					"chat_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Chat ID to send to. Default: the current chat",
+					},
+					"recipients": map[string]interface{}{
+						"type":        "array",
+						"description": "Send to several chats instead of channel/chat_id, same format as the message tool",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"channel": map[string]interface{}{"type": "string"},
+								"chat_id": map[string]interface{}{"type": "string"},
+							},
+							"required": []string{"chat_id"},
+						},
+					},
+				},
+			},
+		),
+		store:    templates.NewStore(workspace),
+		messages: messages,
+	}
+}
+
+// Execute 执行模板操作
+func (t *SendTemplateTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	action, _ := params["action"].(string)
+	if action == "" {
+		action = "send"
+	}
+	if action == "list" {
+		return t.list(), nil
+	}
+	if action != "preview" && action != "send" {
+		return "", fmt.Errorf("unknown action %q (use list, preview or send)", action)
+	}
+
+	name, _ := params["name"].(string)
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	tmpl, err := t.store.Get(name)
+	if err != nil {
+		return "", err
+	}
+	vars, _ := params["variables"].(map[string]interface{})
+	rendered, err := tmpl.Render(vars)
+	if err != nil {
+		return "", err
+	}
+
+	if action == "preview" {
+		preview := rendered.Content
+		if rendered.Media != "" {
+			preview += "\n\n[media: " + rendered.Media + "]"
+		}
+		return preview, nil
+	}
+
+	msgParams := map[string]interface{}{
+		"content":    rendered.Content,
+		"media":      rendered.Media,
+		"media_type": rendered.MediaType,
+	}
+	for _, key := range []string{"channel", "chat_id", "recipients"} {
+		if value, ok := params[key]; ok {
+			msgParams[key] = value
+		}
+	}
+	result, err := t.messages.Execute(ctx, msgParams)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s (template %s)", result, name), nil
+}
+
+// list 列出所有模板
+func (t *SendTemplateTool) list() string {
+	list, errs := t.store.List()
+	var sb strings.Builder
+	if len(list) == 0 {
+		fmt.Fprintf(&sb, "No templates found. Create YAML files in %s with description, variables and content.", t.store.Dir())
+	}
+	for i, tmpl := range list {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("- " + tmpl.Usage())
+	}
+	for _, err := range errs {
+		sb.WriteString("\nWarning: " + err.Error())
+	}
+	return sb.String()
+}
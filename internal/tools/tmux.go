@@ -0,0 +1,448 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tmux.go - tmux 会话工具
+// 此文件实现了 TmuxTool：在私有 socket 上创建命名的 tmux 会话、发送按键、读取窗格内容和结束会话，
+// 用于 SSH、sudo、REPL 等需要 TTY 的交互式程序（shell 工具只能执行非交互式命令）。
+// 会话由 tmux 服务器保持，nanogrip 重启后仍然存在；会话记录保存在 workspace/tmux/sessions.json。
+
+const (
+	tmuxDirName          = "tmux"
+	tmuxSessionsFileName = "sessions.json"
+	tmuxSocketName       = "nanogrip.sock"
+
+	tmuxCommandTimeout = 10 * time.Second // 单条 tmux 命令的超时时间
+	tmuxDefaultWait    = 1                // send_keys 和 new_session 之后读取窗格前默认等待的秒数
+	tmuxMaxWait        = 30               // 最多等待的秒数
+	tmuxDefaultLines   = 200              // capture_pane 默认读取的历史行数
+	tmuxMaxLines       = 2000             // capture_pane 最多读取的历史行数
+	tmuxPreviewLines   = 40               // send_keys 之后返回的窗格行数
+)
+
+// tmuxSessionName 会话名称只允许字母、数字、下划线和连字符（会作为 tmux 的目标参数）
+var tmuxSessionName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// TmuxAvailable 判断当前系统能否使用 tmux 工具（非 Windows 且 PATH 中有 tmux）
+func TmuxAvailable() bool {
+	if runtime.GOOS == "windows" {
+		return false
+	}
+	_, err := exec.LookPath("tmux")
+	return err == nil
+}
+
+// TmuxSession 是一个由工具创建的 tmux 会话
+type TmuxSession struct {
+	Name      string    `json:"name"`              // 会话名称
+	Command   string    `json:"command,omitempty"` // 创建时执行的命令
+	CreatedAt time.Time `json:"created_at"`        // 创建时间
+	LastUsed  time.Time `json:"last_used"`         // 最后一次发送按键或读取的时间
+}
+
+// TmuxTool 提供 tmux 会话操作
+type TmuxTool struct {
+	BaseTool
+	workspace string
+	socket    string         // tmux 服务器的 socket 路径
+	policy    *CommandPolicy // 命令黑名单和环境变量清理（nil 表示不检查）
+	mu        sync.Mutex     // 保护 sessions.json 的读写
+}
+
+// NewTmuxTool 创建一个新的 tmux 工具
+// 参数:
+//
+//	workspace: 工作区目录路径（会话记录保存在 workspace/tmux/sessions.json）
+//	socketDir: tmux socket 所在目录，为空时使用 workspace/tmux
+//
+// 返回:
+//
+//	配置好的TmuxTool实例
+func NewTmuxTool(workspace, socketDir string) *TmuxTool {
+	if socketDir == "" {
+		socketDir = filepath.Join(workspace, tmuxDirName)
+	}
+
+	return &TmuxTool{
+		BaseTool: NewBaseTool(
+			"tmux",
+			"Drive interactive terminal programs (ssh, sudo, installers, REPLs, top) through named tmux sessions. Operations:\n\n"+
+				"- new_session: start a shell in session 'session', optionally typing 'command' into it\n"+
+				"- send_keys: type 'keys' into the session; with literal=false, 'keys' are tmux key names separated by spaces (C-c, Enter, Up, Escape)\n"+
+				"- capture_pane: return the last 'lines' lines of the session's screen and scrollback\n"+
+				"- kill_session: end the session\n"+
+				"- list_sessions: list running sessions\n\n"+
+				"new_session and send_keys wait 'wait' seconds and return the visible screen, so you can see prompts (Password:, [y/N]) and answer them with send_keys. "+
+				"Sessions keep running between turns; kill them when done.",
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"operation": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"new_session", "send_keys", "capture_pane", "kill_session", "list_sessions"},
+						"description": "Operation to perform",
+					},
+					"session": map[string]interface{}{
+						"type":        "string",
+						"description": "Session name (letters, digits, _ and -), required except for list_sessions",
+					},
+					"command": map[string]interface{}{
+						"type":        "string",
+						"description": "Command to type into the new session (for new_session)",
+					},
+					"keys": map[string]interface{}{
+						"type":        "string",
+						"description": "Text or key names to send (for send_keys)",
+					},
+					"literal": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Send 'keys' as literal text (default true); false sends tmux key names",
+					},
+					"enter": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Press Enter after literal text (default true)",
+					},
+					"wait": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("Seconds to wait before reading the screen (new_session and send_keys, default %d, max %d)", tmuxDefaultWait, tmuxMaxWait),
+					},
+					"lines": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("Lines of history to return (for capture_pane, default %d)", tmuxDefaultLines),
+					},
+				},
+				"required": []string{"operation"},
+			},
+		),
+		workspace: workspace,
+		socket:    filepath.Join(socketDir, tmuxSocketName),
+	}
+}
+
+// SetPolicy 设置命令策略
+// 创建会话时的命令和发送的文本按黑名单检查，tmux 服务器启动时从环境变量中去除密钥
+func (t *TmuxTool) SetPolicy(policy *CommandPolicy) {
+	t.policy = policy
+}
+
+// Execute 执行 tmux 操作
+// 参数:
+//
+//	ctx: 上下文对象
+//	params: 参数map，必须包含"operation"，除 list_sessions 外需要"session"
+//
+// 返回:
+//
+//	操作结果，new_session 和 send_keys 附带窗格当前的内容
+func (t *TmuxTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	operation, _ := params["operation"].(string)
+	if operation == "list_sessions" {
+		return t.listSessions(ctx)
+	}
+
+	session, _ := params["session"].(string)
+	session = strings.TrimSpace(session)
+	if !tmuxSessionName.MatchString(session) {
+		return "", fmt.Errorf("invalid session name %q: use 1-32 letters, digits, _ or -", session)
+	}
+
+	wait := tmuxDefaultWait
+	if v, ok := params["wait"].(float64); ok && v >= 0 {
+		wait = min(int(v), tmuxMaxWait)
+	}
+
+	switch operation {
+	case "new_session":
+		command, _ := params["command"].(string)
+		return t.newSession(ctx, session, strings.TrimSpace(command), wait)
+	case "send_keys":
+		keys, _ := params["keys"].(string)
+		literal, enter := true, true
+		if v, ok := params["literal"].(bool); ok {
+			literal = v
+		}
+		if v, ok := params["enter"].(bool); ok {
+			enter = v
+		}
+		return t.sendKeys(ctx, session, keys, literal, enter, wait)
+	case "capture_pane":
+		lines := tmuxDefaultLines
+		if v, ok := params["lines"].(float64); ok && v > 0 {
+			lines = min(int(v), tmuxMaxLines)
+		}
+		return t.capture(ctx, session, lines)
+	case "kill_session":
+		return t.killSession(ctx, session)
+	default:
+		return "", fmt.Errorf("unknown operation: %s", operation)
+	}
+}
+
+// newSession 创建会话并在其中执行 command
+func (t *TmuxTool) newSession(ctx context.Context, session, command string, wait int) (string, error) {
+	if err := t.policy.Check(command); err != nil {
+		return "", fmt.Errorf("command blocked by policy: %v", err)
+	}
+	if t.hasSession(ctx, session) {
+		return "", fmt.Errorf("session %s already exists; use send_keys, or kill_session first", session)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.socket), 0700); err != nil {
+		return "", err
+	}
+
+	// 固定窗口大小，没有客户端连接时输出也按 200 列排版
+	if _, err := t.tmux(ctx, "new-session", "-d", "-s", session, "-x", "200", "-y", "50", "-c", t.workspace); err != nil {
+		return "", err
+	}
+	if command != "" {
+		if _, err := t.tmux(ctx, "send-keys", "-t", tmuxTarget(session), "-l", "--", command); err != nil {
+			return "", err
+		}
+		if _, err := t.tmux(ctx, "send-keys", "-t", tmuxTarget(session), "Enter"); err != nil {
+			return "", err
+		}
+	}
+	t.record(session, command, true)
+
+	screen, err := t.screen(ctx, session, wait)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Session %s started.\n\n%s", session, screen), nil
+}
+
+// sendKeys 向会话发送文本或按键
+func (t *TmuxTool) sendKeys(ctx context.Context, session, keys string, literal, enter bool, wait int) (string, error) {
+	if keys == "" && !(literal && enter) {
+		return "", fmt.Errorf("missing keys parameter")
+	}
+	if !t.hasSession(ctx, session) {
+		return "", fmt.Errorf("session %s does not exist; create it with new_session", session)
+	}
+
+	if literal {
+		if err := t.policy.Check(keys); err != nil {
+			return "", fmt.Errorf("keys blocked by policy: %v", err)
+		}
+		if keys != "" {
+			if _, err := t.tmux(ctx, "send-keys", "-t", tmuxTarget(session), "-l", "--", keys); err != nil {
+				return "", err
+			}
+		}
+		if enter {
+			if _, err := t.tmux(ctx, "send-keys", "-t", tmuxTarget(session), "Enter"); err != nil {
+				return "", err
+			}
+		}
+	} else {
+		args := append([]string{"send-keys", "-t", tmuxTarget(session), "--"}, strings.Fields(keys)...)
+		if _, err := t.tmux(ctx, args...); err != nil {
+			return "", err
+		}
+	}
+	t.record(session, "", false)
+
+	return t.screen(ctx, session, wait)
+}
+
+// capture 返回会话窗格最近 lines 行的内容
+func (t *TmuxTool) capture(ctx context.Context, session string, lines int) (string, error) {
+	out, err := t.tmux(ctx, "capture-pane", "-p", "-J", "-t", tmuxTarget(session), "-S", fmt.Sprintf("-%d", lines))
+	if err != nil {
+		return "", err
+	}
+	t.record(session, "", false)
+	out = strings.TrimRight(out, "\n ")
+	if out == "" {
+		return "(the pane is empty)", nil
+	}
+	return out, nil
+}
+
+// screen 等待 wait 秒后返回窗格最后几行的内容
+func (t *TmuxTool) screen(ctx context.Context, session string, wait int) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(time.Duration(wait) * time.Second):
+	}
+
+	out, err := t.capture(ctx, session, tmuxPreviewLines)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(out, "\n")
+	if len(lines) > tmuxPreviewLines {
+		lines = lines[len(lines)-tmuxPreviewLines:]
+	}
+	return "Screen:\n```\n" + strings.Join(lines, "\n") + "\n```", nil
+}
+
+// killSession 结束会话并删除记录
+func (t *TmuxTool) killSession(ctx context.Context, session string) (string, error) {
+	_, err := t.tmux(ctx, "kill-session", "-t", "="+session)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sessions, loadErr := t.load()
+	if loadErr == nil {
+		if _, ok := sessions[session]; ok {
+			delete(sessions, session)
+			loadErr = t.save(sessions)
+		}
+	}
+
+	if err != nil {
+		return "", err
+	}
+	if loadErr != nil {
+		return "", loadErr
+	}
+	return fmt.Sprintf("Session %s killed.", session), nil
+}
+
+// listSessions 列出正在运行的会话，并删除已经不存在的会话的记录（例如 tmux 服务器重启后）
+func (t *TmuxTool) listSessions(ctx context.Context) (string, error) {
+	running := make(map[string]bool)
+	if out, err := t.tmux(ctx, "list-sessions", "-F", "#{session_name}"); err == nil {
+		for _, name := range strings.Fields(out) {
+			running[name] = true
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sessions, err := t.load()
+	if err != nil {
+		return "", err
+	}
+	changed := false
+	for name := range sessions {
+		if !running[name] {
+			delete(sessions, name)
+			changed = true
+		}
+	}
+	if changed {
+		if err := t.save(sessions); err != nil {
+			return "", err
+		}
+	}
+
+	if len(running) == 0 {
+		return "No tmux sessions running.", nil
+	}
+	names := make([]string, 0, len(running))
+	for name := range running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "tmux sessions (%d):\n", len(names))
+	for _, name := range names {
+		fmt.Fprintf(&sb, "- %s", name)
+		if s, ok := sessions[name]; ok {
+			fmt.Fprintf(&sb, " (started %s, last used %s)", s.CreatedAt.Format("2006-01-02 15:04"), s.LastUsed.Format("2006-01-02 15:04"))
+			if s.Command != "" {
+				fmt.Fprintf(&sb, ": %s", s.Command)
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// hasSession 判断会话是否在运行
+func (t *TmuxTool) hasSession(ctx context.Context, session string) bool {
+	_, err := t.tmux(ctx, "has-session", "-t", "="+session)
+	return err == nil
+}
+
+// tmuxTarget 返回会话当前窗格的目标参数，"=" 表示精确匹配名称（否则 tmux 会匹配名称的前缀）
+func tmuxTarget(session string) string {
+	return "=" + session + ":"
+}
+
+// tmux 在工具的私有 socket 上执行一条 tmux 命令
+func (t *TmuxTool) tmux(ctx context.Context, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, tmuxCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "tmux", append([]string{"-S", t.socket}, args...)...)
+	if t.policy != nil {
+		cmd.Env = t.policy.Env(os.Environ())
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return "", fmt.Errorf("tmux %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("tmux %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// ===== 存储 =====
+
+// record 更新会话的最后使用时间，created 表示新建会话；写入失败只影响 list_sessions 的显示
+func (t *TmuxTool) record(session, command string, created bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sessions, err := t.load()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	s, ok := sessions[session]
+	if !ok || created {
+		s = &TmuxSession{Name: session, Command: command, CreatedAt: now}
+		sessions[session] = s
+	}
+	s.LastUsed = now
+	_ = t.save(sessions)
+}
+
+// load 读取 sessions.json，文件不存在时返回空记录
+func (t *TmuxTool) load() (map[string]*TmuxSession, error) {
+	sessions := make(map[string]*TmuxSession)
+	raw, err := os.ReadFile(filepath.Join(t.workspace, tmuxDirName, tmuxSessionsFileName))
+	if os.IsNotExist(err) {
+		return sessions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []*TmuxSession
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", tmuxSessionsFileName, err)
+	}
+	for _, s := range list {
+		sessions[s.Name] = s
+	}
+	return sessions, nil
+}
+
+// save 写入 sessions.json（按名称排序）
+func (t *TmuxTool) save(sessions map[string]*TmuxSession) error {
+	list := make([]*TmuxSession, 0, len(sessions))
+	for _, s := range sessions {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return atomicWriteJSON(filepath.Join(t.workspace, tmuxDirName, tmuxSessionsFileName), list)
+}
@@ -5,12 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Ailoc/nanogrip/internal/cron"
 	"github.com/google/uuid"
 )
 
@@ -24,6 +28,7 @@ const (
 	todoOperationArchiveProject = "archive_project"
 	todoOperationDeleteProject  = "delete_project"
 	todoOperationDeleteTodo     = "delete_todo"
+	todoOperationNextTodo       = "next_todo"
 
 	projectStatusActive   = "active"
 	projectStatusArchived = "archived"
@@ -37,6 +42,16 @@ const (
 	todoPriorityHigh   = "high"
 	todoPriorityMedium = "medium"
 	todoPriorityLow    = "low"
+
+	todoRecurrenceDaily   = "daily"
+	todoRecurrenceWeekly  = "weekly"
+	todoRecurrenceMonthly = "monthly"
+
+	todoFilterDueToday = "due_today"
+	todoFilterOverdue  = "overdue"
+
+	// todoReminderPrefix 是待办提醒定时任务的 ID 前缀（后接待办 ID）
+	todoReminderPrefix = "todo:"
 )
 
 var (
@@ -48,6 +63,7 @@ var (
 		todoOperationArchiveProject,
 		todoOperationDeleteProject,
 		todoOperationDeleteTodo,
+		todoOperationNextTodo,
 	}
 
 	validTodoStatuses = map[string]struct{}{
@@ -87,6 +103,11 @@ type TodoItem struct {
 	CreatedAt   time.Time `json:"created_at"`   // 创建时间
 	UpdatedAt   time.Time `json:"updated_at"`   // 更新时间
 	CompletedAt time.Time `json:"completed_at"` // 完成时间（可选）
+	DueAt       time.Time `json:"due_at"`       // 截止时间（可选），到期时向添加待办的聊天发送提醒
+	Recurrence  string    `json:"recurrence"`   // 重复规则: daily, weekly, monthly（可选），完成后截止时间顺延
+	Channel     string    `json:"channel"`      // 添加待办的频道（提醒发送到这里）
+	ChatID      string    `json:"chat_id"`      // 添加待办的聊天ID
+	DependsOn   []string  `json:"depends_on"`   // 依赖的待办ID，全部完成后才能开始（可选）
 }
 
 // TodoListData 单一项目的待办列表数据
@@ -109,6 +130,7 @@ type TodoTool struct {
 	BaseTool
 	workspace string
 	mu        sync.Mutex
+	cron      *cron.CronService // 为有截止时间的待办调度提醒（为 nil 时不提醒）
 }
 
 // NewTodoTool 创建一个新的多项目待办事项工具。
@@ -116,7 +138,7 @@ func NewTodoTool(workspace string) *TodoTool {
 	return &TodoTool{
 		BaseTool: NewBaseTool(
 			"todo",
-			"待办事项管理工具（Agentic Task Manager）- 支持多项目/多任务的规划、执行和跟踪。\n\n设计理念：\n- Plan（规划）：使用 add_todos 自动创建项目并写入任务计划\n- Execute（执行）：逐步执行每个待办项\n- Track（跟踪）：通过状态跟踪任务进度\n- Review（回顾）：完成后更新状态并归档项目\n\n可用操作：\n- list_projects: 列出项目\n- add_todos: 批量添加待办事项（按 project_name 自动查找或创建活跃项目）\n- list_todos: 列出项目中的待办\n- update_todo: 更新待办状态\n- archive_project: 归档项目\n- delete_project: 删除项目\n- delete_todo: 删除待办\n\n使用方式：\n1. 规划任务时调用 add_todos，并传入 project_name 与 todos 数组\n2. add_todos 的返回值包含 project_id 和 todo_ids，后续用它们更新状态\n3. 所有步骤完成后调用 archive_project 保持列表整洁",
+			"待办事项管理工具（Agentic Task Manager）- 支持多项目/多任务的规划、执行和跟踪。\n\n设计理念：\n- Plan（规划）：使用 add_todos 自动创建项目并写入任务计划\n- Execute（执行）：逐步执行每个待办项\n- Track（跟踪）：通过状态跟踪任务进度\n- Review（回顾）：完成后更新状态并归档项目\n\n可用操作：\n- list_projects: 列出项目\n- add_todos: 批量添加待办事项（按 project_name 自动查找或创建活跃项目）\n- list_todos: 列出项目中的待办（filter=due_today/overdue 时跨项目列出今天到期或已逾期的待办）\n- update_todo: 更新待办状态\n- archive_project: 归档项目\n- delete_project: 删除项目\n- delete_todo: 删除待办\n- next_todo: 返回下一个可以执行的待办（进行中的优先，其次是依赖已完成、优先级最高的待处理待办）\n\n使用方式：\n1. 规划任务时调用 add_todos，并传入 project_name 与 todos 数组\n2. add_todos 的返回值包含 project_id 和 todo_ids，后续用它们更新状态；每一步开始前调用 next_todo 获取下一个待执行的待办\n3. 所有步骤完成后调用 archive_project 保持列表整洁\n\n截止时间与提醒：\n- 待办可以带 due_at（截止时间）和 recurrence（daily/weekly/monthly），到期时自动向当前聊天发送提醒\n- 重复待办标记为 completed 后会顺延到下一个截止时间并恢复为 pending",
 			map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -135,11 +157,11 @@ func NewTodoTool(workspace string) *TodoTool {
 					},
 					"project_id": map[string]interface{}{
 						"type":        "string",
-						"description": "项目ID（list_todos/update_todo/delete_todo/archive_project/delete_project 时必需）",
+						"description": "项目ID（update_todo/delete_todo/archive_project/delete_project 时必需；list_todos 不带 filter 时必需；next_todo 不带时从所有活跃项目中选择）",
 					},
 					"todos": map[string]interface{}{
 						"type":        "array",
-						"description": "待办事项列表（add_todos 时必需）。每个元素包含 content（必需）和 priority（可选，默认 medium）",
+						"description": "待办事项列表（add_todos 时必需）。每个元素包含 content（必需）、priority（可选，默认 medium）、due_at、recurrence 和 depends_on（可选）",
 						"items": map[string]interface{}{
 							"type": "object",
 							"properties": map[string]interface{}{
@@ -152,6 +174,20 @@ func NewTodoTool(workspace string) *TodoTool {
 									"enum":        []string{todoPriorityHigh, todoPriorityMedium, todoPriorityLow},
 									"description": "优先级",
 								},
+								"due_at": map[string]interface{}{
+									"type":        "string",
+									"description": todoDueAtDescription,
+								},
+								"recurrence": map[string]interface{}{
+									"type":        "string",
+									"enum":        []string{todoRecurrenceDaily, todoRecurrenceWeekly, todoRecurrenceMonthly},
+									"description": "重复规则（需要 due_at）",
+								},
+								"depends_on": map[string]interface{}{
+									"type":        "array",
+									"items":       map[string]interface{}{"type": "string"},
+									"description": "依赖的待办：已有待办的ID，或同一批 todos 中排在前面的待办序号（从 1 开始，例如 \"1\"）",
+								},
 							},
 							"required": []string{"content"},
 						},
@@ -165,6 +201,20 @@ func NewTodoTool(workspace string) *TodoTool {
 						"enum":        []string{todoStatusPending, todoStatusInProgress, todoStatusCompleted, todoStatusFailed},
 						"description": "状态",
 					},
+					"due_at": map[string]interface{}{
+						"type":        "string",
+						"description": "update_todo 时修改截止时间（" + todoDueAtDescription + "，\"none\" 表示清除）",
+					},
+					"recurrence": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{todoRecurrenceDaily, todoRecurrenceWeekly, todoRecurrenceMonthly, "none"},
+						"description": "update_todo 时修改重复规则（\"none\" 表示不重复）",
+					},
+					"filter": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{todoFilterDueToday, todoFilterOverdue},
+						"description": "list_todos 的过滤条件：due_today 今天到期，overdue 已逾期（只列出未完成的待办，不带 project_id 时跨所有活跃项目）",
+					},
 					"include_archived": map[string]interface{}{
 						"type":        "boolean",
 						"description": "是否包含已归档项目，默认 false",
@@ -177,6 +227,116 @@ func NewTodoTool(workspace string) *TodoTool {
 	}
 }
 
+// todoDueAtDescription 是 due_at 参数的格式说明
+const todoDueAtDescription = "截止时间，本地时间 YYYY-MM-DDTHH:MM 或 YYYY-MM-DD（只有日期时按当天 09:00 提醒）"
+
+// SetCronService 设置用于调度待办提醒的定时任务服务，并为已有的未完成待办恢复提醒
+// 定时任务只保存在内存中，所以每次启动都需要重新调度
+// 参数:
+//
+//	service: 定时任务服务
+func (t *TodoTool) SetCronService(service *cron.CronService) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cron = service
+	if service == nil {
+		return
+	}
+
+	manifest, err := t.loadManifest()
+	if err != nil {
+		log.Printf("[Todo] 恢复待办提醒失败: %v", err)
+		return
+	}
+	scheduled := 0
+	for _, project := range manifest.Projects {
+		if project.Status != projectStatusActive {
+			continue
+		}
+		todoData, err := t.loadProjectTodos(project.ID)
+		if err != nil {
+			log.Printf("[Todo] 加载项目 %s 的待办失败: %v", project.Name, err)
+			continue
+		}
+		for _, todo := range todoData.Todos {
+			if t.scheduleReminder(todo) {
+				scheduled++
+			}
+		}
+	}
+	if scheduled > 0 {
+		log.Printf("[Todo] 已恢复 %d 个待办提醒", scheduled)
+	}
+}
+
+// Backlog 汇总所有活跃项目中未完成的待办（pending + in_progress）
+// 返回:
+//
+//	有未完成待办的项目数、未完成待办总数
+func (t *TodoTool) Backlog() (int, int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	manifest, err := t.loadManifest()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	projects, open := 0, 0
+	for _, project := range manifest.Projects {
+		if project.Status != projectStatusActive {
+			continue
+		}
+		if n := project.Stats.Pending + project.Stats.InProgress; n > 0 {
+			projects++
+			open += n
+		}
+	}
+	return projects, open, nil
+}
+
+// CompletedSince 返回活跃项目中在 since 之后完成的待办（用于每日摘要）
+// 返回:
+//
+//	"项目名: 待办内容" 列表，按完成时间排序
+func (t *TodoTool) CompletedSince(since time.Time) ([]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	manifest, err := t.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	type entry struct {
+		project string
+		todo    TodoItem
+	}
+	var completed []entry
+	for _, project := range manifest.Projects {
+		if project.Status != projectStatusActive || project.Stats.Completed == 0 {
+			continue
+		}
+		data, err := t.loadProjectTodos(project.ID)
+		if err != nil {
+			continue
+		}
+		for _, todo := range data.Todos {
+			if todo.Status == todoStatusCompleted && todo.CompletedAt.After(since) {
+				completed = append(completed, entry{project: project.Name, todo: todo})
+			}
+		}
+	}
+	sort.Slice(completed, func(i, j int) bool { return completed[i].todo.CompletedAt.Before(completed[j].todo.CompletedAt) })
+
+	items := make([]string, 0, len(completed))
+	for _, e := range completed {
+		items = append(items, e.project+": "+e.todo.Content)
+	}
+	return items, nil
+}
+
 func (t *TodoTool) getDirs() (string, string, string) {
 	baseDir := filepath.Join(t.workspace, "todos")
 	currentDir := filepath.Join(baseDir, "current")
@@ -372,36 +532,38 @@ func normalizeTodoData(todoData *TodoListData, projectID string) {
 // Execute 执行待办事项操作。
 func (t *TodoTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
 	if err := ctx.Err(); err != nil {
-		return todoError("操作已取消: " + err.Error()), nil
+		return todoError("操作已取消: " + err.Error())
 	}
 
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
 	if err := t.ensureDirs(); err != nil {
-		return todoError("创建目录失败: " + err.Error()), nil
+		return todoError("创建目录失败: " + err.Error())
 	}
 
 	operation := stringParam(params, "operation")
 	switch operation {
 	case "":
-		return todoError("operation 是必需参数"), nil
+		return todoError("operation 是必需参数")
 	case todoOperationListProjects:
 		return t.handleListProjects(params)
 	case todoOperationAddTodos:
-		return t.handleAddTodos(params)
+		return t.handleAddTodos(ctx, params)
 	case todoOperationListTodos:
 		return t.handleListTodos(params)
 	case todoOperationUpdateTodo:
-		return t.handleUpdateTodo(params)
+		return t.handleUpdateTodo(ctx, params)
 	case todoOperationArchiveProject:
 		return t.handleArchiveProject(params)
 	case todoOperationDeleteProject:
 		return t.handleDeleteProject(params)
 	case todoOperationDeleteTodo:
 		return t.handleDeleteTodo(params)
+	case todoOperationNextTodo:
+		return t.handleNextTodo(params)
 	default:
-		return todoError(fmt.Sprintf("未知操作: %s，有效操作: %s", operation, strings.Join(validTodoOperations, ", "))), nil
+		return todoError(fmt.Sprintf("未知操作: %s，有效操作: %s", operation, strings.Join(validTodoOperations, ", ")))
 	}
 }
 
@@ -410,7 +572,7 @@ func (t *TodoTool) handleListProjects(params map[string]interface{}) (string, er
 
 	manifest, err := t.loadManifest()
 	if err != nil {
-		return todoError("加载索引失败: " + err.Error()), nil
+		return todoError("加载索引失败: " + err.Error())
 	}
 
 	activeProjects := make([]Project, 0)
@@ -452,23 +614,23 @@ func (t *TodoTool) handleListProjects(params map[string]interface{}) (string, er
 	return builder.String(), nil
 }
 
-func (t *TodoTool) handleAddTodos(params map[string]interface{}) (string, error) {
+func (t *TodoTool) handleAddTodos(ctx context.Context, params map[string]interface{}) (string, error) {
 	projectName := stringParam(params, "project_name")
 	if projectName == "" {
-		return todoError("project_name 是必需参数，用于自动查找或创建项目"), nil
+		return todoError("project_name 是必需参数，用于自动查找或创建项目")
 	}
 
 	todoInputs, skippedCount, err := parseTodoInputs(params["todos"])
 	if err != nil {
-		return todoError(err.Error()), nil
+		return todoError(err.Error())
 	}
 	if len(todoInputs) == 0 {
-		return todoError("没有有效的待办项被添加，请检查 todos 参数格式"), nil
+		return todoError("没有有效的待办项被添加，请检查 todos 参数格式")
 	}
 
 	manifest, err := t.loadManifest()
 	if err != nil {
-		return todoError("加载索引失败: " + err.Error()), nil
+		return todoError("加载索引失败: " + err.Error())
 	}
 
 	now := time.Now()
@@ -492,21 +654,36 @@ func (t *TodoTool) handleAddTodos(params map[string]interface{}) (string, error)
 	project := manifest.Projects[projectIndex]
 	todoData, err := t.loadProjectTodos(project.ID)
 	if err != nil {
-		return todoError("加载待办失败: " + err.Error()), nil
+		return todoError("加载待办失败: " + err.Error())
 	}
 	todoData.ProjectID = project.ID
 	todoData.ProjectName = project.Name
 
+	channel, chatID := "", ""
+	if toolCtx, ok := ToolContextFrom(ctx); ok {
+		channel, chatID = toolCtx.Channel, toolCtx.ChatID
+	}
+
 	addedTodos := make([]TodoItem, 0, len(todoInputs))
 	addedTodoIDs := make([]string, 0, len(todoInputs))
-	for _, input := range todoInputs {
+	reminders := 0
+	for i, input := range todoInputs {
+		dependsOn, err := resolveTodoDependencies(input.DependsOn, i, addedTodoIDs, todoData)
+		if err != nil {
+			return todoError(fmt.Sprintf("待办 %q: %s", input.Content, err.Error()))
+		}
 		todo := TodoItem{
-			ID:        uuid.NewString(),
-			Content:   input.Content,
-			Status:    todoStatusPending,
-			Priority:  normalizePriority(input.Priority),
-			CreatedAt: now,
-			UpdatedAt: now,
+			ID:         uuid.NewString(),
+			Content:    input.Content,
+			Status:     todoStatusPending,
+			Priority:   normalizePriority(input.Priority),
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			DueAt:      input.DueAt,
+			Recurrence: input.Recurrence,
+			Channel:    channel,
+			ChatID:     chatID,
+			DependsOn:  dependsOn,
 		}
 		todoData.Todos = append(todoData.Todos, todo)
 		addedTodos = append(addedTodos, todo)
@@ -517,10 +694,15 @@ func (t *TodoTool) handleAddTodos(params map[string]interface{}) (string, error)
 	manifest.Projects[projectIndex].UpdatedAt = now
 
 	if err := t.saveProjectTodos(todoData); err != nil {
-		return todoError("保存待办失败: " + err.Error()), nil
+		return todoError("保存待办失败: " + err.Error())
 	}
 	if err := t.saveManifest(manifest); err != nil {
-		return todoError("保存索引失败: " + err.Error()), nil
+		return todoError("保存索引失败: " + err.Error())
+	}
+	for _, todo := range addedTodos {
+		if t.scheduleReminder(todo) {
+			reminders++
+		}
 	}
 
 	result := map[string]interface{}{
@@ -533,6 +715,9 @@ func (t *TodoTool) handleAddTodos(params map[string]interface{}) (string, error)
 		"todo_ids":        addedTodoIDs,
 		"added_todos":     addedTodos,
 	}
+	if reminders > 0 {
+		result["reminders_scheduled"] = reminders
+	}
 	if projectCreated {
 		result["message"] = fmt.Sprintf("已自动创建项目 %q 并添加 %d 个待办", project.Name, len(addedTodos))
 	}
@@ -541,24 +726,27 @@ func (t *TodoTool) handleAddTodos(params map[string]interface{}) (string, error)
 
 func (t *TodoTool) handleListTodos(params map[string]interface{}) (string, error) {
 	projectID := stringParam(params, "project_id")
+	if filter := stringParam(params, "filter"); filter != "" {
+		return t.handleFilteredTodos(projectID, filter)
+	}
 	if projectID == "" {
-		return todoError("project_id 是列出待办的必需参数"), nil
+		return todoError("project_id 是列出待办的必需参数")
 	}
 
 	manifest, err := t.loadManifest()
 	if err != nil {
-		return todoError("加载索引失败: " + err.Error()), nil
+		return todoError("加载索引失败: " + err.Error())
 	}
 
 	idx := projectIndexByID(manifest, projectID)
 	if idx < 0 || manifest.Projects[idx].Status == projectStatusDeleted {
-		return todoError("未找到项目: " + projectID), nil
+		return todoError("未找到项目: " + projectID)
 	}
 	project := manifest.Projects[idx]
 
 	todoData, err := t.loadProjectTodos(projectID)
 	if err != nil {
-		return todoError("加载待办失败: " + err.Error()), nil
+		return todoError("加载待办失败: " + err.Error())
 	}
 	if len(todoData.Todos) == 0 {
 		return fmt.Sprintf("# 项目待办: %s\n\n项目ID: `%s`\n\n暂无待办事项", project.Name, project.ID), nil
@@ -578,104 +766,212 @@ func (t *TodoTool) handleListTodos(params map[string]interface{}) (string, error
 		}
 	}
 
+	statuses := todoStatusByID(todoData.Todos)
 	var builder strings.Builder
 	builder.WriteString(fmt.Sprintf("# 项目待办: %s\n\n项目ID: `%s`\n\n", project.Name, project.ID))
-	writeTodoSection(&builder, "## 🔄 进行中", inProgress)
-	writeTodoSection(&builder, "## ⏳ 待处理", pending)
-	writeTodoSection(&builder, "## ✅ 已完成", completed)
-	writeTodoSection(&builder, "## ❌ 失败", failed)
+	writeTodoSection(&builder, "## 🔄 进行中", inProgress, statuses)
+	writeTodoSection(&builder, "## ⏳ 待处理", pending, statuses)
+	writeTodoSection(&builder, "## ✅ 已完成", completed, statuses)
+	writeTodoSection(&builder, "## ❌ 失败", failed, statuses)
 	builder.WriteString(fmt.Sprintf("---\n**统计**: 总计 %d | 进行中 %d | 待处理 %d | 已完成 %d | 失败 %d",
 		len(todoData.Todos), len(inProgress), len(pending), len(completed), len(failed)))
 	return builder.String(), nil
 }
 
-func (t *TodoTool) handleUpdateTodo(params map[string]interface{}) (string, error) {
+// handleFilteredTodos 列出今天到期或已逾期的未完成待办
+// projectID 为空时遍历所有活跃项目
+func (t *TodoTool) handleFilteredTodos(projectID, filter string) (string, error) {
+	now := time.Now()
+	var title string
+	var match func(due time.Time) bool
+	switch filter {
+	case todoFilterDueToday:
+		title = "今天到期的待办"
+		year, month, day := now.Date()
+		match = func(due time.Time) bool {
+			y, m, d := due.Date()
+			return y == year && m == month && d == day
+		}
+	case todoFilterOverdue:
+		title = "已逾期的待办"
+		match = func(due time.Time) bool { return due.Before(now) }
+	default:
+		return todoError(fmt.Sprintf("无效的 filter: %s，有效值: %s, %s", filter, todoFilterDueToday, todoFilterOverdue))
+	}
+
+	manifest, err := t.loadManifest()
+	if err != nil {
+		return todoError("加载索引失败: " + err.Error())
+	}
+
+	var builder strings.Builder
+	builder.WriteString("# " + title + "\n\n")
+	count := 0
+	for _, project := range manifest.Projects {
+		if projectID != "" && project.ID != projectID {
+			continue
+		}
+		if project.Status == projectStatusDeleted || (projectID == "" && project.Status != projectStatusActive) {
+			continue
+		}
+		todoData, err := t.loadProjectTodos(project.ID)
+		if err != nil {
+			return todoError("加载待办失败: " + err.Error())
+		}
+		for _, todo := range todoData.Todos {
+			if !todoIsOpen(todo) || todo.DueAt.IsZero() || !match(todo.DueAt.Local()) {
+				continue
+			}
+			count++
+			builder.WriteString(fmt.Sprintf("- %s `%s` **[%s]** %s%s — 项目: %s (`%s`)\n",
+				priorityIcon(todo.Priority), todo.ID, todo.Status, todo.Content, todoDueLabel(todo), project.Name, project.ID))
+		}
+	}
+	if count == 0 {
+		return fmt.Sprintf("# %s\n\n暂无%s", title, title), nil
+	}
+	builder.WriteString(fmt.Sprintf("\n---\n**统计**: %d 个待办", count))
+	return builder.String(), nil
+}
+
+func (t *TodoTool) handleUpdateTodo(ctx context.Context, params map[string]interface{}) (string, error) {
 	projectID := stringParam(params, "project_id")
 	if projectID == "" {
-		return todoError("project_id 是更新待办的必需参数"), nil
+		return todoError("project_id 是更新待办的必需参数")
 	}
 	todoID := stringParam(params, "todo_id")
 	if todoID == "" {
-		return todoError("todo_id 是更新待办的必需参数"), nil
+		return todoError("todo_id 是更新待办的必需参数")
 	}
 	status := stringParam(params, "status")
-	if !isValidTodoStatus(status) {
-		return todoError("无效的状态，请使用: pending, in_progress, completed, failed"), nil
+	dueParam := stringParam(params, "due_at")
+	recurrenceParam, recurrenceSet := params["recurrence"].(string)
+	if status == "" && dueParam == "" && !recurrenceSet {
+		return todoError("status、due_at 或 recurrence 至少需要提供一个")
+	}
+	if status != "" && !isValidTodoStatus(status) {
+		return todoError("无效的状态，请使用: pending, in_progress, completed, failed")
 	}
 
 	manifest, err := t.loadManifest()
 	if err != nil {
-		return todoError("加载索引失败: " + err.Error()), nil
+		return todoError("加载索引失败: " + err.Error())
 	}
 	projectIndex := projectIndexByID(manifest, projectID)
 	if projectIndex < 0 || manifest.Projects[projectIndex].Status == projectStatusDeleted {
-		return todoError("未找到项目: " + projectID), nil
+		return todoError("未找到项目: " + projectID)
 	}
 
 	todoData, err := t.loadProjectTodos(projectID)
 	if err != nil {
-		return todoError("加载待办失败: " + err.Error()), nil
+		return todoError("加载待办失败: " + err.Error())
 	}
 
 	now := time.Now()
 	todoIndex := todoIndexByID(todoData, todoID)
 	if todoIndex < 0 {
-		return todoError("未找到待办: " + todoID), nil
+		return todoError("未找到待办: " + todoID)
 	}
 
-	todoData.Todos[todoIndex].Status = status
-	todoData.Todos[todoIndex].UpdatedAt = now
-	if status == todoStatusCompleted {
-		todoData.Todos[todoIndex].CompletedAt = now
-	} else {
-		todoData.Todos[todoIndex].CompletedAt = time.Time{}
+	todo := &todoData.Todos[todoIndex]
+	if dueParam != "" {
+		if strings.EqualFold(dueParam, "none") {
+			todo.DueAt = time.Time{}
+		} else if todo.DueAt, err = parseTodoDue(dueParam); err != nil {
+			return todoError(err.Error())
+		}
+	}
+	if recurrenceSet {
+		if todo.Recurrence, err = normalizeRecurrence(recurrenceParam); err != nil {
+			return todoError(err.Error())
+		}
+	}
+	if todo.Channel == "" {
+		if toolCtx, ok := ToolContextFrom(ctx); ok {
+			todo.Channel, todo.ChatID = toolCtx.Channel, toolCtx.ChatID
+		}
+	}
+
+	if status != "" {
+		todo.Status = status
+		if status == todoStatusCompleted {
+			todo.CompletedAt = now
+		} else {
+			todo.CompletedAt = time.Time{}
+		}
+	}
+	todo.UpdatedAt = now
+
+	// 重复待办完成后顺延到下一个截止时间，重新变为待处理
+	rolled := false
+	if todo.Status == todoStatusCompleted && todo.Recurrence != "" && !todo.DueAt.IsZero() {
+		todo.DueAt = nextTodoDue(todo.DueAt, todo.Recurrence, now)
+		todo.Status = todoStatusPending
+		rolled = true
 	}
 
 	manifest.Projects[projectIndex].Stats = calculateStats(todoData.Todos)
 	manifest.Projects[projectIndex].UpdatedAt = now
 
 	if err := t.saveProjectTodos(todoData); err != nil {
-		return todoError("保存待办失败: " + err.Error()), nil
+		return todoError("保存待办失败: " + err.Error())
 	}
 	if err := t.saveManifest(manifest); err != nil {
-		return todoError("保存索引失败: " + err.Error()), nil
+		return todoError("保存索引失败: " + err.Error())
 	}
 
-	return JSONString(map[string]interface{}{
+	if !t.scheduleReminder(*todo) {
+		t.cancelReminder(todo.ID)
+	}
+
+	// 开始执行某一步时发送进度提示（例如 "Step 3/5: 生成图片"）
+	if status == todoStatusInProgress {
+		ReportProgress(ctx, fmt.Sprintf("Step %d/%d: %s", todoIndex+1, len(todoData.Todos), todo.Content))
+	}
+
+	result := map[string]interface{}{
 		"status":     "updated",
 		"todo_id":    todoID,
 		"project_id": projectID,
-		"new_status": status,
-	}), nil
+		"new_status": todo.Status,
+	}
+	if !todo.DueAt.IsZero() {
+		result["due_at"] = todo.DueAt.Format(todoDueLayout)
+	}
+	if rolled {
+		result["message"] = fmt.Sprintf("重复待办已完成，下一次截止时间: %s", todo.DueAt.Format(todoDueLayout))
+	}
+	return JSONString(result), nil
 }
 
 func (t *TodoTool) handleArchiveProject(params map[string]interface{}) (string, error) {
 	projectID := stringParam(params, "project_id")
 	if projectID == "" {
-		return todoError("project_id 是归档项目的必需参数"), nil
+		return todoError("project_id 是归档项目的必需参数")
 	}
 
 	manifest, err := t.loadManifest()
 	if err != nil {
-		return todoError("加载索引失败: " + err.Error()), nil
+		return todoError("加载索引失败: " + err.Error())
 	}
 	projectIndex := projectIndexByID(manifest, projectID)
 	if projectIndex < 0 || manifest.Projects[projectIndex].Status == projectStatusDeleted {
-		return todoError("未找到项目: " + projectID), nil
+		return todoError("未找到项目: " + projectID)
 	}
 	if manifest.Projects[projectIndex].Status == projectStatusArchived {
-		return todoError("项目已归档: " + projectID), nil
+		return todoError("项目已归档: " + projectID)
 	}
 
+	t.cancelProjectReminders(projectID)
 	if err := t.moveProjectFileToArchive(projectID); err != nil {
-		return todoError("移动待办文件到归档目录失败: " + err.Error()), nil
+		return todoError("移动待办文件到归档目录失败: " + err.Error())
 	}
 
 	now := time.Now()
 	manifest.Projects[projectIndex].Status = projectStatusArchived
 	manifest.Projects[projectIndex].UpdatedAt = now
 	if err := t.saveManifest(manifest); err != nil {
-		return todoError("保存索引失败: " + err.Error()), nil
+		return todoError("保存索引失败: " + err.Error())
 	}
 
 	return JSONString(map[string]interface{}{
@@ -688,16 +984,16 @@ func (t *TodoTool) handleArchiveProject(params map[string]interface{}) (string,
 func (t *TodoTool) handleDeleteProject(params map[string]interface{}) (string, error) {
 	projectID := stringParam(params, "project_id")
 	if projectID == "" {
-		return todoError("project_id 是删除项目的必需参数"), nil
+		return todoError("project_id 是删除项目的必需参数")
 	}
 
 	manifest, err := t.loadManifest()
 	if err != nil {
-		return todoError("加载索引失败: " + err.Error()), nil
+		return todoError("加载索引失败: " + err.Error())
 	}
 	projectIndex := projectIndexByID(manifest, projectID)
 	if projectIndex < 0 || manifest.Projects[projectIndex].Status == projectStatusDeleted {
-		return todoError("未找到项目: " + projectID), nil
+		return todoError("未找到项目: " + projectID)
 	}
 
 	now := time.Now()
@@ -705,11 +1001,12 @@ func (t *TodoTool) handleDeleteProject(params map[string]interface{}) (string, e
 	manifest.Projects[projectIndex].Status = projectStatusDeleted
 	manifest.Projects[projectIndex].UpdatedAt = now
 	if err := t.saveManifest(manifest); err != nil {
-		return todoError("保存索引失败: " + err.Error()), nil
+		return todoError("保存索引失败: " + err.Error())
 	}
 
+	t.cancelProjectReminders(projectID)
 	if err := t.removeProjectFiles(projectID); err != nil {
-		return todoError("删除待办文件失败: " + err.Error()), nil
+		return todoError("删除待办文件失败: " + err.Error())
 	}
 
 	return JSONString(map[string]interface{}{
@@ -722,42 +1019,46 @@ func (t *TodoTool) handleDeleteProject(params map[string]interface{}) (string, e
 func (t *TodoTool) handleDeleteTodo(params map[string]interface{}) (string, error) {
 	projectID := stringParam(params, "project_id")
 	if projectID == "" {
-		return todoError("project_id 是删除待办的必需参数"), nil
+		return todoError("project_id 是删除待办的必需参数")
 	}
 	todoID := stringParam(params, "todo_id")
 	if todoID == "" {
-		return todoError("todo_id 是删除待办的必需参数"), nil
+		return todoError("todo_id 是删除待办的必需参数")
 	}
 
 	manifest, err := t.loadManifest()
 	if err != nil {
-		return todoError("加载索引失败: " + err.Error()), nil
+		return todoError("加载索引失败: " + err.Error())
 	}
 	projectIndex := projectIndexByID(manifest, projectID)
 	if projectIndex < 0 || manifest.Projects[projectIndex].Status == projectStatusDeleted {
-		return todoError("未找到项目: " + projectID), nil
+		return todoError("未找到项目: " + projectID)
 	}
 
 	todoData, err := t.loadProjectTodos(projectID)
 	if err != nil {
-		return todoError("加载待办失败: " + err.Error()), nil
+		return todoError("加载待办失败: " + err.Error())
 	}
 
 	todoIndex := todoIndexByID(todoData, todoID)
 	if todoIndex < 0 {
-		return todoError("未找到待办: " + todoID), nil
+		return todoError("未找到待办: " + todoID)
 	}
 
 	todoData.Todos = append(todoData.Todos[:todoIndex], todoData.Todos[todoIndex+1:]...)
+	for i := range todoData.Todos {
+		todoData.Todos[i].DependsOn = removeString(todoData.Todos[i].DependsOn, todoID)
+	}
+	t.cancelReminder(todoID)
 	now := time.Now()
 	manifest.Projects[projectIndex].Stats = calculateStats(todoData.Todos)
 	manifest.Projects[projectIndex].UpdatedAt = now
 
 	if err := t.saveProjectTodos(todoData); err != nil {
-		return todoError("保存待办失败: " + err.Error()), nil
+		return todoError("保存待办失败: " + err.Error())
 	}
 	if err := t.saveManifest(manifest); err != nil {
-		return todoError("保存索引失败: " + err.Error()), nil
+		return todoError("保存索引失败: " + err.Error())
 	}
 
 	return JSONString(map[string]interface{}{
@@ -767,6 +1068,102 @@ func (t *TodoTool) handleDeleteTodo(params map[string]interface{}) (string, erro
 	}), nil
 }
 
+// todoCandidate 是 next_todo 选择时的候选待办
+type todoCandidate struct {
+	project Project
+	todo    TodoItem
+	index   int // 在项目待办列表中的位置
+	total   int // 项目待办总数
+}
+
+// handleNextTodo 返回下一个可以执行的待办
+// 进行中的待办优先；否则在依赖全部完成的待处理待办中按优先级、截止时间和添加顺序选择
+func (t *TodoTool) handleNextTodo(params map[string]interface{}) (string, error) {
+	projectID := stringParam(params, "project_id")
+
+	manifest, err := t.loadManifest()
+	if err != nil {
+		return todoError("加载索引失败: " + err.Error())
+	}
+	if projectID != "" {
+		if idx := projectIndexByID(manifest, projectID); idx < 0 || manifest.Projects[idx].Status == projectStatusDeleted {
+			return todoError("未找到项目: " + projectID)
+		}
+	}
+
+	var candidates []todoCandidate
+	open := 0
+	var blocked []map[string]interface{}
+	for _, project := range manifest.Projects {
+		if projectID != "" && project.ID != projectID {
+			continue
+		}
+		if project.Status == projectStatusDeleted || (projectID == "" && project.Status != projectStatusActive) {
+			continue
+		}
+		todoData, err := t.loadProjectTodos(project.ID)
+		if err != nil {
+			return todoError("加载待办失败: " + err.Error())
+		}
+		statuses := todoStatusByID(todoData.Todos)
+		for i, todo := range todoData.Todos {
+			if !todoIsOpen(todo) {
+				continue
+			}
+			open++
+			if blockers := todoBlockers(todo, statuses); len(blockers) > 0 && todo.Status != todoStatusInProgress {
+				blocked = append(blocked, map[string]interface{}{
+					"todo_id":    todo.ID,
+					"content":    todo.Content,
+					"waiting_on": blockers,
+				})
+				continue
+			}
+			candidates = append(candidates, todoCandidate{project: project, todo: todo, index: i, total: len(todoData.Todos)})
+		}
+	}
+
+	if len(candidates) == 0 {
+		if open == 0 {
+			return JSONString(map[string]interface{}{
+				"status":     "all_done",
+				"project_id": projectID,
+				"message":    "没有未完成的待办，可以调用 archive_project 归档项目",
+			}), nil
+		}
+		return JSONString(map[string]interface{}{
+			"status":  "blocked",
+			"blocked": blocked,
+			"message": "剩余待办都在等待未完成（或失败）的依赖，请先处理依赖或调整计划",
+		}), nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i].todo, candidates[j].todo
+		if (a.Status == todoStatusInProgress) != (b.Status == todoStatusInProgress) {
+			return a.Status == todoStatusInProgress
+		}
+		if pa, pb := priorityRank(a.Priority), priorityRank(b.Priority); pa != pb {
+			return pa < pb
+		}
+		if a.DueAt.IsZero() != b.DueAt.IsZero() {
+			return !a.DueAt.IsZero()
+		}
+		return a.DueAt.Before(b.DueAt)
+	})
+
+	next := candidates[0]
+	return JSONString(map[string]interface{}{
+		"status":       "next",
+		"project_id":   next.project.ID,
+		"project_name": next.project.Name,
+		"todo":         next.todo,
+		"step":         fmt.Sprintf("%d/%d", next.index+1, next.total),
+		"remaining":    open,
+		"blocked":      len(blocked),
+	}), nil
+}
+
 func (t *TodoTool) moveProjectFileToArchive(projectID string) error {
 	currentPath := t.getProjectFilePath(projectID, false)
 	archivePath := t.getProjectFilePath(projectID, true)
@@ -789,9 +1186,57 @@ func (t *TodoTool) removeProjectFiles(projectID string) error {
 	return nil
 }
 
+// scheduleReminder 为待办调度到期提醒（以 todoReminderPrefix+待办ID 为任务ID，会替换已有的提醒）
+// 没有定时任务服务、待办已结束、没有截止时间或截止时间已过、没有来源聊天时不调度，返回 false
+func (t *TodoTool) scheduleReminder(todo TodoItem) bool {
+	if t.cron == nil || !todoIsOpen(todo) || todo.DueAt.IsZero() || !todo.DueAt.After(time.Now()) {
+		return false
+	}
+	if todo.Channel == "" || todo.ChatID == "" {
+		return false
+	}
+
+	t.cron.RemoveJob(todoReminderPrefix + todo.ID)
+	t.cron.AddJob(&cron.Job{
+		ID:             todoReminderPrefix + todo.ID,
+		Name:           "待办提醒: " + todo.Content,
+		Message:        fmt.Sprintf("⏰ 待办提醒：%s\n截止时间：%s", todo.Content, todo.DueAt.Local().Format(todoDueLayout)),
+		Schedule:       cron.Schedule{Kind: "at", AtMs: todo.DueAt.UnixMilli()},
+		Channel:        todo.Channel,
+		To:             todo.ChatID,
+		Deliver:        true,
+		DeleteAfterRun: true,
+	})
+	return true
+}
+
+// cancelReminder 取消待办的到期提醒
+func (t *TodoTool) cancelReminder(todoID string) {
+	if t.cron != nil {
+		t.cron.RemoveJob(todoReminderPrefix + todoID)
+	}
+}
+
+// cancelProjectReminders 取消项目中所有待办的到期提醒（归档或删除项目时调用）
+func (t *TodoTool) cancelProjectReminders(projectID string) {
+	if t.cron == nil {
+		return
+	}
+	todoData, err := t.loadProjectTodos(projectID)
+	if err != nil {
+		return
+	}
+	for _, todo := range todoData.Todos {
+		t.cancelReminder(todo.ID)
+	}
+}
+
 type todoInput struct {
-	Content  string
-	Priority string
+	Content    string
+	Priority   string
+	DueAt      time.Time
+	Recurrence string
+	DependsOn  []interface{} // 待办ID，或同一批中的序号（数字或数字字符串）
 }
 
 func parseTodoInputs(value interface{}) ([]todoInput, int, error) {
@@ -839,12 +1284,205 @@ func parseTodoInputs(value interface{}) ([]todoInput, int, error) {
 			continue
 		}
 		priority, _ := todoMap["priority"].(string)
-		inputs = append(inputs, todoInput{Content: content, Priority: priority})
+		input := todoInput{Content: content, Priority: priority}
+		if due, _ := todoMap["due_at"].(string); strings.TrimSpace(due) != "" {
+			parsed, err := parseTodoDue(due)
+			if err != nil {
+				return nil, 0, fmt.Errorf("待办 %q: %w", content, err)
+			}
+			input.DueAt = parsed
+		}
+		if recurrence, _ := todoMap["recurrence"].(string); recurrence != "" {
+			normalized, err := normalizeRecurrence(recurrence)
+			if err != nil {
+				return nil, 0, fmt.Errorf("待办 %q: %w", content, err)
+			}
+			if normalized != "" && input.DueAt.IsZero() {
+				return nil, 0, fmt.Errorf("待办 %q: 重复待办需要 due_at", content)
+			}
+			input.Recurrence = normalized
+		}
+		switch deps := todoMap["depends_on"].(type) {
+		case []interface{}:
+			input.DependsOn = deps
+		case []string:
+			for _, dep := range deps {
+				input.DependsOn = append(input.DependsOn, dep)
+			}
+		case string, float64:
+			input.DependsOn = []interface{}{deps}
+		}
+		inputs = append(inputs, input)
 	}
 
 	return inputs, skipped, nil
 }
 
+// resolveTodoDependencies 把 add_todos 中的 depends_on 解析为待办ID
+// 数字（或数字字符串）表示同一批 todos 中的序号（从 1 开始，只能依赖排在前面的待办），其他字符串表示项目中已有的待办ID
+// 参数:
+//
+//	deps: depends_on 原始值
+//	position: 当前待办在这一批中的位置（从 0 开始）
+//	batchIDs: 这一批中已经生成的待办ID
+//	todoData: 项目当前的待办数据
+//
+// 返回:
+//
+//	依赖的待办ID列表
+func resolveTodoDependencies(deps []interface{}, position int, batchIDs []string, todoData *TodoListData) ([]string, error) {
+	var ids []string
+	for _, dep := range deps {
+		if s, ok := dep.(string); ok {
+			if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+				dep = float64(n)
+			}
+		}
+
+		var id string
+		switch v := dep.(type) {
+		case float64:
+			n := int(v)
+			if n < 1 || n > position {
+				return nil, fmt.Errorf("depends_on 序号 %d 无效，只能依赖同一批中排在它前面的待办", n)
+			}
+			id = batchIDs[n-1]
+		case string:
+			id = strings.TrimSpace(v)
+			if todoIndexByID(todoData, id) < 0 && !containsString(batchIDs, id) {
+				return nil, fmt.Errorf("depends_on 中的待办不存在: %s", id)
+			}
+		default:
+			continue
+		}
+		if id != "" && !containsString(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// todoStatusByID 返回待办ID到状态的映射
+func todoStatusByID(todos []TodoItem) map[string]string {
+	statuses := make(map[string]string, len(todos))
+	for _, todo := range todos {
+		statuses[todo.ID] = todo.Status
+	}
+	return statuses
+}
+
+// todoBlockers 返回待办尚未完成的依赖（已删除的依赖视为完成）
+func todoBlockers(todo TodoItem, statuses map[string]string) []string {
+	var blockers []string
+	for _, dep := range todo.DependsOn {
+		if status, ok := statuses[dep]; ok && status != todoStatusCompleted {
+			blockers = append(blockers, dep)
+		}
+	}
+	return blockers
+}
+
+// priorityRank 返回优先级的排序值（越小越优先）
+func priorityRank(priority string) int {
+	switch priority {
+	case todoPriorityHigh:
+		return 0
+	case todoPriorityLow:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func removeString(list []string, value string) []string {
+	result := list[:0]
+	for _, item := range list {
+		if item != value {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// todoDueLayout 是显示截止时间的格式
+const todoDueLayout = "2006-01-02 15:04"
+
+// parseTodoDue 解析本地时间的截止时间，只有日期时取当天 09:00
+func parseTodoDue(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed.Local(), nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", todoDueLayout} {
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+	if parsed, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return parsed.Add(9 * time.Hour), nil
+	}
+	return time.Time{}, fmt.Errorf("无效的截止时间 %q，请使用 YYYY-MM-DDTHH:MM 或 YYYY-MM-DD", value)
+}
+
+// normalizeRecurrence 校验重复规则，"none" 或空字符串表示不重复
+func normalizeRecurrence(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "none":
+		return "", nil
+	case todoRecurrenceDaily:
+		return todoRecurrenceDaily, nil
+	case todoRecurrenceWeekly:
+		return todoRecurrenceWeekly, nil
+	case todoRecurrenceMonthly:
+		return todoRecurrenceMonthly, nil
+	default:
+		return "", fmt.Errorf("无效的重复规则 %q，请使用: daily, weekly, monthly, none", value)
+	}
+}
+
+// nextTodoDue 计算重复待办的下一个截止时间（晚于 now 的第一个周期）
+func nextTodoDue(due time.Time, recurrence string, now time.Time) time.Time {
+	for i := 1; ; i++ {
+		var next time.Time
+		switch recurrence {
+		case todoRecurrenceWeekly:
+			next = due.AddDate(0, 0, 7*i)
+		case todoRecurrenceMonthly:
+			next = due.AddDate(0, i, 0)
+		default:
+			next = due.AddDate(0, 0, i)
+		}
+		if next.After(now) {
+			return next
+		}
+	}
+}
+
+// todoIsOpen 判断待办是否未结束（pending 或 in_progress）
+func todoIsOpen(todo TodoItem) bool {
+	return todo.Status == todoStatusPending || todo.Status == todoStatusInProgress
+}
+
+// todoDueLabel 返回显示在待办内容后的截止时间说明
+func todoDueLabel(todo TodoItem) string {
+	if todo.DueAt.IsZero() {
+		return ""
+	}
+	label := " （截止 " + todo.DueAt.Local().Format(todoDueLayout)
+	switch todo.Recurrence {
+	case todoRecurrenceDaily:
+		label += "，每天重复"
+	case todoRecurrenceWeekly:
+		label += "，每周重复"
+	case todoRecurrenceMonthly:
+		label += "，每月重复"
+	}
+	if todoIsOpen(todo) && todo.DueAt.Before(time.Now()) {
+		label += "，已逾期"
+	}
+	return label + "）"
+}
+
 func calculateStats(todos []TodoItem) ProjectStats {
 	stats := ProjectStats{Total: len(todos)}
 	for _, todo := range todos {
@@ -919,8 +1557,8 @@ func stringParam(params map[string]interface{}, name string) string {
 	return strings.TrimSpace(value)
 }
 
-func todoError(message string) string {
-	return JSONString(map[string]interface{}{"error": message})
+func todoError(message string) (string, error) {
+	return "", errors.New(message)
 }
 
 func writeProjectLine(builder *strings.Builder, project Project) {
@@ -935,7 +1573,7 @@ func writeProjectLine(builder *strings.Builder, project Project) {
 	}
 }
 
-func writeTodoSection(builder *strings.Builder, title string, todos []TodoItem) {
+func writeTodoSection(builder *strings.Builder, title string, todos []TodoItem, statuses map[string]string) {
 	if len(todos) == 0 {
 		return
 	}
@@ -947,8 +1585,11 @@ func writeTodoSection(builder *strings.Builder, title string, todos []TodoItem)
 		if todo.Status == todoStatusCompleted {
 			content = "~~" + content + "~~"
 		}
-		builder.WriteString(fmt.Sprintf("- %s `%s` **[%s]** %s\n",
-			priorityIcon(todo.Priority), todo.ID, todo.Status, content))
+		builder.WriteString(fmt.Sprintf("- %s `%s` **[%s]** %s%s\n",
+			priorityIcon(todo.Priority), todo.ID, todo.Status, content, todoDueLabel(todo)))
+		if blockers := todoBlockers(todo, statuses); todoIsOpen(todo) && len(blockers) > 0 {
+			builder.WriteString(fmt.Sprintf("  - ⛔ 等待: `%s`\n", strings.Join(blockers, "`, `")))
+		}
 	}
 	builder.WriteString("\n")
 }
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// userprofile.go - 用户档案（USER.md）维护工具
+// 记忆整理时模型可以根据对话提出 USER.md 的更新（偏好、时区、常联系的人等），
+// 让 Bootstrap 文件随使用逐渐完善，而不是一直保持初始内容。
+// 默认只保存为待确认的提议（USER.md.proposed），由管理员用 /profile accept 接受；
+// 配置为自动接受时直接写入 USER.md。
+
+// UserProfileFile 用户档案文件名（位于工作区根目录）
+const UserProfileFile = "USER.md"
+
+// proposedSuffix 待确认提议的文件名后缀
+const proposedSuffix = ".proposed"
+
+// SaveUserProfileTool 保存或提议更新用户档案
+type SaveUserProfileTool struct {
+	BaseTool
+	path       string // USER.md 的路径
+	autoAccept bool   // 是否直接写入（false 表示保存为待确认的提议）
+}
+
+// NewSaveUserProfileTool 创建用户档案工具
+// 参数:
+//
+//	workspace: 工作区路径（USER.md 所在目录）
+//	autoAccept: 为 true 时直接更新 USER.md，否则保存为待确认的提议
+func NewSaveUserProfileTool(workspace string, autoAccept bool) *SaveUserProfileTool {
+	return &SaveUserProfileTool{
+		BaseTool: NewBaseTool(
+			"save_user_profile",
+			"Update the user profile (USER.md) with durable facts about the user: preferences, timezone, language, recurring contacts, projects. Only call this when something new and lasting was learned; do not store one-off requests or secrets.",
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"profile": map[string]interface{}{
+						"type":        "string",
+						"description": "Full updated USER.md as markdown. Keep all existing content that is still true and add or correct facts.",
+					},
+					"changes": map[string]interface{}{
+						"type":        "string",
+						"description": "One or two sentences describing what changed and why, shown to the user for confirmation.",
+					},
+				},
+				"required": []string{"profile", "changes"},
+			},
+		),
+		path:       filepath.Join(workspace, UserProfileFile),
+		autoAccept: autoAccept,
+	}
+}
+
+// AutoAccept 返回更新是否直接写入 USER.md
+func (t *SaveUserProfileTool) AutoAccept() bool {
+	return t.autoAccept
+}
+
+// Execute 更新用户档案或保存提议
+func (t *SaveUserProfileTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	profile, _ := params["profile"].(string)
+	changes, _ := params["changes"].(string)
+	if strings.TrimSpace(profile) == "" {
+		return "", fmt.Errorf("profile is required")
+	}
+
+	current, _ := os.ReadFile(t.path)
+	if strings.TrimSpace(string(current)) == strings.TrimSpace(profile) {
+		return "User profile unchanged", nil
+	}
+
+	if t.autoAccept {
+		if err := os.WriteFile(t.path, []byte(profile), 0644); err != nil {
+			return "", fmt.Errorf("failed to save user profile: %w", err)
+		}
+		return "User profile updated: " + changes, nil
+	}
+
+	if err := os.WriteFile(t.path+proposedSuffix, []byte(profile), 0644); err != nil {
+		return "", fmt.Errorf("failed to save user profile proposal: %w", err)
+	}
+	return "User profile update proposed (waiting for the user to confirm with /profile accept): " + changes, nil
+}
+
+// Pending 返回待确认的提议
+// 返回:
+//
+//	提议的 USER.md 内容，没有提议时第二个返回值为 false
+func (t *SaveUserProfileTool) Pending() (string, bool) {
+	data, err := os.ReadFile(t.path + proposedSuffix)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// Accept 用待确认的提议替换 USER.md
+func (t *SaveUserProfileTool) Accept() error {
+	proposed, ok := t.Pending()
+	if !ok {
+		return fmt.Errorf("no pending user profile update")
+	}
+	if err := os.WriteFile(t.path, []byte(proposed), 0644); err != nil {
+		return err
+	}
+	return os.Remove(t.path + proposedSuffix)
+}
+
+// Reject 丢弃待确认的提议
+func (t *SaveUserProfileTool) Reject() error {
+	err := os.Remove(t.path + proposedSuffix)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no pending user profile update")
+	}
+	return err
+}
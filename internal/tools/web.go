@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"strings"
@@ -13,22 +14,39 @@ import (
 )
 
 // web.go - Web搜索工具
-// 此文件实现了 WebSearchTool，支持 Tavily 搜索
+// 此文件实现了 WebSearchTool，支持 Tavily、Brave、SearXNG、Google Custom Search 和 DuckDuckGo
 
 // WebSearchTool 提供网络搜索功能
-// 使用 Tavily Search API
+// 支持的提供商：
+//   - tavily / brave: 需要 API Key
+//   - searxng: 自建 SearXNG 实例，需要 baseURL（实例需开启 JSON 格式输出）
+//   - google: Google Custom Search，需要 API Key 和搜索引擎 ID（cx）
+//   - duckduckgo: 无需 Key，解析 DuckDuckGo 的 HTML 结果页
+//
+// 主提供商未配置或请求失败时，可以退回到 DuckDuckGo
 type WebSearchTool struct {
 	BaseTool
 	apiKey     string       // API密钥
 	provider   string       // 搜索提供商
 	maxResults int          // 最多返回的搜索结果数量
+	baseURL    string       // SearXNG 实例地址
+	engineID   string       // Google Custom Search 搜索引擎 ID（cx）
+	fallback   string       // 备用提供商（目前只支持 duckduckgo，空表示不退回）
 	httpClient *http.Client // HTTP客户端，配置了超时时间
 }
 
+// searchResult 是统一的搜索结果格式
+type searchResult struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+}
+
 // NewWebSearchTool 创建一个新的网络搜索工具
 // 参数:
 //
-//	apiKey: Tavily API 密钥
+//	apiKey: 搜索提供商的 API 密钥（searxng 和 duckduckgo 不需要）
+//	provider: 搜索提供商（tavily、brave、searxng、google、duckduckgo）
 //	maxResults: 最多返回的搜索结果数量
 //
 // 返回:
@@ -65,8 +83,63 @@ func NewWebSearchTool(apiKey string, provider string, maxResults int) *WebSearch
 	}
 }
 
+// SetBaseURL 设置 SearXNG 实例地址
+func (t *WebSearchTool) SetBaseURL(baseURL string) {
+	t.baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+}
+
+// SetEngineID 设置 Google Custom Search 的搜索引擎 ID（cx）
+func (t *WebSearchTool) SetEngineID(engineID string) {
+	t.engineID = strings.TrimSpace(engineID)
+}
+
+// SetFallback 设置备用提供商
+// 参数:
+//
+//	fallback: "duckduckgo" 或空字符串（不退回）
+func (t *WebSearchTool) SetFallback(fallback string) {
+	fallback = strings.ToLower(strings.TrimSpace(fallback))
+	if fallback == "none" {
+		fallback = ""
+	}
+	t.fallback = fallback
+}
+
+// Ready 检查搜索工具是否可用
+// 返回:
+//
+//	主提供商和备用提供商都不可用时返回原因
+func (t *WebSearchTool) Ready() error {
+	if err := t.checkProvider(); err != nil && t.fallback != "duckduckgo" {
+		return err
+	}
+	return nil
+}
+
+// checkProvider 检查主提供商的配置是否完整
+func (t *WebSearchTool) checkProvider() error {
+	switch t.provider {
+	case "tavily", "brave":
+		if t.apiKey == "" {
+			return fmt.Errorf("web search API key not configured for %s", t.provider)
+		}
+	case "google":
+		if t.apiKey == "" || t.engineID == "" {
+			return fmt.Errorf("google search requires apiKey and cx")
+		}
+	case "searxng":
+		if t.baseURL == "" {
+			return fmt.Errorf("searxng requires baseUrl")
+		}
+	case "duckduckgo":
+	default:
+		return fmt.Errorf("unsupported web search provider: %s", t.provider)
+	}
+	return nil
+}
+
 // Execute 执行网络搜索
-// 使用 Tavily Search API
+// 主提供商未配置或请求失败时，如果设置了备用提供商则改用 DuckDuckGo
 // 参数:
 //
 //	ctx: 上下文对象
@@ -82,18 +155,46 @@ func (t *WebSearchTool) Execute(ctx context.Context, params map[string]interface
 		return "", fmt.Errorf("missing or invalid query parameter")
 	}
 
-	// 检查API密钥
-	if t.apiKey == "" {
-		return "", fmt.Errorf("web search API key not configured")
+	err := t.checkProvider()
+	if err == nil {
+		var result string
+		result, err = t.search(ctx, t.provider, query)
+		if err == nil {
+			return result, nil
+		}
 	}
 
-	switch t.provider {
+	if t.fallback == "duckduckgo" && t.provider != "duckduckgo" {
+		log.Printf("[WebSearch] %s 不可用，退回到 DuckDuckGo: %v", t.provider, err)
+		return t.search(ctx, "duckduckgo", query)
+	}
+	return "", err
+}
+
+// Check 用主提供商执行一次测试搜索，校验 API 密钥和服务地址（不使用备用提供商）
+func (t *WebSearchTool) Check(ctx context.Context) error {
+	if err := t.checkProvider(); err != nil {
+		return err
+	}
+	_, err := t.search(ctx, t.provider, "nanogrip")
+	return err
+}
+
+// search 使用指定的提供商执行搜索
+func (t *WebSearchTool) search(ctx context.Context, provider string, query string) (string, error) {
+	switch provider {
 	case "tavily":
 		return t.searchTavily(ctx, query)
 	case "brave":
 		return t.searchBrave(ctx, query)
+	case "searxng":
+		return t.searchSearXNG(ctx, query)
+	case "google":
+		return t.searchGoogle(ctx, query)
+	case "duckduckgo":
+		return t.searchDuckDuckGo(ctx, query)
 	default:
-		return "", fmt.Errorf("unsupported web search provider: %s", t.provider)
+		return "", fmt.Errorf("unsupported web search provider: %s", provider)
 	}
 }
 
@@ -118,7 +219,7 @@ func (t *WebSearchTool) searchBrave(ctx context.Context, query string) (string,
 
 	resp, err := t.httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return "", transientNetwork(err)
 	}
 	defer resp.Body.Close()
 
@@ -127,7 +228,11 @@ func (t *WebSearchTool) searchBrave(ctx context.Context, query string) (string,
 		return "", err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("Brave API returned status %d: %s", resp.StatusCode, string(body))
+		err := fmt.Errorf("Brave API returned status %d: %s", resp.StatusCode, string(body))
+		if transientStatus(resp.StatusCode) {
+			err = Transient(err)
+		}
+		return "", err
 	}
 
 	var result struct {
@@ -181,7 +286,7 @@ func (t *WebSearchTool) searchTavily(ctx context.Context, query string) (string,
 
 	resp, err := t.httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return "", transientNetwork(err)
 	}
 	defer resp.Body.Close()
 
@@ -191,7 +296,11 @@ func (t *WebSearchTool) searchTavily(ctx context.Context, query string) (string,
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("Tavily API returned status %d: %s", resp.StatusCode, string(body))
+		err := fmt.Errorf("Tavily API returned status %d: %s", resp.StatusCode, string(body))
+		if transientStatus(resp.StatusCode) {
+			err = Transient(err)
+		}
+		return "", err
 	}
 
 	// Tavily 响应格式
@@ -220,3 +329,170 @@ func (t *WebSearchTool) searchTavily(ctx context.Context, query string) (string,
 	b, _ := json.Marshal(output)
 	return string(b), nil
 }
+
+// searchSearXNG 查询自建的 SearXNG 实例
+// 实例的 settings.yml 需要在 search.formats 中启用 json
+func (t *WebSearchTool) searchSearXNG(ctx context.Context, query string) (string, error) {
+	values := url.Values{}
+	values.Set("q", query)
+	values.Set("format", "json")
+
+	body, err := t.get(ctx, t.baseURL+"/search?"+values.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("SearXNG: %w", err)
+	}
+
+	var result struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("SearXNG returned invalid JSON (is the json format enabled?): %w", err)
+	}
+
+	output := make([]searchResult, 0, t.maxResults)
+	for _, r := range result.Results {
+		if len(output) >= t.maxResults {
+			break
+		}
+		output = append(output, searchResult{Title: r.Title, Description: r.Content, URL: r.URL})
+	}
+
+	b, _ := json.Marshal(output)
+	return string(b), nil
+}
+
+// searchGoogle 使用 Google Custom Search JSON API
+func (t *WebSearchTool) searchGoogle(ctx context.Context, query string) (string, error) {
+	num := t.maxResults
+	if num > 10 {
+		num = 10 // API 单次最多返回 10 条
+	}
+
+	values := url.Values{}
+	values.Set("key", t.apiKey)
+	values.Set("cx", t.engineID)
+	values.Set("q", query)
+	values.Set("num", fmt.Sprintf("%d", num))
+
+	body, err := t.get(ctx, "https://www.googleapis.com/customsearch/v1?"+values.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("Google Custom Search: %w", err)
+	}
+
+	var result struct {
+		Items []struct {
+			Title   string `json:"title"`
+			Link    string `json:"link"`
+			Snippet string `json:"snippet"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+
+	output := make([]searchResult, 0, len(result.Items))
+	for _, r := range result.Items {
+		output = append(output, searchResult{Title: r.Title, Description: r.Snippet, URL: r.Link})
+	}
+
+	b, _ := json.Marshal(output)
+	return string(b), nil
+}
+
+// searchDuckDuckGo 解析 DuckDuckGo 的 HTML 结果页（无需 API Key）
+func (t *WebSearchTool) searchDuckDuckGo(ctx context.Context, query string) (string, error) {
+	values := url.Values{}
+	values.Set("q", query)
+
+	body, err := t.get(ctx, "https://html.duckduckgo.com/html/?"+values.Encode(), map[string]string{
+		"User-Agent": "Mozilla/5.0 (compatible; nanogrip/1.0)",
+	})
+	if err != nil {
+		return "", fmt.Errorf("DuckDuckGo: %w", err)
+	}
+
+	root := parseHTML(string(body))
+	output := make([]searchResult, 0, t.maxResults)
+	for _, node := range root.findAll(func(n *htmlNode) bool { return n.hasClass("result") }) {
+		if len(output) >= t.maxResults {
+			break
+		}
+		if node.hasClass("result--ad") {
+			continue
+		}
+		link := node.find(func(n *htmlNode) bool { return n.hasClass("result__a") })
+		if link == nil {
+			continue
+		}
+		snippet := node.find(func(n *htmlNode) bool { return n.hasClass("result__snippet") })
+
+		r := searchResult{
+			Title: strings.TrimSpace(collapseSpaces(link.textContent())),
+			URL:   duckDuckGoTarget(link.attrs["href"]),
+		}
+		if snippet != nil {
+			r.Description = strings.TrimSpace(collapseSpaces(snippet.textContent()))
+		}
+		if r.URL != "" {
+			output = append(output, r)
+		}
+	}
+
+	b, _ := json.Marshal(output)
+	return string(b), nil
+}
+
+// duckDuckGoTarget 从 DuckDuckGo 的跳转链接中取出真实地址
+// 例如 "//duckduckgo.com/l/?uddg=https%3A%2F%2Fexample.com%2F&rut=..." -> "https://example.com/"
+func duckDuckGoTarget(href string) string {
+	if strings.HasPrefix(href, "//") {
+		href = "https:" + href
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	if target := u.Query().Get("uddg"); target != "" {
+		return target
+	}
+	return href
+}
+
+// get 发送 GET 请求并返回响应体，非 200 状态码视为错误
+func (t *WebSearchTool) get(ctx context.Context, requestURL string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, text/html;q=0.9")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, transientNetwork(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		snippet := string(body)
+		if len(snippet) > 300 {
+			snippet = snippet[:300] + "..."
+		}
+		err := fmt.Errorf("status %d: %s", resp.StatusCode, snippet)
+		if transientStatus(resp.StatusCode) {
+			err = Transient(err)
+		}
+		return nil, err
+	}
+	return body, nil
+}
@@ -0,0 +1,223 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// webfetch.go - 网页抓取工具
+// 此文件实现了 WebFetchTool：下载网页、去除导航/广告等样板内容，并转换为 Markdown 供模型阅读
+
+const (
+	defaultFetchMaxBytes = 2 * 1024 * 1024 // 默认最多下载 2MB
+	defaultFetchMaxChars = 20000           // 默认最多返回 20000 个字符
+	maxFetchRedirects    = 10              // 最多跟随的重定向次数
+)
+
+// WebFetchTool 提供网页抓取功能
+// 支持 HTML（转换为 Markdown）、纯文本和 JSON
+type WebFetchTool struct {
+	BaseTool
+	maxBytes   int64        // 最多下载的字节数
+	maxChars   int          // 默认返回的最大字符数
+	httpClient *http.Client // HTTP客户端，配置了超时和重定向限制
+}
+
+// NewWebFetchTool 创建一个新的网页抓取工具
+// 参数:
+//
+//	timeout: 请求超时时间（秒）
+//	maxBytes: 最多下载的字节数（<= 0 使用默认值 2MB）
+//	maxChars: 默认返回的最大字符数（<= 0 使用默认值 20000）
+//
+// 返回:
+//
+//	配置好的WebFetchTool实例
+func NewWebFetchTool(timeout int, maxBytes int, maxChars int) *WebFetchTool {
+	if timeout <= 0 {
+		timeout = 30
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultFetchMaxBytes
+	}
+	if maxChars <= 0 {
+		maxChars = defaultFetchMaxChars
+	}
+
+	return &WebFetchTool{
+		BaseTool: NewBaseTool(
+			"web_fetch",
+			"Fetch a web page and return its main content as Markdown (navigation, ads and scripts are removed). Use this to read a page found via web_search or a URL the user shared. Use 'extract' with a CSS selector to get only part of the page.",
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"url": map[string]interface{}{
+						"type":        "string",
+						"description": "The http(s) URL to fetch",
+					},
+					"extract": map[string]interface{}{
+						"type":        "string",
+						"description": "Optional CSS selector; only matching elements are returned (supports tag, #id, .class, [attr=value], descendant and > combinators, e.g. 'article .content' or 'table#prices')",
+					},
+					"max_chars": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("Maximum characters to return (default %d)", maxChars),
+					},
+					"start": map[string]interface{}{
+						"type":        "integer",
+						"description": "Character offset to start from, to continue reading a truncated page",
+					},
+				},
+				"required": []string{"url"},
+			},
+		),
+		maxBytes: int64(maxBytes),
+		maxChars: maxChars,
+		httpClient: &http.Client{
+			Timeout: time.Duration(timeout) * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxFetchRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// Execute 抓取网页
+// 参数:
+//
+//	ctx: 上下文对象
+//	params: 参数map，必须包含"url"，可选"extract"、"max_chars"和"start"
+//
+// 返回:
+//
+//	页面地址、标题和 Markdown 正文
+func (t *WebFetchTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	rawURL, _ := params["url"].(string)
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", fmt.Errorf("missing url parameter")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return "", fmt.Errorf("invalid url: only http and https URLs are supported")
+	}
+
+	extract, _ := params["extract"].(string)
+	maxChars := t.maxChars
+	if v, ok := params["max_chars"].(float64); ok && v > 0 {
+		maxChars = int(v)
+	}
+	start := 0
+	if v, ok := params["start"].(float64); ok && v > 0 {
+		start = int(v)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", target.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; nanogrip/1.0; +https://github.com/Ailoc/nanogrip)")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain,application/json;q=0.9,*/*;q=0.5")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return "", transientNetwork(err)
+	}
+	defer resp.Body.Close()
+
+	expected := resp.ContentLength
+	if expected > t.maxBytes {
+		expected = t.maxBytes
+	}
+	reader := &progressReader{ctx: ctx, r: resp.Body, total: expected}
+	body, err := io.ReadAll(io.LimitReader(reader, t.maxBytes+1))
+	if err != nil {
+		return "", err
+	}
+	truncatedDownload := int64(len(body)) > t.maxBytes
+	if truncatedDownload {
+		body = body[:t.maxBytes]
+	}
+
+	finalURL := resp.Request.URL
+	if resp.StatusCode >= 400 {
+		snippet := strings.TrimSpace(string(body))
+		if len(snippet) > 300 {
+			snippet = snippet[:300] + "..."
+		}
+		err := fmt.Errorf("HTTP %d fetching %s: %s", resp.StatusCode, finalURL, snippet)
+		if transientStatus(resp.StatusCode) {
+			err = Transient(err)
+		}
+		return "", err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "" {
+		mediaType = http.DetectContentType(body)
+		mediaType, _, _ = mime.ParseMediaType(mediaType)
+	}
+
+	text := strings.ToValidUTF8(string(body), "")
+	title := ""
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		title, text, err = htmlToMarkdown(text, finalURL, extract)
+		if err != nil {
+			return "", err
+		}
+	case strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") || mediaType == "application/xml":
+		if extract != "" {
+			return "", fmt.Errorf("'extract' is only supported for HTML pages (got %s)", mediaType)
+		}
+	default:
+		return "", fmt.Errorf("unsupported content type %q (%d bytes); web_fetch only reads HTML, text and JSON", mediaType, len(body))
+	}
+
+	// 按字符分页返回
+	total := utf8.RuneCountInString(text)
+	if start > 0 {
+		if start >= total {
+			return fmt.Sprintf("URL: %s\n\n(start %d is beyond the end of the content, %d characters)", finalURL, start, total), nil
+		}
+		text = string([]rune(text)[start:])
+	}
+	remaining := 0
+	if utf8.RuneCountInString(text) > maxChars {
+		runes := []rune(text)
+		remaining = len(runes) - maxChars
+		text = string(runes[:maxChars])
+	}
+
+	var sb strings.Builder
+	sb.WriteString("URL: " + finalURL.String() + "\n")
+	if title != "" {
+		sb.WriteString("Title: " + title + "\n")
+	}
+	sb.WriteString("\n")
+	if strings.TrimSpace(text) == "" {
+		sb.WriteString("(no readable content found; try a different 'extract' selector)")
+	} else {
+		sb.WriteString(text)
+	}
+	if remaining > 0 {
+		sb.WriteString(fmt.Sprintf("\n\n[Truncated: %d more characters. Call web_fetch again with start=%d to continue.]", remaining, start+maxChars))
+	}
+	if truncatedDownload {
+		sb.WriteString(fmt.Sprintf("\n\n[Download stopped at %d bytes; the page is larger.]", t.maxBytes))
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,209 @@
+package trace
+
+// otlp.go - 以 OTLP/HTTP（JSON 编码）导出 span
+// 不依赖 OpenTelemetry SDK，按 OTLP 协议直接把 span 批量 POST 到收集器
+// （例如 OpenTelemetry Collector、Jaeger 或 Grafana Tempo 的 http://localhost:4318/v1/traces）。
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// exportBatchSize 每批最多导出的 span 数量
+	exportBatchSize = 100
+	// exportInterval 导出间隔
+	exportInterval = 5 * time.Second
+)
+
+// exporter 是当前使用的导出器（nil 表示不导出）
+var exporter atomic.Pointer[Exporter]
+
+// currentExporter 返回当前使用的导出器
+func currentExporter() *Exporter {
+	return exporter.Load()
+}
+
+// Exporter 把结束的 span 批量导出到 OTLP/HTTP 收集器
+type Exporter struct {
+	endpoint    string
+	serviceName string
+	headers     map[string]string
+	client      *http.Client
+	queue       chan *Span
+	dropped     atomic.Int64 // 队列满时丢弃的 span 数量
+}
+
+// NewExporter 创建导出器
+// 参数:
+//
+//	endpoint: 收集器地址（如 "http://localhost:4318/v1/traces"）
+//	serviceName: 服务名称（service.name 资源属性）
+//	headers: 附加的请求头（例如认证令牌）
+func NewExporter(endpoint, serviceName string, headers map[string]string) *Exporter {
+	return &Exporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		headers:     headers,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan *Span, 1000),
+	}
+}
+
+// Run 设置为当前导出器并定期导出 span，直到 ctx 被取消（退出前导出剩余的 span）
+func (e *Exporter) Run(ctx context.Context) {
+	exporter.Store(e)
+	defer exporter.CompareAndSwap(e, nil)
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			log.Printf("[Trace] 导出 %d 个 span 失败: %v", len(batch), err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= exportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			if n := e.dropped.Swap(0); n > 0 {
+				log.Printf("[Trace] 导出队列已满，丢弃了 %d 个 span", n)
+			}
+		}
+	}
+}
+
+// enqueue 把结束的 span 放入导出队列（队列满时丢弃，不阻塞处理流程）
+func (e *Exporter) enqueue(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// export 发送一批 span
+func (e *Exporter) export(spans []*Span) error {
+	otlpSpans := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		otlpSpans = append(otlpSpans, span.otlp())
+	}
+	body := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": e.serviceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "nanogrip"},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
+
+// otlp 把 span 转换为 OTLP JSON 格式
+func (s *Span) otlp() map[string]interface{} {
+	s.mu.Lock()
+	attrs := otlpAttributes(s.attrs)
+	s.mu.Unlock()
+
+	span := map[string]interface{}{
+		"traceId":           s.traceID,
+		"spanId":            s.spanID,
+		"name":              s.name,
+		"kind":              1, // SPAN_KIND_INTERNAL
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        attrs,
+	}
+	if s.parentID != "" {
+		span["parentSpanId"] = s.parentID
+	}
+	if s.err != nil {
+		span["status"] = map[string]interface{}{"code": 2, "message": s.err.Error()} // STATUS_CODE_ERROR
+	} else {
+		span["status"] = map[string]interface{}{"code": 1} // STATUS_CODE_OK
+	}
+	return span
+}
+
+// otlpAttributes 把属性转换为 OTLP 的 KeyValue 列表
+func otlpAttributes(attrs map[string]interface{}) []interface{} {
+	list := make([]interface{}, 0, len(attrs))
+	for key, value := range attrs {
+		var v map[string]interface{}
+		switch val := value.(type) {
+		case string:
+			v = map[string]interface{}{"stringValue": val}
+		case bool:
+			v = map[string]interface{}{"boolValue": val}
+		case int:
+			v = map[string]interface{}{"intValue": strconv.Itoa(val)}
+		case int64:
+			v = map[string]interface{}{"intValue": strconv.FormatInt(val, 10)}
+		case float64:
+			v = map[string]interface{}{"doubleValue": val}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(val)}
+		}
+		list = append(list, map[string]interface{}{"key": key, "value": v})
+	}
+	return list
+}
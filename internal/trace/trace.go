@@ -0,0 +1,143 @@
+// Package trace 为每条入站消息生成追踪 ID，用于串联一条消息的完整处理过程
+//
+// 追踪 ID 在消息发布到消息总线时生成，保存在消息元数据的 "trace_id" 中，
+// 随后通过 context 传递给 Agent 迭代、模型调用和工具执行，并随回复的元数据到达出站发送。
+// 相关日志都带有 "[trace=<ID>]" 前缀，排查"这条回复为什么没有发出去"时按 ID 搜索日志即可。
+//
+// 配置了 OTLP 地址时（见 Exporter），各阶段还会作为 OpenTelemetry span 导出，
+// 追踪 ID 和 span ID 的格式与 W3C Trace Context 一致（32 和 16 位十六进制）。
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// MetadataKey 是消息元数据中保存追踪 ID 的键
+const MetadataKey = "trace_id"
+
+// idKey 是 context 中保存追踪 ID 的键
+type idKey struct{}
+
+// spanKey 是 context 中保存当前 span 的键
+type spanKey struct{}
+
+// NewID 生成一个新的追踪 ID（32 位十六进制）
+func NewID() string {
+	return randomHex(16)
+}
+
+// randomHex 生成 n 字节的随机十六进制字符串
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// 随机数不可用时退化为时间戳，仍然可以用于搜索日志
+		return fmt.Sprintf("%0*x", n*2, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithID 把追踪 ID 放入 context（id 为空时原样返回）
+func WithID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// IDFrom 返回 context 中的追踪 ID，没有时返回空字符串
+func IDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// FromMetadata 返回消息元数据中的追踪 ID，没有时返回空字符串
+func FromMetadata(metadata map[string]interface{}) string {
+	id, _ := metadata[MetadataKey].(string)
+	return id
+}
+
+// Logf 记录一条日志，context 中有追踪 ID 时加上 "[trace=<ID>]" 前缀
+func Logf(ctx context.Context, format string, args ...interface{}) {
+	if id := IDFrom(ctx); id != "" {
+		format = "[trace=" + id + "] " + format
+	}
+	log.Printf(format, args...)
+}
+
+// Span 是处理过程中的一个阶段（例如一次模型调用或一次工具执行）
+// 未配置导出时 span 只用于传递追踪 ID，结束时不做任何事
+type Span struct {
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+	end      time.Time
+	err      error
+
+	mu    sync.Mutex
+	attrs map[string]interface{}
+}
+
+// Start 开始一个 span，返回包含该 span 的 context
+// context 中没有追踪 ID 时生成一个新的（例如定时任务触发的处理）
+// 参数:
+//
+//	name: span 名称（如 "llm.chat"、"tool.execute"）
+//	attrs: 属性，按 键, 值, 键, 值... 的顺序传入
+func Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, *Span) {
+	traceID := IDFrom(ctx)
+	if traceID == "" {
+		traceID = NewID()
+		ctx = WithID(ctx, traceID)
+	}
+	span := &Span{
+		traceID: traceID,
+		spanID:  randomHex(8),
+		name:    name,
+		start:   time.Now(),
+		attrs:   make(map[string]interface{}),
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent.traceID == traceID {
+		span.parentID = parent.spanID
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if key, ok := attrs[i].(string); ok {
+			span.attrs[key] = attrs[i+1]
+		}
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SetAttr 设置一个属性
+func (s *Span) SetAttr(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs[key] = value
+}
+
+// End 结束 span 并交给导出器（如果配置了）
+// 参数:
+//
+//	err: 该阶段的错误，nil 表示成功
+func (s *Span) End(err error) {
+	s.end = time.Now()
+	s.err = err
+	if exporter := currentExporter(); exporter != nil {
+		exporter.enqueue(s)
+	}
+}
+
+// Duration 返回 span 的持续时间（未结束时为到现在为止的时间）
+func (s *Span) Duration() time.Duration {
+	if s.end.IsZero() {
+		return time.Since(s.start)
+	}
+	return s.end.Sub(s.start)
+}
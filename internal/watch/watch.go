@@ -0,0 +1,118 @@
+// Package watch 监视工作区中的文件变化
+//
+// 通过定期比较文件的修改时间和大小发现变化（不依赖 inotify 等系统接口，
+// 在所有平台和网络文件系统上行为一致）。监视的路径可以是文件或目录，目录会递归监视其中的所有文件。
+package watch
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultInterval 默认的检查间隔
+const DefaultInterval = 2 * time.Second
+
+// fileState 是文件的修改时间和大小
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watcher 监视一组文件和目录，发现变化时调用 onChange
+type Watcher struct {
+	paths    []string
+	interval time.Duration
+	onChange func(changed []string)
+	state    map[string]fileState
+}
+
+// New 创建文件监视器
+// 参数:
+//
+//	paths: 要监视的文件或目录（不存在的路径也可以，创建后会被发现）
+//	interval: 检查间隔，<= 0 时使用 DefaultInterval
+//	onChange: 发现变化时调用，参数为新增、修改或删除的文件路径（已排序）
+func New(paths []string, interval time.Duration, onChange func(changed []string)) *Watcher {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Watcher{
+		paths:    paths,
+		interval: interval,
+		onChange: onChange,
+	}
+}
+
+// Run 定期检查文件变化，直到 ctx 被取消
+// 启动时记录的状态作为基准，不会触发 onChange
+func (w *Watcher) Run(ctx context.Context) {
+	w.state = w.scan()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if changed := w.Check(); len(changed) > 0 {
+				w.onChange(changed)
+			}
+		}
+	}
+}
+
+// Check 检查一次文件变化并更新记录的状态
+// 返回: 新增、修改或删除的文件路径（已排序）
+func (w *Watcher) Check() []string {
+	current := w.scan()
+	var changed []string
+	for path, st := range current {
+		if old, ok := w.state[path]; !ok || !old.modTime.Equal(st.modTime) || old.size != st.size {
+			changed = append(changed, path)
+		}
+	}
+	for path := range w.state {
+		if _, ok := current[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	w.state = current
+	sort.Strings(changed)
+	return changed
+}
+
+// scan 记录所有被监视文件的当前状态
+func (w *Watcher) scan() map[string]fileState {
+	state := make(map[string]fileState)
+	for _, root := range w.paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			state[root] = fileState{modTime: info.ModTime(), size: info.Size()}
+			continue
+		}
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				state[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+			}
+			return nil
+		})
+	}
+	return state
+}